@@ -0,0 +1,211 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Record describes a single change made to a firewall
+type Record struct {
+	Time         time.Time         `json:"time"`
+	Action       string            `json:"action"`
+	FirewallID   string            `json:"firewall_id"`
+	FirewallName string            `json:"firewall_name,omitempty"`
+	Added        []string          `json:"added,omitempty"`
+	Removed      []string          `json:"removed,omitempty"`
+	Fingerprint  string            `json:"fingerprint,omitempty"` // Fingerprint of the inbound rules after the change
+	Fields       map[string]string `json:"fields,omitempty"`
+	// Labels tell where the added and removed addresses of named networks come from, by address
+	Labels map[string]Label `json:"labels,omitempty"`
+	// TraceID, SpanID and ParentSpanID link the change to the trace of the automation that triggered the run
+	TraceID      string `json:"trace_id,omitempty"`
+	SpanID       string `json:"span_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+}
+
+// Label is the named network an address belongs to and its owner
+type Label struct {
+	Source string `json:"source"`
+	Owner  string `json:"owner,omitempty"`
+}
+
+// fieldsKey is the context key of the fields attached with WithFields
+type fieldsKey struct{}
+
+// labelsKey is the context key of the labels attached with WithLabels
+type labelsKey struct{}
+
+// WithFields returns a context whose firewall changes are audited with the fields, e.g. who
+// triggered them, in addition to any fields already attached
+func WithFields(ctx context.Context, fields map[string]string) context.Context {
+	merged := make(map[string]string, len(fields))
+	for k, v := range FieldsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FieldsFromContext returns the fields attached to ctx with WithFields
+func FieldsFromContext(ctx context.Context) map[string]string {
+	fields, _ := ctx.Value(fieldsKey{}).(map[string]string)
+	return fields
+}
+
+// WithLabels returns a context whose firewall changes label the addresses found in labels
+func WithLabels(ctx context.Context, labels map[string]Label) context.Context {
+	return context.WithValue(ctx, labelsKey{}, labels)
+}
+
+// LabelsFromContext returns the labels attached to ctx with WithLabels
+func LabelsFromContext(ctx context.Context) map[string]Label {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]Label)
+	return labels
+}
+
+// Logger appends audit records as JSON lines to a file
+type Logger struct {
+	path   string
+	fields map[string]string
+	logger *zap.Logger
+	mu     sync.Mutex
+}
+
+// NewLogger creates an audit logger writing to path, attaching the global fields to every
+// record; it returns nil, which discards records, when path is empty
+func NewLogger(path string, fields map[string]string, logger *zap.Logger) *Logger {
+	if path == "" {
+		return nil
+	}
+	return &Logger{
+		path:   path,
+		fields: fields,
+		logger: logger.Named("audit"),
+	}
+}
+
+// Path returns the file path of the audit log
+func (l *Logger) Path() string {
+	return l.path
+}
+
+// Record appends the record to the audit log; a nil logger discards the record
+func (l *Logger) Record(record Record) error {
+	if l == nil {
+		return nil
+	}
+
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	if len(l.fields) > 0 {
+		fields := make(map[string]string, len(l.fields)+len(record.Fields))
+		for k, v := range l.fields {
+			fields[k] = v
+		}
+		for k, v := range record.Fields {
+			fields[k] = v
+		}
+		record.Fields = fields
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if dir := filepath.Dir(l.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return fmt.Errorf("failed to create audit log directory: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", l.path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+
+	l.logger.Debug("Recorded audit entry",
+		zap.String("action", record.Action),
+		zap.String("firewall_id", record.FirewallID))
+
+	return nil
+}
+
+// Last returns the most recent record for the firewall, or nil if there is none; a nil logger
+// always returns nil
+func (l *Logger) Last(firewallID string) (*Record, error) {
+	var last *Record
+	err := l.scan(func(record Record) {
+		if record.FirewallID == firewallID {
+			last = &record
+		}
+	})
+	return last, err
+}
+
+// Since returns the records for the firewall made at or after since, oldest first; a nil logger
+// always returns no records
+func (l *Logger) Since(firewallID string, since time.Time) ([]Record, error) {
+	var records []Record
+	err := l.scan(func(record Record) {
+		if record.FirewallID == firewallID && !record.Time.Before(since) {
+			records = append(records, record)
+		}
+	})
+	return records, err
+}
+
+// scan calls fn with every well-formed record in the audit log, skipping malformed lines
+func (l *Logger) scan(fn func(Record)) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", l.path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			l.logger.Warn("Skipping malformed audit record", zap.Error(err))
+			continue
+		}
+		fn(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log %s: %w", l.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestNewLoggerDisabled(t *testing.T) {
+	l := NewLogger("", nil, zaptest.NewLogger(t))
+	if l != nil {
+		t.Fatal("expected nil logger for empty path")
+	}
+
+	if err := l.Record(Record{Action: "update_inbound_rules"}); err != nil {
+		t.Errorf("expected nil logger to discard records, got %v", err)
+	}
+}
+
+func TestRecordAppendsWithGlobalFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.log")
+	l := NewLogger(path, map[string]string{"hostname": "web-1", "environment": "prod"}, zaptest.NewLogger(t))
+
+	records := []Record{
+		{Action: "update_inbound_rules", FirewallID: "fw-1", Added: []string{"tcp/22 203.0.113.5/32"}},
+		{Action: "update_inbound_rules", FirewallID: "fw-1", Fields: map[string]string{"environment": "staging"}},
+	}
+	for _, record := range records {
+		if err := l.Record(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var got []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, record)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(got))
+	}
+	if got[0].Time.IsZero() {
+		t.Error("expected record time to be set")
+	}
+	if got[0].Fields["hostname"] != "web-1" || got[0].Fields["environment"] != "prod" {
+		t.Errorf("expected global fields on record, got %v", got[0].Fields)
+	}
+	if got[1].Fields["environment"] != "staging" {
+		t.Errorf("expected record fields to take precedence, got %v", got[1].Fields)
+	}
+}
+
+func TestLast(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := NewLogger(path, nil, zaptest.NewLogger(t))
+
+	last, err := l.Last("fw-1")
+	if err != nil || last != nil {
+		t.Fatalf("expected no record before the log exists, got %+v, %v", last, err)
+	}
+
+	for _, record := range []Record{
+		{Action: "update_inbound_rules", FirewallID: "fw-1", Fingerprint: "a"},
+		{Action: "update_inbound_rules", FirewallID: "fw-1", Fingerprint: "b"},
+		{Action: "update_inbound_rules", FirewallID: "fw-2", Fingerprint: "c"},
+	} {
+		if err := l.Record(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	last, err = l.Last("fw-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last == nil || last.Fingerprint != "b" {
+		t.Errorf("expected the latest fw-1 record, got %+v", last)
+	}
+}
+
+func TestSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := NewLogger(path, nil, zaptest.NewLogger(t))
+
+	start := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+	for _, record := range []Record{
+		{Time: start.Add(-time.Hour), Action: "update_inbound_rules", FirewallID: "fw-1", Fingerprint: "old"},
+		{Time: start, Action: "update_inbound_rules", FirewallID: "fw-1", Fingerprint: "a"},
+		{Time: start.Add(time.Hour), Action: "update_inbound_rules", FirewallID: "fw-2", Fingerprint: "other"},
+		{Time: start.Add(2 * time.Hour), Action: "update_inbound_rules", FirewallID: "fw-1", Fingerprint: "b"},
+	} {
+		if err := l.Record(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	records, err := l.Since("fw-1", start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 || records[0].Fingerprint != "a" || records[1].Fingerprint != "b" {
+		t.Errorf("expected the fw-1 records since start, got %+v", records)
+	}
+
+	var nilLogger *Logger
+	if records, err := nilLogger.Since("fw-1", start); err != nil || records != nil {
+		t.Errorf("expected no records from a nil logger, got %+v, %v", records, err)
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	ctx := WithFields(context.Background(), map[string]string{"invite_id": "abc", "actor": "alice"})
+	ctx = WithFields(ctx, map[string]string{"actor": "bob"})
+
+	fields := FieldsFromContext(ctx)
+	if fields["invite_id"] != "abc" || fields["actor"] != "bob" {
+		t.Errorf("expected merged fields with later values winning, got %v", fields)
+	}
+	if FieldsFromContext(context.Background()) != nil {
+		t.Error("expected no fields on a plain context")
+	}
+}
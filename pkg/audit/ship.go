@@ -0,0 +1,385 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"go.uber.org/zap"
+)
+
+// Collector types audit records can be shipped to
+const (
+	// ShipSplunk posts events to a Splunk HTTP Event Collector, e.g. https://splunk:8088/services/collector/event
+	ShipSplunk = "splunk"
+	// ShipElastic indexes documents through the Elasticsearch bulk API of the cluster URL
+	ShipElastic = "elastic"
+	// ShipHTTPS posts a JSON array of records to any collector URL
+	ShipHTTPS = "https"
+)
+
+// shipSource identifies the records in the collector
+const shipSource = "do-firewall-allowlister"
+
+// Shipper forwards audit records to a SIEM or log collector in batches. It tails the audit log
+// from a cursor file next to it, so records written while the collector is unreachable are
+// shipped once it is back, and every record carries an event_id for deduplication.
+type Shipper struct {
+	kind       string
+	url        string
+	token      string
+	index      string
+	batchSize  int
+	retries    int
+	backoff    time.Duration
+	clock      clock.Clock
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// shippedRecord is a record with the ID collectors deduplicate redelivered batches by
+type shippedRecord struct {
+	EventID string `json:"event_id"`
+	Record
+}
+
+// NewShipper creates a shipper of the kind posting batches of up to batchSize records to
+// collectorURL, retrying failed batches up to retries times
+func NewShipper(kind, collectorURL, token, index string, batchSize, retries int, logger *zap.Logger) (*Shipper, error) {
+	switch kind {
+	case ShipSplunk, ShipElastic, ShipHTTPS:
+	default:
+		return nil, fmt.Errorf("unknown audit shipping type %s", kind)
+	}
+
+	u, err := url.Parse(collectorURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid audit shipping URL %s: must be an http(s) URL", collectorURL)
+	}
+	if kind == ShipElastic {
+		collectorURL = strings.TrimRight(collectorURL, "/") + "/_bulk"
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	return &Shipper{
+		kind:       kind,
+		url:        collectorURL,
+		token:      token,
+		index:      index,
+		batchSize:  batchSize,
+		retries:    retries,
+		backoff:    time.Second,
+		clock:      clock.Real,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     logger.Named("audit"),
+	}, nil
+}
+
+// CursorPath returns the file recording how much of the audit log at path has been shipped
+func CursorPath(path string) string {
+	return path + ".shipped"
+}
+
+// Ship forwards the records appended to the audit log since the last shipment and returns how
+// many were delivered; the cursor only moves past delivered batches, so a failed batch is
+// shipped again next time. A nil logger ships nothing.
+func (s *Shipper) Ship(ctx context.Context, l *Logger) (int, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	cursorPath := CursorPath(l.path)
+	offset, err := readCursor(cursorPath)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open audit log %s: %w", l.path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read audit log %s: %w", l.path, err)
+	}
+	if info.Size() < offset {
+		s.logger.Warn("Audit log is shorter than the shipping cursor, shipping it from the start",
+			zap.String("path", l.path))
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to read audit log %s: %w", l.path, err)
+	}
+
+	shipped := 0
+	position := offset
+	var batch []shippedRecord
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := s.send(ctx, batch); err != nil {
+				return err
+			}
+			shipped += len(batch)
+			batch = batch[:0]
+		}
+		if position != offset {
+			if err := writeCursor(cursorPath, position); err != nil {
+				return err
+			}
+			offset = position
+		}
+		return nil
+	}
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		// A line without its newline is still being written and is left for the next shipment
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return shipped, fmt.Errorf("failed to read audit log %s: %w", l.path, err)
+		}
+		position += int64(len(line))
+
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			s.logger.Warn("Skipping malformed audit record", zap.Error(err))
+			continue
+		}
+		batch = append(batch, shippedRecord{EventID: eventID(line), Record: record})
+
+		if len(batch) >= s.batchSize {
+			if err := flush(); err != nil {
+				return shipped, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return shipped, err
+	}
+
+	if shipped > 0 {
+		s.logger.Debug("Shipped audit records", zap.String("type", s.kind), zap.Int("records", shipped))
+	}
+	return shipped, nil
+}
+
+// eventID derives a stable ID from the raw audit line
+func eventID(line []byte) string {
+	sum := sha256.Sum256(bytes.TrimSpace(line))
+	return hex.EncodeToString(sum[:16])
+}
+
+// send delivers one batch, retrying network errors, throttling and server errors with
+// exponential backoff
+func (s *Shipper) send(ctx context.Context, batch []shippedRecord) error {
+	body, contentType, err := s.encode(batch)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("failed to ship audit records: %w", ctx.Err())
+			case <-s.clock.After(s.backoff << (attempt - 1)):
+			}
+		}
+
+		retry, err := s.post(ctx, body, contentType)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == s.retries {
+			break
+		}
+		s.logger.Warn("Failed to ship audit records, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Int("max_retries", s.retries),
+			zap.Error(err))
+	}
+	return lastErr
+}
+
+// encode renders the batch in the collector's format
+func (s *Shipper) encode(batch []shippedRecord) ([]byte, string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	switch s.kind {
+	case ShipSplunk:
+		// HEC accepts several concatenated event objects in one request
+		for _, record := range batch {
+			event := struct {
+				Time       float64       `json:"time"`
+				Source     string        `json:"source"`
+				Sourcetype string        `json:"sourcetype"`
+				Index      string        `json:"index,omitempty"`
+				Event      shippedRecord `json:"event"`
+			}{
+				Time:       float64(record.Time.UnixMilli()) / 1000,
+				Source:     shipSource,
+				Sourcetype: shipSource + ":audit",
+				Index:      s.index,
+				Event:      record,
+			}
+			if err := enc.Encode(event); err != nil {
+				return nil, "", fmt.Errorf("failed to encode audit records: %w", err)
+			}
+		}
+		return buf.Bytes(), "application/json", nil
+	case ShipElastic:
+		// create with the event ID makes redelivered records conflict instead of duplicating
+		for _, record := range batch {
+			action := map[string]map[string]string{"create": {"_index": s.index, "_id": record.EventID}}
+			doc := struct {
+				Timestamp time.Time `json:"@timestamp"`
+				shippedRecord
+			}{Timestamp: record.Time, shippedRecord: record}
+			if err := enc.Encode(action); err != nil {
+				return nil, "", fmt.Errorf("failed to encode audit records: %w", err)
+			}
+			if err := enc.Encode(doc); err != nil {
+				return nil, "", fmt.Errorf("failed to encode audit records: %w", err)
+			}
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	default:
+		if err := enc.Encode(batch); err != nil {
+			return nil, "", fmt.Errorf("failed to encode audit records: %w", err)
+		}
+		return buf.Bytes(), "application/json", nil
+	}
+}
+
+// post sends the encoded batch and reports whether a failure is worth retrying
+func (s *Shipper) post(ctx context.Context, body []byte, contentType string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create audit shipping request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.token != "" {
+		switch s.kind {
+		case ShipSplunk:
+			req.Header.Set("Authorization", "Splunk "+s.token)
+		case ShipElastic:
+			req.Header.Set("Authorization", "ApiKey "+s.token)
+		default:
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		}
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to ship audit records: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("failed to ship audit records: %s %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+
+	if s.kind == ShipElastic {
+		return checkBulkResponse(resp.Body)
+	}
+	return false, nil
+}
+
+// checkBulkResponse fails on items Elasticsearch rejected; conflicts are records it already has
+func checkBulkResponse(body io.Reader) (bool, error) {
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(io.LimitReader(body, 16<<20)).Decode(&result); err != nil {
+		return true, fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if !result.Errors {
+		return false, nil
+	}
+
+	for _, item := range result.Items {
+		for _, op := range item {
+			if op.Status < 300 || op.Status == http.StatusConflict {
+				continue
+			}
+			retry := op.Status == http.StatusTooManyRequests || op.Status >= 500
+			return retry, fmt.Errorf("failed to ship audit records: elasticsearch rejected a record with status %d: %s %s",
+				op.Status, op.Error.Type, op.Error.Reason)
+		}
+	}
+	return false, nil
+}
+
+// readCursor returns the shipped offset, zero before the first shipment
+func readCursor(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read audit shipping cursor %s: %w", path, err)
+	}
+
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid audit shipping cursor %s", path)
+	}
+	return offset, nil
+}
+
+// writeCursor atomically records the shipped offset
+func writeCursor(path string, offset int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write audit shipping cursor: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.FormatInt(offset, 10) + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write audit shipping cursor: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write audit shipping cursor: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write audit shipping cursor: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestShip(t *testing.T) {
+	tests := []struct {
+		name        string
+		kind        string
+		index       string
+		auth        string
+		contentType string
+		response    string
+		// decode returns the firewall IDs found in a request body
+		decode func(t *testing.T, body []byte) []string
+	}{
+		{
+			name:        "splunk",
+			kind:        ShipSplunk,
+			index:       "security",
+			auth:        "Splunk the-token",
+			contentType: "application/json",
+			response:    `{"text":"Success","code":0}`,
+			decode: func(t *testing.T, body []byte) []string {
+				var ids []string
+				dec := json.NewDecoder(bytes.NewReader(body))
+				for dec.More() {
+					var event struct {
+						Index string `json:"index"`
+						Event struct {
+							EventID    string `json:"event_id"`
+							FirewallID string `json:"firewall_id"`
+						} `json:"event"`
+					}
+					if err := dec.Decode(&event); err != nil {
+						t.Fatalf("failed to decode HEC event: %v", err)
+					}
+					if event.Index != "security" || event.Event.EventID == "" {
+						t.Errorf("unexpected HEC event %+v", event)
+					}
+					ids = append(ids, event.Event.FirewallID)
+				}
+				return ids
+			},
+		},
+		{
+			name:        "elastic",
+			kind:        ShipElastic,
+			index:       "firewall-audit",
+			auth:        "ApiKey the-token",
+			contentType: "application/x-ndjson",
+			response:    `{"errors":true,"items":[{"create":{"status":201}},{"create":{"status":409,"error":{"type":"version_conflict_engine_exception"}}}]}`,
+			decode: func(t *testing.T, body []byte) []string {
+				var ids []string
+				scanner := bufio.NewScanner(bytes.NewReader(body))
+				for scanner.Scan() {
+					var action map[string]map[string]string
+					if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || action["create"]["_index"] != "firewall-audit" || action["create"]["_id"] == "" {
+						t.Fatalf("unexpected bulk action %s", scanner.Text())
+					}
+					if !scanner.Scan() {
+						t.Fatal("expected a document after the bulk action")
+					}
+					var doc map[string]interface{}
+					if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil || doc["@timestamp"] == nil {
+						t.Fatalf("unexpected bulk document %s", scanner.Text())
+					}
+					ids = append(ids, doc["firewall_id"].(string))
+				}
+				return ids
+			},
+		},
+		{
+			name:        "https",
+			kind:        ShipHTTPS,
+			auth:        "Bearer the-token",
+			contentType: "application/json",
+			decode: func(t *testing.T, body []byte) []string {
+				var records []shippedRecord
+				if err := json.Unmarshal(body, &records); err != nil {
+					t.Fatalf("failed to decode records: %v", err)
+				}
+				var ids []string
+				for _, record := range records {
+					ids = append(ids, record.FirewallID)
+				}
+				return ids
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var shipped []string
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Header.Get("Authorization") != tt.auth {
+					t.Errorf("expected Authorization %q, got %q", tt.auth, r.Header.Get("Authorization"))
+				}
+				if r.Header.Get("Content-Type") != tt.contentType {
+					t.Errorf("expected Content-Type %q, got %q", tt.contentType, r.Header.Get("Content-Type"))
+				}
+				if tt.kind == ShipElastic && r.URL.Path != "/_bulk" {
+					t.Errorf("expected the bulk API, got %s", r.URL.Path)
+				}
+				body, _ := io.ReadAll(r.Body)
+				shipped = append(shipped, tt.decode(t, body)...)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			path := filepath.Join(t.TempDir(), "audit.log")
+			l := NewLogger(path, nil, zaptest.NewLogger(t))
+			for _, id := range []string{"fw-1", "fw-2", "fw-3"} {
+				if err := l.Record(Record{Action: "update_inbound_rules", FirewallID: id}); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			shipper, err := NewShipper(tt.kind, srv.URL, "the-token", tt.index, 2, 0, zaptest.NewLogger(t))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			count, err := shipper.Ship(context.Background(), l)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != 3 || requests != 2 || strings.Join(shipped, ",") != "fw-1,fw-2,fw-3" {
+				t.Fatalf("expected 3 records in 2 batches, got %d records in %d requests: %v", count, requests, shipped)
+			}
+
+			// Only records written after the previous shipment are sent
+			if err := l.Record(Record{Action: "update_inbound_rules", FirewallID: "fw-4"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			count, err = shipper.Ship(context.Background(), l)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != 1 || shipped[len(shipped)-1] != "fw-4" {
+				t.Errorf("expected only the new record to be shipped, got %d: %v", count, shipped)
+			}
+		})
+	}
+}
+
+func TestShipRetries(t *testing.T) {
+	failures := 2
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := NewLogger(path, nil, zaptest.NewLogger(t))
+	if err := l.Record(Record{Action: "update_inbound_rules", FirewallID: "fw-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	shipper, err := NewShipper(ShipHTTPS, srv.URL, "", "", 100, 1, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shipper.backoff = 0
+
+	// One retry does not get past two failures, so the record stays unshipped
+	if _, err := shipper.Ship(context.Background(), l); err == nil {
+		t.Fatal("expected an error after exhausting retries")
+	}
+	if _, err := os.Stat(CursorPath(path)); !os.IsNotExist(err) {
+		t.Errorf("expected no cursor before a successful shipment, got %v", err)
+	}
+
+	count, err := shipper.Ship(context.Background(), l)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 1 || requests != 3 {
+		t.Errorf("expected the record on the third request, got %d records after %d requests", count, requests)
+	}
+}
+
+func TestShipPermanentFailure(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	l := NewLogger(filepath.Join(t.TempDir(), "audit.log"), nil, zaptest.NewLogger(t))
+	if err := l.Record(Record{Action: "update_inbound_rules", FirewallID: "fw-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	shipper, err := NewShipper(ShipSplunk, srv.URL, "wrong-token", "", 100, 3, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shipper.backoff = 0
+
+	if _, err := shipper.Ship(context.Background(), l); err == nil {
+		t.Fatal("expected an error for a rejected token")
+	}
+	if requests != 1 {
+		t.Errorf("expected client errors not to be retried, got %d requests", requests)
+	}
+}
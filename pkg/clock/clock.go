@@ -0,0 +1,207 @@
+// Package clock abstracts the wall clock so the scheduler, retry backoff and TTL expiry can be
+// driven by a fake clock in tests and in the simulate command
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits on it
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at a fixed interval until stopped
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the wall clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// Fake is a clock that only moves when set or advanced; timers and tickers fire as the time
+// passes their deadlines
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	// changed is closed and replaced whenever a waiter is added, waking BlockUntil
+	changed chan struct{}
+}
+
+// waiter is a pending After timer, or a ticker when period is set
+type waiter struct {
+	deadline time.Time
+	period   time.Duration
+	ch       chan time.Time
+	stopped  bool
+}
+
+// NewFake creates a fake clock reading now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// After returns a channel receiving the fake time once it advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &waiter{deadline: f.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- f.now
+		return w.ch
+	}
+	f.addWaiter(w)
+	return w.ch
+}
+
+// NewTicker returns a ticker firing every d of fake time; like a real ticker it drops ticks
+// its reader is not ready for
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &waiter{deadline: f.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.addWaiter(w)
+	return &fakeTicker{clock: f, waiter: w}
+}
+
+// addWaiter registers w; f.mu must be held
+func (f *Fake) addWaiter(w *waiter) {
+	f.waiters = append(f.waiters, w)
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// Advance moves the fake time forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(f.now.Add(d))
+}
+
+// Set moves the fake time to t, firing the timers and tickers whose deadlines passed
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(t)
+}
+
+func (f *Fake) set(t time.Time) {
+	f.now = t
+
+	kept := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.stopped {
+			continue
+		}
+		if t.Before(w.deadline) {
+			kept = append(kept, w)
+			continue
+		}
+
+		select {
+		case w.ch <- t:
+		default:
+		}
+		if w.period == 0 {
+			continue
+		}
+		for !t.Before(w.deadline) {
+			w.deadline = w.deadline.Add(w.period)
+		}
+		kept = append(kept, w)
+	}
+	f.waiters = kept
+}
+
+// Waiters returns how many timers and tickers are waiting on the fake time
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until at least n timers and tickers wait on the fake time, so a test can
+// advance it once the code under test is waiting
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		count, changed := len(f.waiters), f.changed
+		f.mu.Unlock()
+
+		if count >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	waiter *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	t.waiter.stopped = true
+	kept := t.clock.waiters[:0]
+	for _, w := range t.clock.waiters {
+		if w != t.waiter {
+			kept = append(kept, w)
+		}
+	}
+	t.clock.waiters = kept
+}
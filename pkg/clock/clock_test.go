@@ -0,0 +1,85 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC)
+
+// fired reports whether ch holds a value, without waiting
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	f := NewFake(start)
+	ch := f.After(time.Minute)
+
+	f.Advance(59 * time.Second)
+	if fired(ch) {
+		t.Fatal("expected the timer not to fire before its deadline")
+	}
+
+	f.Advance(time.Second)
+	if !fired(ch) {
+		t.Fatal("expected the timer to fire at its deadline")
+	}
+	if f.Waiters() != 0 {
+		t.Errorf("expected a fired timer to be removed, got %d waiters", f.Waiters())
+	}
+
+	if !fired(f.After(0)) {
+		t.Error("expected a zero wait to fire immediately")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(time.Minute)
+
+	f.Advance(time.Minute)
+	if !fired(ticker.C()) {
+		t.Fatal("expected a tick after one interval")
+	}
+
+	// Jumping several intervals delivers a single tick, as a real ticker drops the others
+	f.Advance(5 * time.Minute)
+	if !fired(ticker.C()) {
+		t.Fatal("expected a tick after a jump")
+	}
+	if fired(ticker.C()) {
+		t.Fatal("expected the ticks of a jump to be dropped")
+	}
+
+	ticker.Stop()
+	f.Advance(time.Hour)
+	if fired(ticker.C()) {
+		t.Error("expected a stopped ticker not to tick")
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(start)
+
+	done := make(chan time.Time)
+	go func() {
+		done <- <-f.After(time.Hour)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Hour)
+	select {
+	case at := <-done:
+		if !at.Equal(start.Add(time.Hour)) {
+			t.Errorf("expected the timer to fire at %s, got %s", start.Add(time.Hour), at)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiting goroutine to wake up")
+	}
+}
@@ -0,0 +1,296 @@
+package commands
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewRequestAccessCommand creates and returns the request-access command
+func NewRequestAccessCommand() *cobra.Command {
+	var (
+		ip     string
+		port   int
+		reason string
+	)
+
+	requestAccessCmd := &cobra.Command{
+		Use:   "request-access",
+		Short: "Request access for an IP address pending approval",
+		Long: `Record a request to allow an IP address on a port without touching the firewall.
+
+The request is stored in the local state file and must be approved with the
+approve command before it is applied to the DigitalOcean firewall. If --ip is
+not specified, the current public IP address is detected using icanhazip.com.
+
+This is useful for teams that want a second pair of eyes before opening SSH.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRequestAccess(cmd, ip, port, reason)
+		},
+	}
+
+	requestAccessCmd.Flags().StringVar(&ip, "ip", "",
+		"IP address to request access for (default: current public IP)")
+	requestAccessCmd.Flags().IntVar(&port, "port", 22,
+		"Port number to request access to (default: 22)")
+	requestAccessCmd.Flags().StringVar(&reason, "reason", "",
+		"Reason for the access request")
+	addTimeoutFlag(requestAccessCmd, time.Minute)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List pending access requests",
+		RunE:  runListAccessRequests,
+	}
+
+	requestAccessCmd.AddCommand(listCmd)
+	return requestAccessCmd
+}
+
+// NewApproveCommand creates and returns the approve command
+func NewApproveCommand() *cobra.Command {
+	var dryRun bool
+
+	approveCmd := &cobra.Command{
+		Use:   "approve <request-id>",
+		Short: "Approve a pending access request and apply it to the firewall",
+		Long: `Approve a pending access request and add its IP address to the firewall rule
+for the requested port (append mode, existing sources are preserved).`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDecideAccessRequest(cmd, args[0], state.AccessRequestApproved, dryRun)
+		},
+	}
+
+	approveCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show what would be done without making actual changes")
+	addTimeoutFlag(approveCmd, 2*time.Minute)
+
+	return approveCmd
+}
+
+// NewDenyCommand creates and returns the deny command
+func NewDenyCommand() *cobra.Command {
+	denyCmd := &cobra.Command{
+		Use:   "deny <request-id>",
+		Short: "Deny a pending access request",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDecideAccessRequest(cmd, args[0], state.AccessRequestDenied, false)
+		},
+	}
+
+	return denyCmd
+}
+
+func runRequestAccess(cmd *cobra.Command, ip string, port int, reason string) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+
+	// Validate port range
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %d (must be 1-65535)", port)
+	}
+
+	if ip == "" {
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+
+		publicIPClient := newPublicIPClient(cfg, log, false)
+		ip, err = publicIPClient.GetPublicIPWithRetry(ctx, 3)
+		if err != nil {
+			return fmt.Errorf("failed to detect current public IP: %w", err)
+		}
+	} else if net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	req, err := state.NewAccessRequest(ip, port, reason, currentUser())
+	if err != nil {
+		return fmt.Errorf("failed to create access request: %w", err)
+	}
+
+	store := state.NewStore(cfg.State.Path, log)
+	if err := store.Update(func(st *state.State) error {
+		st.AccessRequests = append(st.AccessRequests, req)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to save access request: %w", err)
+	}
+
+	log.Info("Recorded access request pending approval",
+		zap.String("request_id", req.ID),
+		zap.String("ip", req.IP),
+		zap.Int("port", req.Port),
+		zap.String("requested_by", req.RequestedBy))
+
+	out := newPrinter(cmd)
+	out.Success("Access request %s recorded for %s on port %d", req.ID, req.IP, req.Port)
+	out.Detail("Approve with: do-firewall-allowlister approve %s", req.ID)
+	return nil
+}
+
+func runListAccessRequests(cmd *cobra.Command, args []string) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	st, err := state.NewStore(cfg.State.Path, logger.Get()).Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	pending := st.PendingAccessRequests()
+	if len(pending) == 0 {
+		fmt.Println("No pending access requests")
+		return nil
+	}
+
+	for _, req := range pending {
+		fmt.Printf("%s  %-40s port %-5d by %-12s at %s  %s\n",
+			req.ID, req.IP, req.Port, req.RequestedBy,
+			req.RequestedAt.Format("2006-01-02 15:04:05"), req.Reason)
+	}
+
+	return nil
+}
+
+func runDecideAccessRequest(cmd *cobra.Command, id string, decision string, dryRun bool) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+	store := state.NewStore(cfg.State.Path, log)
+	decidedBy := currentUser()
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// Only approvals have a dry run, they are the decisions changing the firewall
+	if dryRun {
+		st, err := store.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		req, err := st.FindAccessRequest(id)
+		if err != nil {
+			return err
+		}
+		if req.Status != state.AccessRequestPending {
+			return fmt.Errorf("access request %s is already %s", req.ID, req.Status)
+		}
+		log.Info("DRY RUN: Would approve access request and append IP to firewall rule",
+			zap.String("request_id", req.ID),
+			zap.String("firewall_id", cfg.DigitalOcean.FirewallID),
+			zap.String("source_ip", req.IP),
+			zap.Int("port", req.Port))
+		return nil
+	}
+
+	// The decision is saved before the firewall is touched, so a failed save never leaves an
+	// address on the firewall for a request that is still pending
+	var req state.AccessRequest
+	err = store.Update(func(st *state.State) error {
+		found, err := st.FindAccessRequest(id)
+		if err != nil {
+			return err
+		}
+		if err := found.Decide(decision, decidedBy); err != nil {
+			return err
+		}
+		req = *found
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if decision == state.AccessRequestApproved {
+		doClient := newDigitalOceanClient(cfg, log)
+		if err := doClient.AddSSHRule(ctx, cfg.DigitalOcean.FirewallID, req.IP, req.Port, false); err != nil {
+			// Pending again, the approval can simply be retried
+			if reopenErr := store.Update(func(st *state.State) error {
+				found, err := st.FindAccessRequest(id)
+				if err != nil {
+					return err
+				}
+				found.Reopen()
+				return nil
+			}); reopenErr != nil {
+				log.Error("Failed to reopen access request after the firewall update failed",
+					zap.String("request_id", id), zap.Error(reopenErr))
+			}
+			return fmt.Errorf("failed to apply access request %s: %w", req.ID, err)
+		}
+	}
+
+	log.Info("Access request decided",
+		zap.String("request_id", id),
+		zap.String("decision", decision),
+		zap.String("decided_by", decidedBy))
+
+	newPrinter(cmd).Success("Access request %s %s", id, decision)
+	return nil
+}
+
+// currentUser returns the name of the user running the command
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
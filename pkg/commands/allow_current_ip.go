@@ -1,13 +1,12 @@
 package commands
 
 import (
-	"context"
 	"fmt"
+	"time"
 
 	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
-	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
-	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/publicip"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -18,6 +17,9 @@ func NewAllowCurrentIPCommand() *cobra.Command {
 		dryRun         bool
 		port           int
 		removeExisting bool
+		assumeYes      bool
+		refresh        bool
+		force          bool
 	)
 
 	allowCurrentIPCmd := &cobra.Command{
@@ -26,8 +28,10 @@ func NewAllowCurrentIPCommand() *cobra.Command {
 		Long: `Detect the current public IP address and add it to the DigitalOcean firewall for SSH access.
 
 This command will:
-- Detect your current public IP address using icanhazip.com
+- Detect your current public IP address using icanhazip.com (cached briefly
+  and rate limited to respect the service, use --refresh to bypass the cache)
 - Add it to existing SSH rules for the specified port (append mode by default)
+- Remove the address this machine added previously, if it changed
 - Preserve existing firewall rules and droplet attachments
 - Default to port 22 (SSH) but can be customized with --port flag
 
@@ -38,7 +42,7 @@ Modes:
 This is useful for quickly allowing SSH access from your current location without
 manually managing firewall rules in the DigitalOcean control panel.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runAllowCurrentIP(cmd, args, dryRun, port, removeExisting)
+			return runAllowCurrentIP(cmd, args, dryRun, port, removeExisting, assumeYes, refresh, force)
 		},
 	}
 
@@ -49,11 +53,18 @@ manually managing firewall rules in the DigitalOcean control panel.`,
 		"Port number for SSH access (default: 22)")
 	allowCurrentIPCmd.Flags().BoolVar(&removeExisting, "remove", false,
 		"Remove existing SSH rules for this port and replace with current IP only")
+	allowCurrentIPCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false,
+		"Apply destructive changes (e.g. --remove dropping other IPs) without confirmation")
+	allowCurrentIPCmd.Flags().BoolVar(&refresh, "refresh", false,
+		"Detect the public IP again instead of using the cached value")
+	allowCurrentIPCmd.Flags().BoolVar(&force, "force", false,
+		"Apply the update even if it removes access to safety.admin-ports for the admin CIDRs")
+	addTimeoutFlag(allowCurrentIPCmd, 2*time.Minute)
 
 	return allowCurrentIPCmd
 }
 
-func runAllowCurrentIP(cmd *cobra.Command, args []string, dryRun bool, port int, removeExisting bool) error {
+func runAllowCurrentIP(cmd *cobra.Command, args []string, dryRun bool, port int, removeExisting bool, assumeYes bool, refresh bool, force bool) error {
 	// Get config file from global flag
 	configFile, _ := cmd.Flags().GetString("config")
 
@@ -67,7 +78,7 @@ func runAllowCurrentIP(cmd *cobra.Command, args []string, dryRun bool, port int,
 	}
 
 	// Initialize logger
-	if err := logger.Initialize(cfg.LogLevel); err != nil {
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 	defer logger.Sync()
@@ -85,11 +96,16 @@ func runAllowCurrentIP(cmd *cobra.Command, args []string, dryRun bool, port int,
 		return fmt.Errorf("invalid port %d (must be 1-65535)", port)
 	}
 
+	out := newPrinter(cmd)
+
 	// Create public IP client
-	publicIPClient := publicip.NewClient(log)
+	out.Step("Detecting current public IP")
+	publicIPClient := newPublicIPClient(cfg, log, refresh)
+
+	// Detect current public IP, bounded by the command timeout
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
 
-	// Detect current public IP
-	ctx := context.Background()
 	currentIP, err := publicIPClient.GetPublicIPWithRetry(ctx, 3)
 	if err != nil {
 		log.Error("Failed to detect current public IP", zap.Error(err))
@@ -97,6 +113,19 @@ func runAllowCurrentIP(cmd *cobra.Command, args []string, dryRun bool, port int,
 	}
 
 	log.Info("Detected current public IP", zap.String("ip", currentIP))
+	out.Success("Detected current public IP %s", currentIP)
+
+	// Look up the address this machine added last time so it can be replaced
+	store := state.NewStore(cfg.State.Path, log)
+	machine := currentMachine()
+	st, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	var previousIP string
+	if entry := st.FindSelfIP(machine, cfg.DigitalOcean.FirewallID, port); entry != nil && entry.IP != currentIP {
+		previousIP = entry.IP
+	}
 
 	if dryRun {
 		if removeExisting {
@@ -109,23 +138,46 @@ func runAllowCurrentIP(cmd *cobra.Command, args []string, dryRun bool, port int,
 			log.Info("DRY RUN: Would append current IP to existing SSH rules",
 				zap.String("firewall_id", cfg.DigitalOcean.FirewallID),
 				zap.String("source_ip", currentIP),
+				zap.String("previous_ip", previousIP),
 				zap.Int("port", port),
 				zap.String("protocol", "tcp"))
 		}
 		log.Info("DRY RUN: Execution completed successfully")
+		out.Success("Dry run completed, no changes made")
 		return nil
 	}
 
 	// Create DigitalOcean client
-	doClient := digitalocean.NewClient(cfg.DigitalOcean.APIKey, log)
+	out.Step("Updating firewall %s", cfg.DigitalOcean.FirewallID)
+	doClient := newDigitalOceanClient(cfg, log)
+	doClient.SetConfirmFunc(newConfirmFunc(assumeYes, cfg.Confirmation.MaxRemovedAddresses))
+	doClient.SetAdminAccess(newAdminAccess(cfg, currentIP, force))
+
+	// Add SSH rule to firewall, replacing the stale address previously added by this machine
+	err = store.Update(func(st *state.State) error {
+		var err error
+		if removeExisting {
+			err = doClient.AddSSHRule(ctx, cfg.DigitalOcean.FirewallID, currentIP, port, true)
+		} else {
+			err = doClient.ReplaceSSHSource(ctx, cfg.DigitalOcean.FirewallID, previousIP, currentIP, port)
+		}
+		if err != nil {
+			return err
+		}
 
-	// Add SSH rule to firewall
-	err = doClient.AddSSHRule(ctx, cfg.DigitalOcean.FirewallID, currentIP, port, removeExisting)
+		st.SetSelfIP(machine, cfg.DigitalOcean.FirewallID, port, currentIP)
+		return nil
+	})
 	if err != nil {
 		log.Error("Failed to add SSH rule to firewall", zap.Error(err))
+		out.Fail("Failed to update firewall %s", cfg.DigitalOcean.FirewallID)
 		return fmt.Errorf("failed to add SSH rule to firewall: %w", err)
 	}
 
+	out.Success("Allowed %s on tcp/%d in firewall %s", currentIP, port, cfg.DigitalOcean.FirewallID)
+	if previousIP != "" && !removeExisting {
+		out.Detail("Removed previous address %s added from %s", previousIP, machine)
+	}
 	log.Info("Successfully added current IP to firewall for SSH access",
 		zap.String("firewall_id", cfg.DigitalOcean.FirewallID),
 		zap.String("source_ip", currentIP),
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewApplyCommand creates and returns the apply command
+func NewApplyCommand() *cobra.Command {
+	var (
+		planFile  string
+		assumeYes bool
+		force     bool
+	)
+
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply a plan saved by plan -o",
+		Long: `Write the inbound rules of a plan saved by "plan -o plan.json" to its firewalls, exactly as
+they were reviewed. The sources are not collected again, so the firewalls end up with the
+planned rules even if a source changed since.
+
+Every firewall is first checked to still have the inbound rules it was planned against; if
+any changed since planning, nothing is written and the drifted firewalls are reported, plan
+again to review the new diff. Firewalls locked down or frozen since planning are skipped. Plans
+written by a release with another plan file version are refused; plan again with this release
+instead.`,
+		Example: `  # Review the plan in a pull request, then apply it once approved
+  do-firewall-allowlister plan -o plan.json
+  do-firewall-allowlister apply --plan plan.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runApply(cmd, planFile, assumeYes, force)
+		},
+	}
+
+	applyCmd.Flags().StringVar(&planFile, "plan", "", "Plan file saved by plan -o (required)")
+	_ = applyCmd.MarkFlagRequired("plan")
+	applyCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false,
+		"Apply destructive changes (rule deletions, large removals) without confirmation")
+	applyCmd.Flags().BoolVar(&force, "force", false,
+		"Apply the plan even if it removes your access to safety.admin-ports")
+	addTimeoutFlag(applyCmd, 5*time.Minute)
+
+	return applyCmd
+}
+
+func runApply(cmd *cobra.Command, planFile string, assumeYes bool, force bool) error {
+	file, err := digitalocean.ReadPlanFile(planFile)
+	if err != nil {
+		return err
+	}
+
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	svc := service.NewService(cfg, log, false)
+	svc.SetConfirmFunc(newConfirmFunc(assumeYes, cfg.Confirmation.MaxRemovedAddresses))
+	svc.SetAdminAccess(newAdminAccess(cfg, detectOperatorIP(ctx, cfg, log), force))
+
+	out := newPrinter(cmd)
+	out.Step("Applying plan of %s", file.CreatedAt.Local().Format(time.RFC1123))
+	for _, planned := range file.Firewalls {
+		printPlan(out, planned.Plan)
+	}
+
+	results, err := svc.ApplyPlanFile(ctx, file)
+	printFirewallResults(out, results)
+	if err != nil {
+		log.Error("Applying the plan failed", zap.Error(err))
+		var updateErr *service.UpdateError
+		if !errors.As(err, &updateErr) {
+			out.Fail("Applying the plan failed")
+		}
+		return fmt.Errorf("failed to apply plan: %w", err)
+	}
+
+	out.Success("Plan applied")
+	return nil
+}
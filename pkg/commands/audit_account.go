@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// NewAuditAccountCommand creates and returns the audit-account command
+func NewAuditAccountCommand() *cobra.Command {
+	var (
+		output     string
+		riskyPorts []int
+		failOn     string
+	)
+
+	auditAccountCmd := &cobra.Command{
+		Use:   "audit-account",
+		Short: "Review every firewall in the account for risky rules",
+		Long: `List every firewall in the DigitalOcean account, not only the configured ones, and report:
+
+- high: SSH, remote desktop and database ports open to 0.0.0.0/0 or ::/0
+- medium: inbound rules of the same protocol whose port ranges overlap
+- low: firewalls applied to no droplet or tag
+
+The firewalls are only read, so a token with firewall:read is enough.`,
+		Example: `  # Fail a CI job when anything exposes a database to the internet
+  do-firewall-allowlister audit-account --fail-on high
+
+  # Also treat the Kafka and etcd ports as sensitive
+  do-firewall-allowlister audit-account --risky-port 9092 --risky-port 2379`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAuditAccount(cmd, output, riskyPorts, digitalocean.Severity(failOn))
+		},
+	}
+
+	auditAccountCmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	auditAccountCmd.Flags().IntSliceVar(&riskyPorts, "risky-port", nil,
+		"Further port that must not be open to the internet (repeatable)")
+	auditAccountCmd.Flags().StringVar(&failOn, "fail-on", "",
+		"Exit with an error when a finding of this severity or higher is found (high, medium, low)")
+	addTimeoutFlag(auditAccountCmd, 2*time.Minute)
+
+	return auditAccountCmd
+}
+
+func runAuditAccount(cmd *cobra.Command, output string, riskyPorts []int, failOn digitalocean.Severity) error {
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unsupported output format: %s (supported: text, json)", output)
+	}
+	if failOn != "" && failOn.Rank() == 0 {
+		return fmt.Errorf("invalid --fail-on %s (must be high, medium or low)", failOn)
+	}
+
+	ports := maps.Clone(digitalocean.DefaultRiskyPorts)
+	for _, port := range riskyPorts {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d (must be 1-65535)", port)
+		}
+		if _, ok := ports[port]; !ok {
+			ports[port] = "port"
+		}
+	}
+
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	firewalls, err := newDigitalOceanClient(cfg, logger.Get()).ListFirewalls(ctx)
+	if err != nil {
+		return err
+	}
+	findings := digitalocean.ReviewFirewalls(firewalls, ports)
+
+	if output == "json" {
+		if findings == nil {
+			findings = []digitalocean.Finding{}
+		}
+		jsonOutput, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal findings: %w", err)
+		}
+		fmt.Println(string(jsonOutput))
+	} else {
+		out := newPrinter(cmd)
+		counts := make(map[digitalocean.Severity]int)
+		for _, finding := range findings {
+			counts[finding.Severity]++
+
+			subject := fmt.Sprintf("%s (%s)", finding.FirewallName, finding.FirewallID)
+			if finding.Rule != "" {
+				subject += " " + finding.Rule
+			}
+			if finding.Severity == digitalocean.SeverityHigh {
+				out.Fail("[%s] %s: %s", finding.Severity, subject, finding.Message)
+			} else {
+				out.Warn("[%s] %s: %s", finding.Severity, subject, finding.Message)
+			}
+		}
+
+		if len(findings) == 0 {
+			out.Success("Reviewed %d firewalls, no findings", len(firewalls))
+		} else {
+			out.Step("Reviewed %d firewalls: %d high, %d medium, %d low", len(firewalls),
+				counts[digitalocean.SeverityHigh], counts[digitalocean.SeverityMedium], counts[digitalocean.SeverityLow])
+		}
+	}
+
+	if failOn == "" {
+		return nil
+	}
+	failing := 0
+	for _, finding := range findings {
+		if finding.Severity.Rank() >= failOn.Rank() {
+			failing++
+		}
+	}
+	if failing > 0 {
+		return fmt.Errorf("found %d findings of %s severity or higher", failing, failOn)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/publicip"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/ui"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// newDigitalOceanClient creates a DigitalOcean client honoring the read-only, lock and audit settings
+func newDigitalOceanClient(cfg *config.Config, log *zap.Logger) *digitalocean.Client {
+	return service.NewDigitalOceanClient(cfg, audit.NewLogger(cfg.Audit.Path, cfg.Logging.GlobalFields(), log), log)
+}
+
+// newAdminAccess returns the self-lockout check for the configured admin ports, covering the admin
+// CIDRs and currentIP when set, or nil if no admin ports are configured
+func newAdminAccess(cfg *config.Config, currentIP string, force bool) *digitalocean.AdminAccess {
+	if len(cfg.Safety.AdminPorts) == 0 {
+		return nil
+	}
+
+	sources := append([]string{}, cfg.Safety.AdminCIDRs...)
+	if currentIP != "" {
+		sources = append(sources, currentIP)
+	}
+
+	return &digitalocean.AdminAccess{
+		Ports:   cfg.Safety.AdminPorts,
+		Sources: sources,
+		Force:   force,
+	}
+}
+
+// detectOperatorIP returns the operator's current public IP for the self-lockout check, or an empty
+// string if no admin ports are configured or detection fails
+func detectOperatorIP(ctx context.Context, cfg *config.Config, log *zap.Logger) string {
+	if len(cfg.Safety.AdminPorts) == 0 {
+		return ""
+	}
+
+	ip, err := newPublicIPClient(cfg, log, false).GetPublicIP(ctx)
+	if err != nil {
+		log.Warn("Failed to detect current public IP, checking admin access for admin CIDRs only",
+			zap.Error(err))
+		return ""
+	}
+	return ip
+}
+
+// logLevel returns the base log level adjusted by the -q/--quiet and -v/--verbose counts
+func logLevel(cmd *cobra.Command, base string) string {
+	quiet, _ := cmd.Flags().GetCount("quiet")
+	verbose, _ := cmd.Flags().GetCount("verbose")
+	if quiet == 0 && verbose == 0 {
+		return base
+	}
+	return logger.ShiftLevel(base, quiet-verbose)
+}
+
+// loggerOptions returns the output, sampling and per-module level settings from the configuration
+func loggerOptions(cfg *config.Config) []logger.Option {
+	opts := []logger.Option{
+		logger.WithSampling(cfg.Logging.Sampling.Initial, cfg.Logging.Sampling.Thereafter, cfg.Logging.Sampling.Tick),
+		logger.WithLevelOverrides(cfg.Logging.Levels),
+		logger.WithFields(cfg.Logging.GlobalFields()),
+	}
+
+	if cfg.Logging.Ship.Format != "" {
+		opts = append(opts, logger.WithShipping(cfg.Logging.Ship.Format, cfg.Logging.Ship.Network,
+			cfg.Logging.Ship.Address, cfg.Logging.Ship.BufferSize))
+	}
+
+	switch cfg.LogOutput {
+	case logger.OutputSyslog:
+		opts = append(opts, logger.WithSyslog(cfg.Logging.Syslog.Network, cfg.Logging.Syslog.Address,
+			cfg.Logging.Tag, cfg.Logging.Syslog.Facility))
+	case logger.OutputJournald:
+		opts = append(opts, logger.WithJournald(cfg.Logging.Tag))
+	}
+	return opts
+}
+
+// newPrinter creates a stdout progress printer that is silenced by -q/--quiet
+func newPrinter(cmd *cobra.Command) *ui.Printer {
+	out := ui.NewPrinter(os.Stdout)
+	if quiet, _ := cmd.Flags().GetCount("quiet"); quiet > 0 {
+		out.SetQuiet(true)
+	}
+	return out
+}
+
+// newPublicIPClient creates a public IP client honoring the cache and rate limit settings,
+// bypassing cached IPs when refresh is set
+func newPublicIPClient(cfg *config.Config, log *zap.Logger, refresh bool) *publicip.Client {
+	ttl := cfg.PublicIP.CacheTTL
+	if refresh {
+		ttl = 0
+	}
+	return publicip.NewClient(log,
+		publicip.WithCache(cfg.PublicIP.CachePath, ttl),
+		publicip.WithMinInterval(cfg.PublicIP.MinInterval),
+	)
+}
+
+// currentMachine returns the name identifying this machine in the state file
+func currentMachine() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return "unknown"
+}
+
+// addTimeoutFlag registers the --timeout flag bounding the total duration of a command
+func addTimeoutFlag(cmd *cobra.Command, defaultTimeout time.Duration) {
+	cmd.Flags().Duration("timeout", defaultTimeout,
+		"Maximum duration of the command including all API calls (0 disables the deadline)")
+}
+
+// commandContext returns a context bounded by the command's --timeout flag
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	parent := cmd.Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
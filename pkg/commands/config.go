@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// NewConfigCommand creates and returns the config command
+func NewConfigCommand() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration format",
+	}
+
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the configuration file",
+		Long: `Print the JSON Schema of the configuration file, generated from the configuration
+structs, so editors and CI can validate configuration files against it.
+
+The same schema is checked when strict is enabled, rejecting unknown keys and mistyped values
+of the configuration file instead of ignoring them.`,
+		Example: `  # Write the schema next to the configuration
+  do-firewall-allowlister config schema > config.schema.json
+
+  # Then point the YAML language server at it from the first line of config.yaml
+  # yaml-language-server: $schema=config.schema.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigSchema()
+		},
+	}
+
+	configCmd.AddCommand(schemaCmd)
+	return configCmd
+}
+
+func runConfigSchema() error {
+	schema, err := json.MarshalIndent(config.NewSchema(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	fmt.Println(string(schema))
+	return nil
+}
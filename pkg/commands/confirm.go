@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/ui"
+)
+
+// maxListedChanges limits how many individual changes are printed in a confirmation prompt
+const maxListedChanges = 20
+
+// newConfirmFunc returns a hook that gates destructive firewall changes behind --yes or an interactive prompt
+func newConfirmFunc(assumeYes bool, maxRemovedAddresses int) digitalocean.ConfirmFunc {
+	return func(changes digitalocean.ChangeSummary) error {
+		if !changes.IsDestructive(maxRemovedAddresses) || assumeYes {
+			return nil
+		}
+
+		printChangeSummary(os.Stderr, changes)
+
+		if !ui.IsTerminal(os.Stdin) {
+			return fmt.Errorf("destructive change to firewall %s requires confirmation, re-run with --yes",
+				changes.FirewallID)
+		}
+
+		fmt.Fprint(os.Stderr, "Apply these changes? [y/N]: ")
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return nil
+		default:
+			return fmt.Errorf("aborted by user")
+		}
+	}
+}
+
+// printChangeSummary writes the destructive parts of a change summary for the operator
+func printChangeSummary(w io.Writer, changes digitalocean.ChangeSummary) {
+	fmt.Fprintf(w, "Firewall %s (%s) would lose %d address(es) and %d rule(s):\n",
+		changes.FirewallName, changes.FirewallID, len(changes.RemovedAddresses), len(changes.RemovedRules))
+
+	for _, rule := range changes.RemovedRules {
+		fmt.Fprintf(w, "  - rule %s\n", rule)
+	}
+
+	for i, address := range changes.RemovedAddresses {
+		if i == maxListedChanges {
+			fmt.Fprintf(w, "  ... and %d more\n", len(changes.RemovedAddresses)-maxListedChanges)
+			break
+		}
+		fmt.Fprintf(w, "  - %s\n", address)
+	}
+}
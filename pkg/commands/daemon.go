@@ -3,6 +3,7 @@ package commands
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/daemon"
@@ -13,7 +14,10 @@ import (
 
 // NewDaemonCommand creates and returns the daemon command
 func NewDaemonCommand() *cobra.Command {
-	var daemonDryRun bool
+	var (
+		daemonDryRun bool
+		force        bool
+	)
 
 	daemonCmd := &cobra.Command{
 		Use:   "daemon",
@@ -24,21 +28,59 @@ DigitalOcean firewall rules based on the configured schedule.
 The daemon will:
 - Fetch Cloudflare IP ranges
 - Resolve Netdata domain IPs
+- Fetch the IP lists configured under sources.http
 - Update DigitalOcean firewall rules
 - Run on the configured cron schedule
-- Handle graceful shutdown on SIGINT/SIGTERM`,
+- Handle graceful shutdown on SIGINT/SIGTERM
+- Reload the configuration on SIGHUP, restarting with it when it changed`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runDaemon(cmd, args, daemonDryRun)
+			return runDaemon(cmd, args, daemonDryRun, force)
 		},
 	}
 
 	// Add command-specific flags
 	daemonCmd.Flags().BoolVar(&daemonDryRun, "dry-run", false, "Show what would be done without making actual changes")
+	daemonCmd.Flags().BoolVar(&force, "force", false,
+		"Apply updates even if they remove access to safety.admin-ports for the admin CIDRs")
 
+	daemonCmd.AddCommand(newAddRuleCommand())
 	return daemonCmd
 }
 
-func runDaemon(cmd *cobra.Command, args []string, dryRun bool) error {
+// newAddRuleCommand creates and returns the daemon add-rule command
+func newAddRuleCommand() *cobra.Command {
+	var (
+		port       int
+		protocol   string
+		firewallID string
+	)
+
+	addRuleCmd := &cobra.Command{
+		Use:   "add-rule",
+		Short: "Add an inbound rule to a running daemon through its admin API",
+		Long: `Ask the daemon listening on admin.address to manage one more inbound rule. The
+daemon records the rule in its state file, so it survives restarts, and updates the
+firewall right away; from then on the rule gets the same sources as the configured ones.
+
+Requires admin.address and admin.token, set to the values the daemon runs with.`,
+		Example: `  # Open 8443 to the allowlisted sources on firewall-id
+  do-firewall-allowlister daemon add-rule --port 8443 --protocol tcp`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAddRule(cmd, port, protocol, firewallID)
+		},
+	}
+
+	addRuleCmd.Flags().IntVar(&port, "port", 0, "Port of the inbound rule")
+	addRuleCmd.Flags().StringVar(&protocol, "protocol", "tcp",
+		"Protocol of the inbound rule (tcp, udp, icmp, or several joined by +)")
+	addRuleCmd.Flags().StringVar(&firewallID, "firewall-id", "",
+		"Firewall to add the rule to (default: digitalocean.firewall-id)")
+	addTimeoutFlag(addRuleCmd, 3*time.Minute)
+
+	return addRuleCmd
+}
+
+func runDaemon(cmd *cobra.Command, args []string, dryRun bool, force bool) error {
 	// Get config file from global flag
 	configFile, _ := cmd.Flags().GetString("config")
 
@@ -46,13 +88,13 @@ func runDaemon(cmd *cobra.Command, args []string, dryRun bool) error {
 	config.SetDefaults()
 
 	// Load configuration (use root command flags for global flags)
-	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	cfg, tenants, err := config.LoadTenants(configFile, cmd.Root().PersistentFlags())
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	// Initialize logger
-	if err := logger.Initialize(cfg.LogLevel); err != nil {
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 	defer logger.Sync()
@@ -61,20 +103,100 @@ func runDaemon(cmd *cobra.Command, args []string, dryRun bool) error {
 	log.Info("Starting firewall allowlister daemon",
 		zap.String("schedule", cfg.Cron.Schedule),
 		zap.String("timezone", cfg.Cron.Timezone),
+		zap.Int("tenants", len(tenants)),
 		zap.Bool("dry_run", dryRun),
 	)
 
-	// Create daemon instance
-	d, err := daemon.NewDaemon(cfg, log, dryRun)
-	if err != nil {
-		return fmt.Errorf("failed to create daemon: %w", err)
+	// Create one daemon per tenant, each with its own credentials, state, schedule and logger
+	daemons := make([]*daemon.Daemon, 0, len(tenants))
+	for _, tenant := range tenants {
+		tenantLog := log
+		if tenant.Name != "" {
+			tenantLog = log.Named(tenant.Name).With(zap.String("tenant", tenant.Name))
+		}
+
+		d, err := daemon.NewDaemon(tenant.Config, tenantLog, dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to create daemon: %w", err)
+		}
+
+		// Scheduled updates must not lock the admin CIDRs out of the admin ports
+		d.SetAdminAccess(newAdminAccess(tenant.Config, "", force))
+		d.SetReloadFunc(newReloadFunc(cmd, configFile, tenant.Name))
+		daemons = append(daemons, d)
 	}
 
-	// Run daemon
+	// Run daemons
 	ctx := context.Background()
-	if err := d.Start(ctx); err != nil {
+	if err := daemon.StartAll(ctx, daemons); err != nil {
 		return fmt.Errorf("daemon failed: %w", err)
 	}
 
 	return nil
 }
+
+// newReloadFunc returns a function loading the configuration of the named tenant again, the
+// top-level configuration without tenants, for the daemon to reload on SIGHUP
+func newReloadFunc(cmd *cobra.Command, configFile, tenant string) daemon.ReloadFunc {
+	return func() (*config.Config, error) {
+		_, tenants, err := config.LoadTenants(configFile, cmd.Root().PersistentFlags())
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tenants {
+			if t.Name == tenant {
+				return t.Config, nil
+			}
+		}
+		if tenant == "" {
+			return nil, fmt.Errorf("tenants are configured now, restart the daemon to run them")
+		}
+		return nil, fmt.Errorf("tenant %s is no longer configured", tenant)
+	}
+}
+
+func runAddRule(cmd *cobra.Command, port int, protocol, firewallID string) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %d (must be 1-65535)", port)
+	}
+	if cfg.Admin.Address == "" {
+		return fmt.Errorf("admin API is not configured, set admin.address and admin.token")
+	}
+	client, err := daemon.NewAdminClient(cfg.Admin.Address, cfg.Admin.Token)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	response, err := client.AddRule(ctx, daemon.AdminRuleRequest{
+		FirewallID: firewallID,
+		Port:       port,
+		Protocol:   protocol,
+		AddedBy:    currentUser(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add rule: %w", err)
+	}
+
+	rule := response.Rule
+	fmt.Printf("Added %s/%d to firewall %s\n", rule.Protocol, rule.Port, rule.FirewallID)
+	if !response.Applied {
+		return fmt.Errorf("rule saved, but the firewall update failed and the next scheduled run retries it: %s", response.Error)
+	}
+	fmt.Println("Firewall updated")
+	return nil
+}
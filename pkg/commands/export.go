@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/export"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewExportCommand creates and returns the export command
+func NewExportCommand() *cobra.Command {
+	var (
+		format string
+		output string
+		chain  string
+	)
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Render the computed allowlist for other layers of the stack",
+		Long: `Collect the same source addresses the firewall update uses (Cloudflare IP ranges, resolved
+Netdata domains and sources.http lists) and render them for application-level allowlists.
+
+Formats:
+- nginx-allow: "allow <address>;" lines for an nginx include
+- haproxy-acl: one address per line, for "acl allowlisted src -f <file>"
+- iptables:    iptables/ip6tables commands appending ACCEPT rules to --chain
+- csv:         address, family and source columns
+- json:        entries with their source
+- plain:       one address per line
+
+The DigitalOcean firewall is not read or modified.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExport(cmd, format, output, chain)
+		},
+	}
+
+	exportCmd.Flags().StringVarP(&format, "format", "f", export.FormatPlain,
+		fmt.Sprintf("Output format (%s)", strings.Join(export.Formats, ", ")))
+	exportCmd.Flags().StringVarP(&output, "output", "o", "",
+		"File to write, replaced atomically, with a signature next to it when signing is configured (default: stdout)")
+	exportCmd.Flags().StringVar(&chain, "chain", export.DefaultIPTablesChain,
+		"Chain the iptables format appends rules to")
+	addTimeoutFlag(exportCmd, 2*time.Minute)
+
+	return exportCmd
+}
+
+func runExport(cmd *cobra.Command, format string, output string, chain string) error {
+	if err := export.ValidateFormat(format); err != nil {
+		return err
+	}
+
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// Exporting never mutates the firewall
+	svc := service.NewService(cfg, log, true)
+	sourceIPs, err := svc.CollectSourceIPs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to collect source IPs: %w", err)
+	}
+	entries := sourceIPs.Entries()
+
+	var buf bytes.Buffer
+	if err := export.Render(&buf, format, entries, export.Options{IPTablesChain: chain}); err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	// Load the key before writing, so a bad key does not leave an unsigned export behind
+	var signer *signing.Signer
+	if cfg.Signing.Format != "" {
+		if signer, err = signing.LoadSigner(cfg.Signing.Format, cfg.Signing.KeyFile); err != nil {
+			return err
+		}
+	}
+
+	if err := export.WriteFile(output, buf.Bytes()); err != nil {
+		return err
+	}
+
+	out := newPrinter(cmd)
+	out.Success("Exported %d addresses to %s", len(entries), output)
+	if signer != nil {
+		sig, err := signer.Sign(filepath.Base(output), buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := export.WriteFile(output+signer.Extension(), sig); err != nil {
+			return err
+		}
+		out.Detail("Signature written to %s", output+signer.Extension())
+	}
+	log.Info("Exported allowlist",
+		zap.String("format", format),
+		zap.String("path", output),
+		zap.Int("count", len(entries)))
+
+	return nil
+}
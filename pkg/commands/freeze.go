@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewFreezeCommand creates and returns the freeze command
+func NewFreezeCommand() *cobra.Command {
+	var reason, firewallID string
+
+	freezeCmd := &cobra.Command{
+		Use:   "freeze",
+		Short: "Halt automated firewall updates without stopping the daemon",
+		Long: `Mark the firewall as frozen in the state file so the daemon skips every scheduled
+update and logs an error instead, leaving the current rules untouched.
+
+Unlike lockdown, freeze does not change any firewall rule. Responders without access
+to the state file can freeze the firewall by adding the digitalocean.freeze-tag tag
+to it in the DigitalOcean console instead.
+
+Use the unfreeze command to resume automated updates.`,
+		Example: `  # Freeze firewall-id
+  do-firewall-allowlister freeze --reason "investigating INC-42"
+
+  # Freeze another configured firewall
+  do-firewall-allowlister freeze --firewall-id edge-firewall --reason "investigating INC-42"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runFreeze(cmd, firewallID, reason)
+		},
+	}
+
+	freezeCmd.Flags().StringVar(&reason, "reason", "", "Why automation is halted, shown in the daemon logs")
+	freezeCmd.Flags().StringVar(&firewallID, "firewall-id", "",
+		"Configured firewall to freeze (default: digitalocean.firewall-id)")
+
+	return freezeCmd
+}
+
+// NewUnfreezeCommand creates and returns the unfreeze command
+func NewUnfreezeCommand() *cobra.Command {
+	var firewallID string
+
+	unfreezeCmd := &cobra.Command{
+		Use:   "unfreeze",
+		Short: "Resume automated firewall updates halted by freeze",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUnfreeze(cmd, firewallID)
+		},
+	}
+
+	unfreezeCmd.Flags().StringVar(&firewallID, "firewall-id", "",
+		"Configured firewall to unfreeze (default: digitalocean.firewall-id)")
+
+	return unfreezeCmd
+}
+
+// freezeTarget returns the configured firewall a freeze applies to, firewall-id when firewallID
+// is empty
+func freezeTarget(cfg *config.Config, firewallID string) (string, error) {
+	if firewallID == "" {
+		return cfg.DigitalOcean.FirewallID, nil
+	}
+	if !slices.ContainsFunc(cfg.DigitalOcean.Targets(), func(target config.FirewallTarget) bool {
+		return target.ID == firewallID
+	}) {
+		return "", fmt.Errorf("unknown firewall %s: only configured firewalls can be frozen", firewallID)
+	}
+	return firewallID, nil
+}
+
+func runFreeze(cmd *cobra.Command, firewallID, reason string) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	firewallID, err = freezeTarget(cfg, firewallID)
+	if err != nil {
+		return err
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+	store := state.NewStore(cfg.State.Path, log)
+
+	freeze := state.Freeze{
+		FirewallID: firewallID,
+		Reason:     reason,
+		FrozenBy:   currentUser(),
+		FrozenAt:   time.Now().UTC(),
+	}
+	if err := store.Update(func(st *state.State) error {
+		st.SetFreeze(freeze)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to save freeze: %w", err)
+	}
+
+	out := newPrinter(cmd)
+	out.Warn("Firewall %s frozen, automated updates are halted", firewallID)
+	if firewallID == cfg.DigitalOcean.FirewallID {
+		out.Detail("Resume with: do-firewall-allowlister unfreeze")
+	} else {
+		out.Detail("Resume with: do-firewall-allowlister unfreeze --firewall-id %s", firewallID)
+	}
+	log.Warn("Firewall frozen, automated updates are halted until unfreeze",
+		zap.String("firewall_id", freeze.FirewallID),
+		zap.String("reason", freeze.Reason),
+		zap.String("frozen_by", freeze.FrozenBy))
+
+	return nil
+}
+
+func runUnfreeze(cmd *cobra.Command, firewallID string) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	firewallID, err = freezeTarget(cfg, firewallID)
+	if err != nil {
+		return err
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+	store := state.NewStore(cfg.State.Path, log)
+
+	err = store.Update(func(st *state.State) error {
+		if !st.RemoveFreeze(firewallID) {
+			return fmt.Errorf("firewall %s is not frozen", firewallID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	out := newPrinter(cmd)
+	out.Success("Firewall %s unfrozen, automated updates resume on the next run", firewallID)
+	if cfg.DigitalOcean.FreezeTag != "" {
+		out.Detail("Updates stay halted while the firewall carries the %s tag", cfg.DigitalOcean.FreezeTag)
+	}
+	log.Info("Firewall unfrozen", zap.String("firewall_id", firewallID))
+
+	return nil
+}
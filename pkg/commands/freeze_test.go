@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFreezeFirewallID(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	configFile := filepath.Join(dir, "config.yaml")
+	config := `digitalocean:
+  api-key: "test-api-key"
+  firewall-id: "web-firewall"
+  inbound-rules:
+    - port: 443
+      protocol: tcp
+  sources: [cloudflare]
+  firewalls:
+    - id: "edge-firewall"
+      inbound-rules:
+        - port: 80
+          protocol: tcp
+      sources: [cloudflare]
+state:
+  path: "` + statePath + `"
+`
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) error {
+		cmd := NewRootCommand(BuildInfo{})
+		cmd.SetArgs(append([]string{"--config", configFile, "-q"}, args...))
+		return cmd.Execute()
+	}
+	frozen := func(firewallID string) bool {
+		st, err := state.NewStore(statePath, zaptest.NewLogger(t)).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st.ActiveFreeze(firewallID) != nil
+	}
+
+	if err := run("freeze", "--firewall-id", "edge-firewall", "--reason", "INC-42"); err != nil {
+		t.Fatalf("expected the configured firewall to freeze, got %v", err)
+	}
+	if !frozen("edge-firewall") || frozen("web-firewall") {
+		t.Fatal("expected only edge-firewall to be frozen")
+	}
+
+	if err := run("freeze", "--firewall-id", "unknown-firewall"); err == nil {
+		t.Error("expected an unconfigured firewall to be rejected")
+	}
+	if err := run("unfreeze"); err == nil {
+		t.Error("expected unfreeze without --firewall-id to fail as web-firewall is not frozen")
+	}
+
+	if err := run("unfreeze", "--firewall-id", "edge-firewall"); err != nil {
+		t.Fatalf("expected edge-firewall to unfreeze, got %v", err)
+	}
+	if frozen("edge-firewall") {
+		t.Error("expected edge-firewall to be unfrozen")
+	}
+}
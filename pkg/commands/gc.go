@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/spf13/cobra"
+)
+
+// NewGCCommand creates and returns the gc command
+func NewGCCommand() *cobra.Command {
+	var (
+		dryRun    bool
+		assumeYes bool
+	)
+
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove the rules of ports dropped from the configuration",
+		Long: `Remove the inbound rules of ports that were dropped from a firewall's configuration.
+
+Every successful update records the ports it wrote rules for in the state file. A recorded
+port that no inbound rule configures anymore is orphaned, and gc deletes the rules covering
+only orphaned ports. Ports still holding addresses added by dynamic DNS, allow-current-ip,
+watch-ip, invites or self-service are kept, as are locked down and frozen firewalls.
+
+Rules written before ports were recorded, and rules whose port range also covers configured
+ports, are left alone. Deleting rules needs confirmation unless --yes is given; set gc.schedule
+to collect garbage from the daemon instead.`,
+		Example: `  # Review what would be removed, then remove it
+  do-firewall-allowlister gc --dry-run
+  do-firewall-allowlister gc --yes`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGC(cmd, dryRun, assumeYes)
+		},
+	}
+
+	gcCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show what would be removed without making actual changes")
+	gcCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false,
+		"Delete the rules without confirmation")
+	addTimeoutFlag(gcCmd, 2*time.Minute)
+
+	return gcCmd
+}
+
+func runGC(cmd *cobra.Command, dryRun bool, assumeYes bool) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	svc := service.NewService(cfg, logger.Get(), dryRun)
+	svc.SetConfirmFunc(newConfirmFunc(assumeYes, cfg.Confirmation.MaxRemovedAddresses))
+
+	out := newPrinter(cmd)
+	collected, err := svc.CollectGarbage(ctx)
+	for _, result := range collected {
+		ports := make([]string, len(result.Ports))
+		for i, port := range result.Ports {
+			ports[i] = fmt.Sprint(port)
+		}
+
+		verb := "Removed"
+		if !result.Applied {
+			verb = "Would remove"
+		}
+		out.Step("%s %d rules of unconfigured ports %s from firewall %s", verb, len(result.Rules),
+			strings.Join(ports, ", "), result.FirewallID)
+		for _, rule := range result.Rules {
+			out.Removed(1, "%s", rule)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to collect garbage: %w", err)
+	}
+
+	if len(collected) == 0 {
+		out.Success("No rules of unconfigured ports to remove")
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/ui"
+	"github.com/spf13/cobra"
+)
+
+// Files GitHub Actions reads the step outputs and the job summary from
+const (
+	githubOutputEnv  = "GITHUB_OUTPUT"
+	githubSummaryEnv = "GITHUB_STEP_SUMMARY"
+)
+
+// githubReport collects the firewall changes of a run for GitHub Actions, which gets an annotation
+// per changed or failed firewall, step outputs and a markdown diff in the job summary
+type githubReport struct {
+	// out receives the annotations, the standard output of the command unless it prints JSON
+	out io.Writer
+	// quiet leaves out the notices, as -q does with progress output; errors are always printed
+	quiet bool
+
+	mu        sync.Mutex
+	firewalls []githubFirewall
+	failures  []githubFailure
+}
+
+// githubFirewall is a firewall the run changes, with the lines of its diff
+type githubFirewall struct {
+	id      string
+	name    string
+	added   int
+	removed int
+	diff    []string
+}
+
+// githubFailure is a firewall the run failed to update
+type githubFailure struct {
+	id  string
+	err error
+}
+
+// addGitHubOutputFlag adds the --github-output flag to a command
+func addGitHubOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("github-output", false,
+		"Report to GitHub Actions: annotations, step outputs in $GITHUB_OUTPUT and a diff in $GITHUB_STEP_SUMMARY")
+}
+
+// newGitHubReport returns a report if the command runs with --github-output, nil otherwise
+func newGitHubReport(cmd *cobra.Command) *githubReport {
+	if enabled, _ := cmd.Flags().GetBool("github-output"); !enabled {
+		return nil
+	}
+
+	quiet, _ := cmd.Flags().GetCount("quiet")
+	report := &githubReport{out: cmd.OutOrStdout(), quiet: quiet > 0}
+	// GitHub Actions reads workflow commands from stderr as well, which keeps JSON output parsable
+	if output, _ := cmd.Flags().GetString("output"); output == "json" {
+		report.out = cmd.ErrOrStderr()
+	}
+	return report
+}
+
+// addPlan adds the changes of a plan, listing every source rather than the first
+// maxListedChanges so the summary can be reviewed in full
+func (r *githubReport) addPlan(plan digitalocean.Plan) {
+	if !plan.HasChanges() {
+		return
+	}
+
+	firewall := githubFirewall{id: plan.FirewallID, name: plan.FirewallName}
+	firewall.added, firewall.removed = plan.Counts()
+	for _, rule := range plan.Rules {
+		switch rule.Action {
+		case digitalocean.RuleCreate:
+			firewall.diff = append(firewall.diff, "+ "+rule.Rule)
+		case digitalocean.RuleDelete:
+			firewall.diff = append(firewall.diff, "- "+rule.Rule)
+		case digitalocean.RuleUpdate:
+			firewall.diff = append(firewall.diff, fmt.Sprintf("~ %s (%d unchanged)", rule.Rule, rule.Kept))
+		default:
+			continue
+		}
+		for _, source := range rule.Added {
+			firewall.diff = append(firewall.diff, "+     "+source)
+		}
+		for _, source := range rule.Removed {
+			firewall.diff = append(firewall.diff, "-     "+source)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.firewalls = append(r.firewalls, firewall)
+}
+
+// addChanges adds the changes of a firewall update, grouping the addresses by rule
+func (r *githubReport) addChanges(changes digitalocean.ChangeSummary) {
+	if !changes.HasChanges() {
+		return
+	}
+
+	firewall := githubFirewall{
+		id:      changes.FirewallID,
+		name:    changes.FirewallName,
+		added:   len(changes.AddedAddresses),
+		removed: len(changes.RemovedAddresses),
+	}
+	for _, rule := range changes.RemovedRules {
+		firewall.diff = append(firewall.diff, "- "+rule)
+	}
+
+	// Entries are "protocol/port address", the rule of each line is printed once
+	var rules []string
+	lines := make(map[string][]string)
+	group := func(entries []string, symbol string) {
+		for _, entry := range entries {
+			rule, address, _ := strings.Cut(entry, " ")
+			if _, ok := lines[rule]; !ok {
+				rules = append(rules, rule)
+			}
+			lines[rule] = append(lines[rule], symbol+"     "+address)
+		}
+	}
+	group(changes.AddedAddresses, "+")
+	group(changes.RemovedAddresses, "-")
+	for _, rule := range rules {
+		firewall.diff = append(firewall.diff, "~ "+rule)
+		firewall.diff = append(firewall.diff, lines[rule]...)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.firewalls = append(r.firewalls, firewall)
+}
+
+// addFailure records a firewall that failed to update, dropping the changes added for it since
+// they may not have been applied
+func (r *githubReport) addFailure(firewallID string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.firewalls[:0]
+	for _, firewall := range r.firewalls {
+		if firewall.id != firewallID {
+			kept = append(kept, firewall)
+		}
+	}
+	r.firewalls = kept
+	r.failures = append(r.failures, githubFailure{id: firewallID, err: err})
+}
+
+// write prints the annotations and appends the step outputs and the job summary; applied tells
+// whether the changes were made or only planned
+func (r *githubReport) write(applied bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added, removed := 0, 0
+	for _, firewall := range r.firewalls {
+		added, removed = added+firewall.added, removed+firewall.removed
+		if r.quiet {
+			continue
+		}
+		format := "would gain %d sources and lose %d"
+		if applied {
+			format = "gained %d sources and lost %d"
+		}
+		githubAnnotation(r.out, "notice", "Firewall "+firewall.label(),
+			fmt.Sprintf(format, firewall.added, firewall.removed))
+	}
+	for _, failure := range r.failures {
+		githubAnnotation(r.out, "error", "Firewall "+failure.id, failure.err.Error())
+	}
+
+	summary := r.markdown(applied, added, removed)
+	changed := len(r.firewalls) > 0
+	outputs := strings.Join([]string{
+		fmt.Sprintf("changed=%t", changed),
+		fmt.Sprintf("changes-applied=%t", changed && applied),
+		fmt.Sprintf("firewalls=%d", len(r.firewalls)),
+		fmt.Sprintf("added=%d", added),
+		fmt.Sprintf("removed=%d", removed),
+		githubMultiline("diff", summary),
+	}, "\n") + "\n"
+
+	if os.Getenv(githubOutputEnv) == "" && os.Getenv(githubSummaryEnv) == "" {
+		ui.NewPlainPrinter(r.out).Warn("Not running in GitHub Actions, only the annotations were written")
+		return nil
+	}
+	if err := appendGitHubFile(githubOutputEnv, outputs); err != nil {
+		return err
+	}
+	return appendGitHubFile(githubSummaryEnv, summary)
+}
+
+// markdown renders the changes as a job summary with a diff block per firewall
+func (r *githubReport) markdown(applied bool, added, removed int) string {
+	var b strings.Builder
+	if applied {
+		b.WriteString("## Firewall update\n\n")
+	} else {
+		b.WriteString("## Firewall plan\n\n")
+	}
+
+	switch {
+	case len(r.firewalls) == 0 && len(r.failures) == 0:
+		b.WriteString("No changes, every firewall is up to date.\n")
+	case len(r.firewalls) > 0 && applied:
+		fmt.Fprintf(&b, "Added %d and removed %d sources on %d firewalls.\n", added, removed, len(r.firewalls))
+	case len(r.firewalls) > 0:
+		fmt.Fprintf(&b, "%d sources to add and %d to remove on %d firewalls.\n", added, removed, len(r.firewalls))
+	}
+	for _, failure := range r.failures {
+		fmt.Fprintf(&b, "\n> [!CAUTION]\n> Firewall `%s` failed: %s\n", failure.id, failure.err)
+	}
+
+	for _, firewall := range r.firewalls {
+		fmt.Fprintf(&b, "\n### %s\n\n```diff\n%s\n```\n", firewall.label(), strings.Join(firewall.diff, "\n"))
+	}
+	return b.String()
+}
+
+// label names a firewall with its ID
+func (f githubFirewall) label() string {
+	if f.name == "" {
+		return f.id
+	}
+	return fmt.Sprintf("%s (%s)", f.name, f.id)
+}
+
+// githubAnnotation prints a workflow command annotating the run, escaped as GitHub Actions requires
+func githubAnnotation(w io.Writer, level, title, message string) {
+	data := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	property := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	fmt.Fprintf(w, "::%s title=%s::%s\n", level, property.Replace(title), data.Replace(message))
+}
+
+// githubMultiline formats a multiline step output, delimited by a random token the value cannot hold
+func githubMultiline(name, value string) string {
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	delimiter := "ghadelimiter_" + hex.EncodeToString(token)
+	return fmt.Sprintf("%s<<%s\n%s\n%s", name, delimiter, strings.TrimSuffix(value, "\n"), delimiter)
+}
+
+// appendGitHubFile appends content to the file named by the environment variable, if it is set
+func appendGitHubFile(env, content string) error {
+	path := os.Getenv(env)
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open $%s: %w", env, err)
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write $%s: %w", env, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write $%s: %w", env, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/spf13/cobra"
+)
+
+func TestGitHubAnnotation(t *testing.T) {
+	var buf bytes.Buffer
+	githubAnnotation(&buf, "error", "Firewall web: eu, us", "100% failed\nretry later: 503, twice")
+
+	// Titles are properties, escaping : and , as well; messages only escape %, \r and \n
+	expected := "::error title=Firewall web%3A eu%2C us::100%25 failed%0Aretry later: 503, twice\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestGitHubMultiline(t *testing.T) {
+	output := githubMultiline("diff", "+ tcp/443\n- tcp/80\n")
+
+	lines := strings.Split(output, "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %q", output)
+	}
+	name, delimiter, _ := strings.Cut(lines[0], "<<")
+	if name != "diff" || !strings.HasPrefix(delimiter, "ghadelimiter_") || len(delimiter) != len("ghadelimiter_")+32 {
+		t.Errorf("expected diff<<ghadelimiter_<token>, got %q", lines[0])
+	}
+	if lines[1] != "+ tcp/443" || lines[2] != "- tcp/80" || lines[3] != delimiter {
+		t.Errorf("expected the value closed by the delimiter, got %q", output)
+	}
+	if other := githubMultiline("diff", "x"); strings.Contains(other, delimiter) {
+		t.Error("expected a new delimiter for every output")
+	}
+}
+
+func TestGitHubReportAddFailure(t *testing.T) {
+	report := &githubReport{}
+	report.addChanges(digitalocean.ChangeSummary{FirewallID: "fw-1", AddedAddresses: []string{"tcp/443 198.51.100.1"}})
+	report.addChanges(digitalocean.ChangeSummary{FirewallID: "fw-2", RemovedAddresses: []string{"tcp/443 203.0.113.9"}})
+	report.addFailure("fw-1", errors.New("403 forbidden"))
+
+	if len(report.firewalls) != 1 || report.firewalls[0].id != "fw-2" {
+		t.Errorf("expected only fw-2 to keep its changes, got %+v", report.firewalls)
+	}
+	if len(report.failures) != 1 || report.failures[0].id != "fw-1" {
+		t.Errorf("expected the failure of fw-1, got %+v", report.failures)
+	}
+}
+
+func TestGitHubReportWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied bool
+		changes []digitalocean.ChangeSummary
+		quiet   bool
+		outputs []string
+		out     string
+	}{
+		{
+			name:    "applied",
+			applied: true,
+			changes: []digitalocean.ChangeSummary{{FirewallID: "fw-1", FirewallName: "web", AddedAddresses: []string{"tcp/443 198.51.100.1"}}},
+			outputs: []string{"changed=true", "changes-applied=true", "firewalls=1", "added=1", "removed=0"},
+			out:     "::notice title=Firewall web (fw-1)::gained 1 sources and lost 0\n",
+		},
+		{
+			name:    "planned",
+			changes: []digitalocean.ChangeSummary{{FirewallID: "fw-1", FirewallName: "web", RemovedAddresses: []string{"tcp/443 198.51.100.1"}}},
+			outputs: []string{"changed=true", "changes-applied=false", "firewalls=1", "added=0", "removed=1"},
+			out:     "::notice title=Firewall web (fw-1)::would gain 0 sources and lose 1\n",
+		},
+		{
+			name:    "no changes",
+			applied: true,
+			outputs: []string{"changed=false", "changes-applied=false", "firewalls=0", "added=0", "removed=0"},
+		},
+		{
+			name:    "quiet",
+			applied: true,
+			changes: []digitalocean.ChangeSummary{{FirewallID: "fw-1", AddedAddresses: []string{"tcp/443 198.51.100.1"}}},
+			quiet:   true,
+			outputs: []string{"changed=true", "changes-applied=true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outputPath := filepath.Join(dir, "output")
+			summaryPath := filepath.Join(dir, "summary")
+			t.Setenv(githubOutputEnv, outputPath)
+			t.Setenv(githubSummaryEnv, summaryPath)
+
+			var buf bytes.Buffer
+			report := &githubReport{out: &buf, quiet: tt.quiet}
+			for _, changes := range tt.changes {
+				report.addChanges(changes)
+			}
+			if err := report.write(tt.applied); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if buf.String() != tt.out {
+				t.Errorf("expected annotations %q, got %q", tt.out, buf.String())
+			}
+			outputs, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("failed to read $%s: %v", githubOutputEnv, err)
+			}
+			lines := strings.Split(string(outputs), "\n")
+			for _, output := range tt.outputs {
+				if !strings.Contains(string(outputs), output+"\n") {
+					t.Errorf("expected output %s, got %q", output, outputs)
+				}
+			}
+			if !strings.HasPrefix(lines[5], "diff<<ghadelimiter_") {
+				t.Errorf("expected the diff output after the counts, got %q", lines[5])
+			}
+			summary, err := os.ReadFile(summaryPath)
+			if err != nil {
+				t.Fatalf("failed to read $%s: %v", githubSummaryEnv, err)
+			}
+			if !strings.HasPrefix(string(summary), "## Firewall") || !strings.Contains(string(outputs), string(summary)) {
+				t.Errorf("expected the job summary in $%s and the diff output, got %q", githubSummaryEnv, summary)
+			}
+		})
+	}
+}
+
+func TestGitHubReportFailureAnnotation(t *testing.T) {
+	t.Setenv(githubOutputEnv, "")
+	t.Setenv(githubSummaryEnv, "")
+
+	// Failures are annotated despite -q, like the failures of the progress output
+	var buf bytes.Buffer
+	report := &githubReport{out: &buf, quiet: true}
+	report.addFailure("fw-1", errors.New("403 forbidden"))
+	if err := report.write(true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "::error title=Firewall fw-1::403 forbidden\n⚠ Not running in GitHub Actions, only the annotations were written\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestNewGitHubReportOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		stderr bool
+	}{
+		{output: "text"},
+		{output: "json", stderr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			addGitHubOutputFlag(cmd)
+			cmd.Flags().StringP("output", "o", "text", "")
+			cmd.Flags().CountP("quiet", "q", "")
+			if err := cmd.ParseFlags([]string{"--github-output", "-o", tt.output}); err != nil {
+				t.Fatalf("failed to parse flags: %v", err)
+			}
+			var stdout, stderr bytes.Buffer
+			cmd.SetOut(&stdout)
+			cmd.SetErr(&stderr)
+
+			report := newGitHubReport(cmd)
+			if report == nil {
+				t.Fatal("expected a report with --github-output")
+			}
+			githubAnnotation(report.out, "notice", "Firewall fw-1", "changed")
+			if got := stderr.Len() > 0; got != tt.stderr {
+				t.Errorf("expected the annotation on stderr: %v, got stdout %q and stderr %q", tt.stderr, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
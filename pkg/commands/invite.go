@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/invite"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewInviteCommand creates and returns the invite command
+func NewInviteCommand() *cobra.Command {
+	var (
+		port     int
+		ttl      time.Duration
+		validFor time.Duration
+	)
+
+	inviteCmd := &cobra.Command{
+		Use:   "invite",
+		Short: "Create a one-time link that allowlists the visitor's IP",
+		Long: `Create a signed one-time URL served by the daemon's HTTP server. Visiting the link
+and confirming allowlists the visitor's IP address on the port until the TTL runs
+out, after which the daemon removes it again.
+
+This is a lightweight alternative to a VPN for contractor access: send the link,
+and the contractor's current address is allowed without sharing any credential.
+Links can only be redeemed once and stop working after --valid-for.
+
+Requires invites.signing-key and server.public-url, and a daemon running with
+server.address and the same signing key.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInvite(cmd, port, ttl, validFor)
+		},
+	}
+
+	inviteCmd.Flags().IntVar(&port, "port", 0,
+		"Port the visitor's IP is allowed on (default: invites.port)")
+	inviteCmd.Flags().DurationVar(&ttl, "ttl", 0,
+		"How long the visitor's IP stays allowed (default: invites.ttl)")
+	inviteCmd.Flags().DurationVar(&validFor, "valid-for", 0,
+		"How long the link can be redeemed (default: invites.valid-for)")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List redeemed invites and the access they opened",
+		RunE:  runListInvites,
+	}
+
+	inviteCmd.AddCommand(listCmd)
+	return inviteCmd
+}
+
+func runInvite(cmd *cobra.Command, port int, ttl, validFor time.Duration) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+
+	if cfg.Invites.SigningKey == "" || cfg.Server.PublicURL == "" {
+		return fmt.Errorf("invites.signing-key and server.public-url are required to create invites")
+	}
+
+	if port == 0 {
+		port = cfg.Invites.Port
+	}
+	if ttl == 0 {
+		ttl = cfg.Invites.TTL
+	}
+	if validFor == 0 {
+		validFor = cfg.Invites.ValidFor
+	}
+
+	// Validate port range
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %d (must be 1-65535)", port)
+	}
+	if ttl <= 0 || validFor <= 0 {
+		return fmt.Errorf("--ttl and --valid-for must be positive")
+	}
+	for _, rule := range cfg.DigitalOcean.InboundRules {
+		if rule.Port == port {
+			return fmt.Errorf("port %d is managed by digitalocean.inbound-rules, the next update would remove the invitee", port)
+		}
+	}
+
+	inv, err := invite.New(port, ttl, validFor, currentUser())
+	if err != nil {
+		return err
+	}
+	token, err := invite.Sign(inv, []byte(cfg.Invites.SigningKey))
+	if err != nil {
+		return err
+	}
+
+	log.Info("Created invite",
+		zap.String("invite_id", inv.ID),
+		zap.Int("port", inv.Port),
+		zap.Duration("ttl", inv.TTL),
+		zap.Time("link_expires_at", inv.ExpiresAt),
+		zap.String("created_by", inv.CreatedBy))
+
+	out := newPrinter(cmd)
+	out.Success("Invite %s allows one visitor on tcp/%d for %s", inv.ID, inv.Port, inv.TTL)
+	out.Detail("Link valid until %s", inv.ExpiresAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintln(cmd.OutOrStdout(), invite.URL(cfg.Server.PublicURL, token))
+	return nil
+}
+
+func runListInvites(cmd *cobra.Command, args []string) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	st, err := state.NewStore(cfg.State.Path, logger.Get()).Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	var grants []state.AccessGrant
+	for _, grant := range st.AccessGrants {
+		if grant.Kind == state.GrantInvite && grant.FirewallID == cfg.DigitalOcean.FirewallID {
+			grants = append(grants, grant)
+		}
+	}
+	if len(grants) == 0 {
+		fmt.Println("No redeemed invites")
+		return nil
+	}
+
+	for _, grant := range grants {
+		status := "active"
+		if grant.Closed {
+			status = "expired"
+		}
+		fmt.Printf("%s  %-40s port %-5d by %-12s until %s  %s\n",
+			grant.ID, grant.IP, grant.Port, grant.CreatedBy,
+			grant.ExpiresAt.Format("2006-01-02 15:04:05"), status)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewLockdownCommand creates and returns the lockdown command
+func NewLockdownCommand() *cobra.Command {
+	var (
+		ports      []int
+		breakGlass []string
+	)
+
+	lockdownCmd := &cobra.Command{
+		Use:   "lockdown",
+		Short: "Emergency lockdown of managed firewall rules",
+		Long: `Remove all inbound rules for the specified ports in one command, or replace their
+sources with break-glass CIDRs, for responding to active attacks.
+
+This command will:
+- Back up the current rules for the locked ports to the state file
+- Remove those rules, or restrict them to the --break-glass sources
+- Pause scheduled updates for the firewall until unlock is run
+
+Ports default to the ports of the configured inbound rules.
+Use the unlock command to restore the previous state from backup.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLockdown(cmd, ports, breakGlass)
+		},
+	}
+
+	lockdownCmd.Flags().IntSliceVar(&ports, "port", nil,
+		"Port to lock down (repeatable, default: all configured inbound rule ports)")
+	lockdownCmd.Flags().StringSliceVar(&breakGlass, "break-glass", nil,
+		"IP address or CIDR allowed during lockdown (repeatable)")
+	addTimeoutFlag(lockdownCmd, 2*time.Minute)
+
+	return lockdownCmd
+}
+
+// NewUnlockCommand creates and returns the unlock command
+func NewUnlockCommand() *cobra.Command {
+	unlockCmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Restore firewall rules saved by lockdown",
+		Long: `Restore the inbound rules backed up by the lockdown command and resume
+scheduled updates for the firewall.`,
+		RunE: runUnlock,
+	}
+	addTimeoutFlag(unlockCmd, 2*time.Minute)
+
+	return unlockCmd
+}
+
+func runLockdown(cmd *cobra.Command, ports []int, breakGlass []string) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+
+	if len(ports) == 0 {
+		for _, rule := range cfg.DigitalOcean.InboundRules {
+			ports = append(ports, rule.Port)
+		}
+	}
+	if len(ports) == 0 {
+		return fmt.Errorf("no ports to lock down (use --port or configure inbound rules)")
+	}
+	for _, port := range ports {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d (must be 1-65535)", port)
+		}
+	}
+
+	store := state.NewStore(cfg.State.Path, log)
+	doClient := newDigitalOceanClient(cfg, log)
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	err = store.Update(func(st *state.State) error {
+		if st.Lockdown != nil {
+			return fmt.Errorf("firewall %s is already locked down since %s, run unlock first",
+				st.Lockdown.FirewallID, st.Lockdown.LockedAt.Format(time.RFC3339))
+		}
+
+		backup, err := doClient.Lockdown(ctx, cfg.DigitalOcean.FirewallID, ports, breakGlass)
+		if err != nil {
+			return fmt.Errorf("failed to lock down firewall: %w", err)
+		}
+
+		st.Lockdown = &state.Lockdown{
+			FirewallID:        cfg.DigitalOcean.FirewallID,
+			Ports:             ports,
+			BreakGlassSources: breakGlass,
+			Backup:            backup,
+			LockedBy:          currentUser(),
+			LockedAt:          time.Now().UTC(),
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	out := newPrinter(cmd)
+	out.Warn("Firewall %s locked down on ports %v", cfg.DigitalOcean.FirewallID, ports)
+	out.Detail("Scheduled updates are paused until: do-firewall-allowlister unlock")
+	log.Warn("Firewall locked down, scheduled updates are paused until unlock",
+		zap.String("firewall_id", cfg.DigitalOcean.FirewallID),
+		zap.Ints("ports", ports),
+		zap.Strings("break_glass_sources", breakGlass))
+
+	return nil
+}
+
+func runUnlock(cmd *cobra.Command, args []string) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+	store := state.NewStore(cfg.State.Path, log)
+	doClient := newDigitalOceanClient(cfg, log)
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	err = store.Update(func(st *state.State) error {
+		lockdown := st.ActiveLockdown(cfg.DigitalOcean.FirewallID)
+		if lockdown == nil {
+			return fmt.Errorf("firewall %s is not locked down", cfg.DigitalOcean.FirewallID)
+		}
+
+		if err := doClient.RestoreRules(ctx, lockdown.FirewallID, lockdown.Ports, lockdown.Backup); err != nil {
+			return fmt.Errorf("failed to restore firewall rules: %w", err)
+		}
+
+		st.Lockdown = nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	newPrinter(cmd).Success("Firewall %s unlocked, previous rules restored", cfg.DigitalOcean.FirewallID)
+	log.Info("Firewall unlocked, previous rules restored",
+		zap.String("firewall_id", cfg.DigitalOcean.FirewallID))
+
+	return nil
+}
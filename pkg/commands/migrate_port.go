@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/spf13/cobra"
+)
+
+// NewMigratePortCommand creates and returns the migrate-port command
+func NewMigratePortCommand() *cobra.Command {
+	var (
+		from       int
+		to         int
+		firewallID string
+		dryRun     bool
+		assumeYes  bool
+	)
+
+	migratePortCmd := &cobra.Command{
+		Use:   "migrate-port",
+		Short: "Move the sources of a managed port to another port",
+		Long: `Move the sources of a managed port's inbound rules to another port, for rotating
+service ports without losing access:
+
+- The rules of --from are moved to --to in a single firewall update, merging into
+  rules that already exist for --to
+- Dynamic DNS, allow-current-ip, watch-ip, invite and self-service records, rules
+  added through the admin API and pending access requests move to --to
+- The inbound rules and dynamic-dns entries of the configuration file are rewritten,
+  keeping its comments
+
+Send SIGHUP to the daemon afterwards so it reloads the rewritten configuration. Moving the
+rules deletes those of --from, so it needs confirmation unless --yes is given.`,
+		Example: `  # Move SSH from 2222 to 22022 on firewall-id
+  do-firewall-allowlister migrate-port --from 2222 --to 22022
+
+  # Preview the migration on a further firewall
+  do-firewall-allowlister migrate-port --from 2222 --to 22022 --firewall-id edge-firewall --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMigratePort(cmd, firewallID, from, to, dryRun, assumeYes)
+		},
+	}
+
+	migratePortCmd.Flags().IntVar(&from, "from", 0, "Managed port to move the sources from")
+	migratePortCmd.Flags().IntVar(&to, "to", 0, "Port to move the sources to")
+	migratePortCmd.Flags().StringVar(&firewallID, "firewall-id", "",
+		"Configured firewall to migrate (default: digitalocean.firewall-id)")
+	migratePortCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show what would be moved without making actual changes")
+	migratePortCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false,
+		"Delete the rules of --from without confirmation")
+	addTimeoutFlag(migratePortCmd, 2*time.Minute)
+
+	return migratePortCmd
+}
+
+func runMigratePort(cmd *cobra.Command, firewallID string, from, to int, dryRun bool, assumeYes bool) error {
+	for _, port := range []int{from, to} {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d (must be 1-65535), set both --from and --to", port)
+		}
+	}
+	if from == to {
+		return fmt.Errorf("--from and --to must be different ports")
+	}
+
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	// Configured through the environment alone there is no file to rewrite
+	configFile = config.ResolveFile(configFile, cmd.Root().PersistentFlags())
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	if firewallID == "" {
+		firewallID = cfg.DigitalOcean.FirewallID
+	}
+
+	// Check the configuration file can be rewritten before touching the firewall
+	var (
+		configData    []byte
+		configChanges int
+	)
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to read configuration file: %w", err)
+		}
+		configData, configChanges, err = config.MigratePort(data, firewallID, firewallID == cfg.DigitalOcean.FirewallID, from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	svc := service.NewService(cfg, logger.Get(), dryRun)
+	svc.SetConfirmFunc(newConfirmFunc(assumeYes, cfg.Confirmation.MaxRemovedAddresses))
+
+	out := newPrinter(cmd)
+	migration, err := svc.MigratePort(ctx, firewallID, from, to)
+	if err != nil {
+		return err
+	}
+
+	verb := "Moved"
+	if !migration.Applied {
+		verb = "Would move"
+	}
+	out.Success("%s %d rules and %d state records of firewall %s from port %d to %d", verb,
+		migration.Rules, migration.Records, migration.FirewallID, from, to)
+
+	switch {
+	case configFile == "":
+		out.Warn("No configuration file given, change port %d to %d in the configuration by hand", from, to)
+	case configChanges == 0:
+		out.Warn("Port %d of firewall %s is not set in %s, change it to %d where it is configured", from, firewallID, configFile, to)
+	case !migration.Applied:
+		out.Detail("Would change %d ports in %s", configChanges, configFile)
+	default:
+		if err := writeConfigFile(configFile, configData); err != nil {
+			return fmt.Errorf("firewall and state were migrated but rewriting the configuration failed: %w", err)
+		}
+		out.Success("Changed %d ports in %s, send SIGHUP to the daemon to reload them", configChanges, configFile)
+	}
+	return nil
+}
+
+// writeConfigFile atomically replaces the configuration file, keeping its permissions since it
+// usually holds the API key
+func writeConfigFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat configuration file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary configuration file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary configuration file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary configuration file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set configuration file permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace configuration file %s: %w", path, err)
+	}
+	return nil
+}
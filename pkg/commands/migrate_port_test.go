@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeDigitalOcean answers the firewall reads of the DigitalOcean client, which sends its
+// requests through http.DefaultTransport
+type fakeDigitalOcean struct {
+	base     http.RoundTripper
+	firewall string
+}
+
+func (f *fakeDigitalOcean) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "api.digitalocean.com" {
+		return f.base.RoundTrip(req)
+	}
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "application/json")
+	_, _ = rec.WriteString(f.firewall)
+	return rec.Result(), nil
+}
+
+func TestMigratePortWithoutConfigFile(t *testing.T) {
+	api := &fakeDigitalOcean{
+		base:     http.DefaultTransport,
+		firewall: `{"firewall":{"id":"env-firewall-id","name":"web","inbound_rules":[{"protocol":"tcp","ports":"443","sources":{"addresses":["173.245.48.0/20"]}}]}}`,
+	}
+	http.DefaultTransport = api
+	t.Cleanup(func() { http.DefaultTransport = api.base })
+
+	// Configured through the environment alone, as the missing default config.yaml allows
+	t.Chdir(t.TempDir())
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY", "env-api-key")
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_FIREWALL_ID", "env-firewall-id")
+	t.Setenv("FIREWALL_ALLOWLISTER_PRESETS", "cloudflare-web")
+
+	cmd := NewRootCommand(BuildInfo{})
+	cmd.SetArgs([]string{"migrate-port", "--from", "443", "--to", "8443", "--dry-run", "-q"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected the migration to run without a configuration file, got %v", err)
+	}
+}
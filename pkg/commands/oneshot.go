@@ -2,18 +2,31 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/daemon"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/netdata"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/tracecontext"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/ui"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
 // NewOneshotCommand creates and returns the oneshot command
 func NewOneshotCommand() *cobra.Command {
-	var oneshotDryRun bool
+	var (
+		oneshotDryRun bool
+		assumeYes     bool
+		force         bool
+	)
 
 	oneshotCmd := &cobra.Command{
 		Use:   "oneshot",
@@ -23,23 +36,32 @@ func NewOneshotCommand() *cobra.Command {
 This command will:
 - Fetch Cloudflare IP ranges
 - Resolve Netdata domain IPs
+- Fetch the IP lists configured under sources.http
 - Update DigitalOcean firewall rules
 - Exit after completion
 
 This is useful for manual execution, testing, or integration with external schedulers.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runOneshot(cmd, args, oneshotDryRun)
+			return runOneshot(cmd, args, oneshotDryRun, assumeYes, force)
 		},
 	}
 
 	// Add command-specific flags
 	oneshotCmd.Flags().BoolVar(&oneshotDryRun, "dry-run", false,
 		"Show what would be done without making actual changes")
+	oneshotCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false,
+		"Apply destructive changes (rule deletions, large removals) without confirmation")
+	oneshotCmd.Flags().BoolVar(&force, "force", false,
+		"Apply the update even if it removes your access to safety.admin-ports")
+	oneshotCmd.Flags().String("traceparent", "",
+		"W3C traceparent of the triggering automation, linking audit records to its trace (default $TRACEPARENT)")
+	addGitHubOutputFlag(oneshotCmd)
+	addTimeoutFlag(oneshotCmd, 5*time.Minute)
 
 	return oneshotCmd
 }
 
-func runOneshot(cmd *cobra.Command, args []string, dryRun bool) error {
+func runOneshot(cmd *cobra.Command, args []string, dryRun bool, assumeYes bool, force bool) error {
 	// Get config file from global flag
 	configFile, _ := cmd.Flags().GetString("config")
 
@@ -53,7 +75,7 @@ func runOneshot(cmd *cobra.Command, args []string, dryRun bool) error {
 	}
 
 	// Initialize logger
-	if err := logger.Initialize(cfg.LogLevel); err != nil {
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 	defer logger.Sync()
@@ -71,13 +93,137 @@ func runOneshot(cmd *cobra.Command, args []string, dryRun bool) error {
 		return fmt.Errorf("failed to create daemon: %w", err)
 	}
 
-	// Run once
-	ctx := context.Background()
-	if err := d.RunOnce(ctx); err != nil {
+	// Require confirmation before destructive changes
+	confirm := newConfirmFunc(assumeYes, cfg.Confirmation.MaxRemovedAddresses)
+	report := newGitHubReport(cmd)
+	if report != nil {
+		// The changes of a firewall are reported once confirmed, just before they are written
+		d.SetConfirmFunc(func(changes digitalocean.ChangeSummary) error {
+			if err := confirm(changes); err != nil {
+				return err
+			}
+			report.addChanges(changes)
+			return nil
+		})
+	} else {
+		d.SetConfirmFunc(confirm)
+	}
+
+	out := newPrinter(cmd)
+	// Dry and read-only runs show what they would change, as the plan command does
+	d.SetPlanFunc(func(plan digitalocean.Plan) {
+		printPlan(out, plan)
+		if report != nil {
+			report.addPlan(plan)
+		}
+	})
+	if len(cfg.DigitalOcean.Firewalls) > 0 {
+		out.Step("Updating firewall %s and %d further firewalls", cfg.DigitalOcean.FirewallID, len(cfg.DigitalOcean.Firewalls))
+	} else {
+		out.Step("Updating firewall %s", cfg.DigitalOcean.FirewallID)
+	}
+
+	// Run once, bounded by the command timeout
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+	// Lite mode skips tracing, so runs are not tied to the caller's trace
+	if !cfg.Lite {
+		ctx = withCallerTrace(ctx, cmd, log)
+	}
+
+	// Refuse to lock the operator out of the admin ports unless forced
+	d.SetAdminAccess(newAdminAccess(cfg, detectOperatorIP(ctx, cfg, log), force))
+
+	err = d.RunOnce(ctx)
+	printDomainResults(out, d.NetdataResults())
+	applied := !dryRun && !cfg.ReadOnly
+	if report != nil {
+		// Only the firewalls that reached the API are listed as changed
+		var updateErr *service.UpdateError
+		switch {
+		case errors.As(err, &updateErr):
+			for _, result := range updateErr.Failed() {
+				report.addFailure(result.FirewallID, result.Err)
+			}
+		case err != nil:
+			report.addFailure(cfg.DigitalOcean.FirewallID, err)
+		}
+		if err := report.write(applied); err != nil {
+			log.Warn("Failed to write GitHub Actions output", zap.Error(err))
+		}
+	}
+	if err != nil {
 		log.Error("One-shot execution failed", zap.Error(err))
+		var updateErr *service.UpdateError
+		if !errors.As(err, &updateErr) {
+			out.Fail("Firewall update failed")
+			return fmt.Errorf("one-shot execution failed: %w", err)
+		}
+
+		// The other firewalls were still updated, so report how each of them fared
+		printFirewallResults(out, updateErr.Results)
 		return fmt.Errorf("one-shot execution failed: %w", err)
 	}
 
 	log.Info("One-shot execution completed successfully")
+	if dryRun {
+		out.Success("Dry run completed, no changes made")
+	} else {
+		out.Success("Firewall update completed")
+	}
 	return nil
 }
+
+// printFirewallResults reports the outcome of every firewall of a run
+func printFirewallResults(out *ui.Printer, results []service.FirewallResult) {
+	for _, result := range results {
+		switch result.Outcome {
+		case service.FirewallFailed:
+			out.Fail("Firewall %s failed: %v", result.FirewallID, result.Err)
+		case service.FirewallSkipped:
+			out.Warn("Firewall %s skipped", result.FirewallID)
+		default:
+			out.Success("Firewall %s %s", result.FirewallID, result.Outcome)
+		}
+	}
+}
+
+// printDomainResults lists how each Netdata domain resolved, so flaky domains stand out
+func printDomainResults(out *ui.Printer, results []netdata.DomainResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	width := 0
+	for _, result := range results {
+		width = max(width, len(result.Domain))
+	}
+	out.Step("Netdata domains")
+	for _, result := range results {
+		duration := result.Duration.Round(time.Millisecond)
+		if result.Error != "" {
+			out.Removed(1, "%-*s  %8s  %s", width, result.Domain, duration, result.Error)
+			continue
+		}
+		out.Added(1, "%-*s  %8s  %s", width, result.Domain, duration, strings.Join(result.IPs, ", "))
+	}
+}
+
+// withCallerTrace attaches the span of the automation that started the command, taken from
+// --traceparent or $TRACEPARENT; an invalid value is ignored as the W3C spec requires
+func withCallerTrace(ctx context.Context, cmd *cobra.Command, log *zap.Logger) context.Context {
+	value, _ := cmd.Flags().GetString("traceparent")
+	if value == "" {
+		value = os.Getenv(tracecontext.EnvVar)
+	}
+	if value == "" {
+		return ctx
+	}
+
+	caller, err := tracecontext.Parse(value)
+	if err != nil {
+		log.Warn("Ignoring invalid traceparent", zap.String("traceparent", value), zap.Error(err))
+		return ctx
+	}
+	return tracecontext.NewContext(ctx, caller)
+}
@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/ui"
+)
+
+func TestPrintFirewallResults(t *testing.T) {
+	var buf bytes.Buffer
+	printFirewallResults(ui.NewPlainPrinter(&buf), []service.FirewallResult{
+		{FirewallID: "fw-1", Outcome: service.FirewallUpdated},
+		{FirewallID: "fw-2", Outcome: service.FirewallFailed, Err: errors.New("403 forbidden")},
+		{FirewallID: "fw-3", Outcome: service.FirewallSkipped},
+		{FirewallID: "fw-4", Outcome: service.FirewallUnchanged},
+	})
+
+	expected := "✔ Firewall fw-1 updated\n✖ Firewall fw-2 failed: 403 forbidden\n⚠ Firewall fw-3 skipped\n✔ Firewall fw-4 unchanged\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+}
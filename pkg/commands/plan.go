@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/ui"
+	"github.com/spf13/cobra"
+)
+
+// NewPlanCommand creates and returns the plan command
+func NewPlanCommand() *cobra.Command {
+	var output string
+
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show the changes the next firewall update would make",
+		Long: `Collect the sources and compare every firewall's inbound rules with the rules the next
+update would write, printing the addresses each protocol and port gains and loses:
+
+  + rule or address to add
+  - rule or address to remove
+  ~ rule whose sources change
+
+Locked down and frozen firewalls are left out. The firewalls are only read, so this is safe to
+run against production before applying a configuration change with oneshot.
+
+When --output names a .json file, the plan is also saved there with the complete rules of every
+firewall, to be reviewed and then written verbatim by apply --plan.`,
+		Example: `  # Review the pending changes, then apply them
+  do-firewall-allowlister plan
+  do-firewall-allowlister oneshot
+
+  # Save the plan for review and apply exactly what was reviewed
+  do-firewall-allowlister plan -o plan.json
+  do-firewall-allowlister apply --plan plan.json
+
+  # Post the pending changes to the summary of a GitHub Actions job
+  do-firewall-allowlister plan --github-output`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPlan(cmd, output)
+		},
+	}
+
+	planCmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json), or a .json file to save the plan to for apply --plan")
+	addGitHubOutputFlag(planCmd)
+	addTimeoutFlag(planCmd, 2*time.Minute)
+
+	return planCmd
+}
+
+func runPlan(cmd *cobra.Command, output string) error {
+	// Any other .json value is the file the plan is saved to, besides printing it as text
+	planFile := ""
+	if output != "text" && output != "json" {
+		if filepath.Ext(output) != ".json" {
+			return fmt.Errorf("unsupported output format: %s (supported: text, json, or a .json plan file)", output)
+		}
+		planFile = output
+	}
+
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	// Planning never mutates the firewall
+	svc := service.NewService(cfg, logger.Get(), true)
+	planned, err := svc.PlanFirewallUpdates(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to plan firewall update: %w", err)
+	}
+	var plans []digitalocean.Plan
+	for _, firewall := range planned {
+		plans = append(plans, firewall.Plan)
+	}
+
+	out := newPrinter(cmd)
+	if report := newGitHubReport(cmd); report != nil {
+		for _, plan := range plans {
+			report.addPlan(plan)
+		}
+		if err := report.write(false); err != nil {
+			return fmt.Errorf("failed to write GitHub Actions output: %w", err)
+		}
+	}
+
+	if output == "json" {
+		if plans == nil {
+			plans = []digitalocean.Plan{}
+		}
+		jsonOutput, err := json.MarshalIndent(plans, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal plans: %w", err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(jsonOutput))
+		return nil
+	}
+
+	if planFile != "" {
+		if err := digitalocean.WritePlanFile(planFile, digitalocean.NewPlanFile(planned, time.Now())); err != nil {
+			return err
+		}
+		defer out.Success("Plan saved to %s, apply it with: apply --plan %s", planFile, planFile)
+	}
+
+	if len(plans) == 0 {
+		out.Warn("Every firewall is locked down or frozen, nothing to plan")
+		return nil
+	}
+
+	added, removed, changed := 0, 0, 0
+	for _, plan := range plans {
+		printPlan(out, plan)
+		a, r := plan.Counts()
+		added, removed = added+a, removed+r
+		if plan.HasChanges() {
+			changed++
+		}
+	}
+	if changed == 0 {
+		out.Success("No changes, every firewall is up to date")
+		return nil
+	}
+	out.Step("Plan: %d sources to add and %d to remove on %d of %d firewalls", added, removed, changed, len(plans))
+	return nil
+}
+
+// printPlan writes the rules a plan changes as a diff, listing up to maxListedChanges sources
+// per rule and direction
+func printPlan(out *ui.Printer, plan digitalocean.Plan) {
+	name := plan.FirewallID
+	if plan.FirewallName != "" {
+		name = fmt.Sprintf("%s (%s)", plan.FirewallName, plan.FirewallID)
+	}
+	if !plan.HasChanges() {
+		out.Success("Firewall %s has no changes", name)
+		return
+	}
+
+	out.Step("Firewall %s", name)
+	for _, rule := range plan.Rules {
+		switch rule.Action {
+		case digitalocean.RuleCreate:
+			out.Added(1, "%s", rule.Rule)
+		case digitalocean.RuleDelete:
+			out.Removed(1, "%s", rule.Rule)
+		case digitalocean.RuleUpdate:
+			out.Changed(1, "%s (%d unchanged)", rule.Rule, rule.Kept)
+		default:
+			continue
+		}
+
+		for i, source := range rule.Added {
+			if i == maxListedChanges {
+				out.Added(2, "... and %d more", len(rule.Added)-maxListedChanges)
+				break
+			}
+			out.Added(2, "%s", source)
+		}
+		for i, source := range rule.Removed {
+			if i == maxListedChanges {
+				out.Removed(2, "... and %d more", len(rule.Removed)-maxListedChanges)
+				break
+			}
+			out.Removed(2, "%s", source)
+		}
+	}
+}
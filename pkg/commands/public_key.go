@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"github.com/spf13/cobra"
+)
+
+// NewPublicKeyCommand creates and returns the public-key command
+func NewPublicKeyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "public-key",
+		Short: "Print the public key verifying signed allowlists",
+		Long: `Print the public key of signing.key-file, for consumers verifying the allowlists that
+export, the allowlist server and publishing sign.
+
+minisign keys are printed in minisign's public key format:
+  minisign -Vm allowlist.txt -p allowlister.pub
+
+cosign keys are printed as a PEM public key:
+  cosign verify-blob --key allowlister.pub --signature allowlist.txt.sig --insecure-ignore-tlog allowlist.txt`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPublicKey(cmd)
+		},
+	}
+}
+
+func runPublicKey(cmd *cobra.Command) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if cfg.Signing.Format == "" {
+		return fmt.Errorf("signing is not configured, set signing.format and signing.key-file")
+	}
+
+	signer, err := signing.LoadSigner(cfg.Signing.Format, cfg.Signing.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := signer.PublicKey()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(publicKey)
+	return err
+}
@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewRollbackCommand creates and returns the rollback command
+func NewRollbackCommand() *cobra.Command {
+	var (
+		to         string
+		firewallID string
+		list       bool
+		dryRun     bool
+		assumeYes  bool
+		force      bool
+	)
+
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Restore firewall rules from a snapshot taken before an update",
+		Long: `Restore the inbound and outbound rules a firewall had before one of its updates.
+
+Before every firewall update the rules it replaces are saved as a snapshot, keeping the
+latest state.snapshots of every firewall next to the state file. --to picks the snapshot by
+index, 0 being the newest, or as the newest taken at or before an RFC 3339 timestamp; it
+defaults to the newest. The rollback is snapshotted like any update, so it can be rolled
+back in turn.
+
+Scheduled runs write the rules of the configured sources again; freeze the firewall to
+keep the restored rules in place.`,
+		Example: `  # List the snapshots of digitalocean.firewall-id
+  do-firewall-allowlister rollback --list
+
+  # Undo the last update
+  do-firewall-allowlister rollback
+
+  # Restore the rules the firewall had at 09:00 UTC
+  do-firewall-allowlister rollback --to 2024-05-01T09:00:00Z --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRollback(cmd, firewallID, to, list, dryRun, assumeYes, force)
+		},
+	}
+
+	rollbackCmd.Flags().StringVar(&to, "to", "",
+		"Snapshot to restore, an index (0 is the newest) or an RFC 3339 timestamp (default: newest)")
+	rollbackCmd.Flags().StringVar(&firewallID, "firewall-id", "",
+		"Firewall to roll back (default: digitalocean.firewall-id)")
+	rollbackCmd.Flags().BoolVar(&list, "list", false, "List the snapshots of the firewall and exit")
+	rollbackCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show what would be restored without making actual changes")
+	rollbackCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false,
+		"Apply destructive changes (rule deletions, large removals) without confirmation")
+	rollbackCmd.Flags().BoolVar(&force, "force", false,
+		"Roll back even if it removes your access to safety.admin-ports")
+	addTimeoutFlag(rollbackCmd, 2*time.Minute)
+
+	return rollbackCmd
+}
+
+func runRollback(cmd *cobra.Command, firewallID, to string, list, dryRun, assumeYes, force bool) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+	if firewallID == "" {
+		firewallID = cfg.DigitalOcean.FirewallID
+	}
+
+	store := state.NewSnapshotStore(cfg.State.SnapshotsPath(), cfg.State.Snapshots, log)
+	snapshots, err := store.List(firewallID)
+	if err != nil {
+		return err
+	}
+
+	out := newPrinter(cmd)
+	if list {
+		if len(snapshots) == 0 {
+			out.Warn("No snapshots of firewall %s in %s", firewallID, cfg.State.SnapshotsPath())
+			return nil
+		}
+		out.Step("Snapshots of firewall %s, newest first", firewallID)
+		for i, snapshot := range snapshots {
+			out.Detail("%d  %s  before %s, %d inbound and %d outbound rules", i,
+				snapshot.TakenAt.Format(time.RFC3339), snapshot.Action,
+				len(snapshot.InboundRules), len(snapshot.OutboundRules))
+		}
+		return nil
+	}
+
+	snapshot, err := state.SelectSnapshot(snapshots, to)
+	if err != nil {
+		return fmt.Errorf("failed to select snapshot of firewall %s: %w", firewallID, err)
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	doClient := newDigitalOceanClient(cfg, log)
+	out.Step("Rolling back firewall %s to the snapshot of %s", firewallID, snapshot.TakenAt.Format(time.RFC3339))
+
+	if dryRun {
+		firewall, err := doClient.GetFirewall(ctx, firewallID)
+		if err != nil {
+			return fmt.Errorf("failed to get current firewall: %w", err)
+		}
+		printPlan(out, digitalocean.DiffRules(firewall, snapshot.InboundRules))
+		out.Detail("Dry run, no changes made")
+		return nil
+	}
+
+	doClient.SetConfirmFunc(newConfirmFunc(assumeYes, cfg.Confirmation.MaxRemovedAddresses))
+	doClient.SetAdminAccess(newAdminAccess(cfg, detectOperatorIP(ctx, cfg, log), force))
+
+	changes, changed, err := doClient.RollbackFirewall(ctx, snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to roll back firewall: %w", err)
+	}
+	if !changed {
+		out.Success("Firewall %s already has the rules of the snapshot", firewallID)
+		return nil
+	}
+
+	out.Success("Firewall %s rolled back, %d address(es) added and %d removed", firewallID,
+		len(changes.AddedAddresses), len(changes.RemovedAddresses))
+	out.Detail("Scheduled runs apply the configured sources again unless the firewall is frozen")
+	log.Info("Firewall rolled back",
+		zap.String("firewall_id", firewallID),
+		zap.Time("snapshot_taken_at", snapshot.TakenAt))
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
 	"github.com/spf13/cobra"
 )
 
@@ -17,19 +18,38 @@ The service can run as a daemon with scheduled updates or as a one-shot command.
 	}
 
 	// Add global persistent flags that are common across all commands
-	rootCmd.PersistentFlags().StringP("config", "c", "config.yaml", "Path to configuration file")
-	rootCmd.PersistentFlags().String("log-level", "", "Log level (DEBUG, INFO, WARN, ERROR, FATAL)")
-	rootCmd.PersistentFlags().String("digitalocean.api-key", "", "DigitalOcean API key")
-	rootCmd.PersistentFlags().String("digitalocean.firewall-id", "", "DigitalOcean firewall ID")
-	rootCmd.PersistentFlags().String("cron.schedule", "", "Cron schedule expression")
-	rootCmd.PersistentFlags().String("cron.timezone", "", "Timezone for cron schedule")
-	rootCmd.PersistentFlags().String("cloudflare.ips-url", "", "Cloudflare IPs API URL")
+	rootCmd.PersistentFlags().StringP("config", "c", config.DefaultConfigFile, "Path to configuration file")
+
+	// Every configuration field can be overridden with a flag named after its key, e.g. --cron.schedule
+	config.RegisterFlags(rootCmd.PersistentFlags())
+
+	rootCmd.PersistentFlags().CountP("quiet", "q", "Decrease output verbosity (repeatable, e.g. -qq)")
+	rootCmd.PersistentFlags().CountP("verbose", "v", "Increase output verbosity (repeatable, e.g. -vv)")
 
 	// Add subcommands
 	rootCmd.AddCommand(NewDaemonCommand())
 	rootCmd.AddCommand(NewOneshotCommand())
 	rootCmd.AddCommand(NewAllowCurrentIPCommand())
+	rootCmd.AddCommand(NewWatchIPCommand())
+	rootCmd.AddCommand(NewRequestAccessCommand())
+	rootCmd.AddCommand(NewApproveCommand())
+	rootCmd.AddCommand(NewDenyCommand())
+	rootCmd.AddCommand(NewInviteCommand())
+	rootCmd.AddCommand(NewLockdownCommand())
+	rootCmd.AddCommand(NewUnlockCommand())
+	rootCmd.AddCommand(NewFreezeCommand())
+	rootCmd.AddCommand(NewUnfreezeCommand())
+	rootCmd.AddCommand(NewRollbackCommand())
+	rootCmd.AddCommand(NewExportCommand())
+	rootCmd.AddCommand(NewPublicKeyCommand())
 	rootCmd.AddCommand(NewValidateCommand())
+	rootCmd.AddCommand(NewSimulateCommand())
+	rootCmd.AddCommand(NewPlanCommand())
+	rootCmd.AddCommand(NewApplyCommand())
+	rootCmd.AddCommand(NewAuditAccountCommand())
+	rootCmd.AddCommand(NewGCCommand())
+	rootCmd.AddCommand(NewMigratePortCommand())
+	rootCmd.AddCommand(NewConfigCommand())
 	rootCmd.AddCommand(NewVersionCommand(buildInfo))
 
 	return rootCmd
@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/daemon"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// NewSimulateCommand creates and returns the simulate command
+func NewSimulateCommand() *cobra.Command {
+	var (
+		start       string
+		output      string
+		changesOnly bool
+	)
+	duration := dayDuration(24 * time.Hour)
+
+	simulateCmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Preview the runs the daemon would schedule",
+		Long: `Move a simulated clock through the schedule the daemon would run and report every run:
+firewall updates and access window boundaries with the rules inside and outside their windows
+and the rules each run adds or removes, digests, audit shipping, and the invites and
+self-service grants whose TTL runs out, removing their addresses.
+
+Grants are read from the state file. No API is contacted and nothing is changed, so this is
+useful for checking cron expressions, windows and timezones before deploying them.`,
+		Example: `  # The coming week, only the runs that change a rule or expire a grant
+  do-firewall-allowlister simulate --duration 7d --changes-only`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSimulate(cmd, start, time.Duration(duration), output, changesOnly)
+		},
+	}
+
+	simulateCmd.Flags().StringVar(&start, "start", "", "Time to start the simulation at, in RFC 3339 format (default: now)")
+	simulateCmd.Flags().Var(&duration, "duration", "How far ahead to simulate, e.g. 12h, 7d or 1d12h")
+	simulateCmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	simulateCmd.Flags().BoolVar(&changesOnly, "changes-only", false, "Only report runs that add or remove a rule or expire a grant")
+
+	return simulateCmd
+}
+
+func runSimulate(cmd *cobra.Command, start string, duration time.Duration, output string, changesOnly bool) error {
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unsupported output format: %s (supported: text, json)", output)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("invalid duration %s: must be positive", dayDuration(duration))
+	}
+
+	startAt := time.Now()
+	if start != "" {
+		var err error
+		if startAt, err = time.Parse(time.RFC3339, start); err != nil {
+			return fmt.Errorf("invalid start time %s: %w", start, err)
+		}
+	}
+
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	runs, err := daemon.Simulate(cfg, logger.Get(), startAt, duration)
+	if err != nil {
+		return fmt.Errorf("simulation failed: %w", err)
+	}
+	if changesOnly {
+		runs = slices.DeleteFunc(runs, func(run daemon.SimulatedRun) bool {
+			return !run.Changes()
+		})
+	}
+
+	if output == "json" {
+		jsonOutput, err := json.MarshalIndent(runs, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal simulated runs: %w", err)
+		}
+		fmt.Println(string(jsonOutput))
+		return nil
+	}
+
+	if len(runs) == 0 {
+		fmt.Printf("No runs within %s\n", dayDuration(duration))
+		return nil
+	}
+
+	ruleChanges, expiries := 0, 0
+	for _, run := range runs {
+		fmt.Printf("%s  %s\n", run.At.Format("2006-01-02 15:04:05 MST"), run.Job)
+		for _, firewall := range run.Firewalls {
+			fmt.Printf("    %-40s active: %s", firewall.ID, listOrNone(firewall.Active))
+			if len(firewall.Inactive) > 0 {
+				fmt.Printf("  outside window: %s", strings.Join(firewall.Inactive, ", "))
+			}
+			if len(firewall.Opened) > 0 {
+				fmt.Printf("  adds: %s", strings.Join(firewall.Opened, ", "))
+			}
+			if len(firewall.Removed) > 0 {
+				fmt.Printf("  removes: %s", strings.Join(firewall.Removed, ", "))
+			}
+			fmt.Println()
+			ruleChanges += len(firewall.Opened) + len(firewall.Removed)
+		}
+		for _, grant := range run.ExpiredGrants {
+			fmt.Printf("    removes %s port %d, %s grant %s expired at %s\n", grant.IP, grant.Port, grant.Kind,
+				grant.ID, grant.ExpiresAt.In(run.At.Location()).Format("15:04:05"))
+		}
+		expiries += len(run.ExpiredGrants)
+	}
+	fmt.Printf("\n%d runs within %s: %d rule changes, %d grant expiries\n",
+		len(runs), dayDuration(duration), ruleChanges, expiries)
+
+	return nil
+}
+
+// dayDuration is a duration flag that also accepts a leading number of days, as in 7d or 1d12h
+type dayDuration time.Duration
+
+func (d *dayDuration) Set(value string) error {
+	var total time.Duration
+	if days, rest, ok := strings.Cut(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number of days in %s", value)
+		}
+		total = time.Duration(n) * 24 * time.Hour
+		value = rest
+	}
+	if value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		total += parsed
+	}
+	*d = dayDuration(total)
+	return nil
+}
+
+func (d dayDuration) String() string {
+	duration := time.Duration(d)
+	days := duration / (24 * time.Hour)
+	if days == 0 {
+		return duration.String()
+	}
+	if rest := duration - days*24*time.Hour; rest != 0 {
+		return fmt.Sprintf("%dd%s", days, rest)
+	}
+	return fmt.Sprintf("%dd", days)
+}
+
+func (d *dayDuration) Type() string {
+	return "duration"
+}
+
+// listOrNone joins values for display, showing none for an empty list
+func listOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
@@ -4,14 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
-	"github.com/kholisrag/do-firewall-allowlister/pkg/daemon"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
 	"github.com/spf13/cobra"
-	"go.uber.org/zap"
 )
 
 // NewValidateCommand creates and returns the validate command
@@ -29,9 +30,22 @@ This command will:
 - Validate cron schedule syntax
 - Show configuration summary
 
+The connectivity tests only reach each firewall and source once. --deep also runs a
+dry-run update, collecting every source and computing the changes to every firewall
+like a run would, without applying them.
+
+With --output json it runs every check even after one failed and prints a report
+listing each with its status (pass, fail or skip), duration and error, for CI gates
+to assert on; the command fails if any check failed.
+
 This is useful for troubleshooting configuration issues before running the service.`,
+		Example: `  # Fail a CI job unless every source can be collected
+  do-firewall-allowlister validate -o json | jq -e '[.checks[] | select(.name | startswith("source:")) | .status == "pass"] | all'`,
 		RunE: runValidate,
 	}
+	validateCmd.Flags().StringP("output", "o", "text", "Output format (text, json)")
+	validateCmd.Flags().Bool("deep", false, "Also run a dry-run update of every firewall")
+	addTimeoutFlag(validateCmd, 30*time.Second)
 
 	statusCmd := &cobra.Command{
 		Use:   "status",
@@ -42,6 +56,10 @@ This command will:
 - Check DigitalOcean API connectivity and firewall status
 - Check Cloudflare API connectivity and IP count
 - Check Netdata domain resolution status
+- Report whether the firewall was last changed by this tool or externally
+  (console, API or another tool) and list recent account actions
+- Report when the daemon on the state file started, its uptime, whether it
+  runs the current configuration, and when each firewall was last applied
 - Display results in JSON format
 
 This is useful for monitoring and health checking.`,
@@ -50,6 +68,7 @@ This is useful for monitoring and health checking.`,
 
 	var statusFormat string
 	statusCmd.Flags().StringVar(&statusFormat, "format", "json", "Output format (json, yaml)")
+	addTimeoutFlag(statusCmd, 30*time.Second)
 
 	validateCmd.AddCommand(statusCmd)
 	return validateCmd
@@ -59,75 +78,351 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	// Get config file from global flag
 	configFile, _ := cmd.Flags().GetString("config")
 
+	switch output, _ := cmd.Flags().GetString("output"); output {
+	case "json":
+		return runValidateReport(cmd, configFile)
+	case "text":
+	default:
+		return fmt.Errorf("unsupported output format: %s (supported: text, json)", output)
+	}
+
+	// Human-readable progress goes to stdout, structured logs stay on stderr
+	out := newPrinter(cmd)
+
 	// Set configuration defaults
 	config.SetDefaults()
 
 	// Load configuration (use root command flags for global flags)
+	out.Step("Loading configuration from %s", configFile)
 	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
 	if err != nil {
-		return fmt.Errorf("❌ Configuration validation failed: %w", err)
+		out.Fail("Configuration validation failed")
+		return fmt.Errorf("configuration validation failed: %w", err)
 	}
 
 	// Initialize logger with minimal output for validation
-	if err := logger.Initialize("ERROR"); err != nil {
+	if err := logger.Initialize(logLevel(cmd, "ERROR")); err != nil {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 	defer logger.Sync()
 
-	log := logger.Get()
-	log.Info("✅ Configuration file loaded successfully")
+	out.Success("Configuration file loaded successfully")
 
 	// Validate cron schedule
 	if err := scheduler.ValidateSchedule(cfg.Cron.Schedule); err != nil {
-		return fmt.Errorf("❌ Invalid cron schedule: %w", err)
+		out.Fail("Invalid cron schedule %q", cfg.Cron.Schedule)
+		return fmt.Errorf("invalid cron schedule: %w", err)
+	}
+
+	out.Success("Cron schedule %q is valid", cfg.Cron.Schedule)
+
+	// Validate access window schedules
+	for _, target := range cfg.DigitalOcean.Targets() {
+		for _, rule := range target.InboundRules {
+			if !rule.Window.Enabled() {
+				continue
+			}
+			if err := scheduler.ValidateSchedule(rule.Window.Open); err != nil {
+				out.Fail("Invalid access window open schedule for port %d of firewall %s", rule.Port, target.ID)
+				return fmt.Errorf("invalid access window open schedule for port %d of firewall %s: %w", rule.Port, target.ID, err)
+			}
+			if err := scheduler.ValidateSchedule(rule.Window.Close); err != nil {
+				out.Fail("Invalid access window close schedule for port %d of firewall %s", rule.Port, target.ID)
+				return fmt.Errorf("invalid access window close schedule for port %d of firewall %s: %w", rule.Port, target.ID, err)
+			}
+			out.Success("Access window for %s/%d is valid", rule.Protocol, rule.Port)
+		}
 	}
 
-	log.Info("✅ Cron schedule is valid", zap.String("schedule", cfg.Cron.Schedule))
+	// Validate the quiet hour schedules of notification channels
+	owners := []string{"notify.email"}
+	quietHours := []config.NotifyQuietHours{cfg.Notify.Email.QuietHours}
+	for i, webhook := range cfg.Notify.Webhooks {
+		owners = append(owners, fmt.Sprintf("notify.webhooks[%d]", i))
+		quietHours = append(quietHours, webhook.QuietHours)
+	}
+	for i, quiet := range quietHours {
+		owner := owners[i]
+		if !quiet.Enabled() {
+			continue
+		}
+		if err := scheduler.ValidateSchedule(quiet.Open); err != nil {
+			out.Fail("Invalid quiet hours open schedule of %s", owner)
+			return fmt.Errorf("invalid quiet hours open schedule of %s: %w", owner, err)
+		}
+		if err := scheduler.ValidateSchedule(quiet.Close); err != nil {
+			out.Fail("Invalid quiet hours close schedule of %s", owner)
+			return fmt.Errorf("invalid quiet hours close schedule of %s: %w", owner, err)
+		}
+		out.Success("Quiet hours of %s are valid", owner)
+	}
 
 	// Try to get next run time
 	if nextRun, err := scheduler.GetNextRunTime(cfg.Cron.Schedule, cfg.Cron.Timezone); err != nil {
-		log.Warn("⚠️  Could not determine next run time", zap.Error(err))
+		out.Warn("Could not determine next run time: %v", err)
 	} else {
-		log.Info("📅 Next scheduled run", zap.String("time", nextRun.Format(time.RFC3339)))
+		out.Detail("Next scheduled run: %s", nextRun.Format(time.RFC3339))
 	}
 
-	// Test connectivity
-	logger := logger.Get()
-	d, err := daemon.NewDaemon(cfg, logger, true) // Use dry-run mode for validation
-	if err != nil {
-		return fmt.Errorf("❌ Failed to initialize services: %w", err)
-	}
+	// Test connectivity, in dry-run mode so that --deep cannot change a firewall
+	svc := service.NewService(cfg, logger.Get(), true)
 
-	log.Info("🔍 Testing connectivity...")
+	out.Step("Testing connectivity...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := commandContext(cmd)
 	defer cancel()
 
-	if err := d.RunOnce(ctx); err != nil {
-		return fmt.Errorf("❌ Connectivity test failed: %w", err)
+	if err := svc.ValidateConfiguration(ctx); err != nil {
+		out.Fail("Connectivity test failed")
+		return fmt.Errorf("connectivity test failed: %w", err)
 	}
 
-	log.Info("✅ All connectivity tests passed")
+	out.Success("All connectivity tests passed")
+
+	if deep, _ := cmd.Flags().GetBool("deep"); deep {
+		out.Step("Running a dry-run update...")
+		if err := svc.UpdateFirewallRules(ctx); err != nil {
+			out.Fail("Dry-run update failed")
+			return fmt.Errorf("dry-run update failed: %w", err)
+		}
+		out.Success("Dry-run update completed")
+	}
+
+	// Tell operators up front whether the token can apply changes
+	if cfg.ReadOnly {
+		out.Detail("API token scopes not probed in read-only mode")
+	} else if scopes, err := svc.ProbeTokenScopes(ctx); err != nil {
+		out.Warn("Could not probe API token scopes: %v", err)
+	} else if !scopes.Write {
+		out.Warn("API token is %s: updates will fail, grant it the firewall:update scope", scopes)
+	} else {
+		out.Success("API token can read and update the firewall")
+	}
 
 	// Show configuration summary
-	log.Info("📋 Configuration Summary")
-	log.Info("Configuration details",
-		zap.String("log_level", cfg.LogLevel),
-		zap.String("cron_schedule", cfg.Cron.Schedule),
-		zap.String("cron_timezone", cfg.Cron.Timezone),
-		zap.String("firewall_id", cfg.DigitalOcean.FirewallID),
-		zap.String("cloudflare_url", cfg.Cloudflare.IPsURL),
-		zap.Int("netdata_domains", len(cfg.Netdata.Domains)),
-		zap.Int("inbound_rules", len(cfg.DigitalOcean.InboundRules)))
+	out.Step("Configuration summary")
+	out.Detail("Log level:       %s", cfg.LogLevel)
+	out.Detail("Cron schedule:   %s (%s)", cfg.Cron.Schedule, cfg.Cron.Timezone)
+	out.Detail("Firewall ID:     %s", cfg.DigitalOcean.FirewallID)
+	out.Detail("Cloudflare URL:  %s", cfg.Cloudflare.IPsURL)
+	out.Detail("Netdata domains: %d", len(cfg.Netdata.Domains))
+	out.Detail("Inbound rules:   %d", len(cfg.DigitalOcean.InboundRules))
 
 	for i, rule := range cfg.DigitalOcean.InboundRules {
-		log.Info("Inbound rule",
-			zap.Int("rule_number", i+1),
-			zap.String("protocol", rule.Protocol),
-			zap.Int("port", rule.Port))
+		if rule.Window.Enabled() {
+			out.Detail("  %d. %s/%d (open %q, close %q)", i+1, rule.Protocol, rule.Port, rule.Window.Open, rule.Window.Close)
+			continue
+		}
+		out.Detail("  %d. %s/%d", i+1, rule.Protocol, rule.Port)
+	}
+
+	for _, target := range cfg.DigitalOcean.Firewalls {
+		sources := "all sources"
+		if len(target.Sources) > 0 {
+			sources = strings.Join(target.Sources, ", ")
+		}
+		out.Detail("Firewall %s: %d inbound rules, %s", target.ID, len(target.InboundRules), sources)
 	}
 
-	log.Info("✅ Configuration validation completed successfully")
+	out.Success("Configuration validation completed successfully")
+	return nil
+}
+
+// The statuses of a validation check; a skipped check could not run because of an earlier failure
+// or does not apply to the configuration
+const (
+	checkPass = "pass"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// validationReport is what validate --output json prints
+type validationReport struct {
+	Config     string            `json:"config"`
+	Valid      bool              `json:"valid"`
+	DurationMS int64             `json:"duration_ms"`
+	Checks     []validationCheck `json:"checks"`
+}
+
+// validationCheck is one check of the report, named by kind and subject, e.g. source:cloudflare
+type validationCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// add records a check that took duration, failed if err is set
+func (r *validationReport) add(name, detail string, duration time.Duration, err error) {
+	check := validationCheck{Name: name, Status: checkPass, DurationMS: duration.Milliseconds(), Detail: detail}
+	if err != nil {
+		check.Status = checkFail
+		check.Error = err.Error()
+		r.Valid = false
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// run records the check done by fn, timing it
+func (r *validationReport) run(name string, fn func() (string, error)) {
+	start := time.Now()
+	detail, err := fn()
+	r.add(name, detail, time.Since(start), err)
+}
+
+// skip records a check that did not run and why
+func (r *validationReport) skip(name, reason string) {
+	r.Checks = append(r.Checks, validationCheck{Name: name, Status: checkSkip, Detail: reason})
+}
+
+// failed returns how many checks failed
+func (r *validationReport) failed() int {
+	failed := 0
+	for _, check := range r.Checks {
+		if check.Status == checkFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+// runValidateReport runs every validation check, including those following a failed one, and
+// prints the report as JSON on stdout
+func runValidateReport(cmd *cobra.Command, configFile string) error {
+	start := time.Now()
+	report := &validationReport{Config: configFile, Valid: true}
+
+	config.SetDefaults()
+	var cfg *config.Config
+	report.run("config", func() (string, error) {
+		var err error
+		cfg, err = config.Load(configFile, cmd.Root().PersistentFlags())
+		return "", err
+	})
+
+	if cfg != nil {
+		if err := logger.Initialize(logLevel(cmd, "ERROR")); err != nil {
+			return fmt.Errorf("failed to initialize logger: %w", err)
+		}
+		defer logger.Sync()
+
+		ctx, cancel := commandContext(cmd)
+		defer cancel()
+		deep, _ := cmd.Flags().GetBool("deep")
+		addValidationChecks(ctx, report, cfg, deep)
+	} else {
+		// Without a configuration the firewalls and sources are unknown, the checks are skipped
+		// by kind so the report still lists what did not run
+		for _, name := range followUpChecks {
+			report.skip(name, "skipped, the configuration failed to load")
+		}
+	}
+
+	report.DurationMS = time.Since(start).Milliseconds()
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal validation report: %w", err)
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(output))
+
+	if !report.Valid {
+		// The report explains the failure, usage after it would break parsing stdout as JSON
+		cmd.SilenceUsage = true
+		return fmt.Errorf("validation failed: %d of %d checks failed", report.failed(), len(report.Checks))
+	}
+	return nil
+}
+
+// followUpChecks are the kinds of the checks addValidationChecks runs, in order
+var followUpChecks = []string{"schedule", "digitalocean", "digitalocean:token-scopes", "source", "dynamic-dns", "dry-run"}
+
+// addValidationChecks runs the checks following the loading of the configuration: the
+// schedules, the DigitalOcean access, every source, and with deep a dry run once all of them
+// passed
+func addValidationChecks(ctx context.Context, report *validationReport, cfg *config.Config, deep bool) {
+	report.run("schedule", func() (string, error) {
+		if err := scheduler.ValidateSchedule(cfg.Cron.Schedule); err != nil {
+			return "", fmt.Errorf("invalid cron schedule %q: %w", cfg.Cron.Schedule, err)
+		}
+		nextRun, err := scheduler.GetNextRunTime(cfg.Cron.Schedule, cfg.Cron.Timezone)
+		if err != nil {
+			return "", err
+		}
+		return "next run at " + nextRun.Format(time.RFC3339), nil
+	})
+	for _, target := range cfg.DigitalOcean.Targets() {
+		for _, rule := range target.InboundRules {
+			if !rule.Window.Enabled() {
+				continue
+			}
+			report.run(fmt.Sprintf("schedule:window:%s:%s/%d", target.ID, rule.Protocol, rule.Port), func() (string, error) {
+				return "", validateWindow(rule.Window.Open, rule.Window.Close)
+			})
+		}
+	}
+	owners := []string{"notify.email"}
+	quietHours := []config.NotifyQuietHours{cfg.Notify.Email.QuietHours}
+	for i, webhook := range cfg.Notify.Webhooks {
+		owners = append(owners, fmt.Sprintf("notify.webhooks[%d]", i))
+		quietHours = append(quietHours, webhook.QuietHours)
+	}
+	for i, quiet := range quietHours {
+		if !quiet.Enabled() {
+			continue
+		}
+		report.run("schedule:quiet-hours:"+owners[i], func() (string, error) {
+			return "", validateWindow(quiet.Open, quiet.Close)
+		})
+	}
+
+	svc := service.NewService(cfg, logger.Get(), true)
+	checks := svc.CheckFirewalls(ctx)
+	for _, check := range checks {
+		report.add(check.Name, check.Detail, check.Duration, check.Err)
+	}
+
+	if cfg.ReadOnly {
+		report.skip("digitalocean:token-scopes", "not probed in read-only mode")
+	} else {
+		report.run("digitalocean:token-scopes", func() (string, error) {
+			scopes, err := svc.ProbeTokenScopes(ctx)
+			if err != nil {
+				return "", fmt.Errorf("failed to probe API token scopes: %w", err)
+			}
+			if !scopes.Write {
+				return "", fmt.Errorf("API token is %s: updates will fail, grant it the firewall:update scope", scopes)
+			}
+			return "token can read and update the firewall", nil
+		})
+	}
+
+	checks = append(svc.CheckSources(ctx), svc.CheckDynamicDNS(ctx)...)
+	for _, check := range checks {
+		report.add(check.Name, check.Detail, check.Duration, check.Err)
+	}
+
+	switch {
+	case !deep:
+		report.skip("dry-run", "run with --deep")
+		return
+	case !report.Valid:
+		report.skip("dry-run", "skipped after failed checks")
+		return
+	}
+	report.run("dry-run", func() (string, error) {
+		return "", svc.UpdateFirewallRules(ctx)
+	})
+}
+
+// validateWindow checks the open and close schedules of an access window or quiet hours
+func validateWindow(open, close string) error {
+	if err := scheduler.ValidateSchedule(open); err != nil {
+		return fmt.Errorf("invalid open schedule %q: %w", open, err)
+	}
+	if err := scheduler.ValidateSchedule(close); err != nil {
+		return fmt.Errorf("invalid close schedule %q: %w", close, err)
+	}
 	return nil
 }
 
@@ -140,26 +435,33 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	config.SetDefaults()
 
 	// Load configuration
-	_, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	// Initialize logger with minimal output
-	if err := logger.Initialize("ERROR"); err != nil {
+	if err := logger.Initialize(logLevel(cmd, "ERROR")); err != nil {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
 	defer logger.Sync()
 
-	// Get status (this would need to be implemented in daemon)
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	svc := service.NewService(cfg, logger.Get(), true)
+	serviceStatus, err := svc.GetStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get status: %w", err)
+	}
+
 	status := map[string]interface{}{
 		"timestamp": time.Now().Format(time.RFC3339),
 		"config":    configFile,
-		"services": map[string]string{
-			"digitalocean": "unknown",
-			"cloudflare":   "unknown",
-			"netdata":      "unknown",
-		},
+		"services":  serviceStatus,
+	}
+	if err := addDaemonStatus(status, svc, cfg, time.Now()); err != nil {
+		return err
 	}
 
 	// Output in requested format
@@ -178,3 +480,37 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	fmt.Println(string(output))
 	return nil
 }
+
+// daemonStatus is the daemon record of the state file as reported by the status command
+type daemonStatus struct {
+	*state.DaemonRecord
+	// Uptime is unset once the daemon stopped; a crashed daemon keeps it, so check the pid too
+	Uptime string `json:"uptime,omitempty"`
+	// ConfigCurrent reports whether the daemon runs the configuration the status command loaded
+	ConfigCurrent bool `json:"config_current"`
+}
+
+// addDaemonStatus adds the daemon started on the state file and the last successful apply of
+// every firewall to the status
+func addDaemonStatus(status map[string]interface{}, svc *service.Service, cfg *config.Config, now time.Time) error {
+	record, err := svc.DaemonRecord()
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		daemonInfo := daemonStatus{DaemonRecord: record, ConfigCurrent: record.ConfigHash == cfg.Hash()}
+		if record.StoppedAt == nil {
+			daemonInfo.Uptime = now.Sub(record.StartedAt).Round(time.Second).String()
+		}
+		status["daemon"] = daemonInfo
+	}
+
+	lastApplied, err := svc.LastSuccessfulRuns()
+	if err != nil {
+		return err
+	}
+	if len(lastApplied) > 0 {
+		status["last_applied"] = lastApplied
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateReportConfigFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{name: "invalid yaml", config: "cron: [\n"},
+		{name: "invalid setting", config: "sources:\n  address-family: ipv5\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configFile, []byte(tt.config), 0o600); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd := NewRootCommand(BuildInfo{})
+			cmd.SetOut(&stdout)
+			cmd.SetErr(&stderr)
+			cmd.SetArgs([]string{"validate", "-o", "json", "-c", configFile})
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), "validation failed: 1 of 7 checks failed") {
+				t.Fatalf("expected the failed validation, got %v", err)
+			}
+
+			// The report is the only output on stdout, with every field of its checks
+			var report map[string]any
+			if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+				t.Fatalf("expected a JSON report on stdout, got %q: %v", stdout.String(), err)
+			}
+			for _, field := range []string{"config", "valid", "duration_ms", "checks"} {
+				if _, ok := report[field]; !ok {
+					t.Errorf("expected the report to have %s, got %v", field, report)
+				}
+			}
+			if report["config"] != configFile || report["valid"] != false {
+				t.Errorf("expected an invalid report of %s, got %v", configFile, report)
+			}
+
+			var parsed validationReport
+			if err := json.Unmarshal(stdout.Bytes(), &parsed); err != nil {
+				t.Fatalf("failed to parse the report: %v", err)
+			}
+			if len(parsed.Checks) == 0 || parsed.Checks[0].Name != "config" || parsed.Checks[0].Status != checkFail || parsed.Checks[0].Error == "" {
+				t.Fatalf("expected the config check to fail with its error, got %+v", parsed.Checks)
+			}
+			var skipped []string
+			for _, check := range parsed.Checks[1:] {
+				if check.Status != checkSkip || check.Detail == "" {
+					t.Errorf("expected %s to be skipped with a reason, got %+v", check.Name, check)
+				}
+				skipped = append(skipped, check.Name)
+			}
+			if !slices.Equal(skipped, followUpChecks) {
+				t.Errorf("expected the skipped checks %v, got %v", followUpChecks, skipped)
+			}
+		})
+	}
+}
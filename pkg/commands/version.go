@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"runtime"
 
+	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
 	"github.com/spf13/cobra"
 )
 
@@ -22,6 +23,7 @@ type VersionInfo struct {
 	Date      string `json:"date"`
 	GoVersion string `json:"goVersion"`
 	Platform  string `json:"platform"`
+	TZData    string `json:"tzdata"`
 }
 
 // NewVersionCommand creates and returns the version command
@@ -48,6 +50,10 @@ func runVersion(output string, buildInfo BuildInfo) error {
 		Date:      buildInfo.Date,
 		GoVersion: runtime.Version(),
 		Platform:  fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+		TZData:    "system",
+	}
+	if scheduler.EmbeddedTZData {
+		versionInfo.TZData = "embedded"
 	}
 
 	switch output {
@@ -63,6 +69,7 @@ func runVersion(output string, buildInfo BuildInfo) error {
 		fmt.Printf("  built: %s\n", versionInfo.Date)
 		fmt.Printf("  go version: %s\n", versionInfo.GoVersion)
 		fmt.Printf("  platform: %s\n", versionInfo.Platform)
+		fmt.Printf("  tzdata: %s\n", versionInfo.TZData)
 	default:
 		return fmt.Errorf("unsupported output format: %s (supported: text, json)", output)
 	}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/logger"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/watcher"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewWatchIPCommand creates and returns the watch-ip command
+func NewWatchIPCommand() *cobra.Command {
+	var (
+		dryRun   bool
+		port     int
+		interval time.Duration
+	)
+
+	watchIPCmd := &cobra.Command{
+		Use:   "watch-ip",
+		Short: "Keep the SSH rule pointed at the current public IP (roaming mode)",
+		Long: `Run in the foreground, periodically re-detecting the current public IP address and
+updating the SSH rule in the DigitalOcean firewall whenever it changes.
+
+This command will:
+- Detect the current public IP and add it to the SSH rule for the port
+- Re-detect the IP on every --interval (default: 5m)
+- Replace the previous IP with the new one when it changes, keeping other sources
+- Handle graceful shutdown on SIGINT/SIGTERM
+
+This is useful on residential connections with rotating IPs.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runWatchIP(cmd, dryRun, port, interval)
+		},
+	}
+
+	watchIPCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show what would be done without making actual changes")
+	watchIPCmd.Flags().IntVar(&port, "port", 22,
+		"Port number for SSH access (default: 22)")
+	watchIPCmd.Flags().DurationVar(&interval, "interval", 5*time.Minute,
+		"How often to re-detect the public IP")
+
+	return watchIPCmd
+}
+
+func runWatchIP(cmd *cobra.Command, dryRun bool, port int, interval time.Duration) error {
+	// Get config file from global flag
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Set configuration defaults
+	config.SetDefaults()
+
+	// Load configuration (use root command flags for global flags)
+	cfg, err := config.Load(configFile, cmd.Root().PersistentFlags())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Initialize logger
+	if err := logger.Initialize(logLevel(cmd, cfg.LogLevel), loggerOptions(cfg)...); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	log := logger.Get()
+
+	// Validate port range and interval
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %d (must be 1-65535)", port)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %s (must be positive)", interval)
+	}
+
+	log.Info("Starting public IP watcher",
+		zap.String("config_file", configFile),
+		zap.String("firewall_id", cfg.DigitalOcean.FirewallID),
+		zap.Int("port", port),
+		zap.Duration("interval", interval),
+		zap.Bool("dry_run", dryRun))
+
+	// Always re-detect the IP; the service's minimum interval is still honored
+	publicIPClient := newPublicIPClient(cfg, log, true)
+	doClient := newDigitalOceanClient(cfg, log)
+	w := watcher.NewWatcher(publicIPClient, doClient, cfg.DigitalOcean.FirewallID, port, interval, dryRun, log)
+
+	// Resume from the address this machine added last time and record every change
+	store := state.NewStore(cfg.State.Path, log)
+	machine := currentMachine()
+	st, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if entry := st.FindSelfIP(machine, cfg.DigitalOcean.FirewallID, port); entry != nil {
+		w.SetPreviousIP(entry.IP)
+	}
+	w.SetOnChange(func(ip string) error {
+		return store.Update(func(st *state.State) error {
+			st.SetSelfIP(machine, cfg.DigitalOcean.FirewallID, port, ip)
+			return nil
+		})
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return w.Run(ctx)
+}
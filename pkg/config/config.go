@@ -1,9 +1,27 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/kholisrag/do-firewall-allowlister/pkg/notify"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
@@ -14,137 +32,948 @@ import (
 // Config represents the application configuration
 type Config struct {
 	LogLevel     string             `koanf:"log-level" yaml:"log-level"`
+	LogOutput    string             `koanf:"log-output" yaml:"log-output"`
+	Logging      LoggingConfig      `koanf:"logging" yaml:"logging"`
+	ReadOnly     bool               `koanf:"read-only" yaml:"read-only"`
 	Cron         CronConfig         `koanf:"cron" yaml:"cron"`
+	Run          RunConfig          `koanf:"run" yaml:"run"`
+	Reconcile    ReconcileConfig    `koanf:"reconcile" yaml:"reconcile"`
 	DigitalOcean DigitalOceanConfig `koanf:"digitalocean" yaml:"digitalocean"`
 	Netdata      NetdataConfig      `koanf:"netdata" yaml:"netdata"`
 	Cloudflare   CloudflareConfig   `koanf:"cloudflare" yaml:"cloudflare"`
+	Sources      SourcesConfig      `koanf:"sources" yaml:"sources"`
+	State        StateConfig        `koanf:"state" yaml:"state"`
+	Lock         LockConfig         `koanf:"lock" yaml:"lock"`
+	Confirmation ConfirmationConfig `koanf:"confirmation" yaml:"confirmation"`
+	Audit        AuditConfig        `koanf:"audit" yaml:"audit"`
+	PublicIP     PublicIPConfig     `koanf:"public-ip" yaml:"public-ip"`
+	Safety       SafetyConfig       `koanf:"safety" yaml:"safety"`
+	Server       ServerConfig       `koanf:"server" yaml:"server"`
+	Health       HealthConfig       `koanf:"health" yaml:"health"`
+	Admin        AdminConfig        `koanf:"admin" yaml:"admin"`
+	Publish      PublishConfig      `koanf:"publish" yaml:"publish"`
+	Signing      SigningConfig      `koanf:"signing" yaml:"signing"`
+	Digest       DigestConfig       `koanf:"digest" yaml:"digest"`
+	Trends       TrendsConfig       `koanf:"trends" yaml:"trends"`
+	Notify       NotifyConfig       `koanf:"notify" yaml:"notify"`
+	Metrics      MetricsConfig      `koanf:"metrics" yaml:"metrics"`
+	Invites      InvitesConfig      `koanf:"invites" yaml:"invites"`
+	SelfService  SelfServiceConfig  `koanf:"self-service" yaml:"self-service"`
+	GC           GCConfig           `koanf:"gc" yaml:"gc"`
+	// Presets are built-in rule and source combinations merged into the configuration, see Presets
+	Presets []string `koanf:"presets" yaml:"presets"`
+	// Tenant selects one of the configured tenants; the daemon runs every tenant when empty
+	Tenant string `koanf:"tenant" yaml:"tenant"`
+	// Lite trims the daemon for small droplets: no HTTP server (allowlist, metrics, invites and
+	// self-service) or admin API, no run tracing and no source size history
+	Lite bool `koanf:"lite" yaml:"lite"`
+	// Strict rejects config file keys and values that do not match the schema, see Schema
+	Strict bool `koanf:"strict" yaml:"strict"`
+}
+
+// LoggingConfig represents log sampling and per-module level configuration
+type LoggingConfig struct {
+	Sampling SamplingConfig    `koanf:"sampling" yaml:"sampling"`
+	Levels   map[string]string `koanf:"levels" yaml:"levels"`
+	Tag      string            `koanf:"tag" yaml:"tag"`
+	Syslog   SyslogConfig      `koanf:"syslog" yaml:"syslog"`
+	Hostname bool              `koanf:"hostname" yaml:"hostname"`
+	Fields   map[string]string `koanf:"fields" yaml:"fields"`
+	Ship     ShipConfig        `koanf:"ship" yaml:"ship"`
+}
+
+// ShipConfig represents an optional Graylog (GELF) or Logstash sink receiving every log entry
+type ShipConfig struct {
+	Format     string `koanf:"format" yaml:"format"`
+	Network    string `koanf:"network" yaml:"network"`
+	Address    string `koanf:"address" yaml:"address"`
+	BufferSize int    `koanf:"buffer-size" yaml:"buffer-size"`
+}
+
+// GlobalFields returns the fields attached to every log entry and audit record,
+// including the hostname when enabled
+func (l LoggingConfig) GlobalFields() map[string]string {
+	fields := make(map[string]string, len(l.Fields)+1)
+	if l.Hostname {
+		if hostname, err := os.Hostname(); err == nil {
+			fields["hostname"] = hostname
+		}
+	}
+	for k, v := range l.Fields {
+		fields[k] = v
+	}
+	return fields
+}
+
+// SyslogConfig represents the syslog destination used when log-output is syslog
+type SyslogConfig struct {
+	Network  string `koanf:"network" yaml:"network"`
+	Address  string `koanf:"address" yaml:"address"`
+	Facility string `koanf:"facility" yaml:"facility"`
+}
+
+// SamplingConfig limits repetitive log entries with the same level and message per tick
+type SamplingConfig struct {
+	Initial    int           `koanf:"initial" yaml:"initial"`
+	Thereafter int           `koanf:"thereafter" yaml:"thereafter"`
+	Tick       time.Duration `koanf:"tick" yaml:"tick"`
 }
 
 // CronConfig represents cron scheduling configuration
 type CronConfig struct {
 	Schedule string `koanf:"schedule" yaml:"schedule"`
 	Timezone string `koanf:"timezone" yaml:"timezone"`
+	// CatchUp runs a job immediately when its scheduled run was missed, e.g. after system suspend
+	CatchUp bool `koanf:"catch-up" yaml:"catch-up"`
+	// Mode adaptive also re-resolves the domains and reconciles when their DNS TTLs expire
+	Mode string `koanf:"mode" yaml:"mode"`
+	// MinInterval is the shortest delay between adaptive runs, however short the TTLs
+	MinInterval time.Duration `koanf:"min-interval" yaml:"min-interval"`
+}
+
+// RunConfig represents the limits of one firewall update run, keeping scheduled runs short when
+// sources or the DigitalOcean API fail
+type RunConfig struct {
+	// RetryBudget is the total backoff the retries of every source and API request of a run may
+	// wait, after which failing calls are no longer retried; 0 disables it
+	RetryBudget time.Duration `koanf:"retry-budget" yaml:"retry-budget"`
+	// Deadline cancels a run still going after it; 0 disables it
+	Deadline time.Duration `koanf:"deadline" yaml:"deadline"`
+}
+
+// ReconcileConfig represents the reconcile-on-change mode of the daemon, which polls the sources
+// between scheduled runs and only updates the firewalls when the collected addresses changed
+type ReconcileConfig struct {
+	// Interval is how often the sources are polled; 0 disables polling
+	Interval time.Duration `koanf:"interval" yaml:"interval"`
+	// MinApplyInterval is the shortest delay between updates triggered by changed sources
+	MinApplyInterval time.Duration `koanf:"min-apply-interval" yaml:"min-apply-interval"`
 }
 
+// Schedule modes of the firewall update
+const (
+	// CronModeFixed runs the update on cron.schedule only
+	CronModeFixed = "fixed"
+	// CronModeAdaptive runs it on cron.schedule and whenever the resolved DNS records expire
+	CronModeAdaptive = "adaptive"
+)
+
 // DigitalOceanConfig represents DigitalOcean API configuration
 type DigitalOceanConfig struct {
-	APIKey       string        `koanf:"api-key" yaml:"api-key"`
+	APIKey string `koanf:"api-key" yaml:"api-key"`
+	// APIKeyFile holds the API key instead of api-key and is re-read when the key is rotated
+	APIKeyFile   string        `koanf:"api-key-file" yaml:"api-key-file"`
 	FirewallID   string        `koanf:"firewall-id" yaml:"firewall-id"`
 	InboundRules []InboundRule `koanf:"inbound-rules" yaml:"inbound-rules"`
+	DynamicDNS   []DynamicDNS  `koanf:"dynamic-dns" yaml:"dynamic-dns"`
+	CompactRules bool          `koanf:"compact-rules" yaml:"compact-rules"`
+	// FreezeTag is the firewall tag that halts automated updates while present, empty disables it
+	FreezeTag string `koanf:"freeze-tag" yaml:"freeze-tag"`
+	// AllowLocalIPv6 accepts link-local (fe80::/10) and unique local (fc00::/7) sources
+	AllowLocalIPv6 bool `koanf:"allow-local-ipv6" yaml:"allow-local-ipv6"`
+	// Sources selects the sources allowlisted on firewall-id, every source when empty
+	Sources []string `koanf:"sources" yaml:"sources"`
+	// Firewalls are further firewalls updated in the same run as firewall-id
+	Firewalls []FirewallTarget `koanf:"firewalls" yaml:"firewalls"`
+	// Workers bounds how many firewalls a run updates at the same time; 0 updates them one by one
+	Workers int `koanf:"workers" yaml:"workers"`
+	// Retry controls the retries of API requests that are rate limited or fail with a server error
+	Retry DigitalOceanRetryConfig `koanf:"retry" yaml:"retry"`
+}
+
+// DigitalOceanRetryConfig represents the backoff of API requests answered with 429 or 5xx; a
+// Retry-After header takes precedence over the backoff
+type DigitalOceanRetryConfig struct {
+	// Retries is the number of retries of a request, 0 disables retrying
+	Retries    int           `koanf:"retries" yaml:"retries"`
+	MinBackoff time.Duration `koanf:"min-backoff" yaml:"min-backoff"`
+	MaxBackoff time.Duration `koanf:"max-backoff" yaml:"max-backoff"`
+}
+
+// FirewallTarget is a firewall updated on every run with its own inbound rules
+type FirewallTarget struct {
+	ID           string        `koanf:"id" yaml:"id"`
+	InboundRules []InboundRule `koanf:"inbound-rules" yaml:"inbound-rules"`
+	// Sources selects the sources allowlisted on the firewall, every source when empty
+	Sources []string `koanf:"sources" yaml:"sources"`
+}
+
+// Targets returns every firewall updated per run: firewall-id with the top-level inbound rules
+// and sources, followed by the further firewalls
+func (c DigitalOceanConfig) Targets() []FirewallTarget {
+	targets := []FirewallTarget{{ID: c.FirewallID, InboundRules: c.InboundRules, Sources: c.Sources}}
+	return append(targets, c.Firewalls...)
+}
+
+// builtinSources are the sources every configuration collects, besides sources.http
+var builtinSources = map[string]bool{
+	"cloudflare": true,
+	"netdata":    true,
+}
+
+// sourceNamePattern matches the names of HTTP sources
+var sourceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// jsonPathPattern matches dotted json paths whose segments may select array elements with [*]
+// or [key=value]
+var jsonPathPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\[(\*|[A-Za-z0-9_-]+=[^\]]*)\])?(\.[A-Za-z0-9_-]+(\[(\*|[A-Za-z0-9_-]+=[^\]]*)\])?)*$`)
+
+// DynamicDNS represents a dynamic-DNS hostname whose addresses are kept in the SSH rule for a port
+type DynamicDNS struct {
+	Hostname string `koanf:"hostname" yaml:"hostname"`
+	Port     int    `koanf:"port" yaml:"port"`
 }
 
 // InboundRule represents a firewall inbound rule
 type InboundRule struct {
-	Port     int    `koanf:"port" yaml:"port"`
-	Protocol string `koanf:"protocol" yaml:"protocol"`
+	Port     int          `koanf:"port" yaml:"port"`
+	Protocol string       `koanf:"protocol" yaml:"protocol"`
+	Window   AccessWindow `koanf:"window" yaml:"window"`
+	// Sources selects the sources the rule allows instead of those of its firewall
+	Sources []string `koanf:"sources" yaml:"sources"`
+	// SourceTags and SourceDropletIDs allow droplets by tag or ID besides the collected addresses
+	SourceTags       []string `koanf:"source-tags" yaml:"source-tags"`
+	SourceDropletIDs []int    `koanf:"source-droplet-ids" yaml:"source-droplet-ids"`
+}
+
+// Protocols returns the protocols the rule expands to, "tcp+udp" yields one rule per protocol
+func (r InboundRule) Protocols() []string {
+	return strings.Split(r.Protocol, "+")
+}
+
+// AccessWindow restricts a rule to the period between the open and close cron expressions
+type AccessWindow struct {
+	Open  string `koanf:"open" yaml:"open"`
+	Close string `koanf:"close" yaml:"close"`
+}
+
+// Enabled returns true if the access window is configured
+func (w AccessWindow) Enabled() bool {
+	return w.Open != "" || w.Close != ""
 }
 
 // NetdataConfig represents Netdata domains configuration
 type NetdataConfig struct {
 	Domains []string `koanf:"domains" yaml:"domains"`
+	// DomainOptions mark domains as required or optional; without an entry, a failing domain only
+	// fails the run when no other domain resolves
+	DomainOptions []NetdataDomainOption `koanf:"domain-options" yaml:"domain-options"`
+	// Resolver is the DNS server queried, host or host:port, the system resolver when empty
+	Resolver string `koanf:"resolver" yaml:"resolver"`
+	// DoH is the URL of a DNS-over-HTTPS endpoint queried instead of a DNS server
+	DoH string `koanf:"doh" yaml:"doh"`
+	// Timeout bounds each lookup
+	Timeout time.Duration `koanf:"timeout" yaml:"timeout"`
+	// OnFailure is what a run does when the Netdata domains fail to resolve, see OnFailureAbort
+	OnFailure string `koanf:"on-failure" yaml:"on-failure"`
+	// AddressFamily keeps the ipv4 or ipv6 addresses of the source only, sources.address-family when empty
+	AddressFamily string `koanf:"address-family" yaml:"address-family"`
+}
+
+// NetdataDomainOption sets whether a domain of netdata.domains must resolve: a required domain
+// failing fails the run, an optional one only warns
+type NetdataDomainOption struct {
+	Domain   string `koanf:"domain" yaml:"domain"`
+	Required bool   `koanf:"required" yaml:"required"`
+}
+
+// Required returns whether each domain with an option must resolve
+func (c NetdataConfig) Required() map[string]bool {
+	required := make(map[string]bool, len(c.DomainOptions))
+	for _, option := range c.DomainOptions {
+		required[option.Domain] = option.Required
+	}
+	return required
 }
 
 // CloudflareConfig represents Cloudflare API configuration
 type CloudflareConfig struct {
 	IPsURL string `koanf:"ips-url" yaml:"ips-url"`
+	// OnFailure is what a run does when the Cloudflare list cannot be fetched, see OnFailureAbort
+	OnFailure string `koanf:"on-failure" yaml:"on-failure"`
+	// AddressFamily keeps the ipv4 or ipv6 addresses of the source only, sources.address-family when empty
+	AddressFamily string `koanf:"address-family" yaml:"address-family"`
+}
+
+// The on-failure policies of a source: abort fails the run and leaves the firewalls as they are,
+// skip updates them without the source's addresses, use-cached with the addresses of its last
+// successful collection, or aborts when there is none
+const (
+	OnFailureAbort     = "abort"
+	OnFailureSkip      = "skip"
+	OnFailureUseCached = "use-cached"
+)
+
+// SourcesConfig represents further allowlist sources
+type SourcesConfig struct {
+	// HTTP are IP lists published at arbitrary URLs, like the Fastly, GitHub meta or AWS lists
+	HTTP []HTTPSource `koanf:"http" yaml:"http"`
+	// Networks are the CIDR blocks of known networks such as offices, recorded with their owner
+	Networks []NetworkSource `koanf:"networks" yaml:"networks"`
+	// Google are the ranges Google publishes in goog.json and cloud.json
+	Google []GoogleSource `koanf:"google" yaml:"google"`
+	// Probes are the addresses uptime monitoring providers run their checks from
+	Probes []ProbeSource `koanf:"probes" yaml:"probes"`
+	// DNS are domains resolved to their addresses, like netdata.domains under other names
+	DNS []DNSSource `koanf:"dns" yaml:"dns"`
+	// Timeout bounds the collection of each source, retries included; 0 disables it
+	Timeout time.Duration `koanf:"timeout" yaml:"timeout"`
+	// CacheTTL is how long the addresses of a source are reused from the state file instead of
+	// collecting it again; 0 collects every source on every run
+	CacheTTL time.Duration `koanf:"cache-ttl" yaml:"cache-ttl"`
+	// AddressFamily keeps the ipv4 or ipv6 addresses of every source only, e.g. for droplets
+	// without IPv6, or both; sources can set their own
+	AddressFamily string `koanf:"address-family" yaml:"address-family"`
+}
+
+// DNSSource is a named list of domains allowlisted at the addresses they resolve to
+type DNSSource struct {
+	Name    string   `koanf:"name" yaml:"name"`
+	Domains []string `koanf:"domains" yaml:"domains"`
+	// RecordTypes keep the addresses of A or AAAA records, both when empty
+	RecordTypes []string `koanf:"record-types" yaml:"record-types"`
+	// Resolver is the DNS server queried, host or host:port, the system resolver when empty
+	Resolver string `koanf:"resolver" yaml:"resolver"`
+	// DoH is the URL of a DNS-over-HTTPS endpoint queried instead of a DNS server
+	DoH string `koanf:"doh" yaml:"doh"`
+	// Timeout bounds each lookup, 10s when zero
+	Timeout time.Duration `koanf:"timeout" yaml:"timeout"`
+	// OnFailure is what a run does when the source fails, abort when empty
+	OnFailure string `koanf:"on-failure" yaml:"on-failure"`
+	// AddressFamily keeps the ipv4 or ipv6 addresses of the source only, sources.address-family when empty
+	AddressFamily string `koanf:"address-family" yaml:"address-family"`
+}
+
+// ProbeSource is the probe list of an uptime monitoring provider
+type ProbeSource struct {
+	// Name labels the addresses, the provider when empty
+	Name string `koanf:"name" yaml:"name"`
+	// Provider is uptimerobot or pingdom
+	Provider string `koanf:"provider" yaml:"provider"`
+	// URL overrides where the list is fetched; the provider's URL when empty
+	URL string `koanf:"url" yaml:"url"`
+	// Token is the Pingdom API token, required by its probes endpoint
+	Token string `koanf:"token" yaml:"token"`
+	// OnFailure is what a run does when the source fails, abort when empty
+	OnFailure string `koanf:"on-failure" yaml:"on-failure"`
+	// AddressFamily keeps the ipv4 or ipv6 addresses of the source only, sources.address-family when empty
+	AddressFamily string `koanf:"address-family" yaml:"address-family"`
+}
+
+// SourceName returns the name the probe addresses are labelled and selected by
+func (p ProbeSource) SourceName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.Provider
+}
+
+// GoogleSource is a range list published by Google, narrowed to some scopes
+type GoogleSource struct {
+	Name string `koanf:"name" yaml:"name"`
+	// List is goog for every Google address or cloud for the Google Cloud customer ranges
+	List string `koanf:"list" yaml:"list"`
+	// URL overrides where the list is fetched, e.g. a mirror; Google's URL when empty
+	URL string `koanf:"url" yaml:"url"`
+	// Scopes keep the cloud ranges of the matching regions, shell patterns like europe-*
+	Scopes []string `koanf:"scopes" yaml:"scopes"`
+	// OnFailure is what a run does when the source fails, abort when empty
+	OnFailure string `koanf:"on-failure" yaml:"on-failure"`
+	// AddressFamily keeps the ipv4 or ipv6 addresses of the source only, sources.address-family when empty
+	AddressFamily string `koanf:"address-family" yaml:"address-family"`
+}
+
+// NetworkSource is a named list of CIDR blocks, such as an office network; the name and owner
+// label its addresses in exports and the audit log
+type NetworkSource struct {
+	// Name labels the addresses and is what firewalls select them by
+	Name string `koanf:"name" yaml:"name"`
+	// Owner is who answers for the network, e.g. a team or an email address
+	Owner string   `koanf:"owner" yaml:"owner"`
+	CIDRs []string `koanf:"cidrs" yaml:"cidrs"`
+	// AddressFamily keeps the ipv4 or ipv6 addresses of the source only, sources.address-family when empty
+	AddressFamily string `koanf:"address-family" yaml:"address-family"`
+}
+
+// HTTPSource is an IP list fetched over HTTP and parsed according to its format
+type HTTPSource struct {
+	// Name labels the addresses in exports and metrics and is what firewalls select them by
+	Name string `koanf:"name" yaml:"name"`
+	URL  string `koanf:"url" yaml:"url"`
+	// Format is json, lines (newline-delimited) or csv
+	Format string `koanf:"format" yaml:"format"`
+	// Paths select the addresses of json lists, e.g. prefixes[service=CLOUDFRONT].ip_prefix
+	Paths []string `koanf:"paths" yaml:"paths"`
+	// Column is the zero-based column holding the addresses of csv lists
+	Column int `koanf:"column" yaml:"column"`
+	// SkipHeader ignores the first row of csv lists
+	SkipHeader bool `koanf:"skip-header" yaml:"skip-header"`
+	// OnFailure is what a run does when the source fails, abort when empty
+	OnFailure string `koanf:"on-failure" yaml:"on-failure"`
+	// AddressFamily keeps the ipv4 or ipv6 addresses of the source only, sources.address-family when empty
+	AddressFamily string `koanf:"address-family" yaml:"address-family"`
+}
+
+// StateConfig represents local state persistence configuration
+type StateConfig struct {
+	Path string `koanf:"path" yaml:"path"`
+	// Snapshots is how many snapshots of the rules replaced by updates are kept per firewall, for
+	// the rollback command; 0 disables them
+	Snapshots int `koanf:"snapshots" yaml:"snapshots"`
+}
+
+// SnapshotsPath returns the file keeping the firewall snapshots next to the state file, e.g.
+// state.json -> state.snapshots.json
+func (c StateConfig) SnapshotsPath() string {
+	ext := filepath.Ext(c.Path)
+	return strings.TrimSuffix(c.Path, ext) + ".snapshots" + ext
+}
+
+// ServerConfig represents the HTTP server publishing the computed allowlist in daemon mode
+type ServerConfig struct {
+	// Address to listen on, e.g. ":8080"; empty disables the server
+	Address string `koanf:"address" yaml:"address"`
+	// PublicURL is where users reach the server, e.g. https://allow.example.com, used in invite links
+	// and SSO redirects
+	PublicURL string `koanf:"public-url" yaml:"public-url"`
+	// TrustProxy takes the client IP from X-Forwarded-For when the server is behind a proxy
+	TrustProxy bool `koanf:"trust-proxy" yaml:"trust-proxy"`
+	// AuthTokens are the bearer tokens accepted on the allowlist and metrics endpoints; empty leaves them open
+	AuthTokens []string `koanf:"auth-tokens" yaml:"auth-tokens"`
+	// RateLimit is the number of requests per minute allowed per client, zero disables it
+	RateLimit int `koanf:"rate-limit" yaml:"rate-limit"`
+}
+
+// HealthConfig represents the daemon's probe server answering /healthz, /readyz and /status
+type HealthConfig struct {
+	// Address to listen on, e.g. ":8081"; empty disables the probe server
+	Address string `koanf:"address" yaml:"address"`
+	// Interval is how often the daemon probes the DigitalOcean API and every source between runs,
+	// for /readyz and the metrics; 0 disables the probes
+	Interval time.Duration `koanf:"interval" yaml:"interval"`
+}
+
+// AdminConfig represents the daemon's admin API, which adds managed rules at runtime
+type AdminConfig struct {
+	// Address to listen on, e.g. "127.0.0.1:8082"; empty disables the admin API
+	Address string `koanf:"address" yaml:"address"`
+	// Token is the bearer token required on every admin request
+	Token string `koanf:"token" yaml:"token"`
+}
+
+// minServerAuthTokenLength is the shortest bearer token accepted, in characters
+const minServerAuthTokenLength = 16
+
+// PublishConfig represents the optional upload of every changed allowlist to DigitalOcean Spaces or S3
+type PublishConfig struct {
+	// Endpoint of the S3-compatible API, e.g. https://nyc3.digitaloceanspaces.com; empty disables publishing
+	Endpoint  string `koanf:"endpoint" yaml:"endpoint"`
+	Region    string `koanf:"region" yaml:"region"`
+	Bucket    string `koanf:"bucket" yaml:"bucket"`
+	Prefix    string `koanf:"prefix" yaml:"prefix"`
+	AccessKey string `koanf:"access-key" yaml:"access-key"`
+	SecretKey string `koanf:"secret-key" yaml:"secret-key"`
+}
+
+// SigningConfig represents the signatures published next to exported, served and uploaded allowlists
+type SigningConfig struct {
+	// Format is minisign or cosign; empty disables signing
+	Format string `koanf:"format" yaml:"format"`
+	// KeyFile is an unencrypted PEM private key, Ed25519 for minisign or ECDSA P-256 for cosign
+	KeyFile string `koanf:"key-file" yaml:"key-file"`
+}
+
+// DigestConfig represents the periodic summary of applied changes posted to a webhook in daemon mode
+type DigestConfig struct {
+	// WebhookURL receives the digest, e.g. a Slack incoming webhook; empty disables it
+	WebhookURL string `koanf:"webhook-url" yaml:"webhook-url"`
+	// Schedule is the cron expression the digest is sent on, e.g. @daily or @weekly
+	Schedule string `koanf:"schedule" yaml:"schedule"`
+}
+
+// TrendsConfig represents the alerts raised when a source's address set changes size sharply
+// between runs, which usually means a provider feed is broken rather than the provider moved
+type TrendsConfig struct {
+	// MaxChangePercent is the size change between runs above which an alert is raised; 0 disables alerts
+	MaxChangePercent int `koanf:"max-change-percent" yaml:"max-change-percent"`
+	// WebhookURL also posts the alerts, e.g. to a Slack incoming webhook; empty only logs them
+	WebhookURL string `koanf:"webhook-url" yaml:"webhook-url"`
+}
+
+// NotifyConfig represents the notifications sent after the scheduled runs of the daemon, and how
+// they, the change digest and source size alerts are worded
+type NotifyConfig struct {
+	// Environment names the deployment in notifications, e.g. production or staging
+	Environment string         `koanf:"environment" yaml:"environment"`
+	Digest      NotifyTemplate `koanf:"digest" yaml:"digest"`
+	// Trends words the source size alerts
+	Trends NotifyTemplate `koanf:"trends" yaml:"trends"`
+	// Run words the notifications of scheduled runs
+	Run NotifyTemplate `koanf:"run" yaml:"run"`
+	// Webhooks receive a notification after every scheduled run that changed a firewall or failed
+	Webhooks []NotifyWebhook `koanf:"webhooks" yaml:"webhooks"`
+	// Email mails the same notifications through an SMTP server
+	Email NotifyEmail `koanf:"email" yaml:"email"`
+}
+
+// NotifyWebhook represents a webhook receiving run notifications
+type NotifyWebhook struct {
+	URL string `koanf:"url" yaml:"url"`
+	// Format is the payload format: generic (default), slack, discord or teams
+	Format string `koanf:"format" yaml:"format"`
+	// FailuresOnly leaves out the runs that succeeded, like MinSeverity failure
+	FailuresOnly bool `koanf:"failures-only" yaml:"failures-only"`
+	// MinSeverity is the lowest severity sent: change (default) or failure
+	MinSeverity string           `koanf:"min-severity" yaml:"min-severity"`
+	QuietHours  NotifyQuietHours `koanf:"quiet-hours" yaml:"quiet-hours"`
+}
+
+// NotifyEmail represents the SMTP server and recipients of run notification emails
+type NotifyEmail struct {
+	// Host is the SMTP server; empty disables email notifications
+	Host string `koanf:"host" yaml:"host"`
+	// Port defaults to 587 for starttls, 465 for tls and 25 for none
+	Port int `koanf:"port" yaml:"port"`
+	// TLS is starttls (default), tls for implicit TLS, or none for a trusted relay
+	TLS      string   `koanf:"tls" yaml:"tls"`
+	Username string   `koanf:"username" yaml:"username"`
+	Password string   `koanf:"password" yaml:"password"`
+	From     string   `koanf:"from" yaml:"from"`
+	To       []string `koanf:"to" yaml:"to"`
+	// FailuresOnly leaves out the runs that succeeded, like MinSeverity failure
+	FailuresOnly bool `koanf:"failures-only" yaml:"failures-only"`
+	// MinSeverity is the lowest severity sent: change (default) or failure
+	MinSeverity string           `koanf:"min-severity" yaml:"min-severity"`
+	QuietHours  NotifyQuietHours `koanf:"quiet-hours" yaml:"quiet-hours"`
+}
+
+// NotifyQuietHours represents the hours a notification channel only receives the severe
+// notifications, between the open and close cron expressions in cron.timezone
+type NotifyQuietHours struct {
+	Open  string `koanf:"open" yaml:"open"`
+	Close string `koanf:"close" yaml:"close"`
+	// MinSeverity is the lowest severity sent during quiet hours: failure (default) or none
+	MinSeverity string `koanf:"min-severity" yaml:"min-severity"`
+}
+
+// Enabled returns true if quiet hours are configured
+func (q NotifyQuietHours) Enabled() bool {
+	return q.Open != "" || q.Close != ""
+}
+
+// notifyWebhookFormats are the payload formats of run notification webhooks
+var notifyWebhookFormats = map[string]bool{"generic": true, "slack": true, "discord": true, "teams": true}
+
+// NotifyTemplate represents the Go templates of a notification's title and body, executed with
+// notify.TemplateData; an empty template keeps the default wording
+type NotifyTemplate struct {
+	Title string `koanf:"title" yaml:"title"`
+	Body  string `koanf:"body" yaml:"body"`
+}
+
+// MetricsConfig represents the Prometheus metrics served at /metrics by the allowlist server
+type MetricsConfig struct {
+	// Namespace prefixes every metric name so several deployments can share a Prometheus
+	Namespace string `koanf:"namespace" yaml:"namespace"`
+	// Labels are constant labels added to every sample, e.g. env or firewall name
+	Labels map[string]string `koanf:"labels" yaml:"labels"`
+	// SourceLabels breaks address counts down by source; disable to export a single series
+	SourceLabels bool `koanf:"source-labels" yaml:"source-labels"`
+}
+
+// InvitesConfig represents the signed one-time links that allowlist the visitor's IP for a while
+type InvitesConfig struct {
+	// SigningKey authenticates invite links; empty disables invites
+	SigningKey string `koanf:"signing-key" yaml:"signing-key"`
+	Port       int    `koanf:"port" yaml:"port"`
+	// TTL is how long a redeemed invite keeps the visitor's IP allowed
+	TTL time.Duration `koanf:"ttl" yaml:"ttl"`
+	// ValidFor is how long an invite link can be redeemed after it was created
+	ValidFor time.Duration `koanf:"valid-for" yaml:"valid-for"`
+}
+
+// GCConfig represents the daemon task removing the rules of ports dropped from the configuration
+type GCConfig struct {
+	// Schedule is the cron expression garbage collection runs on, e.g. @weekly; empty disables it
+	Schedule string `koanf:"schedule" yaml:"schedule"`
+}
+
+// SelfServiceConfig represents the SSO-protected endpoint where users allowlist their own IP
+type SelfServiceConfig struct {
+	// Provider is google, github or oidc; empty disables the endpoint
+	Provider     string `koanf:"provider" yaml:"provider"`
+	ClientID     string `koanf:"client-id" yaml:"client-id"`
+	ClientSecret string `koanf:"client-secret" yaml:"client-secret"`
+	// AuthURL, TokenURL and UserInfoURL are the endpoints of the oidc provider
+	AuthURL     string `koanf:"auth-url" yaml:"auth-url"`
+	TokenURL    string `koanf:"token-url" yaml:"token-url"`
+	UserInfoURL string `koanf:"userinfo-url" yaml:"userinfo-url"`
+	// SessionKey signs the session cookies of signed-in users
+	SessionKey string              `koanf:"session-key" yaml:"session-key"`
+	Policies   []SelfServicePolicy `koanf:"policies" yaml:"policies"`
+}
+
+// SelfServicePolicy grants the matching users access to the ports for at most MaxTTL
+type SelfServicePolicy struct {
+	// Users are emails, *@domain wildcards or GitHub logins
+	Users  []string      `koanf:"users" yaml:"users"`
+	Ports  []int         `koanf:"ports" yaml:"ports"`
+	MaxTTL time.Duration `koanf:"max-ttl" yaml:"max-ttl"`
+}
+
+// PolicyFor returns the first policy matching the identity
+func (c SelfServiceConfig) PolicyFor(identity string) (SelfServicePolicy, bool) {
+	for _, policy := range c.Policies {
+		if policy.Matches(identity) {
+			return policy, true
+		}
+	}
+	return SelfServicePolicy{}, false
+}
+
+// Matches reports whether the identity is one of the policy's users, ignoring case
+func (p SelfServicePolicy) Matches(identity string) bool {
+	identity = strings.ToLower(identity)
+	for _, user := range p.Users {
+		user = strings.ToLower(user)
+		if domain, ok := strings.CutPrefix(user, "*@"); ok {
+			if strings.HasSuffix(identity, "@"+domain) {
+				return true
+			}
+			continue
+		}
+		if identity == user {
+			return true
+		}
+	}
+	return false
+}
+
+// selfServiceProviders are the supported self-service identity providers
+var selfServiceProviders = map[string]bool{"google": true, "github": true, "oidc": true}
+
+// minInviteSigningKeyLength is the shortest signing key accepted, in bytes
+const minInviteSigningKeyLength = 32
+
+// LockConfig represents the single-instance lock acquired before firewall mutations
+type LockConfig struct {
+	Path    string        `koanf:"path" yaml:"path"`
+	Timeout time.Duration `koanf:"timeout" yaml:"timeout"`
+}
+
+// ConfirmationConfig represents the thresholds above which interactive commands require confirmation
+type ConfirmationConfig struct {
+	MaxRemovedAddresses int `koanf:"max-removed-addresses" yaml:"max-removed-addresses"`
+}
+
+// SafetyConfig represents the admin ports that updates must not lock the operator out of
+type SafetyConfig struct {
+	AdminPorts []int    `koanf:"admin-ports" yaml:"admin-ports"`
+	AdminCIDRs []string `koanf:"admin-cidrs" yaml:"admin-cidrs"`
+	// ReservedSources is what happens to private, loopback and bogon addresses resolved from
+	// domains and dynamic-DNS hostnames: drop, keep or fail
+	ReservedSources string `koanf:"reserved-sources" yaml:"reserved-sources"`
+	// BogonFilter drops bogon and reserved ranges from source lists such as Cloudflare's;
+	// disable to allowlist them as published
+	BogonFilter bool `koanf:"bogon-filter" yaml:"bogon-filter"`
+}
+
+// AuditConfig represents the local audit trail of firewall changes
+type AuditConfig struct {
+	Path string `koanf:"path" yaml:"path"`
+	// Ship forwards the audit log to a SIEM or log collector
+	Ship AuditShipConfig `koanf:"ship" yaml:"ship"`
+}
+
+// AuditShipConfig represents the forwarding of audit records to Splunk, Elastic or an HTTPS collector
+type AuditShipConfig struct {
+	// Type is splunk, elastic or https; empty disables shipping
+	Type string `koanf:"type" yaml:"type"`
+	// URL is the HEC event endpoint, the Elasticsearch cluster or the collector receiving JSON arrays
+	URL string `koanf:"url" yaml:"url"`
+	// Token is the HEC token, Elasticsearch API key or bearer token of the collector
+	Token string `koanf:"token" yaml:"token"`
+	// Index is the Splunk index, or the Elasticsearch index or data stream records are written to
+	Index     string `koanf:"index" yaml:"index"`
+	BatchSize int    `koanf:"batch-size" yaml:"batch-size"`
+	Retries   int    `koanf:"retries" yaml:"retries"`
+	// Interval is how often the daemon ships new records
+	Interval time.Duration `koanf:"interval" yaml:"interval"`
+}
+
+// auditShipTypes are the supported audit.ship.type values
+var auditShipTypes = map[string]bool{"splunk": true, "elastic": true, "https": true}
+
+// PublicIPConfig represents caching and rate limiting of public IP detection
+type PublicIPConfig struct {
+	CachePath   string        `koanf:"cache-path" yaml:"cache-path"`
+	CacheTTL    time.Duration `koanf:"cache-ttl" yaml:"cache-ttl"`
+	MinInterval time.Duration `koanf:"min-interval" yaml:"min-interval"`
+}
+
+// DefaultPublicIPCachePath is per user since the detected IP depends on the user's network
+var DefaultPublicIPCachePath = defaultPublicIPCachePath()
+
+func defaultPublicIPCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "do-firewall-allowlister", "public-ip.json")
+}
+
+// DefaultLockPath is shared by every instance on the host regardless of working directory
+var DefaultLockPath = filepath.Join(os.TempDir(), "do-firewall-allowlister.lock")
+
+// DefaultConfigFile is the configuration file read unless --config names another one; unlike a
+// named one it may be missing, leaving the settings to the environment and the flags
+const DefaultConfigFile = "config.yaml"
+
+// DefaultFreezeTag is the firewall tag incident responders add to halt automated updates
+const DefaultFreezeTag = "allowlister-freeze"
+
+// DefaultMetricsNamespace prefixes every exported metric name unless configured otherwise
+const DefaultMetricsNamespace = "firewall_allowlister"
+
+// metricNamePattern and labelNamePattern match the metric and label names Prometheus accepts
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// reservedMetricLabels are set by the exported metrics themselves and cannot be constant labels
+var reservedMetricLabels = map[string]bool{"source": true, "job_name": true, "probe": true}
+
+// validTagPattern matches the characters DigitalOcean allows in tag names
+var validTagPattern = regexp.MustCompile(`^[a-zA-Z0-9_:\-]{1,255}$`)
+
+// defaultValues are the built-in defaults, the lowest-priority configuration source
+var defaultValues = map[string]interface{}{
+	"log-level":                          "INFO",
+	"log-output":                         "stderr",
+	"logging.tag":                        "do-firewall-allowlister",
+	"logging.syslog.network":             "udp",
+	"logging.syslog.facility":            "daemon",
+	"logging.ship.network":               "tcp",
+	"logging.ship.buffer-size":           1000,
+	"logging.sampling.initial":           100,
+	"logging.sampling.thereafter":        100,
+	"logging.sampling.tick":              "1s",
+	"cron.schedule":                      "0 0 * * *", // Standard 5-field format: minute hour day month weekday
+	"cron.timezone":                      "UTC",
+	"cron.catch-up":                      false,
+	"reconcile.min-apply-interval":       "1m",
+	"digitalocean.freeze-tag":            DefaultFreezeTag,
+	"digitalocean.workers":               4,
+	"digitalocean.retry.retries":         3,
+	"digitalocean.retry.min-backoff":     "1s",
+	"digitalocean.retry.max-backoff":     "30s",
+	"cloudflare.ips-url":                 "https://api.cloudflare.com/client/v4/ips",
+	"cloudflare.on-failure":              OnFailureAbort,
+	"netdata.on-failure":                 OnFailureAbort,
+	"state.path":                         "state.json",
+	"state.snapshots":                    10,
+	"sources.timeout":                    "2m",
+	"sources.cache-ttl":                  "0s",
+	"sources.address-family":             sources.FamilyBoth,
+	"server.rate-limit":                  60,
+	"safety.reserved-sources":            "drop",
+	"safety.bogon-filter":                true,
+	"publish.region":                     "us-east-1",
+	"publish.prefix":                     "allowlist",
+	"digest.schedule":                    "@daily",
+	"trends.max-change-percent":          50,
+	"audit.ship.batch-size":              100,
+	"audit.ship.retries":                 3,
+	"audit.ship.interval":                "1m",
+	"metrics.namespace":                  DefaultMetricsNamespace,
+	"metrics.source-labels":              true,
+	"invites.port":                       22,
+	"invites.ttl":                        "8h",
+	"invites.valid-for":                  "24h",
+	"lock.timeout":                       "30s",
+	"confirmation.max-removed-addresses": 10,
+	"public-ip.cache-ttl":                "1m",
+	"public-ip.min-interval":             "5s",
 }
 
 var k = koanf.New(".")
 
 // Load loads configuration from YAML file, environment variables, and command line flags
 // Priority: CLI flags (highest) > Environment variables > YAML file (lowest)
+// When tenants are configured, the configuration of the tenant selected by tenant is returned
 func Load(configFile string, flags *pflag.FlagSet) (*Config, error) {
+	config, tenants, err := load(configFile, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tenants) == 0 {
+		return config, nil
+	}
+	if config.Tenant == "" {
+		return nil, fmt.Errorf("tenants are configured: select one with --tenant")
+	}
+	return selectTenant(tenants, config.Tenant)
+}
+
+// LoadTenants loads the top-level configuration and every tenant's, or just the selected tenant's;
+// without tenants the top-level configuration is the only tenant, with an empty name
+func LoadTenants(configFile string, flags *pflag.FlagSet) (*Config, []Tenant, error) {
+	config, tenants, err := load(configFile, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(tenants) == 0 {
+		return config, []Tenant{{Config: config}}, nil
+	}
+	if config.Tenant != "" {
+		selected, err := selectTenant(tenants, config.Tenant)
+		if err != nil {
+			return nil, nil, err
+		}
+		return config, []Tenant{{Name: config.Tenant, Config: selected}}, nil
+	}
+	return config, tenants, nil
+}
+
+// Hash returns the SHA-256 of the loaded configuration, the file merged with the environment and
+// the flags, telling a daemon started with other settings apart from one running the current ones
+func (c *Config) Hash() string {
+	// The tenant only selects which configuration this is
+	hashed := *c
+	hashed.Tenant = ""
+	data, _ := json.Marshal(hashed)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ResolveFile returns the configuration file Load reads, or an empty string when there is none:
+// without --config, deployments configured through the environment need no file at all, so a
+// missing default file is not an error
+func ResolveFile(configFile string, flags *pflag.FlagSet) string {
+	if configFile == DefaultConfigFile && (flags == nil || !flags.Changed("config")) {
+		if _, err := os.Stat(configFile); errors.Is(err, os.ErrNotExist) {
+			return ""
+		}
+	}
+	return configFile
+}
+
+// load loads the top-level configuration and the tenants merged over it; the top-level
+// configuration is only validated when there are no tenants
+func load(configFile string, flags *pflag.FlagSet) (*Config, []Tenant, error) {
 	// Create a new koanf instance for this load operation
 	loader := koanf.New(".")
 
 	// Load defaults first (lowest priority)
-	_ = loader.Set("log-level", "INFO")
-	_ = loader.Set("cron.schedule", "0 0 * * *") // Standard 5-field format: minute hour day month weekday
-	_ = loader.Set("cron.timezone", "UTC")
-	_ = loader.Set("cloudflare.ips-url", "https://api.cloudflare.com/client/v4/ips")
+	for key, value := range defaultValues {
+		_ = loader.Set(key, value)
+	}
+	// These depend on the host, so they are not part of defaultValues and the schema
+	_ = loader.Set("lock.path", DefaultLockPath)
+	_ = loader.Set("public-ip.cache-path", DefaultPublicIPCachePath)
+
+	configFile = ResolveFile(configFile, flags)
 
 	// Load from YAML file (low priority)
 	if configFile != "" {
 		if err := loader.Load(file.Provider(configFile), yaml.Parser()); err != nil {
-			return nil, fmt.Errorf("failed to load config file %s: %w", configFile, err)
+			return nil, nil, fmt.Errorf("failed to load config file %s: %w", configFile, err)
 		}
 	}
 
 	// Load from environment variables (medium priority)
 	// Environment variables should be prefixed with FIREWALL_ALLOWLISTER_
 	// and use underscores instead of dashes (e.g., FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY -> digitalocean-api-key)
-	if err := loader.Load(env.Provider("FIREWALL_ALLOWLISTER_", ".", func(s string) string {
-		// Remove prefix and convert to lowercase
-		key := strings.ToLower(strings.TrimPrefix(s, "FIREWALL_ALLOWLISTER_"))
-
-		// Handle specific mappings for nested structures
-		switch key {
-		case "digitalocean_api_key":
-			return "digitalocean.api-key"
-		case "digitalocean_firewall_id":
-			return "digitalocean.firewall-id"
-		case "cloudflare_ips_url":
-			return "cloudflare.ips-url"
-		case "cron_schedule":
-			return "cron.schedule"
-		case "cron_timezone":
-			return "cron.timezone"
-		case "log_level":
-			return "log-level"
-		default:
-			// For other cases, replace first underscore with dot for section.key pattern
-			parts := strings.SplitN(key, "_", 2)
-			if len(parts) == 2 {
-				return parts[0] + "." + strings.ReplaceAll(parts[1], "_", "-")
-			}
-			return key
+	// List fields take JSON (inbound rules, dynamic DNS) or comma-separated values (domains, CIDRs)
+	var envErr error
+	if err := loader.Load(env.ProviderWithValue("FIREWALL_ALLOWLISTER_", ".", func(s string, value string) (string, interface{}) {
+		key := envKey(s)
+		parsed, err := envValue(key, value)
+		if err != nil && envErr == nil {
+			envErr = fmt.Errorf("invalid value for %s: %w", s, err)
 		}
+		return key, parsed
 	}), nil); err != nil {
-		return nil, fmt.Errorf("failed to load environment variables: %w", err)
+		return nil, nil, fmt.Errorf("failed to load environment variables: %w", err)
+	}
+	if envErr != nil {
+		return nil, nil, fmt.Errorf("failed to load environment variables: %w", envErr)
 	}
 
 	// Load from command line flags (highest priority)
 	if flags != nil {
-		// Manually load flags with proper key mapping
-		flags.VisitAll(func(f *pflag.Flag) {
-			if f.Changed {
-				key := f.Name
-				// Handle specific flag mappings
-				switch key {
-				case "log-level":
-					key = "log-level"
-				case "digitalocean.api-key":
-					key = "digitalocean.api-key"
-				case "digitalocean.firewall-id":
-					key = "digitalocean.firewall-id"
-				case "cloudflare.ips-url":
-					key = "cloudflare.ips-url"
-				case "cron.schedule":
-					key = "cron.schedule"
-				case "cron.timezone":
-					key = "cron.timezone"
-				default:
-					// Keep hyphens as-is for other flags
-					key = f.Name
-				}
+		if err := loadFlags(loader, flags); err != nil {
+			return nil, nil, fmt.Errorf("failed to load command line flags: %w", err)
+		}
+	}
 
-				_ = loader.Set(key, f.Value.String())
-			}
-		})
+	// Report every mistyped key and value of the file at once instead of ignoring them
+	if configFile != "" && loader.Bool("strict") {
+		if err := checkConfigFile(configFile); err != nil {
+			return nil, nil, err
+		}
 	}
 
+	// Accept protocol lists in inbound rules as shorthand for "tcp+udp"
+	normalizeProtocolLists(loader)
+
 	// Unmarshal into Config struct
 	var config Config
 	if err := loader.Unmarshal("", &config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		return nil, nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	// Each tenant is validated on its own, the top level only provides their shared settings
+	tenants, err := loadTenants(loader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config validation failed: %w", err)
+	}
+	if len(tenants) > 0 {
+		return &config, tenants, nil
+	}
+	if config.Tenant != "" {
+		return nil, nil, fmt.Errorf("unknown tenant %s: no tenants are configured", config.Tenant)
+	}
+
+	if err := applyPresets(&config); err != nil {
+		return nil, nil, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	// Read the API key from its file so every command authenticates with the current key
+	if err := readAPIKeyFile(&config); err != nil {
+		return nil, nil, err
 	}
 
 	// Validate configuration
 	if err := validate(&config); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+		return nil, nil, fmt.Errorf("config validation failed: %w", err)
 	}
 
-	return &config, nil
+	return &config, nil, nil
+}
+
+// readAPIKeyFile sets the API key from digitalocean.api-key-file when configured
+func readAPIKeyFile(config *Config) error {
+	path := config.DigitalOcean.APIKeyFile
+	if path == "" {
+		return nil
+	}
+	if config.DigitalOcean.APIKey != "" {
+		return fmt.Errorf("set only one of digitalocean.api-key and digitalocean.api-key-file")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read digitalocean.api-key-file: %w", err)
+	}
+	config.DigitalOcean.APIKey = strings.TrimSpace(string(data))
+	if config.DigitalOcean.APIKey == "" {
+		return fmt.Errorf("digitalocean.api-key-file %s is empty", path)
+	}
+	return nil
 }
 
 // validate performs basic validation on the configuration
@@ -164,6 +993,45 @@ func validate(config *Config) error {
 	if config.Cron.Schedule == "" {
 		return fmt.Errorf("cron.schedule is required")
 	}
+	if mode := config.Cron.Mode; mode != "" && mode != CronModeFixed && mode != CronModeAdaptive {
+		return fmt.Errorf("invalid cron.mode: %s (must be fixed or adaptive)", mode)
+	}
+	if config.Cron.Mode == CronModeAdaptive && config.Cron.MinInterval < time.Second {
+		return fmt.Errorf("cron.min-interval must be at least 1s in adaptive mode, got %s", config.Cron.MinInterval)
+	}
+	if config.Run.RetryBudget < 0 {
+		return fmt.Errorf("invalid run.retry-budget: %s (must not be negative)", config.Run.RetryBudget)
+	}
+	if config.Run.Deadline < 0 {
+		return fmt.Errorf("invalid run.deadline: %s (must not be negative)", config.Run.Deadline)
+	}
+	if config.Sources.Timeout < 0 {
+		return fmt.Errorf("invalid sources.timeout: %s (must not be negative)", config.Sources.Timeout)
+	}
+	if config.Sources.CacheTTL < 0 {
+		return fmt.Errorf("invalid sources.cache-ttl: %s (must not be negative)", config.Sources.CacheTTL)
+	}
+	if err := validateAddressFamily("sources", config.Sources.AddressFamily); err != nil {
+		return err
+	}
+	if config.Reconcile.Interval < 0 {
+		return fmt.Errorf("invalid reconcile.interval: %s (must not be negative)", config.Reconcile.Interval)
+	}
+	if config.Reconcile.Interval > 0 && config.Reconcile.Interval < time.Second {
+		return fmt.Errorf("reconcile.interval must be at least 1s, got %s", config.Reconcile.Interval)
+	}
+	if config.Health.Interval < 0 {
+		return fmt.Errorf("invalid health.interval: %s (must not be negative)", config.Health.Interval)
+	}
+	if config.Health.Interval > 0 && config.Health.Interval < time.Second {
+		return fmt.Errorf("health.interval must be at least 1s, got %s", config.Health.Interval)
+	}
+	if config.Reconcile.MinApplyInterval < 0 {
+		return fmt.Errorf("invalid reconcile.min-apply-interval: %s (must not be negative)", config.Reconcile.MinApplyInterval)
+	}
+	if config.State.Snapshots < 0 {
+		return fmt.Errorf("invalid state.snapshots: %d (must not be negative)", config.State.Snapshots)
+	}
 
 	// Validate log level
 	validLogLevels := map[string]bool{
@@ -177,28 +1045,974 @@ func validate(config *Config) error {
 		return fmt.Errorf("invalid log level: %s (must be DEBUG, INFO, WARN, ERROR, or FATAL)", config.LogLevel)
 	}
 
-	// Validate inbound rules
-	for i, rule := range config.DigitalOcean.InboundRules {
-		if rule.Port <= 0 || rule.Port > 65535 {
-			return fmt.Errorf("invalid port %d in inbound rule %d (must be 1-65535)", rule.Port, i)
+	// Validate log output
+	switch config.LogOutput {
+	case "", "stderr", "journald":
+	case "syslog":
+		switch config.Logging.Syslog.Network {
+		case "", "udp", "tcp", "unix", "unixgram":
+		default:
+			return fmt.Errorf("invalid logging.syslog.network: %s (must be udp, tcp, unix, or unixgram)", config.Logging.Syslog.Network)
+		}
+	default:
+		return fmt.Errorf("invalid log output: %s (must be stderr, syslog, or journald)", config.LogOutput)
+	}
+
+	// Validate log shipping
+	switch config.Logging.Ship.Format {
+	case "":
+	case "gelf", "logstash":
+		if config.Logging.Ship.Address == "" {
+			return fmt.Errorf("logging.ship.address is required when logging.ship.format is set")
 		}
-		if rule.Protocol != "tcp" && rule.Protocol != "udp" && rule.Protocol != "icmp" {
-			return fmt.Errorf("invalid protocol %s in inbound rule %d (must be tcp, udp, or icmp)", rule.Protocol, i)
+		if config.Logging.Ship.Network != "tcp" && config.Logging.Ship.Network != "udp" {
+			return fmt.Errorf("invalid logging.ship.network: %s (must be tcp or udp)", config.Logging.Ship.Network)
 		}
+		if config.Logging.Ship.BufferSize < 0 {
+			return fmt.Errorf("logging.ship.buffer-size must not be negative")
+		}
+	default:
+		return fmt.Errorf("invalid logging.ship.format: %s (must be gelf or logstash)", config.Logging.Ship.Format)
 	}
 
-	return nil
-}
+	// Validate logging overrides
+	for module, level := range config.Logging.Levels {
+		if !validLogLevels[strings.ToUpper(level)] {
+			return fmt.Errorf("invalid log level %s for module %s (must be DEBUG, INFO, WARN, ERROR, or FATAL)", level, module)
+		}
+	}
 
-// SetDefaults sets default values for configuration
-func SetDefaults() {
-	_ = k.Set("log-level", "INFO")
-	_ = k.Set("cron.schedule", "0 0 * * *") // Standard 5-field format: minute hour day month weekday
-	_ = k.Set("cron.timezone", "UTC")
-	_ = k.Set("cloudflare.ips-url", "https://api.cloudflare.com/client/v4/ips")
-}
+	if config.Logging.Sampling.Initial < 0 || config.Logging.Sampling.Thereafter < 0 {
+		return fmt.Errorf("logging.sampling.initial and logging.sampling.thereafter must not be negative")
+	}
 
-// GetKoanf returns the koanf instance for advanced usage
-func GetKoanf() *koanf.Koanf {
-	return k
+	if config.Logging.Sampling.Tick < 0 {
+		return fmt.Errorf("logging.sampling.tick must not be negative")
+	}
+
+	if err := validateInboundRules(config.DigitalOcean.InboundRules); err != nil {
+		return err
+	}
+
+	// Validate HTTP sources; names label addresses, so they must be unique
+	sourceNames := make(map[string]bool, len(builtinSources)+len(config.Sources.HTTP))
+	for name := range builtinSources {
+		sourceNames[name] = true
+	}
+	for i, source := range config.Sources.HTTP {
+		if !sourceNamePattern.MatchString(source.Name) {
+			return fmt.Errorf("invalid name %q in sources.http entry %d (lowercase letters, numbers, dashes and underscores only)", source.Name, i)
+		}
+		if sourceNames[source.Name] {
+			return fmt.Errorf("duplicate source name %s in sources.http", source.Name)
+		}
+		sourceNames[source.Name] = true
+
+		u, err := url.Parse(source.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid url %s of source %s: must be an http(s) URL", source.URL, source.Name)
+		}
+
+		switch source.Format {
+		case "json":
+			if len(source.Paths) == 0 {
+				return fmt.Errorf("source %s requires paths selecting the addresses of the json list", source.Name)
+			}
+			for _, path := range source.Paths {
+				if !jsonPathPattern.MatchString(path) {
+					return fmt.Errorf("invalid json path %s of source %s", path, source.Name)
+				}
+			}
+		case "lines":
+		case "csv":
+			if source.Column < 0 {
+				return fmt.Errorf("column of source %s must not be negative", source.Name)
+			}
+		default:
+			return fmt.Errorf("invalid format %s of source %s (must be json, lines, or csv)", source.Format, source.Name)
+		}
+
+		if err := validateOnFailure("source "+source.Name, source.OnFailure); err != nil {
+			return err
+		}
+		if err := validateAddressFamily("source "+source.Name, source.AddressFamily); err != nil {
+			return err
+		}
+	}
+
+	if err := validateNetworkSources(config.Sources.Networks, config.Safety.ReservedSources == "keep", sourceNames); err != nil {
+		return err
+	}
+
+	if err := validateGoogleSources(config.Sources.Google, sourceNames); err != nil {
+		return err
+	}
+
+	if err := validateProbeSources(config.Sources.Probes, sourceNames); err != nil {
+		return err
+	}
+
+	if err := validateDNSSources(config.Sources.DNS, sourceNames); err != nil {
+		return err
+	}
+
+	if err := validateTargetSources(config.DigitalOcean.FirewallID, config.DigitalOcean.Sources, sourceNames); err != nil {
+		return err
+	}
+	for _, target := range config.DigitalOcean.Targets() {
+		for _, rule := range target.InboundRules {
+			for _, source := range rule.Sources {
+				if !sourceNames[source] {
+					return fmt.Errorf("invalid source %s for port %d of firewall %s (must be a configured source name)", source, rule.Port, target.ID)
+				}
+			}
+		}
+	}
+
+	// Validate further firewalls; a firewall listed twice would get conflicting rules
+	firewalls := map[string]bool{config.DigitalOcean.FirewallID: true}
+	for i, target := range config.DigitalOcean.Firewalls {
+		if target.ID == "" {
+			return fmt.Errorf("digitalocean.firewalls entry %d requires an id", i)
+		}
+		if firewalls[target.ID] {
+			return fmt.Errorf("firewall %s is listed more than once in digitalocean.firewall-id and digitalocean.firewalls", target.ID)
+		}
+		firewalls[target.ID] = true
+
+		if err := validateInboundRules(target.InboundRules); err != nil {
+			return fmt.Errorf("firewall %s: %w", target.ID, err)
+		}
+		if err := validateTargetSources(target.ID, target.Sources, sourceNames); err != nil {
+			return err
+		}
+	}
+
+	if config.DigitalOcean.Workers < 0 {
+		return fmt.Errorf("invalid digitalocean.workers: %d (must not be negative)", config.DigitalOcean.Workers)
+	}
+	if err := validateDigitalOceanRetry(config.DigitalOcean.Retry); err != nil {
+		return err
+	}
+
+	// Validate dynamic DNS hostnames
+	for i, entry := range config.DigitalOcean.DynamicDNS {
+		if entry.Hostname == "" {
+			return fmt.Errorf("dynamic-dns entry %d requires a hostname", i)
+		}
+		if entry.Port <= 0 || entry.Port > 65535 {
+			return fmt.Errorf("invalid port %d in dynamic-dns entry %d (must be 1-65535)", entry.Port, i)
+		}
+	}
+
+	// Domain options only apply to configured domains
+	seenDomains := make(map[string]bool, len(config.Netdata.DomainOptions))
+	for i, option := range config.Netdata.DomainOptions {
+		if !slices.Contains(config.Netdata.Domains, option.Domain) {
+			return fmt.Errorf("netdata.domain-options entry %d: domain %q is not listed in netdata.domains", i, option.Domain)
+		}
+		if seenDomains[option.Domain] {
+			return fmt.Errorf("netdata.domain-options lists %s more than once", option.Domain)
+		}
+		seenDomains[option.Domain] = true
+	}
+	if err := validateResolver("netdata", config.Netdata.Resolver, config.Netdata.DoH, config.Netdata.Timeout); err != nil {
+		return err
+	}
+	if err := validateOnFailure("netdata", config.Netdata.OnFailure); err != nil {
+		return err
+	}
+	if err := validateOnFailure("cloudflare", config.Cloudflare.OnFailure); err != nil {
+		return err
+	}
+	if err := validateAddressFamily("netdata", config.Netdata.AddressFamily); err != nil {
+		return err
+	}
+	if err := validateAddressFamily("cloudflare", config.Cloudflare.AddressFamily); err != nil {
+		return err
+	}
+
+	if tag := config.DigitalOcean.FreezeTag; tag != "" && !validTagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid digitalocean.freeze-tag: %s (letters, numbers, colons, dashes and underscores only)", tag)
+	}
+
+	// Invite links and self-service are redeemed through the HTTP server lite mode turns off
+	if config.Lite && (config.Invites.SigningKey != "" || config.SelfService.Provider != "") {
+		return fmt.Errorf("invites and self-service need the HTTP server, which lite mode disables")
+	}
+	if config.Lite && config.Admin.Address != "" {
+		return fmt.Errorf("admin.address serves the admin API over HTTP, which lite mode disables")
+	}
+
+	if config.Server.Address != "" {
+		if _, _, err := net.SplitHostPort(config.Server.Address); err != nil {
+			return fmt.Errorf("invalid server.address %s: %w", config.Server.Address, err)
+		}
+	}
+
+	if config.Health.Address != "" {
+		if _, _, err := net.SplitHostPort(config.Health.Address); err != nil {
+			return fmt.Errorf("invalid health.address %s: %w", config.Health.Address, err)
+		}
+		if config.Health.Address == config.Server.Address {
+			return fmt.Errorf("health.address and server.address must differ, both are %s", config.Health.Address)
+		}
+	}
+
+	if config.Admin.Address != "" {
+		if _, _, err := net.SplitHostPort(config.Admin.Address); err != nil {
+			return fmt.Errorf("invalid admin.address %s: %w", config.Admin.Address, err)
+		}
+		if config.Admin.Address == config.Server.Address || config.Admin.Address == config.Health.Address {
+			return fmt.Errorf("admin.address must differ from server.address and health.address, all are %s", config.Admin.Address)
+		}
+		// The admin API changes the firewall, so it is never left open
+		if len(config.Admin.Token) < minServerAuthTokenLength {
+			return fmt.Errorf("admin.token must be at least %d characters when admin.address is set", minServerAuthTokenLength)
+		}
+	}
+
+	if config.Publish.Endpoint != "" {
+		u, err := url.Parse(config.Publish.Endpoint)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid publish.endpoint %s: must be an http(s) URL", config.Publish.Endpoint)
+		}
+		if config.Publish.Bucket == "" {
+			return fmt.Errorf("publish.bucket is required when publish.endpoint is set")
+		}
+		if config.Publish.AccessKey == "" || config.Publish.SecretKey == "" {
+			return fmt.Errorf("publish.access-key and publish.secret-key are required when publish.endpoint is set")
+		}
+	}
+
+	if config.Digest.WebhookURL != "" {
+		u, err := url.Parse(config.Digest.WebhookURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid digest.webhook-url: must be an http(s) URL")
+		}
+		if config.Digest.Schedule == "" {
+			return fmt.Errorf("digest.schedule is required when digest.webhook-url is set")
+		}
+		// The digest is built from the audit trail
+		if config.Audit.Path == "" {
+			return fmt.Errorf("audit.path is required when digest.webhook-url is set")
+		}
+	}
+
+	if config.Trends.MaxChangePercent < 0 {
+		return fmt.Errorf("invalid trends.max-change-percent: %d (must not be negative)", config.Trends.MaxChangePercent)
+	}
+	if config.Trends.WebhookURL != "" {
+		u, err := url.Parse(config.Trends.WebhookURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid trends.webhook-url: must be an http(s) URL")
+		}
+	}
+
+	if _, err := notify.ParseTemplate(config.Notify.Digest.Title, config.Notify.Digest.Body); err != nil {
+		return fmt.Errorf("invalid notify.digest: %w", err)
+	}
+	if _, err := notify.ParseTemplate(config.Notify.Trends.Title, config.Notify.Trends.Body); err != nil {
+		return fmt.Errorf("invalid notify.trends: %w", err)
+	}
+	if _, err := notify.ParseTemplate(config.Notify.Run.Title, config.Notify.Run.Body); err != nil {
+		return fmt.Errorf("invalid notify.run: %w", err)
+	}
+	for i, webhook := range config.Notify.Webhooks {
+		u, err := url.Parse(webhook.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid notify.webhooks[%d].url: must be an http(s) URL", i)
+		}
+		if webhook.Format != "" && !notifyWebhookFormats[webhook.Format] {
+			return fmt.Errorf("invalid notify.webhooks[%d].format: %s (must be generic, slack, discord or teams)", i, webhook.Format)
+		}
+		if err := validateNotifyFilter(fmt.Sprintf("notify.webhooks[%d]", i), webhook.MinSeverity, webhook.QuietHours); err != nil {
+			return err
+		}
+	}
+	if err := validateNotifyEmail(config.Notify.Email); err != nil {
+		return err
+	}
+
+	switch config.Safety.ReservedSources {
+	case "", "drop", "keep", "fail":
+	default:
+		return fmt.Errorf("invalid safety.reserved-sources: %s (must be drop, keep or fail)", config.Safety.ReservedSources)
+	}
+
+	if format := config.Signing.Format; format != "" {
+		if format != "minisign" && format != "cosign" {
+			return fmt.Errorf("invalid signing.format: %s (must be minisign or cosign)", format)
+		}
+		if config.Signing.KeyFile == "" {
+			return fmt.Errorf("signing.key-file is required when signing.format is set")
+		}
+	}
+
+	if err := validateAuditShip(config); err != nil {
+		return err
+	}
+
+	if ns := config.Metrics.Namespace; ns != "" && !metricNamePattern.MatchString(ns) {
+		return fmt.Errorf("invalid metrics.namespace: %s (letters, numbers, colons and underscores only)", ns)
+	}
+	for name := range config.Metrics.Labels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid metrics.labels name: %s (letters, numbers and underscores only)", name)
+		}
+		if reservedMetricLabels[name] {
+			return fmt.Errorf("invalid metrics.labels name: %s is set by the exported metrics", name)
+		}
+	}
+
+	for _, token := range config.Server.AuthTokens {
+		if len(token) < minServerAuthTokenLength {
+			return fmt.Errorf("server.auth-tokens must be at least %d characters", minServerAuthTokenLength)
+		}
+	}
+	if config.Server.RateLimit < 0 {
+		return fmt.Errorf("server.rate-limit must not be negative")
+	}
+
+	if config.Server.PublicURL != "" {
+		u, err := url.Parse(config.Server.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid server.public-url: must be an http(s) URL")
+		}
+	}
+
+	if config.Invites.SigningKey != "" {
+		if len(config.Invites.SigningKey) < minInviteSigningKeyLength {
+			return fmt.Errorf("invites.signing-key must be at least %d characters", minInviteSigningKeyLength)
+		}
+		if config.Invites.Port <= 0 || config.Invites.Port > 65535 {
+			return fmt.Errorf("invalid invites.port %d (must be 1-65535)", config.Invites.Port)
+		}
+		if config.Invites.TTL <= 0 || config.Invites.ValidFor <= 0 {
+			return fmt.Errorf("invites.ttl and invites.valid-for must be positive")
+		}
+		// The scheduled update would replace the invitees' addresses with the shared sources
+		if hasInboundRule(config.DigitalOcean.InboundRules, config.Invites.Port) {
+			return fmt.Errorf("invites.port %d must not be managed by digitalocean.inbound-rules", config.Invites.Port)
+		}
+	}
+
+	if err := validateSelfService(config); err != nil {
+		return err
+	}
+
+	if config.Lock.Timeout < 0 {
+		return fmt.Errorf("lock.timeout must not be negative")
+	}
+
+	if config.PublicIP.CacheTTL < 0 || config.PublicIP.MinInterval < 0 {
+		return fmt.Errorf("public-ip.cache-ttl and public-ip.min-interval must not be negative")
+	}
+
+	for _, port := range config.Safety.AdminPorts {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d in safety.admin-ports (must be 1-65535)", port)
+		}
+	}
+
+	for _, cidr := range config.Safety.AdminCIDRs {
+		if net.ParseIP(cidr) == nil {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("invalid IP address or CIDR block %s in safety.admin-cidrs", cidr)
+			}
+		}
+	}
+
+	if config.Confirmation.MaxRemovedAddresses < 0 {
+		return fmt.Errorf("confirmation.max-removed-addresses must not be negative")
+	}
+
+	return nil
+}
+
+// validateSelfService checks the self-service endpoint settings when a provider is configured
+func validateSelfService(config *Config) error {
+	selfService := config.SelfService
+	if selfService.Provider == "" {
+		return nil
+	}
+
+	if !selfServiceProviders[selfService.Provider] {
+		return fmt.Errorf("invalid self-service.provider: %s (must be google, github or oidc)", selfService.Provider)
+	}
+	if selfService.ClientID == "" || selfService.ClientSecret == "" {
+		return fmt.Errorf("self-service.client-id and self-service.client-secret are required")
+	}
+	if selfService.Provider == "oidc" &&
+		(selfService.AuthURL == "" || selfService.TokenURL == "" || selfService.UserInfoURL == "") {
+		return fmt.Errorf("self-service.auth-url, token-url and userinfo-url are required for the oidc provider")
+	}
+	if len(selfService.SessionKey) < minInviteSigningKeyLength {
+		return fmt.Errorf("self-service.session-key must be at least %d characters", minInviteSigningKeyLength)
+	}
+	// The provider redirects users back to the server's public URL
+	if config.Server.Address == "" || config.Server.PublicURL == "" {
+		return fmt.Errorf("server.address and server.public-url are required for self-service")
+	}
+
+	if len(selfService.Policies) == 0 {
+		return fmt.Errorf("self-service.policies must grant at least one user access")
+	}
+	for i, policy := range selfService.Policies {
+		if len(policy.Users) == 0 || len(policy.Ports) == 0 {
+			return fmt.Errorf("self-service policy %d must list users and ports", i)
+		}
+		if policy.MaxTTL <= 0 {
+			return fmt.Errorf("self-service policy %d must have a positive max-ttl", i)
+		}
+		for _, port := range policy.Ports {
+			if port <= 0 || port > 65535 {
+				return fmt.Errorf("invalid port %d in self-service policy %d (must be 1-65535)", port, i)
+			}
+			if hasInboundRule(config.DigitalOcean.InboundRules, port) {
+				return fmt.Errorf("port %d in self-service policy %d must not be managed by digitalocean.inbound-rules", port, i)
+			}
+		}
+	}
+	return nil
+}
+
+// envKeys maps environment variable names, without prefix and lowercased, to configuration keys
+var envKeys = buildEnvKeys()
+
+// buildEnvKeys derives the environment variable name of every configuration key by replacing
+// dots and dashes with underscores (e.g. logging.sampling.initial -> logging_sampling_initial)
+func buildEnvKeys() map[string]string {
+	replacer := strings.NewReplacer(".", "_", "-", "_")
+	keys := make(map[string]string)
+	walkConfig(reflect.TypeOf(Config{}), "", func(path string, _ reflect.Type) {
+		keys[replacer.Replace(path)] = path
+	})
+	return keys
+}
+
+// envKey maps an environment variable name to its configuration key
+func envKey(s string) string {
+	// Remove prefix and convert to lowercase
+	key := strings.ToLower(strings.TrimPrefix(s, "FIREWALL_ALLOWLISTER_"))
+	if path, ok := envKeys[key]; ok {
+		return path
+	}
+
+	// For unknown keys, replace first underscore with dot for section.key pattern
+	parts := strings.SplitN(key, "_", 2)
+	if len(parts) == 2 {
+		return parts[0] + "." + strings.ReplaceAll(parts[1], "_", "-")
+	}
+	return key
+}
+
+// validateInboundRules checks the ports, protocols and access windows of inbound rules
+func validateInboundRules(rules []InboundRule) error {
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("%w in inbound rule %d", err, i)
+		}
+	}
+	return nil
+}
+
+// Validate checks the port, protocols, access window and droplet sources of the rule
+func (r InboundRule) Validate() error {
+	if r.Port <= 0 || r.Port > 65535 {
+		return fmt.Errorf("invalid port %d (must be 1-65535)", r.Port)
+	}
+	seen := make(map[string]bool)
+	for _, protocol := range r.Protocols() {
+		if protocol != "tcp" && protocol != "udp" && protocol != "icmp" {
+			return fmt.Errorf("invalid protocol %s (must be tcp, udp, or icmp)", r.Protocol)
+		}
+		if seen[protocol] {
+			return fmt.Errorf("duplicate protocol %s", protocol)
+		}
+		seen[protocol] = true
+	}
+	if r.Window.Enabled() && (r.Window.Open == "" || r.Window.Close == "") {
+		return fmt.Errorf("window requires both open and close schedules")
+	}
+	for _, tag := range r.SourceTags {
+		if !validTagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid source tag %s (letters, numbers, colons, dashes and underscores only)", tag)
+		}
+	}
+	for _, id := range r.SourceDropletIDs {
+		if id <= 0 {
+			return fmt.Errorf("invalid source droplet ID %d (must be positive)", id)
+		}
+	}
+	return nil
+}
+
+// validateNetworkSources checks the named networks and adds their names to sourceNames; every
+// block must be an address or CIDR given by its first address, since a typo there opens the
+// firewall to the wrong network, and public unless reserved sources are kept
+func validateNetworkSources(networks []NetworkSource, keepReserved bool, sourceNames map[string]bool) error {
+	for i, network := range networks {
+		if !sourceNamePattern.MatchString(network.Name) {
+			return fmt.Errorf("invalid name %q in sources.networks entry %d (lowercase letters, numbers, dashes and underscores only)", network.Name, i)
+		}
+		if sourceNames[network.Name] {
+			return fmt.Errorf("duplicate source name %s in sources.networks", network.Name)
+		}
+		sourceNames[network.Name] = true
+
+		if len(network.CIDRs) == 0 {
+			return fmt.Errorf("network %s requires at least one CIDR block", network.Name)
+		}
+		for _, cidr := range network.CIDRs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(cidr)
+				if addrErr != nil {
+					return fmt.Errorf("network %s: %s is not an IP address or CIDR block", network.Name, cidr)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			if masked := prefix.Masked(); masked != prefix {
+				return fmt.Errorf("network %s: %s has host bits set, did you mean %s?", network.Name, cidr, masked)
+			}
+			if category := sources.Reserved(cidr); category != "" && !keepReserved {
+				return fmt.Errorf("network %s: %s is a %s range, which can never reach the firewall", network.Name, cidr, category)
+			}
+		}
+		if err := validateAddressFamily("network "+network.Name, network.AddressFamily); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateGoogleSources checks the Google range lists and adds their names to sourceNames
+func validateGoogleSources(lists []GoogleSource, sourceNames map[string]bool) error {
+	for i, list := range lists {
+		if !sourceNamePattern.MatchString(list.Name) {
+			return fmt.Errorf("invalid name %q in sources.google entry %d (lowercase letters, numbers, dashes and underscores only)", list.Name, i)
+		}
+		if sourceNames[list.Name] {
+			return fmt.Errorf("duplicate source name %s in sources.google", list.Name)
+		}
+		sourceNames[list.Name] = true
+
+		switch list.List {
+		case "cloud":
+		case "goog":
+			// Only cloud.json tells the scope of its prefixes
+			if len(list.Scopes) > 0 {
+				return fmt.Errorf("source %s: scopes only apply to the cloud list", list.Name)
+			}
+		default:
+			return fmt.Errorf("invalid list %s of source %s (must be goog or cloud)", list.List, list.Name)
+		}
+
+		if list.URL != "" {
+			u, err := url.Parse(list.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("invalid url %s of source %s: must be an http(s) URL", list.URL, list.Name)
+			}
+		}
+		for _, scope := range list.Scopes {
+			if _, err := path.Match(scope, ""); err != nil || scope == "" {
+				return fmt.Errorf("invalid scope %q of source %s", scope, list.Name)
+			}
+		}
+		if err := validateOnFailure("source "+list.Name, list.OnFailure); err != nil {
+			return err
+		}
+		if err := validateAddressFamily("source "+list.Name, list.AddressFamily); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateProbeSources checks the probe lists and adds their names to sourceNames
+func validateProbeSources(lists []ProbeSource, sourceNames map[string]bool) error {
+	for i, list := range lists {
+		switch list.Provider {
+		case "uptimerobot":
+		case "pingdom":
+			if list.Token == "" {
+				return fmt.Errorf("sources.probes entry %d: pingdom requires a token", i)
+			}
+		default:
+			return fmt.Errorf("invalid provider %q in sources.probes entry %d (must be uptimerobot or pingdom)", list.Provider, i)
+		}
+
+		name := list.SourceName()
+		if !sourceNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid name %q in sources.probes entry %d (lowercase letters, numbers, dashes and underscores only)", name, i)
+		}
+		if sourceNames[name] {
+			return fmt.Errorf("duplicate source name %s in sources.probes", name)
+		}
+		sourceNames[name] = true
+
+		if list.URL != "" {
+			u, err := url.Parse(list.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("invalid url %s of source %s: must be an http(s) URL", list.URL, name)
+			}
+		}
+		if err := validateOnFailure("source "+name, list.OnFailure); err != nil {
+			return err
+		}
+		if err := validateAddressFamily("source "+name, list.AddressFamily); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDNSSources checks the DNS sources and adds their names to sourceNames; netdata is taken
+// by netdata.domains
+func validateDNSSources(lists []DNSSource, sourceNames map[string]bool) error {
+	for i, list := range lists {
+		if !sourceNamePattern.MatchString(list.Name) {
+			return fmt.Errorf("invalid name %q in sources.dns entry %d (lowercase letters, numbers, dashes and underscores only)", list.Name, i)
+		}
+		if sourceNames[list.Name] {
+			return fmt.Errorf("duplicate source name %s in sources.dns", list.Name)
+		}
+		sourceNames[list.Name] = true
+
+		if len(list.Domains) == 0 {
+			return fmt.Errorf("source %s requires at least one domain", list.Name)
+		}
+		for _, recordType := range list.RecordTypes {
+			if recordType != "A" && recordType != "AAAA" {
+				return fmt.Errorf("invalid record type %s of source %s (must be A or AAAA)", recordType, list.Name)
+			}
+		}
+
+		if err := validateResolver("source "+list.Name, list.Resolver, list.DoH, list.Timeout); err != nil {
+			return err
+		}
+		if err := validateOnFailure("source "+list.Name, list.OnFailure); err != nil {
+			return err
+		}
+		if err := validateAddressFamily("source "+list.Name, list.AddressFamily); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNotifyEmail checks the SMTP settings of email notifications when a host is set
+func validateNotifyEmail(email NotifyEmail) error {
+	if email.Host == "" {
+		return nil
+	}
+	switch email.TLS {
+	case "", "starttls", "tls", "none":
+	default:
+		return fmt.Errorf("invalid notify.email.tls: %s (must be starttls, tls or none)", email.TLS)
+	}
+	if email.Port < 0 || email.Port > 65535 {
+		return fmt.Errorf("invalid notify.email.port: %d", email.Port)
+	}
+	if _, err := mail.ParseAddress(email.From); err != nil {
+		return fmt.Errorf("invalid notify.email.from: %q is not an email address", email.From)
+	}
+	if len(email.To) == 0 {
+		return fmt.Errorf("notify.email.to is required when notify.email.host is set")
+	}
+	for _, to := range email.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid notify.email.to: %q is not an email address", to)
+		}
+	}
+	if email.Password != "" && email.Username == "" {
+		return fmt.Errorf("notify.email.username is required when notify.email.password is set")
+	}
+	return validateNotifyFilter("notify.email", email.MinSeverity, email.QuietHours)
+}
+
+// validateNotifyFilter checks the severity thresholds and quiet hours of a notification channel;
+// the cron expressions are checked by the validate command like access windows
+func validateNotifyFilter(owner, minSeverity string, quiet NotifyQuietHours) error {
+	switch minSeverity {
+	case "", "change", "failure":
+	default:
+		return fmt.Errorf("invalid %s.min-severity: %s (must be change or failure)", owner, minSeverity)
+	}
+	if !quiet.Enabled() {
+		return nil
+	}
+	if quiet.Open == "" || quiet.Close == "" {
+		return fmt.Errorf("%s.quiet-hours requires both open and close schedules", owner)
+	}
+	switch quiet.MinSeverity {
+	case "", "failure", "none":
+	default:
+		return fmt.Errorf("invalid %s.quiet-hours.min-severity: %s (must be failure or none)", owner, quiet.MinSeverity)
+	}
+	return nil
+}
+
+// validateResolver checks the custom resolver of owner: a DNS server address or a DoH endpoint,
+// not both, and a lookup timeout that is not negative
+func validateResolver(owner, resolver, doh string, timeout time.Duration) error {
+	if resolver != "" && doh != "" {
+		return fmt.Errorf("%s sets both a resolver and a DoH endpoint, choose one", owner)
+	}
+	if resolver != "" {
+		host, port, err := net.SplitHostPort(resolver)
+		if err != nil {
+			host, port = resolver, "53"
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid resolver %s of %s: must be an IP address, optionally with a port", resolver, owner)
+		}
+		if value, err := strconv.Atoi(port); err != nil || value <= 0 || value > 65535 {
+			return fmt.Errorf("invalid resolver port %s of %s (must be 1-65535)", port, owner)
+		}
+	}
+	if doh != "" {
+		parsed, err := url.Parse(doh)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("invalid DoH endpoint %s of %s: must be an https URL", doh, owner)
+		}
+	}
+	if timeout < 0 {
+		return fmt.Errorf("invalid timeout %s of %s (must not be negative)", timeout, owner)
+	}
+	return nil
+}
+
+// validateOnFailure checks the on-failure policy of a source; an empty policy aborts
+func validateOnFailure(owner, policy string) error {
+	switch policy {
+	case "", OnFailureAbort, OnFailureSkip, OnFailureUseCached:
+		return nil
+	}
+	return fmt.Errorf("invalid on-failure %s of %s (must be abort, skip or use-cached)", policy, owner)
+}
+
+// validateAddressFamily checks the address family of a source; an empty family takes
+// sources.address-family
+func validateAddressFamily(owner, family string) error {
+	switch family {
+	case "", sources.FamilyIPv4, sources.FamilyIPv6, sources.FamilyBoth:
+		return nil
+	}
+	return fmt.Errorf("invalid address-family %s of %s (must be ipv4, ipv6 or both)", family, owner)
+}
+
+// validateTargetSources checks that a firewall only selects configured sources
+func validateTargetSources(firewallID string, sources []string, sourceNames map[string]bool) error {
+	for _, source := range sources {
+		if !sourceNames[source] {
+			return fmt.Errorf("invalid source %s for firewall %s (must be cloudflare, netdata, or a sources.http, sources.networks, sources.google, sources.probes or sources.dns name)", source, firewallID)
+		}
+	}
+	return nil
+}
+
+// envJSONKeys are the list-of-object fields configured from environment variables as JSON
+var envJSONKeys = map[string]bool{
+	"digitalocean.inbound-rules": true,
+	"digitalocean.dynamic-dns":   true,
+	"digitalocean.firewalls":     true,
+	"sources.http":               true,
+	"self-service.policies":      true,
+	"netdata.domain-options":     true,
+	"sources.networks":           true,
+	"sources.google":             true,
+	"sources.probes":             true,
+	"sources.dns":                true,
+}
+
+// envListKeys are the list fields configured from environment variables as comma-separated values
+var envListKeys = map[string]bool{
+	"presets":              true,
+	"netdata.domains":      true,
+	"digitalocean.sources": true,
+	"safety.admin-ports":   true,
+	"safety.admin-cidrs":   true,
+	"server.auth-tokens":   true,
+}
+
+// envValue parses the value of an environment variable for the configuration key
+func envValue(key, value string) (interface{}, error) {
+	switch {
+	case envJSONKeys[key]:
+		var list []interface{}
+		if err := json.Unmarshal([]byte(value), &list); err != nil {
+			return value, fmt.Errorf("expected a JSON list: %w", err)
+		}
+		return list, nil
+	case envListKeys[key]:
+		var list []interface{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
+// normalizeProtocolLists rewrites inbound rule protocol lists such as [tcp, udp] to "tcp+udp",
+// both in the top-level rules and in the rules of further firewalls
+func normalizeProtocolLists(loader *koanf.Koanf) {
+	if rules, ok := loader.Get("digitalocean.inbound-rules").([]interface{}); ok && normalizeRuleProtocols(rules) {
+		_ = loader.Set("digitalocean.inbound-rules", rules)
+	}
+
+	targets, ok := loader.Get("digitalocean.firewalls").([]interface{})
+	if !ok {
+		return
+	}
+	changed := false
+	for _, target := range targets {
+		fields, ok := target.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if rules, ok := fields["inbound-rules"].([]interface{}); ok && normalizeRuleProtocols(rules) {
+			changed = true
+		}
+	}
+	if changed {
+		_ = loader.Set("digitalocean.firewalls", targets)
+	}
+}
+
+// normalizeRuleProtocols joins the protocol lists of rules in place, reporting whether any changed
+func normalizeRuleProtocols(rules []interface{}) bool {
+	changed := false
+	for _, rule := range rules {
+		fields, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		list, ok := fields["protocol"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		protocols := make([]string, 0, len(list))
+		for _, protocol := range list {
+			protocols = append(protocols, fmt.Sprint(protocol))
+		}
+		fields["protocol"] = strings.Join(protocols, "+")
+		changed = true
+	}
+	return changed
+}
+
+// SetDefaults sets default values for configuration
+func SetDefaults() {
+	_ = k.Set("log-level", "INFO")
+	_ = k.Set("log-output", "stderr")
+	_ = k.Set("logging.tag", "do-firewall-allowlister")
+	_ = k.Set("logging.syslog.network", "udp")
+	_ = k.Set("logging.syslog.facility", "daemon")
+	_ = k.Set("logging.ship.network", "tcp")
+	_ = k.Set("logging.ship.buffer-size", 1000)
+	_ = k.Set("logging.sampling.initial", 100)
+	_ = k.Set("logging.sampling.thereafter", 100)
+	_ = k.Set("logging.sampling.tick", "1s")
+	_ = k.Set("cron.schedule", "0 0 * * *") // Standard 5-field format: minute hour day month weekday
+	_ = k.Set("cron.timezone", "UTC")
+	_ = k.Set("cron.catch-up", false)
+	_ = k.Set("cron.mode", CronModeFixed)
+	_ = k.Set("cron.min-interval", "1m")
+	_ = k.Set("reconcile.interval", "0s")
+	_ = k.Set("health.interval", "0s")
+	_ = k.Set("reconcile.min-apply-interval", "1m")
+	_ = k.Set("digitalocean.freeze-tag", DefaultFreezeTag)
+	_ = k.Set("digitalocean.workers", 4)
+	_ = k.Set("digitalocean.retry.retries", 3)
+	_ = k.Set("digitalocean.retry.min-backoff", "1s")
+	_ = k.Set("digitalocean.retry.max-backoff", "30s")
+	_ = k.Set("netdata.timeout", "10s")
+	_ = k.Set("cloudflare.ips-url", "https://api.cloudflare.com/client/v4/ips")
+	_ = k.Set("cloudflare.on-failure", OnFailureAbort)
+	_ = k.Set("netdata.on-failure", OnFailureAbort)
+	_ = k.Set("state.path", "state.json")
+	_ = k.Set("state.snapshots", 10)
+	_ = k.Set("sources.timeout", "2m")
+	_ = k.Set("sources.cache-ttl", "0s")
+	_ = k.Set("sources.address-family", sources.FamilyBoth)
+	_ = k.Set("server.rate-limit", 60)
+	_ = k.Set("safety.reserved-sources", "drop")
+	_ = k.Set("safety.bogon-filter", true)
+	_ = k.Set("publish.region", "us-east-1")
+	_ = k.Set("publish.prefix", "allowlist")
+	_ = k.Set("digest.schedule", "@daily")
+	_ = k.Set("trends.max-change-percent", 50)
+	_ = k.Set("audit.ship.batch-size", 100)
+	_ = k.Set("audit.ship.retries", 3)
+	_ = k.Set("audit.ship.interval", "1m")
+	_ = k.Set("metrics.namespace", DefaultMetricsNamespace)
+	_ = k.Set("metrics.source-labels", true)
+	_ = k.Set("invites.port", 22)
+	_ = k.Set("invites.ttl", "8h")
+	_ = k.Set("invites.valid-for", "24h")
+	_ = k.Set("lock.path", DefaultLockPath)
+	_ = k.Set("lock.timeout", "30s")
+	_ = k.Set("confirmation.max-removed-addresses", 10)
+	_ = k.Set("public-ip.cache-path", DefaultPublicIPCachePath)
+	_ = k.Set("public-ip.cache-ttl", "1m")
+	_ = k.Set("public-ip.min-interval", "5s")
+}
+
+// GetKoanf returns the koanf instance for advanced usage
+func GetKoanf() *koanf.Koanf {
+	return k
+}
+
+// validateDigitalOceanRetry checks the backoff of API requests; zero backoffs fall back to the
+// client's defaults
+func validateDigitalOceanRetry(retry DigitalOceanRetryConfig) error {
+	if retry.Retries < 0 {
+		return fmt.Errorf("digitalocean.retry.retries must not be negative")
+	}
+	if retry.MinBackoff < 0 || retry.MaxBackoff < 0 {
+		return fmt.Errorf("digitalocean.retry.min-backoff and max-backoff must not be negative")
+	}
+	if retry.MaxBackoff > 0 && retry.MinBackoff > retry.MaxBackoff {
+		return fmt.Errorf("digitalocean.retry.min-backoff %s must not exceed max-backoff %s", retry.MinBackoff, retry.MaxBackoff)
+	}
+	return nil
+}
+
+// validateAuditShip checks the audit shipping settings when a collector type is set
+func validateAuditShip(config *Config) error {
+	ship := config.Audit.Ship
+	if ship.Type == "" {
+		return nil
+	}
+
+	if !auditShipTypes[ship.Type] {
+		return fmt.Errorf("invalid audit.ship.type: %s (must be splunk, elastic or https)", ship.Type)
+	}
+	if u, err := url.Parse(ship.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid audit.ship.url: must be an http(s) URL")
+	}
+	// Records are shipped from the audit log
+	if config.Audit.Path == "" {
+		return fmt.Errorf("audit.path is required when audit.ship.type is set")
+	}
+	if ship.Type == "elastic" && ship.Index == "" {
+		return fmt.Errorf("audit.ship.index is required when shipping to elastic")
+	}
+	if ship.BatchSize < 1 {
+		return fmt.Errorf("audit.ship.batch-size must be at least 1")
+	}
+	if ship.Retries < 0 {
+		return fmt.Errorf("audit.ship.retries must not be negative")
+	}
+	if ship.Interval <= 0 {
+		return fmt.Errorf("audit.ship.interval must be positive")
+	}
+	return nil
 }
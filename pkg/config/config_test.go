@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/knadh/koanf/v2"
 	"github.com/spf13/pflag"
@@ -61,6 +63,51 @@ func TestLoad(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name:       "environment variable lists",
+			configFile: "testdata/valid_config.yaml",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_DIGITALOCEAN_INBOUND_RULES": `[{"port":443,"protocol":"tcp"},{"port":53,"protocol":["tcp","udp"]}]`,
+				"FIREWALL_ALLOWLISTER_NETDATA_DOMAINS":            "app.netdata.cloud, api.netdata.cloud",
+				"FIREWALL_ALLOWLISTER_NETDATA_DOMAIN_OPTIONS":     `[{"domain":"api.netdata.cloud","required":true}]`,
+			},
+			validate: func(cfg *Config) error {
+				rules := cfg.DigitalOcean.InboundRules
+				if len(rules) != 2 || rules[0].Port != 443 || rules[1].Protocol != "tcp+udp" {
+					t.Errorf("expected inbound rules from env, got %+v", rules)
+				}
+				domains := cfg.Netdata.Domains
+				if len(domains) != 2 || domains[0] != "app.netdata.cloud" || domains[1] != "api.netdata.cloud" {
+					t.Errorf("expected domains from env, got %v", domains)
+				}
+				if required, ok := cfg.Netdata.Required()["api.netdata.cloud"]; !ok || !required {
+					t.Errorf("expected api.netdata.cloud to be required from env, got %+v", cfg.Netdata.DomainOptions)
+				}
+				return nil
+			},
+		},
+		{
+			name:       "http sources from environment variable",
+			configFile: "testdata/valid_config.yaml",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_SOURCES_HTTP": `[{"name":"fastly","url":"https://api.fastly.com/public-ip-list","format":"json","paths":["addresses","ipv6_addresses"]}]`,
+			},
+			validate: func(cfg *Config) error {
+				sources := cfg.Sources.HTTP
+				if len(sources) != 1 || sources[0].Name != "fastly" || len(sources[0].Paths) != 2 {
+					t.Errorf("expected http sources from env, got %+v", sources)
+				}
+				return nil
+			},
+		},
+		{
+			name:       "invalid environment variable list",
+			configFile: "testdata/valid_config.yaml",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_DIGITALOCEAN_INBOUND_RULES": "443/tcp",
+			},
+			expectError: true,
+		},
 		{
 			name:       "flag override",
 			configFile: "", // No config file, only flags
@@ -84,6 +131,60 @@ func TestLoad(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name:       "protocol shorthand and list",
+			configFile: "testdata/protocols_config.yaml",
+			validate: func(cfg *Config) error {
+				for _, rule := range cfg.DigitalOcean.InboundRules {
+					protocols := rule.Protocols()
+					if len(protocols) != 2 || protocols[0] != "tcp" || protocols[1] != "udp" {
+						t.Errorf("expected port %d to expand to tcp and udp, got %v", rule.Port, protocols)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:       "further firewalls",
+			configFile: "testdata/firewalls_config.yaml",
+			validate: func(cfg *Config) error {
+				targets := cfg.DigitalOcean.Targets()
+				if len(targets) != 3 || targets[0].ID != "web-firewall" || targets[0].InboundRules[0].Port != 443 {
+					t.Fatalf("expected firewall-id followed by two firewalls, got %+v", targets)
+				}
+				if len(targets[0].Sources) != 1 || targets[0].Sources[0] != "cloudflare" {
+					t.Errorf("expected firewall-id to allow the Cloudflare ranges only, got %v", targets[0].Sources)
+				}
+				monitoring := targets[1]
+				if monitoring.ID != "monitoring-firewall" || len(monitoring.Sources) != 1 || monitoring.Sources[0] != "netdata" {
+					t.Errorf("unexpected monitoring firewall %+v", monitoring)
+				}
+				if protocols := monitoring.InboundRules[0].Protocols(); len(protocols) != 2 || protocols[1] != "udp" {
+					t.Errorf("expected the protocol list of a further firewall to expand, got %v", protocols)
+				}
+				if len(targets[2].Sources) != 0 {
+					t.Errorf("expected the edge firewall to allow every source, got %v", targets[2].Sources)
+				}
+				if ssh := targets[2].InboundRules[1]; len(ssh.SourceTags) != 1 || ssh.SourceTags[0] != "bastion" ||
+					len(ssh.SourceDropletIDs) != 1 || ssh.SourceDropletIDs[0] != 42 {
+					t.Errorf("expected the edge SSH rule to allow the bastion tag and droplet 42, got %+v", ssh)
+				}
+				return nil
+			},
+		},
+		{
+			name:       "read-only flag",
+			configFile: "testdata/valid_config.yaml",
+			flags: map[string]string{
+				"read-only": "true",
+			},
+			validate: func(cfg *Config) error {
+				if !cfg.ReadOnly {
+					t.Errorf("expected ReadOnly true from flag")
+				}
+				return nil
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -217,6 +318,48 @@ func TestValidate(t *testing.T) {
 			expectError: true,
 			errorMsg:    "invalid port",
 		},
+		{
+			name: "invalid source tag",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					InboundRules: []InboundRule{
+						{Port: 22, Protocol: "tcp", SourceTags: []string{"bastion hosts"}},
+					},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid source tag",
+		},
+		{
+			name: "invalid source droplet ID",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					InboundRules: []InboundRule{
+						{Port: 22, Protocol: "tcp", SourceDropletIDs: []int{0}},
+					},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid source droplet ID",
+		},
 		{
 			name: "invalid protocol",
 			config: &Config{
@@ -238,60 +381,1820 @@ func TestValidate(t *testing.T) {
 			expectError: true,
 			errorMsg:    "invalid protocol",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := validate(tt.config)
-
-			if tt.expectError {
-				if err == nil {
-					t.Errorf("expected error but got none")
-					return
-				}
-				if tt.errorMsg != "" && !contains(err.Error(), tt.errorMsg) {
-					t.Errorf("expected error to contain '%s', got '%s'", tt.errorMsg, err.Error())
-				}
-			} else if err != nil {
-				t.Errorf("unexpected error: %v", err)
-			}
-		})
-	}
-}
-
-func TestSetDefaults(t *testing.T) {
-	// Reset koanf instance
-	k = koanf.New(".")
-
-	SetDefaults()
-
-	if k.String("log-level") != "INFO" {
-		t.Errorf("expected default log-level INFO, got %s", k.String("log-level"))
-	}
-
-	if k.String("cron.schedule") != "0 0 * * *" {
-		t.Errorf("expected default cron schedule '0 0 * * *', got %s", k.String("cron.schedule"))
-	}
-
-	if k.String("cron.timezone") != "UTC" {
-		t.Errorf("expected default timezone UTC, got %s", k.String("cron.timezone"))
-	}
-
-	if k.String("cloudflare.ips-url") != "https://api.cloudflare.com/client/v4/ips" {
-		t.Errorf("expected default Cloudflare URL, got %s", k.String("cloudflare.ips-url"))
-	}
-}
-
-// Helper function to check if a string contains a substring
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
-		(len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
-			func() bool {
-				for i := 0; i <= len(s)-len(substr); i++ {
-					if s[i:i+len(substr)] == substr {
-						return true
-					}
-				}
-				return false
-			}())))
+		{
+			name: "incomplete access window",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					InboundRules: []InboundRule{
+						{Port: 22, Protocol: "tcp", Window: AccessWindow{Open: "0 8 * * 1-5"}},
+					},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "requires both open and close",
+		},
+		{
+			name: "invalid module log level",
+			config: &Config{
+				LogLevel: "INFO",
+				Logging: LoggingConfig{
+					Levels: map[string]string{"scheduler": "LOUD"},
+				},
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "for module scheduler",
+		},
+		{
+			name: "invalid log output",
+			config: &Config{
+				LogLevel:  "INFO",
+				LogOutput: "kafka",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid log output",
+		},
+		{
+			name: "duplicate protocol",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 53, Protocol: "udp+udp"}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "duplicate protocol",
+		},
+		{
+			name: "dynamic dns without hostname",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					DynamicDNS: []DynamicDNS{{Port: 22}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "requires a hostname",
+		},
+		{
+			name: "invalid metrics namespace",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Metrics: MetricsConfig{Namespace: "firewall-allowlister"},
+			},
+			expectError: true,
+			errorMsg:    "invalid metrics.namespace",
+		},
+		{
+			name: "reserved metrics label",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Metrics: MetricsConfig{Labels: map[string]string{"env": "prod", "source": "x"}},
+			},
+			expectError: true,
+			errorMsg:    "set by the exported metrics",
+		},
+		{
+			name: "short invite signing key",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Invites: InvitesConfig{SigningKey: "too-short", Port: 22, TTL: time.Hour, ValidFor: time.Hour},
+			},
+			expectError: true,
+			errorMsg:    "invites.signing-key must be at least 32 characters",
+		},
+		{
+			name: "invalid server public URL",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Server: ServerConfig{Address: ":8080", PublicURL: "allow.example.com"},
+			},
+			expectError: true,
+			errorMsg:    "invalid server.public-url",
+		},
+		{
+			name: "invalid health address",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Health: HealthConfig{Address: "8081"},
+			},
+			expectError: true,
+			errorMsg:    "invalid health.address",
+		},
+		{
+			name: "health address shared with the server",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Server: ServerConfig{Address: ":8080"},
+				Health: HealthConfig{Address: ":8080"},
+			},
+			expectError: true,
+			errorMsg:    "health.address and server.address must differ",
+		},
+		{
+			name: "admin API without token",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Admin: AdminConfig{Address: "127.0.0.1:8082"},
+			},
+			expectError: true,
+			errorMsg:    "admin.token must be at least 16 characters",
+		},
+		{
+			name: "admin address shared with health probes",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Health: HealthConfig{Address: ":8081"},
+				Admin:  AdminConfig{Address: ":8081", Token: "admin-token-0123456789"},
+			},
+			expectError: true,
+			errorMsg:    "admin.address must differ",
+		},
+		{
+			name: "short server auth token",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Server: ServerConfig{Address: ":8080", AuthTokens: []string{"secret"}},
+			},
+			expectError: true,
+			errorMsg:    "server.auth-tokens must be at least 16 characters",
+		},
+		{
+			name: "audit shipping without audit path",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Audit: AuditConfig{Ship: AuditShipConfig{Type: "splunk", URL: "https://splunk.example.com:8088/services/collector/event", BatchSize: 100, Interval: time.Minute}},
+			},
+			expectError: true,
+			errorMsg:    "audit.path is required when audit.ship.type is set",
+		},
+		{
+			name: "signing without key file",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Signing: SigningConfig{Format: "minisign"},
+			},
+			expectError: true,
+			errorMsg:    "signing.key-file is required when signing.format is set",
+		},
+		{
+			name: "invalid reserved sources policy",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Safety: SafetyConfig{ReservedSources: "warn"},
+			},
+			expectError: true,
+			errorMsg:    "invalid safety.reserved-sources",
+		},
+		{
+			name: "invalid trends webhook",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Trends: TrendsConfig{MaxChangePercent: 30, WebhookURL: "hooks.slack.com/services/x"},
+			},
+			expectError: true,
+			errorMsg:    "invalid trends.webhook-url",
+		},
+		{
+			name: "invalid notification template",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Digest: NotifyTemplate{Title: "{{ .FirewallName"}},
+			},
+			expectError: true,
+			errorMsg:    "invalid notify.digest",
+		},
+		{
+			name: "valid notify webhooks",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "https://hooks.slack.com/services/x", Format: "slack"}, {URL: "https://example.com/hook"}}},
+			},
+			expectError: false,
+			errorMsg:    "",
+		},
+		{
+			name: "invalid notify webhook url",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "hooks.slack.com/services/x"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid notify.webhooks[0].url",
+		},
+		{
+			name: "invalid notify webhook format",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "https://example.com/hook", Format: "matrix"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid notify.webhooks[0].format",
+		},
+		{
+			name: "valid notify email",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Email: NotifyEmail{Host: "smtp.example.com", Username: "ops", Password: "secret", From: "Allowlister <allowlister@example.com>", To: []string{"ops@example.com"}, FailuresOnly: true}},
+			},
+			expectError: false,
+			errorMsg:    "",
+		},
+		{
+			name: "notify email without recipients",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Email: NotifyEmail{Host: "smtp.example.com", From: "allowlister@example.com"}},
+			},
+			expectError: true,
+			errorMsg:    "notify.email.to is required",
+		},
+		{
+			name: "invalid notify email tls",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Email: NotifyEmail{Host: "smtp.example.com", TLS: "ssl", From: "allowlister@example.com", To: []string{"ops@example.com"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid notify.email.tls",
+		},
+		{
+			name: "invalid notify email sender",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Email: NotifyEmail{Host: "smtp.example.com", From: "allowlister", To: []string{"ops@example.com"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid notify.email.from",
+		},
+		{
+			name: "notify webhook quiet hours",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "https://example.com/hook", MinSeverity: "change", QuietHours: NotifyQuietHours{Open: "0 22 * * *", Close: "0 7 * * *", MinSeverity: "none"}}}},
+			},
+			expectError: false,
+			errorMsg:    "",
+		},
+		{
+			name: "invalid notify webhook severity",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "https://example.com/hook", MinSeverity: "critical"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid notify.webhooks[0].min-severity",
+		},
+		{
+			name: "notify webhook quiet hours without close",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "https://example.com/hook", QuietHours: NotifyQuietHours{Open: "0 22 * * *"}}}},
+			},
+			expectError: true,
+			errorMsg:    "notify.webhooks[0].quiet-hours requires both open and close",
+		},
+		{
+			name: "invalid notify webhook quiet severity",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Notify: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "https://example.com/hook", QuietHours: NotifyQuietHours{Open: "0 22 * * *", Close: "0 7 * * *", MinSeverity: "change"}}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid notify.webhooks[0].quiet-hours.min-severity",
+		},
+		{
+			name: "negative run retry budget",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Run:          RunConfig{RetryBudget: -time.Second},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid run.retry-budget",
+		},
+		{
+			name: "negative run deadline",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Run:          RunConfig{Deadline: -time.Minute},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid run.deadline",
+		},
+		{
+			name: "negative sources timeout",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Sources:      SourcesConfig{Timeout: -time.Second},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid sources.timeout",
+		},
+		{
+			name: "negative sources cache ttl",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Sources:      SourcesConfig{CacheTTL: -time.Minute},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid sources.cache-ttl",
+		},
+		{
+			name: "invalid sources address family",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Sources:      SourcesConfig{AddressFamily: "ipv5"},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid address-family ipv5 of sources",
+		},
+		{
+			name: "invalid network address family",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron:     CronConfig{Schedule: "0 0 * * *"},
+				Sources: SourcesConfig{Networks: []NetworkSource{
+					{Name: "office", CIDRs: []string{"151.101.0.0/27"}, AddressFamily: "v4"},
+				}},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid address-family v4 of network office",
+		},
+		{
+			name: "invalid source on-failure policy",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron:     CronConfig{Schedule: "0 0 * * *"},
+				Sources: SourcesConfig{DNS: []DNSSource{
+					{Name: "partner", Domains: []string{"egress.partner.example.com"}, OnFailure: "ignore"},
+				}},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid on-failure ignore of source partner",
+		},
+		{
+			name: "use-cached cloudflare on-failure policy",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips", OnFailure: OnFailureUseCached},
+			},
+			expectError: false,
+		},
+		{
+			name: "sub-second health interval",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Health:       HealthConfig{Interval: 100 * time.Millisecond},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "health.interval must be at least 1s",
+		},
+		{
+			name: "negative reconcile interval",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Reconcile:    ReconcileConfig{Interval: -time.Second},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid reconcile.interval",
+		},
+		{
+			name: "reconcile interval under a second",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Reconcile:    ReconcileConfig{Interval: 100 * time.Millisecond},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "reconcile.interval must be at least 1s, got 100ms",
+		},
+		{
+			name: "negative reconcile min apply interval",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				Reconcile:    ReconcileConfig{Interval: time.Minute, MinApplyInterval: -time.Minute},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid reconcile.min-apply-interval",
+		},
+		{
+			name: "negative state snapshots",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				State:        StateConfig{Path: "state.json", Snapshots: -1},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+			},
+			expectError: true,
+			errorMsg:    "invalid state.snapshots",
+		},
+		{
+			name: "negative workers",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Workers:    -1,
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid digitalocean.workers",
+		},
+		{
+			name: "netdata domain option for an unlisted domain",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Netdata: NetdataConfig{
+					Domains:       []string{"app.netdata.cloud"},
+					DomainOptions: []NetdataDomainOption{{Domain: "mqtt.netdata.cloud", Required: true}},
+				},
+			},
+			expectError: true,
+			errorMsg:    "not listed in netdata.domains",
+		},
+		{
+			name: "retry min-backoff above max-backoff",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Retry: DigitalOceanRetryConfig{
+						Retries:    3,
+						MinBackoff: time.Minute,
+						MaxBackoff: time.Second,
+					},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "digitalocean.retry.min-backoff",
+		},
+		{
+			name: "further firewall without id",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Firewalls:  []FirewallTarget{{InboundRules: []InboundRule{{Port: 80, Protocol: "tcp"}}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "requires an id",
+		},
+		{
+			name: "firewall listed twice",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Firewalls:  []FirewallTarget{{ID: "test-firewall"}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "listed more than once",
+		},
+		{
+			name: "invalid rule of further firewall",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Firewalls:  []FirewallTarget{{ID: "fw-2", InboundRules: []InboundRule{{Port: 0, Protocol: "tcp"}}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "firewall fw-2: invalid port",
+		},
+		{
+			name: "unknown source of further firewall",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Firewalls:  []FirewallTarget{{ID: "fw-2", Sources: []string{"fastly"}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid source fastly",
+		},
+		{
+			name: "unknown source of firewall-id",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"datadog"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid source datadog for firewall test-firewall",
+		},
+		{
+			name: "http source selected by a firewall",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Firewalls:  []FirewallTarget{{ID: "fw-2", Sources: []string{"github"}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{HTTP: []HTTPSource{{Name: "github", URL: "https://api.github.com/meta", Format: "json", Paths: []string{"hooks"}}, {Name: "partner", URL: "https://partner.example.com/ips.csv", Format: "csv", Column: 1, SkipHeader: true}}},
+			},
+		},
+		{
+			name: "http source named like a built-in source",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{HTTP: []HTTPSource{{Name: "cloudflare", URL: "https://example.com/ips.txt", Format: "lines"}}},
+			},
+			expectError: true,
+			errorMsg:    "duplicate source name cloudflare",
+		},
+		{
+			name: "valid named networks",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"cloudflare", "nyc-office"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Networks: []NetworkSource{{Name: "nyc-office", Owner: "it@example.com", CIDRs: []string{"151.101.0.0/27", "2a04:4e40::/48", "151.101.64.7"}}}},
+			},
+			expectError: false,
+		},
+		{
+			name: "named network with host bits set",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"cloudflare", "nyc-office"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Networks: []NetworkSource{{Name: "nyc-office", CIDRs: []string{"151.101.0.5/27"}}}},
+			},
+			expectError: true,
+			errorMsg:    "151.101.0.5/27 has host bits set, did you mean 151.101.0.0/27?",
+		},
+		{
+			name: "named network with private range",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"cloudflare", "nyc-office"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Networks: []NetworkSource{{Name: "nyc-office", CIDRs: []string{"10.0.0.0/8"}}}},
+			},
+			expectError: true,
+			errorMsg:    "10.0.0.0/8 is a private range",
+		},
+		{
+			name: "named network without blocks",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"cloudflare", "nyc-office"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Networks: []NetworkSource{{Name: "nyc-office"}}},
+			},
+			expectError: true,
+			errorMsg:    "network nyc-office requires at least one CIDR block",
+		},
+		{
+			name: "named network with duplicate name",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"cloudflare", "nyc-office"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Networks: []NetworkSource{{Name: "nyc-office", CIDRs: []string{"151.101.0.0/27"}}, {Name: "nyc-office", CIDRs: []string{"151.101.64.0/24"}}}},
+			},
+			expectError: true,
+			errorMsg:    "duplicate source name nyc-office in sources.networks",
+		},
+		{
+			name: "valid google sources selected per rule",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 22, Protocol: "tcp", Sources: []string{"gcp-us", "netdata"}}, {Port: 443, Protocol: "tcp"}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Google: []GoogleSource{{Name: "gcp-us", List: "cloud", Scopes: []string{"us-*", "northamerica-northeast1"}}, {Name: "google", List: "goog", URL: "https://mirror.example.com/goog.json"}}},
+			},
+			expectError: false,
+		},
+		{
+			name: "google source with invalid list",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 443, Protocol: "tcp"}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Google: []GoogleSource{{Name: "gcp-us", List: "gcp"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid list gcp of source gcp-us (must be goog or cloud)",
+		},
+		{
+			name: "google source with scopes on the goog list",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 443, Protocol: "tcp"}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Google: []GoogleSource{{Name: "google", List: "goog", Scopes: []string{"us-central1"}}}},
+			},
+			expectError: true,
+			errorMsg:    "scopes only apply to the cloud list",
+		},
+		{
+			name: "google source with invalid scope",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 443, Protocol: "tcp"}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Google: []GoogleSource{{Name: "gcp-us", List: "cloud", Scopes: []string{"us-[central1"}}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid scope",
+		},
+		{
+			name: "rule selecting an unknown source",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 22, Protocol: "tcp", Sources: []string{"gcp-eu"}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Google: []GoogleSource{{Name: "gcp-us", List: "cloud"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid source gcp-eu for port 22 of firewall test-firewall",
+		},
+		{
+			name: "valid probe sources",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 8080, Protocol: "tcp", Sources: []string{"uptimerobot", "pingdom-eu"}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Probes: []ProbeSource{{Provider: "uptimerobot"}, {Name: "pingdom-eu", Provider: "pingdom", Token: "pingdom-token"}}},
+			},
+			expectError: false,
+		},
+		{
+			name: "pingdom probes without token",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 8080, Protocol: "tcp", Sources: []string{"uptimerobot", "pingdom-eu"}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Probes: []ProbeSource{{Provider: "uptimerobot"}, {Name: "pingdom-eu", Provider: "pingdom"}}},
+			},
+			expectError: true,
+			errorMsg:    "sources.probes entry 1: pingdom requires a token",
+		},
+		{
+			name: "probe source with invalid provider",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 8080, Protocol: "tcp", Sources: []string{"uptimerobot", "pingdom-eu"}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Probes: []ProbeSource{{Provider: "statuscake"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid provider \"statuscake\" in sources.probes entry 0",
+		},
+		{
+			name: "probe sources with duplicate name",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:       "test-key",
+					FirewallID:   "test-firewall",
+					InboundRules: []InboundRule{{Port: 8080, Protocol: "tcp", Sources: []string{"uptimerobot", "pingdom-eu"}}},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{Probes: []ProbeSource{{Provider: "uptimerobot"}, {Provider: "uptimerobot"}}},
+			},
+			expectError: true,
+			errorMsg:    "duplicate source name uptimerobot in sources.probes",
+		},
+		{
+			name: "valid dns sources",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"partner"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{DNS: []DNSSource{{Name: "partner", Domains: []string{"egress.partner.example.com"}, RecordTypes: []string{"A"}, Resolver: "10.0.0.2"}, {Name: "corp", Domains: []string{"vpn.corp.example.com"}, Resolver: "[2606:4700:4700::1111]:53"}}},
+			},
+			expectError: false,
+		},
+		{
+			name: "dns source without domains",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"partner"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{DNS: []DNSSource{{Name: "partner"}}},
+			},
+			expectError: true,
+			errorMsg:    "source partner requires at least one domain",
+		},
+		{
+			name: "dns source named netdata",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"partner"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{DNS: []DNSSource{{Name: "netdata", Domains: []string{"app.netdata.cloud"}}}},
+			},
+			expectError: true,
+			errorMsg:    "duplicate source name netdata in sources.dns",
+		},
+		{
+			name: "dns source with invalid record type",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"partner"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{DNS: []DNSSource{{Name: "partner", Domains: []string{"egress.partner.example.com"}, RecordTypes: []string{"CNAME"}}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid record type CNAME of source partner (must be A or AAAA)",
+		},
+		{
+			name: "dns source with hostname resolver",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"partner"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{DNS: []DNSSource{{Name: "partner", Domains: []string{"egress.partner.example.com"}, Resolver: "dns.example.com"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid resolver dns.example.com of source partner",
+		},
+		{
+			name: "dns source with invalid resolver port",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+					Sources:    []string{"partner"},
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{DNS: []DNSSource{{Name: "partner", Domains: []string{"egress.partner.example.com"}, Resolver: "10.0.0.2:0"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid resolver port 0 of source partner",
+		},
+		{
+			name: "dns source with DoH endpoint",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{DNS: []DNSSource{{Name: "partner", Domains: []string{"egress.partner.example.com"}, DoH: "https://cloudflare-dns.com/dns-query", Timeout: 3 * time.Second}}},
+			},
+			expectError: false,
+		},
+		{
+			name: "dns source with resolver and DoH endpoint",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{DNS: []DNSSource{{Name: "partner", Domains: []string{"egress.partner.example.com"}, Resolver: "10.0.0.2", DoH: "https://cloudflare-dns.com/dns-query"}}},
+			},
+			expectError: true,
+			errorMsg:    "source partner sets both a resolver and a DoH endpoint, choose one",
+		},
+		{
+			name: "netdata DoH endpoint over http",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Netdata: NetdataConfig{Domains: []string{"app.netdata.cloud"}, DoH: "http://dns.example.com/dns-query"},
+			},
+			expectError: true,
+			errorMsg:    "invalid DoH endpoint http://dns.example.com/dns-query of netdata: must be an https URL",
+		},
+		{
+			name: "invalid cron mode",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+					Mode:     "ttl",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid cron.mode: ttl (must be fixed or adaptive)",
+		},
+		{
+			name: "adaptive cron mode without min interval",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+					Mode:     CronModeAdaptive,
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+			},
+			expectError: true,
+			errorMsg:    "cron.min-interval must be at least 1s in adaptive mode, got 0s",
+		},
+		{
+			name: "netdata negative timeout",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Netdata: NetdataConfig{Domains: []string{"app.netdata.cloud"}, Timeout: -time.Second},
+			},
+			expectError: true,
+			errorMsg:    "invalid timeout -1s of netdata (must not be negative)",
+		},
+		{
+			name: "http source with invalid name",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{HTTP: []HTTPSource{{Name: "Partner IPs", URL: "https://example.com/ips.txt", Format: "lines"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid name",
+		},
+		{
+			name: "http source without url",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{HTTP: []HTTPSource{{Name: "partner", Format: "lines"}}},
+			},
+			expectError: true,
+			errorMsg:    "must be an http(s) URL",
+		},
+		{
+			name: "json http source without paths",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{HTTP: []HTTPSource{{Name: "github", URL: "https://api.github.com/meta", Format: "json"}}},
+			},
+			expectError: true,
+			errorMsg:    "requires paths",
+		},
+		{
+			name: "json http source with invalid path",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{HTTP: []HTTPSource{{Name: "aws", URL: "https://ip-ranges.amazonaws.com/ip-ranges.json", Format: "json", Paths: []string{"prefixes[service=EC2.ip_prefix"}}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid json path",
+		},
+		{
+			name: "http source with unknown format",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Sources: SourcesConfig{HTTP: []HTTPSource{{Name: "partner", URL: "https://example.com/ips.xml", Format: "xml"}}},
+			},
+			expectError: true,
+			errorMsg:    "invalid format xml",
+		},
+		{
+			name: "lite mode with invites",
+			config: &Config{
+				LogLevel: "INFO",
+				Cron: CronConfig{
+					Schedule: "0 0 * * *",
+				},
+				DigitalOcean: DigitalOceanConfig{
+					APIKey:     "test-key",
+					FirewallID: "test-firewall",
+				},
+				Cloudflare: CloudflareConfig{
+					IPsURL: "https://api.cloudflare.com/client/v4/ips",
+				},
+				Invites: InvitesConfig{SigningKey: "0123456789abcdef0123456789abcdef"},
+				Lite:    true,
+			},
+			expectError: true,
+			errorMsg:    "lite mode disables",
+		},
+		{
+			name: "lite mode with admin API",
+			config: &Config{
+				LogLevel:     "INFO",
+				Cron:         CronConfig{Schedule: "0 0 * * *"},
+				DigitalOcean: DigitalOceanConfig{APIKey: "test-key", FirewallID: "test-firewall"},
+				Cloudflare:   CloudflareConfig{IPsURL: "https://api.cloudflare.com/client/v4/ips"},
+				Admin:        AdminConfig{Address: "127.0.0.1:8082", Token: "0123456789abcdef"},
+				Lite:         true,
+			},
+			expectError: true,
+			errorMsg:    "admin.address serves the admin API over HTTP, which lite mode disables",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(tt.config)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+					return
+				}
+				if tt.errorMsg != "" && !contains(err.Error(), tt.errorMsg) {
+					t.Errorf("expected error to contain '%s', got '%s'", tt.errorMsg, err.Error())
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	// Reset koanf instance
+	k = koanf.New(".")
+
+	SetDefaults()
+
+	if k.String("log-level") != "INFO" {
+		t.Errorf("expected default log-level INFO, got %s", k.String("log-level"))
+	}
+
+	if k.String("cron.schedule") != "0 0 * * *" {
+		t.Errorf("expected default cron schedule '0 0 * * *', got %s", k.String("cron.schedule"))
+	}
+
+	if k.String("cron.timezone") != "UTC" {
+		t.Errorf("expected default timezone UTC, got %s", k.String("cron.timezone"))
+	}
+
+	if k.String("cloudflare.ips-url") != "https://api.cloudflare.com/client/v4/ips" {
+		t.Errorf("expected default Cloudflare URL, got %s", k.String("cloudflare.ips-url"))
+	}
+}
+
+// Helper function to check if a string contains a substring
+func contains(s, substr string) bool {
+	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
+		(len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
+			func() bool {
+				for i := 0; i <= len(s)-len(substr); i++ {
+					if s[i:i+len(substr)] == substr {
+						return true
+					}
+				}
+				return false
+			}())))
+}
+
+func TestLoadWithoutConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY", "env-api-key")
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_FIREWALL_ID", "env-firewall-id")
+	t.Setenv("FIREWALL_ALLOWLISTER_PRESETS", "cloudflare-web")
+
+	// The default file may be missing, the environment configures everything
+	cfg, err := Load(DefaultConfigFile, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DigitalOcean.FirewallID != "env-firewall-id" || len(cfg.DigitalOcean.InboundRules) != 2 {
+		t.Errorf("expected the firewall and preset rules from the environment, got %+v", cfg.DigitalOcean)
+	}
+
+	// A file named with --config must exist, even if it is the default one
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("config", DefaultConfigFile, "")
+	if err := flags.Set("config", DefaultConfigFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Load(DefaultConfigFile, flags); err == nil || !contains(err.Error(), "failed to load config file") {
+		t.Errorf("expected the missing config file to fail, got %v", err)
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	changed := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	changed.String("config", DefaultConfigFile, "")
+	if err := changed.Set("config", DefaultConfigFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := ResolveFile(DefaultConfigFile, nil); got != "" {
+		t.Errorf("expected no file without the default one, got %q", got)
+	}
+	if got := ResolveFile(DefaultConfigFile, changed); got != DefaultConfigFile {
+		t.Errorf("expected the file named with --config, got %q", got)
+	}
+	if got := ResolveFile("other.yaml", nil); got != "other.yaml" {
+		t.Errorf("expected another file to be kept even if missing, got %q", got)
+	}
+
+	if err := os.WriteFile(DefaultConfigFile, []byte("{}\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if got := ResolveFile(DefaultConfigFile, nil); got != DefaultConfigFile {
+		t.Errorf("expected the existing default file, got %q", got)
+	}
+}
+
+func TestLoadAPIKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	if err := os.WriteFile(path, []byte("file-api-key\n"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		envVars     map[string]string
+		expectError string
+	}{
+		{
+			name: "key read from file",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY_FILE": path,
+			},
+		},
+		{
+			name: "key and key file both set",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY":      "env-api-key",
+				"FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY_FILE": path,
+			},
+			expectError: "set only one of",
+		},
+		{
+			name: "missing key file",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY_FILE": filepath.Join(t.TempDir(), "missing"),
+			},
+			expectError: "failed to read digitalocean.api-key-file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_FIREWALL_ID", "env-firewall-id")
+			for key, value := range tt.envVars {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load("", nil)
+			if tt.expectError != "" {
+				if err == nil || !contains(err.Error(), tt.expectError) {
+					t.Errorf("expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.DigitalOcean.APIKey != "file-api-key" {
+				t.Errorf("expected API key from file, got %q", cfg.DigitalOcean.APIKey)
+			}
+		})
+	}
+}
+
+func TestLoadSelfService(t *testing.T) {
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY", "env-api-key")
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_FIREWALL_ID", "env-firewall-id")
+	t.Setenv("FIREWALL_ALLOWLISTER_SERVER_ADDRESS", ":8080")
+	t.Setenv("FIREWALL_ALLOWLISTER_SERVER_PUBLIC_URL", "https://allow.example.com")
+	t.Setenv("FIREWALL_ALLOWLISTER_SELF_SERVICE_PROVIDER", "google")
+	t.Setenv("FIREWALL_ALLOWLISTER_SELF_SERVICE_CLIENT_ID", "client")
+	t.Setenv("FIREWALL_ALLOWLISTER_SELF_SERVICE_CLIENT_SECRET", "secret")
+	t.Setenv("FIREWALL_ALLOWLISTER_SELF_SERVICE_SESSION_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("FIREWALL_ALLOWLISTER_SELF_SERVICE_POLICIES",
+		`[{"users":["*@example.com"],"ports":[22],"max-ttl":"8h"},{"users":["octocat"],"ports":[22,3389],"max-ttl":"1h"}]`)
+
+	cfg, err := Load("", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		identity string
+		ok       bool
+		maxTTL   time.Duration
+	}{
+		{identity: "Alice@Example.com", ok: true, maxTTL: 8 * time.Hour},
+		{identity: "octocat", ok: true, maxTTL: time.Hour},
+		{identity: "mallory@example.com.evil.test", ok: false},
+		{identity: "example.com", ok: false},
+	}
+	for _, tt := range tests {
+		policy, ok := cfg.SelfService.PolicyFor(tt.identity)
+		if ok != tt.ok || policy.MaxTTL != tt.maxTTL {
+			t.Errorf("%s: expected match %v with max-ttl %s, got %v with %s", tt.identity, tt.ok, tt.maxTTL, ok, policy.MaxTTL)
+		}
+	}
+
+	// A managed port would have the user's address replaced by the next scheduled update
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_INBOUND_RULES", `[{"port":3389,"protocol":"tcp"}]`)
+	if _, err := Load("", nil); err == nil || !contains(err.Error(), "must not be managed by digitalocean.inbound-rules") {
+		t.Errorf("expected managed self-service port to be rejected, got %v", err)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	first, err := Load("testdata/valid_config.yaml", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := Load("testdata/valid_config.yaml", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first.Hash()) != 64 || first.Hash() != second.Hash() {
+		t.Fatalf("expected the same hash for the same configuration, got %s and %s", first.Hash(), second.Hash())
+	}
+
+	second.Tenant = "prod"
+	if first.Hash() != second.Hash() {
+		t.Error("expected the tenant selection to leave the hash alone")
+	}
+	second.Cron.Schedule = "0 1 * * *"
+	if first.Hash() == second.Hash() {
+		t.Error("expected a changed setting to change the hash")
+	}
+}
+
+func TestSnapshotsPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "state.json", expected: "state.snapshots.json"},
+		{path: "/var/lib/allowlister/state-acme.json", expected: "/var/lib/allowlister/state-acme.snapshots.json"},
+		{path: "state", expected: "state.snapshots"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := (StateConfig{Path: tt.path}).SnapshotsPath(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
 }
@@ -0,0 +1,35 @@
+package config
+
+import "reflect"
+
+// ChangedKeys returns the keys whose values differ between two configurations, in the order of
+// the Config struct; lists and maps are compared as a whole and reported by their own key, so
+// secrets are named but never shown
+func ChangedKeys(previous, current *Config) []string {
+	return changedKeys(reflect.ValueOf(*previous), reflect.ValueOf(*current), "")
+}
+
+// changedKeys compares the koanf-tagged fields of two structs of the same type, descending into
+// nested structs
+func changedKeys(previous, current reflect.Value, prefix string) []string {
+	var changed []string
+	t := previous.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("koanf")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+
+		a, b := previous.Field(i), current.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			changed = append(changed, changedKeys(a, b, path+".")...)
+			continue
+		}
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangedKeys(t *testing.T) {
+	previous := &Config{
+		LogLevel: "INFO",
+		Cron:     CronConfig{Schedule: "0 * * * *", Timezone: "UTC"},
+		DigitalOcean: DigitalOceanConfig{
+			APIKey:       "old-key",
+			FirewallID:   "fw-1",
+			InboundRules: []InboundRule{{Port: 443, Protocol: "tcp"}},
+		},
+	}
+
+	if changed := ChangedKeys(previous, previous); len(changed) != 0 {
+		t.Errorf("expected no changes, got %v", changed)
+	}
+
+	current := *previous
+	current.Cron.Schedule = "*/5 * * * *"
+	current.Reconcile.Interval = time.Minute
+	current.DigitalOcean.APIKey = "new-key"
+	current.DigitalOcean.InboundRules = []InboundRule{{Port: 443, Protocol: "tcp"}, {Port: 22, Protocol: "tcp"}}
+
+	expected := []string{"cron.schedule", "reconcile.interval", "digitalocean.api-key", "digitalocean.inbound-rules"}
+	if changed := ChangedKeys(previous, &current); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected %v, got %v", expected, changed)
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/knadh/koanf/providers/posflag"
+	"github.com/knadh/koanf/v2"
+	"github.com/spf13/pflag"
+)
+
+// flagUsage is the help text of every flag RegisterFlags generates, keyed by its dotted koanf path
+var flagUsage = map[string]string{
+	"log-level":                             "Log level (DEBUG, INFO, WARN, ERROR, FATAL)",
+	"log-output":                            "Log output (stderr, syslog, journald)",
+	"presets":                               "Built-in presets to apply (cloudflare-web, netdata-monitoring, ssh-admin)",
+	"tenant":                                "Tenant to operate on when tenants are configured",
+	"read-only":                             "Guarantee that no mutating DigitalOcean API call is made",
+	"strict":                                "Reject config file keys and values that do not match the schema",
+	"lite":                                  "Run the daemon without HTTP server, admin API, metrics, tracing and source size history",
+	"logging.sampling.initial":              "Identical log entries logged per sampling tick before sampling starts, 0 disables sampling",
+	"logging.sampling.thereafter":           "Log every nth identical entry past logging.sampling.initial within a tick",
+	"logging.sampling.tick":                 "Period over which identical log entries are counted for sampling",
+	"logging.levels":                        "Log level per module, e.g. scheduler=WARN,digitalocean=DEBUG",
+	"logging.tag":                           "Syslog APP-NAME and journald SYSLOG_IDENTIFIER of the log entries",
+	"logging.syslog.network":                "Network of the syslog output: udp, tcp, unix or unixgram",
+	"logging.syslog.address":                "Syslog server receiving the log entries, e.g. logs.example.com:514 (default: local syslog daemon)",
+	"logging.syslog.facility":               "Syslog facility of the log entries, e.g. daemon",
+	"logging.hostname":                      "Add a hostname field to every log entry and audit record",
+	"logging.fields":                        "Global fields added to every log entry and audit record, e.g. environment=production",
+	"logging.ship.format":                   "Also ship log entries to Graylog or Logstash: gelf or logstash",
+	"logging.ship.network":                  "Network of the shipped log entries: tcp or udp",
+	"logging.ship.address":                  "Collector receiving the shipped log entries, e.g. graylog.example.com:12201",
+	"logging.ship.buffer-size":              "Log entries buffered for shipping before new ones are dropped",
+	"digitalocean.api-key":                  "DigitalOcean API key",
+	"digitalocean.api-key-file":             "File holding the DigitalOcean API key, re-read on SIGHUP and rejected requests",
+	"digitalocean.firewall-id":              "DigitalOcean firewall ID",
+	"digitalocean.inbound-rules":            `Inbound rules as JSON, e.g. '[{"port":443,"protocol":"tcp"}]'`,
+	"digitalocean.sources":                  "Sources allowlisted on firewall-id: cloudflare, netdata or sources.http names (comma-separated, default: all)",
+	"digitalocean.workers":                  "How many firewalls a run updates at the same time",
+	"digitalocean.retry.retries":            "Retries of a DigitalOcean API request answered with 429 or a server error, 0 disables",
+	"digitalocean.retry.min-backoff":        "Initial backoff between DigitalOcean API retries without a Retry-After header",
+	"digitalocean.retry.max-backoff":        "Maximum backoff between DigitalOcean API retries",
+	"digitalocean.firewalls":                `Further firewalls as JSON, e.g. '[{"id":"fw-2","inbound-rules":[{"port":19999,"protocol":"tcp"}],"sources":["netdata"]}]'`,
+	"digitalocean.dynamic-dns":              `Dynamic DNS hostnames as JSON, e.g. '[{"hostname":"home.example.org","port":22}]'`,
+	"digitalocean.freeze-tag":               "Firewall tag that halts automated updates while present",
+	"digitalocean.allow-local-ipv6":         "Accept link-local and unique local IPv6 sources, which are rejected by default",
+	"digitalocean.compact-rules":            "Merge managed rules with the same tags and droplets into multi-port rules",
+	"lock.path":                             "Host-wide lock file serializing firewall mutations",
+	"lock.timeout":                          "How long to wait for the host-wide lock before failing",
+	"confirmation.max-removed-addresses":    "Removed addresses above which a change requires confirmation",
+	"cron.schedule":                         "Cron schedule expression",
+	"cron.timezone":                         "Timezone for cron schedule",
+	"cron.catch-up":                         "Run immediately when a scheduled run was missed",
+	"cron.mode":                             "Schedule mode: fixed, or adaptive to also update when resolved DNS records expire",
+	"cron.min-interval":                     "Shortest delay between adaptive updates, however short the DNS TTLs",
+	"run.retry-budget":                      "Total backoff the retries of a run may wait across sources and API requests, 0 disables",
+	"run.deadline":                          "Cancel a firewall update run still going after this long, 0 disables",
+	"reconcile.interval":                    "Poll the sources this often and update the firewalls when they changed, 0 disables",
+	"reconcile.min-apply-interval":          "Shortest delay between updates triggered by changed sources",
+	"cloudflare.ips-url":                    "Cloudflare IPs API URL",
+	"cloudflare.on-failure":                 "When the Cloudflare list cannot be fetched: abort the run, skip the source or use-cached addresses",
+	"sources.timeout":                       "Longest a source may take to collect, retries included, 0 disables",
+	"sources.cache-ttl":                     "Reuse the addresses of a source collected less than this long ago, 0 disables",
+	"sources.address-family":                "Addresses kept from every source: ipv4, ipv6 or both",
+	"cloudflare.address-family":             "Cloudflare ranges kept: ipv4, ipv6 or both (default: sources.address-family)",
+	"netdata.address-family":                "Netdata addresses kept: ipv4, ipv6 or both (default: sources.address-family)",
+	"sources.http":                          `IP lists as JSON, e.g. '[{"name":"github","url":"https://api.github.com/meta","format":"json","paths":["hooks"]}]'`,
+	"sources.google":                        `Google range lists as JSON, e.g. '[{"name":"gcp-us","list":"cloud","scopes":["us-*"]}]'`,
+	"sources.probes":                        `Uptime monitoring probe lists as JSON, e.g. '[{"provider":"uptimerobot"},{"provider":"pingdom","token":"..."}]'`,
+	"sources.dns":                           `Domains to resolve as JSON, e.g. '[{"name":"partner","domains":["egress.partner.example.com"],"record-types":["A"]}]'`,
+	"sources.networks":                      `Named networks as JSON, e.g. '[{"name":"nyc-office","owner":"it@example.com","cidrs":["203.0.113.0/27"]}]'`,
+	"netdata.domains":                       "Netdata domains to resolve (comma-separated)",
+	"netdata.domain-options":                `Required or optional Netdata domains as JSON, e.g. '[{"domain":"mqtt.netdata.cloud","required":false}]'`,
+	"netdata.resolver":                      "DNS server resolving the Netdata domains, host or host:port (default: system resolver)",
+	"netdata.doh":                           "DNS-over-HTTPS endpoint resolving the Netdata domains, e.g. https://cloudflare-dns.com/dns-query",
+	"netdata.timeout":                       "Timeout of each Netdata domain lookup",
+	"netdata.on-failure":                    "When the Netdata domains fail to resolve: abort the run, skip the source or use-cached addresses",
+	"state.path":                            "Path to local state file",
+	"state.snapshots":                       "Snapshots of the rules replaced by updates kept per firewall for rollback, 0 disables",
+	"safety.admin-ports":                    "Ports on which an update may not take away your current access (comma-separated)",
+	"safety.admin-cidrs":                    "Admin networks that must stay allowed on the admin ports (comma-separated)",
+	"safety.reserved-sources":               "Private, loopback and bogon addresses resolved from domains: drop, keep or fail",
+	"safety.bogon-filter":                   "Drop bogon and reserved ranges from source lists such as Cloudflare's",
+	"public-ip.cache-path":                  "File caching the detected public IP (default: in the user cache directory)",
+	"public-ip.cache-ttl":                   "Serve the cached public IP for this long, 0 disables the cache",
+	"public-ip.min-interval":                "Shortest delay between requests to the public IP service",
+	"server.address":                        "Address serving the allowlist over HTTP in daemon mode, e.g. :8080",
+	"server.auth-tokens":                    "Bearer tokens required on the allowlist and metrics endpoints (comma-separated)",
+	"server.rate-limit":                     "Requests per minute allowed per client of the HTTP server, 0 disables the limit",
+	"server.public-url":                     "URL users reach the server at, used in invite links and SSO redirects",
+	"server.trust-proxy":                    "Take the client IP from X-Forwarded-For when the server is behind a proxy",
+	"health.address":                        "Address serving the /healthz, /readyz and /status probes in daemon mode, e.g. :8081",
+	"health.interval":                       "Probe the DigitalOcean API and every source this often between runs, 0 disables",
+	"admin.address":                         "Address serving the admin API that adds managed rules at runtime, e.g. 127.0.0.1:8082",
+	"admin.token":                           "Bearer token required by the admin API, at least 16 characters",
+	"audit.path":                            "Append-only JSON audit log of firewall changes; empty disables it",
+	"audit.ship.type":                       "Ship audit records to splunk, elastic or an https collector",
+	"audit.ship.url":                        "Splunk HEC endpoint, Elasticsearch URL or collector URL receiving audit records",
+	"audit.ship.token":                      "Splunk HEC token, Elasticsearch API key or collector bearer token",
+	"audit.ship.index":                      "Splunk index or Elasticsearch index receiving audit records",
+	"audit.ship.batch-size":                 "Maximum number of audit records per shipping request",
+	"audit.ship.retries":                    "Retries of a failed audit shipping request",
+	"audit.ship.interval":                   "How often the daemon ships new audit records",
+	"signing.format":                        "Sign exported allowlists with minisign or cosign signatures",
+	"signing.key-file":                      "Unencrypted PEM private key signing allowlists (Ed25519 for minisign, ECDSA P-256 for cosign)",
+	"digest.webhook-url":                    "Webhook receiving a periodic digest of applied changes",
+	"digest.schedule":                       "Cron schedule of the change digest, e.g. @daily or @weekly",
+	"gc.schedule":                           "Cron schedule removing the rules of ports dropped from the configuration; empty disables it",
+	"trends.max-change-percent":             "Source size change between runs in percent above which an alert is raised, 0 disables",
+	"trends.webhook-url":                    "Webhook also receiving source size alerts",
+	"notify.environment":                    "Deployment named in notifications, e.g. production",
+	"notify.digest.title":                   "Go template of the change digest title",
+	"notify.digest.body":                    "Go template of the change digest body",
+	"notify.trends.title":                   "Go template of the source size alert title",
+	"notify.trends.body":                    "Go template of the source size alert body",
+	"notify.run.title":                      "Go template of the scheduled run notification title",
+	"notify.run.body":                       "Go template of the scheduled run notification body",
+	"notify.webhooks":                       `Webhooks notified after scheduled runs as JSON, e.g. '[{"url":"https://hooks.slack.com/services/...","format":"slack"}]'`,
+	"notify.email.host":                     "SMTP server sending run notification emails; empty disables them",
+	"notify.email.port":                     "SMTP port, 587 for starttls, 465 for tls and 25 for none by default",
+	"notify.email.tls":                      "SMTP connection security: starttls, tls or none",
+	"notify.email.username":                 "SMTP username",
+	"notify.email.password":                 "SMTP password",
+	"notify.email.from":                     "Sender address of run notification emails",
+	"notify.email.to":                       "Recipients of run notification emails",
+	"notify.email.failures-only":            "Only email the notifications of failed runs",
+	"notify.email.min-severity":             "Lowest severity emailed: change or failure",
+	"notify.email.quiet-hours.open":         "Cron schedule beginning the quiet hours of emails",
+	"notify.email.quiet-hours.close":        "Cron schedule ending the quiet hours of emails",
+	"notify.email.quiet-hours.min-severity": "Lowest severity emailed during quiet hours: failure or none",
+	"metrics.namespace":                     "Prefix of every metric name served at /metrics",
+	"metrics.labels":                        "Constant labels added to every metric, e.g. env=production,firewall=web",
+	"metrics.source-labels":                 "Break address counts down by source; false exports a single series",
+	"invites.signing-key":                   "Secret signing one-time invite links, at least 32 characters",
+	"invites.port":                          "Default port of new invites",
+	"invites.ttl":                           "How long a redeemed invite keeps the visitor's IP allowed",
+	"invites.valid-for":                     "How long an invite link can be redeemed after it was created",
+	"self-service.provider":                 "Identity provider of the self-service allow endpoint (google, github, oidc)",
+	"self-service.policies":                 `Self-service policies as JSON, e.g. '[{"users":["*@example.com"],"ports":[22],"max-ttl":"8h"}]'`,
+	"self-service.client-id":                "OAuth client ID registered with the self-service identity provider",
+	"self-service.client-secret":            "OAuth client secret registered with the self-service identity provider",
+	"self-service.auth-url":                 "Authorization endpoint of the oidc provider",
+	"self-service.token-url":                "Token endpoint of the oidc provider",
+	"self-service.userinfo-url":             "Userinfo endpoint of the oidc provider",
+	"self-service.session-key":              "Secret signing the session cookies of signed-in users, at least 32 characters",
+	"publish.endpoint":                      "Spaces/S3 endpoint receiving every changed allowlist, e.g. https://nyc3.digitaloceanspaces.com",
+	"publish.region":                        "Region of the publish bucket; Spaces accepts us-east-1 for every region",
+	"publish.bucket":                        "Bucket receiving the published allowlists",
+	"publish.prefix":                        "Key prefix of the published allowlists",
+	"publish.access-key":                    "Access key of the publish bucket",
+	"publish.secret-key":                    "Secret key of the publish bucket",
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// RegisterFlags registers a flag for every configuration field, named after its dotted koanf
+// path; lists of objects such as inbound rules take JSON
+func RegisterFlags(flags *pflag.FlagSet) {
+	walkConfig(reflect.TypeOf(Config{}), "", func(path string, t reflect.Type) {
+		usage, ok := flagUsage[path]
+		if !ok {
+			usage = fmt.Sprintf("Override %s", path)
+		}
+
+		switch {
+		case t == durationType:
+			flags.Duration(path, 0, usage)
+		case t.Kind() == reflect.String:
+			flags.String(path, "", usage)
+		case t.Kind() == reflect.Bool:
+			flags.Bool(path, false, usage)
+		case t.Kind() == reflect.Int:
+			flags.Int(path, 0, usage)
+		case t.Kind() == reflect.Map && t.Elem().Kind() == reflect.String:
+			flags.StringToString(path, nil, usage)
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+			flags.StringSlice(path, nil, usage)
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Int:
+			flags.IntSlice(path, nil, usage)
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct:
+			flags.String(path, "", usage)
+		}
+	})
+}
+
+// walkConfig calls fn with the dotted koanf path and type of every non-struct field of t
+func walkConfig(t reflect.Type, prefix string, fn func(path string, t reflect.Type)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("koanf")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			walkConfig(field.Type, prefix+name+".", fn)
+			continue
+		}
+		fn(prefix+name, field.Type)
+	}
+}
+
+// loadFlags loads the changed flags over the loader, decoding JSON values for lists of objects
+func loadFlags(loader *koanf.Koanf, flags *pflag.FlagSet) error {
+	var flagErr error
+	provider := posflag.ProviderWithFlag(flags, ".", loader, func(f *pflag.Flag) (string, interface{}) {
+		// Flags carry no defaults of their own, so an unchanged flag never overrides another source
+		if !f.Changed {
+			return "", nil
+		}
+
+		if envJSONKeys[f.Name] {
+			parsed, err := envValue(f.Name, f.Value.String())
+			if err != nil && flagErr == nil {
+				flagErr = fmt.Errorf("invalid value for --%s: %w", f.Name, err)
+			}
+			return f.Name, parsed
+		}
+		return f.Name, posflag.FlagVal(flags, f)
+	})
+
+	if err := loader.Load(provider, nil); err != nil {
+		return err
+	}
+	return flagErr
+}
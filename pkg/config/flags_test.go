@@ -0,0 +1,245 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/spf13/pflag"
+)
+
+func TestRegisterFlags(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(flags)
+
+	expected := map[string]string{
+		"log-level":                          "string",
+		"read-only":                          "bool",
+		"digitalocean.inbound-rules":         "string",
+		"netdata.domains":                    "stringSlice",
+		"safety.admin-ports":                 "intSlice",
+		"logging.levels":                     "stringToString",
+		"logging.sampling.tick":              "duration",
+		"confirmation.max-removed-addresses": "int",
+	}
+	for name, typ := range expected {
+		f := flags.Lookup(name)
+		if f == nil {
+			t.Errorf("expected flag --%s to be registered", name)
+			continue
+		}
+		if f.Value.Type() != typ {
+			t.Errorf("expected flag --%s to be of type %s, got %s", name, typ, f.Value.Type())
+		}
+	}
+}
+
+func TestFlagUsage(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(flags)
+
+	flags.VisitAll(func(f *pflag.Flag) {
+		if _, ok := flagUsage[f.Name]; !ok {
+			t.Errorf("expected flag --%s to have help text in flagUsage, got %q", f.Name, f.Usage)
+		}
+	})
+}
+
+func TestLoadGeneratedFlags(t *testing.T) {
+	k = koanf.New(".")
+	SetDefaults()
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(flags)
+	args := []string{
+		"--digitalocean.api-key=flag-api-key",
+		"--digitalocean.firewall-id=flag-firewall-id",
+		`--digitalocean.inbound-rules=[{"port":443,"protocol":"tcp"}]`,
+		"--netdata.domains=app.netdata.cloud,api.netdata.cloud",
+		"--safety.admin-ports=22,2222",
+		"--logging.levels=scheduler=DEBUG",
+		"--lock.timeout=1m",
+	}
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	cfg, err := Load("", flags)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.DigitalOcean.InboundRules) != 1 || cfg.DigitalOcean.InboundRules[0].Port != 443 {
+		t.Errorf("expected inbound rules from flag, got %+v", cfg.DigitalOcean.InboundRules)
+	}
+	if len(cfg.Netdata.Domains) != 2 {
+		t.Errorf("expected two domains from flag, got %v", cfg.Netdata.Domains)
+	}
+	if len(cfg.Safety.AdminPorts) != 2 || cfg.Safety.AdminPorts[1] != 2222 {
+		t.Errorf("expected admin ports from flag, got %v", cfg.Safety.AdminPorts)
+	}
+	if cfg.Logging.Levels["scheduler"] != "DEBUG" {
+		t.Errorf("expected module level from flag, got %v", cfg.Logging.Levels)
+	}
+	if cfg.Lock.Timeout != time.Minute {
+		t.Errorf("expected lock timeout from flag, got %s", cfg.Lock.Timeout)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		envVars  map[string]string
+		args     []string
+		validate func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "file overrides defaults",
+			validate: func(t *testing.T, cfg *Config) {
+				if cfg.LogLevel != "WARN" {
+					t.Errorf("expected log level WARN from file, got %s", cfg.LogLevel)
+				}
+				if cfg.Cron.Timezone != "UTC" {
+					t.Errorf("expected default timezone UTC, got %s", cfg.Cron.Timezone)
+				}
+				if cfg.Logging.Sampling.Initial != 10 || cfg.Logging.Sampling.Tick != time.Second {
+					t.Errorf("expected nested file values merged over defaults, got %+v", cfg.Logging.Sampling)
+				}
+			},
+		},
+		{
+			name: "env overrides file",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_LOG_LEVEL":                          "DEBUG",
+				"FIREWALL_ALLOWLISTER_LOGGING_SAMPLING_INITIAL":           "50",
+				"FIREWALL_ALLOWLISTER_CONFIRMATION_MAX_REMOVED_ADDRESSES": "7",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				if cfg.LogLevel != "DEBUG" {
+					t.Errorf("expected log level DEBUG from env, got %s", cfg.LogLevel)
+				}
+				if cfg.Logging.Sampling.Initial != 50 {
+					t.Errorf("expected nested sampling.initial 50 from env, got %d", cfg.Logging.Sampling.Initial)
+				}
+				if cfg.Logging.Sampling.Thereafter != 20 {
+					t.Errorf("expected sibling sampling.thereafter 20 kept from file, got %d", cfg.Logging.Sampling.Thereafter)
+				}
+				if cfg.Confirmation.MaxRemovedAddresses != 7 {
+					t.Errorf("expected max removed addresses 7 from env, got %d", cfg.Confirmation.MaxRemovedAddresses)
+				}
+			},
+		},
+		{
+			name: "flags override env",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_LOG_LEVEL":                "DEBUG",
+				"FIREWALL_ALLOWLISTER_LOGGING_SAMPLING_INITIAL": "50",
+			},
+			args: []string{"--log-level=ERROR", "--logging.sampling.initial=99"},
+			validate: func(t *testing.T, cfg *Config) {
+				if cfg.LogLevel != "ERROR" {
+					t.Errorf("expected log level ERROR from flag, got %s", cfg.LogLevel)
+				}
+				if cfg.Logging.Sampling.Initial != 99 {
+					t.Errorf("expected nested sampling.initial 99 from flag, got %d", cfg.Logging.Sampling.Initial)
+				}
+			},
+		},
+		{
+			name: "unchanged flags do not override",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_LOG_LEVEL": "DEBUG",
+			},
+			args: []string{"--digitalocean.firewall-id=flag-firewall-id"},
+			validate: func(t *testing.T, cfg *Config) {
+				if cfg.LogLevel != "DEBUG" {
+					t.Errorf("expected log level DEBUG from env, got %s", cfg.LogLevel)
+				}
+				if !cfg.ReadOnly {
+					t.Errorf("expected read-only true from file")
+				}
+				if cfg.Confirmation.MaxRemovedAddresses != 5 {
+					t.Errorf("expected max removed addresses 5 from file, got %d", cfg.Confirmation.MaxRemovedAddresses)
+				}
+				if len(cfg.Netdata.Domains) != 1 || cfg.Netdata.Domains[0] != "file.example.com" {
+					t.Errorf("expected domains from file, got %v", cfg.Netdata.Domains)
+				}
+				if cfg.DigitalOcean.APIKey != "file-api-key" {
+					t.Errorf("expected api key from file, got %s", cfg.DigitalOcean.APIKey)
+				}
+			},
+		},
+		{
+			name: "explicit zero value flags override",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_CONFIRMATION_MAX_REMOVED_ADDRESSES": "7",
+			},
+			args: []string{"--read-only=false", "--confirmation.max-removed-addresses=0"},
+			validate: func(t *testing.T, cfg *Config) {
+				if cfg.ReadOnly {
+					t.Errorf("expected read-only false from flag")
+				}
+				if cfg.Confirmation.MaxRemovedAddresses != 0 {
+					t.Errorf("expected max removed addresses 0 from flag, got %d", cfg.Confirmation.MaxRemovedAddresses)
+				}
+			},
+		},
+		{
+			name: "list flags replace file lists",
+			envVars: map[string]string{
+				"FIREWALL_ALLOWLISTER_NETDATA_DOMAINS": "env.example.com",
+			},
+			args: []string{
+				"--netdata.domains=flag.example.com",
+				`--digitalocean.inbound-rules=[{"port":443,"protocol":"tcp"},{"port":8443,"protocol":"tcp"}]`,
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				if len(cfg.Netdata.Domains) != 1 || cfg.Netdata.Domains[0] != "flag.example.com" {
+					t.Errorf("expected domains from flag, got %v", cfg.Netdata.Domains)
+				}
+				if len(cfg.DigitalOcean.InboundRules) != 2 || cfg.DigitalOcean.InboundRules[0].Port != 443 {
+					t.Errorf("expected inbound rules from flag, got %+v", cfg.DigitalOcean.InboundRules)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k = koanf.New(".")
+			SetDefaults()
+
+			for key, value := range tt.envVars {
+				t.Setenv(key, value)
+			}
+
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			RegisterFlags(flags)
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("failed to parse flags: %v", err)
+			}
+
+			cfg, err := Load("testdata/precedence_config.yaml", flags)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.validate(t, cfg)
+		})
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	tests := map[string]string{
+		"FIREWALL_ALLOWLISTER_LOG_LEVEL":                          "log-level",
+		"FIREWALL_ALLOWLISTER_READ_ONLY":                          "read-only",
+		"FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY":               "digitalocean.api-key",
+		"FIREWALL_ALLOWLISTER_LOGGING_SAMPLING_INITIAL":           "logging.sampling.initial",
+		"FIREWALL_ALLOWLISTER_CONFIRMATION_MAX_REMOVED_ADDRESSES": "confirmation.max-removed-addresses",
+		"FIREWALL_ALLOWLISTER_UNKNOWN_SOME_KEY":                   "unknown.some-key",
+	}
+	for env, expected := range tests {
+		if got := envKey(env); got != expected {
+			t.Errorf("envKey(%s) = %s, want %s", env, got, expected)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// MigratePort rewrites the ports of a configuration file's inbound rules for the firewall from
+// from to to, and of its dynamic-dns entries when primary is set because they only apply to
+// firewall-id; comments are kept, and the rewritten file and the number of changed ports are
+// returned
+func MigratePort(data []byte, firewallID string, primary bool, from, to int) ([]byte, int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse configuration file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return data, 0, nil
+	}
+
+	digitalOcean := mappingValue(doc.Content[0], "digitalocean")
+	if digitalOcean == nil {
+		return data, 0, nil
+	}
+
+	changed := 0
+	if primary {
+		changed += migrateListPorts(mappingValue(digitalOcean, "inbound-rules"), from, to)
+		changed += migrateListPorts(mappingValue(digitalOcean, "dynamic-dns"), from, to)
+	}
+	if firewalls := mappingValue(digitalOcean, "firewalls"); firewalls != nil && firewalls.Kind == yaml.SequenceNode {
+		for _, firewall := range firewalls.Content {
+			if id := mappingValue(firewall, "id"); id != nil && id.Value == firewallID {
+				changed += migrateListPorts(mappingValue(firewall, "inbound-rules"), from, to)
+			}
+		}
+	}
+	if changed == 0 {
+		return data, 0, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, 0, fmt.Errorf("failed to encode configuration file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, 0, fmt.Errorf("failed to encode configuration file: %w", err)
+	}
+	return buf.Bytes(), changed, nil
+}
+
+// migrateListPorts rewrites the port keys of a sequence of mappings from from to to
+func migrateListPorts(list *yaml.Node, from, to int) int {
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return 0
+	}
+
+	changed := 0
+	for _, item := range list.Content {
+		port := mappingValue(item, "port")
+		if port == nil || port.Kind != yaml.ScalarNode {
+			continue
+		}
+		if value, err := strconv.Atoi(port.Value); err == nil && value == from {
+			port.Value = strconv.Itoa(to)
+			port.Tag = "!!int"
+			port.Style = 0
+			changed++
+		}
+	}
+	return changed
+}
+
+// mappingValue returns the value of a key of a mapping node, nil if absent or not a mapping
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
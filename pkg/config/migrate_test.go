@@ -0,0 +1,85 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const migrateTestConfig = `digitalocean:
+  firewall-id: "web-firewall"
+  # SSH moves to 22022 next quarter
+  inbound-rules:
+    - port: 2222
+      protocol: tcp
+    - port: 443
+      protocol: tcp
+  dynamic-dns:
+    - hostname: home.example.com
+      port: 2222
+  firewalls:
+    - id: "edge-firewall"
+      inbound-rules:
+        - port: 2222
+          protocol: tcp
+`
+
+func TestMigratePort(t *testing.T) {
+	tests := []struct {
+		name        string
+		firewallID  string
+		primary     bool
+		wantChanged int
+		wantPorts   []string
+	}{
+		{
+			name:        "firewall-id",
+			firewallID:  "web-firewall",
+			primary:     true,
+			wantChanged: 2,
+			wantPorts:   []string{"22022", "443", "22022", "2222"},
+		},
+		{
+			name:        "further firewall",
+			firewallID:  "edge-firewall",
+			wantChanged: 1,
+			wantPorts:   []string{"2222", "443", "2222", "22022"},
+		},
+		{
+			name:        "unknown firewall",
+			firewallID:  "other-firewall",
+			wantChanged: 0,
+			wantPorts:   []string{"2222", "443", "2222", "2222"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, changed, err := MigratePort([]byte(migrateTestConfig), tt.firewallID, tt.primary, 2222, 22022)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("expected %d changed ports, got %d", tt.wantChanged, changed)
+			}
+
+			var ports []string
+			for _, line := range strings.Split(string(data), "\n") {
+				if value, ok := strings.CutPrefix(strings.TrimLeft(line, " -"), "port: "); ok {
+					ports = append(ports, value)
+				}
+			}
+			if strings.Join(ports, ",") != strings.Join(tt.wantPorts, ",") {
+				t.Errorf("expected ports %v, got %v in\n%s", tt.wantPorts, ports, data)
+			}
+			if !strings.Contains(string(data), "# SSH moves to 22022 next quarter") {
+				t.Errorf("expected comments to be kept, got\n%s", data)
+			}
+		})
+	}
+}
+
+func TestMigratePortInvalid(t *testing.T) {
+	if _, _, err := MigratePort([]byte("digitalocean: [unclosed"), "web-firewall", true, 2222, 22022); err == nil {
+		t.Error("expected an error for an invalid configuration file")
+	}
+}
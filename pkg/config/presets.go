@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Preset is a built-in combination of inbound rules and source settings for a common setup
+type Preset struct {
+	Description  string
+	InboundRules []InboundRule
+	// NetdataDomains are resolved as sources unless netdata.domains is configured
+	NetdataDomains []string
+	// AdminPorts are added to safety.admin-ports so updates cannot lock operators out of them
+	AdminPorts []int
+}
+
+// Presets are the built-in presets selectable by name under presets
+var Presets = map[string]Preset{
+	"cloudflare-web": {
+		Description:  "HTTP and HTTPS from Cloudflare's proxy ranges",
+		InboundRules: []InboundRule{{Port: 80, Protocol: "tcp"}, {Port: 443, Protocol: "tcp"}},
+	},
+	"netdata-monitoring": {
+		Description:    "Netdata agent dashboard from Netdata Cloud",
+		InboundRules:   []InboundRule{{Port: 19999, Protocol: "tcp"}},
+		NetdataDomains: []string{"app.netdata.cloud", "api.netdata.cloud", "mqtt.netdata.cloud"},
+	},
+	"ssh-admin": {
+		// SSH is opened per operator by allow-current-ip and access requests, never to the shared
+		// sources, so the preset only protects it
+		Description: "Self-lockout protection for SSH managed with allow-current-ip",
+		AdminPorts:  []int{22},
+	},
+}
+
+// PresetNames returns the names of the built-in presets in alphabetical order
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPresets expands the selected presets into the configuration; explicitly configured rules
+// and settings take precedence over what a preset provides
+func applyPresets(config *Config) error {
+	for _, name := range config.Presets {
+		preset, ok := Presets[name]
+		if !ok {
+			return fmt.Errorf("unknown preset %s (available: %s)", name, strings.Join(PresetNames(), ", "))
+		}
+
+		for _, rule := range preset.InboundRules {
+			if !hasInboundRule(config.DigitalOcean.InboundRules, rule.Port) {
+				config.DigitalOcean.InboundRules = append(config.DigitalOcean.InboundRules, rule)
+			}
+		}
+
+		if len(config.Netdata.Domains) == 0 {
+			config.Netdata.Domains = append(config.Netdata.Domains, preset.NetdataDomains...)
+		}
+
+		for _, port := range preset.AdminPorts {
+			if !containsInt(config.Safety.AdminPorts, port) {
+				config.Safety.AdminPorts = append(config.Safety.AdminPorts, port)
+			}
+		}
+	}
+	return nil
+}
+
+// hasInboundRule reports whether a rule for the port is already configured
+func hasInboundRule(rules []InboundRule, port int) bool {
+	for _, rule := range rules {
+		if rule.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt reports whether values contains v
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
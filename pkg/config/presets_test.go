@@ -0,0 +1,88 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+)
+
+func TestApplyPresets(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		expectRules   []InboundRule
+		expectDomains []string
+		expectPorts   []int
+		expectError   bool
+	}{
+		{
+			name:          "expands every selected preset",
+			config:        Config{Presets: []string{"cloudflare-web", "netdata-monitoring", "ssh-admin"}},
+			expectRules:   []InboundRule{{Port: 80, Protocol: "tcp"}, {Port: 443, Protocol: "tcp"}, {Port: 19999, Protocol: "tcp"}},
+			expectDomains: []string{"app.netdata.cloud", "api.netdata.cloud", "mqtt.netdata.cloud"},
+			expectPorts:   []int{22},
+		},
+		{
+			name: "configured rules and settings take precedence",
+			config: Config{
+				Presets:      []string{"cloudflare-web", "netdata-monitoring", "ssh-admin"},
+				DigitalOcean: DigitalOceanConfig{InboundRules: []InboundRule{{Port: 443, Protocol: "tcp+udp"}}},
+				Netdata:      NetdataConfig{Domains: []string{"custom.example.com"}},
+				Safety:       SafetyConfig{AdminPorts: []int{22, 2222}},
+			},
+			expectRules:   []InboundRule{{Port: 443, Protocol: "tcp+udp"}, {Port: 80, Protocol: "tcp"}, {Port: 19999, Protocol: "tcp"}},
+			expectDomains: []string{"custom.example.com"},
+			expectPorts:   []int{22, 2222},
+		},
+		{
+			name:        "unknown preset",
+			config:      Config{Presets: []string{"wordpress"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config
+			err := applyPresets(&cfg)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cfg.DigitalOcean.InboundRules, tt.expectRules) {
+				t.Errorf("expected rules %+v, got %+v", tt.expectRules, cfg.DigitalOcean.InboundRules)
+			}
+			if !reflect.DeepEqual(cfg.Netdata.Domains, tt.expectDomains) {
+				t.Errorf("expected domains %v, got %v", tt.expectDomains, cfg.Netdata.Domains)
+			}
+			if !reflect.DeepEqual(cfg.Safety.AdminPorts, tt.expectPorts) {
+				t.Errorf("expected admin ports %v, got %v", tt.expectPorts, cfg.Safety.AdminPorts)
+			}
+		})
+	}
+}
+
+func TestLoadPresetsFromEnv(t *testing.T) {
+	k = koanf.New(".")
+	SetDefaults()
+
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_API_KEY", "env-api-key")
+	t.Setenv("FIREWALL_ALLOWLISTER_DIGITALOCEAN_FIREWALL_ID", "env-firewall-id")
+	t.Setenv("FIREWALL_ALLOWLISTER_PRESETS", "cloudflare-web, ssh-admin")
+
+	cfg, err := Load("", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.DigitalOcean.InboundRules) != 2 || len(cfg.Safety.AdminPorts) != 1 {
+		t.Errorf("expected presets applied from env, got rules %+v and admin ports %v",
+			cfg.DigitalOcean.InboundRules, cfg.Safety.AdminPorts)
+	}
+}
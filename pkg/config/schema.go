@@ -0,0 +1,350 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+	"github.com/knadh/koanf/parsers/yaml"
+)
+
+// schemaDialect is the JSON Schema version the configuration schema is written in
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the durations accepted by time.ParseDuration, e.g. 30s or 1h30m
+const durationPattern = `^(0|-?(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+)$`
+
+// Schema is the subset of JSON Schema describing the configuration file
+type Schema struct {
+	Dialect     string             `json:"$schema,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties is the schema of map values, or false for objects with fixed properties
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	Required             []string    `json:"required,omitempty"`
+	Items                *Schema     `json:"items,omitempty"`
+	Enum                 []string    `json:"enum,omitempty"`
+	Pattern              string      `json:"pattern,omitempty"`
+	OneOf                []*Schema   `json:"oneOf,omitempty"`
+	Default              interface{} `json:"default,omitempty"`
+}
+
+// schemaEnums are the values accepted by string fields, or by the items of string lists, limited
+// to a fixed set; an empty value leaves the feature disabled
+var schemaEnums = map[string][]string{
+	"log-output":                      {"stderr", "syslog", "journald"},
+	"logging.syslog.network":          {"udp", "tcp", "unix", "unixgram"},
+	"logging.ship.format":             {"", "gelf", "logstash"},
+	"logging.ship.network":            {"tcp", "udp"},
+	"presets":                         PresetNames(),
+	"sources.http.format":             {"json", "lines", "csv"},
+	"safety.reserved-sources":         {"drop", "keep", "fail"},
+	"cloudflare.on-failure":           onFailurePolicies,
+	"netdata.on-failure":              onFailurePolicies,
+	"sources.http.on-failure":         onFailurePolicies,
+	"sources.google.on-failure":       onFailurePolicies,
+	"sources.probes.on-failure":       onFailurePolicies,
+	"sources.dns.on-failure":          onFailurePolicies,
+	"sources.address-family":          {sources.FamilyIPv4, sources.FamilyIPv6, sources.FamilyBoth},
+	"cloudflare.address-family":       addressFamilies,
+	"netdata.address-family":          addressFamilies,
+	"sources.http.address-family":     addressFamilies,
+	"sources.google.address-family":   addressFamilies,
+	"sources.probes.address-family":   addressFamilies,
+	"sources.dns.address-family":      addressFamilies,
+	"sources.networks.address-family": addressFamilies,
+	"signing.format":                  {"", "minisign", "cosign"},
+	"audit.ship.type":                 {"", "splunk", "elastic", "https"},
+	"self-service.provider":           {"", "google", "github", "oidc"},
+}
+
+// onFailurePolicies are the on-failure values of a source, abort when empty
+var onFailurePolicies = []string{"", OnFailureAbort, OnFailureSkip, OnFailureUseCached}
+
+// addressFamilies are the address-family values of a source, sources.address-family when empty
+var addressFamilies = []string{"", sources.FamilyIPv4, sources.FamilyIPv6, sources.FamilyBoth}
+
+var inboundRuleType = reflect.TypeOf(InboundRule{})
+
+// NewSchema generates the JSON Schema of the configuration file from the Config struct, for
+// editors and CI to validate configuration files against
+func NewSchema() *Schema {
+	schema := objectSchema(reflect.TypeOf(Config{}), "")
+	schema.Dialect = schemaDialect
+	schema.Title = "do-firewall-allowlister configuration"
+
+	// Tenants take every setting except the tenant selection, plus their name
+	tenant := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+		Required:             []string{"name"},
+	}
+	for name, property := range schema.Properties {
+		if name != "tenant" {
+			tenant.Properties[name] = property
+		}
+	}
+	tenant.Properties["name"] = &Schema{
+		Type:        "string",
+		Description: "Name of the tenant, used in logger names, metric labels and file names",
+		Pattern:     tenantNamePattern.String(),
+	}
+	schema.Properties["tenants"] = &Schema{
+		Type:        "array",
+		Description: "Teams managed by one deployment, each overriding the top-level settings",
+		Items:       tenant,
+	}
+	return schema
+}
+
+// objectSchema describes a struct by the koanf tags of its fields, prefix being its dotted path
+func objectSchema(t reflect.Type, prefix string) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("koanf")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+
+		property := typeSchema(field.Type, path)
+		if t == inboundRuleType && name == "protocol" {
+			property = protocolSchema()
+		}
+		// The usage of list and map flags describes their command line syntax rather than YAML's
+		if kind := field.Type.Kind(); kind != reflect.Slice && kind != reflect.Map {
+			property.Description = flagUsage[path]
+		}
+		if values, ok := schemaEnums[path]; ok {
+			if property.Items != nil {
+				property.Items.Enum = values
+			} else {
+				property.Enum = values
+			}
+		}
+		if value, ok := defaultValues[path]; ok {
+			property.Default = value
+		}
+		schema.Properties[name] = property
+	}
+	return schema
+}
+
+// typeSchema describes a field type; the items of lists of structs share the list's path
+func typeSchema(t reflect.Type, path string) *Schema {
+	switch {
+	case t == durationType:
+		return &Schema{Type: "string", Pattern: durationPattern}
+	case t.Kind() == reflect.Struct:
+		return objectSchema(t, path+".")
+	case t.Kind() == reflect.Slice:
+		return &Schema{Type: "array", Items: typeSchema(t.Elem(), path)}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), path)}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() == reflect.Int:
+		return &Schema{Type: "integer"}
+	default:
+		return &Schema{Type: "string"}
+	}
+}
+
+// protocolSchema accepts an inbound rule protocol as tcp, as tcp+udp or as a list like [tcp, udp]
+func protocolSchema() *Schema {
+	return &Schema{OneOf: []*Schema{
+		{Type: "string", Pattern: `^(tcp|udp|icmp)(\+(tcp|udp|icmp))*$`},
+		{Type: "array", Items: &Schema{Type: "string", Enum: []string{"tcp", "udp", "icmp"}}},
+	}}
+}
+
+// checkConfigFile checks the config file against the schema, reporting every problem at once
+func checkConfigFile(configFile string) error {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", configFile, err)
+	}
+	raw, err := yaml.Parser().Unmarshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", configFile, err)
+	}
+
+	problems := NewSchema().check("", raw)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("config file %s does not match the schema:\n  %s", configFile, strings.Join(problems, "\n  "))
+}
+
+// check returns a problem for every value under path that does not match the schema; empty
+// values are accepted everywhere since they leave the default in place
+func (s *Schema) check(path string, value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+
+	if len(s.OneOf) > 0 {
+		types := make([]string, 0, len(s.OneOf))
+		for _, option := range s.OneOf {
+			if option.Type == jsonType(value) {
+				return option.check(path, value)
+			}
+			types = append(types, option.Type)
+		}
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(value))}
+	}
+
+	if got := jsonType(value); got != s.Type {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, s.Type, got)}
+	}
+
+	switch s.Type {
+	case "object":
+		fields := value.(map[string]interface{})
+		var problems []string
+		for _, key := range slices.Sorted(maps.Keys(fields)) {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+
+			property, ok := s.Properties[key]
+			if !ok {
+				additional, ok := s.AdditionalProperties.(*Schema)
+				if !ok {
+					problems = append(problems, unknownKey(keyPath, key, s.Properties))
+					continue
+				}
+				property = additional
+			}
+			problems = append(problems, property.check(keyPath, fields[key])...)
+		}
+		for _, key := range s.Required {
+			if _, ok := fields[key]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required key %s", path, key))
+			}
+		}
+		return problems
+	case "array":
+		var problems []string
+		for i, item := range value.([]interface{}) {
+			problems = append(problems, s.Items.check(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+		return problems
+	case "string":
+		text := value.(string)
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, text) {
+			choices := slices.DeleteFunc(slices.Clone(s.Enum), func(choice string) bool { return choice == "" })
+			last := len(choices) - 1
+			return []string{fmt.Sprintf("%s: invalid value %q (must be %s or %s)", path, text,
+				strings.Join(choices[:last], ", "), choices[last])}
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(text) {
+			if s.Pattern == durationPattern {
+				return []string{fmt.Sprintf("%s: invalid duration %q (e.g. 30s or 1h30m)", path, text)}
+			}
+			return []string{fmt.Sprintf("%s: invalid value %q", path, text)}
+		}
+	}
+	return nil
+}
+
+// jsonType names the JSON Schema type of a value parsed from YAML
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// unknownKey reports a key the schema does not know, suggesting the key it most likely meant
+func unknownKey(path, key string, properties map[string]*Schema) string {
+	if suggestion := suggestKey(key, properties); suggestion != "" {
+		return fmt.Sprintf("%s: unknown key, did you mean %s?", path, suggestion)
+	}
+	return fmt.Sprintf("%s: unknown key", path)
+}
+
+// suggestKey returns the known key closest to a mistyped one, such as api-key for api_key or
+// apiKey, or empty when none is within two edits
+func suggestKey(key string, properties map[string]*Schema) string {
+	normalized := kebabCase(key)
+	if _, ok := properties[normalized]; ok {
+		return normalized
+	}
+
+	best, bestDistance := "", 3
+	for _, name := range slices.Sorted(maps.Keys(properties)) {
+		if distance := editDistance(normalized, name); distance < bestDistance {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+// kebabCase rewrites camelCase and snake_case keys to the dashed form of configuration keys
+func kebabCase(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case r == '_':
+			b.WriteRune('-')
+		case unicode.IsUpper(r):
+			if i > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current := make([]int, len(br)+1)
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(br)]
+}
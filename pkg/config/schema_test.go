@@ -0,0 +1,186 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+)
+
+func TestNewSchema(t *testing.T) {
+	schema := NewSchema()
+
+	// Every configuration field is described
+	walkConfig(reflect.TypeOf(Config{}), "", func(path string, _ reflect.Type) {
+		property := schema
+		for _, name := range strings.Split(path, ".") {
+			if property = property.Properties[name]; property == nil {
+				t.Errorf("expected schema to describe %s", path)
+				return
+			}
+		}
+	})
+
+	rules := schema.Properties["digitalocean"].Properties["inbound-rules"]
+	if rules.Type != "array" || rules.Items.AdditionalProperties != false {
+		t.Errorf("expected inbound rules to be a list of closed objects, got %+v", rules)
+	}
+	if protocol := rules.Items.Properties["protocol"]; len(protocol.OneOf) != 2 {
+		t.Errorf("expected protocol to accept a string or a list, got %+v", protocol)
+	}
+	if ttl := schema.Properties["invites"].Properties["ttl"]; ttl.Type != "string" || ttl.Pattern != durationPattern || ttl.Default != "8h" {
+		t.Errorf("expected invites.ttl to be a duration defaulting to 8h, got %+v", ttl)
+	}
+	if labels := schema.Properties["metrics"].Properties["labels"]; labels.AdditionalProperties.(*Schema).Type != "string" {
+		t.Errorf("expected metrics.labels to map names to strings, got %+v", labels)
+	}
+	if presets := schema.Properties["presets"]; !reflect.DeepEqual(presets.Items.Enum, PresetNames()) {
+		t.Errorf("expected presets to be limited to the preset names, got %v", presets.Items.Enum)
+	}
+
+	tenant := schema.Properties["tenants"].Items
+	if tenant.Properties["name"] == nil || tenant.Properties["tenant"] != nil || tenant.Properties["cron"] == nil {
+		t.Errorf("expected tenants to take a name and the settings but tenant, got %v", tenant.Properties)
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	for _, path := range []string{
+		"testdata/valid_config.yaml",
+		"testdata/protocols_config.yaml",
+		"testdata/firewalls_config.yaml",
+		"testdata/tenants_config.yaml",
+	} {
+		if err := checkConfigFile(path); err != nil {
+			t.Errorf("expected %s to match the schema, got %v", path, err)
+		}
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		problems []string
+	}{
+		{
+			name: "valid",
+			config: `
+digitalocean:
+  api-key: "key"
+  firewall-id: "fw-1"
+  inbound-rules:
+    - {port: 443, protocol: [tcp, udp]}
+invites:
+  ttl: 1h30m
+netdata:
+`,
+		},
+		{
+			name: "unknown keys",
+			config: `
+logLevel: INFO
+digitalocean:
+  api_key: "key"
+  firewall-id: "fw-1"
+  firewal-ids: ["fw-2"]
+  colour: blue
+`,
+			problems: []string{
+				"digitalocean.api_key: unknown key, did you mean api-key?",
+				"digitalocean.colour: unknown key\n",
+				"digitalocean.firewal-ids: unknown key, did you mean firewall-id?",
+				"logLevel: unknown key, did you mean log-level?",
+			},
+		},
+		{
+			name: "mistyped values",
+			config: `
+log-output: file
+digitalocean:
+  api-key: "key"
+  firewall-id: "fw-1"
+  inbound-rules:
+    - {port: "443", protocol: tcp+sctp}
+    - {port: 22, protocol: 6}
+invites:
+  ttl: 8 hours
+metrics:
+  labels: {env: [production]}
+tenants:
+  - cron: {schedule: "0 * * * *"}
+`,
+			problems: []string{
+				"digitalocean.inbound-rules[0].port: expected integer, got string",
+				`digitalocean.inbound-rules[0].protocol: invalid value "tcp+sctp"`,
+				"digitalocean.inbound-rules[1].protocol: expected string or array, got integer",
+				`invites.ttl: invalid duration "8 hours"`,
+				`log-output: invalid value "file" (must be stderr, syslog or journald)`,
+				"metrics.labels.env: expected string, got array",
+				"tenants[0]: missing required key name",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k = koanf.New(".")
+			SetDefaults()
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte("strict: true\n"+tt.config), 0600); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			_, _, err := load(path, nil)
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error listing %v", tt.problems)
+			}
+			for _, problem := range tt.problems {
+				if !contains(err.Error()+"\n", problem) {
+					t.Errorf("expected error containing %q, got %v", problem, err)
+				}
+			}
+		})
+	}
+
+	// Without strict the file is loaded as before, ignoring unknown keys
+	k = koanf.New(".")
+	SetDefaults()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("digitalocean: {api-key: key, firewall-id: fw-1, colour: blue}\n"), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, _, err := load(path, nil); err != nil {
+		t.Errorf("unexpected error without strict: %v", err)
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	properties := NewSchema().Properties["digitalocean"].Properties
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: "api_key", expected: "api-key"},
+		{key: "inboundRules", expected: "inbound-rules"},
+		{key: "firewall-di", expected: "firewall-id"},
+		{key: "colour", expected: ""},
+	}
+
+	for _, tt := range tests {
+		if got := suggestKey(tt.key, properties); got != tt.expected {
+			t.Errorf("suggestKey(%s) = %q, expected %q", tt.key, got, tt.expected)
+		}
+	}
+}
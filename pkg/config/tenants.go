@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+)
+
+// Tenant is one team's complete configuration in a multi-tenant deployment: the top-level
+// settings overridden by the tenant's own
+type Tenant struct {
+	Name   string
+	Config *Config
+}
+
+// tenantNamePattern matches tenant names, which appear in logger names, metric labels and file names
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// tenantPrivateKeys identify or authenticate a tenant, so they are never inherited from the top level
+var tenantPrivateKeys = []string{
+	"server",
+	"health",
+	"admin",
+	"digitalocean.api-key",
+	"digitalocean.api-key-file",
+	"digitalocean.firewall-id",
+	"digest.webhook-url",
+	"invites.signing-key",
+	"self-service.client-secret",
+	"self-service.session-key",
+	"publish.endpoint",
+	"publish.bucket",
+	"publish.access-key",
+	"publish.secret-key",
+}
+
+// loadTenants builds the configuration of every entry in tenants by merging it over the
+// top-level settings, returning nil when no tenants are configured
+func loadTenants(loader *koanf.Koanf) ([]Tenant, error) {
+	if !loader.Exists("tenants") {
+		return nil, nil
+	}
+
+	entries, ok := loader.Get("tenants").([]interface{})
+	items := loader.Slices("tenants")
+	if !ok || len(items) != len(entries) {
+		return nil, fmt.Errorf("tenants must be a list of tenant settings")
+	}
+
+	tenants := make([]Tenant, 0, len(items))
+	names := make(map[string]bool)
+	firewalls := make(map[string]string)
+	addresses := make(map[string]string)
+	for i, item := range items {
+		name := item.String("name")
+		if !tenantNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid name %q for tenant %d (lowercase letters, numbers, dashes and underscores only)", name, i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate tenant name %s", name)
+		}
+		names[name] = true
+
+		cfg, err := loadTenant(loader, item, name)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", name, err)
+		}
+
+		// Tenants sharing a firewall or listener would undo each other's work
+		for _, target := range cfg.DigitalOcean.Targets() {
+			if other, ok := firewalls[target.ID]; ok {
+				return nil, fmt.Errorf("firewall %s is managed by both tenants %s and %s", target.ID, other, name)
+			}
+			firewalls[target.ID] = name
+		}
+		for _, address := range []string{cfg.Server.Address, cfg.Health.Address, cfg.Admin.Address} {
+			if address == "" {
+				continue
+			}
+			if other, ok := addresses[address]; ok {
+				return nil, fmt.Errorf("listen address %s is used by both tenants %s and %s", address, other, name)
+			}
+			addresses[address] = name
+		}
+
+		tenants = append(tenants, Tenant{Name: name, Config: cfg})
+	}
+	return tenants, nil
+}
+
+// loadTenant merges a tenant's settings over a copy of the top-level settings and validates them
+func loadTenant(loader *koanf.Koanf, item *koanf.Koanf, name string) (*Config, error) {
+	tk := loader.Copy()
+	tk.Delete("tenants")
+	tk.Delete("tenant")
+	for _, key := range tenantPrivateKeys {
+		tk.Delete(key)
+	}
+
+	for key, value := range item.Raw() {
+		if key == "name" {
+			continue
+		}
+		if key == "tenants" || key == "tenant" {
+			return nil, fmt.Errorf("tenants cannot be nested")
+		}
+		_ = tk.Set(key, value)
+	}
+
+	// Separate state files keep the tenants' stores from overwriting each other
+	if !item.Exists("state.path") {
+		_ = tk.Set("state.path", tenantStatePath(loader.String("state.path"), name))
+	}
+	_ = tk.Set("metrics.labels.tenant", name)
+	_ = tk.Set("logging.fields.tenant", name)
+	normalizeProtocolLists(tk)
+
+	var cfg Config
+	if err := tk.Unmarshal("", &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	cfg.Tenant = name
+
+	if err := applyPresets(&cfg); err != nil {
+		return nil, err
+	}
+	if err := readAPIKeyFile(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validate(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// tenantStatePath derives a tenant's state file from the top-level one, e.g. state.json -> state-acme.json
+func tenantStatePath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// selectTenant returns the configuration of the named tenant
+func selectTenant(tenants []Tenant, name string) (*Config, error) {
+	for _, tenant := range tenants {
+		if tenant.Name == name {
+			return tenant.Config, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown tenant %s", name)
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/spf13/pflag"
+)
+
+func TestLoadTenants(t *testing.T) {
+	k = koanf.New(".")
+	SetDefaults()
+
+	root, tenants, err := LoadTenants("testdata/tenants_config.yaml", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if root.LogLevel != "WARN" {
+		t.Errorf("expected top-level log level WARN, got %s", root.LogLevel)
+	}
+	if len(tenants) != 2 {
+		t.Fatalf("expected 2 tenants, got %d", len(tenants))
+	}
+
+	payments, search := tenants[0].Config, tenants[1].Config
+	if tenants[0].Name != "payments" || payments.Tenant != "payments" {
+		t.Errorf("expected first tenant payments, got %s", tenants[0].Name)
+	}
+
+	// Shared settings are inherited
+	if payments.Cron.Schedule != "0 * * * *" || payments.Cron.Timezone != "Europe/Berlin" {
+		t.Errorf("expected inherited cron settings, got %+v", payments.Cron)
+	}
+	if len(payments.DigitalOcean.InboundRules) != 1 || payments.DigitalOcean.InboundRules[0].Port != 443 {
+		t.Errorf("expected inherited inbound rules, got %+v", payments.DigitalOcean.InboundRules)
+	}
+	if payments.State.Path != "/var/lib/allowlister/state-payments.json" {
+		t.Errorf("expected derived state path, got %s", payments.State.Path)
+	}
+	if payments.Metrics.Labels["env"] != "production" || payments.Metrics.Labels["tenant"] != "payments" {
+		t.Errorf("expected inherited and tenant metrics labels, got %v", payments.Metrics.Labels)
+	}
+	if payments.Logging.Fields["tenant"] != "payments" {
+		t.Errorf("expected tenant logging field, got %v", payments.Logging.Fields)
+	}
+	if payments.Server.Address != "127.0.0.1:9101" {
+		t.Errorf("expected tenant server address, got %s", payments.Server.Address)
+	}
+
+	// Tenant settings override the shared ones
+	if search.Cron.Schedule != "30 * * * *" || search.Cron.Timezone != "Europe/Berlin" {
+		t.Errorf("expected overridden schedule with inherited timezone, got %+v", search.Cron)
+	}
+	if search.DigitalOcean.APIKey != "search-api-key" || search.DigitalOcean.FirewallID != "search-firewall" {
+		t.Errorf("expected tenant credentials, got %+v", search.DigitalOcean)
+	}
+	if len(search.DigitalOcean.InboundRules) != 1 || search.DigitalOcean.InboundRules[0].Protocol != "tcp+udp" {
+		t.Errorf("expected tenant inbound rules with normalized protocols, got %+v", search.DigitalOcean.InboundRules)
+	}
+	if len(search.Netdata.Domains) != 0 {
+		t.Errorf("expected tenant to clear netdata domains, got %v", search.Netdata.Domains)
+	}
+	if search.State.Path != "/var/lib/search/state.json" {
+		t.Errorf("expected tenant state path, got %s", search.State.Path)
+	}
+	if search.Server.Address != "" {
+		t.Errorf("expected server address not to be inherited, got %s", search.Server.Address)
+	}
+}
+
+func TestLoadTenantSelection(t *testing.T) {
+	k = koanf.New(".")
+	SetDefaults()
+
+	if _, err := Load("testdata/tenants_config.yaml", nil); err == nil || !contains(err.Error(), "select one with --tenant") {
+		t.Errorf("expected error asking for a tenant, got %v", err)
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(flags)
+	if err := flags.Parse([]string{"--tenant=search"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	cfg, err := Load("testdata/tenants_config.yaml", flags)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DigitalOcean.FirewallID != "search-firewall" {
+		t.Errorf("expected search tenant config, got firewall %s", cfg.DigitalOcean.FirewallID)
+	}
+
+	_, tenants, err := LoadTenants("testdata/tenants_config.yaml", flags)
+	if err != nil || len(tenants) != 1 || tenants[0].Name != "search" {
+		t.Errorf("expected only the selected tenant, got %+v (%v)", tenants, err)
+	}
+
+	t.Setenv("FIREWALL_ALLOWLISTER_TENANT", "unknown")
+	if _, err := Load("testdata/tenants_config.yaml", nil); err == nil || !contains(err.Error(), "unknown tenant") {
+		t.Errorf("expected unknown tenant error, got %v", err)
+	}
+}
+
+func TestLoadTenantsInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		tenants  string
+		errorMsg string
+	}{
+		{
+			name: "credentials are not inherited",
+			tenants: `
+  - name: payments
+    digitalocean:
+      firewall-id: "payments-firewall"`,
+			errorMsg: "tenant payments: digitalocean.api-key is required",
+		},
+		{
+			name: "invalid name",
+			tenants: `
+  - name: Payments Team
+    digitalocean:
+      api-key: "key"
+      firewall-id: "payments-firewall"`,
+			errorMsg: "invalid name",
+		},
+		{
+			name: "duplicate name",
+			tenants: `
+  - name: payments
+    digitalocean: {api-key: "key", firewall-id: "fw-1"}
+  - name: payments
+    digitalocean: {api-key: "key", firewall-id: "fw-2"}`,
+			errorMsg: "duplicate tenant name",
+		},
+		{
+			name: "shared firewall",
+			tenants: `
+  - name: payments
+    digitalocean: {api-key: "key", firewall-id: "fw-1"}
+  - name: search
+    digitalocean: {api-key: "key", firewall-id: "fw-1"}`,
+			errorMsg: "managed by both tenants payments and search",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k = koanf.New(".")
+			SetDefaults()
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			config := "digitalocean:\n  api-key: \"shared-api-key\"\ntenants:" + tt.tenants + "\n"
+			if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			_, _, err := LoadTenants(path, nil)
+			if err == nil || !contains(err.Error(), tt.errorMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestTenantStatePath(t *testing.T) {
+	tests := map[string]string{
+		"state.json":                 "state-acme.json",
+		"/var/lib/app/state.json":    "/var/lib/app/state-acme.json",
+		"/var/lib/app/state":         "/var/lib/app/state-acme",
+		"/var/lib/app.d/state.cache": "/var/lib/app.d/state-acme.cache",
+	}
+	for path, expected := range tests {
+		if got := tenantStatePath(path, "acme"); got != expected {
+			t.Errorf("tenantStatePath(%s) = %s, want %s", path, got, expected)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+	"go.uber.org/zap"
+)
+
+// startAdaptiveRefresh reruns the firewall update whenever the records resolved for the domains
+// expire by their TTLs, besides the runs of cron.schedule, until the daemon shuts down
+func (d *Daemon) startAdaptiveRefresh(job scheduler.JobFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	d.stopAdaptive = func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		d.refreshOnTTL(ctx, job)
+	}()
+}
+
+// refreshOnTTL waits for the resolved records to expire, no sooner than cron.min-interval after
+// the previous check, and runs the job once they have; records without a TTL never expire
+func (d *Daemon) refreshOnTTL(ctx context.Context, job scheduler.JobFunc) {
+	minInterval := d.config.Cron.MinInterval
+	for {
+		wait := minInterval
+		if expiry := d.service.DNSExpiry(); !expiry.IsZero() {
+			wait = max(expiry.Sub(d.clock.Now()), minInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(wait):
+		}
+
+		// A scheduled run may have resolved the records again in the meantime
+		expiry := d.service.DNSExpiry()
+		if expiry.IsZero() || d.clock.Now().Before(expiry) {
+			continue
+		}
+
+		d.logger.Info("Resolved DNS records expired, updating the firewalls", zap.Time("expired_at", expiry))
+		// A run that started finishes even if the daemon shuts down meanwhile, like scheduled runs
+		if err := job(context.WithoutCancel(ctx)); err != nil {
+			d.logger.Error("Adaptive firewall update failed", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// adminRulesPath is where the admin API lists and adds the rules managed at runtime
+const adminRulesPath = "/rules"
+
+// adminUpdateTimeout bounds the firewall update applying a rule added through the admin API
+const adminUpdateTimeout = 2 * time.Minute
+
+// AdminRuleRequest asks the admin API to add an inbound rule to a firewall, firewall-id when
+// FirewallID is empty
+type AdminRuleRequest struct {
+	FirewallID string `json:"firewall_id,omitempty"`
+	Port       int    `json:"port"`
+	Protocol   string `json:"protocol"`
+	AddedBy    string `json:"added_by,omitempty"`
+}
+
+// AdminRuleResponse describes a rule added through the admin API and the firewall update that
+// applied it; a failed update leaves the rule to the next scheduled run
+type AdminRuleResponse struct {
+	Rule    state.ManagedRule `json:"rule"`
+	Applied bool              `json:"applied"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// adminHandler serves GET /rules, the rules added at runtime, and POST /rules, adding a rule from
+// an AdminRuleRequest and updating the firewalls right away; every request needs admin.token
+func (d *Daemon) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+adminRulesPath, func(w http.ResponseWriter, r *http.Request) {
+		rules, err := d.service.ManagedRules()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rules == nil {
+			rules = []state.ManagedRule{}
+		}
+		writeJSON(w, http.StatusOK, rules, d.logger)
+	})
+	mux.HandleFunc("POST "+adminRulesPath, d.handleAddRule)
+
+	token := []byte(d.config.Admin.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), token) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="do-firewall-allowlister admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// handleAddRule persists the requested rule and applies it with an immediate firewall update
+func (d *Daemon) handleAddRule(w http.ResponseWriter, r *http.Request) {
+	var req AdminRuleRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid rule request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	rule := config.InboundRule{Port: req.Port, Protocol: req.Protocol}
+	if rule.Protocol == "" {
+		rule.Protocol = "tcp"
+	}
+	added, err := d.service.AddManagedRule(req.FirewallID, rule, req.AddedBy)
+	if errors.Is(err, service.ErrRuleManaged) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := AdminRuleResponse{Rule: *added, Applied: true}
+	ctx, cancel := context.WithTimeout(r.Context(), adminUpdateTimeout)
+	defer cancel()
+	if err := d.service.UpdateFirewallRules(ctx); err != nil {
+		d.logger.Error("Firewall update after adding a rule failed, the next scheduled run applies it",
+			zap.String("firewall_id", added.FirewallID),
+			zap.Int("port", added.Port),
+			zap.Error(err))
+		response.Applied = false
+		response.Error = err.Error()
+	}
+	writeJSON(w, http.StatusCreated, response, d.logger)
+}
+
+// writeJSON answers with value encoded as JSON
+func writeJSON(w http.ResponseWriter, code int, value interface{}, logger *zap.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Warn("Failed to write response", zap.Error(err))
+	}
+}
+
+// AdminClient calls the admin API of a running daemon
+type AdminClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewAdminClient returns a client of the admin API listening on address, as configured in
+// admin.address; wildcard and empty hosts are reached over the loopback interface
+func NewAdminClient(address, token string) (*AdminClient, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin.address %s: %w", address, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	return &AdminClient{
+		baseURL: "http://" + net.JoinHostPort(host, port),
+		token:   token,
+		// Adding a rule waits for the firewall update applying it
+		httpClient: &http.Client{Timeout: adminUpdateTimeout + 30*time.Second},
+	}, nil
+}
+
+// AddRule asks the daemon to add an inbound rule and apply it
+func (c *AdminClient) AddRule(ctx context.Context, req AdminRuleRequest) (*AdminRuleResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rule request: %w", err)
+	}
+
+	var response AdminRuleResponse
+	if err := c.do(ctx, http.MethodPost, bytes.NewReader(body), &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Rules returns the rules added to the daemon's firewalls at runtime
+func (c *AdminClient) Rules(ctx context.Context) ([]state.ManagedRule, error) {
+	var rules []state.ManagedRule
+	if err := c.do(ctx, http.MethodGet, nil, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// do sends an authenticated request to the rules endpoint and decodes the JSON answer into result
+func (c *AdminClient) do(ctx context.Context, method string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+adminRulesPath, body)
+	if err != nil {
+		return fmt.Errorf("failed to create admin API request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the daemon admin API at %s: %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("daemon admin API answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode admin API response: %w", err)
+	}
+	return nil
+}
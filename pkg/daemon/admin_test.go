@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap/zaptest"
+)
+
+const testAdminToken = "0123456789abcdef"
+
+func TestAdminHandler(t *testing.T) {
+	d, _ := newTestDaemon(t)
+	d.config.DigitalOcean.FirewallID = "fw-1"
+	d.config.DigitalOcean.InboundRules = []config.InboundRule{{Port: 443, Protocol: "tcp"}}
+	d.config.State.Path = filepath.Join(t.TempDir(), "state.json")
+	d.config.Admin.Token = testAdminToken
+	d.service = service.NewService(d.config, zaptest.NewLogger(t), false)
+	handler := d.adminHandler()
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		body     string
+		expected int
+	}{
+		{name: "missing token", method: http.MethodGet, expected: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, token: "fedcba9876543210", expected: http.StatusUnauthorized},
+		{name: "list rules", method: http.MethodGet, token: testAdminToken, expected: http.StatusOK},
+		{name: "unknown field", method: http.MethodPost, token: testAdminToken, body: `{"port":8443,"cidr":"0.0.0.0/0"}`, expected: http.StatusBadRequest},
+		{name: "invalid port", method: http.MethodPost, token: testAdminToken, body: `{"port":70000}`, expected: http.StatusBadRequest},
+		{name: "unknown firewall", method: http.MethodPost, token: testAdminToken, body: `{"firewall_id":"fw-2","port":8443}`, expected: http.StatusBadRequest},
+		{name: "configured rule", method: http.MethodPost, token: testAdminToken, body: `{"port":443,"protocol":"tcp+udp"}`, expected: http.StatusConflict},
+		{name: "unsupported method", method: http.MethodDelete, token: testAdminToken, expected: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, adminRulesPath, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d: %s", tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// Rules already in the state file are listed and conflict like configured ones
+	store := state.NewStore(d.config.State.Path, zaptest.NewLogger(t))
+	if err := store.Update(func(st *state.State) error {
+		st.ManagedRules = append(st.ManagedRules, state.ManagedRule{FirewallID: "fw-1", Port: 8443, Protocol: "tcp"})
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to record managed rule: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, adminRulesPath, nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var rules []state.ManagedRule
+	if err := json.Unmarshal(rec.Body.Bytes(), &rules); err != nil {
+		t.Fatalf("failed to decode rules: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Port != 8443 {
+		t.Errorf("expected the managed rule on port 8443, got %+v", rules)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, adminRulesPath, strings.NewReader(`{"port":8443}`))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected a rule added at runtime to conflict, got %d", rec.Code)
+	}
+}
+
+func TestNewAdminClient(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{address: ":9091", expected: "http://127.0.0.1:9091"},
+		{address: "0.0.0.0:9091", expected: "http://127.0.0.1:9091"},
+		{address: "[::]:9091", expected: "http://127.0.0.1:9091"},
+		{address: "10.0.0.5:9091", expected: "http://10.0.0.5:9091"},
+		{address: "[::1]:9091", expected: "http://[::1]:9091"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			client, err := NewAdminClient(tt.address, testAdminToken)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if client.baseURL != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, client.baseURL)
+			}
+		})
+	}
+
+	if _, err := NewAdminClient("localhost", testAdminToken); err == nil {
+		t.Error("expected an address without a port to be rejected")
+	}
+}
@@ -3,26 +3,83 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/invite"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/server"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/netdata"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sso"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
 	"go.uber.org/zap"
 )
 
+// firewallUpdateJob names the scheduled job updating every firewall
+const firewallUpdateJob = "firewall-update"
+
 // Daemon manages the long-running service
 type Daemon struct {
 	config    *config.Config
 	service   *service.Service
 	scheduler *scheduler.Scheduler
+	server    *server.Server
+	health    *listenerServer
+	admin     *listenerServer
+	sso       *sso.Client
 	logger    *zap.Logger
 	dryRun    bool
+
+	// clock and signals are swapped in tests and simulations, which must not depend on the
+	// wall clock or receive the test binary's own signals
+	clock   clock.Clock
+	signals <-chan os.Signal
+
+	// ready is set while the jobs are scheduled, answering readiness probes
+	ready atomic.Bool
+
+	// stopAdaptive stops the TTL-driven runs of cron.mode adaptive, nil in fixed mode
+	stopAdaptive func()
+	// stopReconcile stops the source polling of reconcile.interval, nil when it is disabled
+	stopReconcile func()
+	// stopProbes stops the health probes of health.interval, nil when they are disabled
+	stopProbes func()
+
+	// startedAt is when the jobs were scheduled, configHash the Config.Hash the daemon runs with
+	startedAt  time.Time
+	configHash string
+
+	// reload loads the configuration again on SIGHUP, next is the daemon restarting with it;
+	// baseLogger, and the hooks installed on the service, are handed over to the next daemon
+	reload      ReloadFunc
+	next        *Daemon
+	baseLogger  *zap.Logger
+	confirmFunc digitalocean.ConfirmFunc
+	planFunc    func(digitalocean.Plan)
+	adminAccess *digitalocean.AdminAccess
+
+	mu        sync.Mutex
+	sourceIPs *service.SourceIPs
+	// probes are the checks of the latest health probe round, run at probedAt
+	probes   []service.Check
+	probedAt time.Time
 }
 
+// ReloadFunc loads and validates the configuration of the daemon again
+type ReloadFunc func() (*config.Config, error)
+
 // NewDaemon creates a new daemon instance
 func NewDaemon(cfg *config.Config, logger *zap.Logger, dryRun bool) (*Daemon, error) {
 	// Create service
@@ -33,52 +90,277 @@ func NewDaemon(cfg *config.Config, logger *zap.Logger, dryRun bool) (*Daemon, er
 	if err != nil {
 		return nil, fmt.Errorf("failed to create scheduler: %w", err)
 	}
+	sched.SetCatchUp(cfg.Cron.CatchUp)
+
+	d := &Daemon{
+		config:     cfg,
+		service:    svc,
+		scheduler:  sched,
+		logger:     logger.Named("daemon"),
+		dryRun:     dryRun,
+		clock:      clock.Real,
+		configHash: cfg.Hash(),
+		baseLogger: logger,
+	}
+
+	// Signatures let consumers check the allowlists they fetch were produced by this daemon
+	var signer *signing.Signer
+	if cfg.Signing.Format != "" {
+		signer, err = signing.LoadSigner(cfg.Signing.Format, cfg.Signing.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		svc.SetSigner(signer)
+	}
 
-	return &Daemon{
-		config:    cfg,
-		service:   svc,
-		scheduler: sched,
-		logger:    logger.Named("daemon"),
-		dryRun:    dryRun,
-	}, nil
+	// Probes stay available in lite mode, they only need a small listener of their own
+	if cfg.Health.Address != "" {
+		d.health = newListenerServer("health probes", cfg.Health.Address, d.healthHandler(), logger.Named("health"))
+	}
+	if cfg.Admin.Address != "" {
+		d.admin = newListenerServer("admin API", cfg.Admin.Address, d.adminHandler(), logger.Named("admin"))
+	}
+
+	// Lite mode leaves out the HTTP server, and with it the metrics, for small droplets
+	if cfg.Lite && cfg.Server.Address != "" {
+		d.logger.Info("Lite mode, not serving the allowlist and metrics", zap.String("address", cfg.Server.Address))
+	}
+
+	// Publish every collected allowlist so other systems can pull what the firewall uses
+	if cfg.Server.Address != "" && !cfg.Lite {
+		d.server = server.NewServer(cfg.Server.Address, logger,
+			server.WithAuthTokens(cfg.Server.AuthTokens),
+			server.WithRateLimit(cfg.Server.RateLimit),
+			server.WithTrustProxy(cfg.Server.TrustProxy),
+			server.WithSigner(signer))
+		d.server.Handle("/metrics", d.newMetricsRegistry(logger))
+		if cfg.Invites.SigningKey != "" {
+			d.server.HandlePublic(invite.Path, http.HandlerFunc(d.handleInvite))
+		}
+		if cfg.SelfService.Provider != "" {
+			d.sso = newSSOClient(cfg, logger)
+			d.server.HandlePublic(selfServicePath, http.HandlerFunc(d.handleSelfService))
+			d.server.HandlePublic(selfServiceCallbackPath, http.HandlerFunc(d.handleSelfServiceCallback))
+		}
+		svc.SetSourceIPsFunc(func(ips *service.SourceIPs) {
+			d.recordSourceIPs(ips)
+			if err := d.server.Update(ips.Entries()); err != nil {
+				d.logger.Warn("Failed to update served allowlist", zap.Error(err))
+			}
+		})
+	}
+
+	return d, nil
 }
 
-// Start starts the daemon with graceful shutdown handling
+// Start starts the daemon with graceful shutdown handling; a configuration reloaded on SIGHUP
+// restarts it in place with the new settings
 func (d *Daemon) Start(ctx context.Context) error {
+	for current := d; current != nil; current = current.next {
+		if err := current.start(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start runs the daemon until shutdown or a configuration reload
+func (d *Daemon) start(ctx context.Context) (err error) {
 	d.logger.Info("Starting daemon",
 		zap.String("schedule", d.config.Cron.Schedule),
 		zap.String("timezone", d.config.Cron.Timezone),
+		zap.Bool("catch_up", d.config.Cron.CatchUp),
+		zap.String("mode", d.config.Cron.Mode),
 		zap.Bool("dry_run", d.dryRun))
 
+	// Answer liveness probes during the startup checks; readiness follows once the jobs are
+	// scheduled. The shutdown stops the probe server, a failed startup stops it here
+	if d.health != nil {
+		if err := d.health.Start(); err != nil {
+			return fmt.Errorf("failed to start health server: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				d.stopHealthServer()
+			}
+		}()
+	}
+
 	// Validate configuration before starting
 	if err := d.service.ValidateConfiguration(ctx); err != nil {
 		return fmt.Errorf("configuration validation failed: %w", err)
 	}
 
-	// Add the firewall update job to scheduler
+	// Refuse to apply changes with a token that cannot update the firewall
+	if err := d.checkTokenScopes(ctx); err != nil {
+		return err
+	}
+
+	jobFunc, err := d.addJobs()
+	if err != nil {
+		return err
+	}
+
+	if d.server != nil {
+		if err := d.server.Start(); err != nil {
+			return fmt.Errorf("failed to start allowlist server: %w", err)
+		}
+
+		// Serve the current allowlist right away instead of waiting for the first scheduled run
+		if _, err := d.service.CollectSourceIPs(ctx); err != nil {
+			d.logger.Warn("Failed to collect the initial allowlist", zap.Error(err))
+		}
+	}
+
+	// Apply an edited configuration right away, otherwise make up for scheduled runs missed while
+	// the daemon was not running
+	if !d.reconcileChangedConfig(ctx, jobFunc) {
+		d.catchUpAfterDowntime(ctx, jobFunc)
+	}
+
+	// Follow the DNS TTLs of the resolved domains besides the schedule
+	if d.config.Cron.Mode == config.CronModeAdaptive {
+		d.startAdaptiveRefresh(jobFunc)
+	}
+
+	// Poll the sources between scheduled runs and only update the firewalls when they changed
+	if d.config.Reconcile.Interval > 0 {
+		d.startReconcile(jobFunc)
+	}
+
+	// Detect outages of the sources and the DigitalOcean API between the runs
+	if d.config.Health.Interval > 0 {
+		d.startHealthProbes()
+	}
+
+	// Rules added through the admin API update the firewalls like the scheduled runs
+	if d.admin != nil {
+		if err := d.admin.Start(); err != nil {
+			return fmt.Errorf("failed to start admin API: %w", err)
+		}
+	}
+
+	// Other commands read the record to tell whether the daemon is up and current
+	d.recordStart()
+
+	return d.run(ctx)
+}
+
+// addJobs adds the firewall update job and the jobs of the enabled features to the scheduler,
+// returning the firewall update job
+func (d *Daemon) addJobs() (scheduler.JobFunc, error) {
 	jobFunc := func(ctx context.Context) error {
-		return d.service.UpdateFirewallRules(ctx)
+		return d.service.ScheduledUpdate(ctx)
+	}
+
+	if err := d.scheduler.AddJob(d.config.Cron.Schedule, firewallUpdateJob, jobFunc); err != nil {
+		return nil, fmt.Errorf("failed to add scheduled job: %w", err)
 	}
 
-	if err := d.scheduler.AddJob(d.config.Cron.Schedule, "firewall-update", jobFunc); err != nil {
-		return fmt.Errorf("failed to add scheduled job: %w", err)
+	// Reconcile at access window boundaries so windowed rules are added and removed on time; every
+	// run updates all firewalls, so the jobs of further firewalls are only named after them
+	for _, target := range d.config.DigitalOcean.Targets() {
+		prefix := "window"
+		if target.ID != d.config.DigitalOcean.FirewallID {
+			prefix = "window-" + target.ID
+		}
+
+		for _, rule := range target.InboundRules {
+			if !rule.Window.Enabled() {
+				continue
+			}
+
+			openJob := fmt.Sprintf("%s-open-%s-%d", prefix, rule.Protocol, rule.Port)
+			if err := d.scheduler.AddJob(rule.Window.Open, openJob, jobFunc); err != nil {
+				return nil, fmt.Errorf("failed to add access window job: %w", err)
+			}
+
+			closeJob := fmt.Sprintf("%s-close-%s-%d", prefix, rule.Protocol, rule.Port)
+			if err := d.scheduler.AddJob(rule.Window.Close, closeJob, jobFunc); err != nil {
+				return nil, fmt.Errorf("failed to add access window job: %w", err)
+			}
+		}
 	}
 
+	// Summarize applied changes on their own schedule instead of notifying per run
+	if d.config.Digest.WebhookURL != "" {
+		digestJob := func(ctx context.Context) error {
+			return d.service.SendDigest(ctx)
+		}
+		if err := d.scheduler.AddJob(d.config.Digest.Schedule, "change-digest", digestJob); err != nil {
+			return nil, fmt.Errorf("failed to add change digest job: %w", err)
+		}
+	}
+
+	// Remove the rules of ports dropped from the configuration since they were last written
+	if d.config.GC.Schedule != "" {
+		gcJob := func(ctx context.Context) error {
+			_, err := d.service.CollectGarbage(ctx)
+			return err
+		}
+		if err := d.scheduler.AddJob(d.config.GC.Schedule, "rule-gc", gcJob); err != nil {
+			return nil, fmt.Errorf("failed to add rule garbage collection job: %w", err)
+		}
+	}
+
+	// Forward the audit log to the SIEM continuously, catching up after collector outages
+	if d.config.Audit.Ship.Type != "" {
+		shipJob := func(ctx context.Context) error {
+			return d.service.ShipAuditLog(ctx)
+		}
+		if err := d.scheduler.AddJob("@every "+d.config.Audit.Ship.Interval.String(), "audit-shipping", shipJob); err != nil {
+			return nil, fmt.Errorf("failed to add audit shipping job: %w", err)
+		}
+	}
+
+	// Close the access opened by invites and self-service once their TTL runs out
+	if d.config.Invites.SigningKey != "" || d.config.SelfService.Provider != "" {
+		expiryJob := func(ctx context.Context) error {
+			return d.service.ExpireAccessGrants(ctx)
+		}
+		if err := d.scheduler.AddJob(grantExpirySchedule, grantExpiryJob, expiryJob); err != nil {
+			return nil, fmt.Errorf("failed to add access grant expiry job: %w", err)
+		}
+	}
+
+	return jobFunc, nil
+}
+
+// run starts the scheduler and blocks until a shutdown signal or ctx cancellation, then stops
+// the scheduler and the server
+func (d *Daemon) run(ctx context.Context) error {
 	// Start the scheduler
 	d.scheduler.Start()
-
-	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	d.ready.Store(true)
+
+	// Set up signal handling for graceful shutdown and configuration reloads
+	signals := d.signals
+	if signals == nil {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		defer signal.Stop(sigChan)
+		signals = sigChan
+	}
 
 	d.logger.Info("Daemon started successfully, waiting for signals or context cancellation")
 
 	// Wait for shutdown signal or context cancellation
-	select {
-	case sig := <-sigChan:
-		d.logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
-	case <-ctx.Done():
-		d.logger.Info("Context cancelled, shutting down")
+wait:
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if d.reloadConfig(ctx) {
+					break wait
+				}
+				continue
+			}
+			d.logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
+			break wait
+		case <-ctx.Done():
+			d.logger.Info("Context cancelled, shutting down")
+			break wait
+		}
 	}
 
 	// Graceful shutdown
@@ -89,14 +371,289 @@ func (d *Daemon) Start(ctx context.Context) error {
 	return nil
 }
 
+// checkTokenScopes fails when the daemon would apply changes with a token lacking the write
+// scope; dry-run and read-only daemons never write, so they are not probed
+func (d *Daemon) checkTokenScopes(ctx context.Context) error {
+	if d.dryRun || d.config.ReadOnly {
+		return nil
+	}
+
+	scopes, err := d.service.ProbeTokenScopes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to probe DigitalOcean API token scopes: %w", err)
+	}
+	if !scopes.Write {
+		return fmt.Errorf("DigitalOcean API token is %s for firewall %s: create a token with the "+
+			"firewall:read and firewall:update scopes, or run the daemon with --read-only or --dry-run",
+			scopes, d.config.DigitalOcean.FirewallID)
+	}
+	return nil
+}
+
+// ProbeTokenScopes classifies what the DigitalOcean API token may do with the configured firewall
+func (d *Daemon) ProbeTokenScopes(ctx context.Context) (digitalocean.TokenScopes, error) {
+	return d.service.ProbeTokenScopes(ctx)
+}
+
+// catchUpAfterDowntime runs the job immediately if the schedule fired at least once since the
+// last successful run recorded in state; failures are logged and left to the next scheduled run
+func (d *Daemon) catchUpAfterDowntime(ctx context.Context, job scheduler.JobFunc) {
+	last, err := d.service.LastSuccessfulRun()
+	if err != nil {
+		d.logger.Warn("Failed to read last successful run, skipping catch-up", zap.Error(err))
+		return
+	}
+	if last.IsZero() {
+		d.logger.Debug("No successful run recorded yet, skipping catch-up")
+		return
+	}
+
+	missed, err := scheduler.CountMissedRuns(d.config.Cron.Schedule, d.config.Cron.Timezone, last, d.clock.Now())
+	if err != nil {
+		d.logger.Warn("Failed to check for missed runs, skipping catch-up", zap.Error(err))
+		return
+	}
+	if missed == 0 {
+		return
+	}
+
+	d.logger.Warn("Scheduled runs were missed while the daemon was down, running catch-up update",
+		zap.Time("last_successful_run", last),
+		zap.Int("missed_runs", missed))
+
+	if err := job(ctx); err != nil {
+		d.logger.Error("Catch-up update failed", zap.Error(err))
+		return
+	}
+	d.logger.Info("Catch-up update completed successfully")
+}
+
+// reconcileChangedConfig runs the job immediately if a firewall was last updated with another
+// configuration, reporting whether it ran; failures are logged and left to the next scheduled run
+func (d *Daemon) reconcileChangedConfig(ctx context.Context, job scheduler.JobFunc) bool {
+	changed, err := d.service.NoteConfigChange()
+	if err != nil {
+		d.logger.Warn("Failed to check for configuration changes, skipping reconcile", zap.Error(err))
+		return false
+	}
+	if len(changed) == 0 {
+		return false
+	}
+
+	d.logger.Info("Configuration changed since the last update, reconciling now",
+		zap.Strings("firewall_ids", changed),
+		zap.String("config_hash", d.configHash))
+
+	if err := job(ctx); err != nil {
+		d.logger.Error("Reconcile after configuration change failed", zap.Error(err))
+		return true
+	}
+	d.logger.Info("Reconcile after configuration change completed successfully")
+	return true
+}
+
+// reloadConfig loads the configuration again on SIGHUP and prepares the next daemon running it,
+// reporting whether the daemon must restart; a configuration failing to load or validate keeps
+// the current one, and a changed API token alone is swapped without a restart when it is read
+// from digitalocean.api-key-file
+func (d *Daemon) reloadConfig(ctx context.Context) bool {
+	if d.reload == nil {
+		d.reloadAPIToken()
+		return false
+	}
+
+	d.logger.Info("Received SIGHUP, reloading configuration")
+	cfg, err := d.reload()
+	if err != nil {
+		d.logger.Error("Failed to reload configuration, keeping the current one", zap.Error(err))
+		return false
+	}
+
+	changed := config.ChangedKeys(d.config, cfg)
+	tokenChanged := slices.Contains(changed, "digitalocean.api-key")
+	// A token read from api-key-file is swapped in place; an inline one only reaches the API
+	// through the client of the next daemon
+	if d.config.DigitalOcean.APIKeyFile != "" {
+		changed = slices.DeleteFunc(changed, func(key string) bool { return key == "digitalocean.api-key" })
+	}
+	if len(changed) == 0 {
+		if tokenChanged {
+			d.reloadAPIToken()
+			return false
+		}
+		d.logger.Info("Configuration unchanged")
+		return false
+	}
+
+	next, err := NewDaemon(cfg, d.baseLogger, d.dryRun)
+	if err != nil {
+		d.logger.Error("Failed to apply reloaded configuration, keeping the current one", zap.Error(err))
+		return false
+	}
+	if err := next.service.ValidateConfiguration(ctx); err != nil {
+		d.logger.Error("Reloaded configuration failed validation, keeping the current one", zap.Error(err))
+		return false
+	}
+	next.reload = d.reload
+	next.signals = d.signals
+	if d.confirmFunc != nil {
+		next.SetConfirmFunc(d.confirmFunc)
+	}
+	if d.planFunc != nil {
+		next.SetPlanFunc(d.planFunc)
+	}
+	if d.adminAccess != nil {
+		next.SetAdminAccess(d.adminAccess)
+	}
+	d.next = next
+
+	d.logger.Info("Configuration changed, restarting the daemon with it",
+		zap.Strings("changed", changed),
+		zap.Bool("api_token_changed", tokenChanged),
+		zap.String("config_hash", next.configHash),
+		zap.String("previous_config_hash", d.configHash))
+
+	// The logger is set up once per process, before the daemons are created
+	if logging := slices.DeleteFunc(slices.Clone(changed), func(key string) bool {
+		return key != "log-level" && key != "log-output" && !strings.HasPrefix(key, "logging.")
+	}); len(logging) > 0 {
+		d.logger.Warn("Logging settings only take effect after a restart of the process", zap.Strings("changed", logging))
+	}
+	return true
+}
+
+// reloadAPIToken re-reads a rotated API token on SIGHUP; a failed reload keeps the current token
+func (d *Daemon) reloadAPIToken() {
+	if d.config.DigitalOcean.APIKeyFile == "" {
+		d.logger.Warn("Received SIGHUP but digitalocean.api-key-file is not set, ignoring")
+		return
+	}
+
+	d.logger.Info("Received SIGHUP, reloading DigitalOcean API token")
+	if err := d.service.ReloadAPIToken(); err != nil {
+		d.logger.Error("Failed to reload DigitalOcean API token, keeping the current token", zap.Error(err))
+	}
+}
+
+// recordStart records the daemon of this process in the state file
+func (d *Daemon) recordStart() {
+	d.mu.Lock()
+	d.startedAt = d.clock.Now()
+	d.mu.Unlock()
+
+	hostname, _ := os.Hostname()
+	err := d.service.RecordDaemonStart(state.DaemonRecord{
+		StartedAt:  d.startedAt,
+		PID:        os.Getpid(),
+		Hostname:   hostname,
+		DryRun:     d.dryRun,
+		ConfigHash: d.configHash,
+	})
+	if err != nil {
+		d.logger.Warn("Failed to record daemon start", zap.Error(err))
+	}
+}
+
+// recordStop marks the daemon record of this process stopped, if Start recorded one
+func (d *Daemon) recordStop() {
+	d.mu.Lock()
+	started := !d.startedAt.IsZero()
+	d.mu.Unlock()
+	if !started {
+		return
+	}
+
+	if err := d.service.RecordDaemonStop(os.Getpid(), d.clock.Now()); err != nil {
+		d.logger.Warn("Failed to record daemon stop", zap.Error(err))
+	}
+}
+
 // shutdown performs graceful shutdown
 func (d *Daemon) shutdown() {
-	// Stop the scheduler
+	// Fail readiness probes first so traffic drains while the jobs finish
+	d.ready.Store(false)
+
+	// Stop the scheduler, the TTL-driven runs and the source polling
 	d.scheduler.Stop()
+	if d.stopAdaptive != nil {
+		d.stopAdaptive()
+	}
+	if d.stopReconcile != nil {
+		d.stopReconcile()
+	}
+	if d.stopProbes != nil {
+		d.stopProbes()
+	}
+
+	if d.admin != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := d.admin.Shutdown(ctx); err != nil {
+			d.logger.Warn("Failed to stop admin API", zap.Error(err))
+		}
+	}
+
+	if d.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := d.server.Shutdown(ctx); err != nil {
+			d.logger.Warn("Failed to stop allowlist server", zap.Error(err))
+		}
+	}
+
+	d.recordStop()
+
+	// Liveness probes are answered until the very end
+	d.stopHealthServer()
 
 	d.logger.Info("Graceful shutdown completed")
 }
 
+// stopHealthServer stops the probe server when one is configured
+func (d *Daemon) stopHealthServer() {
+	if d.health == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := d.health.Shutdown(ctx); err != nil {
+		d.logger.Warn("Failed to stop health server", zap.Error(err))
+	}
+}
+
+// SetConfirmFunc installs a hook that must approve every firewall update before it is applied
+func (d *Daemon) SetConfirmFunc(fn digitalocean.ConfirmFunc) {
+	d.confirmFunc = fn
+	d.service.SetConfirmFunc(fn)
+}
+
+// SetPlanFunc installs a hook receiving the planned changes of every firewall a dry run leaves alone
+func (d *Daemon) SetPlanFunc(fn func(digitalocean.Plan)) {
+	d.planFunc = fn
+	d.service.SetPlanFunc(fn)
+}
+
+// SetAdminAccess installs a check that refuses updates removing admin access unless forced
+func (d *Daemon) SetAdminAccess(access *digitalocean.AdminAccess) {
+	d.adminAccess = access
+	d.service.SetAdminAccess(access)
+}
+
+// SetReloadFunc makes SIGHUP reload the configuration with fn and restart the daemon with it when
+// it changed; without it, SIGHUP only re-reads the API token
+func (d *Daemon) SetReloadFunc(fn ReloadFunc) {
+	d.reload = fn
+}
+
+// NetdataResults returns how each Netdata domain of the latest resolution went
+func (d *Daemon) NetdataResults() []netdata.DomainResult {
+	return d.service.NetdataResults()
+}
+
 // RunOnce runs the firewall update job once and exits
 func (d *Daemon) RunOnce(ctx context.Context) error {
 	d.logger.Info("Running firewall update once", zap.Bool("dry_run", d.dryRun))
@@ -111,6 +668,11 @@ func (d *Daemon) RunOnce(ctx context.Context) error {
 		return fmt.Errorf("firewall update failed: %w", err)
 	}
 
+	// The changes are recorded either way, a later run ships them if the collector is down
+	if err := d.service.ShipAuditLog(ctx); err != nil {
+		d.logger.Warn("Failed to ship audit log", zap.Error(err))
+	}
+
 	d.logger.Info("One-shot execution completed successfully")
 	return nil
 }
@@ -118,10 +680,25 @@ func (d *Daemon) RunOnce(ctx context.Context) error {
 // GetStatus returns the current status of the daemon and its services
 func (d *Daemon) GetStatus(ctx context.Context) (*DaemonStatus, error) {
 	status := &DaemonStatus{
-		IsRunning: d.scheduler.IsRunning(),
-		DryRun:    d.dryRun,
-		Schedule:  d.config.Cron.Schedule,
-		Timezone:  d.config.Cron.Timezone,
+		IsRunning:  d.scheduler.IsRunning(),
+		DryRun:     d.dryRun,
+		Schedule:   d.config.Cron.Schedule,
+		Timezone:   d.config.Cron.Timezone,
+		JobMetrics: d.scheduler.Metrics(),
+		ConfigHash: d.configHash,
+	}
+
+	d.mu.Lock()
+	startedAt := d.startedAt
+	d.mu.Unlock()
+	if !startedAt.IsZero() {
+		status.StartedAt = startedAt
+		status.Uptime = d.clock.Now().Sub(startedAt).Round(time.Second).String()
+	}
+	if lastApplied, err := d.service.LastSuccessfulRuns(); err != nil {
+		d.logger.Warn("Failed to read the last successful runs", zap.Error(err))
+	} else if len(lastApplied) > 0 {
+		status.LastApplied = lastApplied
 	}
 
 	// Get scheduler entries
@@ -159,13 +736,18 @@ func (d *Daemon) GetNextRunTime() (time.Time, error) {
 
 // DaemonStatus represents the current status of the daemon
 type DaemonStatus struct {
-	IsRunning     bool               `json:"is_running"`
-	DryRun        bool               `json:"dry_run"`
-	Schedule      string             `json:"schedule"`
-	Timezone      string             `json:"timezone"`
-	ScheduledJobs []ScheduledJobInfo `json:"scheduled_jobs"`
-	ServiceStatus *service.Status    `json:"service_status,omitempty"`
-	StatusError   string             `json:"status_error,omitempty"`
+	IsRunning     bool                   `json:"is_running"`
+	DryRun        bool                   `json:"dry_run"`
+	StartedAt     time.Time              `json:"started_at"`
+	Uptime        string                 `json:"uptime,omitempty"`
+	ConfigHash    string                 `json:"config_hash"`
+	LastApplied   map[string]time.Time   `json:"last_applied,omitempty"`
+	Schedule      string                 `json:"schedule"`
+	Timezone      string                 `json:"timezone"`
+	ScheduledJobs []ScheduledJobInfo     `json:"scheduled_jobs"`
+	JobMetrics    []scheduler.JobMetrics `json:"job_metrics"`
+	ServiceStatus *service.Status        `json:"service_status,omitempty"`
+	StatusError   string                 `json:"status_error,omitempty"`
 }
 
 // ScheduledJobInfo contains information about a scheduled job
@@ -0,0 +1,388 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/server"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/cloudflare"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newTestDaemon creates a daemon with an hourly job and a fake signal channel, without the
+// service the full Start validates against the APIs
+func newTestDaemon(t *testing.T) (*Daemon, chan os.Signal) {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Cron.Schedule = "0 * * * *"
+	cfg.Cron.Timezone = "UTC"
+
+	sched, err := scheduler.NewScheduler(cfg.Cron.Timezone, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+	sched.SetCatchUp(true)
+	if err := sched.AddJob(cfg.Cron.Schedule, "firewall-update", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	return &Daemon{
+		config:    cfg,
+		scheduler: sched,
+		logger:    zaptest.NewLogger(t),
+		clock:     clock.Real,
+		signals:   signals,
+	}, signals
+}
+
+// waitForGoroutines fails the test unless the goroutine count drops back to baseline
+func waitForGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("expected %d goroutines after shutdown, got %d:\n%s", baseline, runtime.NumGoroutine(), buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// runDaemon runs the daemon in the background, returning a channel closed when run returns
+func runDaemon(ctx context.Context, t *testing.T, d *Daemon) <-chan struct{} {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := d.run(ctx); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}()
+	return done
+}
+
+func TestRunSignals(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal os.Signal
+	}{
+		{name: "SIGTERM", signal: syscall.SIGTERM},
+		{name: "SIGINT", signal: syscall.SIGINT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+
+			d, signals := newTestDaemon(t)
+			done := runDaemon(context.Background(), t, d)
+
+			// SIGHUP reloads the API token and keeps the daemon running
+			signals <- syscall.SIGHUP
+			select {
+			case <-done:
+				t.Fatal("expected SIGHUP not to stop the daemon")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			signals <- tt.signal
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatalf("expected %s to stop the daemon", tt.name)
+			}
+			waitForGoroutines(t, baseline)
+		})
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	d, _ := newTestDaemon(t)
+	d.server = server.NewServer("127.0.0.1:0", zaptest.NewLogger(t))
+	if err := d.server.Start(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runDaemon(ctx, t, d)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected cancelling the context to stop the daemon")
+	}
+
+	// The scheduler, its missed-run watcher and the server all exit on shutdown
+	waitForGoroutines(t, baseline)
+}
+
+func TestCatchUpAfterDowntime(t *testing.T) {
+	lastRun := time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected bool
+	}{
+		{name: "no run missed", now: lastRun.Add(20 * time.Minute), expected: false},
+		{name: "runs missed", now: lastRun.Add(3 * time.Hour), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDaemon(t)
+			d.config.DigitalOcean.FirewallID = "fw-1"
+			d.config.State.Path = filepath.Join(t.TempDir(), "state.json")
+			d.clock = clock.NewFake(tt.now)
+
+			store := state.NewStore(d.config.State.Path, zaptest.NewLogger(t))
+			if err := store.Update(func(st *state.State) error {
+				st.SetLastSuccessfulRun("fw-1", lastRun)
+				return nil
+			}); err != nil {
+				t.Fatalf("failed to record last run: %v", err)
+			}
+			d.service = service.NewService(d.config, zaptest.NewLogger(t), true)
+
+			ran := false
+			d.catchUpAfterDowntime(context.Background(), func(ctx context.Context) error {
+				ran = true
+				return nil
+			})
+			if ran != tt.expected {
+				t.Errorf("expected catch-up run %v, got %v", tt.expected, ran)
+			}
+		})
+	}
+}
+
+func TestReconcileChangedConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		applied  string
+		expected bool
+	}{
+		{name: "no configuration recorded", applied: "", expected: false},
+		{name: "configuration unchanged", applied: "current", expected: false},
+		{name: "configuration changed", applied: "edited", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDaemon(t)
+			d.config.DigitalOcean.FirewallID = "fw-1"
+			d.config.State.Path = filepath.Join(t.TempDir(), "state.json")
+			d.config.Audit.Path = filepath.Join(t.TempDir(), "audit.log")
+			applied := tt.applied
+			if applied == "current" {
+				applied = d.config.Hash()
+			}
+
+			store := state.NewStore(d.config.State.Path, zaptest.NewLogger(t))
+			if err := store.Update(func(st *state.State) error {
+				st.SetLastSuccessfulRun("fw-1", time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+				st.SetAppliedConfigHash("fw-1", applied)
+				return nil
+			}); err != nil {
+				t.Fatalf("failed to record last run: %v", err)
+			}
+			d.service = service.NewService(d.config, zaptest.NewLogger(t), true)
+
+			ran := false
+			got := d.reconcileChangedConfig(context.Background(), func(ctx context.Context) error {
+				ran = true
+				return nil
+			})
+			if got != tt.expected || ran != tt.expected {
+				t.Errorf("expected reconcile %v, got %v (ran %v)", tt.expected, got, ran)
+			}
+
+			// The change is noted in the audit log
+			record, err := audit.NewLogger(d.config.Audit.Path, nil, zaptest.NewLogger(t)).Last("fw-1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expected != (record != nil && record.Action == "config_changed") {
+				t.Errorf("expected config_changed audit note %v, got %+v", tt.expected, record)
+			}
+		})
+	}
+}
+
+func TestReloadConfigKeepsCurrent(t *testing.T) {
+	tests := []struct {
+		name   string
+		reload ReloadFunc
+	}{
+		{name: "no reload function"},
+		{name: "reload fails", reload: func() (*config.Config, error) { return nil, errors.New("invalid cron.mode") }},
+		{name: "configuration unchanged", reload: func() (*config.Config, error) {
+			cfg := &config.Config{}
+			cfg.Cron.Schedule = "0 * * * *"
+			cfg.Cron.Timezone = "UTC"
+			return cfg, nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDaemon(t)
+			d.reload = tt.reload
+
+			if d.reloadConfig(context.Background()) || d.next != nil {
+				t.Errorf("expected the daemon to keep running its configuration, got next %v", d.next)
+			}
+		})
+	}
+}
+
+// fakeDigitalOcean answers the requests of the DigitalOcean clients, which send them through
+// http.DefaultTransport, recording the tokens they carry
+type fakeDigitalOcean struct {
+	base   http.RoundTripper
+	tokens []string
+}
+
+func (f *fakeDigitalOcean) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "api.digitalocean.com" {
+		return f.base.RoundTrip(req)
+	}
+	f.tokens = append(f.tokens, req.Header.Get("Authorization"))
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "application/json")
+	_, _ = rec.WriteString(`{"firewall":{"id":"fw-1","name":"web"}}`)
+	return rec.Result(), nil
+}
+
+func TestReloadConfigRestarts(t *testing.T) {
+	cfServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := cloudflare.CloudflareIPsResponse{Success: true}
+		response.Result.IPv4CIDRs = []string{"173.245.48.0/20"}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer cfServer.Close()
+
+	api := &fakeDigitalOcean{base: http.DefaultTransport}
+	http.DefaultTransport = api
+	t.Cleanup(func() { http.DefaultTransport = api.base })
+
+	tests := []struct {
+		name    string
+		change  func(cfg *config.Config)
+		changed []string
+	}{
+		{
+			name:    "inline api-key only",
+			change:  func(cfg *config.Config) { cfg.DigitalOcean.APIKey = "new-token" },
+			changed: []string{"digitalocean.api-key"},
+		},
+		{
+			name: "schedule and api-key",
+			change: func(cfg *config.Config) {
+				cfg.Cron.Schedule = "*/5 * * * *"
+				cfg.DigitalOcean.APIKey = "new-token"
+			},
+			changed: []string{"cron.schedule", "digitalocean.api-key"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.tokens = nil
+			d, _ := newTestDaemon(t)
+			core, logs := observer.New(zapcore.InfoLevel)
+			d.logger = zap.New(core)
+			d.baseLogger = zaptest.NewLogger(t)
+			d.config.DigitalOcean.APIKey = "old-token"
+			d.config.DigitalOcean.FirewallID = "fw-1"
+			d.config.Cloudflare.IPsURL = cfServer.URL
+			d.config.State.Path = filepath.Join(t.TempDir(), "state.json")
+			d.reload = func() (*config.Config, error) {
+				cfg := *d.config
+				tt.change(&cfg)
+				return &cfg, nil
+			}
+
+			if !d.reloadConfig(context.Background()) || d.next == nil {
+				t.Fatal("expected the daemon to restart with the reloaded configuration")
+			}
+			if d.next.config.DigitalOcean.APIKey != "new-token" {
+				t.Errorf("expected the next daemon to run the new token, got %q", d.next.config.DigitalOcean.APIKey)
+			}
+			// The reloaded configuration is validated with the client of the next daemon
+			if len(api.tokens) == 0 || api.tokens[len(api.tokens)-1] != "Bearer new-token" {
+				t.Errorf("expected the new token to reach the API, got %v", api.tokens)
+			}
+
+			entries := logs.FilterMessage("Configuration changed, restarting the daemon with it").All()
+			if len(entries) != 1 {
+				t.Fatalf("expected the restart to be logged, got %+v", logs.All())
+			}
+			changed, ok := entries[0].ContextMap()["changed"].([]interface{})
+			if !ok || len(changed) != len(tt.changed) {
+				t.Fatalf("expected the changed keys %v, got %v", tt.changed, entries[0].ContextMap()["changed"])
+			}
+			for i, key := range tt.changed {
+				if changed[i] != key {
+					t.Errorf("expected the changed keys %v, got %v", tt.changed, changed)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordStartAndStop(t *testing.T) {
+	startedAt := time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC)
+	fake := clock.NewFake(startedAt)
+
+	d, _ := newTestDaemon(t)
+	d.config.State.Path = filepath.Join(t.TempDir(), "state.json")
+	d.clock = fake
+	d.configHash = d.config.Hash()
+	d.service = service.NewService(d.config, zaptest.NewLogger(t), true)
+
+	d.recordStart()
+	record, err := d.service.DaemonRecord()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record == nil || !record.StartedAt.Equal(startedAt) || record.PID != os.Getpid() ||
+		record.ConfigHash != d.config.Hash() || record.StoppedAt != nil {
+		t.Fatalf("expected the record of the started daemon, got %+v", record)
+	}
+
+	fake.Advance(time.Hour)
+	d.recordStop()
+	record, err = d.service.DaemonRecord()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.StoppedAt == nil || !record.StoppedAt.Equal(startedAt.Add(time.Hour)) {
+		t.Errorf("expected the daemon stopped an hour later, got %+v", record)
+	}
+}
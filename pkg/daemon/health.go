@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// healthHandler serves /healthz, answering while the process runs; /readyz, answering once the
+// startup checks passed and the jobs are scheduled, until shutdown begins or a critical health
+// probe fails; and /status, the DaemonStatus as JSON
+func (d *Daemon) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, http.StatusOK, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !d.ready.Load() {
+			writeProbe(w, http.StatusServiceUnavailable, "not ready")
+			return
+		}
+		if failing := d.failingProbes(); len(failing) > 0 {
+			writeProbe(w, http.StatusServiceUnavailable, "not ready: "+strings.Join(failing, ", ")+" failing")
+			return
+		}
+		writeProbe(w, http.StatusOK, "ready")
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		// The service status queries the DigitalOcean API and the sources
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		status, err := d.GetStatus(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			d.logger.Warn("Failed to write status", zap.Error(err))
+		}
+	})
+	return mux
+}
+
+// writeProbe answers a probe with a short plain-text body
+func writeProbe(w http.ResponseWriter, code int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_, _ = fmt.Fprintln(w, body)
+}
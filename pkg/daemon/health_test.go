@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// probe returns the status code the handler answers a request with
+func probe(t *testing.T, handler http.Handler, method, path string) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec.Code
+}
+
+func TestHealthProbes(t *testing.T) {
+	d, signals := newTestDaemon(t)
+	handler := d.healthHandler()
+
+	if code := probe(t, handler, http.MethodGet, "/healthz"); code != http.StatusOK {
+		t.Errorf("expected /healthz to answer 200, got %d", code)
+	}
+	if code := probe(t, handler, http.MethodPost, "/healthz"); code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST /healthz to answer 405, got %d", code)
+	}
+	if code := probe(t, handler, http.MethodGet, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected /readyz to answer 503 before the scheduler starts, got %d", code)
+	}
+
+	done := runDaemon(context.Background(), t, d)
+
+	deadline := time.Now().Add(time.Second)
+	for probe(t, handler, http.MethodGet, "/readyz") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("expected /readyz to answer 200 once the scheduler started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	signals <- syscall.SIGTERM
+	<-done
+
+	if code := probe(t, handler, http.MethodGet, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected /readyz to answer 503 after shutdown, got %d", code)
+	}
+	if code := probe(t, handler, http.MethodGet, "/healthz"); code != http.StatusOK {
+		t.Errorf("expected /healthz to keep answering 200, got %d", code)
+	}
+}
@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/invite"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/server"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"go.uber.org/zap"
+)
+
+// grantExpirySchedule is how often the addresses of expired invites and self-service grants are removed
+const grantExpirySchedule = "@every 1m"
+
+// grantExpiryJob names the scheduled job removing the addresses of expired grants
+const grantExpiryJob = "access-grant-expiry"
+
+// invitePage asks the visitor to confirm, so link previews fetching the URL do not redeem it
+const invitePage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Firewall access</title></head>
+<body>
+<p>Allow your IP address %s through the firewall on port %d?</p>
+<form method="post"><button type="submit">Allow my IP</button></form>
+</body>
+</html>
+`
+
+// handleInvite shows the confirmation page on GET and redeems the invite in the URL on POST,
+// allowlisting the visitor's IP
+func (d *Daemon) handleInvite(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, invite.Path)
+	ip := server.ClientIP(r, d.config.Server.TrustProxy)
+	if net.ParseIP(ip) == nil {
+		http.Error(w, "could not determine your IP address", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		inv, err := invite.Verify(token, []byte(d.config.Invites.SigningKey), d.clock.Now())
+		if err != nil {
+			d.writeInviteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintf(w, invitePage, html.EscapeString(ip), inv.Port)
+	case http.MethodPost:
+		grant, err := d.service.RedeemInvite(r.Context(), token, ip)
+		if err != nil {
+			d.writeInviteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintf(w, "Allowed %s on tcp/%d until %s\n", grant.IP, grant.Port, grant.ExpiresAt.Format("2006-01-02 15:04:05 MST"))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeInviteError answers a request for an unusable invite without revealing why beyond what
+// the visitor can act on
+func (d *Daemon) writeInviteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, invite.ErrInvalid):
+		http.Error(w, "invalid invite link", http.StatusForbidden)
+	case errors.Is(err, invite.ErrExpired):
+		http.Error(w, "invite link expired", http.StatusGone)
+	case errors.Is(err, service.ErrInviteRedeemed):
+		http.Error(w, "invite link already used", http.StatusGone)
+	default:
+		d.logger.Error("Failed to redeem invite", zap.Error(err))
+		http.Error(w, "failed to redeem invite", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// listenerServer serves one of the daemon's handlers on an address of its own, apart from the
+// allowlist server, so the health probes and the admin API work in lite mode and without its
+// bearer tokens
+type listenerServer struct {
+	name       string
+	address    string
+	logger     *zap.Logger
+	httpServer *http.Server
+	listener   net.Listener
+}
+
+// newListenerServer creates a server for handler that listens on address once started; name
+// describes what it serves in logs, e.g. health probes
+func newListenerServer(name, address string, handler http.Handler, logger *zap.Logger) *listenerServer {
+	return &listenerServer{
+		name:    name,
+		address: address,
+		logger:  logger,
+		httpServer: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Start listens on the configured address and serves requests in the background
+func (s *listenerServer) Start() error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.address, err)
+	}
+	s.listener = listener
+
+	s.logger.Info("Serving "+s.name+" over HTTP", zap.String("address", listener.Addr().String()))
+
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Server stopped", zap.String("server", s.name), zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the server, waiting for in-flight requests until ctx is done
+func (s *listenerServer) Shutdown(ctx context.Context) error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.httpServer.Shutdown(ctx)
+}
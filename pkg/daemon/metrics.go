@@ -0,0 +1,218 @@
+package daemon
+
+import (
+	"sort"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/metrics"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"go.uber.org/zap"
+)
+
+// newMetricsRegistry creates the registry served at /metrics with the daemon's collectors
+func (d *Daemon) newMetricsRegistry(logger *zap.Logger) *metrics.Registry {
+	registry := metrics.NewRegistry(d.config.Metrics.Namespace, d.config.Metrics.Labels, logger)
+	registry.Register(d.collectSourceMetrics)
+	registry.Register(d.collectSchedulerMetrics)
+	registry.Register(d.collectRunMetrics)
+	registry.Register(d.collectSourceTrendMetrics)
+	registry.Register(d.collectProbeMetrics)
+	return registry
+}
+
+// recordSourceIPs keeps the latest collected addresses for the metrics collector
+func (d *Daemon) recordSourceIPs(ips *service.SourceIPs) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sourceIPs = ips
+}
+
+// collectSourceMetrics reports the collected address counts, per source unless source labels are
+// disabled to keep a single series per metric
+func (d *Daemon) collectSourceMetrics() []metrics.Family {
+	d.mu.Lock()
+	ips := d.sourceIPs
+	d.mu.Unlock()
+
+	if ips == nil {
+		return nil
+	}
+
+	entries := ips.Entries()
+	families := []metrics.Family{{
+		Name:    "allowlist_addresses",
+		Help:    "Addresses in the most recently collected allowlist",
+		Type:    metrics.TypeGauge,
+		Samples: []metrics.Sample{{Value: float64(len(entries))}},
+	}}
+
+	if !d.config.Metrics.SourceLabels {
+		return families
+	}
+
+	counts := ips.Counts()
+	sources := make([]string, 0, len(counts))
+	for source := range counts {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	perSource := metrics.Family{
+		Name: "source_addresses",
+		Help: "Addresses every source returned in the most recent collection",
+		Type: metrics.TypeGauge,
+	}
+	for _, source := range sources {
+		perSource.Samples = append(perSource.Samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "source", Value: source}},
+			Value:  float64(counts[source]),
+		})
+	}
+	return append(families, perSource)
+}
+
+// collectSchedulerMetrics reports the run counters and drift of every scheduled job
+func (d *Daemon) collectSchedulerMetrics() []metrics.Family {
+	runs := metrics.Family{Name: "scheduler_runs_total", Help: "Started runs of the scheduled job", Type: metrics.TypeCounter}
+	missed := metrics.Family{Name: "scheduler_missed_runs_total", Help: "Scheduled runs skipped entirely", Type: metrics.TypeCounter}
+	catchUp := metrics.Family{Name: "scheduler_catch_up_runs_total", Help: "Runs started to make up for missed runs", Type: metrics.TypeCounter}
+	drift := metrics.Family{Name: "scheduler_last_drift_seconds", Help: "Delay of the last run behind its schedule", Type: metrics.TypeGauge}
+
+	for _, job := range d.scheduler.Metrics() {
+		labels := []metrics.Label{{Name: "job_name", Value: job.Name}}
+		runs.Samples = append(runs.Samples, metrics.Sample{Labels: labels, Value: float64(job.Runs)})
+		missed.Samples = append(missed.Samples, metrics.Sample{Labels: labels, Value: float64(job.MissedRuns)})
+		catchUp.Samples = append(catchUp.Samples, metrics.Sample{Labels: labels, Value: float64(job.CatchUpRuns)})
+		drift.Samples = append(drift.Samples, metrics.Sample{Labels: labels, Value: job.LastDrift.Seconds()})
+	}
+	return []metrics.Family{runs, missed, catchUp, drift}
+}
+
+// collectRunMetrics reports when the firewall was last updated successfully, per firewall when
+// further firewalls are configured
+func (d *Daemon) collectRunMetrics() []metrics.Family {
+	family := metrics.Family{
+		Name: "last_success_timestamp_seconds",
+		Help: "Unix time of the last successful firewall update",
+		Type: metrics.TypeGauge,
+	}
+
+	if len(d.config.DigitalOcean.Firewalls) == 0 {
+		last, err := d.service.LastSuccessfulRun()
+		if err != nil {
+			d.logger.Warn("Failed to read last successful run for metrics", zap.Error(err))
+			return nil
+		}
+		if last.IsZero() {
+			return nil
+		}
+		family.Samples = []metrics.Sample{{Value: float64(last.Unix())}}
+		return []metrics.Family{family}
+	}
+
+	runs, err := d.service.LastSuccessfulRuns()
+	if err != nil {
+		d.logger.Warn("Failed to read last successful runs for metrics", zap.Error(err))
+		return nil
+	}
+	for _, target := range d.config.DigitalOcean.Targets() {
+		last, ok := runs[target.ID]
+		if !ok {
+			continue
+		}
+		family.Samples = append(family.Samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "firewall_id", Value: target.ID}},
+			Value:  float64(last.Unix()),
+		})
+	}
+	if len(family.Samples) == 0 {
+		return nil
+	}
+	return []metrics.Family{family}
+}
+
+// collectSourceTrendMetrics reports how much every source's address set changed between its last
+// two collections, the value trends.max-change-percent alerts on
+func (d *Daemon) collectSourceTrendMetrics() []metrics.Family {
+	if !d.config.Metrics.SourceLabels {
+		return nil
+	}
+
+	changes, err := d.service.SourceSizeChanges()
+	if err != nil {
+		d.logger.Warn("Failed to read source sizes for metrics", zap.Error(err))
+		return nil
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	sources := make([]string, 0, len(changes))
+	for source := range changes {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	family := metrics.Family{
+		Name: "source_size_change_percent",
+		Help: "Size change of the source's address set between its last two collections",
+		Type: metrics.TypeGauge,
+	}
+	for _, source := range sources {
+		family.Samples = append(family.Samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "source", Value: source}},
+			Value:  changes[source],
+		})
+	}
+	return []metrics.Family{family}
+}
+
+// collectProbeMetrics reports the outcome of the latest health probe round, per probe unless
+// source labels are disabled
+func (d *Daemon) collectProbeMetrics() []metrics.Family {
+	d.mu.Lock()
+	checks, probedAt := d.probes, d.probedAt
+	d.mu.Unlock()
+
+	if probedAt.IsZero() {
+		return nil
+	}
+
+	failures := 0
+	for _, check := range checks {
+		if check.Err != nil {
+			failures++
+		}
+	}
+	families := []metrics.Family{
+		{
+			Name:    "health_probe_failures",
+			Help:    "Health probes that failed in the latest round",
+			Type:    metrics.TypeGauge,
+			Samples: []metrics.Sample{{Value: float64(failures)}},
+		},
+		{
+			Name:    "health_probe_timestamp_seconds",
+			Help:    "Unix time of the latest health probe round",
+			Type:    metrics.TypeGauge,
+			Samples: []metrics.Sample{{Value: float64(probedAt.Unix())}},
+		},
+	}
+
+	if !d.config.Metrics.SourceLabels {
+		return families
+	}
+
+	up := metrics.Family{Name: "health_probe_up", Help: "Whether the health probe passed in the latest round", Type: metrics.TypeGauge}
+	duration := metrics.Family{Name: "health_probe_duration_seconds", Help: "Duration of the health probe in the latest round", Type: metrics.TypeGauge}
+	for _, check := range checks {
+		labels := []metrics.Label{{Name: "probe", Value: check.Name}}
+		value := 1.0
+		if check.Err != nil {
+			value = 0
+		}
+		up.Samples = append(up.Samples, metrics.Sample{Labels: labels, Value: value})
+		duration.Samples = append(duration.Samples, metrics.Sample{Labels: labels, Value: check.Duration.Seconds()})
+	}
+	return append(families, up, duration)
+}
@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"go.uber.org/zap"
+)
+
+// startHealthProbes checks the DigitalOcean API and every source every health.interval, without
+// updating the firewalls, until the daemon shuts down
+func (d *Daemon) startHealthProbes() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	d.stopProbes = func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		d.probeHealth(ctx, d.service.ProbeHealth)
+	}()
+}
+
+// probeHealth runs the probe right away and then every health.interval, each bounded by the
+// interval so a hanging source cannot delay the next one
+func (d *Daemon) probeHealth(ctx context.Context, probe func(context.Context) []service.Check) {
+	for {
+		probeCtx, cancel := context.WithTimeout(ctx, d.config.Health.Interval)
+		start := d.clock.Now()
+		checks := probe(probeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		d.recordProbes(checks, start)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(d.config.Health.Interval):
+		}
+	}
+}
+
+// recordProbes keeps the latest probe results for /readyz and the metrics, logging the probes
+// that started failing or recovered since the previous round
+func (d *Daemon) recordProbes(checks []service.Check, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	failing := make(map[string]bool, len(d.probes))
+	for _, check := range d.probes {
+		failing[check.Name] = check.Err != nil
+	}
+	for _, check := range checks {
+		wasFailing, seen := failing[check.Name]
+		switch {
+		case check.Err != nil && !wasFailing:
+			d.logger.Warn("Health probe failing",
+				zap.String("probe", check.Name),
+				zap.Bool("critical", check.Critical),
+				zap.Error(check.Err))
+		case check.Err == nil && seen && wasFailing:
+			d.logger.Info("Health probe recovered", zap.String("probe", check.Name))
+		}
+	}
+
+	d.probes = checks
+	d.probedAt = at
+}
+
+// failingProbes returns the names of the critical probes that failed in the latest round, those
+// whose outage fails the next run
+func (d *Daemon) failingProbes() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var names []string
+	for _, check := range d.probes {
+		if check.Critical && check.Err != nil {
+			names = append(names, check.Name)
+		}
+	}
+	return names
+}
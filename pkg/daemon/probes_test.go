@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+)
+
+func TestProbeHealth(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC))
+
+	d, _ := newTestDaemon(t)
+	d.clock = fake
+	d.config.Health.Interval = 30 * time.Second
+	d.ready.Store(true)
+	handler := d.healthHandler()
+
+	outage := errors.New("connection refused")
+	rounds := make(chan []service.Check)
+	check := func(ctx context.Context) []service.Check {
+		select {
+		case checks := <-rounds:
+			return checks
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.probeHealth(ctx, check)
+	}()
+
+	for _, tc := range []struct {
+		name     string
+		checks   []service.Check
+		expected []string
+	}{
+		{
+			name:   "all passing",
+			checks: []service.Check{{Name: "digitalocean:fw-1", Critical: true}, {Name: "source:cloudflare", Critical: true}},
+		},
+		{
+			name: "optional source failing",
+			checks: []service.Check{
+				{Name: "digitalocean:fw-1", Critical: true},
+				{Name: "source:cloudflare", Critical: true},
+				{Name: "source:office", Err: outage},
+			},
+		},
+		{
+			name: "critical probes failing",
+			checks: []service.Check{
+				{Name: "digitalocean:fw-1", Critical: true, Err: outage},
+				{Name: "source:cloudflare", Critical: true, Err: outage},
+			},
+			expected: []string{"digitalocean:fw-1", "source:cloudflare"},
+		},
+		{
+			name:   "recovered",
+			checks: []service.Check{{Name: "digitalocean:fw-1", Critical: true}, {Name: "source:cloudflare", Critical: true}},
+		},
+	} {
+		rounds <- tc.checks
+		// The next round waits for the interval once this one is recorded
+		fake.BlockUntil(1)
+
+		if failing := d.failingProbes(); !reflect.DeepEqual(failing, tc.expected) {
+			t.Errorf("%s: expected failing probes %v, got %v", tc.name, tc.expected, failing)
+		}
+		expectedCode := http.StatusOK
+		if len(tc.expected) > 0 {
+			expectedCode = http.StatusServiceUnavailable
+		}
+		if code := probe(t, handler, http.MethodGet, "/readyz"); code != expectedCode {
+			t.Errorf("%s: expected /readyz to answer %d, got %d", tc.name, expectedCode, code)
+		}
+		fake.Advance(d.config.Health.Interval)
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+	"go.uber.org/zap"
+)
+
+// startReconcile polls the sources every reconcile.interval and reruns the firewall update when
+// the collected addresses changed, besides the runs of cron.schedule, until the daemon shuts down
+func (d *Daemon) startReconcile(job scheduler.JobFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	d.stopReconcile = func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		d.reconcileOnChange(ctx, d.service.SourceHash, job)
+	}()
+}
+
+// reconcileOnChange runs the job when the hash returned by poll differs from the one of the last
+// update it ran, no sooner than reconcile.min-apply-interval after that update. The first poll
+// only records the hash, the scheduled runs keep the firewalls current until the sources change
+func (d *Daemon) reconcileOnChange(ctx context.Context, poll func(context.Context) (string, error), job scheduler.JobFunc) {
+	var (
+		applied   string
+		appliedAt time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(d.config.Reconcile.Interval):
+		}
+
+		hash, err := poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			d.logger.Warn("Failed to poll the sources, retrying at the next interval", zap.Error(err))
+			continue
+		}
+		if applied == "" {
+			applied = hash
+			continue
+		}
+		if hash == applied {
+			continue
+		}
+
+		now := d.clock.Now()
+		if wait := d.config.Reconcile.MinApplyInterval - now.Sub(appliedAt); !appliedAt.IsZero() && wait > 0 {
+			d.logger.Debug("Sources changed, deferring the update to reconcile.min-apply-interval",
+				zap.Duration("wait", wait))
+			continue
+		}
+
+		d.logger.Info("Sources changed, updating the firewalls",
+			zap.String("source_hash", hash),
+			zap.String("previous_source_hash", applied))
+		appliedAt = now
+		// A run that started finishes even if the daemon shuts down meanwhile, like scheduled runs
+		if err := job(context.WithoutCancel(ctx)); err != nil {
+			d.logger.Error("Reconcile-on-change firewall update failed", zap.Error(err))
+			continue
+		}
+		applied = hash
+	}
+}
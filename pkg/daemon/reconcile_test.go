@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+)
+
+func TestReconcileOnChange(t *testing.T) {
+	start := time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+
+	d, _ := newTestDaemon(t)
+	d.clock = fake
+	d.config.Reconcile.Interval = 10 * time.Second
+	d.config.Reconcile.MinApplyInterval = 30 * time.Second
+
+	polls := make(chan string)
+	poll := func(ctx context.Context) (string, error) {
+		return <-polls, nil
+	}
+
+	var (
+		mu   sync.Mutex
+		runs []time.Duration
+	)
+	job := func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs = append(runs, fake.Now().Sub(start))
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.reconcileOnChange(ctx, poll, job)
+	}()
+
+	// The first poll only records the hash; the change at 40s waits for min-apply-interval
+	for _, hash := range []string{"a", "a", "b", "c", "c", "c", "c"} {
+		fake.BlockUntil(1)
+		fake.Advance(10 * time.Second)
+		polls <- hash
+	}
+	fake.BlockUntil(1)
+	cancel()
+	<-done
+
+	expected := []time.Duration{30 * time.Second, 60 * time.Second}
+	if !reflect.DeepEqual(runs, expected) {
+		t.Errorf("expected updates at %v, got %v", expected, runs)
+	}
+}
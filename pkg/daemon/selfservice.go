@@ -0,0 +1,221 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/server"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sso"
+	"go.uber.org/zap"
+)
+
+// Self-service endpoint paths and cookies
+const (
+	selfServicePath         = "/allow"
+	selfServiceCallbackPath = "/allow/callback"
+	sessionCookieName       = "allowlister_session"
+	loginCookieName         = "allowlister_login"
+	sessionTTL              = time.Hour
+	loginTTL                = 10 * time.Minute
+)
+
+// selfServicePage lets a signed-in user pick one of their policy's ports and a duration
+var selfServicePage = template.Must(template.New("allow").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Firewall access</title></head>
+<body>
+<p>Signed in as {{.Identity}}. Allow your IP address {{.IP}} through the firewall:</p>
+<form method="post">
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+<label>Port <select name="port">{{range .Ports}}<option>{{.}}</option>{{end}}</select></label>
+<label>for <input name="ttl" value="{{.MaxTTL}}"></label> (at most {{.MaxTTL}})
+<button type="submit">Allow my IP</button>
+</form>
+</body>
+</html>
+`))
+
+// newSSOClient creates the sign-in client of the configured self-service provider
+func newSSOClient(cfg *config.Config, logger *zap.Logger) *sso.Client {
+	selfService := cfg.SelfService
+	provider, ok := sso.Providers[selfService.Provider]
+	if !ok {
+		provider = sso.OIDCProvider(selfService.AuthURL, selfService.TokenURL, selfService.UserInfoURL)
+	}
+
+	redirectURL := strings.TrimRight(cfg.Server.PublicURL, "/") + selfServiceCallbackPath
+	return sso.NewClient(provider, selfService.ClientID, selfService.ClientSecret, redirectURL, logger)
+}
+
+// handleSelfService signs the visitor in with the identity provider, then shows the allow form on
+// GET and allowlists the visitor's IP on POST within the limits of their policy
+func (d *Daemon) handleSelfService(w http.ResponseWriter, r *http.Request) {
+	key := []byte(d.config.SelfService.SessionKey)
+
+	cookie, err := r.Cookie(sessionCookieName)
+	var session sso.Session
+	if err == nil {
+		session, err = sso.OpenSession(cookie.Value, key, d.clock.Now())
+	}
+	if err != nil {
+		if r.Method != http.MethodGet {
+			http.Error(w, "session expired, reload the page to sign in again", http.StatusForbidden)
+			return
+		}
+		d.startSignIn(w, r)
+		return
+	}
+
+	ip := server.ClientIP(r, d.config.Server.TrustProxy)
+	if net.ParseIP(ip) == nil {
+		http.Error(w, "could not determine your IP address", http.StatusBadRequest)
+		return
+	}
+
+	policy, ok := d.config.SelfService.PolicyFor(session.Identity)
+	if !ok {
+		http.Error(w, "no self-service access for "+session.Identity, http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := selfServicePage.Execute(w, map[string]interface{}{
+			"Identity": session.Identity,
+			"IP":       ip,
+			"CSRF":     sso.CSRFToken(cookie.Value, key),
+			"Ports":    policy.Ports,
+			"MaxTTL":   policy.MaxTTL.String(),
+		})
+		if err != nil {
+			d.logger.Warn("Failed to render self-service page", zap.Error(err))
+		}
+	case http.MethodPost:
+		if !sso.ValidCSRFToken(r.PostFormValue("csrf"), cookie.Value, key) {
+			http.Error(w, "invalid form, reload the page", http.StatusForbidden)
+			return
+		}
+		port, err := strconv.Atoi(r.PostFormValue("port"))
+		if err != nil {
+			http.Error(w, "invalid port", http.StatusBadRequest)
+			return
+		}
+		ttl, err := time.ParseDuration(r.PostFormValue("ttl"))
+		if err != nil {
+			http.Error(w, "invalid duration, e.g. 30m or 2h", http.StatusBadRequest)
+			return
+		}
+
+		grant, err := d.service.AllowSelfService(r.Context(), session.Identity, ip, port, ttl)
+		if errors.Is(err, service.ErrNotPermitted) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			d.logger.Error("Failed to allow self-service IP", zap.String("identity", session.Identity), zap.Error(err))
+			http.Error(w, "failed to allow your IP", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Allowed %s on tcp/%d until %s\n", grant.IP, grant.Port, grant.ExpiresAt.Format("2006-01-02 15:04:05 MST"))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// startSignIn remembers a new sign-in in a cookie and redirects to the identity provider
+func (d *Daemon) startSignIn(w http.ResponseWriter, r *http.Request) {
+	login, err := sso.NewLogin(loginTTL)
+	if err != nil {
+		d.logger.Error("Failed to start sign-in", zap.Error(err))
+		http.Error(w, "failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+	value, err := sso.Seal(login, []byte(d.config.SelfService.SessionKey))
+	if err != nil {
+		d.logger.Error("Failed to start sign-in", zap.Error(err))
+		http.Error(w, "failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, d.selfServiceCookie(loginCookieName, value, loginTTL))
+	http.Redirect(w, r, d.sso.AuthCodeURL(login.State, login.Verifier), http.StatusFound)
+}
+
+// handleSelfServiceCallback completes the sign-in the identity provider redirected back from and
+// starts a session for users with a policy
+func (d *Daemon) handleSelfServiceCallback(w http.ResponseWriter, r *http.Request) {
+	key := []byte(d.config.SelfService.SessionKey)
+
+	cookie, err := r.Cookie(loginCookieName)
+	var login sso.Login
+	if err == nil {
+		login, err = sso.OpenLogin(cookie.Value, key, d.clock.Now())
+	}
+	state := r.URL.Query().Get("state")
+	if err != nil || subtle.ConstantTimeCompare([]byte(state), []byte(login.State)) != 1 {
+		http.Error(w, "sign-in expired, start again at "+selfServicePath, http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, d.selfServiceCookie(loginCookieName, "", -1))
+
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		http.Error(w, "sign-in failed: "+reason, http.StatusForbidden)
+		return
+	}
+
+	identity, err := d.sso.Exchange(r.Context(), r.URL.Query().Get("code"), login.Verifier)
+	if err != nil {
+		d.logger.Warn("Self-service sign-in failed", zap.Error(err))
+		http.Error(w, "sign-in failed", http.StatusForbidden)
+		return
+	}
+
+	name := identity.Name()
+	if _, ok := d.config.SelfService.PolicyFor(name); !ok {
+		d.logger.Warn("Signed-in user has no self-service policy", zap.String("identity", name))
+		http.Error(w, "no self-service access for "+name, http.StatusForbidden)
+		return
+	}
+
+	value, err := sso.Seal(sso.Session{Identity: name, ExpiresAt: d.clock.Now().Add(sessionTTL)}, key)
+	if err != nil {
+		d.logger.Error("Failed to start self-service session", zap.Error(err))
+		http.Error(w, "failed to sign in", http.StatusInternalServerError)
+		return
+	}
+
+	d.logger.Info("User signed in to self-service", zap.String("identity", name))
+	http.SetCookie(w, d.selfServiceCookie(sessionCookieName, value, sessionTTL))
+	http.Redirect(w, r, selfServicePath, http.StatusSeeOther)
+}
+
+// selfServiceCookie creates a cookie scoped to the self-service endpoint; a negative maxAge
+// deletes it
+func (d *Daemon) selfServiceCookie(name, value string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     selfServicePath,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(d.config.Server.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
@@ -0,0 +1,156 @@
+package daemon
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/service"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// SimulatedRun is a scheduled run of a simulation and what it would act on
+type SimulatedRun struct {
+	scheduler.Run
+	// Firewalls holds the rule activity of every firewall for firewall update and window runs
+	Firewalls []SimulatedFirewall `json:"firewalls,omitempty"`
+	// ExpiredGrants holds the grants whose TTL ran out since the previous expiry run
+	ExpiredGrants []state.AccessGrant `json:"expired_grants,omitempty"`
+}
+
+// Changes reports whether the run adds or removes a rule or expires a grant
+func (r SimulatedRun) Changes() bool {
+	if len(r.ExpiredGrants) > 0 {
+		return true
+	}
+	for _, firewall := range r.Firewalls {
+		if len(firewall.Opened) > 0 || len(firewall.Removed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SimulatedFirewall lists the rules of a firewall inside and outside their access windows,
+// as protocol/port, and the rules the run adds or removes since the previous firewall run
+type SimulatedFirewall struct {
+	ID       string   `json:"id"`
+	Active   []string `json:"active"`
+	Inactive []string `json:"inactive,omitempty"`
+	Opened   []string `json:"opened,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+// Simulate moves a fake clock from start through every run the daemon would schedule within
+// duration, evaluating access windows and grant expiry at each run against the state file. It
+// contacts no API and changes nothing; grant expiry runs are only reported when a grant expires,
+// and the rule changes of a firewall run are relative to the previous one or to start.
+func Simulate(cfg *config.Config, logger *zap.Logger, start time.Time, duration time.Duration) ([]SimulatedRun, error) {
+	fake := clock.NewFake(start)
+
+	sched, err := scheduler.NewScheduler(cfg.Cron.Timezone, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduler: %w", err)
+	}
+	sched.SetClock(fake)
+
+	svc := service.NewService(cfg, logger, true)
+	svc.SetClock(fake)
+
+	d := &Daemon{
+		config:    cfg,
+		service:   svc,
+		scheduler: sched,
+		logger:    logger.Named("daemon"),
+		dryRun:    true,
+		clock:     fake,
+	}
+	if _, err := d.addJobs(); err != nil {
+		return nil, err
+	}
+
+	// The rules active at the start are what the first firewall run compares against
+	previous, err := d.simulateFirewalls(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []SimulatedRun
+	expired := make(map[string]bool)
+	for _, run := range sched.Upcoming(start.Add(duration)) {
+		fake.Set(run.At)
+		simulated := SimulatedRun{Run: run}
+
+		switch {
+		case run.Job == grantExpiryJob:
+			due, err := svc.DueAccessGrants()
+			if err != nil {
+				return nil, err
+			}
+			for _, grant := range due {
+				if !expired[grant.ID] {
+					expired[grant.ID] = true
+					simulated.ExpiredGrants = append(simulated.ExpiredGrants, grant)
+				}
+			}
+			if len(simulated.ExpiredGrants) == 0 {
+				continue
+			}
+		case run.Job == firewallUpdateJob || strings.HasPrefix(run.Job, "window-"):
+			simulated.Firewalls, err = d.simulateFirewalls(previous)
+			if err != nil {
+				return nil, err
+			}
+			previous = simulated.Firewalls
+		}
+
+		runs = append(runs, simulated)
+	}
+	return runs, nil
+}
+
+// simulateFirewalls evaluates the access windows of every firewall's rules at the clock's time,
+// comparing them with the previous evaluation
+func (d *Daemon) simulateFirewalls(previous []SimulatedFirewall) ([]SimulatedFirewall, error) {
+	var firewalls []SimulatedFirewall
+	for i, target := range d.config.DigitalOcean.Targets() {
+		firewall := SimulatedFirewall{ID: target.ID}
+		for _, rule := range target.InboundRules {
+			active, err := d.service.RuleActive(rule)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate access window for port %d: %w", rule.Port, err)
+			}
+
+			for _, protocol := range rule.Protocols() {
+				label := fmt.Sprintf("%s/%d", protocol, rule.Port)
+				if active {
+					firewall.Active = append(firewall.Active, label)
+				} else {
+					firewall.Inactive = append(firewall.Inactive, label)
+				}
+			}
+		}
+		if i < len(previous) {
+			firewall.Opened = missingFrom(firewall.Active, previous[i].Active)
+			firewall.Removed = missingFrom(previous[i].Active, firewall.Active)
+		}
+		firewalls = append(firewalls, firewall)
+	}
+	return firewalls, nil
+}
+
+// missingFrom returns the values of a that b does not hold
+func missingFrom(a, b []string) []string {
+	var missing []string
+	for _, value := range a {
+		if !slices.Contains(b, value) {
+			missing = append(missing, value)
+		}
+	}
+	return missing
+}
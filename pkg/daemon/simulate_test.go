@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSimulate(t *testing.T) {
+	day := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+
+	cfg := &config.Config{}
+	cfg.Cron.Schedule = "0 * * * *"
+	cfg.Cron.Timezone = "UTC"
+	cfg.DigitalOcean.FirewallID = "fw-1"
+	cfg.DigitalOcean.InboundRules = []config.InboundRule{
+		{Port: 443, Protocol: "tcp"},
+		{Port: 22, Protocol: "tcp", Window: config.AccessWindow{Open: "0 9 * * *", Close: "0 17 * * *"}},
+	}
+	cfg.Invites.SigningKey = "test-key"
+	cfg.State.Path = filepath.Join(t.TempDir(), "state.json")
+
+	store := state.NewStore(cfg.State.Path, zaptest.NewLogger(t))
+	if err := store.Update(func(st *state.State) error {
+		st.AccessGrants = append(st.AccessGrants, state.AccessGrant{
+			ID:         "grant-1",
+			Kind:       state.GrantInvite,
+			FirewallID: "fw-1",
+			Port:       22,
+			IP:         "203.0.113.5",
+			ExpiresAt:  day.Add(9*time.Hour + 15*time.Minute),
+		})
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to record grant: %v", err)
+	}
+
+	runs, err := Simulate(cfg, zaptest.NewLogger(t), day.Add(7*time.Hour+30*time.Minute), 150*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	closed := []SimulatedFirewall{{ID: "fw-1", Active: []string{"tcp/443"}, Inactive: []string{"tcp/22"}}}
+	open := []SimulatedFirewall{{ID: "fw-1", Active: []string{"tcp/443", "tcp/22"}}}
+	// The first run inside the window adds the rule, the window job at the same time finds it open
+	opening := []SimulatedFirewall{{ID: "fw-1", Active: []string{"tcp/443", "tcp/22"}, Opened: []string{"tcp/22"}}}
+	expected := []struct {
+		job       string
+		at        time.Time
+		firewalls []SimulatedFirewall
+		grants    int
+	}{
+		{job: "firewall-update", at: day.Add(8 * time.Hour), firewalls: closed},
+		{job: "firewall-update", at: day.Add(9 * time.Hour), firewalls: opening},
+		{job: "window-open-tcp-22", at: day.Add(9 * time.Hour), firewalls: open},
+		{job: "access-grant-expiry", at: day.Add(9*time.Hour + 15*time.Minute), grants: 1},
+		{job: "firewall-update", at: day.Add(10 * time.Hour), firewalls: open},
+	}
+
+	if len(runs) != len(expected) {
+		t.Fatalf("expected %d runs, got %+v", len(expected), runs)
+	}
+	for i, run := range runs {
+		want := expected[i]
+		if run.Job != want.job || !run.At.Equal(want.at) {
+			t.Errorf("expected run %d to be %s at %s, got %s at %s", i, want.job, want.at, run.Job, run.At)
+		}
+		if !reflect.DeepEqual(run.Firewalls, want.firewalls) {
+			t.Errorf("expected run %d to see %+v, got %+v", i, want.firewalls, run.Firewalls)
+		}
+		if len(run.ExpiredGrants) != want.grants {
+			t.Errorf("expected run %d to expire %d grants, got %d", i, want.grants, len(run.ExpiredGrants))
+		}
+	}
+}
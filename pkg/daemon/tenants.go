@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// StartAll runs the daemons of several tenants side by side until a shutdown signal or ctx is
+// done; a tenant failing to start is logged without stopping the others, and an error is only
+// returned if no tenant could start
+func StartAll(ctx context.Context, daemons []*Daemon) error {
+	if len(daemons) == 1 {
+		return daemons[0].Start(ctx)
+	}
+
+	errs := make(chan error, len(daemons))
+	for _, d := range daemons {
+		go func(d *Daemon) {
+			err := d.Start(ctx)
+			if err != nil {
+				d.logger.Error("Tenant daemon failed, other tenants keep running", zap.Error(err))
+				err = fmt.Errorf("tenant %s: %w", d.config.Tenant, err)
+			}
+			errs <- err
+		}(d)
+	}
+
+	var failures []error
+	for range daemons {
+		if err := <-errs; err != nil {
+			failures = append(failures, err)
+		}
+	}
+	if len(failures) == len(daemons) {
+		return errors.Join(failures...)
+	}
+	return nil
+}
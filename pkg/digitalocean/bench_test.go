@@ -0,0 +1,119 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap"
+)
+
+// benchSources returns n distinct IPv4 and IPv6 CIDR blocks, as large provider feeds look
+func benchSources(n int) []string {
+	sources := make([]string, 0, n)
+	for i := 0; len(sources) < n; i++ {
+		sources = append(sources, fmt.Sprintf("%d.%d.%d.0/24", 11+i/65536%200, i/256%256, i%256))
+		if len(sources) < n {
+			sources = append(sources, fmt.Sprintf("2a00:%x:%x::/48", i/65536, i%65536))
+		}
+	}
+	return sources
+}
+
+// benchRules returns inbound rules for ports 8000 and up, each allowing every source
+func benchRules(ports int, sources []string) []godo.InboundRule {
+	rules := make([]godo.InboundRule, 0, ports)
+	for port := 0; port < ports; port++ {
+		rules = append(rules, godo.InboundRule{
+			Protocol:  "tcp",
+			PortRange: fmt.Sprintf("%d", 8000+port),
+			Sources:   &godo.Sources{Addresses: sources},
+		})
+	}
+	return rules
+}
+
+func BenchmarkValidateAndNormalizeSources(b *testing.B) {
+	client := &Client{logger: zap.NewNop()}
+	sources := benchSources(20000)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.validateAndNormalizeSources(sources); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompactPortRules(b *testing.B) {
+	sources := benchSources(20000)
+	var rules []FirewallRule
+	for port := 0; port < 50; port++ {
+		rules = append(rules, FirewallRule{Port: 8000 + port, Protocol: "tcp", Sources: sources})
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if compacted := compactPortRules(rules); len(compacted) != 1 {
+			b.Fatalf("expected one port range, got %v", compacted)
+		}
+	}
+}
+
+func BenchmarkSummarizeChanges(b *testing.B) {
+	sources := benchSources(20000)
+	firewall := &godo.Firewall{ID: "fw-1", InboundRules: benchRules(10, sources)}
+	// One in a hundred sources is replaced
+	changed := append([]string{}, sources...)
+	for i := 0; i < len(changed); i += 100 {
+		changed[i] = fmt.Sprintf("198.18.%d.%d/32", i/256%256, i%256)
+	}
+	newRules := benchRules(10, changed)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		SummarizeChanges(firewall, newRules)
+	}
+}
+
+func BenchmarkLostAdminAccess(b *testing.B) {
+	sources := benchSources(20000)
+	current := append(benchRules(10, sources), godo.InboundRule{
+		Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: append([]string{"203.0.113.0/24"}, sources...)},
+	})
+	newRules := benchRules(10, sources)
+	access := AdminAccess{
+		Ports:   []int{22, 8000, 8005},
+		Sources: []string{"203.0.113.7", "203.0.113.8", "11.0.1.0/24", "2a00:0:1::/64"},
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if lost := LostAdminAccess(current, newRules, access); len(lost) != 4 {
+			b.Fatalf("expected every admin source to lose access to port 22, got %v", lost)
+		}
+	}
+}
+
+func BenchmarkUpdateFirewallRules(b *testing.B) {
+	sources := benchSources(20000)
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web", InboundRules: benchRules(10, sources)})
+	client := newTestClient(b, api)
+	client.logger = zap.NewNop()
+	client.compactRules = true
+	client.adminAccess = &AdminAccess{Ports: []int{8000}, Sources: []string{"11.0.1.0/24"}}
+
+	var rules []FirewallRule
+	for port := 0; port < 10; port++ {
+		rules = append(rules, FirewallRule{Port: 8000 + port, Protocol: "tcp", Sources: sources})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := client.UpdateFirewallRules(context.Background(), "fw-1", rules, sources); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
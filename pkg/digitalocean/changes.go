@@ -0,0 +1,374 @@
+package digitalocean
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/tracecontext"
+	"go.uber.org/zap"
+)
+
+// ChangeSummary describes the effect of replacing a firewall's inbound rules
+type ChangeSummary struct {
+	FirewallID       string
+	FirewallName     string
+	AddedAddresses   []string // "protocol/port address" entries gained
+	RemovedAddresses []string // "protocol/port address" entries lost
+	RemovedRules     []string // "protocol/port" rules deleted entirely
+}
+
+// IsDestructive reports whether the change deletes rules or removes more than maxRemovedAddresses addresses
+func (s ChangeSummary) IsDestructive(maxRemovedAddresses int) bool {
+	return len(s.RemovedRules) > 0 || len(s.RemovedAddresses) > maxRemovedAddresses
+}
+
+// HasChanges reports whether any address or rule is added or removed
+func (s ChangeSummary) HasChanges() bool {
+	return len(s.AddedAddresses) > 0 || len(s.RemovedAddresses) > 0 || len(s.RemovedRules) > 0
+}
+
+// ConfirmFunc is called with the pending changes before a firewall update; returning an error aborts it
+type ConfirmFunc func(changes ChangeSummary) error
+
+// SetConfirmFunc installs a hook consulted before every firewall update
+func (c *Client) SetConfirmFunc(fn ConfirmFunc) {
+	c.confirm = fn
+}
+
+// SummarizeChanges compares two inbound rule sets by protocol, port range and address
+func SummarizeChanges(firewall *godo.Firewall, newRules []godo.InboundRule) ChangeSummary {
+	summary := ChangeSummary{
+		FirewallID:   firewall.ID,
+		FirewallName: firewall.Name,
+	}
+
+	current := ruleAddressLists(firewall.InboundRules)
+	desired := ruleAddressLists(newRules)
+
+	for key, addresses := range current {
+		desiredAddresses, ok := desired[key]
+		if !ok {
+			summary.RemovedRules = append(summary.RemovedRules, key)
+		}
+		removed, added := diffSorted(addresses, desiredAddresses)
+		for _, address := range removed {
+			summary.RemovedAddresses = append(summary.RemovedAddresses, key+" "+address)
+		}
+		for _, address := range added {
+			summary.AddedAddresses = append(summary.AddedAddresses, key+" "+address)
+		}
+	}
+
+	for key, addresses := range desired {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		for _, address := range addresses {
+			summary.AddedAddresses = append(summary.AddedAddresses, key+" "+address)
+		}
+	}
+
+	sort.Strings(summary.AddedAddresses)
+	sort.Strings(summary.RemovedAddresses)
+	sort.Strings(summary.RemovedRules)
+
+	return summary
+}
+
+// changeLabels picks the labels of the added and removed addresses, nil if none has one
+func changeLabels(labels map[string]audit.Label, changes ChangeSummary) map[string]audit.Label {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	// Rules hold canonical prefixes, 203.0.113.5 of a network being 203.0.113.5/32
+	canonical := make(map[string]audit.Label, len(labels))
+	for address, label := range labels {
+		if prefix, err := canonicalSource(address); err == nil {
+			canonical[prefix.String()] = label
+		}
+	}
+
+	var picked map[string]audit.Label
+	for _, change := range slices.Concat(changes.AddedAddresses, changes.RemovedAddresses) {
+		// Changes are "protocol/port address"
+		address := change[strings.LastIndex(change, " ")+1:]
+		if label, ok := canonical[address]; ok {
+			if picked == nil {
+				picked = make(map[string]audit.Label)
+			}
+			picked[address] = label
+		}
+	}
+	return picked
+}
+
+// ruleAddressLists indexes inbound rule addresses by "protocol/port", sorted and deduplicated;
+// a rule listing the same addresses as the previous one, as every managed rule does, reuses its
+// sorted list rather than sorting tens of thousands of addresses again
+func ruleAddressLists(rules []godo.InboundRule) map[string][]string {
+	lists := make(map[string][]string)
+	var previous, previousSorted []string
+	for _, rule := range rules {
+		key := rule.Protocol + "/" + rule.PortRange
+		var addresses []string
+		if rule.Sources != nil {
+			addresses = rule.Sources.Addresses
+		}
+
+		existing, ok := lists[key]
+		if !ok && previousSorted != nil && slices.Equal(addresses, previous) {
+			lists[key] = previousSorted
+			continue
+		}
+
+		// The lists may be shared between keys, so merging into one always copies
+		sorted := append(append(make([]string, 0, len(existing)+len(addresses)), existing...), addresses...)
+		slices.Sort(sorted)
+		sorted = slices.Compact(sorted)
+		lists[key] = sorted
+		if !ok {
+			previous, previousSorted = addresses, sorted
+		}
+	}
+	return lists
+}
+
+// diffSorted returns the entries only in a and only in b, merging the two sorted lists in one pass
+func diffSorted(a, b []string) (onlyA, onlyB []string) {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case a[i] < b[j]:
+			onlyA = append(onlyA, a[i])
+			i++
+		default:
+			onlyB = append(onlyB, b[j])
+			j++
+		}
+	}
+	onlyA = append(onlyA, a[i:]...)
+	onlyB = append(onlyB, b[j:]...)
+	return onlyA, onlyB
+}
+
+// RulesFingerprint returns a stable hash of the inbound rules' protocols, port ranges and addresses
+func RulesFingerprint(rules []godo.InboundRule) string {
+	lists := ruleAddressLists(rules)
+	keys := make([]string, 0, len(lists))
+	for key := range lists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Hashes the sorted "protocol/port" and "protocol/port address" entries joined by newlines;
+	// port ranges never contain a space, so every key sorts right before its own addresses
+	h := sha256.New()
+	for i, key := range keys {
+		if i > 0 {
+			h.Write([]byte("\n"))
+		}
+		h.Write([]byte(key))
+		for _, address := range lists[key] {
+			h.Write([]byte("\n" + key + " " + address))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RulesUnchanged reports whether replacing the firewall's inbound rules with the summarized ones
+// leaves every protocol and port range allowing the same addresses, droplets, tags, load balancers
+// and Kubernetes clusters, so the update can be skipped
+func RulesUnchanged(firewall *godo.Firewall, newRules []godo.InboundRule, changes ChangeSummary) bool {
+	return !changes.HasChanges() && maps.EqualFunc(ruleTargets(firewall.InboundRules), ruleTargets(newRules), slices.Equal)
+}
+
+// ruleTargets indexes the sources of inbound rules other than addresses by "protocol/port",
+// sorted and deduplicated
+func ruleTargets(rules []godo.InboundRule) map[string][]string {
+	targets := make(map[string][]string)
+	for _, rule := range rules {
+		if rule.Sources == nil {
+			continue
+		}
+
+		key := rule.Protocol + "/" + rule.PortRange
+		for _, id := range rule.Sources.DropletIDs {
+			targets[key] = append(targets[key], fmt.Sprintf("droplet:%d", id))
+		}
+		for _, tag := range rule.Sources.Tags {
+			targets[key] = append(targets[key], "tag:"+tag)
+		}
+		for _, uid := range rule.Sources.LoadBalancerUIDs {
+			targets[key] = append(targets[key], "load_balancer:"+uid)
+		}
+		for _, id := range rule.Sources.KubernetesIDs {
+			targets[key] = append(targets[key], "kubernetes:"+id)
+		}
+	}
+	for key, list := range targets {
+		slices.Sort(list)
+		targets[key] = slices.Compact(list)
+	}
+	return targets
+}
+
+// replaceInboundRules updates the firewall with new inbound rules, preserving everything else
+func (c *Client) replaceInboundRules(ctx context.Context, firewall *godo.Firewall, inboundRules []godo.InboundRule) error {
+	return c.applyInboundRules(ctx, firewall, inboundRules, SummarizeChanges(firewall, inboundRules))
+}
+
+// applyInboundRules updates the firewall with new inbound rules whose changes were already summarized
+func (c *Client) applyInboundRules(
+	ctx context.Context,
+	firewall *godo.Firewall,
+	inboundRules []godo.InboundRule,
+	changes ChangeSummary,
+) error {
+	return c.applyRules(ctx, "update_inbound_rules", firewall, inboundRules, firewall.OutboundRules, changes)
+}
+
+// applyRules replaces the inbound and outbound rules of the firewall for the audited action,
+// keeping a snapshot of the replaced rules
+func (c *Client) applyRules(
+	ctx context.Context,
+	action string,
+	firewall *godo.Firewall,
+	inboundRules []godo.InboundRule,
+	outboundRules []godo.OutboundRule,
+	changes ChangeSummary,
+) error {
+	// Refuse to remove the operator's own access to admin ports unless forced
+	if c.adminAccess != nil {
+		if lost := LostAdminAccess(firewall.InboundRules, inboundRules, *c.adminAccess); len(lost) > 0 {
+			if !c.adminAccess.Force {
+				c.logger.Error("Firewall update would remove admin access",
+					zap.String("firewall_id", firewall.ID),
+					zap.Strings("lost_access", lost))
+				return fmt.Errorf("%w (%s), re-run with --force", ErrSelfLockout, strings.Join(lost, ", "))
+			}
+			c.logger.Warn("Forcing firewall update that removes admin access",
+				zap.String("firewall_id", firewall.ID),
+				zap.Strings("lost_access", lost))
+		}
+	}
+
+	if c.confirm != nil {
+		c.confirmMu.Lock()
+		err := c.confirm(changes)
+		c.confirmMu.Unlock()
+		if err != nil {
+			c.logger.Warn("Firewall update was not confirmed",
+				zap.String("firewall_id", firewall.ID),
+				zap.Int("removed_addresses", len(changes.RemovedAddresses)),
+				zap.Strings("removed_rules", changes.RemovedRules),
+				zap.Error(err))
+			return fmt.Errorf("firewall update not confirmed: %w", err)
+		}
+	}
+
+	updateRequest := &godo.FirewallRequest{
+		Name:          firewall.Name,
+		InboundRules:  inboundRules,
+		OutboundRules: outboundRules,
+		Tags:          firewall.Tags,
+		DropletIDs:    firewall.DropletIDs, // Preserve existing droplet attachments
+	}
+
+	_, _, err := c.client.Firewalls.Update(ctx, firewall.ID, updateRequest)
+	if err != nil {
+		c.logger.Error("Failed to update firewall",
+			zap.String("firewall_id", firewall.ID),
+			zap.Error(err))
+		return fmt.Errorf("failed to update firewall %s: %w", firewall.ID, err)
+	}
+
+	// Like the audit record, a failed snapshot must not fail the update that already happened
+	if c.snapshots != nil {
+		err := c.snapshots.Record(state.FirewallSnapshot{
+			FirewallID:    firewall.ID,
+			FirewallName:  firewall.Name,
+			Action:        action,
+			TakenAt:       time.Now(),
+			InboundRules:  firewall.InboundRules,
+			OutboundRules: firewall.OutboundRules,
+		})
+		if err != nil {
+			c.logger.Warn("Failed to save firewall snapshot",
+				zap.String("firewall_id", firewall.ID),
+				zap.Error(err))
+		}
+	}
+
+	record := audit.Record{
+		Action:       action,
+		FirewallID:   firewall.ID,
+		FirewallName: firewall.Name,
+		Added:        changes.AddedAddresses,
+		Removed:      changes.RemovedAddresses,
+		Fingerprint:  RulesFingerprint(inboundRules),
+		Fields:       audit.FieldsFromContext(ctx),
+		Labels:       changeLabels(audit.LabelsFromContext(ctx), changes),
+	}
+	if span, ok := tracecontext.FromContext(ctx); ok {
+		record.TraceID = span.TraceID
+		record.SpanID = span.SpanID
+		record.ParentSpanID = span.ParentID
+	}
+
+	// The firewall has already changed, so a failed audit write must not fail the update
+	if err := c.auditor.Record(record); err != nil {
+		c.logger.Warn("Failed to write audit record",
+			zap.String("firewall_id", firewall.ID),
+			zap.Error(err))
+	}
+	if applied, ok := ctx.Value(appliedChangesKey{}).(*AppliedChanges); ok {
+		applied.add(changes)
+	}
+
+	return nil
+}
+
+// appliedChangesKey is the context key of the changes applied during a run
+type appliedChangesKey struct{}
+
+// AppliedChanges collects the changes the firewall updates of a run applied, for reporting them
+// once the run is over
+type AppliedChanges struct {
+	mu      sync.Mutex
+	changes []ChangeSummary
+}
+
+// WithAppliedChanges returns a context whose firewall updates add their changes to applied
+func WithAppliedChanges(ctx context.Context, applied *AppliedChanges) context.Context {
+	return context.WithValue(ctx, appliedChangesKey{}, applied)
+}
+
+func (a *AppliedChanges) add(changes ChangeSummary) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.changes = append(a.changes, changes)
+}
+
+// List returns the applied changes in the order the updates completed
+func (a *AppliedChanges) List() []ChangeSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return slices.Clone(a.changes)
+}
@@ -0,0 +1,195 @@
+package digitalocean
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSummarizeChanges(t *testing.T) {
+	firewall := &godo.Firewall{
+		ID: "fw-1",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24", "198.51.100.0/24"}}},
+		},
+	}
+
+	newRules := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24", "203.0.113.0/24"}}},
+	}
+
+	summary := SummarizeChanges(firewall, newRules)
+
+	if len(summary.RemovedRules) != 1 || summary.RemovedRules[0] != "tcp/22" {
+		t.Errorf("expected tcp/22 to be removed, got %v", summary.RemovedRules)
+	}
+
+	expectedRemoved := []string{"tcp/22 198.51.100.7/32", "tcp/443 198.51.100.0/24"}
+	if len(summary.RemovedAddresses) != len(expectedRemoved) {
+		t.Fatalf("expected removed addresses %v, got %v", expectedRemoved, summary.RemovedAddresses)
+	}
+	for i, expected := range expectedRemoved {
+		if summary.RemovedAddresses[i] != expected {
+			t.Errorf("expected removed[%d] = %s, got %s", i, expected, summary.RemovedAddresses[i])
+		}
+	}
+
+	if len(summary.AddedAddresses) != 1 || summary.AddedAddresses[0] != "tcp/443 203.0.113.0/24" {
+		t.Errorf("expected tcp/443 203.0.113.0/24 to be added, got %v", summary.AddedAddresses)
+	}
+
+	if !summary.IsDestructive(10) {
+		t.Error("expected change deleting a rule to be destructive")
+	}
+
+	if !summary.HasChanges() {
+		t.Error("expected summary to report changes")
+	}
+}
+
+func TestIsDestructive(t *testing.T) {
+	summary := ChangeSummary{RemovedAddresses: []string{"tcp/443 192.0.2.0/24", "tcp/443 192.0.2.1/32"}}
+
+	if summary.IsDestructive(2) {
+		t.Error("expected removal at the threshold not to be destructive")
+	}
+
+	if !summary.IsDestructive(1) {
+		t.Error("expected removal above the threshold to be destructive")
+	}
+}
+
+func TestConfirmFuncAbortsUpdate(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID: "fw-1",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+		},
+	})
+	client := newTestClient(t, api)
+
+	errDeclined := errors.New("declined")
+	var seen ChangeSummary
+	client.SetConfirmFunc(func(changes ChangeSummary) error {
+		seen = changes
+		return errDeclined
+	})
+
+	err := client.AddSSHRule(context.Background(), "fw-1", "203.0.113.5", 22, true)
+	if !errors.Is(err, errDeclined) {
+		t.Fatalf("expected declined error, got %v", err)
+	}
+
+	if len(seen.RemovedAddresses) != 1 {
+		t.Errorf("expected confirm func to see 1 removed address, got %v", seen.RemovedAddresses)
+	}
+
+	if api.updates != 0 {
+		t.Errorf("expected no firewall updates, got %d", api.updates)
+	}
+}
+
+func TestAppliedChanges(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID:   "fw-1",
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+		},
+	})
+	client := newTestClient(t, api)
+
+	applied := &AppliedChanges{}
+	ctx := WithAppliedChanges(context.Background(), applied)
+	if err := client.AddSSHRule(ctx, "fw-1", "203.0.113.5", 22, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	changes := applied.List()
+	if len(changes) != 1 || changes[0].FirewallID != "fw-1" || len(changes[0].AddedAddresses) != 1 {
+		t.Errorf("expected the applied change of fw-1, got %+v", changes)
+	}
+}
+
+func TestReplaceInboundRulesAudit(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID:   "fw-1",
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+		},
+	})
+	client := newTestClient(t, api)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	client.auditor = audit.NewLogger(path, map[string]string{"instance": "eu-1"}, zaptest.NewLogger(t))
+
+	if err := client.AddSSHRule(context.Background(), "fw-1", "203.0.113.5", 22, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected audit log to be written: %v", err)
+	}
+
+	var record audit.Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("invalid audit record %q: %v", data, err)
+	}
+
+	if record.FirewallID != "fw-1" || record.FirewallName != "web" {
+		t.Errorf("unexpected firewall in audit record: %+v", record)
+	}
+	if len(record.Added) != 1 || record.Added[0] != "tcp/22 203.0.113.5/32" {
+		t.Errorf("expected added address in audit record, got %v", record.Added)
+	}
+	if record.Fields["instance"] != "eu-1" {
+		t.Errorf("expected global fields in audit record, got %v", record.Fields)
+	}
+}
+
+func TestReplaceInboundRulesAuditLabels(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID:   "fw-1",
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+		},
+	})
+	client := newTestClient(t, api)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	client.auditor = audit.NewLogger(path, nil, zaptest.NewLogger(t))
+
+	ctx := audit.WithLabels(context.Background(), map[string]audit.Label{
+		"203.0.113.5":  {Source: "nyc-office", Owner: "it@example.com"},
+		"192.0.2.0/24": {Source: "lon-office"},
+	})
+	if err := client.AddSSHRule(ctx, "fw-1", "203.0.113.5", 22, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected audit log to be written: %v", err)
+	}
+
+	var record audit.Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("invalid audit record %q: %v", data, err)
+	}
+
+	want := map[string]audit.Label{"203.0.113.5/32": {Source: "nyc-office", Owner: "it@example.com"}}
+	if len(record.Labels) != len(want) || record.Labels["203.0.113.5/32"] != want["203.0.113.5/32"] {
+		t.Errorf("expected labels %v of the added address only, got %v", want, record.Labels)
+	}
+}
@@ -0,0 +1,174 @@
+package digitalocean
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// portRule is the protocol, DigitalOcean port range, addresses and droplet sources of an inbound
+// rule to create
+type portRule struct {
+	Protocol   string
+	PortRange  string
+	Addresses  []string
+	Tags       []string
+	DropletIDs []int
+}
+
+// WithRuleCompaction merges managed rules on consecutive ports that share a protocol and
+// sources into port-range rules, keeping large configurations under the rule-count limit
+func WithRuleCompaction(compact bool) Option {
+	return func(c *Client) {
+		c.compactRules = compact
+	}
+}
+
+// portRules returns the port rules to create for the active rules, compacted into port ranges
+// when enabled
+func (c *Client) portRules(rules []FirewallRule) []portRule {
+	var active []FirewallRule
+	for _, rule := range rules {
+		if !rule.Inactive {
+			active = append(active, rule)
+		}
+	}
+
+	if !c.compactRules {
+		result := make([]portRule, 0, len(active))
+		for _, rule := range active {
+			result = append(result, portRule{
+				Protocol:   rule.Protocol,
+				PortRange:  fmt.Sprintf("%d", rule.Port),
+				Addresses:  rule.Sources,
+				Tags:       rule.Tags,
+				DropletIDs: rule.DropletIDs,
+			})
+		}
+		return result
+	}
+	return compactPortRules(active)
+}
+
+// compactPortRules merges rules sharing a protocol, source set and droplet sources on consecutive
+// ports into port ranges; ICMP rules carry no real port and are kept as they are
+func compactPortRules(rules []FirewallRule) []portRule {
+	type group struct {
+		protocol   string
+		addresses  []string
+		tags       []string
+		dropletIDs []int
+		ports      []int
+	}
+
+	var groups []*group
+	byKey := make(map[string]*group)
+	var result []portRule
+	keys := sourceSetKeys{}
+
+	for _, rule := range rules {
+		if rule.Protocol == "icmp" {
+			result = append(result, portRule{
+				Protocol:   rule.Protocol,
+				PortRange:  fmt.Sprintf("%d", rule.Port),
+				Addresses:  rule.Sources,
+				Tags:       rule.Tags,
+				DropletIDs: rule.DropletIDs,
+			})
+			continue
+		}
+
+		key := rule.Protocol + "|" + keys.key(rule.Sources) + "|" + dropletSourcesKey(rule)
+
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{protocol: rule.Protocol, addresses: rule.Sources, tags: rule.Tags, dropletIDs: rule.DropletIDs}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.ports = append(g.ports, rule.Port)
+	}
+
+	for _, g := range groups {
+		sort.Ints(g.ports)
+		for i := 0; i < len(g.ports); {
+			start := g.ports[i]
+			end := start
+			for i++; i < len(g.ports) && g.ports[i] <= end+1; i++ {
+				end = g.ports[i]
+			}
+
+			portRange := fmt.Sprintf("%d", start)
+			if end != start {
+				portRange = fmt.Sprintf("%d-%d", start, end)
+			}
+			result = append(result, portRule{Protocol: g.protocol, PortRange: portRange, Addresses: g.addresses, Tags: g.tags, DropletIDs: g.dropletIDs})
+		}
+	}
+
+	return result
+}
+
+// sourceSetKeys derives an order-independent key for each distinct source list; rules built from
+// one collection share the same list, which is then sorted once rather than once per rule
+type sourceSetKeys []sourceSetKey
+
+type sourceSetKey struct {
+	sources []string
+	key     string
+}
+
+// key returns the key of the source list, deriving it on first use
+func (k *sourceSetKeys) key(sources []string) string {
+	for _, known := range *k {
+		if slices.Equal(known.sources, sources) {
+			return known.key
+		}
+	}
+
+	sorted := append([]string{}, sources...)
+	sort.Strings(sorted)
+	key := strings.Join(sorted, ",")
+	*k = append(*k, sourceSetKey{sources: sources, key: key})
+	return key
+}
+
+// dropletSourcesKey derives an order-independent key for the tags and droplet IDs of a rule
+func dropletSourcesKey(rule FirewallRule) string {
+	if len(rule.Tags) == 0 && len(rule.DropletIDs) == 0 {
+		return ""
+	}
+
+	tags := slices.Sorted(slices.Values(rule.Tags))
+	ids := make([]string, 0, len(rule.DropletIDs))
+	for _, id := range slices.Sorted(slices.Values(rule.DropletIDs)) {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return strings.Join(tags, ",") + "|" + strings.Join(ids, ",")
+}
+
+// isManagedPortRange reports whether every port of an existing rule's port range is managed, so
+// the rule is replaced rather than preserved
+func isManagedPortRange(portRange string, managedPorts map[int]bool) bool {
+	low, high, isRange := strings.Cut(portRange, "-")
+	start, err := strconv.Atoi(low)
+	if err != nil {
+		return false
+	}
+	if !isRange {
+		return managedPorts[start]
+	}
+
+	end, err := strconv.Atoi(high)
+	if err != nil || end < start {
+		return false
+	}
+	for port := start; port <= end; port++ {
+		if !managedPorts[port] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package digitalocean
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestCompactPortRules(t *testing.T) {
+	sources := []string{"203.0.113.0/24"}
+	rules := []FirewallRule{
+		{Port: 8002, Protocol: "tcp", Sources: sources},
+		{Port: 8000, Protocol: "tcp", Sources: sources},
+		{Port: 8001, Protocol: "tcp", Sources: sources},
+		{Port: 443, Protocol: "tcp", Sources: sources},
+		{Port: 8001, Protocol: "udp", Sources: sources},
+		{Port: 8003, Protocol: "tcp", Sources: []string{"198.51.100.7"}},
+		{Port: 0, Protocol: "icmp", Sources: sources},
+		{Port: 9000, Protocol: "tcp", Sources: sources, Tags: []string{"web"}},
+		{Port: 9001, Protocol: "tcp", Sources: sources, Tags: []string{"web"}},
+		{Port: 8003, Protocol: "udp", Sources: sources, DropletIDs: []int{42}},
+	}
+
+	expected := []portRule{
+		{Protocol: "icmp", PortRange: "0", Addresses: sources},
+		{Protocol: "tcp", PortRange: "443", Addresses: sources},
+		{Protocol: "tcp", PortRange: "8000-8002", Addresses: sources},
+		{Protocol: "udp", PortRange: "8001", Addresses: sources},
+		{Protocol: "tcp", PortRange: "8003", Addresses: []string{"198.51.100.7"}},
+		{Protocol: "tcp", PortRange: "9000-9001", Addresses: sources, Tags: []string{"web"}},
+		{Protocol: "udp", PortRange: "8003", Addresses: sources, DropletIDs: []int{42}},
+	}
+
+	result := compactPortRules(rules)
+	if len(result) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, result)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(result[i], expected[i]) {
+			t.Errorf("expected rule %d to be %v, got %v", i, expected[i], result[i])
+		}
+	}
+}
+
+func TestIsManagedPortRange(t *testing.T) {
+	managed := map[int]bool{22: true, 8000: true, 8001: true, 8002: true}
+
+	tests := []struct {
+		portRange string
+		expected  bool
+	}{
+		{"22", true},
+		{"80", false},
+		{"8000-8002", true},
+		{"8000-8003", false},
+		{"all", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.portRange, func(t *testing.T) {
+			if got := isManagedPortRange(tt.portRange, managed); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateFirewallRulesCompaction(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID: "fw-1",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "8000-8001", Sources: &godo.Sources{Addresses: []string{"192.0.2.10/32"}}},
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"192.0.2.10/32"}}},
+		},
+	})
+	client := newTestClient(t, api)
+	client.compactRules = true
+
+	sources := []string{"203.0.113.5", "203.0.113.5/32"}
+	rules := []FirewallRule{
+		{Port: 8000, Protocol: "tcp", Sources: sources},
+		{Port: 8001, Protocol: "tcp", Sources: sources},
+		// Rules allow the normalized combined set, however their own sources are spelled
+		{Port: 8002, Protocol: "tcp", Sources: []string{"203.0.113.5/32"}},
+	}
+	applied, _, err := client.UpdateFirewallRules(context.Background(), "fw-1", rules, sources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applied) != 1 || applied[0] != "203.0.113.5/32" {
+		t.Errorf("expected the normalized sources to be returned, got %v", applied)
+	}
+
+	inbound := api.firewalls["fw-1"].InboundRules
+	if len(inbound) != 2 {
+		t.Fatalf("expected the unmanaged rule and one compacted rule, got %+v", inbound)
+	}
+	if inbound[0].PortRange != "22" || inbound[1].PortRange != "8000-8002" {
+		t.Errorf("expected rules for 22 and 8000-8002, got %s and %s", inbound[0].PortRange, inbound[1].PortRange)
+	}
+}
@@ -2,17 +2,57 @@ package digitalocean
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/digitalocean/godo"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/lock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 )
 
+// ErrReadOnly is returned when a mutating API call is attempted in read-only mode
+var ErrReadOnly = errors.New("read-only mode: mutating DigitalOcean API calls are disabled")
+
 // Client wraps the DigitalOcean API client
 type Client struct {
-	client *godo.Client
-	logger *zap.Logger
+	client      *godo.Client
+	logger      *zap.Logger
+	readOnly    bool
+	locker      *lock.Locker
+	lockTimeout time.Duration
+	confirm     ConfirmFunc
+	// confirmMu keeps the prompts of firewalls updated concurrently from interleaving
+	confirmMu   sync.Mutex
+	auditor     *audit.Logger
+	snapshots   *state.SnapshotStore
+	adminAccess *AdminAccess
+	tokenFile   string
+	tokenSource *FileTokenSource
+	retries     int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	baseURL     *url.URL
+
+	compactRules   bool
+	allowLocalIPv6 bool
+}
+
+// Option configures optional Client behavior
+type Option func(*Client)
+
+// WithReadOnly guarantees that no mutating API call is made by the client
+func WithReadOnly(readOnly bool) Option {
+	return func(c *Client) {
+		c.readOnly = readOnly
+	}
 }
 
 // TokenSource implements oauth2.TokenSource for DigitalOcean API authentication
@@ -28,19 +68,130 @@ func (t *TokenSource) Token() (*oauth2.Token, error) {
 	return token, nil
 }
 
-// NewClient creates a new DigitalOcean client
-func NewClient(apiKey string, logger *zap.Logger) *Client {
-	tokenSource := &TokenSource{
-		AccessToken: apiKey,
+// WithLock makes the client hold an exclusive host-wide lock during every firewall mutation
+func WithLock(locker *lock.Locker, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.locker = locker
+		c.lockTimeout = timeout
 	}
+}
 
-	oauthClient := oauth2.NewClient(context.Background(), tokenSource)
-	client := godo.NewClient(oauthClient)
+// WithSnapshots keeps the rules every update replaces in store, for rollback to restore them
+func WithSnapshots(store *state.SnapshotStore) Option {
+	return func(c *Client) {
+		c.snapshots = store
+	}
+}
 
-	return &Client{
-		client: client,
+// WithAudit records every successful firewall mutation to the audit log
+func WithAudit(auditor *audit.Logger) Option {
+	return func(c *Client) {
+		c.auditor = auditor
+	}
+}
+
+// WithBaseURL sends the API requests to baseURL, e.g. http://127.0.0.1:8080/, rather than the
+// DigitalOcean API; services in tests point it at a fake API
+func WithBaseURL(baseURL *url.URL) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// NewClient creates a new DigitalOcean client
+func NewClient(apiKey string, logger *zap.Logger, opts ...Option) *Client {
+	c := &Client{
 		logger: logger.Named("digitalocean"),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var oauthClient *http.Client
+	if c.tokenFile != "" {
+		// Ask the source for the token on every request instead of caching it, so reloads apply
+		c.tokenSource = NewFileTokenSource(c.tokenFile, apiKey)
+		oauthClient = &http.Client{Transport: &tokenReloadTransport{
+			base:   &oauth2.Transport{Source: c.tokenSource},
+			source: c.tokenSource,
+			logger: c.logger,
+		}}
+	} else {
+		tokenSource := &TokenSource{
+			AccessToken: apiKey,
+		}
+		oauthClient = oauth2.NewClient(context.Background(), tokenSource)
+	}
+
+	if c.retries > 0 {
+		oauthClient.Transport = &retryTransport{
+			base:       oauthClient.Transport,
+			retries:    c.retries,
+			minBackoff: c.minBackoff,
+			maxBackoff: c.maxBackoff,
+			logger:     c.logger,
+			clock:      clock.Real,
+		}
+	}
+
+	if c.readOnly {
+		// Enforce read-only mode at the transport so no code path can bypass it
+		oauthClient.Transport = &readOnlyTransport{base: oauthClient.Transport}
+		c.logger.Info("DigitalOcean client running in read-only mode")
+	}
+	c.client = godo.NewClient(oauthClient)
+	if c.baseURL != nil {
+		c.client.BaseURL = c.baseURL
+	}
+
+	return c
+}
+
+// IsReadOnly returns true if the client refuses mutating API calls
+func (c *Client) IsReadOnly() bool {
+	return c.readOnly
+}
+
+// acquireLock takes the mutation lock of the firewall if one is configured and returns its release
+// function; firewalls are locked independently so they can be updated concurrently
+func (c *Client) acquireLock(ctx context.Context, firewallID string) (func(), error) {
+	if c.locker == nil {
+		return func() {}, nil
+	}
+
+	locker := c.locker.For(firewallID)
+	lk, err := locker.Acquire(ctx, c.lockTimeout)
+	if err != nil {
+		c.logger.Error("Failed to acquire firewall mutation lock",
+			zap.String("firewall_id", firewallID),
+			zap.String("lock_path", locker.Path()),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to acquire firewall mutation lock: %w", err)
+	}
+
+	return func() {
+		if err := lk.Release(); err != nil {
+			c.logger.Warn("Failed to release firewall mutation lock", zap.Error(err))
+		}
+	}, nil
+}
+
+// readOnlyTransport rejects every request that is not a safe HTTP method
+type readOnlyTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.base.RoundTrip(req)
+	default:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w (%s %s)", ErrReadOnly, req.Method, req.URL.Path)
+	}
 }
 
 // GetFirewall retrieves a firewall by ID
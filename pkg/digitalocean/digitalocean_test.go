@@ -1,8 +1,12 @@
 package digitalocean
 
 import (
+	"context"
+	"errors"
 	"testing"
 
+	"github.com/digitalocean/godo"
+
 	"go.uber.org/zap/zaptest"
 )
 
@@ -42,13 +46,13 @@ func TestTokenSource_Token(t *testing.T) {
 
 func TestValidateAndNormalizeSources(t *testing.T) {
 	logger := zaptest.NewLogger(t)
-	client := NewClient("test-key", logger)
 
 	tests := []struct {
 		name        string
 		sources     []string
 		expected    []string
 		expectError bool
+		allowLocal  bool
 	}{
 		{
 			name:     "valid IPv4 addresses",
@@ -85,10 +89,57 @@ func TestValidateAndNormalizeSources(t *testing.T) {
 			sources:  []string{},
 			expected: []string{},
 		},
+		{
+			name:     "canonical IPv6",
+			sources:  []string{"2001:DB8:0:0:0:0:0:1", "2001:0db8:0000::/48"},
+			expected: []string{"2001:db8::1/128", "2001:db8::/48"},
+		},
+		{
+			name:     "zone identifiers stripped",
+			sources:  []string{"2001:db8::1%eth0", "2001:db8::%eth0/64"},
+			expected: []string{"2001:db8::1/128", "2001:db8::/64"},
+		},
+		{
+			name:     "host bits masked",
+			sources:  []string{"10.1.2.3/8", "2001:db8::1/32"},
+			expected: []string{"10.0.0.0/8", "2001:db8::/32"},
+		},
+		{
+			name:     "IPv4-mapped IPv6",
+			sources:  []string{"::ffff:192.0.2.1", "::ffff:192.0.2.0/120"},
+			expected: []string{"192.0.2.1/32", "192.0.2.0/24"},
+		},
+		{
+			name:     "equivalent representations deduplicated",
+			sources:  []string{"2001:db8::1", "2001:DB8::1/128", "192.0.2.1", "192.0.2.1/32", "::ffff:192.0.2.1"},
+			expected: []string{"2001:db8::1/128", "192.0.2.1/32"},
+		},
+		{
+			name:        "link-local IPv6 rejected",
+			sources:     []string{"fe80::1%eth0"},
+			expectError: true,
+		},
+		{
+			name:        "unique local IPv6 rejected",
+			sources:     []string{"fd12:3456:789a::/48"},
+			expectError: true,
+		},
+		{
+			name:     "range covering local IPv6 allowed",
+			sources:  []string{"::/0"},
+			expected: []string{"::/0"},
+		},
+		{
+			name:       "local IPv6 allowed by override",
+			sources:    []string{"fe80::1", "fd00::/8"},
+			expected:   []string{"fe80::1/128", "fd00::/8"},
+			allowLocal: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient("test-key", logger, WithLocalIPv6(tt.allowLocal))
 			result, err := client.validateAndNormalizeSources(tt.sources)
 
 			if tt.expectError {
@@ -161,3 +212,25 @@ func TestFirewallRule(t *testing.T) {
 		t.Errorf("expected sources [192.168.1.0/24], got %v", rule.Sources)
 	}
 }
+
+func TestReadOnlyTransport(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web"})
+	client := newTestClient(t, api)
+	client.readOnly = true
+	client.client.HTTPClient.Transport = &readOnlyTransport{base: client.client.HTTPClient.Transport}
+
+	ctx := context.Background()
+
+	if _, err := client.GetFirewall(ctx, "fw-1"); err != nil {
+		t.Fatalf("expected read calls to succeed, got %v", err)
+	}
+
+	err := client.AddSSHRule(ctx, "fw-1", "203.0.113.5", 22, false)
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+
+	if api.updates != 0 {
+		t.Errorf("expected no firewall updates, got %d", api.updates)
+	}
+}
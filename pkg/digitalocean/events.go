@@ -0,0 +1,94 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap"
+)
+
+// Sources of the last modification of a firewall's inbound rules
+const (
+	ModifiedByTool     = "do-firewall-allowlister"
+	ModifiedExternally = "external"
+	ModifiedUnknown    = "unknown"
+)
+
+// Event is a DigitalOcean account action affecting a firewall or one of its droplets
+type Event struct {
+	ID           int       `json:"id"`
+	Type         string    `json:"type"`
+	Status       string    `json:"status"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   int       `json:"resource_id"`
+	StartedAt    time.Time `json:"started_at"`
+}
+
+// Modification describes who last changed a firewall's inbound rules
+type Modification struct {
+	Source        string     `json:"source"`
+	LastAppliedAt *time.Time `json:"last_applied_at,omitempty"` // Last change made by this tool
+}
+
+// RecentEvents returns up to limit of the most recent account actions on the firewall or its droplets.
+// DigitalOcean does not record every firewall change as an action, so the list may be incomplete.
+func (c *Client) RecentEvents(ctx context.Context, firewall *godo.Firewall, limit int) ([]Event, error) {
+	c.logger.Debug("Listing recent account actions", zap.String("firewall_id", firewall.ID))
+
+	actions, _, err := c.client.Actions.List(ctx, &godo.ListOptions{Page: 1, PerPage: 100})
+	if err != nil {
+		c.logger.Error("Failed to list account actions", zap.Error(err))
+		return nil, fmt.Errorf("failed to list account actions: %w", err)
+	}
+
+	droplets := make(map[int]bool, len(firewall.DropletIDs))
+	for _, id := range firewall.DropletIDs {
+		droplets[id] = true
+	}
+
+	var events []Event
+	for _, action := range actions {
+		if action.ResourceType != "firewall" && !(action.ResourceType == "droplet" && droplets[action.ResourceID]) {
+			continue
+		}
+
+		event := Event{
+			ID:           action.ID,
+			Type:         action.Type,
+			Status:       action.Status,
+			ResourceType: action.ResourceType,
+			ResourceID:   action.ResourceID,
+		}
+		if action.StartedAt != nil {
+			event.StartedAt = action.StartedAt.Time
+		}
+		events = append(events, event)
+
+		if len(events) == limit {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+// LastModification compares the firewall's inbound rules against the last change recorded in the
+// audit log, the source is unknown when auditing is disabled or nothing was recorded yet
+func (c *Client) LastModification(firewall *godo.Firewall) (Modification, error) {
+	record, err := c.auditor.Last(firewall.ID)
+	if err != nil {
+		return Modification{Source: ModifiedUnknown}, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if record == nil || record.Fingerprint == "" {
+		return Modification{Source: ModifiedUnknown}, nil
+	}
+
+	modification := Modification{Source: ModifiedByTool, LastAppliedAt: &record.Time}
+	if RulesFingerprint(firewall.InboundRules) != record.Fingerprint {
+		// The rules changed after this tool's last update: the console, the API or another tool
+		modification.Source = ModifiedExternally
+	}
+	return modification, nil
+}
@@ -0,0 +1,67 @@
+package digitalocean
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRecentEvents(t *testing.T) {
+	firewall := &godo.Firewall{ID: "fw-1", DropletIDs: []int{101}}
+	api := newFakeFirewallAPI(firewall)
+	api.actions = []godo.Action{
+		{ID: 1, Type: "power_off", Status: "completed", ResourceType: "droplet", ResourceID: 101},
+		{ID: 2, Type: "snapshot", Status: "completed", ResourceType: "droplet", ResourceID: 202},
+		{ID: 3, Type: "resize", Status: "in-progress", ResourceType: "droplet", ResourceID: 101},
+		{ID: 4, Type: "rebuild", Status: "completed", ResourceType: "droplet", ResourceID: 101},
+	}
+	client := newTestClient(t, api)
+
+	events, err := client.RecentEvents(context.Background(), firewall, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(events) != 2 || events[0].ID != 1 || events[1].ID != 3 {
+		t.Errorf("expected the two most recent actions on attached droplets, got %+v", events)
+	}
+}
+
+func TestLastModification(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1"})
+	client := newTestClient(t, api)
+
+	modification, err := client.LastModification(api.firewalls["fw-1"])
+	if err != nil || modification.Source != ModifiedUnknown {
+		t.Fatalf("expected unknown source without an audit log, got %+v, %v", modification, err)
+	}
+
+	client.auditor = audit.NewLogger(filepath.Join(t.TempDir(), "audit.log"), nil, zaptest.NewLogger(t))
+	if err := client.AddSSHRule(context.Background(), "fw-1", "203.0.113.5", 22, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	modification, err = client.LastModification(api.firewalls["fw-1"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if modification.Source != ModifiedByTool || modification.LastAppliedAt == nil {
+		t.Errorf("expected the firewall to be attributed to this tool, got %+v", modification)
+	}
+
+	// Simulate an edit in the control panel
+	api.firewalls["fw-1"].InboundRules[0].Sources.Addresses = append(
+		api.firewalls["fw-1"].InboundRules[0].Sources.Addresses, "192.0.2.10/32")
+
+	modification, err = client.LastModification(api.firewalls["fw-1"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if modification.Source != ModifiedExternally {
+		t.Errorf("expected an external modification, got %+v", modification)
+	}
+}
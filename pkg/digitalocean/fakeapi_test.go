@@ -0,0 +1,88 @@
+package digitalocean
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeFirewallAPI is an in-memory stand-in for the DigitalOcean firewalls API
+type fakeFirewallAPI struct {
+	mu        sync.Mutex
+	firewalls map[string]*godo.Firewall
+	actions   []godo.Action
+	updates   int
+}
+
+func newFakeFirewallAPI(firewalls ...*godo.Firewall) *fakeFirewallAPI {
+	api := &fakeFirewallAPI{firewalls: make(map[string]*godo.Firewall)}
+	for _, fw := range firewalls {
+		api.firewalls[fw.ID] = fw
+	}
+	return api
+}
+
+func (f *fakeFirewallAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/v2/actions" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string][]godo.Action{"actions": f.actions})
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v2/firewalls/")
+	fw, ok := f.firewalls[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"id":"not_found","message":"firewall not found"}`))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req godo.FirewallRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fw.Name = req.Name
+		fw.InboundRules = req.InboundRules
+		fw.OutboundRules = req.OutboundRules
+		fw.DropletIDs = req.DropletIDs
+		fw.Tags = req.Tags
+		f.updates++
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]*godo.Firewall{"firewall": fw})
+}
+
+// newTestClient returns a Client talking to the fake API
+func newTestClient(t testing.TB, api *fakeFirewallAPI) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	godoClient, err := godo.New(server.Client(), godo.SetBaseURL(server.URL+"/"))
+	if err != nil {
+		t.Fatalf("failed to create godo client: %v", err)
+	}
+
+	return &Client{
+		client: godoClient,
+		logger: zaptest.NewLogger(t).Named("digitalocean"),
+	}
+}
@@ -3,7 +3,8 @@ package digitalocean
 import (
 	"context"
 	"fmt"
-	"net"
+	"net/netip"
+	"strings"
 
 	"github.com/digitalocean/godo"
 	"go.uber.org/zap"
@@ -13,129 +14,259 @@ import (
 type FirewallRule struct {
 	Port     int
 	Protocol string
-	Sources  []string // IP addresses or CIDR blocks
+	Sources  []string // IP addresses or CIDR blocks; UpdateFirewallRules replaces them with its normalized sources
+	Inactive bool     // Port is managed but the rule is currently removed (e.g. outside its access window)
+	// OwnSources keeps the rule's own Sources, normalized, rather than the sources of the update
+	OwnSources bool
+	// Tags and DropletIDs are droplets allowed besides the addresses, by tag or by ID
+	Tags       []string
+	DropletIDs []int
 }
 
-// UpdateFirewallRules updates the firewall with new inbound rules for the specified IPs
+// UpdateFirewallRules updates the firewall with new inbound rules for the specified IPs, returning
+// the normalized sources every managed rule now allows and whether the firewall changed; no update
+// is sent when the firewall already has the rules
 func (c *Client) UpdateFirewallRules(
 	ctx context.Context,
 	firewallID string,
 	rules []FirewallRule,
 	sourceIPs []string,
-) error {
+) ([]string, bool, error) {
 	c.logger.Info("Updating firewall rules",
 		zap.String("firewall_id", firewallID),
 		zap.Int("rule_count", len(rules)),
 		zap.Int("source_ip_count", len(sourceIPs)))
 
+	// Hold the mutation lock across the read-modify-write of the firewall
+	release, err := c.acquireLock(ctx, firewallID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
 	// Get current firewall configuration
 	firewall, err := c.GetFirewall(ctx, firewallID)
 	if err != nil {
-		return fmt.Errorf("failed to get current firewall: %w", err)
+		return nil, false, fmt.Errorf("failed to get current firewall: %w", err)
+	}
+
+	// Validate and normalize the combined sources once; every managed rule allows the same set
+	validSources, err := c.NormalizeSources(sourceIPs)
+	if err != nil {
+		return nil, false, err
+	}
+	rules, err = c.normalizeOwnSources(rules)
+	if err != nil {
+		return nil, false, err
 	}
+	newInboundRules := c.desiredInboundRules(firewall, rules, validSources)
 
-	// Build new inbound rules
+	// Log droplets that will be preserved
+	if len(firewall.DropletIDs) > 0 {
+		c.logger.Debug("Preserving droplet attachments during firewall update",
+			zap.String("firewall_id", firewallID),
+			zap.Ints("droplet_ids", firewall.DropletIDs))
+	}
+
+	// Skip the write, and the rate limit it costs, when the firewall already has the rules
+	changes := SummarizeChanges(firewall, newInboundRules)
+	if RulesUnchanged(firewall, newInboundRules, changes) {
+		c.logger.Info("Firewall rules are up to date, no changes",
+			zap.String("firewall_id", firewallID),
+			zap.Int("total_inbound_rules", len(newInboundRules)),
+			zap.Int("normalized_source_count", len(validSources)))
+		return validSources, false, nil
+	}
+
+	// Update the firewall
+	if err := c.applyInboundRules(ctx, firewall, newInboundRules, changes); err != nil {
+		return nil, false, err
+	}
+
+	c.logger.Info("Successfully updated firewall rules",
+		zap.String("firewall_id", firewallID),
+		zap.Int("total_inbound_rules", len(newInboundRules)),
+		zap.Int("normalized_source_count", len(validSources)),
+		zap.Int("preserved_droplets", len(firewall.DropletIDs)))
+
+	return validSources, true, nil
+}
+
+// desiredInboundRules builds the inbound rules of the firewall after an update: the rules of ports
+// it does not manage are kept, and every active managed rule allows validSources
+func (c *Client) desiredInboundRules(firewall *godo.Firewall, rules []FirewallRule, validSources []string) []godo.InboundRule {
 	var newInboundRules []godo.InboundRule
 
 	// Keep existing rules that don't match our managed ports
-	managedPorts := make(map[string]bool)
+	managedPorts := make(map[int]bool)
 	for _, rule := range rules {
-		managedPorts[fmt.Sprintf("%d", rule.Port)] = true
+		managedPorts[rule.Port] = true
 	}
 
 	for _, existingRule := range firewall.InboundRules {
 		// Keep rules for ports we don't manage
-		if !managedPorts[existingRule.PortRange] {
+		if !isManagedPortRange(existingRule.PortRange, managedPorts) {
 			newInboundRules = append(newInboundRules, existingRule)
 		}
 	}
 
-	// Add new rules for our managed ports
 	for _, rule := range rules {
-		// Validate and normalize source IPs
-		validSources, err := c.validateAndNormalizeSources(sourceIPs)
-		if err != nil {
-			c.logger.Error("Failed to validate source IPs", zap.Error(err))
-			return fmt.Errorf("failed to validate source IPs: %w", err)
+		if rule.Inactive {
+			c.logger.Debug("Skipping inactive rule",
+				zap.Int("port", rule.Port),
+				zap.String("protocol", rule.Protocol))
 		}
+	}
 
+	managedRules := make([]FirewallRule, len(rules))
+	for i, rule := range rules {
+		if !rule.OwnSources {
+			rule.Sources = validSources
+		}
+		managedRules[i] = rule
+	}
+
+	// Add new rules for our managed ports
+	for _, rule := range c.portRules(managedRules) {
 		inboundRule := godo.InboundRule{
 			Protocol:  rule.Protocol,
-			PortRange: fmt.Sprintf("%d", rule.Port),
+			PortRange: rule.PortRange,
 			Sources: &godo.Sources{
-				Addresses: validSources,
+				Addresses:  rule.Addresses,
+				Tags:       rule.Tags,
+				DropletIDs: rule.DropletIDs,
 			},
 		}
 
 		newInboundRules = append(newInboundRules, inboundRule)
 
 		c.logger.Debug("Added inbound rule",
-			zap.Int("port", rule.Port),
+			zap.String("port_range", rule.PortRange),
 			zap.String("protocol", rule.Protocol),
-			zap.Strings("sources", validSources))
+			zap.Strings("sources", rule.Addresses),
+			zap.Strings("source_tags", rule.Tags),
+			zap.Ints("source_droplet_ids", rule.DropletIDs))
 	}
 
-	// Log droplets that will be preserved
-	if len(firewall.DropletIDs) > 0 {
-		c.logger.Debug("Preserving droplet attachments during firewall update",
-			zap.String("firewall_id", firewallID),
-			zap.Ints("droplet_ids", firewall.DropletIDs))
-	}
+	return newInboundRules
+}
 
-	// Update the firewall
-	updateRequest := &godo.FirewallRequest{
-		Name:          firewall.Name,
-		InboundRules:  newInboundRules,
-		OutboundRules: firewall.OutboundRules,
-		Tags:          firewall.Tags,
-		DropletIDs:    firewall.DropletIDs, // Preserve existing droplet attachments
+// NormalizeSources validates the combined sources of a run and returns them as canonical,
+// deduplicated CIDRs, failing on the first invalid or non-routable source
+func (c *Client) NormalizeSources(sources []string) ([]string, error) {
+	validSources, err := c.validateAndNormalizeSources(sources)
+	if err != nil {
+		c.logger.Error("Failed to validate source IPs", zap.Error(err))
+		return nil, fmt.Errorf("failed to validate source IPs: %w", err)
 	}
+	return validSources, nil
+}
 
-	_, _, err = c.client.Firewalls.Update(ctx, firewallID, updateRequest)
-	if err != nil {
-		c.logger.Error("Failed to update firewall",
-			zap.String("firewall_id", firewallID),
-			zap.Error(err))
-		return fmt.Errorf("failed to update firewall %s: %w", firewallID, err)
+// normalizeOwnSources returns a copy of the rules with the own sources of each normalized like the
+// sources of the update
+func (c *Client) normalizeOwnSources(rules []FirewallRule) ([]FirewallRule, error) {
+	normalized := make([]FirewallRule, len(rules))
+	for i, rule := range rules {
+		if rule.OwnSources {
+			sources, err := c.NormalizeSources(rule.Sources)
+			if err != nil {
+				return nil, fmt.Errorf("port %d: %w", rule.Port, err)
+			}
+			rule.Sources = sources
+		}
+		normalized[i] = rule
 	}
+	return normalized, nil
+}
 
-	c.logger.Info("Successfully updated firewall rules",
-		zap.String("firewall_id", firewallID),
-		zap.Int("total_inbound_rules", len(newInboundRules)),
-		zap.Int("preserved_droplets", len(firewall.DropletIDs)))
+// nonRoutableIPv6 are the IPv6 ranges rejected as sources unless WithLocalIPv6 allows them
+var nonRoutableIPv6 = []struct {
+	name   string
+	prefix netip.Prefix
+}{
+	{name: "link-local", prefix: netip.MustParsePrefix("fe80::/10")},
+	{name: "unique local", prefix: netip.MustParsePrefix("fc00::/7")},
+}
 
-	return nil
+// WithLocalIPv6 accepts link-local and unique local IPv6 sources, which are otherwise rejected
+// since they never reach a droplet from the internet
+func WithLocalIPv6(allow bool) Option {
+	return func(c *Client) {
+		c.allowLocalIPv6 = allow
+	}
 }
 
-// validateAndNormalizeSources validates IP addresses and CIDR blocks
+// validateAndNormalizeSources validates IP addresses and CIDR blocks and returns them as
+// canonical CIDRs: IPv6 lowercase and compressed, zone identifiers and host bits stripped,
+// IPv4-mapped IPv6 addresses as IPv4, and equivalent representations listed once
 func (c *Client) validateAndNormalizeSources(sources []string) ([]string, error) {
 	var validSources []string
+	seen := make(map[netip.Prefix]bool, len(sources))
 
 	for _, source := range sources {
-		// Try to parse as IP address first
-		if ip := net.ParseIP(source); ip != nil {
-			// Convert to CIDR notation
-			if ip.To4() != nil {
-				validSources = append(validSources, source+"/32")
-			} else {
-				validSources = append(validSources, source+"/128")
+		prefix, err := canonicalSource(source)
+		if err != nil {
+			c.logger.Warn("Invalid IP address or CIDR block", zap.String("source", source))
+			return nil, fmt.Errorf("invalid IP address or CIDR block: %s", source)
+		}
+
+		if !c.allowLocalIPv6 {
+			for _, local := range nonRoutableIPv6 {
+				if prefix.Bits() >= local.prefix.Bits() && local.prefix.Contains(prefix.Addr()) {
+					c.logger.Warn("Rejecting non-routable IPv6 source", zap.String("source", source), zap.String("range", local.name))
+					return nil, fmt.Errorf("%s IPv6 source %s is not reachable from the internet (set digitalocean.allow-local-ipv6 to allow it)", local.name, source)
+				}
 			}
-			continue
 		}
 
-		// Try to parse as CIDR block
-		if _, _, err := net.ParseCIDR(source); err == nil {
-			validSources = append(validSources, source)
+		if seen[prefix] {
 			continue
 		}
-
-		c.logger.Warn("Invalid IP address or CIDR block", zap.String("source", source))
-		return nil, fmt.Errorf("invalid IP address or CIDR block: %s", source)
+		seen[prefix] = true
+		validSources = append(validSources, prefix.String())
 	}
 
 	return validSources, nil
 }
 
+// canonicalSource parses an IP address or CIDR block into its canonical prefix, addresses becoming
+// single-address prefixes
+func canonicalSource(source string) (netip.Prefix, error) {
+	// Zones such as %eth0 only mean something on the host that resolved the address
+	value := source
+	if strings.Contains(value, "%") {
+		address, bits, hasBits := strings.Cut(value, "/")
+		value, _, _ = strings.Cut(address, "%")
+		if hasBits {
+			value += "/" + bits
+		}
+	}
+
+	var prefix netip.Prefix
+	if strings.Contains(value, "/") {
+		parsed, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		prefix = parsed
+	} else {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	// ::ffff:192.0.2.1 is the IPv4 address, its prefix length covering the mapped 96 bits
+	if prefix.Addr().Is4In6() {
+		if prefix.Bits() < 96 {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix length for an IPv4-mapped address: %s", source)
+		}
+		return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96).Masked(), nil
+	}
+	return prefix.Masked(), nil
+}
+
 // ListFirewalls lists all firewalls in the account
 func (c *Client) ListFirewalls(ctx context.Context) ([]godo.Firewall, error) {
 	c.logger.Debug("Listing firewalls")
@@ -176,11 +307,133 @@ func (c *Client) ListFirewalls(ctx context.Context) ([]godo.Firewall, error) {
 // If replaceExisting is true, it removes all existing SSH rules for the port and replaces with the new IP
 // If replaceExisting is false, it appends the IP to existing SSH rules for the port
 func (c *Client) AddSSHRule(ctx context.Context, firewallID string, sourceIP string, port int, replaceExisting bool) error {
+	return c.updateSSHRule(ctx, firewallID, []string{sourceIP}, port, replaceExisting, nil)
+}
+
+// ReplaceSSHSource adds sourceIP to the SSH rule for the port and removes previousIP from it in a
+// single update, keeping every other source
+func (c *Client) ReplaceSSHSource(ctx context.Context, firewallID string, previousIP string, sourceIP string, port int) error {
+	var previous []string
+	if previousIP != "" {
+		previous = []string{previousIP}
+	}
+	return c.ReplaceSSHSources(ctx, firewallID, previous, []string{sourceIP}, port)
+}
+
+// ReplaceSSHSources adds sourceIPs to the SSH rule for the port and removes the previous sources
+// that are no longer wanted in a single update, keeping every other source
+func (c *Client) ReplaceSSHSources(ctx context.Context, firewallID string, previousIPs []string, sourceIPs []string, port int) error {
+	current := make(map[string]bool, len(sourceIPs))
+	for _, ip := range sourceIPs {
+		current[ip] = true
+	}
+
+	var stale []string
+	for _, ip := range previousIPs {
+		if !current[ip] {
+			stale = append(stale, ip)
+		}
+	}
+	return c.updateSSHRule(ctx, firewallID, sourceIPs, port, false, stale)
+}
+
+// RemoveSSHSources removes sourceIPs from the SSH rule for the port, keeping every other source;
+// the rule is deleted when no source is left
+func (c *Client) RemoveSSHSources(ctx context.Context, firewallID string, sourceIPs []string, port int) error {
+	release, err := c.acquireLock(ctx, firewallID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	firewall, err := c.GetFirewall(ctx, firewallID)
+	if err != nil {
+		return fmt.Errorf("failed to get current firewall: %w", err)
+	}
+
+	addresses, err := c.validateAndNormalizeSources(sourceIPs)
+	if err != nil {
+		return fmt.Errorf("failed to validate source IP: %w", err)
+	}
+	remove := make(map[string]bool, len(addresses))
+	for _, addr := range addresses {
+		remove[addr] = true
+	}
+
+	portRange := fmt.Sprintf("%d", port)
+	removed := false
+	newInboundRules := make([]godo.InboundRule, 0, len(firewall.InboundRules))
+	for _, rule := range firewall.InboundRules {
+		if rule.Protocol != "tcp" || rule.PortRange != portRange || rule.Sources == nil {
+			newInboundRules = append(newInboundRules, rule)
+			continue
+		}
+
+		var kept []string
+		for _, addr := range rule.Sources.Addresses {
+			if remove[addr] {
+				removed = true
+				continue
+			}
+			kept = append(kept, addr)
+		}
+		if len(kept) == 0 && len(rule.Sources.Tags) == 0 && len(rule.Sources.DropletIDs) == 0 &&
+			len(rule.Sources.LoadBalancerUIDs) == 0 && len(rule.Sources.KubernetesIDs) == 0 {
+			continue
+		}
+
+		sources := *rule.Sources
+		sources.Addresses = kept
+		rule.Sources = &sources
+		newInboundRules = append(newInboundRules, rule)
+	}
+
+	if !removed {
+		c.logger.Debug("SSH sources already absent",
+			zap.String("firewall_id", firewallID),
+			zap.Strings("source_ips", sourceIPs),
+			zap.Int("port", port))
+		return nil
+	}
+
+	if err := c.replaceInboundRules(ctx, firewall, newInboundRules); err != nil {
+		return fmt.Errorf("failed to remove SSH sources: %w", err)
+	}
+
+	c.logger.Info("Removed sources from SSH rule",
+		zap.String("firewall_id", firewallID),
+		zap.Strings("source_ips", sourceIPs),
+		zap.Int("port", port))
+	return nil
+}
+
+// updateSSHRule adds sourceIPs to the SSH rule for the port, either replacing all existing sources
+// or appending to them while dropping the stale sources
+func (c *Client) updateSSHRule(
+	ctx context.Context,
+	firewallID string,
+	sourceIPs []string,
+	port int,
+	replaceExisting bool,
+	staleSources []string,
+) error {
 	c.logger.Info("Adding SSH rule to firewall",
 		zap.String("firewall_id", firewallID),
-		zap.String("source_ip", sourceIP),
+		zap.Strings("source_ips", sourceIPs),
 		zap.Int("port", port),
-		zap.Bool("replace_existing", replaceExisting))
+		zap.Bool("replace_existing", replaceExisting),
+		zap.Strings("stale_sources", staleSources))
+
+	if len(sourceIPs) == 0 {
+		return fmt.Errorf("no source IP given for SSH rule on port %d", port)
+	}
+
+	// Hold the mutation lock across the read-modify-write of the firewall
+	release, err := c.acquireLock(ctx, firewallID)
+	if err != nil {
+		return err
+	}
+	defer release()
 
 	// Get current firewall configuration
 	firewall, err := c.GetFirewall(ctx, firewallID)
@@ -188,13 +441,22 @@ func (c *Client) AddSSHRule(ctx context.Context, firewallID string, sourceIP str
 		return fmt.Errorf("failed to get current firewall: %w", err)
 	}
 
-	// Validate and normalize the source IP
-	validSources, err := c.validateAndNormalizeSources([]string{sourceIP})
+	// Validate and normalize the source IPs
+	validSources, err := c.validateAndNormalizeSources(sourceIPs)
 	if err != nil {
 		c.logger.Error("Failed to validate source IP", zap.Error(err))
 		return fmt.Errorf("failed to validate source IP: %w", err)
 	}
 
+	staleAddresses, err := c.validateAndNormalizeSources(staleSources)
+	if err != nil {
+		return fmt.Errorf("failed to validate stale sources: %w", err)
+	}
+	stale := make(map[string]bool, len(staleAddresses))
+	for _, addr := range staleAddresses {
+		stale[addr] = true
+	}
+
 	var newInboundRules []godo.InboundRule
 	var existingSSHRule *godo.InboundRule
 	var existingSSHRuleIndex int = -1
@@ -209,22 +471,31 @@ func (c *Client) AddSSHRule(ctx context.Context, firewallID string, sourceIP str
 	}
 
 	if existingSSHRule != nil {
-		// Check if IP already exists in the rule
-		ipAlreadyExists := false
+		// Check which IPs already exist in the rule and whether any stale source is still present
+		existing := make(map[string]bool)
+		hasStale := false
 		if existingSSHRule.Sources != nil {
 			for _, addr := range existingSSHRule.Sources.Addresses {
-				if addr == validSources[0] {
-					ipAlreadyExists = true
-					c.logger.Info("SSH rule already exists for this IP",
-						zap.String("source_ip", sourceIP),
-						zap.Int("port", port))
-					break
+				existing[addr] = true
+				if stale[addr] {
+					hasStale = true
 				}
 			}
 		}
 
-		if ipAlreadyExists && !replaceExisting {
-			return nil // IP already exists and we're not replacing, nothing to do
+		var missingSources []string
+		for _, addr := range validSources {
+			if existing[addr] {
+				c.logger.Info("SSH rule already exists for this IP",
+					zap.String("source_ip", addr),
+					zap.Int("port", port))
+				continue
+			}
+			missingSources = append(missingSources, addr)
+		}
+
+		if len(missingSources) == 0 && !hasStale && !replaceExisting {
+			return nil // IPs already exist and we're not replacing, nothing to do
 		}
 
 		// Copy all rules except the existing SSH rule
@@ -237,20 +508,28 @@ func (c *Client) AddSSHRule(ctx context.Context, firewallID string, sourceIP str
 		// Create updated SSH rule
 		var updatedAddresses []string
 		if replaceExisting {
-			// Replace mode: only use the new IP
+			// Replace mode: only use the new IPs
 			updatedAddresses = validSources
 			c.logger.Info("Replacing existing SSH rule with current IP",
-				zap.String("source_ip", sourceIP),
+				zap.Strings("source_ips", sourceIPs),
 				zap.Int("port", port))
 		} else {
-			// Append mode: merge with existing IPs
+			// Append mode: merge with existing IPs, dropping stale ones
 			if existingSSHRule.Sources != nil {
-				updatedAddresses = append(updatedAddresses, existingSSHRule.Sources.Addresses...)
+				for _, addr := range existingSSHRule.Sources.Addresses {
+					if stale[addr] {
+						c.logger.Info("Removing stale IP from SSH rule",
+							zap.String("stale_source", addr),
+							zap.Int("port", port))
+						continue
+					}
+					updatedAddresses = append(updatedAddresses, addr)
+				}
 			}
-			if !ipAlreadyExists {
-				updatedAddresses = append(updatedAddresses, validSources...)
+			if len(missingSources) > 0 {
+				updatedAddresses = append(updatedAddresses, missingSources...)
 				c.logger.Info("Appending IP to existing SSH rule",
-					zap.String("source_ip", sourceIP),
+					zap.Strings("source_ips", missingSources),
 					zap.Int("port", port),
 					zap.Int("total_ips", len(updatedAddresses)))
 			}
@@ -279,7 +558,7 @@ func (c *Client) AddSSHRule(ctx context.Context, firewallID string, sourceIP str
 		newInboundRules = append(newInboundRules, sshRule)
 
 		c.logger.Info("Creating new SSH rule",
-			zap.String("source_ip", sourceIP),
+			zap.Strings("source_ips", sourceIPs),
 			zap.Int("port", port))
 	}
 
@@ -291,25 +570,13 @@ func (c *Client) AddSSHRule(ctx context.Context, firewallID string, sourceIP str
 	}
 
 	// Update the firewall
-	updateRequest := &godo.FirewallRequest{
-		Name:          firewall.Name,
-		InboundRules:  newInboundRules,
-		OutboundRules: firewall.OutboundRules,
-		Tags:          firewall.Tags,
-		DropletIDs:    firewall.DropletIDs, // Preserve existing droplet attachments
-	}
-
-	_, _, err = c.client.Firewalls.Update(ctx, firewallID, updateRequest)
-	if err != nil {
-		c.logger.Error("Failed to update firewall with SSH rule",
-			zap.String("firewall_id", firewallID),
-			zap.Error(err))
-		return fmt.Errorf("failed to update firewall %s with SSH rule: %w", firewallID, err)
+	if err := c.replaceInboundRules(ctx, firewall, newInboundRules); err != nil {
+		return fmt.Errorf("failed to add SSH rule: %w", err)
 	}
 
 	c.logger.Info("Successfully added SSH rule to firewall",
 		zap.String("firewall_id", firewallID),
-		zap.String("source_ip", sourceIP),
+		zap.Strings("source_ips", sourceIPs),
 		zap.Int("port", port),
 		zap.Int("total_inbound_rules", len(newInboundRules)),
 		zap.Int("preserved_droplets", len(firewall.DropletIDs)))
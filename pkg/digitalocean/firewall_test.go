@@ -0,0 +1,249 @@
+package digitalocean
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestReplaceSSHSource(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID:   "fw-1",
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"192.0.2.10/32", "203.0.113.5/32"}}},
+		},
+	})
+	client := newTestClient(t, api)
+
+	if err := client.ReplaceSSHSource(context.Background(), "fw-1", "203.0.113.5", "198.51.100.7", 22); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	addresses := api.firewalls["fw-1"].InboundRules[0].Sources.Addresses
+	expected := []string{"192.0.2.10/32", "198.51.100.7/32"}
+	if len(addresses) != len(expected) {
+		t.Fatalf("expected addresses %v, got %v", expected, addresses)
+	}
+	for i := range expected {
+		if addresses[i] != expected[i] {
+			t.Errorf("expected address %d to be %s, got %s", i, expected[i], addresses[i])
+		}
+	}
+}
+
+func TestReplaceSSHSourceUnchanged(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID: "fw-1",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"203.0.113.5/32"}}},
+		},
+	})
+	client := newTestClient(t, api)
+
+	if err := client.ReplaceSSHSource(context.Background(), "fw-1", "203.0.113.5", "203.0.113.5", 22); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updates != 0 {
+		t.Errorf("expected no update when the IP did not change, got %d", api.updates)
+	}
+}
+
+func TestReplaceSSHSources(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID: "fw-1",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"192.0.2.10/32", "203.0.113.5/32", "2001:db8::1/128"}}},
+		},
+	})
+	client := newTestClient(t, api)
+
+	previous := []string{"203.0.113.5", "2001:db8::1"}
+	current := []string{"198.51.100.7", "2001:db8::1"}
+	if err := client.ReplaceSSHSources(context.Background(), "fw-1", previous, current, 22); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	addresses := api.firewalls["fw-1"].InboundRules[0].Sources.Addresses
+	expected := []string{"192.0.2.10/32", "2001:db8::1/128", "198.51.100.7/32"}
+	if len(addresses) != len(expected) {
+		t.Fatalf("expected addresses %v, got %v", expected, addresses)
+	}
+	for i := range expected {
+		if addresses[i] != expected[i] {
+			t.Errorf("expected address %d to be %s, got %s", i, expected[i], addresses[i])
+		}
+	}
+}
+
+func TestRemoveSSHSources(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID: "fw-1",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"192.0.2.10/32", "203.0.113.5/32"}}},
+			{Protocol: "tcp", PortRange: "2222", Sources: &godo.Sources{Addresses: []string{"203.0.113.5/32"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"203.0.113.5/32"}}},
+		},
+	})
+	client := newTestClient(t, api)
+
+	if err := client.RemoveSSHSources(context.Background(), "fw-1", []string{"203.0.113.5"}, 22); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.RemoveSSHSources(context.Background(), "fw-1", []string{"203.0.113.5"}, 2222); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rules := api.firewalls["fw-1"].InboundRules
+	if len(rules) != 2 {
+		t.Fatalf("expected the emptied rule to be deleted, got %+v", rules)
+	}
+	if addresses := rules[0].Sources.Addresses; len(addresses) != 1 || addresses[0] != "192.0.2.10/32" {
+		t.Errorf("expected 192.0.2.10/32 to remain on port 22, got %v", addresses)
+	}
+	if rules[1].PortRange != "443" || len(rules[1].Sources.Addresses) != 1 {
+		t.Errorf("expected other ports to be untouched, got %+v", rules[1])
+	}
+
+	updates := api.updates
+	if err := client.RemoveSSHSources(context.Background(), "fw-1", []string{"203.0.113.5"}, 22); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updates != updates {
+		t.Errorf("expected no update when the address is already absent")
+	}
+}
+
+func TestUpdateFirewallRulesUnchanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []godo.InboundRule
+		changed bool
+	}{
+		{
+			name: "same addresses in another order",
+			rules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Tags: []string{"bastion"}}},
+				{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"203.0.113.0/24", "192.0.2.0/24"}}},
+			},
+		},
+		{
+			name: "address added",
+			rules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Tags: []string{"bastion"}}},
+				{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+			},
+			changed: true,
+		},
+		{
+			// The managed rule only allows addresses, so the tag would be dropped
+			name: "tag on a managed port",
+			rules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Tags: []string{"bastion"}}},
+				{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{
+					Addresses: []string{"192.0.2.0/24", "203.0.113.0/24"},
+					Tags:      []string{"web"},
+				}},
+			},
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web", InboundRules: tt.rules})
+			client := newTestClient(t, api)
+
+			sources := []string{"192.0.2.0/24", "203.0.113.0/24"}
+			rules := []FirewallRule{{Port: 443, Protocol: "tcp", Sources: sources}}
+			_, changed, err := client.UpdateFirewallRules(context.Background(), "fw-1", rules, sources)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("expected changed to be %v, got %v", tt.changed, changed)
+			}
+			expected := 0
+			if tt.changed {
+				expected = 1
+			}
+			if api.updates != expected {
+				t.Errorf("expected %d updates, got %d", expected, api.updates)
+			}
+
+			// The second run finds the rules it applied
+			if _, changed, err := client.UpdateFirewallRules(context.Background(), "fw-1", rules, sources); err != nil || changed {
+				t.Errorf("expected the second run to change nothing, got changed %v and error %v", changed, err)
+			}
+		})
+	}
+}
+
+func TestUpdateFirewallRulesDropletSources(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web"})
+	client := newTestClient(t, api)
+
+	sources := []string{"192.0.2.0/24"}
+	rules := []FirewallRule{
+		{Port: 22, Protocol: "tcp", Sources: sources, Tags: []string{"bastion"}, DropletIDs: []int{42}},
+		{Port: 443, Protocol: "tcp", Sources: sources},
+	}
+	if _, _, err := client.UpdateFirewallRules(context.Background(), "fw-1", rules, sources); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fw := api.firewalls["fw-1"]
+	if len(fw.InboundRules) != 2 {
+		t.Fatalf("expected 2 inbound rules, got %+v", fw.InboundRules)
+	}
+	ssh := fw.InboundRules[0].Sources
+	if !slices.Equal(ssh.Addresses, sources) || !slices.Equal(ssh.Tags, []string{"bastion"}) || !slices.Equal(ssh.DropletIDs, []int{42}) {
+		t.Errorf("expected the SSH rule to allow the addresses, tag and droplet, got %+v", ssh)
+	}
+	if https := fw.InboundRules[1].Sources; len(https.Tags) != 0 || len(https.DropletIDs) != 0 {
+		t.Errorf("expected the HTTPS rule to allow only addresses, got %+v", https)
+	}
+
+	// Removing the tag from the configuration removes it from the rule
+	rules[0].Tags = nil
+	_, changed, err := client.UpdateFirewallRules(context.Background(), "fw-1", rules, sources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || len(fw.InboundRules[0].Sources.Tags) != 0 {
+		t.Errorf("expected the tag to be removed, got changed %v and %+v", changed, fw.InboundRules[0].Sources)
+	}
+}
+
+func TestUpdateFirewallRulesOwnSources(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web"})
+	client := newTestClient(t, api)
+
+	sources := []string{"192.0.2.0/24"}
+	rules := []FirewallRule{
+		{Port: 22, Protocol: "tcp", Sources: []string{"34.16.0.5/17", "34.16.0.0/17"}, OwnSources: true},
+		{Port: 443, Protocol: "tcp", Sources: sources},
+	}
+	if _, _, err := client.UpdateFirewallRules(context.Background(), "fw-1", rules, sources); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fw := api.firewalls["fw-1"]
+	if len(fw.InboundRules) != 2 {
+		t.Fatalf("expected 2 inbound rules, got %+v", fw.InboundRules)
+	}
+	if ssh := fw.InboundRules[0].Sources.Addresses; !slices.Equal(ssh, []string{"34.16.0.0/17"}) {
+		t.Errorf("expected the SSH rule to allow its own normalized sources, got %v", ssh)
+	}
+	if https := fw.InboundRules[1].Sources.Addresses; !slices.Equal(https, sources) {
+		t.Errorf("expected the HTTPS rule to allow the sources of the update, got %v", https)
+	}
+
+	// An invalid own source fails the update like an invalid source of the update
+	rules[0].Sources = []string{"not-an-address"}
+	if _, _, err := client.UpdateFirewallRules(context.Background(), "fw-1", rules, sources); err == nil {
+		t.Error("expected an invalid own source to fail the update")
+	}
+}
@@ -0,0 +1,29 @@
+package digitalocean
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// IsFrozen reports whether the firewall carries the freeze tag; an empty tag never freezes
+func (c *Client) IsFrozen(ctx context.Context, firewallID string, tag string) (bool, error) {
+	if tag == "" {
+		return false, nil
+	}
+
+	firewall, err := c.GetFirewall(ctx, firewallID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, t := range firewall.Tags {
+		if t == tag {
+			c.logger.Debug("Firewall carries the freeze tag",
+				zap.String("firewall_id", firewallID),
+				zap.String("tag", tag))
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,44 @@
+package digitalocean
+
+import (
+	"context"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestIsFrozen(t *testing.T) {
+	api := newFakeFirewallAPI(
+		&godo.Firewall{ID: "fw-frozen", Name: "frozen", Tags: []string{"web", "allowlister-freeze"}},
+		&godo.Firewall{ID: "fw-active", Name: "active", Tags: []string{"web"}},
+	)
+	client := newTestClient(t, api)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		firewallID string
+		tag        string
+		expected   bool
+	}{
+		{name: "tagged firewall", firewallID: "fw-frozen", tag: "allowlister-freeze", expected: true},
+		{name: "untagged firewall", firewallID: "fw-active", tag: "allowlister-freeze", expected: false},
+		{name: "freeze tag disabled", firewallID: "fw-frozen", tag: "", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frozen, err := client.IsFrozen(ctx, tt.firewallID, tt.tag)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if frozen != tt.expected {
+				t.Errorf("expected frozen %v, got %v", tt.expected, frozen)
+			}
+		})
+	}
+
+	if _, err := client.IsFrozen(ctx, "missing", "allowlister-freeze"); err == nil {
+		t.Error("expected error for unknown firewall")
+	}
+}
@@ -0,0 +1,68 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap"
+)
+
+// OrphanedRules returns the inbound rules of the firewall covering only the given ports; rules whose
+// port range also covers other ports are left out
+func OrphanedRules(firewall *godo.Firewall, ports []int) []godo.InboundRule {
+	orphaned, _ := splitPortRules(firewall.InboundRules, ports)
+	return orphaned
+}
+
+// splitPortRules separates the rules covering only the given ports from the others
+func splitPortRules(rules []godo.InboundRule, ports []int) (orphaned, kept []godo.InboundRule) {
+	set := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		set[port] = true
+	}
+
+	for _, rule := range rules {
+		if isManagedPortRange(rule.PortRange, set) {
+			orphaned = append(orphaned, rule)
+		} else {
+			kept = append(kept, rule)
+		}
+	}
+	return orphaned, kept
+}
+
+// RemovePortRules deletes the inbound rules covering only the given ports, keeping every other
+// rule, and returns the deleted rules
+func (c *Client) RemovePortRules(ctx context.Context, firewallID string, ports []int) ([]godo.InboundRule, error) {
+	// Hold the mutation lock across the read-modify-write of the firewall
+	release, err := c.acquireLock(ctx, firewallID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	firewall, err := c.GetFirewall(ctx, firewallID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current firewall: %w", err)
+	}
+
+	removed, newInboundRules := splitPortRules(firewall.InboundRules, ports)
+	if len(removed) == 0 {
+		c.logger.Debug("No inbound rules left for the ports",
+			zap.String("firewall_id", firewallID),
+			zap.Ints("ports", ports))
+		return nil, nil
+	}
+
+	if err := c.replaceInboundRules(ctx, firewall, newInboundRules); err != nil {
+		return nil, fmt.Errorf("failed to remove inbound rules: %w", err)
+	}
+
+	c.logger.Info("Removed inbound rules",
+		zap.String("firewall_id", firewallID),
+		zap.Ints("ports", ports),
+		zap.Int("removed_rules", len(removed)),
+		zap.Int("total_inbound_rules", len(newInboundRules)))
+	return removed, nil
+}
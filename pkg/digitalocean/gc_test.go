@@ -0,0 +1,83 @@
+package digitalocean
+
+import (
+	"context"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func newGCTestFirewall() *godo.Firewall {
+	return &godo.Firewall{
+		ID:   "fw-1",
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+			{Protocol: "tcp", PortRange: "8080", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+			{Protocol: "udp", PortRange: "8080", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+			{Protocol: "tcp", PortRange: "8080-8082", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+		},
+		DropletIDs: []int{42},
+	}
+}
+
+func TestOrphanedRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []int
+		want  []string
+	}{
+		{name: "no ports", ports: nil, want: nil},
+		{name: "single port rules", ports: []int{8080}, want: []string{"tcp/8080", "udp/8080"}},
+		{name: "whole range", ports: []int{8080, 8081, 8082}, want: []string{"tcp/8080", "udp/8080", "tcp/8080-8082"}},
+		{name: "unknown port", ports: []int{9090}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, rule := range OrphanedRules(newGCTestFirewall(), tt.ports) {
+				got = append(got, rule.Protocol+"/"+rule.PortRange)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRemovePortRules(t *testing.T) {
+	api := newFakeFirewallAPI(newGCTestFirewall())
+	client := newTestClient(t, api)
+	ctx := context.Background()
+
+	removed, err := client.RemovePortRules(ctx, "fw-1", []int{8080})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected both port 8080 rules to be removed, got %+v", removed)
+	}
+
+	fw := api.firewalls["fw-1"]
+	if len(fw.InboundRules) != 2 || fw.InboundRules[0].PortRange != "22" || fw.InboundRules[1].PortRange != "8080-8082" {
+		t.Errorf("expected the port 22 and range rules to remain, got %+v", fw.InboundRules)
+	}
+	if len(fw.DropletIDs) != 1 || fw.DropletIDs[0] != 42 {
+		t.Errorf("expected droplet attachments to be preserved, got %v", fw.DropletIDs)
+	}
+
+	// Nothing is left for the port, so the firewall is not written again
+	removed, err = client.RemovePortRules(ctx, "fw-1", []int{8080})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(removed) != 0 || api.updates != 1 {
+		t.Errorf("expected no further update, got %d removed rules and %d updates", len(removed), api.updates)
+	}
+}
@@ -0,0 +1,91 @@
+package digitalocean
+
+import (
+	"context"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func newLockdownTestFirewall() *godo.Firewall {
+	return &godo.Firewall{
+		ID:   "fw-1",
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"0.0.0.0/0"}}},
+		},
+		DropletIDs: []int{42},
+	}
+}
+
+func TestLockdownRemovesRules(t *testing.T) {
+	api := newFakeFirewallAPI(newLockdownTestFirewall())
+	client := newTestClient(t, api)
+	ctx := context.Background()
+
+	backup, err := client.Lockdown(ctx, "fw-1", []int{22}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(backup) != 1 || backup[0].PortRange != "22" {
+		t.Fatalf("expected port 22 rule in backup, got %+v", backup)
+	}
+
+	fw := api.firewalls["fw-1"]
+	if len(fw.InboundRules) != 1 || fw.InboundRules[0].PortRange != "443" {
+		t.Errorf("expected only port 443 rule to remain, got %+v", fw.InboundRules)
+	}
+
+	if len(fw.DropletIDs) != 1 || fw.DropletIDs[0] != 42 {
+		t.Errorf("expected droplet attachments to be preserved, got %v", fw.DropletIDs)
+	}
+
+	if err := client.RestoreRules(ctx, "fw-1", []int{22}, backup); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fw.InboundRules) != 2 {
+		t.Errorf("expected 2 rules after restore, got %d", len(fw.InboundRules))
+	}
+}
+
+func TestLockdownBreakGlass(t *testing.T) {
+	api := newFakeFirewallAPI(newLockdownTestFirewall())
+	client := newTestClient(t, api)
+
+	_, err := client.Lockdown(context.Background(), "fw-1", []int{22}, []string{"203.0.113.5"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fw := api.firewalls["fw-1"]
+	var sshRule *godo.InboundRule
+	for i := range fw.InboundRules {
+		if fw.InboundRules[i].PortRange == "22" {
+			sshRule = &fw.InboundRules[i]
+		}
+	}
+
+	if sshRule == nil {
+		t.Fatal("expected break-glass rule for port 22")
+	}
+
+	if len(sshRule.Sources.Addresses) != 1 || sshRule.Sources.Addresses[0] != "203.0.113.5/32" {
+		t.Errorf("expected break-glass source 203.0.113.5/32, got %v", sshRule.Sources.Addresses)
+	}
+}
+
+func TestLockdownInvalidBreakGlass(t *testing.T) {
+	api := newFakeFirewallAPI(newLockdownTestFirewall())
+	client := newTestClient(t, api)
+
+	if _, err := client.Lockdown(context.Background(), "fw-1", []int{22}, []string{"not-an-ip"}); err == nil {
+		t.Error("expected error for invalid break-glass source")
+	}
+
+	if api.updates != 0 {
+		t.Errorf("expected no firewall updates, got %d", api.updates)
+	}
+}
@@ -0,0 +1,114 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap"
+)
+
+// MovePortRules moves the sources of every inbound rule for port from to the rule of the same
+// protocol for port to in a single firewall update, merging them into an existing rule; it returns
+// the number of rules moved
+func (c *Client) MovePortRules(ctx context.Context, firewallID string, from, to int) (int, error) {
+	// Hold the mutation lock across the read-modify-write of the firewall
+	release, err := c.acquireLock(ctx, firewallID)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	firewall, err := c.GetFirewall(ctx, firewallID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current firewall: %w", err)
+	}
+
+	newInboundRules, moved := movePortRules(firewall.InboundRules, strconv.Itoa(from), strconv.Itoa(to))
+	if moved == 0 {
+		c.logger.Debug("No inbound rules to move",
+			zap.String("firewall_id", firewallID),
+			zap.Int("from_port", from))
+		return 0, nil
+	}
+
+	if err := c.replaceInboundRules(ctx, firewall, newInboundRules); err != nil {
+		return 0, fmt.Errorf("failed to move inbound rules: %w", err)
+	}
+
+	c.logger.Info("Moved inbound rules to another port",
+		zap.String("firewall_id", firewallID),
+		zap.Int("from_port", from),
+		zap.Int("to_port", to),
+		zap.Int("moved_rules", moved))
+	return moved, nil
+}
+
+// movePortRules rewrites the rules of port range from to port range to, merging the sources of a
+// moved rule into the existing rule of the same protocol for to
+func movePortRules(rules []godo.InboundRule, from, to string) ([]godo.InboundRule, int) {
+	var moved []godo.InboundRule
+	count := 0
+	for _, rule := range rules {
+		if rule.PortRange != from {
+			continue
+		}
+		count++
+		index := slices.IndexFunc(moved, func(m godo.InboundRule) bool { return m.Protocol == rule.Protocol })
+		if index < 0 {
+			rule.PortRange = to
+			moved = append(moved, rule)
+			continue
+		}
+		moved[index].Sources = mergeSources(moved[index].Sources, rule.Sources)
+	}
+	if len(moved) == 0 {
+		return rules, 0
+	}
+
+	newInboundRules := make([]godo.InboundRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.PortRange == from {
+			continue
+		}
+		if rule.PortRange == to {
+			index := slices.IndexFunc(moved, func(m godo.InboundRule) bool { return m.Protocol == rule.Protocol })
+			if index >= 0 {
+				rule.Sources = mergeSources(rule.Sources, moved[index].Sources)
+				moved = slices.Delete(moved, index, index+1)
+			}
+		}
+		newInboundRules = append(newInboundRules, rule)
+	}
+	return append(newInboundRules, moved...), count
+}
+
+// mergeSources returns the union of two rule sources, keeping the order of a then b
+func mergeSources(a, b *godo.Sources) *godo.Sources {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &godo.Sources{
+		Addresses:        union(a.Addresses, b.Addresses),
+		Tags:             union(a.Tags, b.Tags),
+		DropletIDs:       union(a.DropletIDs, b.DropletIDs),
+		LoadBalancerUIDs: union(a.LoadBalancerUIDs, b.LoadBalancerUIDs),
+		KubernetesIDs:    union(a.KubernetesIDs, b.KubernetesIDs),
+	}
+}
+
+// union appends the values of b missing from a to a copy of a
+func union[T comparable](a, b []T) []T {
+	merged := slices.Clone(a)
+	for _, value := range b {
+		if !slices.Contains(merged, value) {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,62 @@
+package digitalocean
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestMovePortRules(t *testing.T) {
+	api := newFakeFirewallAPI(&godo.Firewall{
+		ID:   "fw-1",
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "2222", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32", "203.0.113.5/32"}}},
+			{Protocol: "udp", PortRange: "2222", Sources: &godo.Sources{Addresses: []string{"198.51.100.7/32"}}},
+			{Protocol: "tcp", PortRange: "22022", Sources: &godo.Sources{Addresses: []string{"203.0.113.5/32"}, Tags: []string{"bastion"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"0.0.0.0/0"}}},
+		},
+		DropletIDs: []int{42},
+	})
+	client := newTestClient(t, api)
+
+	moved, err := client.MovePortRules(context.Background(), "fw-1", 2222, 22022)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if moved != 2 {
+		t.Errorf("expected 2 moved rules, got %d", moved)
+	}
+	if api.updates != 1 {
+		t.Errorf("expected the rules to move in a single update, got %d updates", api.updates)
+	}
+
+	rules := make(map[string]*godo.Sources)
+	for _, rule := range api.firewalls["fw-1"].InboundRules {
+		rules[rule.Protocol+"/"+rule.PortRange] = rule.Sources
+	}
+	if len(rules) != 3 || rules["tcp/2222"] != nil || rules["udp/2222"] != nil {
+		t.Fatalf("expected no rules left for port 2222, got %v", rules)
+	}
+	if tcp := rules["tcp/22022"]; tcp == nil ||
+		!slices.Equal(tcp.Addresses, []string{"203.0.113.5/32", "198.51.100.7/32"}) || !slices.Equal(tcp.Tags, []string{"bastion"}) {
+		t.Errorf("expected the tcp sources to be merged into the existing rule, got %+v", tcp)
+	}
+	if udp := rules["udp/22022"]; udp == nil || !slices.Equal(udp.Addresses, []string{"198.51.100.7/32"}) {
+		t.Errorf("expected the udp rule to move to port 22022, got %+v", udp)
+	}
+	if len(api.firewalls["fw-1"].DropletIDs) != 1 {
+		t.Errorf("expected droplet attachments to be preserved, got %v", api.firewalls["fw-1"].DropletIDs)
+	}
+
+	// Nothing is left on the old port, so the firewall is not written again
+	moved, err = client.MovePortRules(context.Background(), "fw-1", 2222, 22022)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if moved != 0 || api.updates != 1 {
+		t.Errorf("expected no further update, got %d moved rules and %d updates", moved, api.updates)
+	}
+}
@@ -0,0 +1,150 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/digitalocean/godo"
+)
+
+// RuleAction is what applying a plan does to the inbound rule of one protocol and port range
+type RuleAction string
+
+const (
+	// RuleCreate adds a rule the firewall does not have yet
+	RuleCreate RuleAction = "create"
+	// RuleUpdate changes the sources of an existing rule
+	RuleUpdate RuleAction = "update"
+	// RuleDelete removes a rule, e.g. one outside its access window
+	RuleDelete RuleAction = "delete"
+	// RuleUnchanged leaves a rule as it is
+	RuleUnchanged RuleAction = "unchanged"
+)
+
+// RuleDiff is the planned change to the inbound rule of one protocol and port range
+type RuleDiff struct {
+	Rule    string     `json:"rule"` // "protocol/port"
+	Action  RuleAction `json:"action"`
+	Added   []string   `json:"added,omitempty"`   // addresses, droplets, tags, load balancers and clusters gained
+	Removed []string   `json:"removed,omitempty"` // addresses, droplets, tags, load balancers and clusters lost
+	Kept    int        `json:"kept"`              // sources allowed before and after
+}
+
+// Plan is the diff between a firewall's inbound rules and the rules an update would write
+type Plan struct {
+	FirewallID   string     `json:"firewall_id"`
+	FirewallName string     `json:"firewall_name"`
+	Rules        []RuleDiff `json:"rules"`
+}
+
+// HasChanges reports whether applying the plan changes any rule
+func (p Plan) HasChanges() bool {
+	return slices.ContainsFunc(p.Rules, func(rule RuleDiff) bool { return rule.Action != RuleUnchanged })
+}
+
+// Counts returns how many sources the plan adds and removes across all rules
+func (p Plan) Counts() (added, removed int) {
+	for _, rule := range p.Rules {
+		added += len(rule.Added)
+		removed += len(rule.Removed)
+	}
+	return added, removed
+}
+
+// DiffRules compares two inbound rule sets rule by rule, keyed by protocol and port range and
+// sorted by them; droplets, tags, load balancers and clusters are listed as in ruleTargets
+func DiffRules(firewall *godo.Firewall, newRules []godo.InboundRule) Plan {
+	current := ruleSources(firewall.InboundRules)
+	desired := ruleSources(newRules)
+
+	plan := Plan{FirewallID: firewall.ID, FirewallName: firewall.Name}
+	keys := slices.Sorted(maps.Keys(current))
+	for key := range desired {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		before, inCurrent := current[key]
+		after, inDesired := desired[key]
+		removed, added := diffSorted(before, after)
+
+		diff := RuleDiff{
+			Rule:    key,
+			Action:  RuleUnchanged,
+			Added:   added,
+			Removed: removed,
+			Kept:    len(before) - len(removed),
+		}
+		switch {
+		case !inCurrent:
+			diff.Action = RuleCreate
+		case !inDesired:
+			diff.Action = RuleDelete
+		case len(added) > 0 || len(removed) > 0:
+			diff.Action = RuleUpdate
+		}
+		plan.Rules = append(plan.Rules, diff)
+	}
+	return plan
+}
+
+// ruleSources indexes every source of inbound rules by "protocol/port", sorted and deduplicated
+func ruleSources(rules []godo.InboundRule) map[string][]string {
+	sources := ruleAddressLists(rules)
+	for key, targets := range ruleTargets(rules) {
+		merged := append(slices.Clone(sources[key]), targets...)
+		slices.Sort(merged)
+		sources[key] = slices.Compact(merged)
+	}
+	return sources
+}
+
+// PlanFirewallRules diffs the firewall's inbound rules against the rules UpdateFirewallRules would
+// write for the same arguments, changing nothing
+func (c *Client) PlanFirewallRules(
+	ctx context.Context,
+	firewallID string,
+	rules []FirewallRule,
+	sourceIPs []string,
+) (*Plan, error) {
+	planned, err := c.PlanFirewallUpdate(ctx, firewallID, rules, sourceIPs)
+	if err != nil {
+		return nil, err
+	}
+	return &planned.Plan, nil
+}
+
+// PlanFirewallUpdate plans like PlanFirewallRules, keeping the complete inbound rules the update
+// would write so that ApplyPlannedFirewall can write them verbatim later
+func (c *Client) PlanFirewallUpdate(
+	ctx context.Context,
+	firewallID string,
+	rules []FirewallRule,
+	sourceIPs []string,
+) (*PlannedFirewall, error) {
+	firewall, err := c.GetFirewall(ctx, firewallID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current firewall: %w", err)
+	}
+
+	validSources, err := c.NormalizeSources(sourceIPs)
+	if err != nil {
+		return nil, err
+	}
+	rules, err = c.normalizeOwnSources(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	inboundRules := c.desiredInboundRules(firewall, rules, validSources)
+	return &PlannedFirewall{
+		Plan:              DiffRules(firewall, inboundRules),
+		BeforeFingerprint: SourcesFingerprint(firewall.InboundRules),
+		InboundRules:      inboundRules,
+	}, nil
+}
@@ -0,0 +1,80 @@
+package digitalocean
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestDiffRules(t *testing.T) {
+	firewall := &godo.Firewall{
+		ID:   "fw-1",
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Tags: []string{"bastion"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24", "198.51.100.0/24"}}},
+			{Protocol: "tcp", PortRange: "8080", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+		},
+	}
+	newRules := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Tags: []string{"bastion"}}},
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"203.0.113.0/24", "192.0.2.0/24"}}},
+		{Protocol: "udp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+	}
+
+	plan := DiffRules(firewall, newRules)
+
+	expected := Plan{
+		FirewallID:   "fw-1",
+		FirewallName: "web",
+		Rules: []RuleDiff{
+			{Rule: "tcp/22", Action: RuleUnchanged, Kept: 1},
+			{Rule: "tcp/443", Action: RuleUpdate, Added: []string{"203.0.113.0/24"}, Removed: []string{"198.51.100.0/24"}, Kept: 1},
+			{Rule: "tcp/8080", Action: RuleDelete, Removed: []string{"192.0.2.0/24"}},
+			{Rule: "udp/443", Action: RuleCreate, Added: []string{"192.0.2.0/24"}},
+		},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("expected plan %+v, got %+v", expected, plan)
+	}
+	if !plan.HasChanges() {
+		t.Error("expected the plan to have changes")
+	}
+	if added, removed := plan.Counts(); added != 2 || removed != 2 {
+		t.Errorf("expected 2 added and 2 removed sources, got %d and %d", added, removed)
+	}
+
+	if DiffRules(firewall, firewall.InboundRules).HasChanges() {
+		t.Error("expected no changes when the rules are the same")
+	}
+}
+
+func TestPlanFirewallRules(t *testing.T) {
+	current := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Tags: []string{"bastion"}}},
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+	}
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web", InboundRules: current})
+	client := newTestClient(t, api)
+
+	sources := []string{"192.0.2.0/24", "203.0.113.7"}
+	rules := []FirewallRule{{Port: 443, Protocol: "tcp", Sources: sources}}
+	plan, err := client.PlanFirewallRules(context.Background(), "fw-1", rules, sources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The unmanaged SSH rule is kept and the new address is normalized like an update would
+	expected := []RuleDiff{
+		{Rule: "tcp/22", Action: RuleUnchanged, Kept: 1},
+		{Rule: "tcp/443", Action: RuleUpdate, Added: []string{"203.0.113.7/32"}, Kept: 1},
+	}
+	if !reflect.DeepEqual(plan.Rules, expected) {
+		t.Errorf("expected rules %+v, got %+v", expected, plan.Rules)
+	}
+	if api.updates != 0 {
+		t.Errorf("expected planning to leave the firewall alone, got %d updates", api.updates)
+	}
+}
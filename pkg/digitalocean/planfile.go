@@ -0,0 +1,173 @@
+package digitalocean
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap"
+)
+
+// PlanFileVersion is the version of the plan file format, raised on every incompatible change so
+// that a plan is never applied by a release reading it differently
+const PlanFileVersion = 1
+
+// ErrPlanDrift is returned when a firewall's inbound rules changed since its plan was made, so
+// applying the plan would overwrite changes nobody reviewed
+var ErrPlanDrift = errors.New("firewall changed since the plan was made")
+
+// PlanFile is a plan saved for review by plan -o and applied verbatim by apply --plan
+type PlanFile struct {
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+	Firewalls []PlannedFirewall `json:"firewalls"`
+}
+
+// PlannedFirewall is the planned update of one firewall: the diff to review and the complete
+// inbound rules the update writes
+type PlannedFirewall struct {
+	Plan
+	// BeforeFingerprint is the SourcesFingerprint of the inbound rules when the plan was made
+	BeforeFingerprint string             `json:"before_fingerprint"`
+	InboundRules      []godo.InboundRule `json:"inbound_rules"`
+}
+
+// NewPlanFile returns the plan file of the planned firewalls
+func NewPlanFile(firewalls []PlannedFirewall, createdAt time.Time) *PlanFile {
+	if firewalls == nil {
+		firewalls = []PlannedFirewall{}
+	}
+	return &PlanFile{
+		Version:   PlanFileVersion,
+		CreatedAt: createdAt.UTC(),
+		Firewalls: firewalls,
+	}
+}
+
+// WritePlanFile saves the plan file at path as indented JSON, so it diffs well in a pull request
+func WritePlanFile(path string, file *PlanFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan file: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write plan file: %w", err)
+	}
+	return nil
+}
+
+// ReadPlanFile loads the plan file at path, rejecting versions this release does not know
+func ReadPlanFile(path string) (*PlanFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan file: %w", err)
+	}
+
+	var file PlanFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse plan file: %w", err)
+	}
+	if file.Version != PlanFileVersion {
+		return nil, fmt.Errorf("unsupported plan file version %d (supported: %d)", file.Version, PlanFileVersion)
+	}
+	for i, firewall := range file.Firewalls {
+		if firewall.FirewallID == "" {
+			return nil, fmt.Errorf("plan file firewall %d has no firewall_id", i)
+		}
+		if firewall.BeforeFingerprint == "" {
+			return nil, fmt.Errorf("plan file firewall %s has no before_fingerprint", firewall.FirewallID)
+		}
+	}
+	return &file, nil
+}
+
+// SourcesFingerprint returns a stable hash of every source of the inbound rules by protocol and
+// port range: addresses, droplets, tags, load balancers and clusters
+func SourcesFingerprint(rules []godo.InboundRule) string {
+	sources := ruleSources(rules)
+
+	// Hashes the sorted "protocol/port" keys each followed by their sorted sources, one per line
+	h := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(sources)) {
+		h.Write([]byte(key + "\n"))
+		for _, source := range sources[key] {
+			h.Write([]byte(" " + source + "\n"))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyPlannedFirewall checks that the firewall still has the inbound rules it was planned
+// against, returning ErrPlanDrift otherwise
+func (c *Client) VerifyPlannedFirewall(ctx context.Context, planned PlannedFirewall) error {
+	firewall, err := c.GetFirewall(ctx, planned.FirewallID)
+	if err != nil {
+		return fmt.Errorf("failed to get current firewall: %w", err)
+	}
+	return checkPlanDrift(firewall, planned)
+}
+
+// checkPlanDrift returns ErrPlanDrift when the firewall has neither the rules it was planned
+// against nor the planned ones, which a plan applied before leaves in place
+func checkPlanDrift(firewall *godo.Firewall, planned PlannedFirewall) error {
+	current := SourcesFingerprint(firewall.InboundRules)
+	if current != planned.BeforeFingerprint && current != SourcesFingerprint(planned.InboundRules) {
+		return fmt.Errorf("%w: firewall %s has fingerprint %s, the plan expected %s, plan again",
+			ErrPlanDrift, firewall.ID, current, planned.BeforeFingerprint)
+	}
+	return nil
+}
+
+// ApplyPlannedFirewall writes the planned inbound rules to the firewall as they are, reporting
+// whether it changed; no update is sent when the firewall already has them, and ErrPlanDrift is
+// returned without writing when its rules changed otherwise since planning
+func (c *Client) ApplyPlannedFirewall(ctx context.Context, planned PlannedFirewall) (bool, error) {
+	c.logger.Info("Applying planned firewall rules",
+		zap.String("firewall_id", planned.FirewallID),
+		zap.Int("rule_count", len(planned.InboundRules)))
+
+	// Hold the mutation lock across the read-modify-write of the firewall
+	release, err := c.acquireLock(ctx, planned.FirewallID)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	firewall, err := c.GetFirewall(ctx, planned.FirewallID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get current firewall: %w", err)
+	}
+
+	// Checked under the lock, so nothing can change the firewall between the check and the write
+	if err := checkPlanDrift(firewall, planned); err != nil {
+		c.logger.Error("Firewall changed since the plan was made, not applying it",
+			zap.String("firewall_id", planned.FirewallID),
+			zap.String("before_fingerprint", planned.BeforeFingerprint))
+		return false, err
+	}
+
+	changes := SummarizeChanges(firewall, planned.InboundRules)
+	if RulesUnchanged(firewall, planned.InboundRules, changes) {
+		c.logger.Info("Firewall already has the planned rules, no changes",
+			zap.String("firewall_id", planned.FirewallID))
+		return false, nil
+	}
+
+	if err := c.applyInboundRules(ctx, firewall, planned.InboundRules, changes); err != nil {
+		return false, err
+	}
+
+	c.logger.Info("Successfully applied planned firewall rules",
+		zap.String("firewall_id", planned.FirewallID),
+		zap.Int("added_addresses", len(changes.AddedAddresses)),
+		zap.Int("removed_addresses", len(changes.RemovedAddresses)))
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package digitalocean
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestPlanFileRoundTrip(t *testing.T) {
+	current := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+	}
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web", InboundRules: current})
+	client := newTestClient(t, api)
+
+	sources := []string{"192.0.2.0/24", "203.0.113.7"}
+	planned, err := client.PlanFirewallUpdate(context.Background(), "fw-1",
+		[]FirewallRule{{Port: 443, Protocol: "tcp", Sources: sources}}, sources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if planned.BeforeFingerprint != SourcesFingerprint(current) {
+		t.Errorf("expected the fingerprint of the current rules, got %s", planned.BeforeFingerprint)
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	createdAt := time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC)
+	if err := WritePlanFile(path, NewPlanFile([]PlannedFirewall{*planned}, createdAt)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	file, err := ReadPlanFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if file.Version != PlanFileVersion || !file.CreatedAt.Equal(createdAt) {
+		t.Errorf("expected version %d created at %s, got %d at %s", PlanFileVersion, createdAt, file.Version, file.CreatedAt)
+	}
+	if len(file.Firewalls) != 1 || !reflect.DeepEqual(file.Firewalls[0], *planned) {
+		t.Errorf("expected the planned firewall back, got %+v", file.Firewalls)
+	}
+}
+
+func TestReadPlanFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		errorMsg string
+	}{
+		{name: "newer version", content: `{"version":2,"firewalls":[]}`, errorMsg: "unsupported plan file version 2"},
+		{name: "missing version", content: `{"firewalls":[]}`, errorMsg: "unsupported plan file version 0"},
+		{name: "firewall without ID", content: `{"version":1,"firewalls":[{"rules":[]}]}`, errorMsg: "has no firewall_id"},
+		{name: "firewall without fingerprint", content: `{"version":1,"firewalls":[{"firewall_id":"fw-1"}]}`, errorMsg: "has no before_fingerprint"},
+		{name: "invalid JSON", content: `{`, errorMsg: "failed to parse plan file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadPlanFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestApplyPlannedFirewall(t *testing.T) {
+	current := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+	}
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web", InboundRules: current})
+	client := newTestClient(t, api)
+
+	planned := PlannedFirewall{
+		Plan:              Plan{FirewallID: "fw-1", FirewallName: "web"},
+		BeforeFingerprint: SourcesFingerprint(current),
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24", "203.0.113.7/32"}}},
+		},
+	}
+
+	changed, err := client.ApplyPlannedFirewall(context.Background(), planned)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || api.updates != 1 {
+		t.Errorf("expected one update, got changed %t after %d updates", changed, api.updates)
+	}
+	if !reflect.DeepEqual(api.firewalls["fw-1"].InboundRules, planned.InboundRules) {
+		t.Errorf("expected the planned rules verbatim, got %+v", api.firewalls["fw-1"].InboundRules)
+	}
+
+	// Applying the same plan again finds the rules in place
+	changed, err = client.ApplyPlannedFirewall(context.Background(), planned)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed || api.updates != 1 {
+		t.Errorf("expected no further update, got changed %t after %d updates", changed, api.updates)
+	}
+}
+
+func TestApplyPlannedFirewallDrift(t *testing.T) {
+	current := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+	}
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web", InboundRules: []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}, Tags: []string{"web"}}},
+	}})
+	client := newTestClient(t, api)
+
+	planned := PlannedFirewall{
+		Plan:              Plan{FirewallID: "fw-1", FirewallName: "web"},
+		BeforeFingerprint: SourcesFingerprint(current),
+		InboundRules: []godo.InboundRule{
+			{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"203.0.113.7/32"}}},
+		},
+	}
+
+	if err := client.VerifyPlannedFirewall(context.Background(), planned); !errors.Is(err, ErrPlanDrift) {
+		t.Errorf("expected ErrPlanDrift from the verification, got %v", err)
+	}
+	changed, err := client.ApplyPlannedFirewall(context.Background(), planned)
+	if !errors.Is(err, ErrPlanDrift) {
+		t.Errorf("expected ErrPlanDrift, got %v", err)
+	}
+	if changed || api.updates != 0 {
+		t.Errorf("expected the drifted firewall left alone, got changed %t after %d updates", changed, api.updates)
+	}
+}
@@ -0,0 +1,117 @@
+package digitalocean
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"go.uber.org/zap"
+)
+
+// WithRetry retries API requests answered with 429 or a server error up to retries times, waiting
+// out the Retry-After header or else a jittered exponential backoff between minBackoff and maxBackoff
+func WithRetry(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// retryTransport retries requests the API rate limited or failed to serve
+type retryTransport struct {
+	base       http.RoundTripper
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	logger     *zap.Logger
+	// clock times the waits and is faked in tests
+	clock clock.Clock
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := &backoff.Backoff{
+		Min:    t.minBackoff,
+		Max:    t.maxBackoff,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || !retryableStatus(resp.StatusCode) || attempt > t.retries {
+			return resp, err
+		}
+		// A consumed body cannot be sent again
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, nil
+		}
+
+		// The reset announced by the API beats guessing with the backoff
+		wait := b.Duration()
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), t.clock.Now()); ok {
+			wait = after
+		}
+		// Every retry of the run shares its retry budget, the last response is returned once it is spent
+		if !retrybudget.Take(req.Context(), wait) {
+			t.logger.Warn("Retry budget of the run exhausted, not retrying DigitalOcean API request",
+				zap.String("method", req.Method),
+				zap.String("path", req.URL.Path),
+				zap.Int("status_code", resp.StatusCode),
+				zap.Int("attempt", attempt),
+				zap.Duration("backoff", wait))
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		t.logger.Warn("DigitalOcean API request failed, retrying",
+			zap.String("method", req.Method),
+			zap.String("path", req.URL.Path),
+			zap.Int("status_code", resp.StatusCode),
+			zap.Int("attempt", attempt),
+			zap.Int("max_retries", t.retries),
+			zap.Duration("backoff", wait))
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-t.clock.After(wait):
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body for retry: %w", err)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryableStatus reports whether a response status is worth retrying: rate limiting and server
+// errors, but not 501 Not Implemented
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code != http.StatusNotImplemented)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,187 @@
+package digitalocean
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		retries      int
+		expectStatus int
+		expectCalls  int
+	}{
+		{name: "rate limited request is retried", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, retries: 3, expectStatus: http.StatusOK, expectCalls: 2},
+		{name: "server errors are retried", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, retries: 3, expectStatus: http.StatusOK, expectCalls: 3},
+		{name: "retries run out", statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}, retries: 1, expectStatus: http.StatusServiceUnavailable, expectCalls: 2},
+		{name: "client errors are not retried", statuses: []int{http.StatusUnprocessableEntity, http.StatusOK}, retries: 3, expectStatus: http.StatusUnprocessableEntity, expectCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != `{"name":"web"}` {
+					t.Errorf("expected request body on every attempt, got %q", body)
+				}
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+			}))
+			defer srv.Close()
+
+			client := &http.Client{Transport: &retryTransport{
+				base:       http.DefaultTransport,
+				retries:    tt.retries,
+				minBackoff: time.Millisecond,
+				maxBackoff: time.Millisecond,
+				logger:     zaptest.NewLogger(t),
+				clock:      clock.Real,
+			}}
+
+			req, err := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader(`{"name":"web"}`))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectStatus {
+				t.Errorf("expected status %d, got %d", tt.expectStatus, resp.StatusCode)
+			}
+			if calls != tt.expectCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRetryTransportWaitsOutRetryAfter(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	client := &http.Client{Transport: &retryTransport{
+		base:       http.DefaultTransport,
+		retries:    3,
+		minBackoff: time.Millisecond,
+		maxBackoff: time.Millisecond,
+		logger:     zaptest.NewLogger(t),
+		clock:      fake,
+	}}
+
+	done := make(chan int, 1)
+	go func() {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+
+	// The backoff would retry after a millisecond, the header holds the retry for 30 seconds
+	fake.BlockUntil(1)
+	fake.Advance(29 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("expected the retry to wait out Retry-After")
+	case <-time.After(50 * time.Millisecond):
+	}
+	fake.Advance(time.Second)
+
+	if status := <-done; status != http.StatusOK || calls != 2 {
+		t.Errorf("expected OK on the second call, got %d after %d calls", status, calls)
+	}
+}
+
+func TestRetryTransportStopsAtRetryBudget(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	client := &http.Client{Transport: &retryTransport{
+		base:       http.DefaultTransport,
+		retries:    10,
+		minBackoff: time.Millisecond,
+		maxBackoff: time.Millisecond,
+		logger:     zaptest.NewLogger(t),
+		clock:      fake,
+	}}
+
+	// The budget allows two waits of 2 seconds out of the 10 retries
+	ctx := retrybudget.WithBudget(context.Background(), 5*time.Second)
+	done := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+
+	for range 2 {
+		fake.BlockUntil(1)
+		fake.Advance(2 * time.Second)
+	}
+
+	if status := <-done; status != http.StatusServiceUnavailable || calls != 3 {
+		t.Errorf("expected the last 503 after 3 calls, got %d after %d calls", status, calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "", ok: false},
+		{value: "12", expected: 12 * time.Second, ok: true},
+		{value: now.Add(time.Minute).Format(http.TimeFormat), expected: time.Minute, ok: true},
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), expected: 0, ok: true},
+		{value: "soon", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v, expected %s, %v", tt.value, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
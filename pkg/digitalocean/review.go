@@ -0,0 +1,174 @@
+package digitalocean
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/godo"
+)
+
+// Severity ranks the findings of an account review
+type Severity string
+
+const (
+	// SeverityHigh findings expose a service to the whole internet
+	SeverityHigh Severity = "high"
+	// SeverityMedium findings make the effective rules harder to reason about
+	SeverityMedium Severity = "medium"
+	// SeverityLow findings are leftovers worth cleaning up
+	SeverityLow Severity = "low"
+)
+
+// Rank orders severities from low (1) to high (3), 0 for unknown values
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// The checks of an account review
+const (
+	CheckOpenToInternet  = "open-to-internet"
+	CheckUnattached      = "unattached"
+	CheckOverlappingRule = "overlapping-rules"
+)
+
+// Finding is a risky pattern ReviewFirewalls found on a firewall
+type Finding struct {
+	FirewallID   string   `json:"firewall_id"`
+	FirewallName string   `json:"firewall_name"`
+	Check        string   `json:"check"`
+	Severity     Severity `json:"severity"`
+	Rule         string   `json:"rule,omitempty"` // "protocol/port" of the inbound rule the finding is about
+	Message      string   `json:"message"`
+}
+
+// DefaultRiskyPorts are the SSH, remote desktop and database ports that should never be open to
+// the whole internet, by the service usually listening on them
+var DefaultRiskyPorts = map[int]string{
+	22:    "SSH",
+	1433:  "SQL Server",
+	3306:  "MySQL",
+	3389:  "RDP",
+	5432:  "PostgreSQL",
+	5984:  "CouchDB",
+	6379:  "Redis",
+	9200:  "Elasticsearch",
+	11211: "Memcached",
+	27017: "MongoDB",
+}
+
+// ReviewFirewalls scans the firewalls of an account for inbound rules opening riskyPorts to the
+// whole internet, firewalls applied to no droplet or tag, and rules of the same protocol whose port
+// ranges overlap; findings are sorted by severity, then firewall and rule
+func ReviewFirewalls(firewalls []godo.Firewall, riskyPorts map[int]string) []Finding {
+	ports := slices.Sorted(maps.Keys(riskyPorts))
+
+	var findings []Finding
+	for _, firewall := range firewalls {
+		finding := func(check string, severity Severity, rule, format string, args ...any) Finding {
+			return Finding{
+				FirewallID:   firewall.ID,
+				FirewallName: firewall.Name,
+				Check:        check,
+				Severity:     severity,
+				Rule:         rule,
+				Message:      fmt.Sprintf(format, args...),
+			}
+		}
+
+		if len(firewall.DropletIDs) == 0 && len(firewall.Tags) == 0 {
+			findings = append(findings, finding(CheckUnattached, SeverityLow, "",
+				"firewall is applied to no droplet or tag, so it protects nothing"))
+		}
+
+		for i, rule := range firewall.InboundRules {
+			key := rule.Protocol + "/" + rule.PortRange
+			if world := worldSources(rule); len(world) > 0 && rule.Protocol != "icmp" {
+				var services []string
+				for _, port := range ports {
+					if portRangeContains(rule.PortRange, port) {
+						services = append(services, fmt.Sprintf("%s (%d)", riskyPorts[port], port))
+					}
+				}
+				if len(services) > 0 {
+					findings = append(findings, finding(CheckOpenToInternet, SeverityHigh, key,
+						"%s exposes %s to the whole internet", strings.Join(world, ", "), strings.Join(services, ", ")))
+				}
+			}
+
+			for _, other := range firewall.InboundRules[i+1:] {
+				if other.Protocol == rule.Protocol && rule.Protocol != "icmp" && portRangesOverlap(rule.PortRange, other.PortRange) {
+					findings = append(findings, finding(CheckOverlappingRule, SeverityMedium, key,
+						"overlaps %s/%s, the sources of both rules apply to the shared ports", other.Protocol, other.PortRange))
+				}
+			}
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Or(
+			cmp.Compare(b.Severity.Rank(), a.Severity.Rank()),
+			cmp.Compare(a.FirewallName, b.FirewallName),
+			cmp.Compare(a.FirewallID, b.FirewallID),
+			cmp.Compare(a.Rule, b.Rule),
+		)
+	})
+	return findings
+}
+
+// worldSources returns the addresses of the rule that match every IPv4 or IPv6 address
+func worldSources(rule godo.InboundRule) []string {
+	if rule.Sources == nil {
+		return nil
+	}
+
+	var world []string
+	for _, address := range rule.Sources.Addresses {
+		if prefix, err := netip.ParsePrefix(address); err == nil && prefix.Bits() == 0 {
+			world = append(world, address)
+		}
+	}
+	return world
+}
+
+// portRangesOverlap reports whether two port ranges share a port; "all", "0" and empty ranges
+// cover every port
+func portRangesOverlap(a, b string) bool {
+	aStart, aEnd, okA := portBounds(a)
+	bStart, bEnd, okB := portBounds(b)
+	return okA && okB && aStart <= bEnd && bStart <= aEnd
+}
+
+// portBounds returns the first and last port of a port range
+func portBounds(portRange string) (int, int, bool) {
+	if portRange == "" || portRange == "all" || portRange == "0" {
+		return 1, 65535, true
+	}
+
+	low, high, isRange := strings.Cut(portRange, "-")
+	start, err := strconv.Atoi(low)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !isRange {
+		return start, start, true
+	}
+	end, err := strconv.Atoi(high)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
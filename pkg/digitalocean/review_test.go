@@ -0,0 +1,85 @@
+package digitalocean
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestReviewFirewalls(t *testing.T) {
+	world := &godo.Sources{Addresses: []string{"0.0.0.0/0", "::/0"}}
+	firewalls := []godo.Firewall{
+		{
+			ID:         "fw-db",
+			Name:       "db",
+			DropletIDs: []int{1},
+			InboundRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "5432", Sources: world},
+				{Protocol: "tcp", PortRange: "5000-6000", Sources: &godo.Sources{Addresses: []string{"10.0.0.0/8"}}},
+				{Protocol: "udp", PortRange: "5432", Sources: &godo.Sources{Addresses: []string{"10.0.0.0/8"}}},
+			},
+		},
+		{
+			ID:   "fw-web",
+			Name: "web",
+			Tags: []string{"web"},
+			InboundRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "443", Sources: world},
+				{Protocol: "icmp", Sources: world},
+			},
+		},
+		{
+			ID:   "fw-old",
+			Name: "old",
+			InboundRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "all", Sources: &godo.Sources{Addresses: []string{"0.0.0.0/0"}}},
+			},
+		},
+	}
+
+	findings := ReviewFirewalls(firewalls, DefaultRiskyPorts)
+
+	type summary struct {
+		firewall, check, rule string
+		severity              Severity
+	}
+	var got []summary
+	for _, finding := range findings {
+		got = append(got, summary{finding.FirewallID, finding.Check, finding.Rule, finding.Severity})
+	}
+	expected := []summary{
+		{"fw-db", CheckOpenToInternet, "tcp/5432", SeverityHigh},
+		{"fw-old", CheckOpenToInternet, "tcp/all", SeverityHigh},
+		{"fw-db", CheckOverlappingRule, "tcp/5432", SeverityMedium},
+		{"fw-old", CheckUnattached, "", SeverityLow},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected findings %+v, got %+v", expected, got)
+	}
+
+	if findings[0].Message != "0.0.0.0/0, ::/0 exposes PostgreSQL (5432) to the whole internet" {
+		t.Errorf("unexpected message %q", findings[0].Message)
+	}
+}
+
+func TestPortRangesOverlap(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"22", "22", true},
+		{"22", "23", false},
+		{"20-30", "25", true},
+		{"20-30", "31-40", false},
+		{"all", "443", true},
+		{"0", "1-10", true},
+		{"invalid", "22", false},
+	}
+
+	for _, tt := range tests {
+		if got := portRangesOverlap(tt.a, tt.b); got != tt.expected {
+			t.Errorf("expected %s and %s to overlap: %v, got %v", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/digitalocean/godo"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// RollbackFirewall restores the inbound and outbound rules of a snapshot to its firewall,
+// reporting the changes to the inbound rules and whether the firewall changed; the rules the
+// rollback replaces are snapshotted like those of any update, so it can be rolled back in turn
+func (c *Client) RollbackFirewall(ctx context.Context, snapshot state.FirewallSnapshot) (ChangeSummary, bool, error) {
+	c.logger.Info("Rolling back firewall rules",
+		zap.String("firewall_id", snapshot.FirewallID),
+		zap.Time("snapshot_taken_at", snapshot.TakenAt),
+		zap.Int("inbound_rule_count", len(snapshot.InboundRules)),
+		zap.Int("outbound_rule_count", len(snapshot.OutboundRules)))
+
+	// Hold the mutation lock across the read-modify-write of the firewall
+	release, err := c.acquireLock(ctx, snapshot.FirewallID)
+	if err != nil {
+		return ChangeSummary{}, false, err
+	}
+	defer release()
+
+	firewall, err := c.GetFirewall(ctx, snapshot.FirewallID)
+	if err != nil {
+		return ChangeSummary{}, false, fmt.Errorf("failed to get current firewall: %w", err)
+	}
+
+	changes := SummarizeChanges(firewall, snapshot.InboundRules)
+	if RulesUnchanged(firewall, snapshot.InboundRules, changes) && outboundUnchanged(firewall.OutboundRules, snapshot.OutboundRules) {
+		c.logger.Info("Firewall already has the snapshot rules, no changes",
+			zap.String("firewall_id", snapshot.FirewallID))
+		return changes, false, nil
+	}
+
+	if err := c.applyRules(ctx, "rollback", firewall, snapshot.InboundRules, snapshot.OutboundRules, changes); err != nil {
+		return changes, false, err
+	}
+
+	c.logger.Info("Successfully rolled back firewall rules",
+		zap.String("firewall_id", snapshot.FirewallID),
+		zap.Int("added_addresses", len(changes.AddedAddresses)),
+		zap.Int("removed_addresses", len(changes.RemovedAddresses)))
+	return changes, true, nil
+}
+
+// outboundUnchanged reports whether two outbound rule sets are the same, treating a missing one
+// like an empty one
+func outboundUnchanged(current, restored []godo.OutboundRule) bool {
+	if len(current) == 0 && len(restored) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(current, restored)
+}
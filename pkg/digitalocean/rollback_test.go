@@ -0,0 +1,70 @@
+package digitalocean
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRollbackFirewall(t *testing.T) {
+	original := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+	}
+	outbound := []godo.OutboundRule{
+		{Protocol: "tcp", PortRange: "all", Destinations: &godo.Destinations{Addresses: []string{"0.0.0.0/0"}}},
+	}
+	api := newFakeFirewallAPI(&godo.Firewall{ID: "fw-1", Name: "web", InboundRules: original, OutboundRules: outbound})
+	client := newTestClient(t, api)
+	store := state.NewSnapshotStore(filepath.Join(t.TempDir(), "state.snapshots.json"), 10, zaptest.NewLogger(t))
+	client.snapshots = store
+
+	// The update keeps the rules it replaced
+	updated := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"203.0.113.7/32"}}},
+	}
+	firewall, err := client.GetFirewall(context.Background(), "fw-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.replaceInboundRules(context.Background(), firewall, updated); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	api.firewalls["fw-1"].OutboundRules = nil
+
+	snapshots, err := store.List("fw-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Action != "update_inbound_rules" || !reflect.DeepEqual(snapshots[0].InboundRules, original) {
+		t.Fatalf("expected a snapshot of the original rules, got %+v", snapshots)
+	}
+
+	changes, changed, err := client.RollbackFirewall(context.Background(), snapshots[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || len(changes.AddedAddresses) != 1 || len(changes.RemovedAddresses) != 1 {
+		t.Errorf("expected the rollback to swap one address, got changed %t with %+v", changed, changes)
+	}
+	fw := api.firewalls["fw-1"]
+	if !reflect.DeepEqual(fw.InboundRules, original) || !reflect.DeepEqual(fw.OutboundRules, outbound) {
+		t.Errorf("expected the snapshot rules restored, got %+v and %+v", fw.InboundRules, fw.OutboundRules)
+	}
+
+	// The rollback is snapshotted too, so it can be undone
+	snapshots, _ = store.List("fw-1")
+	if len(snapshots) != 2 || snapshots[0].Action != "rollback" || !reflect.DeepEqual(snapshots[0].InboundRules, updated) {
+		t.Fatalf("expected a snapshot of the rolled back rules, got %+v", snapshots)
+	}
+
+	// Rolling back to the rules in place changes nothing
+	updates := api.updates
+	if _, changed, err := client.RollbackFirewall(context.Background(), snapshots[1]); err != nil || changed || api.updates != updates {
+		t.Errorf("expected no further update, got changed %t after %d updates: %v", changed, api.updates, err)
+	}
+}
@@ -0,0 +1,147 @@
+package digitalocean
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/godo"
+)
+
+// ErrSelfLockout is returned when an update would remove the operator's own access to an admin port
+var ErrSelfLockout = errors.New("update would lock the operator out of admin ports")
+
+// AdminAccess describes the sources that must keep access to the admin ports
+type AdminAccess struct {
+	Ports   []int
+	Sources []string // IP addresses or CIDR blocks, e.g. the operator's current IP and admin networks
+	Force   bool     // Apply updates that remove admin access anyway, logging a warning instead of failing
+}
+
+// SetAdminAccess installs a check that refuses updates removing admin access unless forced
+func (c *Client) SetAdminAccess(access *AdminAccess) {
+	c.adminAccess = access
+}
+
+// LostAdminAccess returns the "protocol/port source" entries allowed by currentRules but no longer
+// allowed by newRules
+func LostAdminAccess(currentRules, newRules []godo.InboundRule, access AdminAccess) []string {
+	sets := &prefixSets{}
+	current := ruleIndex{rules: currentRules, sets: sets}
+	desired := ruleIndex{rules: newRules, sets: sets}
+
+	var lost []string
+	for _, protocol := range []string{"tcp", "udp"} {
+		for _, port := range access.Ports {
+			for _, source := range access.Sources {
+				network, err := canonicalSource(source)
+				if err != nil {
+					continue
+				}
+				if current.allows(protocol, port, network) && !desired.allows(protocol, port, network) {
+					lost = append(lost, fmt.Sprintf("%s/%d %s", protocol, port, source))
+				}
+			}
+		}
+	}
+	return lost
+}
+
+// ruleIndex answers which networks inbound rules allow, parsing a rule's addresses into a prefix
+// set the first time the rule is consulted instead of on every lookup
+type ruleIndex struct {
+	rules []godo.InboundRule
+	sets  *prefixSets
+}
+
+// allows reports whether any rule allows the whole network on the protocol and port
+func (x ruleIndex) allows(protocol string, port int, network netip.Prefix) bool {
+	for _, rule := range x.rules {
+		if rule.Protocol != protocol || !portRangeContains(rule.PortRange, port) || rule.Sources == nil {
+			continue
+		}
+		if x.sets.get(rule.Sources.Addresses).covers(network) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixSets builds one prefix set per distinct address list; the managed rules of the current and
+// the new rule set all list the same addresses, which are then parsed once
+type prefixSets []*prefixSet
+
+// get returns the prefix set of the addresses, building it on first use
+func (c *prefixSets) get(addresses []string) *prefixSet {
+	for _, set := range *c {
+		if slices.Equal(set.addresses, addresses) {
+			return set
+		}
+	}
+	set := newPrefixSet(addresses)
+	*c = append(*c, set)
+	return set
+}
+
+// prefixSet holds CIDR blocks keyed by their masked prefix, so whether one covers a network takes
+// a lookup per distinct prefix length rather than a comparison per block
+type prefixSet struct {
+	addresses []string
+	lengths   []int // distinct prefix lengths, shortest first
+	prefixes  map[netip.Prefix]bool
+}
+
+func newPrefixSet(addresses []string) *prefixSet {
+	set := &prefixSet{addresses: addresses, prefixes: make(map[netip.Prefix]bool, len(addresses))}
+	for _, address := range addresses {
+		prefix, err := canonicalSource(address)
+		if err != nil {
+			continue
+		}
+		if !slices.Contains(set.lengths, prefix.Bits()) {
+			set.lengths = append(set.lengths, prefix.Bits())
+		}
+		set.prefixes[prefix] = true
+	}
+	slices.Sort(set.lengths)
+	return set
+}
+
+// covers reports whether a block in the set includes every address of the network
+func (s *prefixSet) covers(network netip.Prefix) bool {
+	for _, bits := range s.lengths {
+		if bits > network.Bits() {
+			break
+		}
+		// IPv4 and IPv6 prefixes never compare equal, so lengths of the other family miss harmlessly
+		if outer, err := network.Addr().Prefix(bits); err == nil && s.prefixes[outer] {
+			return true
+		}
+	}
+	return false
+}
+
+// portRangeContains reports whether a DigitalOcean port range ("22", "8000-8010" or "all") includes the port
+func portRangeContains(portRange string, port int) bool {
+	if portRange == "" || portRange == "all" || portRange == "0" {
+		return true
+	}
+
+	low, high, isRange := strings.Cut(portRange, "-")
+	start, err := strconv.Atoi(low)
+	if err != nil {
+		return false
+	}
+	if !isRange {
+		return start == port
+	}
+
+	end, err := strconv.Atoi(high)
+	if err != nil {
+		return false
+	}
+	return start <= port && port <= end
+}
@@ -0,0 +1,132 @@
+package digitalocean
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestLostAdminAccess(t *testing.T) {
+	current := []godo.InboundRule{
+		{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"203.0.113.5/32", "192.0.2.0/24"}}},
+		{Protocol: "tcp", PortRange: "8000-8010", Sources: &godo.Sources{Addresses: []string{"0.0.0.0/0"}}},
+	}
+
+	tests := []struct {
+		name     string
+		newRules []godo.InboundRule
+		access   AdminAccess
+		expected []string
+	}{
+		{
+			name:     "access kept",
+			newRules: current,
+			access:   AdminAccess{Ports: []int{22}, Sources: []string{"203.0.113.5", "192.0.2.0/26"}},
+		},
+		{
+			name: "current IP removed",
+			newRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/24"}}},
+			},
+			access:   AdminAccess{Ports: []int{22}, Sources: []string{"203.0.113.5", "192.0.2.10"}},
+			expected: []string{"tcp/22 203.0.113.5"},
+		},
+		{
+			name:     "port range removed",
+			newRules: current[:1],
+			access:   AdminAccess{Ports: []int{8005}, Sources: []string{"198.51.100.7"}},
+			expected: []string{"tcp/8005 198.51.100.7"},
+		},
+		{
+			name: "admin CIDR narrowed",
+			newRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"192.0.2.0/25"}}},
+			},
+			access:   AdminAccess{Ports: []int{22}, Sources: []string{"192.0.2.0/24"}},
+			expected: []string{"tcp/22 192.0.2.0/24"},
+		},
+		{
+			name:     "source without prior access",
+			newRules: nil,
+			access:   AdminAccess{Ports: []int{22}, Sources: []string{"198.51.100.7"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lost := LostAdminAccess(current, tt.newRules, tt.access)
+			if len(lost) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, lost)
+			}
+			for i := range tt.expected {
+				if lost[i] != tt.expected[i] {
+					t.Errorf("expected lost access %d to be %s, got %s", i, tt.expected[i], lost[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceInboundRulesSelfLockout(t *testing.T) {
+	newAPI := func() *fakeFirewallAPI {
+		return newFakeFirewallAPI(&godo.Firewall{
+			ID: "fw-1",
+			InboundRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"203.0.113.5/32"}}},
+			},
+		})
+	}
+
+	api := newAPI()
+	client := newTestClient(t, api)
+	client.SetAdminAccess(&AdminAccess{Ports: []int{22}, Sources: []string{"203.0.113.5"}})
+
+	err := client.AddSSHRule(context.Background(), "fw-1", "198.51.100.7", 22, true)
+	if !errors.Is(err, ErrSelfLockout) {
+		t.Fatalf("expected ErrSelfLockout, got %v", err)
+	}
+	if api.updates != 0 {
+		t.Errorf("expected no update, got %d", api.updates)
+	}
+
+	api = newAPI()
+	client = newTestClient(t, api)
+	client.SetAdminAccess(&AdminAccess{Ports: []int{22}, Sources: []string{"203.0.113.5"}, Force: true})
+
+	if err := client.AddSSHRule(context.Background(), "fw-1", "198.51.100.7", 22, true); err != nil {
+		t.Fatalf("expected forced update to succeed, got %v", err)
+	}
+	if api.updates != 1 {
+		t.Errorf("expected one update, got %d", api.updates)
+	}
+}
+
+func TestPrefixSetCovers(t *testing.T) {
+	set := newPrefixSet([]string{"203.0.113.0/24", "198.51.100.7", "2001:db8::/32", "not-an-ip"})
+
+	tests := []struct {
+		network  string
+		expected bool
+	}{
+		{network: "203.0.113.5/32", expected: true},
+		{network: "203.0.113.128/25", expected: true},
+		{network: "203.0.112.0/23", expected: false},
+		{network: "198.51.100.7/32", expected: true},
+		{network: "198.51.100.8/32", expected: false},
+		{network: "2001:db8:1::/48", expected: true},
+		{network: "2001:db9::/32", expected: false},
+		// /24 IPv6 lengths are looked up too and must not match the IPv4 block
+		{network: "cb00:7100::/32", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			if got := set.covers(netip.MustParsePrefix(tt.network)); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package digitalocean
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidToken is returned by ProbeTokenScopes when the API rejects the token itself
+var ErrInvalidToken = errors.New("DigitalOcean API token is invalid, expired or revoked")
+
+// TokenScopes describes what the API token may do with the firewall
+type TokenScopes struct {
+	Read  bool `json:"read"`
+	Write bool `json:"write"`
+}
+
+// String describes the scopes for operators
+func (s TokenScopes) String() string {
+	switch {
+	case s.Read && s.Write:
+		return "read and write"
+	case s.Read:
+		return "read-only"
+	case s.Write:
+		return "write-only"
+	default:
+		return "no firewall access"
+	}
+}
+
+// ProbeTokenScopes classifies the token by reading the firewall and sending a no-op write, a
+// request adding no tags, which a token without the firewall:update scope is refused with 403
+func (c *Client) ProbeTokenScopes(ctx context.Context, firewallID string) (TokenScopes, error) {
+	if c.readOnly {
+		return TokenScopes{}, fmt.Errorf("cannot probe the write scope: %w", ErrReadOnly)
+	}
+
+	var scopes TokenScopes
+
+	_, _, err := c.client.Firewalls.Get(ctx, firewallID)
+	allowed, err := classifyScopeProbe(err)
+	if err != nil {
+		return TokenScopes{}, fmt.Errorf("failed to probe read access to firewall %s: %w", firewallID, err)
+	}
+	scopes.Read = allowed
+
+	// Adding no tags passes authorization and validation without changing the firewall
+	_, err = c.client.Firewalls.AddTags(ctx, firewallID)
+	allowed, err = classifyScopeProbe(err)
+	if err != nil {
+		return TokenScopes{}, fmt.Errorf("failed to probe write access to firewall %s: %w", firewallID, err)
+	}
+	scopes.Write = allowed
+
+	c.logger.Info("Probed DigitalOcean API token scopes",
+		zap.String("firewall_id", firewallID),
+		zap.Bool("read", scopes.Read),
+		zap.Bool("write", scopes.Write))
+	return scopes, nil
+}
+
+// classifyScopeProbe reports whether a probe request got past authorization: 403 means the
+// scope is missing, while a 2xx or a validation error means the token holds it
+func classifyScopeProbe(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+
+	var apiErr *godo.ErrorResponse
+	if !errors.As(err, &apiErr) || apiErr.Response == nil {
+		return false, err
+	}
+
+	switch apiErr.Response.StatusCode {
+	case http.StatusUnauthorized:
+		return false, ErrInvalidToken
+	case http.StatusForbidden:
+		return false, nil
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return true, nil
+	default:
+		return false, err
+	}
+}
@@ -0,0 +1,101 @@
+package digitalocean
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestProbeTokenScopes(t *testing.T) {
+	tests := []struct {
+		name        string
+		readStatus  int
+		writeStatus int
+		expected    TokenScopes
+		expectError error
+	}{
+		{
+			name:        "read and write",
+			readStatus:  http.StatusOK,
+			writeStatus: http.StatusNoContent,
+			expected:    TokenScopes{Read: true, Write: true},
+		},
+		{
+			name:        "write passes authorization but fails validation",
+			readStatus:  http.StatusOK,
+			writeStatus: http.StatusUnprocessableEntity,
+			expected:    TokenScopes{Read: true, Write: true},
+		},
+		{
+			name:        "read-only token",
+			readStatus:  http.StatusOK,
+			writeStatus: http.StatusForbidden,
+			expected:    TokenScopes{Read: true},
+		},
+		{
+			name:        "invalid token",
+			readStatus:  http.StatusUnauthorized,
+			writeStatus: http.StatusUnauthorized,
+			expectError: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tagBody string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/firewalls/fw-1":
+					w.WriteHeader(tt.readStatus)
+					_, _ = w.Write([]byte(`{"firewall":{"id":"fw-1"}}`))
+				case r.Method == http.MethodPost && r.URL.Path == "/v2/firewalls/fw-1/tags":
+					body, _ := io.ReadAll(r.Body)
+					tagBody = string(body)
+					w.WriteHeader(tt.writeStatus)
+					_, _ = w.Write([]byte(`{"id":"unprocessable_entity","message":"tags are required"}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			godoClient, err := godo.New(srv.Client(), godo.SetBaseURL(srv.URL+"/"))
+			if err != nil {
+				t.Fatalf("failed to create godo client: %v", err)
+			}
+			c := &Client{client: godoClient, logger: zaptest.NewLogger(t)}
+
+			scopes, err := c.ProbeTokenScopes(context.Background(), "fw-1")
+			if tt.expectError != nil {
+				if !errors.Is(err, tt.expectError) {
+					t.Errorf("expected error %v, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if scopes != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, scopes)
+			}
+			if tagBody != `{"tags":null}`+"\n" {
+				t.Errorf("expected a write probe adding no tags, got %q", tagBody)
+			}
+		})
+	}
+}
+
+func TestProbeTokenScopesReadOnly(t *testing.T) {
+	c := NewClient("token", zaptest.NewLogger(t), WithReadOnly(true))
+	if _, err := c.ProbeTokenScopes(context.Background(), "fw-1"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package digitalocean
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// FileTokenSource serves the API token read from a file, such as a mounted secret, and re-reads
+// it on Reload so a rotated token is picked up without a restart
+type FileTokenSource struct {
+	path string
+
+	mu    sync.RWMutex
+	token string
+}
+
+// NewFileTokenSource creates a token source for path, serving token until the first reload
+func NewFileTokenSource(path, token string) *FileTokenSource {
+	return &FileTokenSource{
+		path:  path,
+		token: token,
+	}
+}
+
+// Token returns the oauth2 token for API authentication
+func (s *FileTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &oauth2.Token{AccessToken: s.token}, nil
+}
+
+// Reload re-reads the token file, reporting whether the token changed; the current token is kept
+// if the file cannot be read or is empty
+func (s *FileTokenSource) Reload() (bool, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read API token file %s: %w", s.path, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return false, fmt.Errorf("API token file %s is empty", s.path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token == s.token {
+		return false, nil
+	}
+	s.token = token
+	return true, nil
+}
+
+// WithTokenFile authenticates with the token in path, re-reading it when the API rejects the
+// current token and on ReloadToken
+func WithTokenFile(path string) Option {
+	return func(c *Client) {
+		c.tokenFile = path
+	}
+}
+
+// ReloadToken re-reads the API token file, e.g. on SIGHUP after a scheduled rotation
+func (c *Client) ReloadToken() error {
+	if c.tokenSource == nil {
+		return errors.New("no API token file configured")
+	}
+
+	changed, err := c.tokenSource.Reload()
+	if err != nil {
+		return err
+	}
+	if changed {
+		c.logger.Info("Reloaded rotated DigitalOcean API token", zap.String("path", c.tokenSource.path))
+	} else {
+		c.logger.Debug("DigitalOcean API token unchanged", zap.String("path", c.tokenSource.path))
+	}
+	return nil
+}
+
+// tokenReloadTransport re-reads the token file when the API answers 401 and retries the request
+// once if the token changed, so a rotation between runs does not fail the next update
+type tokenReloadTransport struct {
+	base   http.RoundTripper
+	source *FileTokenSource
+	logger *zap.Logger
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *tokenReloadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// A consumed body cannot be sent again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	changed, reloadErr := t.source.Reload()
+	if reloadErr != nil {
+		t.logger.Warn("API token rejected and token file could not be reloaded", zap.Error(reloadErr))
+		return resp, nil
+	}
+	if !changed {
+		t.logger.Warn("API token rejected and token file is unchanged", zap.String("path", t.source.path))
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	t.logger.Info("API token rejected, retrying with rotated token from file", zap.String("path", t.source.path))
+	return t.base.RoundTrip(retry)
+}
@@ -0,0 +1,111 @@
+package digitalocean
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/oauth2"
+)
+
+func TestFileTokenSourceReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	source := NewFileTokenSource(path, "old-token")
+
+	if _, err := source.Reload(); err == nil {
+		t.Error("expected error for missing token file")
+	}
+
+	writeToken(t, path, "  \n")
+	if _, err := source.Reload(); err == nil {
+		t.Error("expected error for empty token file")
+	}
+
+	writeToken(t, path, "old-token\n")
+	if changed, err := source.Reload(); err != nil || changed {
+		t.Errorf("expected unchanged token, got changed=%v err=%v", changed, err)
+	}
+
+	writeToken(t, path, "new-token\n")
+	if changed, err := source.Reload(); err != nil || !changed {
+		t.Errorf("expected changed token, got changed=%v err=%v", changed, err)
+	}
+
+	token, _ := source.Token()
+	if token.AccessToken != "new-token" {
+		t.Errorf("expected new-token, got %s", token.AccessToken)
+	}
+}
+
+func TestTokenReloadTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		fileToken    string
+		expectStatus int
+		expectCalls  int
+	}{
+		{name: "rotated token is retried", fileToken: "new-token", expectStatus: http.StatusOK, expectCalls: 2},
+		{name: "unchanged token is not retried", fileToken: "old-token", expectStatus: http.StatusUnauthorized, expectCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != `{"name":"web"}` {
+					t.Errorf("expected request body on every attempt, got %q", body)
+				}
+				if r.Header.Get("Authorization") != "Bearer new-token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+			}))
+			defer srv.Close()
+
+			path := filepath.Join(t.TempDir(), "token")
+			writeToken(t, path, tt.fileToken)
+
+			source := NewFileTokenSource(path, "old-token")
+			client := &http.Client{Transport: &tokenReloadTransport{
+				base:   &oauth2.Transport{Source: source},
+				source: source,
+				logger: zaptest.NewLogger(t),
+			}}
+
+			resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"name":"web"}`))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectStatus {
+				t.Errorf("expected status %d, got %d", tt.expectStatus, resp.StatusCode)
+			}
+			if calls != tt.expectCalls {
+				t.Errorf("expected %d requests, got %d", tt.expectCalls, calls)
+			}
+		})
+	}
+}
+
+func TestReloadTokenWithoutFile(t *testing.T) {
+	c := NewClient("static-token", zaptest.NewLogger(t))
+	if err := c.ReloadToken(); err == nil {
+		t.Error("expected error reloading without a token file")
+	}
+}
+
+func writeToken(t *testing.T, path, token string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(token), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+}
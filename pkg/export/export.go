@@ -0,0 +1,178 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Supported export formats
+const (
+	FormatNginxAllow = "nginx-allow"
+	FormatHAProxyACL = "haproxy-acl"
+	FormatIPTables   = "iptables"
+	FormatCSV        = "csv"
+	FormatJSON       = "json"
+	FormatPlain      = "plain"
+)
+
+// Formats lists every supported export format
+var Formats = []string{FormatNginxAllow, FormatHAProxyACL, FormatIPTables, FormatCSV, FormatJSON, FormatPlain}
+
+// DefaultIPTablesChain is the chain iptables rules are appended to unless another is given
+const DefaultIPTablesChain = "ALLOWLIST"
+
+// header identifies generated files in formats that support comments
+const header = "# Generated by do-firewall-allowlister, do not edit"
+
+// Entry is an allowlisted address or CIDR and the source it was collected from
+type Entry struct {
+	Address string `json:"address"`
+	Source  string `json:"source"`
+	// Owner is who answers for the named network the address belongs to
+	Owner string `json:"owner,omitempty"`
+}
+
+// Family returns "ipv6" for IPv6 addresses and "ipv4" otherwise
+func (e Entry) Family() string {
+	if strings.Contains(e.Address, ":") {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+// Document is the JSON representation of an allowlist
+type Document struct {
+	Count   int     `json:"count"`
+	Entries []Entry `json:"entries"`
+}
+
+// Options tunes the rendering of formats that need more than the addresses
+type Options struct {
+	// IPTablesChain is the chain iptables rules are appended to
+	IPTablesChain string
+}
+
+// Render writes the entries to w in the given format
+func Render(w io.Writer, format string, entries []Entry, opts Options) error {
+	switch format {
+	case FormatNginxAllow:
+		return renderLines(w, header, entries, func(e Entry) string {
+			return fmt.Sprintf("allow %s;", e.Address)
+		})
+	case FormatHAProxyACL:
+		// One pattern per line, loaded with: acl allowlisted src -f <file>
+		return renderLines(w, header, entries, func(e Entry) string {
+			return e.Address
+		})
+	case FormatIPTables:
+		chain := opts.IPTablesChain
+		if chain == "" {
+			chain = DefaultIPTablesChain
+		}
+		return renderLines(w, header, entries, func(e Entry) string {
+			command := "iptables"
+			if e.Family() == "ipv6" {
+				command = "ip6tables"
+			}
+			return fmt.Sprintf("%s -A %s -s %s -j ACCEPT", command, chain, e.Address)
+		})
+	case FormatCSV:
+		return renderCSV(w, entries)
+	case FormatJSON:
+		return renderJSON(w, entries)
+	case FormatPlain:
+		return renderLines(w, "", entries, func(e Entry) string {
+			return e.Address
+		})
+	default:
+		return ValidateFormat(format)
+	}
+}
+
+// ValidateFormat returns an error if format is not a supported export format
+func ValidateFormat(format string) error {
+	for _, supported := range Formats {
+		if format == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported export format: %s (must be one of %s)", format, strings.Join(Formats, ", "))
+}
+
+// renderLines writes an optional comment header followed by one line per entry
+func renderLines(w io.Writer, comment string, entries []Entry, line func(Entry) string) error {
+	if comment != "" {
+		if _, err := fmt.Fprintln(w, comment); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		if _, err := fmt.Fprintln(w, line(entry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderJSON writes the entries as an indented Document
+func renderJSON(w io.Writer, entries []Entry) error {
+	if entries == nil {
+		entries = []Entry{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(Document{Count: len(entries), Entries: entries})
+}
+
+// renderCSV writes the entries with their address family and source
+func renderCSV(w io.Writer, entries []Entry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"address", "family", "source"}); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := writer.Write([]string{entry.Address, entry.Family(), entry.Source}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteFile atomically replaces the file at path with data, so readers such as a reloading nginx
+// never see a partially written allowlist
+func WriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary export file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary export file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary export file: %w", err)
+	}
+
+	// CreateTemp uses 0600, exported allowlists are meant to be read by other services
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to set export file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace export file %s: %w", path, err)
+	}
+	return nil
+}
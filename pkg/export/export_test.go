@@ -0,0 +1,125 @@
+package export
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	entries := []Entry{
+		{Address: "173.245.48.0/20", Source: "cloudflare"},
+		{Address: "2400:cb00::/32", Source: "cloudflare"},
+		{Address: "203.0.113.5", Source: "netdata"},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		opts     Options
+		expected string
+	}{
+		{
+			name:   "nginx allow",
+			format: FormatNginxAllow,
+			expected: header + "\n" +
+				"allow 173.245.48.0/20;\n" +
+				"allow 2400:cb00::/32;\n" +
+				"allow 203.0.113.5;\n",
+		},
+		{
+			name:   "haproxy acl",
+			format: FormatHAProxyACL,
+			expected: header + "\n" +
+				"173.245.48.0/20\n" +
+				"2400:cb00::/32\n" +
+				"203.0.113.5\n",
+		},
+		{
+			name:   "iptables with default chain",
+			format: FormatIPTables,
+			expected: header + "\n" +
+				"iptables -A ALLOWLIST -s 173.245.48.0/20 -j ACCEPT\n" +
+				"ip6tables -A ALLOWLIST -s 2400:cb00::/32 -j ACCEPT\n" +
+				"iptables -A ALLOWLIST -s 203.0.113.5 -j ACCEPT\n",
+		},
+		{
+			name:   "iptables with custom chain",
+			format: FormatIPTables,
+			opts:   Options{IPTablesChain: "WEB"},
+			expected: header + "\n" +
+				"iptables -A WEB -s 173.245.48.0/20 -j ACCEPT\n" +
+				"ip6tables -A WEB -s 2400:cb00::/32 -j ACCEPT\n" +
+				"iptables -A WEB -s 203.0.113.5 -j ACCEPT\n",
+		},
+		{
+			name:   "csv",
+			format: FormatCSV,
+			expected: "address,family,source\n" +
+				"173.245.48.0/20,ipv4,cloudflare\n" +
+				"2400:cb00::/32,ipv6,cloudflare\n" +
+				"203.0.113.5,ipv4,netdata\n",
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			expected: "{\n" +
+				"  \"count\": 3,\n" +
+				"  \"entries\": [\n" +
+				"    {\n      \"address\": \"173.245.48.0/20\",\n      \"source\": \"cloudflare\"\n    },\n" +
+				"    {\n      \"address\": \"2400:cb00::/32\",\n      \"source\": \"cloudflare\"\n    },\n" +
+				"    {\n      \"address\": \"203.0.113.5\",\n      \"source\": \"netdata\"\n    }\n" +
+				"  ]\n" +
+				"}\n",
+		},
+		{
+			name:     "plain",
+			format:   FormatPlain,
+			expected: "173.245.48.0/20\n2400:cb00::/32\n203.0.113.5\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Render(&buf, tt.format, entries, tt.opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderUnsupportedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, "xml", nil, Options{}); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.conf")
+
+	if err := WriteFile(path, []byte("first\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := WriteFile(path, []byte("second\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read export file: %v", err)
+	}
+	if string(data) != "second\n" {
+		t.Errorf("expected replaced content, got %q", data)
+	}
+
+	matches, _ := filepath.Glob(path + ".tmp-*")
+	if len(matches) != 0 {
+		t.Errorf("expected no temporary files left, got %v", matches)
+	}
+}
@@ -0,0 +1,98 @@
+package invite
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Path is the URL path under which the daemon's server redeems invite tokens
+const Path = "/invite/"
+
+// Errors returned by Verify
+var (
+	ErrInvalid = errors.New("invalid invite")
+	ErrExpired = errors.New("invite expired")
+)
+
+// Invite grants whoever redeems it before ExpiresAt access to Port for TTL
+type Invite struct {
+	ID        string        `json:"id"`
+	Port      int           `json:"port"`
+	TTL       time.Duration `json:"ttl"`
+	ExpiresAt time.Time     `json:"exp"`
+	CreatedBy string        `json:"by,omitempty"`
+}
+
+// New creates an invite with a random ID that can be redeemed for validFor
+func New(port int, ttl, validFor time.Duration, createdBy string) (Invite, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Invite{}, fmt.Errorf("failed to generate invite id: %w", err)
+	}
+
+	return Invite{
+		ID:        hex.EncodeToString(b),
+		Port:      port,
+		TTL:       ttl,
+		ExpiresAt: time.Now().UTC().Add(validFor).Truncate(time.Second),
+		CreatedBy: createdBy,
+	}, nil
+}
+
+// Sign encodes the invite as a URL-safe token authenticated with an HMAC-SHA256 of key
+func Sign(inv Invite, key []byte) (string, error) {
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode invite: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature(encoded, key)), nil
+}
+
+// Verify checks the token's signature and expiry and returns the invite it encodes
+func Verify(token string, key []byte, now time.Time) (Invite, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Invite{}, ErrInvalid
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, signature(encoded, key)) {
+		return Invite{}, ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Invite{}, ErrInvalid
+	}
+
+	var inv Invite
+	if err := json.Unmarshal(payload, &inv); err != nil || inv.ID == "" {
+		return Invite{}, ErrInvalid
+	}
+	if !now.Before(inv.ExpiresAt) {
+		return Invite{}, ErrExpired
+	}
+	return inv, nil
+}
+
+// URL returns the link redeeming token on the server reachable at baseURL
+func URL(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + Path + token
+}
+
+// signature computes the HMAC-SHA256 of the encoded payload
+func signature(encoded string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
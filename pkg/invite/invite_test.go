@@ -0,0 +1,79 @@
+package invite
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	inv, err := New(22, 2*time.Hour, 24*time.Hour, "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token, err := Sign(inv, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := Verify(token, key, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ID != inv.ID || got.Port != 22 || got.TTL != 2*time.Hour || got.CreatedBy != "alice" {
+		t.Errorf("expected %+v, got %+v", inv, got)
+	}
+	if !got.ExpiresAt.Equal(inv.ExpiresAt) {
+		t.Errorf("expected expiry %s, got %s", inv.ExpiresAt, got.ExpiresAt)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	inv, err := New(22, time.Hour, time.Hour, "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token, err := Sign(inv, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	other, err := Sign(Invite{ID: inv.ID, Port: 3389, TTL: time.Hour, ExpiresAt: inv.ExpiresAt}, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	otherPayload, _, _ := strings.Cut(other, ".")
+
+	tests := []struct {
+		name     string
+		token    string
+		key      []byte
+		now      time.Time
+		expected error
+	}{
+		{name: "wrong key", token: token, key: []byte("another-signing-key-another-key!!"), now: time.Now(), expected: ErrInvalid},
+		{name: "tampered payload", token: otherPayload + "." + sig, key: key, now: time.Now(), expected: ErrInvalid},
+		{name: "missing signature", token: payload, key: key, now: time.Now(), expected: ErrInvalid},
+		{name: "garbage", token: "not-a-token", key: key, now: time.Now(), expected: ErrInvalid},
+		{name: "expired", token: token, key: key, now: inv.ExpiresAt, expected: ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.token, tt.key, tt.now); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestURL(t *testing.T) {
+	if got := URL("https://allow.example.com/", "abc.def"); got != "https://allow.example.com/invite/abc.def" {
+		t.Errorf("unexpected URL %s", got)
+	}
+}
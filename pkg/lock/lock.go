@@ -0,0 +1,117 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrLocked is returned when the lock is held by another process and could not be acquired in time
+var ErrLocked = errors.New("lock is held by another process")
+
+// pollInterval is how often a busy lock is retried while waiting
+const pollInterval = 250 * time.Millisecond
+
+// Locker acquires exclusive advisory locks on a file shared by all instances on the host
+type Locker struct {
+	path   string
+	logger *zap.Logger
+}
+
+// Lock is an acquired lock that must be released
+type Lock struct {
+	file   *os.File
+	logger *zap.Logger
+}
+
+// NewLocker creates a new locker for the given lock file path
+func NewLocker(path string, logger *zap.Logger) *Locker {
+	return &Locker{
+		path:   path,
+		logger: logger.Named("lock"),
+	}
+}
+
+// Path returns the lock file path
+func (l *Locker) Path() string {
+	return l.path
+}
+
+// For returns a locker for one resource, e.g. a firewall, whose lock file sits next to the
+// locker's so instances only exclude each other while working on the same resource
+func (l *Locker) For(name string) *Locker {
+	return &Locker{
+		path:   l.path + "." + name,
+		logger: l.logger,
+	}
+}
+
+// Acquire waits until the lock is acquired, the timeout elapses, or the context is cancelled
+func (l *Locker) Acquire(ctx context.Context, timeout time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	// Each acquisition uses its own file descriptor so goroutines in the same process also exclude each other
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", l.path, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", l.path, err)
+		}
+
+		if locked {
+			// Record the owner for troubleshooting; the lock itself is the advisory file lock
+			_ = file.Truncate(0)
+			_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+			l.logger.Debug("Acquired lock", zap.String("path", l.path), zap.Int("attempts", attempt))
+			return &Lock{file: file, logger: l.logger}, nil
+		}
+
+		if attempt == 1 {
+			l.logger.Info("Waiting for lock held by another instance",
+				zap.String("path", l.path),
+				zap.Duration("timeout", timeout))
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, fmt.Errorf("%w: %s (waited %s)", ErrLocked, l.path, timeout)
+		case <-time.After(pollInterval):
+			// Retry
+		}
+	}
+}
+
+// Release releases the lock
+func (lk *Lock) Release() error {
+	if lk == nil || lk.file == nil {
+		return nil
+	}
+
+	if err := unlock(lk.file); err != nil {
+		lk.file.Close()
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	lk.logger.Debug("Released lock", zap.String("path", lk.file.Name()))
+	err := lk.file.Close()
+	lk.file = nil
+	return err
+}
@@ -0,0 +1,94 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAcquireRelease(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	locker := NewLocker(filepath.Join(t.TempDir(), "test.lock"), logger)
+	ctx := context.Background()
+
+	first, err := locker.Acquire(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A second acquisition must wait and fail while the first lock is held
+	if _, err := locker.Acquire(ctx, 300*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("unexpected error releasing lock: %v", err)
+	}
+
+	second, err := locker.Acquire(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("expected lock to be acquirable after release, got %v", err)
+	}
+
+	if err := second.Release(); err != nil {
+		t.Fatalf("unexpected error releasing lock: %v", err)
+	}
+}
+
+func TestAcquireWaitsForRelease(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	locker := NewLocker(filepath.Join(t.TempDir(), "test.lock"), logger)
+	ctx := context.Background()
+
+	first, err := locker.Acquire(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = first.Release()
+	}()
+
+	second, err := locker.Acquire(ctx, 5*time.Second)
+	if err != nil {
+		t.Fatalf("expected lock after release, got %v", err)
+	}
+	_ = second.Release()
+}
+
+func TestFor(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	locker := NewLocker(filepath.Join(t.TempDir(), "test.lock"), logger)
+	ctx := context.Background()
+
+	first, err := locker.For("fw-1").Acquire(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer first.Release()
+
+	// Other resources are locked independently
+	other, err := locker.For("fw-2").Acquire(ctx, 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected the lock of another resource to be acquirable, got %v", err)
+	}
+	if err := other.Release(); err != nil {
+		t.Fatalf("unexpected error releasing lock: %v", err)
+	}
+
+	if _, err := locker.For("fw-1").Acquire(ctx, 300*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked for the same resource, got %v", err)
+	}
+}
+
+func TestReleaseNil(t *testing.T) {
+	var lk *Lock
+	if err := lk.Release(); err != nil {
+		t.Errorf("expected nil error releasing nil lock, got %v", err)
+	}
+}
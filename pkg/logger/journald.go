@@ -0,0 +1,145 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// journaldSocket is the native journal protocol socket
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldCore sends entries to journald using the native protocol, mapping each
+// structured field to a journal field
+type journaldCore struct {
+	zapcore.LevelEnabler
+	conn       net.Conn
+	identifier string
+	context    []zapcore.Field
+}
+
+// newJournaldCore connects to the local journald socket
+func newJournaldCore(identifier string, level zapcore.LevelEnabler) (zapcore.Core, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+
+	return &journaldCore{LevelEnabler: level, conn: conn, identifier: identifier}, nil
+}
+
+// With adds structured context to the core
+func (c *journaldCore) With(fields []zapcore.Field) zapcore.Core {
+	context := make([]zapcore.Field, 0, len(c.context)+len(fields))
+	context = append(context, c.context...)
+	context = append(context, fields...)
+	return &journaldCore{LevelEnabler: c.LevelEnabler, conn: c.conn, identifier: c.identifier, context: context}
+}
+
+// Check adds the core to the checked entry if the level is enabled
+func (c *journaldCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write sends the entry as a single journal datagram
+func (c *journaldCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.context {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", ent.Message)
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(syslogSeverity(ent.Level)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", c.identifier)
+	if ent.LoggerName != "" {
+		writeJournalField(&buf, "LOGGER", ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		writeJournalField(&buf, "CODE_FILE", ent.Caller.File)
+		writeJournalField(&buf, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		writeJournalField(&buf, "CODE_FUNC", ent.Caller.Function)
+	}
+	if ent.Stack != "" {
+		writeJournalField(&buf, "STACKTRACE", ent.Stack)
+	}
+
+	for key, value := range enc.Fields {
+		writeJournalField(&buf, journalFieldName(key), journalFieldValue(value))
+	}
+
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+// Sync is a no-op since every entry is sent immediately
+func (c *journaldCore) Sync() error {
+	return nil
+}
+
+// writeJournalField appends a field in the native journal format, using the binary
+// length-prefixed form for values containing newlines
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName converts a log field key to a valid journal field name
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	// Names must not start with an underscore or digit, those are reserved or invalid
+	if name == "" || name[0] == '_' || (name[0] >= '0' && name[0] <= '9') {
+		name = "F_" + name
+	}
+	return name
+}
+
+// journalFieldValue renders a field value, using JSON for non-string values
+func journalFieldValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
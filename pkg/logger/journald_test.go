@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestJournalFieldName(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: "firewall_id", expected: "FIREWALL_ID"},
+		{key: "source-ip", expected: "SOURCE_IP"},
+		{key: "_private", expected: "F__PRIVATE"},
+		{key: "1st", expected: "F_1ST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := journalFieldName(tt.key); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWriteJournalField(t *testing.T) {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", "hello")
+	if buf.String() != "MESSAGE=hello\n" {
+		t.Errorf("unexpected simple field encoding %q", buf.String())
+	}
+
+	buf.Reset()
+	writeJournalField(&buf, "STACKTRACE", "a\nb")
+
+	var expected bytes.Buffer
+	expected.WriteString("STACKTRACE\n")
+	_ = binary.Write(&expected, binary.LittleEndian, uint64(3))
+	expected.WriteString("a\nb\n")
+
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+		t.Errorf("unexpected multi-line field encoding %q", buf.String())
+	}
+}
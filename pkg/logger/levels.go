@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// levelOverrideCore filters entries by a per-module level chosen from the logger name
+type levelOverrideCore struct {
+	zapcore.Core
+	level     zapcore.Level
+	overrides map[string]zapcore.Level
+}
+
+// newLevelOverrideCore wraps a core that must be enabled for the most verbose of all levels
+func newLevelOverrideCore(core zapcore.Core, level zapcore.Level, overrides map[string]zapcore.Level) zapcore.Core {
+	return &levelOverrideCore{Core: core, level: level, overrides: overrides}
+}
+
+// Enabled reports whether any module may log at the given level
+func (c *levelOverrideCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= minLevel(c.level, c.overrides)
+}
+
+// With adds structured context while keeping the overrides
+func (c *levelOverrideCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelOverrideCore{Core: c.Core.With(fields), level: c.level, overrides: c.overrides}
+}
+
+// Check drops entries below the level of the module that produced them
+func (c *levelOverrideCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < c.levelFor(ent.LoggerName) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// levelFor returns the level for a logger name such as "daemon.service.digitalocean",
+// preferring an exact match and then the innermost named module
+func (c *levelOverrideCore) levelFor(name string) zapcore.Level {
+	if lvl, ok := c.overrides[name]; ok {
+		return lvl
+	}
+
+	parts := strings.Split(name, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if lvl, ok := c.overrides[parts[i]]; ok {
+			return lvl
+		}
+	}
+	return c.level
+}
+
+// minLevel returns the most verbose of the base level and all overrides
+func minLevel(level zapcore.Level, overrides map[string]zapcore.Level) zapcore.Level {
+	for _, lvl := range overrides {
+		if lvl < level {
+			level = lvl
+		}
+	}
+	return level
+}
@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLevelOverrideCore(t *testing.T) {
+	inner, logs := observer.New(zapcore.DebugLevel)
+	overrides := map[string]zapcore.Level{
+		"scheduler":    zapcore.WarnLevel,
+		"digitalocean": zapcore.DebugLevel,
+	}
+	log := zap.New(newLevelOverrideCore(inner, zapcore.InfoLevel, overrides))
+
+	log.Named("scheduler").Info("dropped: scheduler is WARN")
+	log.Named("scheduler").Warn("kept: scheduler warning")
+	log.Named("daemon").Named("digitalocean").Debug("kept: nested digitalocean debug")
+	log.Named("service").Debug("dropped: service uses base INFO")
+	log.Named("service").With(zap.String("k", "v")).Info("kept: service info")
+
+	entries := logs.All()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %+v", len(entries), entries)
+	}
+	for _, entry := range entries {
+		if entry.Message[:5] != "kept:" {
+			t.Errorf("unexpected entry %q from %s", entry.Message, entry.LoggerName)
+		}
+	}
+}
+
+func TestInitializeWithOptions(t *testing.T) {
+	err := Initialize("INFO",
+		WithSampling(0, 0, 0),
+		WithLevelOverrides(map[string]string{"scheduler": "WARN"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if Named("scheduler").Core().Enabled(zapcore.DebugLevel) {
+		t.Error("expected DEBUG to be disabled when no module requests it")
+	}
+}
@@ -1,7 +1,11 @@
 package logger
 
 import (
+	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -9,15 +13,120 @@ import (
 
 var globalLogger *zap.Logger
 
+// Supported log outputs
+const (
+	OutputStderr   = "stderr"
+	OutputSyslog   = "syslog"
+	OutputJournald = "journald"
+)
+
+// options holds optional logger settings
+type options struct {
+	sampling       *zap.SamplingConfig
+	samplingTick   time.Duration
+	levelOverrides map[string]string
+	output         string
+	syslog         syslogOptions
+	fields         map[string]string
+	ship           *shipOptions
+}
+
+// shipOptions holds the remote log collector settings
+type shipOptions struct {
+	format     string
+	network    string
+	address    string
+	bufferSize int
+}
+
+// syslogOptions holds the syslog destination settings
+type syslogOptions struct {
+	network  string
+	address  string
+	tag      string
+	facility string
+}
+
+// Option configures optional logger behavior
+type Option func(*options)
+
+// WithSampling logs the first initial entries with the same level and message per tick,
+// then every thereafter-th entry; an initial of zero disables sampling
+func WithSampling(initial, thereafter int, tick time.Duration) Option {
+	return func(o *options) {
+		if initial <= 0 {
+			o.sampling = nil
+			return
+		}
+		o.sampling = &zap.SamplingConfig{Initial: initial, Thereafter: thereafter}
+		o.samplingTick = tick
+	}
+}
+
+// WithLevelOverrides sets per-module log levels keyed by logger name (e.g. scheduler=WARN)
+func WithLevelOverrides(overrides map[string]string) Option {
+	return func(o *options) {
+		o.levelOverrides = overrides
+	}
+}
+
+// WithFields attaches the given fields to every log entry
+func WithFields(fields map[string]string) Option {
+	return func(o *options) {
+		o.fields = fields
+	}
+}
+
+// WithShipping additionally ships every entry to a Graylog (gelf) or Logstash (logstash)
+// collector over tcp or udp, buffering up to bufferSize entries in memory
+func WithShipping(format, network, address string, bufferSize int) Option {
+	return func(o *options) {
+		o.ship = &shipOptions{format: format, network: network, address: address, bufferSize: bufferSize}
+	}
+}
+
+// WithSyslog sends logs to syslog in RFC5424 format, to the local daemon when address
+// is empty or to a remote daemon over network (udp or tcp) otherwise
+func WithSyslog(network, address, tag, facility string) Option {
+	return func(o *options) {
+		o.output = OutputSyslog
+		o.syslog = syslogOptions{network: network, address: address, tag: tag, facility: facility}
+	}
+}
+
+// WithJournald sends logs natively to the local systemd journal
+func WithJournald(identifier string) Option {
+	return func(o *options) {
+		o.output = OutputJournald
+		o.syslog = syslogOptions{tag: identifier}
+	}
+}
+
 // Initialize sets up the global logger with the specified log level
-func Initialize(logLevel string) error {
+func Initialize(logLevel string, opts ...Option) error {
 	level, err := parseLogLevel(logLevel)
 	if err != nil {
 		return err
 	}
 
+	o := &options{
+		sampling:     &zap.SamplingConfig{Initial: 100, Thereafter: 100},
+		samplingTick: time.Second,
+		output:       OutputStderr,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	overrides := make(map[string]zapcore.Level, len(o.levelOverrides))
+	for name, overrideLevel := range o.levelOverrides {
+		overrides[name], _ = parseLogLevel(overrideLevel)
+	}
+
 	config := zap.NewProductionConfig()
-	config.Level = zap.NewAtomicLevelAt(level)
+	config.Level = zap.NewAtomicLevelAt(minLevel(level, overrides))
+	// Sampling is applied below so that the tick is configurable
+	config.Sampling = nil
 	config.Encoding = "json"
 	config.EncoderConfig.TimeKey = "timestamp"
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -26,7 +135,49 @@ func Initialize(logLevel string) error {
 	config.EncoderConfig.CallerKey = "caller"
 	config.EncoderConfig.StacktraceKey = "stacktrace"
 
-	logger, err := config.Build(zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	buildOpts := []zap.Option{zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)}
+	// Tee into the shipping sink first so global fields, sampling and overrides apply to both
+	if o.ship != nil {
+		s, err := newShipper(o.ship.format, o.ship.network, o.ship.address, o.ship.bufferSize)
+		if err != nil {
+			return err
+		}
+		shipLevel := config.Level
+		buildOpts = append(buildOpts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, newShipCore(s, shipLevel))
+		}))
+	}
+	if len(o.fields) > 0 {
+		keys := make([]string, 0, len(o.fields))
+		for key := range o.fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := make([]zap.Field, 0, len(keys))
+		for _, key := range keys {
+			fields = append(fields, zap.String(key, o.fields[key]))
+		}
+		buildOpts = append(buildOpts, zap.Fields(fields...))
+	}
+	if o.sampling != nil {
+		sampling := o.sampling
+		tick := o.samplingTick
+		if tick <= 0 {
+			tick = time.Second
+		}
+		buildOpts = append(buildOpts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewSamplerWithOptions(core, tick, sampling.Initial, sampling.Thereafter)
+		}))
+	}
+	// Filter per-module levels before sampling so dropped entries are not counted
+	if len(overrides) > 0 {
+		buildOpts = append(buildOpts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return newLevelOverrideCore(core, level, overrides)
+		}))
+	}
+
+	logger, err := build(config, o, buildOpts)
 	if err != nil {
 		return err
 	}
@@ -35,6 +186,59 @@ func Initialize(logLevel string) error {
 	return nil
 }
 
+// build creates the logger for the configured output
+func build(config zap.Config, o *options, buildOpts []zap.Option) (*zap.Logger, error) {
+	var core zapcore.Core
+	switch o.output {
+	case OutputStderr:
+		return config.Build(buildOpts...)
+	case OutputSyslog:
+		w, err := newSyslogWriter(o.syslog.network, o.syslog.address, o.syslog.tag, o.syslog.facility)
+		if err != nil {
+			return nil, err
+		}
+		core = newSyslogCore(zapcore.NewJSONEncoder(config.EncoderConfig), w, config.Level)
+	case OutputJournald:
+		journald, err := newJournaldCore(o.syslog.tag, config.Level)
+		if err != nil {
+			return nil, err
+		}
+		core = journald
+	default:
+		return nil, fmt.Errorf("unsupported log output: %s", o.output)
+	}
+
+	// Internal zap errors still go to stderr so they are never lost
+	buildOpts = append(buildOpts, zap.ErrorOutput(zapcore.Lock(os.Stderr)))
+	return zap.New(core, buildOpts...), nil
+}
+
+// levelNames lists the supported log levels from most to least verbose
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+// ShiftLevel returns the log level delta steps less verbose than logLevel,
+// clamped to the supported range (negative deltas increase verbosity)
+func ShiftLevel(logLevel string, delta int) string {
+	level, _ := parseLogLevel(logLevel)
+
+	index := 0
+	for i, name := range levelNames {
+		if l, _ := parseLogLevel(name); l == level {
+			index = i
+			break
+		}
+	}
+
+	index += delta
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(levelNames) {
+		index = len(levelNames) - 1
+	}
+	return levelNames[index]
+}
+
 // parseLogLevel converts string log level to zapcore.Level
 func parseLogLevel(logLevel string) (zapcore.Level, error) {
 	switch strings.ToUpper(logLevel) {
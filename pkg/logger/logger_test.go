@@ -0,0 +1,29 @@
+package logger
+
+import "testing"
+
+func TestShiftLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    string
+		delta    int
+		expected string
+	}{
+		{name: "no change", level: "INFO", delta: 0, expected: "INFO"},
+		{name: "quiet", level: "INFO", delta: 1, expected: "WARN"},
+		{name: "very quiet", level: "INFO", delta: 2, expected: "ERROR"},
+		{name: "verbose", level: "INFO", delta: -1, expected: "DEBUG"},
+		{name: "clamped verbose", level: "DEBUG", delta: -3, expected: "DEBUG"},
+		{name: "clamped quiet", level: "ERROR", delta: 5, expected: "FATAL"},
+		{name: "warning alias", level: "warning", delta: -1, expected: "INFO"},
+		{name: "unknown defaults to info", level: "bogus", delta: 1, expected: "WARN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ShiftLevel(tt.level, tt.delta); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Supported log shipping formats
+const (
+	ShipFormatGELF     = "gelf"
+	ShipFormatLogstash = "logstash"
+)
+
+const (
+	// gelfChunkSize is the maximum UDP datagram payload before a GELF message is chunked
+	gelfChunkSize = 8192
+	// gelfMaxChunks is the maximum number of chunks allowed by the GELF specification
+	gelfMaxChunks = 128
+	// shipSyncTimeout bounds how long Sync waits for buffered entries to be sent
+	shipSyncTimeout = 5 * time.Second
+)
+
+// shipper sends encoded log messages to a remote collector from a background goroutine
+type shipper struct {
+	network string
+	address string
+	format  string
+
+	queue   chan []byte
+	pending atomic.Int64
+	dropped atomic.Uint64
+
+	conn net.Conn
+}
+
+// newShipper creates a shipper buffering up to bufferSize messages
+func newShipper(format, network, address string, bufferSize int) (*shipper, error) {
+	if format != ShipFormatGELF && format != ShipFormatLogstash {
+		return nil, fmt.Errorf("unsupported log shipping format: %s", format)
+	}
+	if network != "tcp" && network != "udp" {
+		return nil, fmt.Errorf("unsupported log shipping network: %s", network)
+	}
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+
+	s := &shipper{
+		network: network,
+		address: address,
+		format:  format,
+		queue:   make(chan []byte, bufferSize),
+	}
+	go s.run()
+	return s, nil
+}
+
+// enqueue buffers a message, dropping it if the buffer is full so logging never blocks
+func (s *shipper) enqueue(msg []byte) {
+	s.pending.Add(1)
+	select {
+	case s.queue <- msg:
+	default:
+		s.pending.Add(-1)
+		s.dropped.Add(1)
+	}
+}
+
+// run sends queued messages until the process exits
+func (s *shipper) run() {
+	for msg := range s.queue {
+		// A failed send is retried once on a fresh connection, then dropped
+		if err := s.send(msg); err != nil {
+			if err := s.send(msg); err != nil {
+				s.dropped.Add(1)
+			}
+		}
+		s.pending.Add(-1)
+	}
+}
+
+// send writes a single message, connecting lazily so an unavailable collector never
+// prevents the application from starting
+func (s *shipper) send(msg []byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	_ = s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+
+	var err error
+	switch {
+	case s.network == "tcp" && s.format == ShipFormatGELF:
+		// GELF over TCP is delimited by a null byte
+		_, err = s.conn.Write(append(msg, 0))
+	case s.network == "tcp":
+		_, err = s.conn.Write(append(msg, '\n'))
+	case s.format == ShipFormatGELF && len(msg) > gelfChunkSize:
+		err = s.writeGELFChunks(msg)
+	default:
+		_, err = s.conn.Write(msg)
+	}
+
+	if err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// writeGELFChunks splits a large GELF message into chunked UDP datagrams
+func (s *shipper) writeGELFChunks(msg []byte) error {
+	count := (len(msg) + gelfChunkSize - 1) / gelfChunkSize
+	if count > gelfMaxChunks {
+		return fmt.Errorf("GELF message too large: %d bytes", len(msg))
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * gelfChunkSize
+		if end > len(msg) {
+			end = len(msg)
+		}
+
+		chunk := make([]byte, 0, 12+end-i*gelfChunkSize)
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*gelfChunkSize:end]...)
+
+		if _, err := s.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sync waits for buffered messages to be sent, bounded by shipSyncTimeout
+func (s *shipper) sync() error {
+	deadline := time.Now().Add(shipSyncTimeout)
+	for s.pending.Load() > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out flushing shipped logs to %s", s.address)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if dropped := s.dropped.Swap(0); dropped > 0 {
+		return fmt.Errorf("dropped %d log entries shipped to %s", dropped, s.address)
+	}
+	return nil
+}
+
+// shipCore encodes entries for a GELF or Logstash collector
+type shipCore struct {
+	zapcore.LevelEnabler
+	shipper *shipper
+	host    string
+	context []zapcore.Field
+}
+
+// newShipCore creates a core shipping entries through the shipper
+func newShipCore(s *shipper, level zapcore.LevelEnabler) zapcore.Core {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &shipCore{LevelEnabler: level, shipper: s, host: host}
+}
+
+// With adds structured context to the core
+func (c *shipCore) With(fields []zapcore.Field) zapcore.Core {
+	context := make([]zapcore.Field, 0, len(c.context)+len(fields))
+	context = append(context, c.context...)
+	context = append(context, fields...)
+	return &shipCore{LevelEnabler: c.LevelEnabler, shipper: c.shipper, host: c.host, context: context}
+}
+
+// Check adds the core to the checked entry if the level is enabled
+func (c *shipCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write encodes the entry and hands it to the shipper's buffer
+func (c *shipCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.context {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	var msg map[string]interface{}
+	if c.shipper.format == ShipFormatGELF {
+		msg = c.gelfMessage(ent, enc.Fields)
+	} else {
+		msg = c.logstashMessage(ent, enc.Fields)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode shipped log entry: %w", err)
+	}
+
+	c.shipper.enqueue(data)
+	return nil
+}
+
+// Sync flushes buffered entries
+func (c *shipCore) Sync() error {
+	return c.shipper.sync()
+}
+
+// gelfMessage builds a GELF 1.1 message, prefixing additional fields with an underscore
+func (c *shipCore) gelfMessage(ent zapcore.Entry, fields map[string]interface{}) map[string]interface{} {
+	msg := map[string]interface{}{
+		"version":       "1.1",
+		"host":          c.host,
+		"short_message": ent.Message,
+		"timestamp":     float64(ent.Time.UnixNano()) / float64(time.Second),
+		"level":         syslogSeverity(ent.Level),
+	}
+	if ent.Stack != "" {
+		msg["full_message"] = ent.Message + "\n" + ent.Stack
+	}
+	if ent.LoggerName != "" {
+		msg["_logger"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		msg["_caller"] = ent.Caller.TrimmedPath()
+	}
+
+	for key, value := range fields {
+		name := "_" + gelfFieldName(key)
+		// "_id" is reserved by the GELF specification
+		if name == "_id" {
+			name = "_field_id"
+		}
+		msg[name] = value
+	}
+	return msg
+}
+
+// logstashMessage builds a message for the Logstash json_lines codec
+func (c *shipCore) logstashMessage(ent zapcore.Entry, fields map[string]interface{}) map[string]interface{} {
+	msg := make(map[string]interface{}, len(fields)+6)
+	for key, value := range fields {
+		msg[key] = value
+	}
+
+	msg["@timestamp"] = ent.Time.UTC().Format(time.RFC3339Nano)
+	msg["@version"] = "1"
+	msg["message"] = ent.Message
+	msg["level"] = ent.Level.CapitalString()
+	msg["host"] = c.host
+	if ent.LoggerName != "" {
+		msg["logger"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		msg["caller"] = ent.Caller.TrimmedPath()
+	}
+	if ent.Stack != "" {
+		msg["stacktrace"] = ent.Stack
+	}
+	return msg
+}
+
+// gelfFieldName replaces characters not allowed in GELF additional field names
+func gelfFieldName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestShipGELFOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msg, _ := bufio.NewReader(conn).ReadString(0)
+		received <- strings.TrimSuffix(msg, "\x00")
+	}()
+
+	s, err := newShipper(ShipFormatGELF, "tcp", listener.Addr().String(), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log := zap.New(newShipCore(s, zapcore.InfoLevel))
+	log.Named("service").With(zap.String("id", "r-1")).Error("Update failed", zap.Int("port", 22))
+
+	if err := log.Sync(); err != nil {
+		t.Fatalf("unexpected sync error: %v", err)
+	}
+
+	var msg map[string]interface{}
+	select {
+	case raw := <-received:
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			t.Fatalf("invalid GELF message %q: %v", raw, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for GELF message")
+	}
+
+	if msg["version"] != "1.1" || msg["short_message"] != "Update failed" {
+		t.Errorf("unexpected GELF message: %v", msg)
+	}
+	if msg["level"] != float64(3) {
+		t.Errorf("expected syslog error level 3, got %v", msg["level"])
+	}
+	if msg["_logger"] != "service" || msg["_port"] != float64(22) || msg["_field_id"] != "r-1" {
+		t.Errorf("expected additional fields, got %v", msg)
+	}
+}
+
+func TestShipLogstashOverUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	s, err := newShipper(ShipFormatLogstash, "udp", listener.LocalAddr().String(), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log := zap.New(newShipCore(s, zapcore.InfoLevel))
+	log.Info("Firewall updated", zap.String("firewall_id", "fw-1"))
+	_ = log.Sync()
+
+	buf := make([]byte, 4096)
+	_ = listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read Logstash message: %v", err)
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(buf[:n], &msg); err != nil {
+		t.Fatalf("invalid Logstash message %q: %v", buf[:n], err)
+	}
+
+	if msg["message"] != "Firewall updated" || msg["level"] != "INFO" || msg["firewall_id"] != "fw-1" {
+		t.Errorf("unexpected Logstash message: %v", msg)
+	}
+	if _, ok := msg["@timestamp"]; !ok {
+		t.Error("expected @timestamp field")
+	}
+}
+
+func TestShipperDropsWhenBufferFull(t *testing.T) {
+	s := &shipper{queue: make(chan []byte, 1)}
+
+	s.enqueue([]byte("first"))
+	s.enqueue([]byte("second"))
+
+	if dropped := s.dropped.Load(); dropped != 1 {
+		t.Errorf("expected 1 dropped message, got %d", dropped)
+	}
+}
+
+func TestNewShipperInvalid(t *testing.T) {
+	if _, err := newShipper("fluentd", "tcp", "127.0.0.1:1", 1); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+	if _, err := newShipper(ShipFormatGELF, "unix", "/tmp/sock", 1); err == nil {
+		t.Error("expected error for unsupported network")
+	}
+}
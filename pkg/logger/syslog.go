@@ -0,0 +1,189 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syslogFacilities maps facility names to their RFC5424 codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// localSyslogPaths are the well-known local syslog sockets, tried in order
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogWriter sends RFC5424 messages to a local or remote syslog daemon
+type syslogWriter struct {
+	network  string
+	address  string
+	tag      string
+	facility int
+	hostname string
+	pid      int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// newSyslogWriter connects to the syslog daemon at network/address, or to the local
+// daemon when address is empty
+func newSyslogWriter(network, address, tag, facility string) (*syslogWriter, error) {
+	code, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility: %s", facility)
+	}
+
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	w := &syslogWriter{
+		network:  network,
+		address:  address,
+		tag:      tag,
+		facility: code,
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect dials the configured syslog daemon
+func (w *syslogWriter) connect() error {
+	if w.address != "" {
+		conn, err := net.Dial(w.network, w.address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog at %s://%s: %w", w.network, w.address, err)
+		}
+		w.conn = conn
+		return nil
+	}
+
+	for _, path := range localSyslogPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				w.network = network
+				w.conn = conn
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("failed to connect to local syslog daemon")
+}
+
+// write sends a single message, reconnecting once if the connection was lost
+func (w *syslogWriter) write(severity int, t time.Time, msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	packet := w.format(severity, t, msg)
+	if w.conn != nil {
+		if _, err := w.conn.Write(packet); err == nil {
+			return nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	if err := w.connect(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write(packet)
+	return err
+}
+
+// format renders an RFC5424 message, with octet-counting framing on stream transports
+func (w *syslogWriter) format(severity int, t time.Time, msg []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d - - ",
+		w.facility*8+severity, t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), w.hostname, w.tag, w.pid)
+	buf.Write(msg)
+
+	if w.network == "tcp" || w.network == "tcp4" || w.network == "tcp6" || w.network == "unix" {
+		return append([]byte(fmt.Sprintf("%d ", buf.Len())), buf.Bytes()...)
+	}
+	return buf.Bytes()
+}
+
+// syslogSeverity maps a zap level to an RFC5424 severity
+func syslogSeverity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// syslogCore encodes entries as JSON and sends them to syslog with a severity matching their level
+type syslogCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	w   *syslogWriter
+}
+
+// newSyslogCore creates a core writing JSON-encoded entries to the syslog writer
+func newSyslogCore(enc zapcore.Encoder, w *syslogWriter, level zapcore.LevelEnabler) zapcore.Core {
+	return &syslogCore{LevelEnabler: level, enc: enc, w: w}
+}
+
+// With adds structured context to the core
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &syslogCore{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), w: c.w}
+	for _, field := range fields {
+		field.AddTo(clone.enc)
+	}
+	return clone
+}
+
+// Check adds the core to the checked entry if the level is enabled
+func (c *syslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write sends the encoded entry to syslog
+func (c *syslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	return c.w.write(syslogSeverity(ent.Level), ent.Time, bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+// Sync is a no-op since every entry is sent immediately
+func (c *syslogCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSyslogCore(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	w, err := newSyslogWriter("udp", listener.LocalAddr().String(), "allowlister", "daemon")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	log := zap.New(newSyslogCore(enc, w, zapcore.InfoLevel))
+	log.Named("service").Warn("Firewall updated", zap.String("firewall_id", "fw-1"))
+
+	buf := make([]byte, 4096)
+	_ = listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read syslog message: %v", err)
+	}
+	msg := string(buf[:n])
+
+	// daemon facility (3) * 8 + warning severity (4)
+	if !strings.HasPrefix(msg, "<28>1 ") {
+		t.Errorf("expected RFC5424 header with priority 28, got %q", msg)
+	}
+	if !strings.Contains(msg, " allowlister ") {
+		t.Errorf("expected app name in message, got %q", msg)
+	}
+	if !strings.Contains(msg, `"firewall_id":"fw-1"`) || !strings.Contains(msg, `"logger":"service"`) {
+		t.Errorf("expected JSON payload with fields, got %q", msg)
+	}
+}
+
+func TestSyslogStreamFraming(t *testing.T) {
+	w := &syslogWriter{network: "tcp", tag: "app", facility: 1, hostname: "host", pid: 7}
+	packet := string(w.format(6, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), []byte("hello")))
+
+	expected := "<14>1 2024-01-02T03:04:05.000000Z host app 7 - - hello"
+	framed := fmt.Sprintf("%d %s", len(expected), expected)
+	if packet != framed {
+		t.Errorf("expected octet-counted frame %q, got %q", framed, packet)
+	}
+}
+
+func TestSyslogUnknownFacility(t *testing.T) {
+	if _, err := newSyslogWriter("udp", "127.0.0.1:514", "app", "bogus"); err == nil {
+		t.Error("expected error for unknown facility")
+	}
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Metric types of the Prometheus text exposition format
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// contentType is the Prometheus text exposition format version written by the registry
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Label is a name/value pair attached to a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a metric family
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named metric with its samples; the name is prefixed with the namespace when written
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector returns the current metric families at scrape time
+type Collector func() []Family
+
+// Registry writes the families of its collectors in the Prometheus text format, adding the
+// constant labels to every sample
+type Registry struct {
+	namespace string
+	labels    []Label
+	logger    *zap.Logger
+
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates a registry prefixing metrics with namespace and labelling every sample
+// with the constant labels
+func NewRegistry(namespace string, labels map[string]string, logger *zap.Logger) *Registry {
+	r := &Registry{
+		namespace: namespace,
+		logger:    logger.Named("metrics"),
+	}
+	for name, value := range labels {
+		r.labels = append(r.labels, Label{Name: name, Value: value})
+	}
+	sort.Slice(r.labels, func(i, j int) bool { return r.labels[i].Name < r.labels[j].Name })
+	return r
+}
+
+// Register adds a collector called on every scrape
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes the families of every collector in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, collect := range collectors {
+		for _, family := range collect() {
+			r.writeFamily(bw, family)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeFamily writes the HELP and TYPE lines followed by one line per sample
+func (r *Registry) writeFamily(w *bufio.Writer, family Family) {
+	name := family.Name
+	if r.namespace != "" {
+		name = r.namespace + "_" + name
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(family.Help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, family.Type)
+	for _, sample := range family.Samples {
+		w.WriteString(name)
+		r.writeLabels(w, sample.Labels)
+		w.WriteString(" ")
+		w.WriteString(strconv.FormatFloat(sample.Value, 'g', -1, 64))
+		w.WriteString("\n")
+	}
+}
+
+// writeLabels writes the constant labels followed by the sample's own labels
+func (r *Registry) writeLabels(w *bufio.Writer, labels []Label) {
+	if len(r.labels) == 0 && len(labels) == 0 {
+		return
+	}
+
+	w.WriteString("{")
+	for i, label := range append(append([]Label(nil), r.labels...), labels...) {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		fmt.Fprintf(w, `%s="%s"`, label.Name, escapeLabelValue(label.Value))
+	}
+	w.WriteString("}")
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if err := r.Write(w); err != nil {
+		r.logger.Warn("Failed to write metrics", zap.Error(err))
+	}
+}
+
+// escapeHelp escapes backslashes and line feeds in HELP text
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds in label values
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
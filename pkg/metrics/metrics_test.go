@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		expected  string
+	}{
+		{
+			name:      "namespace and constant labels",
+			namespace: "allowlister",
+			labels:    map[string]string{"firewall": "web", "env": "prod"},
+			expected: `# HELP allowlister_source_addresses Addresses collected per source
+# TYPE allowlister_source_addresses gauge
+allowlister_source_addresses{env="prod",firewall="web",source="cloudflare"} 22
+allowlister_source_addresses{env="prod",firewall="web",source="netdata"} 3
+# HELP allowlister_runs_total Started runs
+# TYPE allowlister_runs_total counter
+allowlister_runs_total{env="prod",firewall="web"} 1.5
+`,
+		},
+		{
+			name: "no namespace or labels",
+			expected: `# HELP source_addresses Addresses collected per source
+# TYPE source_addresses gauge
+source_addresses{source="cloudflare"} 22
+source_addresses{source="netdata"} 3
+# HELP runs_total Started runs
+# TYPE runs_total counter
+runs_total 1.5
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(tt.namespace, tt.labels, zaptest.NewLogger(t))
+			r.Register(func() []Family {
+				return []Family{
+					{Name: "source_addresses", Help: "Addresses collected per source", Type: TypeGauge, Samples: []Sample{
+						{Labels: []Label{{Name: "source", Value: "cloudflare"}}, Value: 22},
+						{Labels: []Label{{Name: "source", Value: "netdata"}}, Value: 3},
+					}},
+				}
+			})
+			r.Register(func() []Family {
+				return []Family{{Name: "runs_total", Help: "Started runs", Type: TypeCounter, Samples: []Sample{{Value: 1.5}}}}
+			})
+
+			var buf bytes.Buffer
+			if err := r.Write(&buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("unexpected output:\n%s\nwant:\n%s", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestRegistryEscaping(t *testing.T) {
+	r := NewRegistry("", map[string]string{"env": `a"b\c` + "\n"}, zaptest.NewLogger(t))
+	r.Register(func() []Family {
+		return []Family{{Name: "up", Help: "line\nbreak", Type: TypeGauge, Samples: []Sample{{Value: 1}}}}
+	})
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "# HELP up line\\nbreak\n# TYPE up gauge\nup{env=\"a\\\"b\\\\c\\n\"} 1\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%q\nwant:\n%q", buf.String(), expected)
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := NewRegistry("firewall_allowlister", nil, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != contentType {
+		t.Errorf("unexpected response: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+)
+
+// maxListedAddresses bounds how many entries a digest message spells out per direction
+const maxListedAddresses = 20
+
+// Digest summarizes the changes applied to a firewall over a period
+type Digest struct {
+	FirewallID   string         `json:"firewall_id"`
+	FirewallName string         `json:"firewall_name,omitempty"`
+	From         time.Time      `json:"from"`
+	To           time.Time      `json:"to"`
+	Changes      int            `json:"changes"`
+	Actions      map[string]int `json:"actions,omitempty"`
+	// Added and Removed are the net "protocol/port address" changes: an entry added and removed
+	// again within the period appears in neither
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// Summarize builds the digest of the audit records of a firewall between from and to
+func Summarize(firewallID string, records []audit.Record, from, to time.Time) *Digest {
+	digest := &Digest{
+		FirewallID: firewallID,
+		From:       from,
+		To:         to,
+		Actions:    make(map[string]int),
+		Added:      []string{},
+		Removed:    []string{},
+	}
+
+	// net maps an entry to a positive count when it ended up added and negative when removed
+	net := make(map[string]int)
+	for _, record := range records {
+		if record.Time.Before(from) || !record.Time.Before(to) {
+			continue
+		}
+
+		digest.Changes++
+		digest.Actions[record.Action]++
+		if record.FirewallName != "" {
+			digest.FirewallName = record.FirewallName
+		}
+		for _, address := range record.Added {
+			net[address]++
+		}
+		for _, address := range record.Removed {
+			net[address]--
+		}
+	}
+
+	for address, change := range net {
+		switch {
+		case change > 0:
+			digest.Added = append(digest.Added, address)
+		case change < 0:
+			digest.Removed = append(digest.Removed, address)
+		}
+	}
+	sort.Strings(digest.Added)
+	sort.Strings(digest.Removed)
+
+	return digest
+}
+
+// Text renders the digest as a short human-readable message, its title followed by its body
+func (d *Digest) Text() string {
+	return d.Title() + "\n" + d.Body()
+}
+
+// Title renders the first line of the digest message, naming the firewall and the period
+func (d *Digest) Title() string {
+	name := d.FirewallID
+	if d.FirewallName != "" {
+		name = fmt.Sprintf("%s (%s)", d.FirewallName, d.FirewallID)
+	}
+	return fmt.Sprintf("Firewall change digest for %s, %s to %s",
+		name, d.From.UTC().Format(time.RFC3339), d.To.UTC().Format(time.RFC3339))
+}
+
+// Body renders the digest message after its title: the counts and the bounded address lists
+func (d *Digest) Body() string {
+	if d.Changes == 0 {
+		return "No changes were applied in this period."
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d changes applied: %d rule entries added, %d removed", d.Changes, len(d.Added), len(d.Removed))
+	writeAddresses(&b, "Added", d.Added)
+	writeAddresses(&b, "Removed", d.Removed)
+	return b.String()
+}
+
+// writeAddresses appends a bounded list of entries to the message
+func writeAddresses(b *strings.Builder, label string, addresses []string) {
+	if len(addresses) == 0 {
+		return
+	}
+
+	listed := addresses
+	if len(listed) > maxListedAddresses {
+		listed = listed[:maxListedAddresses]
+	}
+	fmt.Fprintf(b, "\n%s: %s", label, strings.Join(listed, ", "))
+	if more := len(addresses) - len(listed); more > 0 {
+		fmt.Fprintf(b, " and %d more", more)
+	}
+}
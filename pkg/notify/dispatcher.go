@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// Channel delivers notifications, e.g. a Webhook
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Dispatcher sends the notifications of scheduled runs to every configured channel
+type Dispatcher struct {
+	channels []Channel
+	logger   *zap.Logger
+}
+
+// NewDispatcher creates a dispatcher sending to channels
+func NewDispatcher(logger *zap.Logger, channels ...Channel) *Dispatcher {
+	return &Dispatcher{
+		channels: channels,
+		logger:   logger.Named("notify"),
+	}
+}
+
+// Enabled reports whether any channel is configured
+func (d *Dispatcher) Enabled() bool {
+	return d != nil && len(d.channels) > 0
+}
+
+// Dispatch sends the message to every channel; a failing channel does not stop the others, and
+// the errors of all failing channels are returned together
+func (d *Dispatcher) Dispatch(ctx context.Context, msg Message) error {
+	if !d.Enabled() {
+		return nil
+	}
+
+	var errs []error
+	for _, channel := range d.channels {
+		if err := channel.Send(ctx, msg); err != nil {
+			d.logger.Error("Failed to send notification", zap.Error(err))
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TLS modes of the SMTP connection
+const (
+	// SMTPStartTLS upgrades a plain connection with STARTTLS, failing if the server does not offer it
+	SMTPStartTLS = "starttls"
+	// SMTPTLS connects over TLS from the start, usually on port 465
+	SMTPTLS = "tls"
+	// SMTPNone sends in the clear, for relays on localhost or a trusted network only
+	SMTPNone = "none"
+)
+
+// emailTimeout bounds the whole SMTP conversation of one notification
+const emailTimeout = 30 * time.Second
+
+// Email sends notifications as plain text mails through an SMTP server
+type Email struct {
+	host     string
+	port     int
+	tlsMode  string
+	username string
+	password string
+	from     string
+	to       []string
+	logger   *zap.Logger
+}
+
+// NewEmail creates an email channel sending from from to every address of to through the SMTP
+// server at host; port 0 picks the usual port of the TLS mode
+func NewEmail(host string, port int, tlsMode, username, password, from string, to []string, logger *zap.Logger) *Email {
+	if tlsMode == "" {
+		tlsMode = SMTPStartTLS
+	}
+	if port == 0 {
+		port = DefaultSMTPPort(tlsMode)
+	}
+	return &Email{
+		host:     host,
+		port:     port,
+		tlsMode:  tlsMode,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+		logger:   logger.Named("notify"),
+	}
+}
+
+// DefaultSMTPPort returns the usual SMTP port of a TLS mode: 465 for tls, 25 for none and the
+// submission port 587 for starttls
+func DefaultSMTPPort(tlsMode string) int {
+	switch tlsMode {
+	case SMTPTLS:
+		return 465
+	case SMTPNone:
+		return 25
+	default:
+		return 587
+	}
+}
+
+// Send mails the message with its title as the subject
+func (e *Email) Send(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if e.tlsMode == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: e.host}}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if e.tlsMode == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("failed to send email: SMTP server %s does not offer STARTTLS", address)
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return fmt.Errorf("failed to start TLS with SMTP server: %w", err)
+		}
+	}
+	if e.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return fmt.Errorf("failed to authenticate with SMTP server: %w", err)
+		}
+	}
+
+	// The envelope takes the bare addresses, the headers keep any display names
+	if err := client.Mail(envelopeAddress(e.from)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	for _, to := range e.to {
+		if err := client.Rcpt(envelopeAddress(to)); err != nil {
+			return fmt.Errorf("failed to send email to %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(e.mail(msg, time.Now())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := client.Quit(); err != nil {
+		e.logger.Debug("SMTP server closed the connection uncleanly", zap.Error(err))
+	}
+
+	e.logger.Debug("Sent email notification", zap.Strings("to", e.to))
+	return nil
+}
+
+// envelopeAddress returns the bare address of an address with a display name such as
+// "Ops <ops@example.com>"
+func envelopeAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return address
+}
+
+// mail renders the message as a MIME mail with a quoted-printable UTF-8 body
+func (e *Email) mail(msg Message, date time.Time) []byte {
+	subject := msg.Title
+	if subject == "" {
+		subject = "do-firewall-allowlister notification"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	_, _ = qp.Write([]byte(strings.ReplaceAll(msg.Text, "\n", "\r\n")))
+	_ = qp.Close()
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// smtpServer accepts one mail on a local listener and returns the commands and data it received;
+// it offers STARTTLS in its EHLO reply only when startTLS is set, but never upgrades
+func smtpServer(t *testing.T, startTLS bool) (host string, port int, received chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received = make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var lines []string
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch {
+			case inData && line == ".":
+				inData = false
+				reply("250 queued")
+			case inData:
+			case strings.HasPrefix(line, "EHLO"):
+				if startTLS {
+					reply("250-localhost")
+					reply("250 STARTTLS")
+				} else {
+					reply("250 localhost")
+				}
+			case line == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case line == "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+		received <- lines
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestEmailSend(t *testing.T) {
+	host, port, received := smtpServer(t, false)
+	email := NewEmail(host, port, SMTPNone, "", "", "Allowlister <allowlister@example.com>",
+		[]string{"ops@example.com", "security@example.com"}, zaptest.NewLogger(t))
+
+	msg := Message{Title: "[production] Firewall update failed, 0 firewalls changed", Text: "Error: failed to fetch Cloudflare IPs"}
+	if err := email.Send(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	session := strings.Join(<-received, "\n")
+	for _, expected := range []string{
+		"MAIL FROM:<allowlister@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<security@example.com>",
+		"From: Allowlister <allowlister@example.com>",
+		"To: ops@example.com, security@example.com",
+		"Subject: [production] Firewall update failed, 0 firewalls changed",
+		"Error: failed to fetch Cloudflare IPs",
+	} {
+		if !strings.Contains(session, expected) {
+			t.Errorf("expected the SMTP session to contain %q, got:\n%s", expected, session)
+		}
+	}
+}
+
+func TestEmailRequiresStartTLS(t *testing.T) {
+	host, port, _ := smtpServer(t, false)
+	email := NewEmail(host, port, SMTPStartTLS, "", "", "allowlister@example.com", []string{"ops@example.com"}, zaptest.NewLogger(t))
+
+	err := email.Send(context.Background(), Message{Title: "hello"})
+	if err == nil || !strings.Contains(err.Error(), "does not offer STARTTLS") {
+		t.Errorf("expected a server without STARTTLS to be refused, got %v", err)
+	}
+}
+
+func TestDefaultSMTPPort(t *testing.T) {
+	for mode, expected := range map[string]int{SMTPStartTLS: 587, SMTPTLS: 465, SMTPNone: 25, "": 587} {
+		if port := DefaultSMTPPort(mode); port != expected {
+			t.Errorf("expected port %d for %q, got %d", expected, mode, port)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+)
+
+// Severities of run notifications, in increasing order; SeverityNone is above every notification
+// and so filters all of them out
+const (
+	SeverityChange  = "change"
+	SeverityFailure = "failure"
+	SeverityNone    = "none"
+)
+
+// severityRanks orders the severities
+var severityRanks = map[string]int{SeverityChange: 0, SeverityFailure: 1, SeverityNone: 2}
+
+// Severity returns the severity of the run: failure for failed runs, change otherwise
+func (r *Run) Severity() string {
+	if r.Failed() {
+		return SeverityFailure
+	}
+	return SeverityChange
+}
+
+// Filter selects the notifications a channel receives by severity, with a stricter threshold
+// during quiet hours
+type Filter struct {
+	// MinSeverity is the lowest severity passed on; empty passes every notification
+	MinSeverity string
+	// QuietOpen and QuietClose are the cron expressions beginning and ending quiet hours, in
+	// Location; empty disables quiet hours
+	QuietOpen  string
+	QuietClose string
+	// QuietMinSeverity is the lowest severity passed on during quiet hours, failure when empty
+	QuietMinSeverity string
+	Location         *time.Location
+}
+
+// filtered passes on the notifications its filter selects
+type filtered struct {
+	channel Channel
+	filter  Filter
+}
+
+// Filtered returns a channel sending the notifications filter selects to channel
+func Filtered(channel Channel, filter Filter) Channel {
+	if filter.Location == nil {
+		filter.Location = time.UTC
+	}
+	return filtered{channel: channel, filter: filter}
+}
+
+// FailuresOnly returns a channel sending only the notifications of failed runs to channel
+func FailuresOnly(channel Channel) Channel {
+	return Filtered(channel, Filter{MinSeverity: SeverityFailure})
+}
+
+func (f filtered) Send(ctx context.Context, msg Message) error {
+	// Only runs have a severity; the rest is sent unless the filter asks for failures
+	severity, at := SeverityChange, time.Now()
+	if msg.Run != nil {
+		severity, at = msg.Run.Severity(), msg.Run.FinishedAt
+	}
+	if !f.filter.Passes(severity, at) {
+		return nil
+	}
+	return f.channel.Send(ctx, msg)
+}
+
+// Passes reports whether a notification of severity sent at the given time passes the filter
+func (f Filter) Passes(severity string, at time.Time) bool {
+	threshold := f.MinSeverity
+	if f.QuietOpen != "" && f.QuietClose != "" {
+		loc := f.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		// The schedules are validated on load, an invalid one disables quiet hours
+		if quiet, err := scheduler.InWindow(f.QuietOpen, f.QuietClose, loc, at); err == nil && quiet {
+			quietThreshold := f.QuietMinSeverity
+			if quietThreshold == "" {
+				quietThreshold = SeverityFailure
+			}
+			if severityRanks[quietThreshold] > severityRanks[threshold] {
+				threshold = quietThreshold
+			}
+		}
+	}
+	return severityRanks[severity] >= severityRanks[threshold]
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFilterPasses(t *testing.T) {
+	night := time.Date(2025, 1, 8, 23, 30, 0, 0, time.UTC)
+	day := time.Date(2025, 1, 8, 11, 0, 0, 0, time.UTC)
+	quiet := Filter{QuietOpen: "0 22 * * *", QuietClose: "0 7 * * *"}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		severity string
+		at       time.Time
+		expected bool
+	}{
+		{name: "no filter", severity: SeverityChange, at: night, expected: true},
+		{name: "change below threshold", filter: Filter{MinSeverity: SeverityFailure}, severity: SeverityChange, at: day},
+		{name: "failure at threshold", filter: Filter{MinSeverity: SeverityFailure}, severity: SeverityFailure, at: day, expected: true},
+		{name: "change outside quiet hours", filter: quiet, severity: SeverityChange, at: day, expected: true},
+		{name: "change during quiet hours", filter: quiet, severity: SeverityChange, at: night},
+		{name: "failure during quiet hours", filter: quiet, severity: SeverityFailure, at: night, expected: true},
+		{
+			name:     "muted quiet hours",
+			filter:   Filter{QuietOpen: "0 22 * * *", QuietClose: "0 7 * * *", QuietMinSeverity: SeverityNone},
+			severity: SeverityFailure,
+			at:       night,
+		},
+		{
+			name:     "quiet hours in the location",
+			filter:   Filter{QuietOpen: "0 22 * * *", QuietClose: "0 7 * * *", Location: time.FixedZone("UTC+12", 12*3600)},
+			severity: SeverityChange,
+			at:       day, // 23:00 at UTC+12
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if passes := tt.filter.Passes(tt.severity, tt.at); passes != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, passes)
+			}
+		})
+	}
+}
+
+func TestFilteredUsesRunTime(t *testing.T) {
+	failing := &failingChannel{}
+	channel := Filtered(failing, Filter{QuietOpen: "0 22 * * *", QuietClose: "0 7 * * *"})
+
+	night := time.Date(2025, 1, 8, 23, 30, 0, 0, time.UTC)
+	_ = channel.Send(context.Background(), Message{Run: &Run{Status: RunSucceeded, FinishedAt: night}})
+	if failing.sent != 0 {
+		t.Errorf("expected the change summary of a night run to be held back, got %d sends", failing.sent)
+	}
+	_ = channel.Send(context.Background(), Message{Run: &Run{Status: RunSucceeded, FinishedAt: night.Add(12 * time.Hour)}})
+	if failing.sent != 1 {
+		t.Errorf("expected the change summary of a day run to be sent, got %d sends", failing.sent)
+	}
+}
+
+func TestFailuresOnly(t *testing.T) {
+	failing := &failingChannel{}
+	channel := FailuresOnly(failing)
+
+	_ = channel.Send(context.Background(), Message{Run: &Run{Status: RunSucceeded}})
+	_ = channel.Send(context.Background(), Message{Text: "digest"})
+	if failing.sent != 0 {
+		t.Errorf("expected succeeded runs and other notifications to be left out, got %d sends", failing.sent)
+	}
+	if err := channel.Send(context.Background(), Message{Run: &Run{Status: RunFailed}}); err == nil || failing.sent != 1 {
+		t.Errorf("expected the failed run to be sent, got %d sends and %v", failing.sent, err)
+	}
+}
@@ -0,0 +1,316 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSummarize(t *testing.T) {
+	from := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	records := []audit.Record{
+		{Time: from.Add(-time.Minute), Action: "update_inbound_rules", Added: []string{"tcp/22 192.0.2.1"}},
+		{Time: from.Add(time.Hour), Action: "update_inbound_rules", FirewallName: "web",
+			Added: []string{"tcp/443 203.0.113.5", "tcp/443 198.51.100.7"}},
+		{Time: from.Add(2 * time.Hour), Action: "update_inbound_rules",
+			Added: []string{"tcp/443 198.51.100.8"}, Removed: []string{"tcp/443 198.51.100.7", "tcp/443 10.0.0.1"}},
+		{Time: from.Add(3 * time.Hour), Action: "lockdown"},
+		{Time: to, Action: "update_inbound_rules", Added: []string{"tcp/22 192.0.2.2"}},
+	}
+
+	digest := Summarize("fw-1", records, from, to)
+
+	if digest.Changes != 3 {
+		t.Errorf("expected 3 changes in the period, got %d", digest.Changes)
+	}
+	if digest.Actions["update_inbound_rules"] != 2 || digest.Actions["lockdown"] != 1 {
+		t.Errorf("unexpected action counts: %v", digest.Actions)
+	}
+	if digest.FirewallName != "web" {
+		t.Errorf("expected firewall name web, got %s", digest.FirewallName)
+	}
+
+	expectedAdded := []string{"tcp/443 198.51.100.8", "tcp/443 203.0.113.5"}
+	if fmt.Sprint(digest.Added) != fmt.Sprint(expectedAdded) {
+		t.Errorf("expected net added %v, got %v", expectedAdded, digest.Added)
+	}
+	if fmt.Sprint(digest.Removed) != fmt.Sprint([]string{"tcp/443 10.0.0.1"}) {
+		t.Errorf("expected net removed [tcp/443 10.0.0.1], got %v", digest.Removed)
+	}
+
+	text := digest.Text()
+	if !strings.Contains(text, "web (fw-1)") || !strings.Contains(text, "3 changes applied") {
+		t.Errorf("unexpected digest text: %s", text)
+	}
+}
+
+func TestDigestTextNoChanges(t *testing.T) {
+	from := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+	digest := Summarize("fw-1", nil, from, from.Add(24*time.Hour))
+
+	if !strings.Contains(digest.Text(), "No changes") {
+		t.Errorf("expected a no-changes message, got %s", digest.Text())
+	}
+}
+
+func TestDigestTextTruncatesAddresses(t *testing.T) {
+	from := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+	record := audit.Record{Time: from.Add(time.Hour), Action: "update_inbound_rules"}
+	for i := 0; i < maxListedAddresses+5; i++ {
+		record.Added = append(record.Added, fmt.Sprintf("tcp/443 203.0.113.%d", i))
+	}
+
+	text := Summarize("fw-1", []audit.Record{record}, from, from.Add(24*time.Hour)).Text()
+	if !strings.Contains(text, "and 5 more") {
+		t.Errorf("expected the added list to be truncated, got %s", text)
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	var received Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected JSON content type, got %s", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	webhook := NewWebhook(srv.URL, zaptest.NewLogger(t))
+	digest := &Digest{FirewallID: "fw-1", Changes: 2}
+	if err := webhook.Send(context.Background(), Message{Text: "hello", Digest: digest}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if received.Text != "hello" || received.Digest == nil || received.Digest.Changes != 2 {
+		t.Errorf("unexpected payload: %+v", received)
+	}
+}
+
+func TestWebhookSendError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("no_service"))
+	}))
+	defer srv.Close()
+
+	err := NewWebhook(srv.URL, zaptest.NewLogger(t)).Send(context.Background(), Message{Text: "hello"})
+	if err == nil || !strings.Contains(err.Error(), "no_service") {
+		t.Errorf("expected error with response body, got %v", err)
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	digest := &Digest{FirewallID: "fw-1", FirewallName: "web", Changes: 2, Added: []string{"tcp/443 203.0.113.5"}}
+	data := TemplateData{
+		Kind:         KindDigest,
+		Environment:  "production",
+		FirewallID:   "fw-1",
+		FirewallName: "web",
+		Changes:      digest.Changes,
+		Added:        digest.Added,
+		Removed:      []string{"tcp/443 10.0.0.1", "tcp/443 10.0.0.2"},
+		Digest:       digest,
+		Title:        "default title",
+		Text:         "default text",
+	}
+
+	tests := []struct {
+		name     string
+		title    string
+		body     string
+		expected Message
+	}{
+		{name: "default wording", expected: Message{Title: "default title", Text: "default text"}},
+		{
+			name:     "custom title",
+			title:    "[{{ upper .Environment }}] {{ .FirewallName }}: {{ .Changes }} changes",
+			expected: Message{Title: "[PRODUCTION] web: 2 changes", Text: "default text"},
+		},
+		{
+			name:     "custom body",
+			body:     "{{ .Text }}\n{{ range limit 1 .Removed }}- {{ . }}\n{{ end }}+{{ len .Added }} -{{ len .Removed }}\n",
+			expected: Message{Title: "default title", Text: "default text\n- tcp/443 10.0.0.1\n+1 -2"},
+		},
+		{
+			name:     "joined lists",
+			title:    "{{ .Kind }}",
+			body:     `{{ join ", " .Digest.Added }}`,
+			expected: Message{Title: "digest", Text: "tcp/443 203.0.113.5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.title, tt.body)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			msg, err := tmpl.Render(data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if msg != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, msg)
+			}
+		})
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	if _, err := ParseTemplate("{{ .FirewallName", ""); err == nil || !strings.Contains(err.Error(), "title template") {
+		t.Errorf("expected a title parse error, got %v", err)
+	}
+	if _, err := ParseTemplate("", "{{ nosuchfunc }}"); err == nil || !strings.Contains(err.Error(), "body template") {
+		t.Errorf("expected a body parse error, got %v", err)
+	}
+
+	tmpl, err := ParseTemplate("", "{{ .Digest.Changes }}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := tmpl.Render(TemplateData{Kind: KindSourceSizeAlert}); err == nil {
+		t.Error("expected rendering a digest field of an alert to fail")
+	}
+}
+
+func TestWebhookSendTitle(t *testing.T) {
+	var received Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer srv.Close()
+
+	err := NewWebhook(srv.URL, zaptest.NewLogger(t)).Send(context.Background(), Message{Title: "Digest", Text: "2 changes"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received.Title != "Digest" || received.Text != "Digest\n2 changes" {
+		t.Errorf("expected the title as the first line of the text, got %+v", received)
+	}
+}
+
+func TestRunText(t *testing.T) {
+	run := &Run{
+		Status: RunFailed,
+		Firewalls: []RunFirewall{
+			{FirewallID: "fw-1", FirewallName: "web", Outcome: "updated", Added: []string{"tcp/443 203.0.113.5"}, Removed: []string{}},
+			{FirewallID: "fw-2", Outcome: RunFailed, Error: "rate limited"},
+		},
+		Error: "failed to update 1 of 2 firewalls",
+	}
+
+	if run.Changed() != 1 {
+		t.Errorf("expected 1 changed firewall, got %d", run.Changed())
+	}
+	if title := run.Title("production"); title != "[production] Firewall update failed, 1 firewalls changed" {
+		t.Errorf("unexpected title: %s", title)
+	}
+	body := run.Body()
+	if !strings.Contains(body, "web (fw-1): 1 rule entries added, 0 removed\nAdded: tcp/443 203.0.113.5") ||
+		!strings.Contains(body, "fw-2: failed: rate limited") {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	// A run failing before any firewall reports its error
+	collection := &Run{Status: RunFailed, Error: "failed to fetch Cloudflare IPs"}
+	if body := collection.Body(); body != "Error: failed to fetch Cloudflare IPs" {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestWebhookFormats(t *testing.T) {
+	msg := Message{Title: "Firewall update failed", Text: "fw-1: failed\nfw-2: failed", Run: &Run{Status: RunFailed}}
+
+	tests := []struct {
+		format   string
+		expected map[string]any
+	}{
+		{format: FormatSlack, expected: map[string]any{"text": "*Firewall update failed*\nfw-1: failed\nfw-2: failed"}},
+		{format: FormatDiscord, expected: map[string]any{"content": "**Firewall update failed**\nfw-1: failed\nfw-2: failed"}},
+		{format: FormatTeams, expected: map[string]any{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    "Firewall update failed",
+			"title":      "Firewall update failed",
+			"text":       "fw-1: failed\n\nfw-2: failed",
+			"themeColor": "E01E5A",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var received map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewDecoder(r.Body).Decode(&received)
+			}))
+			defer srv.Close()
+
+			if err := NewWebhook(srv.URL, zaptest.NewLogger(t), WithFormat(tt.format)).Send(context.Background(), msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(received) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, received)
+			}
+		})
+	}
+}
+
+func TestWebhookDiscordTruncates(t *testing.T) {
+	var received map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer srv.Close()
+
+	msg := Message{Text: strings.Repeat("x", discordMaxContent+100)}
+	if err := NewWebhook(srv.URL, zaptest.NewLogger(t), WithFormat(FormatDiscord)).Send(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len([]rune(received["content"])); n != discordMaxContent {
+		t.Errorf("expected the content cut to %d characters, got %d", discordMaxContent, n)
+	}
+}
+
+// failingChannel is a notification channel that always fails
+type failingChannel struct{ sent int }
+
+func (c *failingChannel) Send(ctx context.Context, msg Message) error {
+	c.sent++
+	return fmt.Errorf("channel down")
+}
+
+func TestDispatcher(t *testing.T) {
+	var received Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer srv.Close()
+
+	failing := &failingChannel{}
+	dispatcher := NewDispatcher(zaptest.NewLogger(t), failing, NewWebhook(srv.URL, zaptest.NewLogger(t)))
+	err := dispatcher.Dispatch(context.Background(), Message{Text: "hello", Run: &Run{Status: RunSucceeded}})
+	if err == nil || !strings.Contains(err.Error(), "channel down") {
+		t.Errorf("expected the failing channel's error, got %v", err)
+	}
+	if failing.sent != 1 || received.Text != "hello" || received.Run == nil {
+		t.Errorf("expected every channel to be sent to, got %d sends and %+v", failing.sent, received)
+	}
+
+	var disabled *Dispatcher
+	if disabled.Enabled() || NewDispatcher(zaptest.NewLogger(t)).Enabled() {
+		t.Error("expected a dispatcher without channels to be disabled")
+	}
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KindRun is the kind of the notifications sent after a scheduled firewall update run
+const KindRun = "run"
+
+// Run statuses
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// Run is the result of a scheduled firewall update run
+type Run struct {
+	Status     string        `json:"status"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Firewalls  []RunFirewall `json:"firewalls"`
+	// Error is why the run failed, including every failed firewall
+	Error string `json:"error,omitempty"`
+}
+
+// RunFirewall is what a run did to one firewall it changed or failed to update
+type RunFirewall struct {
+	FirewallID   string `json:"firewall_id"`
+	FirewallName string `json:"firewall_name,omitempty"`
+	// Outcome is updated or failed
+	Outcome string   `json:"outcome"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Failed reports whether the run failed
+func (r *Run) Failed() bool {
+	return r.Status == RunFailed
+}
+
+// Changed returns how many firewalls the run changed
+func (r *Run) Changed() int {
+	changed := 0
+	for _, firewall := range r.Firewalls {
+		if firewall.Outcome != RunFailed {
+			changed++
+		}
+	}
+	return changed
+}
+
+// Added returns the "protocol/port address" entries the run added to every firewall
+func (r *Run) Added() []string {
+	var added []string
+	for _, firewall := range r.Firewalls {
+		added = append(added, firewall.Added...)
+	}
+	return added
+}
+
+// Removed returns the "protocol/port address" entries the run removed from every firewall
+func (r *Run) Removed() []string {
+	var removed []string
+	for _, firewall := range r.Firewalls {
+		removed = append(removed, firewall.Removed...)
+	}
+	return removed
+}
+
+// Title renders the first line of the run message, with the status and the changed firewalls
+func (r *Run) Title(environment string) string {
+	prefix := ""
+	if environment != "" {
+		prefix = fmt.Sprintf("[%s] ", environment)
+	}
+	if r.Failed() {
+		return fmt.Sprintf("%sFirewall update failed, %d firewalls changed", prefix, r.Changed())
+	}
+	return fmt.Sprintf("%sFirewall update succeeded, %d firewalls changed", prefix, r.Changed())
+}
+
+// Body renders the run message after its title: a line per firewall with its bounded address
+// lists, then the error of a failed run
+func (r *Run) Body() string {
+	var b strings.Builder
+	for i, firewall := range r.Firewalls {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		name := firewall.FirewallID
+		if firewall.FirewallName != "" {
+			name = fmt.Sprintf("%s (%s)", firewall.FirewallName, firewall.FirewallID)
+		}
+		if firewall.Outcome == RunFailed {
+			fmt.Fprintf(&b, "%s: failed: %s", name, firewall.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %d rule entries added, %d removed", name, len(firewall.Added), len(firewall.Removed))
+		writeAddresses(&b, "Added", firewall.Added)
+		writeAddresses(&b, "Removed", firewall.Removed)
+	}
+
+	// Collection failures fail the run before any firewall
+	if r.Failed() && len(r.Firewalls) == 0 {
+		fmt.Fprintf(&b, "Error: %s", r.Error)
+	}
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Kinds of notifications besides KindRun, which TemplateData.Kind tells templates apart by
+const (
+	KindDigest          = "digest"
+	KindSourceSizeAlert = "source-size-alert"
+)
+
+// TemplateData is the run context notification templates are executed with
+type TemplateData struct {
+	Kind string
+	// Environment is the deployment the notification comes from, e.g. production
+	Environment  string
+	FirewallID   string
+	FirewallName string
+	Time         time.Time
+	// Changes, Added and Removed are the diff: the applied changes and their net rule entries
+	Changes int
+	Added   []string
+	Removed []string
+	// Digest is the whole change digest, set for digests only
+	Digest *Digest
+	// Run is the result of a scheduled run, with its status and error, set for runs only
+	Run *Run
+	// Alerts are the source size changes, one line per source, set for source size alerts only
+	Alerts []string
+	// Title and Text are the default wording, for templates that only add to it
+	Title string
+	Text  string
+}
+
+// templateFuncs are the functions available to notification templates besides the builtin ones
+var templateFuncs = template.FuncMap{
+	"env":   os.Getenv,
+	"join":  func(sep string, items []string) string { return strings.Join(items, sep) },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// limit returns the first n items, so long diffs do not flood a channel
+	"limit": func(n int, items []string) []string { return items[:min(n, len(items))] },
+	"rfc3339": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+}
+
+// Template words a notification from Go templates for its title and body; an empty template
+// keeps the default wording of that part
+type Template struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// ParseTemplate parses the title and body templates of a notification
+func ParseTemplate(title, body string) (*Template, error) {
+	t := &Template{}
+	var err error
+	if title != "" {
+		if t.title, err = template.New("title").Funcs(templateFuncs).Option("missingkey=error").Parse(title); err != nil {
+			return nil, fmt.Errorf("failed to parse title template: %w", err)
+		}
+	}
+	if body != "" {
+		if t.body, err = template.New("body").Funcs(templateFuncs).Option("missingkey=error").Parse(body); err != nil {
+			return nil, fmt.Errorf("failed to parse body template: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// Render returns the message of the notification; a nil template renders the default wording
+func (t *Template) Render(data TemplateData) (Message, error) {
+	msg := Message{Title: data.Title, Text: data.Text}
+	if t == nil {
+		return msg, nil
+	}
+
+	var err error
+	if t.title != nil {
+		if msg.Title, err = execute(t.title, data); err != nil {
+			return Message{}, fmt.Errorf("failed to render title template: %w", err)
+		}
+	}
+	if t.body != nil {
+		if msg.Text, err = execute(t.body, data); err != nil {
+			return Message{}, fmt.Errorf("failed to render body template: %w", err)
+		}
+	}
+	return msg, nil
+}
+
+// execute runs a template, trimming the surrounding whitespace block templates leave
+func execute(tmpl *template.Template, data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is the JSON payload posted to a generic webhook. Text is understood by Slack, Mattermost
+// and Rocket.Chat incoming webhooks and is sent with the title as its first line; Title, Digest
+// and Run carry the structured notification for other receivers.
+type Message struct {
+	Title  string  `json:"title,omitempty"`
+	Text   string  `json:"text"`
+	Digest *Digest `json:"digest,omitempty"`
+	Run    *Run    `json:"run,omitempty"`
+}
+
+// Webhook payload formats
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+	FormatDiscord = "discord"
+	FormatTeams   = "teams"
+)
+
+// discordMaxContent is the longest message content Discord accepts
+const discordMaxContent = 2000
+
+// Webhook posts messages to an incoming webhook URL
+type Webhook struct {
+	url        string
+	format     string
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// WebhookOption configures a Webhook
+type WebhookOption func(*Webhook)
+
+// WithFormat posts messages in the payload format of a chat service; empty keeps the generic one
+func WithFormat(format string) WebhookOption {
+	return func(w *Webhook) {
+		if format != "" {
+			w.format = format
+		}
+	}
+}
+
+// NewWebhook creates a webhook client posting to url
+func NewWebhook(url string, logger *zap.Logger, opts ...WebhookOption) *Webhook {
+	w := &Webhook{
+		url:        url,
+		format:     FormatGeneric,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     logger.Named("notify"),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Send posts the message, failing on any non-2xx response
+func (w *Webhook) Send(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(w.payload(msg))
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to send notification: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	w.logger.Debug("Sent notification", zap.String("format", w.format), zap.Int("status", resp.StatusCode))
+	return nil
+}
+
+// payload returns the message in the webhook's format
+func (w *Webhook) payload(msg Message) any {
+	switch w.format {
+	case FormatSlack:
+		return map[string]string{"text": joinTitle("*"+msg.Title+"*", msg.Title, msg.Text)}
+	case FormatDiscord:
+		content := []rune(joinTitle("**"+msg.Title+"**", msg.Title, msg.Text))
+		if len(content) > discordMaxContent {
+			content = append(content[:discordMaxContent-1], '…')
+		}
+		return map[string]string{"content": string(content)}
+	case FormatTeams:
+		// An Office 365 connector card; its text is markdown, where a line break needs an empty line
+		card := map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  msg.Title,
+			"title":    msg.Title,
+			"text":     strings.ReplaceAll(msg.Text, "\n", "\n\n"),
+		}
+		if msg.Run != nil {
+			card["themeColor"] = "2EB67D"
+			if msg.Run.Failed() {
+				card["themeColor"] = "E01E5A"
+			}
+		}
+		if card["summary"] == "" {
+			card["summary"] = "do-firewall-allowlister notification"
+		}
+		return card
+	default:
+		msg.Text = joinTitle(msg.Title, msg.Title, msg.Text)
+		return msg
+	}
+}
+
+// joinTitle returns the text with the formatted title as its first line, or only the text when
+// there is no title
+func joinTitle(formatted, title, text string) string {
+	if title == "" {
+		return text
+	}
+	return strings.TrimSpace(formatted + "\n" + text)
+}
@@ -0,0 +1,260 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/export"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"go.uber.org/zap"
+)
+
+// Diff describes how an allowlist changed since the previously published one
+type Diff struct {
+	PublishedAt   time.Time `json:"published_at"`
+	PreviousCount int       `json:"previous_count"`
+	Count         int       `json:"count"`
+	Added         []string  `json:"added"`
+	Removed       []string  `json:"removed"`
+}
+
+// Publisher uploads computed allowlists and their diffs to a DigitalOcean Spaces or S3 bucket.
+//
+// Every changed allowlist is written under <prefix>/current/ and kept as a version under
+// <prefix>/history/<timestamp>/ alongside a diff against the previous version.
+type Publisher struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	prefix     string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+	logger     *zap.Logger
+	now        func() time.Time
+	signer     *signing.Signer
+
+	previous []export.Entry
+	loaded   bool
+}
+
+// NewPublisher creates a publisher for the bucket at the S3-compatible endpoint,
+// e.g. https://nyc3.digitaloceanspaces.com
+func NewPublisher(endpoint, region, bucket, prefix, accessKey, secretKey string, logger *zap.Logger) (*Publisher, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid publish endpoint %s: must be an http(s) URL", endpoint)
+	}
+
+	return &Publisher{
+		endpoint:   u,
+		region:     region,
+		bucket:     bucket,
+		prefix:     strings.Trim(prefix, "/"),
+		accessKey:  accessKey,
+		secretKey:  secretKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     logger.Named("publish"),
+		now:        time.Now,
+	}, nil
+}
+
+// SetSigner uploads a signature next to every allowlist and diff object
+func (p *Publisher) SetSigner(signer *signing.Signer) {
+	p.signer = signer
+}
+
+// Publish uploads the allowlist if it differs from the previously published one
+func (p *Publisher) Publish(ctx context.Context, entries []export.Entry) error {
+	if !p.loaded {
+		previous, err := p.loadCurrent(ctx)
+		if err != nil {
+			return err
+		}
+		p.previous = previous
+		p.loaded = true
+	}
+
+	diff := diffEntries(p.previous, entries)
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 && p.previous != nil {
+		p.logger.Debug("Allowlist unchanged, skipping upload")
+		return nil
+	}
+
+	now := p.now().UTC()
+	diff.PublishedAt = now
+
+	var txt, doc bytes.Buffer
+	if err := export.Render(&txt, export.FormatPlain, entries, export.Options{}); err != nil {
+		return fmt.Errorf("failed to render allowlist: %w", err)
+	}
+	if err := export.Render(&doc, export.FormatJSON, entries, export.Options{}); err != nil {
+		return fmt.Errorf("failed to render allowlist: %w", err)
+	}
+	diffData, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode allowlist diff: %w", err)
+	}
+
+	// History first, so current never points at a version that was not stored
+	version := p.key("history", now.Format("20060102T150405Z"))
+	objects := []struct {
+		key         string
+		body        []byte
+		contentType string
+	}{
+		{version + "/allowlist.json", doc.Bytes(), "application/json"},
+		{version + "/diff.json", append(diffData, '\n'), "application/json"},
+		{p.key("current", "allowlist.txt"), txt.Bytes(), "text/plain; charset=utf-8"},
+		{p.key("current", "allowlist.json"), doc.Bytes(), "application/json"},
+	}
+	for _, object := range objects {
+		if err := p.putObject(ctx, object.key, object.body, object.contentType); err != nil {
+			return err
+		}
+		if p.signer == nil {
+			continue
+		}
+
+		sig, err := p.signer.Sign(path.Base(object.key), object.body)
+		if err != nil {
+			return err
+		}
+		if err := p.putObject(ctx, object.key+p.signer.Extension(), sig, "text/plain; charset=utf-8"); err != nil {
+			return err
+		}
+	}
+
+	p.previous = entries
+	p.logger.Info("Published allowlist",
+		zap.String("bucket", p.bucket),
+		zap.String("version", version),
+		zap.Int("count", diff.Count),
+		zap.Int("added", len(diff.Added)),
+		zap.Int("removed", len(diff.Removed)))
+	return nil
+}
+
+// key joins the prefix and path elements into an object key
+func (p *Publisher) key(elements ...string) string {
+	if p.prefix != "" {
+		elements = append([]string{p.prefix}, elements...)
+	}
+	return strings.Join(elements, "/")
+}
+
+// loadCurrent fetches the currently published allowlist, returning nil if none exists yet
+func (p *Publisher) loadCurrent(ctx context.Context) ([]export.Entry, error) {
+	data, err := p.getObject(ctx, p.key("current", "allowlist.json"))
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var doc export.Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		p.logger.Warn("Ignoring unreadable published allowlist", zap.Error(err))
+		return nil, nil
+	}
+	return doc.Entries, nil
+}
+
+// putObject uploads an object to the bucket
+func (p *Publisher) putObject(ctx context.Context, key string, body []byte, contentType string) error {
+	req, err := p.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	signV4(req, sha256Hex(body), p.accessKey, p.secretKey, p.region, p.now())
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to upload %s: %s", key, responseError(resp))
+	}
+	return nil
+}
+
+// getObject downloads an object from the bucket, returning nil if it does not exist
+func (p *Publisher) getObject(ctx context.Context, key string) ([]byte, error) {
+	req, err := p.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	signV4(req, emptyPayloadHash, p.accessKey, p.secretKey, p.region, p.now())
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s: %w", key, err)
+		}
+		return data, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to download %s: %s", key, responseError(resp))
+	}
+}
+
+// newRequest creates a path-style request for the object key
+func (p *Publisher) newRequest(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	u := *p.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + p.bucket + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", key, err)
+	}
+	return req, nil
+}
+
+// responseError describes an unexpected response, including the start of the S3 error body
+func responseError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if len(body) == 0 {
+		return resp.Status
+	}
+	return fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// diffEntries returns the addresses added and removed between two allowlists
+func diffEntries(previous, current []export.Entry) Diff {
+	diff := Diff{PreviousCount: len(previous), Count: len(current), Added: []string{}, Removed: []string{}}
+
+	before := make(map[string]bool, len(previous))
+	for _, entry := range previous {
+		before[entry.Address] = true
+	}
+	after := make(map[string]bool, len(current))
+	for _, entry := range current {
+		after[entry.Address] = true
+		if !before[entry.Address] {
+			diff.Added = append(diff.Added, entry.Address)
+		}
+	}
+	for _, entry := range previous {
+		if !after[entry.Address] {
+			diff.Removed = append(diff.Removed, entry.Address)
+		}
+	}
+	return diff
+}
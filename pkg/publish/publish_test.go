@@ -0,0 +1,200 @@
+package publish
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/export"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeBucket is an in-memory stand-in for an S3 bucket using path-style requests
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		b.objects[key] = data
+		b.puts++
+	case http.MethodGet:
+		data, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}
+}
+
+func newTestPublisher(t *testing.T, bucket *fakeBucket) *Publisher {
+	t.Helper()
+
+	srv := httptest.NewServer(bucket)
+	t.Cleanup(srv.Close)
+
+	p, err := NewPublisher(srv.URL, "us-east-1", "bucket", "allowlist", "key", "secret", zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	p.now = func() time.Time { return time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC) }
+	return p
+}
+
+func TestPublish(t *testing.T) {
+	bucket := &fakeBucket{objects: make(map[string][]byte)}
+	p := newTestPublisher(t, bucket)
+	ctx := context.Background()
+
+	first := []export.Entry{
+		{Address: "173.245.48.0/20", Source: "cloudflare"},
+		{Address: "203.0.113.5", Source: "netdata"},
+	}
+	if err := p.Publish(ctx, first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, key := range []string{
+		"allowlist/current/allowlist.txt",
+		"allowlist/current/allowlist.json",
+		"allowlist/history/20250108T100000Z/allowlist.json",
+		"allowlist/history/20250108T100000Z/diff.json",
+	} {
+		if _, ok := bucket.objects[key]; !ok {
+			t.Errorf("expected object %s to be uploaded", key)
+		}
+	}
+	if string(bucket.objects["allowlist/current/allowlist.txt"]) != "173.245.48.0/20\n203.0.113.5\n" {
+		t.Errorf("unexpected current allowlist: %q", bucket.objects["allowlist/current/allowlist.txt"])
+	}
+
+	// Unchanged allowlists are not uploaded again
+	puts := bucket.puts
+	if err := p.Publish(ctx, first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bucket.puts != puts {
+		t.Errorf("expected no upload for an unchanged allowlist, got %d", bucket.puts-puts)
+	}
+
+	// A restarted publisher diffs against the published allowlist
+	p = newTestPublisher(t, bucket)
+	p.now = func() time.Time { return time.Date(2025, 1, 8, 11, 0, 0, 0, time.UTC) }
+	second := []export.Entry{
+		{Address: "173.245.48.0/20", Source: "cloudflare"},
+		{Address: "198.51.100.7", Source: "netdata"},
+	}
+	if err := p.Publish(ctx, second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var diff Diff
+	if err := json.Unmarshal(bucket.objects["allowlist/history/20250108T110000Z/diff.json"], &diff); err != nil {
+		t.Fatalf("failed to decode diff: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0] != "198.51.100.7" {
+		t.Errorf("expected 198.51.100.7 added, got %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0] != "203.0.113.5" {
+		t.Errorf("expected 203.0.113.5 removed, got %v", diff.Removed)
+	}
+	if diff.PreviousCount != 2 || diff.Count != 2 {
+		t.Errorf("unexpected counts in diff: %+v", diff)
+	}
+}
+
+func TestPublishSigned(t *testing.T) {
+	bucket := &fakeBucket{objects: make(map[string][]byte)}
+	p := newTestPublisher(t, bucket)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	signer, err := signing.NewSigner(signing.FormatCosign, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.SetSigner(signer)
+
+	if err := p.Publish(context.Background(), []export.Entry{{Address: "203.0.113.5", Source: "netdata"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, object := range []string{
+		"allowlist/current/allowlist.txt",
+		"allowlist/current/allowlist.json",
+		"allowlist/history/20250108T100000Z/allowlist.json",
+		"allowlist/history/20250108T100000Z/diff.json",
+	} {
+		sig, err := base64.StdEncoding.DecodeString(string(bucket.objects[object+".sig"]))
+		if err != nil || len(sig) == 0 {
+			t.Errorf("expected signature of %s to be uploaded", object)
+			continue
+		}
+		digest := sha256.Sum256(bucket.objects[object])
+		if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+			t.Errorf("expected signature of %s to verify", object)
+		}
+	}
+}
+
+func TestPublishUploadError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("<Error><Code>AccessDenied</Code></Error>"))
+	}))
+	defer srv.Close()
+
+	p, err := NewPublisher(srv.URL, "us-east-1", "bucket", "", "key", "secret", zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+
+	err = p.Publish(context.Background(), []export.Entry{{Address: "203.0.113.5", Source: "netdata"}})
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("expected AccessDenied error, got %v", err)
+	}
+}
+
+func TestNewPublisherInvalidEndpoint(t *testing.T) {
+	if _, err := NewPublisher("nyc3.digitaloceanspaces.com", "us-east-1", "bucket", "", "key", "secret", zaptest.NewLogger(t)); err == nil {
+		t.Error("expected error for an endpoint without scheme")
+	}
+}
@@ -0,0 +1,75 @@
+// Package retrybudget bounds the time a run spends waiting between retries, shared by the retries
+// of every source and DigitalOcean API call of the run, so a flaky upstream cannot stretch a
+// scheduled run far past its usual duration
+package retrybudget
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrExhausted is returned by retry loops stopping early because the run spent its retry budget
+var ErrExhausted = errors.New("retry budget of the run exhausted")
+
+// Budget is the backoff time left to the retries of one run
+type Budget struct {
+	mu        sync.Mutex
+	remaining time.Duration
+}
+
+// New creates a budget allowing limit of backoff in total
+func New(limit time.Duration) *Budget {
+	return &Budget{remaining: limit}
+}
+
+// Take consumes wait from the budget, reporting false and consuming nothing when less than wait
+// is left
+func (b *Budget) Take(wait time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wait > b.remaining {
+		return false
+	}
+	b.remaining -= wait
+	return true
+}
+
+// Remaining returns the backoff time left
+func (b *Budget) Remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remaining
+}
+
+// budgetKey is the context key of the retry budget
+type budgetKey struct{}
+
+// WithBudget returns a context holding a new budget of limit, or ctx itself if it already holds
+// one or limit is not positive, which leaves the retries unbounded
+func WithBudget(ctx context.Context, limit time.Duration) context.Context {
+	if limit <= 0 {
+		return ctx
+	}
+	if _, ok := ctx.Value(budgetKey{}).(*Budget); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetKey{}, New(limit))
+}
+
+// FromContext returns the budget of ctx, if any
+func FromContext(ctx context.Context) (*Budget, bool) {
+	b, ok := ctx.Value(budgetKey{}).(*Budget)
+	return b, ok
+}
+
+// Take consumes wait from the budget of ctx before a retry waits it out, reporting false when the
+// retry must not happen; it always allows the retry when ctx holds no budget
+func Take(ctx context.Context, wait time.Duration) bool {
+	b, ok := FromContext(ctx)
+	if !ok {
+		return true
+	}
+	return b.Take(wait)
+}
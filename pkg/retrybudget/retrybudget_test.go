@@ -0,0 +1,78 @@
+package retrybudget
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBudgetTake(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         time.Duration
+		waits         []time.Duration
+		expected      []bool
+		expectedSpare time.Duration
+	}{
+		{name: "waits within the budget", limit: 10 * time.Second, waits: []time.Duration{2 * time.Second, 3 * time.Second}, expected: []bool{true, true}, expectedSpare: 5 * time.Second},
+		{name: "exact budget", limit: 5 * time.Second, waits: []time.Duration{5 * time.Second, 0}, expected: []bool{true, true}},
+		{name: "wait over the rest is refused", limit: 5 * time.Second, waits: []time.Duration{4 * time.Second, 2 * time.Second, time.Second}, expected: []bool{true, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(tt.limit)
+			for i, wait := range tt.waits {
+				if got := b.Take(wait); got != tt.expected[i] {
+					t.Errorf("wait %d: expected %v, got %v", i, tt.expected[i], got)
+				}
+			}
+			if got := b.Remaining(); got != tt.expectedSpare {
+				t.Errorf("expected %s remaining, got %s", tt.expectedSpare, got)
+			}
+		})
+	}
+}
+
+func TestTakeFromContext(t *testing.T) {
+	if !Take(context.Background(), time.Hour) {
+		t.Error("expected retries without a budget to be allowed")
+	}
+	if _, ok := FromContext(WithBudget(context.Background(), 0)); ok {
+		t.Error("expected no budget for a zero limit")
+	}
+
+	ctx := WithBudget(context.Background(), time.Second)
+	// A nested run keeps the budget of the outer one
+	nested := WithBudget(ctx, time.Hour)
+	if !Take(nested, time.Second) {
+		t.Fatal("expected the first wait to fit the budget")
+	}
+	if Take(ctx, time.Millisecond) {
+		t.Error("expected the budget to be shared with the nested context")
+	}
+}
+
+func TestBudgetConcurrentTake(t *testing.T) {
+	b := New(100 * time.Millisecond)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.Take(10 * time.Millisecond) {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Errorf("expected 10 waits allowed, got %d", allowed)
+	}
+}
@@ -0,0 +1,140 @@
+package scheduler
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"go.uber.org/zap/zaptest"
+)
+
+// newTestScheduler creates a scheduler on a fake clock, which also drives the missed-run watcher
+func newTestScheduler(t *testing.T) (*Scheduler, *clock.Fake) {
+	t.Helper()
+
+	s, err := NewScheduler("UTC", zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	s.SetClock(fake)
+	return s, fake
+}
+
+// waitForGoroutines fails the test unless the goroutine count drops back to baseline
+func waitForGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("expected %d goroutines after Stop, got %d:\n%s", baseline, runtime.NumGoroutine(), buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// blockingJob returns a job signalling started when it runs and blocking until release is closed
+func blockingJob(started chan<- struct{}, release <-chan struct{}) JobFunc {
+	return func(ctx context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	s, _ := newTestScheduler(t)
+	s.SetCatchUp(true)
+	if err := s.AddJob("0 * * * *", "test", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	// A stopped scheduler can be started again without leaking the previous watcher
+	for i := 0; i < 2; i++ {
+		s.Start()
+		s.Stop()
+	}
+	waitForGoroutines(t, baseline)
+}
+
+func TestStopWaitsForCatchUpRuns(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	s, fake := newTestScheduler(t)
+	s.SetCatchUp(true)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	if err := s.AddJob("0 * * * *", "test", blockingJob(started, release)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	s.Start()
+
+	// Jumping past the expected run, as after a suspend, starts a catch-up run once the watcher
+	// ticks
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Hour)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected a catch-up run")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("expected Stop to wait for the running catch-up run")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected Stop to return once the catch-up run finished")
+	}
+	waitForGoroutines(t, baseline)
+
+	if m := s.Metrics()[0]; m.CatchUpRuns != 1 {
+		t.Errorf("expected 1 catch-up run, got %d", m.CatchUpRuns)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	s, fake := newTestScheduler(t)
+	s.SetCatchUp(true)
+	s.stopTimeout = 10 * time.Millisecond
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	if err := s.AddJob("0 * * * *", "test", blockingJob(started, release)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	s.Start()
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Hour)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected a catch-up run")
+	}
+
+	// Stop gives up on a stuck job, which still exits once it completes
+	s.Stop()
+	close(release)
+	waitForGoroutines(t, baseline)
+}
@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// missedRunGrace is how late a job may start before its scheduled run counts as missed
+	missedRunGrace = time.Minute
+	// catchUpInterval is how often the wall clock is checked for missed runs when catch-up is enabled
+	catchUpInterval = 30 * time.Second
+	// stopTimeout is how long Stop waits for running jobs before giving up on them
+	stopTimeout = 30 * time.Second
+)
+
+// JobMetrics describes the timing of a scheduled job's runs
+type JobMetrics struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// Runs counts started runs, including catch-up runs
+	Runs int `json:"runs"`
+	// MissedRuns counts scheduled runs that were skipped entirely, e.g. while the system was suspended
+	MissedRuns int `json:"missed_runs"`
+	// CatchUpRuns counts runs started by the catch-up check rather than the cron schedule
+	CatchUpRuns   int           `json:"catch_up_runs"`
+	LastScheduled time.Time     `json:"last_scheduled,omitempty"`
+	LastStarted   time.Time     `json:"last_started,omitempty"`
+	Next          time.Time     `json:"next"`
+	LastDrift     time.Duration `json:"last_drift"`
+	MaxDrift      time.Duration `json:"max_drift"`
+}
+
+var (
+	// errJobRunning is returned by begin when the previous run has not completed yet
+	errJobRunning = errors.New("previous run still in progress")
+	// errRunHandled is returned by begin when the scheduled run was already started by a catch-up run
+	errRunHandled = errors.New("scheduled run already handled by a catch-up run")
+)
+
+// jobState tracks when a job is expected to run next and the metrics of its past runs
+type jobState struct {
+	mu       sync.Mutex
+	name     string
+	schedule cron.Schedule
+	job      JobFunc
+	next     time.Time
+	running  bool
+	metrics  JobMetrics
+}
+
+// runTiming describes a run accepted by begin
+type runTiming struct {
+	scheduled time.Time
+	drift     time.Duration
+	missed    int
+}
+
+// reset expects the next run at the schedule's first activation after now
+func (j *jobState) reset(now time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.next = j.schedule.Next(now)
+}
+
+// begin records a run starting at now, failing if the job is already running or if the
+// scheduled run it belongs to was already handled by a catch-up run
+func (j *jobState) begin(now time.Time, catchUp bool) (runTiming, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.running {
+		return runTiming{}, errJobRunning
+	}
+	if now.Before(j.next) {
+		return runTiming{}, errRunHandled
+	}
+
+	timing := runTiming{scheduled: j.next, drift: now.Sub(j.next)}
+
+	// Every later activation that has already passed was skipped
+	next := j.schedule.Next(j.next)
+	for !next.After(now) {
+		timing.missed++
+		next = j.schedule.Next(next)
+	}
+	j.next = next
+	j.running = true
+
+	j.metrics.Runs++
+	j.metrics.MissedRuns += timing.missed
+	if catchUp {
+		j.metrics.CatchUpRuns++
+	}
+	j.metrics.LastScheduled = timing.scheduled
+	j.metrics.LastStarted = now
+	j.metrics.LastDrift = timing.drift
+	if timing.drift > j.metrics.MaxDrift {
+		j.metrics.MaxDrift = timing.drift
+	}
+
+	return timing, nil
+}
+
+// finish marks the current run as completed
+func (j *jobState) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.running = false
+}
+
+// overdue reports whether the expected run is more than missedRunGrace late at now
+func (j *jobState) overdue(now time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return !j.running && now.After(j.next.Add(missedRunGrace))
+}
+
+// snapshot returns a copy of the job's metrics
+func (j *jobState) snapshot() JobMetrics {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	metrics := j.metrics
+	metrics.Next = j.next
+	return metrics
+}
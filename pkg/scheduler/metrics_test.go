@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func newTestJobState(t *testing.T, schedule string, from time.Time) *jobState {
+	t.Helper()
+
+	sched, err := cronParser.Parse(schedule)
+	if err != nil {
+		t.Fatalf("failed to parse schedule: %v", err)
+	}
+
+	st := &jobState{name: "test", schedule: sched, metrics: JobMetrics{Name: "test", Schedule: schedule}}
+	st.reset(from)
+	return st
+}
+
+func TestJobStateBegin(t *testing.T) {
+	start := time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC)
+	scheduled := time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		expectErr     error
+		expectDrift   time.Duration
+		expectMissed  int
+		expectNextRun time.Time
+	}{
+		{
+			name:          "on time",
+			now:           scheduled.Add(5 * time.Millisecond),
+			expectDrift:   5 * time.Millisecond,
+			expectNextRun: scheduled.Add(time.Hour),
+		},
+		{
+			name:          "late after suspend",
+			now:           scheduled.Add(3*time.Hour + 30*time.Minute),
+			expectDrift:   3*time.Hour + 30*time.Minute,
+			expectMissed:  3,
+			expectNextRun: scheduled.Add(4 * time.Hour),
+		},
+		{
+			name:      "before the expected run",
+			now:       scheduled.Add(-time.Minute),
+			expectErr: errRunHandled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newTestJobState(t, "0 * * * *", start)
+
+			timing, err := st.begin(tt.now, false)
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !timing.scheduled.Equal(scheduled) {
+				t.Errorf("expected scheduled %s, got %s", scheduled, timing.scheduled)
+			}
+			if timing.drift != tt.expectDrift {
+				t.Errorf("expected drift %s, got %s", tt.expectDrift, timing.drift)
+			}
+			if timing.missed != tt.expectMissed {
+				t.Errorf("expected %d missed runs, got %d", tt.expectMissed, timing.missed)
+			}
+
+			metrics := st.snapshot()
+			if metrics.Runs != 1 || metrics.MissedRuns != tt.expectMissed || metrics.MaxDrift != tt.expectDrift {
+				t.Errorf("unexpected metrics: %+v", metrics)
+			}
+			if !metrics.Next.Equal(tt.expectNextRun) {
+				t.Errorf("expected next run %s, got %s", tt.expectNextRun, metrics.Next)
+			}
+		})
+	}
+}
+
+func TestJobStateBeginWhileRunning(t *testing.T) {
+	start := time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC)
+	st := newTestJobState(t, "0 * * * *", start)
+
+	if _, err := st.begin(start.Add(30*time.Minute), false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := st.begin(start.Add(90*time.Minute), false); !errors.Is(err, errJobRunning) {
+		t.Errorf("expected errJobRunning, got %v", err)
+	}
+
+	st.finish()
+	if _, err := st.begin(start.Add(90*time.Minute), false); err != nil {
+		t.Errorf("unexpected error after finish: %v", err)
+	}
+}
+
+func TestCatchUpMissedRuns(t *testing.T) {
+	s, err := NewScheduler("UTC", zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	ran := make(chan struct{}, 1)
+	if err := s.AddJob("0 * * * *", "test", func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	expected := s.Metrics()[0].Next
+
+	// Within the grace period nothing is caught up
+	s.catchUpMissedRuns(expected.Add(missedRunGrace / 2))
+	select {
+	case <-ran:
+		t.Fatal("expected no catch-up run within the grace period")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	now := expected.Add(2*time.Hour + 10*time.Minute)
+	s.catchUpMissedRuns(now)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("expected a catch-up run")
+	}
+
+	// Wait for the run to be recorded as finished
+	deadline := time.Now().Add(time.Second)
+	for isRunning(s.jobs[0]) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	metrics := s.Metrics()[0]
+	if metrics.Runs != 1 || metrics.CatchUpRuns != 1 {
+		t.Errorf("expected one catch-up run, got %+v", metrics)
+	}
+	if metrics.MissedRuns != 2 {
+		t.Errorf("expected 2 missed runs, got %d", metrics.MissedRuns)
+	}
+	if !metrics.Next.Equal(expected.Add(3 * time.Hour)) {
+		t.Errorf("expected next run %s, got %s", expected.Add(3*time.Hour), metrics.Next)
+	}
+
+	// The delayed cron run for the missed slot is skipped
+	if _, err := s.jobs[0].begin(expected.Add(2*time.Hour+20*time.Minute), false); !errors.Is(err, errRunHandled) {
+		t.Errorf("expected errRunHandled, got %v", err)
+	}
+}
+
+func isRunning(st *jobState) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.running
+}
@@ -2,9 +2,13 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 )
@@ -14,6 +18,18 @@ type Scheduler struct {
 	cron     *cron.Cron
 	logger   *zap.Logger
 	timezone *time.Location
+
+	// clock drives drift tracking and the missed-run watcher; the cron itself always follows
+	// the wall clock. stopTimeout is shortened in tests
+	clock       clock.Clock
+	stopTimeout time.Duration
+
+	mu      sync.Mutex
+	jobs    []*jobState
+	catchUp bool
+	stop    chan struct{}
+	// wg tracks the missed-run watcher and the catch-up runs it starts, which the cron does not
+	wg sync.WaitGroup
 }
 
 // JobFunc represents a function that can be scheduled
@@ -21,7 +37,7 @@ type JobFunc func(ctx context.Context) error
 
 // NewScheduler creates a new scheduler with the specified timezone
 func NewScheduler(timezone string, logger *zap.Logger) (*Scheduler, error) {
-	loc, err := time.LoadLocation(timezone)
+	loc, err := LoadLocation(timezone)
 	if err != nil {
 		return nil, fmt.Errorf("invalid timezone %s: %w", timezone, err)
 	}
@@ -32,9 +48,11 @@ func NewScheduler(timezone string, logger *zap.Logger) (*Scheduler, error) {
 	)
 
 	return &Scheduler{
-		cron:     c,
-		logger:   logger.Named("scheduler"),
-		timezone: loc,
+		cron:        c,
+		logger:      logger.Named("scheduler"),
+		timezone:    loc,
+		clock:       clock.Real,
+		stopTimeout: stopTimeout,
 	}, nil
 }
 
@@ -45,9 +63,7 @@ func (s *Scheduler) AddJob(schedule string, jobName string, job JobFunc) error {
 		zap.String("schedule", schedule),
 		zap.String("timezone", s.timezone.String()))
 
-	wrappedJob := s.wrapJob(jobName, job)
-
-	_, err := s.cron.AddFunc(schedule, wrappedJob)
+	sched, err := cronParser.Parse(schedule)
 	if err != nil {
 		s.logger.Error("Failed to add scheduled job",
 			zap.String("job_name", jobName),
@@ -56,6 +72,20 @@ func (s *Scheduler) AddJob(schedule string, jobName string, job JobFunc) error {
 		return fmt.Errorf("failed to add job %s with schedule %s: %w", jobName, schedule, err)
 	}
 
+	st := &jobState{
+		name:     jobName,
+		schedule: sched,
+		job:      job,
+		metrics:  JobMetrics{Name: jobName, Schedule: schedule},
+	}
+	st.reset(s.clock.Now().In(s.timezone))
+
+	s.cron.Schedule(sched, cron.FuncJob(s.wrapJob(st)))
+
+	s.mu.Lock()
+	s.jobs = append(s.jobs, st)
+	s.mu.Unlock()
+
 	s.logger.Info("Successfully added scheduled job",
 		zap.String("job_name", jobName),
 		zap.String("schedule", schedule))
@@ -63,46 +93,175 @@ func (s *Scheduler) AddJob(schedule string, jobName string, job JobFunc) error {
 	return nil
 }
 
-// wrapJob wraps a JobFunc with logging and error handling
-func (s *Scheduler) wrapJob(jobName string, job JobFunc) func() {
+// wrapJob wraps a scheduled job with drift tracking, logging and error handling
+func (s *Scheduler) wrapJob(st *jobState) func() {
 	return func() {
-		ctx := context.Background()
-
-		s.logger.Info("Starting scheduled job execution", zap.String("job_name", jobName))
-		startTime := time.Now()
-
-		err := job(ctx)
-		duration := time.Since(startTime)
-
-		if err != nil {
-			s.logger.Error("Scheduled job failed",
-				zap.String("job_name", jobName),
-				zap.Duration("duration", duration),
-				zap.Error(err))
-		} else {
-			s.logger.Info("Scheduled job completed successfully",
-				zap.String("job_name", jobName),
-				zap.Duration("duration", duration))
+		s.runJob(st, s.clock.Now(), false)
+	}
+}
+
+// runJob runs a job started at now unless its scheduled run was already handled, recording
+// how late it started
+func (s *Scheduler) runJob(st *jobState, now time.Time, catchUp bool) {
+	jobName := st.name
+	startTime := s.clock.Now()
+
+	timing, err := st.begin(now.In(s.timezone), catchUp)
+	if errors.Is(err, errJobRunning) {
+		s.logger.Warn("Skipping scheduled job", zap.String("job_name", jobName), zap.Error(err))
+		return
+	}
+	if err != nil {
+		s.logger.Debug("Skipping scheduled job", zap.String("job_name", jobName), zap.Error(err))
+		return
+	}
+	defer st.finish()
+
+	fields := []zap.Field{
+		zap.String("job_name", jobName),
+		zap.Time("scheduled_at", timing.scheduled),
+		zap.Duration("drift", timing.drift),
+		zap.Int("missed_runs", timing.missed),
+		zap.Bool("catch_up", catchUp),
+	}
+	if timing.drift > missedRunGrace || timing.missed > 0 {
+		s.logger.Warn("Scheduled job started late, the system may have been suspended", fields...)
+	}
+
+	ctx := context.Background()
+
+	s.logger.Info("Starting scheduled job execution", fields...)
+
+	err = st.job(ctx)
+	duration := s.clock.Now().Sub(startTime)
+
+	if err != nil {
+		s.logger.Error("Scheduled job failed",
+			zap.String("job_name", jobName),
+			zap.Duration("duration", duration),
+			zap.Error(err))
+	} else {
+		s.logger.Info("Scheduled job completed successfully",
+			zap.String("job_name", jobName),
+			zap.Duration("duration", duration))
+	}
+}
+
+// SetClock replaces the wall clock the scheduler reads; set it before adding jobs
+func (s *Scheduler) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetCatchUp enables running a job immediately when its scheduled run was missed
+func (s *Scheduler) SetCatchUp(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.catchUp = enabled
+}
+
+// Metrics returns the timing metrics of every scheduled job
+func (s *Scheduler) Metrics() []JobMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics := make([]JobMetrics, 0, len(s.jobs))
+	for _, st := range s.jobs {
+		metrics = append(metrics, st.snapshot())
+	}
+	return metrics
+}
+
+// watchMissedRuns periodically starts catch-up runs until stop is closed.
+// Timers do not advance while the system is suspended, so the wall clock is compared
+// against each job's expected run instead.
+func (s *Scheduler) watchMissedRuns(stop <-chan struct{}) {
+	defer s.wg.Done()
+
+	ticker := s.clock.NewTicker(catchUpInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			s.catchUpMissedRuns(s.clock.Now().In(s.timezone))
+		}
+	}
+}
+
+// catchUpMissedRuns starts a catch-up run for every job whose expected run is overdue at now
+func (s *Scheduler) catchUpMissedRuns(now time.Time) {
+	s.mu.Lock()
+	jobs := append([]*jobState(nil), s.jobs...)
+	s.mu.Unlock()
+
+	for _, st := range jobs {
+		if !st.overdue(now) {
+			continue
 		}
+
+		s.logger.Warn("Scheduled run was missed, starting catch-up run",
+			zap.String("job_name", st.name))
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.runJob(st, now, true)
+		}()
 	}
 }
 
 // Start starts the scheduler
 func (s *Scheduler) Start() {
 	s.logger.Info("Starting scheduler", zap.String("timezone", s.timezone.String()))
+
+	// Expect the first runs from now, as the cron starts its entries
+	now := s.clock.Now().In(s.timezone)
+
+	s.mu.Lock()
+	for _, st := range s.jobs {
+		st.reset(now)
+	}
+	if s.catchUp && s.stop == nil {
+		s.stop = make(chan struct{})
+		s.wg.Add(1)
+		go s.watchMissedRuns(s.stop)
+	}
+	s.mu.Unlock()
+
 	s.cron.Start()
 }
 
 // Stop stops the scheduler gracefully
 func (s *Scheduler) Stop() {
 	s.logger.Info("Stopping scheduler")
+
+	s.mu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.mu.Unlock()
+
 	ctx := s.cron.Stop()
 
-	// Wait for running jobs to complete
+	// Wait for running jobs to complete, both scheduled and catch-up runs
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		s.wg.Wait()
+		close(done)
+	}()
+
+	// The timeout bounds how long shutdown really waits, so it stays on the wall clock
+	timeout := time.NewTimer(s.stopTimeout)
+	defer timeout.Stop()
+
 	select {
-	case <-ctx.Done():
+	case <-done:
 		s.logger.Info("Scheduler stopped gracefully")
-	case <-time.After(30 * time.Second):
+	case <-timeout.C:
 		s.logger.Warn("Scheduler stop timeout, some jobs may have been interrupted")
 	}
 }
@@ -115,7 +274,7 @@ func (s *Scheduler) GetEntries() []EntryInfo {
 	for _, entry := range entries {
 		info = append(info, EntryInfo{
 			ID:       entry.ID,
-			Schedule: entry.Schedule.Next(time.Now()).Format(time.RFC3339),
+			Schedule: entry.Schedule.Next(s.clock.Now()).Format(time.RFC3339),
 			Next:     entry.Next,
 			Prev:     entry.Prev,
 		})
@@ -124,6 +283,32 @@ func (s *Scheduler) GetEntries() []EntryInfo {
 	return info
 }
 
+// Run is one activation of a scheduled job
+type Run struct {
+	Job string    `json:"job"`
+	At  time.Time `json:"at"`
+}
+
+// Upcoming returns every activation of the scheduled jobs after the clock's time and up to until,
+// in time order; jobs activating together keep the order they were added in
+func (s *Scheduler) Upcoming(until time.Time) []Run {
+	s.mu.Lock()
+	jobs := append([]*jobState(nil), s.jobs...)
+	s.mu.Unlock()
+
+	now := s.clock.Now().In(s.timezone)
+	var runs []Run
+	for _, st := range jobs {
+		for next := st.schedule.Next(now); !next.After(until); next = st.schedule.Next(next) {
+			runs = append(runs, Run{Job: st.name, At: next})
+		}
+	}
+	slices.SortStableFunc(runs, func(a, b Run) int {
+		return a.At.Compare(b.At)
+	})
+	return runs
+}
+
 // EntryInfo contains information about a scheduled job
 type EntryInfo struct {
 	ID       cron.EntryID `json:"id"`
@@ -139,10 +324,12 @@ func (s *Scheduler) IsRunning() bool {
 	return len(entries) > 0
 }
 
+// cronParser parses the standard 5-field cron format used by the cron scheduler
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 // ValidateSchedule validates a cron schedule expression
 func ValidateSchedule(schedule string) error {
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
-	_, err := parser.Parse(schedule)
+	_, err := cronParser.Parse(schedule)
 	if err != nil {
 		return fmt.Errorf("invalid cron schedule %s: %w", schedule, err)
 	}
@@ -151,7 +338,7 @@ func ValidateSchedule(schedule string) error {
 
 // GetNextRunTime returns the next scheduled run time for a given schedule
 func GetNextRunTime(schedule string, timezone string) (time.Time, error) {
-	loc, err := time.LoadLocation(timezone)
+	loc, err := LoadLocation(timezone)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("invalid timezone %s: %w", timezone, err)
 	}
@@ -168,15 +355,50 @@ func GetNextRunTime(schedule string, timezone string) (time.Time, error) {
 	return next, nil
 }
 
+// CountMissedRuns returns how many activations of the schedule fell after since and up to now
+func CountMissedRuns(schedule string, timezone string, since, now time.Time) (int, error) {
+	loc, err := LoadLocation(timezone)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timezone %s: %w", timezone, err)
+	}
+
+	sched, err := cronParser.Parse(schedule)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cron schedule %s: %w", schedule, err)
+	}
+
+	missed := 0
+	for next := sched.Next(since.In(loc)); !next.After(now); next = sched.Next(next) {
+		missed++
+	}
+	return missed, nil
+}
+
+// ScheduleInterval returns the time between the two activations of the schedule following at
+func ScheduleInterval(schedule string, timezone string, at time.Time) (time.Duration, error) {
+	loc, err := LoadLocation(timezone)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timezone %s: %w", timezone, err)
+	}
+
+	sched, err := cronParser.Parse(schedule)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cron schedule %s: %w", schedule, err)
+	}
+
+	next := sched.Next(at.In(loc))
+	return sched.Next(next).Sub(next), nil
+}
+
 // RunOnce executes a job immediately (for testing or one-shot execution)
 func (s *Scheduler) RunOnce(jobName string, job JobFunc) error {
 	s.logger.Info("Running job once", zap.String("job_name", jobName))
 
 	ctx := context.Background()
-	startTime := time.Now()
+	startTime := s.clock.Now()
 
 	err := job(ctx)
-	duration := time.Since(startTime)
+	duration := s.clock.Now().Sub(startTime)
 
 	if err != nil {
 		s.logger.Error("One-shot job failed",
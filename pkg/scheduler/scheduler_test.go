@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCountMissedRuns(t *testing.T) {
+	since := time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule string
+		now      time.Time
+		expected int
+	}{
+		{
+			name:     "before the next run",
+			schedule: "0 * * * *",
+			now:      since.Add(59 * time.Minute),
+			expected: 0,
+		},
+		{
+			name:     "at the next run",
+			schedule: "0 * * * *",
+			now:      since.Add(time.Hour),
+			expected: 1,
+		},
+		{
+			name:     "several runs missed",
+			schedule: "0 * * * *",
+			now:      since.Add(3*time.Hour + 30*time.Minute),
+			expected: 3,
+		},
+		{
+			name:     "daily schedule",
+			schedule: "0 0 * * *",
+			now:      since.Add(12 * time.Hour),
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, err := CountMissedRuns(tt.schedule, "UTC", since, tt.now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if missed != tt.expected {
+				t.Errorf("expected %d missed runs, got %d", tt.expected, missed)
+			}
+		})
+	}
+
+	if _, err := CountMissedRuns("invalid", "UTC", since, since); err == nil {
+		t.Error("expected error for invalid schedule")
+	}
+}
+
+func TestUpcoming(t *testing.T) {
+	s, _ := newTestScheduler(t)
+	noop := func(ctx context.Context) error { return nil }
+	if err := s.AddJob("0 * * * *", "hourly", noop); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := s.AddJob("30 10 * * *", "daily", noop); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	// The clock reads 09:30, so the runs follow from 10:00
+	day := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+	expected := []Run{
+		{Job: "hourly", At: day.Add(10 * time.Hour)},
+		{Job: "daily", At: day.Add(10*time.Hour + 30*time.Minute)},
+		{Job: "hourly", At: day.Add(11 * time.Hour)},
+		{Job: "hourly", At: day.Add(12 * time.Hour)},
+	}
+
+	runs := s.Upcoming(day.Add(12 * time.Hour))
+	if len(runs) != len(expected) {
+		t.Fatalf("expected %d runs, got %v", len(expected), runs)
+	}
+	for i, run := range runs {
+		if run.Job != expected[i].Job || !run.At.Equal(expected[i].At) {
+			t.Errorf("expected run %d to be %v, got %v", i, expected[i], run)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoadLocation loads the named timezone like time.LoadLocation; when the binary carries no
+// timezone database of its own the error suggests embedding one, since scratch images and
+// Windows hosts commonly have no zoneinfo to load non-UTC timezones from
+func LoadLocation(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil && !EmbeddedTZData {
+		return nil, fmt.Errorf("%w (install the host's tzdata package or build with -tags tzdata to embed it)", err)
+	}
+	return loc, err
+}
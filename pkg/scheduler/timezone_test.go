@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadLocation(t *testing.T) {
+	loc, err := LoadLocation("UTC")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loc.String() != "UTC" {
+		t.Errorf("expected UTC, got %s", loc)
+	}
+
+	_, err = LoadLocation("Not/A_Zone")
+	if err == nil {
+		t.Fatal("expected an error for an unknown timezone")
+	}
+	if hint := strings.Contains(err.Error(), "-tags tzdata"); hint == EmbeddedTZData {
+		t.Errorf("expected the embedding hint only without embedded tzdata, got %q", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build tzdata || timetzdata
+
+package scheduler
+
+// Embeds the IANA timezone database, about 450 KB, used when the host has no zoneinfo
+import _ "time/tzdata"
+
+// EmbeddedTZData reports whether the timezone database is built into the binary
+const EmbeddedTZData = true
@@ -0,0 +1,6 @@
+//go:build !tzdata && !timetzdata
+
+package scheduler
+
+// EmbeddedTZData reports whether the timezone database is built into the binary
+const EmbeddedTZData = false
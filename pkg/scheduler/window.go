@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// InWindow reports whether now falls inside the window delimited by the open and close
+// cron expressions. The window is considered open when the next close event occurs
+// before the next open event.
+func InWindow(open, close string, loc *time.Location, now time.Time) (bool, error) {
+	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+	openSched, err := parser.Parse(open)
+	if err != nil {
+		return false, fmt.Errorf("invalid window open schedule %s: %w", open, err)
+	}
+
+	closeSched, err := parser.Parse(close)
+	if err != nil {
+		return false, fmt.Errorf("invalid window close schedule %s: %w", close, err)
+	}
+
+	now = now.In(loc)
+	nextOpen := openSched.Next(now)
+	nextClose := closeSched.Next(now)
+
+	return nextClose.Before(nextOpen), nil
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInWindow(t *testing.T) {
+	loc := time.UTC
+	open := "0 8 * * 1-5"
+	close := "0 18 * * 1-5"
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected bool
+	}{
+		{
+			name:     "weekday during business hours",
+			now:      time.Date(2025, 1, 8, 12, 0, 0, 0, loc), // Wednesday
+			expected: true,
+		},
+		{
+			name:     "weekday at opening time",
+			now:      time.Date(2025, 1, 8, 8, 0, 0, 0, loc),
+			expected: true,
+		},
+		{
+			name:     "weekday after closing",
+			now:      time.Date(2025, 1, 8, 19, 0, 0, 0, loc),
+			expected: false,
+		},
+		{
+			name:     "weekday before opening",
+			now:      time.Date(2025, 1, 8, 7, 59, 0, 0, loc),
+			expected: false,
+		},
+		{
+			name:     "weekend",
+			now:      time.Date(2025, 1, 11, 12, 0, 0, 0, loc), // Saturday
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, err := InWindow(open, close, loc, tt.now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if active != tt.expected {
+				t.Errorf("expected active=%v, got %v", tt.expected, active)
+			}
+		})
+	}
+}
+
+func TestInWindowInvalidSchedule(t *testing.T) {
+	if _, err := InWindow("invalid", "0 18 * * *", time.UTC, time.Now()); err == nil {
+		t.Error("expected error for invalid open schedule")
+	}
+
+	if _, err := InWindow("0 8 * * *", "invalid", time.UTC, time.Now()); err == nil {
+		t.Error("expected error for invalid close schedule")
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithAuthTokens requires one of the bearer tokens on the allowlist, metrics and other handlers
+// added with Handle; no tokens leave them open
+func WithAuthTokens(tokens []string) Option {
+	return func(s *Server) {
+		s.authTokens = tokens
+	}
+}
+
+// WithRateLimit limits every client to perMinute requests, allowing short bursts of the same
+// size; zero disables the limit
+func WithRateLimit(perMinute int) Option {
+	return func(s *Server) {
+		if perMinute > 0 {
+			s.limiter = newClientLimiter(perMinute)
+		}
+	}
+}
+
+// WithTrustProxy identifies clients by the X-Forwarded-For header set by a reverse proxy
+func WithTrustProxy(trust bool) Option {
+	return func(s *Server) {
+		s.trustProxy = trust
+	}
+}
+
+// WithSigner serves a signature of each allowlist representation next to it, e.g.
+// /allowlist.txt.minisig
+func WithSigner(signer *signing.Signer) Option {
+	return func(s *Server) {
+		s.signer = signer
+	}
+}
+
+// ClientIP returns the client address of the request; behind a trusted proxy, the last
+// X-Forwarded-For entry is the one the proxy appended
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requireToken rejects requests without one of the configured bearer tokens
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	if len(s.authTokens) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !s.validToken(token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="do-firewall-allowlister"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validToken compares the token with every configured token in constant time
+func (s *Server) validToken(token string) bool {
+	valid := 0
+	for _, expected := range s.authTokens {
+		valid |= subtle.ConstantTimeCompare([]byte(token), []byte(expected))
+	}
+	return valid == 1
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// middleware rate limits and logs every request; the registered route is logged instead of the
+// path, which can carry invite tokens
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		client := ClientIP(r, s.trustProxy)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		if s.limiter != nil && !s.limiter.allow(client, start) {
+			rec.Header().Set("Retry-After", strconv.Itoa(s.limiter.retryAfter()))
+			http.Error(rec, "too many requests", http.StatusTooManyRequests)
+		} else {
+			next.ServeHTTP(rec, r)
+		}
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		s.logger.Info("Handled request",
+			zap.String("method", r.Method),
+			zap.String("route", route),
+			zap.Int("status", rec.status),
+			zap.String("client_ip", client),
+			zap.Duration("duration", time.Since(start)))
+	})
+}
+
+// limiterIdleTimeout is how long a client's limiter is kept after its last request
+const limiterIdleTimeout = 10 * time.Minute
+
+// clientLimiter holds a token bucket per client address
+type clientLimiter struct {
+	perMinute int
+
+	mu          sync.Mutex
+	clients     map[string]*clientBucket
+	lastCleanup time.Time
+}
+
+// clientBucket is the token bucket of one client
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newClientLimiter(perMinute int) *clientLimiter {
+	return &clientLimiter{
+		perMinute: perMinute,
+		clients:   make(map[string]*clientBucket),
+	}
+}
+
+// allow reports whether the client may make another request now
+func (l *clientLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget idle clients so the map does not grow with every address ever seen
+	if now.Sub(l.lastCleanup) > time.Minute {
+		for address, bucket := range l.clients {
+			if now.Sub(bucket.lastSeen) > limiterIdleTimeout {
+				delete(l.clients, address)
+			}
+		}
+		l.lastCleanup = now
+	}
+
+	bucket, ok := l.clients[client]
+	if !ok {
+		bucket = &clientBucket{limiter: rate.NewLimiter(rate.Limit(float64(l.perMinute)/60), l.perMinute)}
+		l.clients[client] = bucket
+	}
+	bucket.lastSeen = now
+	return bucket.limiter.AllowN(now, 1)
+}
+
+// retryAfter returns how many seconds a limited client waits for its next request
+func (l *clientLimiter) retryAfter() int {
+	seconds := 60 / l.perMinute
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/export"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"go.uber.org/zap"
+)
+
+// document is a rendered allowlist representation served with its validator
+type document struct {
+	body        []byte
+	etag        string
+	contentType string
+}
+
+// Server publishes the most recently computed allowlist over HTTP
+type Server struct {
+	address string
+	logger  *zap.Logger
+
+	mux        *http.ServeMux
+	authTokens []string
+	limiter    *clientLimiter
+	trustProxy bool
+	signer     *signing.Signer
+
+	mu        sync.RWMutex
+	documents map[string]*document
+	updatedAt time.Time
+
+	httpServer *http.Server
+	listener   net.Listener
+}
+
+// NewServer creates a server that listens on address once started
+func NewServer(address string, logger *zap.Logger, opts ...Option) *Server {
+	s := &Server{
+		address: address,
+		logger:  logger.Named("server"),
+		mux:     http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.Handle("/allowlist.txt", s.serveDocument("txt"))
+	s.Handle("/allowlist.json", s.serveDocument("json"))
+	if s.signer != nil {
+		s.Handle("/allowlist.txt"+s.signer.Extension(), s.serveDocument("txt"+s.signer.Extension()))
+		s.Handle("/allowlist.json"+s.signer.Extension(), s.serveDocument("json"+s.signer.Extension()))
+	}
+	s.httpServer = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Handler returns the HTTP handler serving /allowlist.txt, /allowlist.json, their signatures and
+// any added handlers
+func (s *Server) Handler() http.Handler {
+	return s.middleware(s.mux)
+}
+
+// Handle serves an additional handler, such as metrics, next to the allowlist, requiring the
+// bearer token like the allowlist does
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, s.requireToken(handler))
+}
+
+// HandlePublic serves an additional handler without the bearer token, for pages people open in a
+// browser that authenticate on their own
+func (s *Server) HandlePublic(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Update replaces the served allowlist; the ETags and Last-Modified only change when the
+// entries do, so pollers can rely on conditional requests
+func (s *Server) Update(entries []export.Entry) error {
+	var txt bytes.Buffer
+	if err := export.Render(&txt, export.FormatPlain, entries, export.Options{}); err != nil {
+		return fmt.Errorf("failed to render allowlist: %w", err)
+	}
+
+	var data bytes.Buffer
+	if err := export.Render(&data, export.FormatJSON, entries, export.Options{}); err != nil {
+		return fmt.Errorf("failed to render allowlist: %w", err)
+	}
+
+	documents := map[string]*document{
+		"txt":  newDocument(txt.Bytes(), "text/plain; charset=utf-8"),
+		"json": newDocument(data.Bytes(), "application/json"),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.documents["json"]; ok && current.etag == documents["json"].etag {
+		return nil
+	}
+
+	if s.signer != nil {
+		for _, name := range []string{"txt", "json"} {
+			sig, err := s.signer.Sign("allowlist."+name, documents[name].body)
+			if err != nil {
+				return err
+			}
+			documents[name+s.signer.Extension()] = newDocument(sig, "text/plain; charset=utf-8")
+		}
+	}
+	s.documents = documents
+	s.updatedAt = time.Now().UTC()
+
+	s.logger.Info("Updated served allowlist", zap.Int("count", len(entries)))
+	return nil
+}
+
+// newDocument wraps a body with a strong ETag derived from its content
+func newDocument(body []byte, contentType string) *document {
+	sum := sha256.Sum256(body)
+	return &document{
+		body:        body,
+		etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		contentType: contentType,
+	}
+}
+
+// serveDocument serves the named representation, answering 503 until the first update
+func (s *Server) serveDocument(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mu.RLock()
+		doc := s.documents[name]
+		updatedAt := s.updatedAt
+		s.mu.RUnlock()
+
+		if doc == nil {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "allowlist not computed yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("ETag", doc.etag)
+		w.Header().Set("Content-Type", doc.contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		// ServeContent handles If-None-Match, If-Modified-Since and HEAD requests
+		http.ServeContent(w, r, "", updatedAt, bytes.NewReader(doc.body))
+	}
+}
+
+// Start listens on the configured address and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.address, err)
+	}
+	s.listener = listener
+
+	s.logger.Info("Serving allowlist over HTTP", zap.String("address", listener.Addr().String()))
+
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Allowlist server stopped", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the server, waiting for in-flight requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.httpServer.Shutdown(ctx)
+}
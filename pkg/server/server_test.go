@@ -0,0 +1,191 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/export"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestServeAllowlist(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", zaptest.NewLogger(t))
+	handler := srv.Handler()
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/allowlist.txt", nil); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before the first update, got %d", rec.Code)
+	}
+
+	entries := []export.Entry{
+		{Address: "173.245.48.0/20", Source: "cloudflare"},
+		{Address: "203.0.113.5", Source: "netdata"},
+	}
+	if err := srv.Update(entries); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := get("/allowlist.txt", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "173.245.48.0/20\n203.0.113.5\n" {
+		t.Errorf("unexpected text body: %q", rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag header")
+	}
+
+	rec = get("/allowlist.json", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body export.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode JSON body: %v", err)
+	}
+	if body.Count != 2 || body.Entries[1].Source != "netdata" {
+		t.Errorf("unexpected JSON body: %+v", body)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Error("expected each representation to have its own ETag")
+	}
+
+	if rec := get("/allowlist.txt", map[string]string{"If-None-Match": etag}); rec.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", rec.Code)
+	}
+
+	// Publishing the same entries keeps the validators
+	if err := srv.Update(entries); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec := get("/allowlist.txt", nil); rec.Header().Get("ETag") != etag {
+		t.Error("expected the ETag to stay the same for unchanged entries")
+	}
+
+	if err := srv.Update(entries[:1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rec := get("/allowlist.txt", map[string]string{"If-None-Match": etag}); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 after the allowlist changed, got %d", rec.Code)
+	}
+}
+
+func TestServeAllowlistMethodNotAllowed(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/allowlist.json", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		path     string
+		header   map[string]string
+		requests int
+		expected int
+	}{
+		{name: "open without tokens", path: "/private", expected: http.StatusNoContent},
+		{name: "missing token", opts: []Option{WithAuthTokens([]string{"0123456789abcdef"})}, path: "/private", expected: http.StatusUnauthorized},
+		{name: "wrong token", opts: []Option{WithAuthTokens([]string{"0123456789abcdef"})}, path: "/private", header: map[string]string{"Authorization": "Bearer fedcba9876543210"}, expected: http.StatusUnauthorized},
+		{name: "valid token", opts: []Option{WithAuthTokens([]string{"fedcba9876543210", "0123456789abcdef"})}, path: "/private", header: map[string]string{"Authorization": "Bearer 0123456789abcdef"}, expected: http.StatusNoContent},
+		{name: "public handler", opts: []Option{WithAuthTokens([]string{"0123456789abcdef"})}, path: "/public", expected: http.StatusNoContent},
+		{name: "within rate limit", opts: []Option{WithRateLimit(3)}, path: "/public", requests: 3, expected: http.StatusNoContent},
+		{name: "over rate limit", opts: []Option{WithRateLimit(3)}, path: "/public", requests: 4, expected: http.StatusTooManyRequests},
+		{name: "rate limit per forwarded client", opts: []Option{WithRateLimit(1), WithTrustProxy(true)}, path: "/public", header: map[string]string{"X-Forwarded-For": "198.51.100.7"}, requests: 1, expected: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer("127.0.0.1:0", zaptest.NewLogger(t), tt.opts...)
+			srv.Handle("/private", ok)
+			srv.HandlePublic("/public", ok)
+			handler := srv.Handler()
+
+			// Another client behind the same proxy uses up its own budget first
+			other := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			other.Header.Set("X-Forwarded-For", "198.51.100.8")
+			handler.ServeHTTP(httptest.NewRecorder(), other)
+
+			requests := tt.requests
+			if requests == 0 {
+				requests = 1
+			}
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < requests; i++ {
+				req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+				req.RemoteAddr = "203.0.113.5:4242"
+				for key, value := range tt.header {
+					req.Header.Set(key, value)
+				}
+				rec = httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+			}
+
+			if rec.Code != tt.expected {
+				t.Fatalf("expected %d, got %d", tt.expected, rec.Code)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate header")
+			}
+			if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Error("expected a Retry-After header")
+			}
+		})
+	}
+}
+
+func TestServeSignatures(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	signer, err := signing.NewSigner(signing.FormatMinisign, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv := NewServer("127.0.0.1:0", zaptest.NewLogger(t), WithSigner(signer))
+	if err := srv.Update([]export.Entry{{Address: "203.0.113.5", Source: "netdata"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, path := range []string{"/allowlist.txt.minisig", "/allowlist.json.minisig"} {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "untrusted comment: ") {
+			t.Errorf("expected a minisign signature at %s, got %d %q", path, rec.Code, rec.Body.String())
+		}
+	}
+}
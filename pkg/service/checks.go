@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+)
+
+// Check is the outcome of one validation check, e.g. the access to a firewall or the collection
+// of a source; Err is nil when it passed
+type Check struct {
+	Name     string
+	Detail   string
+	Duration time.Duration
+	Err      error
+	// Critical is set when the failure fails the next run, unlike that of a source whose
+	// on-failure policy skips it or falls back to its cached addresses
+	Critical bool
+}
+
+// ProbeHealth checks the access to every firewall and collects every source without updating
+// anything, far cheaper than a run, for the daemon to detect outages between runs: each source
+// gets a single attempt, one collected within sources.cache-ttl is not fetched at all, and
+// nothing is logged, the daemon logs the changes of the checks
+func (s *Service) ProbeHealth(ctx context.Context) []Check {
+	return append(s.CheckFirewalls(ctx), s.probeSources(ctx)...)
+}
+
+// CheckFirewalls checks the access to every configured firewall, one check each named
+// digitalocean:<firewall-id>
+func (s *Service) CheckFirewalls(ctx context.Context) []Check {
+	var checks []Check
+	for _, target := range s.config.DigitalOcean.Targets() {
+		check := Check{Name: "digitalocean:" + target.ID, Critical: true}
+		start := time.Now()
+		firewall, err := s.digitalOceanClient.GetFirewall(ctx, target.ID)
+		check.Duration = time.Since(start)
+		if err != nil {
+			check.Err = fmt.Errorf("failed to access DigitalOcean firewall %s: %w", target.ID, err)
+		} else {
+			check.Detail = fmt.Sprintf("firewall %s, %d inbound rules", firewall.Name, len(firewall.InboundRules))
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// CheckSources collects every source like a run, one check each named source:<name>; the
+// on-failure policies do not apply, a failing source always fails its check
+func (s *Service) CheckSources(ctx context.Context) []Check {
+	return s.checkFetches(ctx, s.sourceFetches())
+}
+
+// probeSources collects every source for ProbeHealth like CheckSources, with a single attempt
+// each and the cached addresses of those collected within sources.cache-ttl
+func (s *Service) probeSources(ctx context.Context) []Check {
+	return s.checkFetches(ctx, s.withCachedSources(s.probeFetches()))
+}
+
+// checkFetches runs every fetch, one check each named source:<name>
+func (s *Service) checkFetches(ctx context.Context, fetches []sourceFetch) []Check {
+	ctx = sources.WithRunCache(ctx)
+	results, errs, took := s.fetchAll(ctx, fetches)
+
+	checks := make([]Check, len(fetches))
+	for i, source := range fetches {
+		critical := source.onFailure != config.OnFailureSkip && source.onFailure != config.OnFailureUseCached
+		checks[i] = Check{Name: "source:" + source.name, Duration: took[i], Err: errs[i], Critical: critical}
+		switch {
+		case errs[i] != nil:
+		case source.cached:
+			checks[i].Detail = fmt.Sprintf("%d cached addresses", len(results[i]))
+		default:
+			checks[i].Detail = fmt.Sprintf("%d addresses", len(results[i]))
+		}
+	}
+	return checks
+}
+
+// CheckDynamicDNS resolves every dynamic DNS hostname once, one check each named
+// dynamic-dns:<hostname>
+func (s *Service) CheckDynamicDNS(ctx context.Context) []Check {
+	var checks []Check
+	for _, entry := range s.config.DigitalOcean.DynamicDNS {
+		check := Check{Name: "dynamic-dns:" + entry.Hostname}
+		start := time.Now()
+		ips, err := s.dynDNSClient.Resolve(ctx, entry.Hostname)
+		check.Duration = time.Since(start)
+		if err != nil {
+			check.Err = fmt.Errorf("failed to resolve dynamic DNS hostname: %w", err)
+		} else {
+			check.Detail = fmt.Sprintf("%d addresses", len(ips))
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+)
+
+func TestProbeSources(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/partner", "/cached":
+			_, _ = w.Write([]byte("198.51.100.0/24\n203.0.113.0/27\n"))
+		case "/vendor":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Cloudflare: config.CloudflareConfig{IPsURL: server.URL + "/cloudflare"},
+		Sources: config.SourcesConfig{
+			HTTP: []config.HTTPSource{
+				{Name: "partner", URL: server.URL + "/partner", Format: "lines"},
+				{Name: "vendor", URL: server.URL + "/vendor", Format: "lines", OnFailure: config.OnFailureSkip},
+				{Name: "cached", URL: server.URL + "/cached", Format: "lines"},
+			},
+			Timeout:  5 * time.Second,
+			CacheTTL: time.Hour,
+		},
+	}
+	now := time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC)
+	s := newTestService(t, cfg)
+	s.clock = clock.NewFake(now)
+	s.probeClients = newSourceClients(cfg, zaptest.NewLogger(t))
+	if err := s.stateStore.Update(func(st *state.State) error {
+		st.CacheSource("cached", collectedSources(cfg)["cached"].hash, []string{"192.0.2.0/24"}, now.Add(-time.Minute))
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to cache the source: %v", err)
+	}
+
+	checks := s.probeSources(context.Background())
+
+	expected := []struct {
+		name     string
+		failed   bool
+		critical bool
+		detail   string
+	}{
+		{name: "source:cloudflare", failed: true, critical: true},
+		{name: "source:netdata", critical: true, detail: "0 addresses"},
+		{name: "source:partner", critical: true, detail: "2 addresses"},
+		{name: "source:vendor", failed: true},
+		{name: "source:cached", critical: true, detail: "1 cached addresses"},
+	}
+	if len(checks) != len(expected) {
+		t.Fatalf("expected %d checks, got %d: %+v", len(expected), len(checks), checks)
+	}
+	for i, want := range expected {
+		check := checks[i]
+		if check.Name != want.name {
+			t.Errorf("check %d: expected %s, got %s", i, want.name, check.Name)
+		}
+		if (check.Err != nil) != want.failed {
+			t.Errorf("%s: expected failed %v, got error %v", want.name, want.failed, check.Err)
+		}
+		if check.Critical != want.critical {
+			t.Errorf("%s: expected critical %v, got %v", want.name, want.critical, check.Critical)
+		}
+		if check.Detail != want.detail {
+			t.Errorf("%s: expected detail %q, got %q", want.name, want.detail, check.Detail)
+		}
+	}
+
+	// A single attempt per source, failing or not, and none for the source cached within the TTL
+	expectedRequests := map[string]int{"/cloudflare": 1, "/partner": 1, "/vendor": 1}
+	mu.Lock()
+	defer mu.Unlock()
+	for path, count := range expectedRequests {
+		if requests[path] != count {
+			t.Errorf("expected %d requests to %s, got %d", count, path, requests[path])
+		}
+	}
+	if requests["/cached"] != 0 {
+		t.Errorf("expected no request to the cached source, got %d", requests["/cached"])
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/cloudflare"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/netdata"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeFirewallAPI is an in-memory stand-in for the DigitalOcean firewalls API that counts the
+// updates in flight at the same time; updates of the firewalls in fail are answered with 500
+type fakeFirewallAPI struct {
+	mu        sync.Mutex
+	firewalls map[string]*godo.Firewall
+	fail      map[string]bool
+	// delay keeps every update in flight for a while, so concurrent updates overlap
+	delay       time.Duration
+	inFlight    int
+	maxInFlight int
+	updates     int
+}
+
+func newFakeFirewallAPI(ids ...string) *fakeFirewallAPI {
+	api := &fakeFirewallAPI{firewalls: make(map[string]*godo.Firewall), fail: make(map[string]bool)}
+	for _, id := range ids {
+		api.firewalls[id] = &godo.Firewall{ID: id, Name: id}
+	}
+	return api
+}
+
+func (f *fakeFirewallAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/v2/firewalls/")
+
+	f.mu.Lock()
+	fw, ok := f.firewalls[id]
+	if !ok {
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"id":"not_found","message":"firewall not found"}`))
+		return
+	}
+	if r.Method == http.MethodPut {
+		f.inFlight++
+		f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	}
+	f.mu.Unlock()
+
+	if r.Method == http.MethodPut {
+		time.Sleep(f.delay)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.inFlight--
+		if f.fail[id] {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"id":"server_error","message":"internal server error"}`))
+			return
+		}
+		var req godo.FirewallRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fw.InboundRules = req.InboundRules
+		fw.OutboundRules = req.OutboundRules
+		f.updates++
+	} else {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]*godo.Firewall{"firewall": fw})
+}
+
+// withFakeAPIs installs DigitalOcean and Cloudflare clients talking to the fake firewall API and
+// a Cloudflare API listing ranges, and a Netdata client that is never asked to resolve anything
+func withFakeAPIs(t *testing.T, s *Service, api *fakeFirewallAPI, ranges ...string) {
+	t.Helper()
+	logger := zaptest.NewLogger(t)
+
+	doServer := httptest.NewServer(api)
+	t.Cleanup(doServer.Close)
+	baseURL, err := url.Parse(doServer.URL + "/")
+	if err != nil {
+		t.Fatalf("failed to parse fake API URL: %v", err)
+	}
+	s.digitalOceanClient = digitalocean.NewClient("test-token", logger, digitalocean.WithBaseURL(baseURL))
+
+	cfServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := cloudflare.CloudflareIPsResponse{Success: true}
+		response.Result.IPv4CIDRs = ranges
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(cfServer.Close)
+	s.cloudflareClient = cloudflare.NewClient(cfServer.URL, logger)
+	s.netdataClient = netdata.NewClient(logger)
+}
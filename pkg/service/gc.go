@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/digitalocean/godo"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// CollectedRules are the inbound rules gc removed from a firewall, or would remove in a dry run,
+// because their ports are no longer configured
+type CollectedRules struct {
+	FirewallID string   `json:"firewall_id"`
+	Ports      []int    `json:"ports"`
+	Rules      []string `json:"rules"` // "protocol/port_range" of every removed rule
+	Applied    bool     `json:"applied"`
+}
+
+// CollectGarbage removes the inbound rules the allowlister wrote for ports that were since dropped
+// from the configuration of a firewall; ports are only known once an update recorded them, and
+// ports holding dynamic DNS, allow-current-ip, watch-ip or invited addresses are kept
+func (s *Service) CollectGarbage(ctx context.Context) ([]CollectedRules, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	var collected []CollectedRules
+	for _, target := range s.targets(st) {
+		ports := orphanedPorts(st, target.ID, target.InboundRules)
+		if len(ports) == 0 || s.isHalted(st, target.ID) {
+			continue
+		}
+		fields := []zap.Field{
+			zap.String("firewall_id", target.ID),
+			zap.Ints("ports", ports),
+		}
+
+		if s.dryRun || s.digitalOceanClient.IsReadOnly() {
+			firewall, err := s.digitalOceanClient.GetFirewall(ctx, target.ID)
+			if err != nil {
+				return collected, fmt.Errorf("failed to get firewall %s: %w", target.ID, err)
+			}
+			rules := digitalocean.OrphanedRules(firewall, ports)
+			s.logger.Info("DRY RUN: Would remove rules of unconfigured ports",
+				append(fields, zap.Int("rules", len(rules)))...)
+			collected = append(collected, CollectedRules{FirewallID: target.ID, Ports: ports, Rules: ruleNames(rules)})
+			continue
+		}
+
+		frozen, err := s.digitalOceanClient.IsFrozen(ctx, target.ID, s.config.DigitalOcean.FreezeTag)
+		if err != nil {
+			return collected, fmt.Errorf("failed to check freeze tag: %w", err)
+		}
+		if frozen {
+			s.logger.Error("Firewall is frozen by tag, skipping garbage collection until the tag is removed",
+				zap.String("firewall_id", target.ID),
+				zap.String("tag", s.config.DigitalOcean.FreezeTag))
+			continue
+		}
+
+		rules, err := s.digitalOceanClient.RemovePortRules(ctx, target.ID, ports)
+		if err != nil {
+			return collected, fmt.Errorf("failed to remove rules of unconfigured ports from %s: %w", target.ID, err)
+		}
+
+		// Ports whose rules are already gone are forgotten too, there is nothing left to collect
+		err = s.stateStore.Update(func(st *state.State) error {
+			st.ForgetManagedPorts(target.ID, ports)
+			return nil
+		})
+		if err != nil {
+			return collected, fmt.Errorf("failed to record garbage collection: %w", err)
+		}
+
+		s.logger.Info("Removed rules of unconfigured ports", append(fields, zap.Int("rules", len(rules)))...)
+		collected = append(collected, CollectedRules{FirewallID: target.ID, Ports: ports, Rules: ruleNames(rules), Applied: true})
+	}
+	return collected, nil
+}
+
+// orphanedPorts returns the ports recorded for the firewall that none of its rules configure and
+// no address added outside the configuration uses
+func orphanedPorts(st *state.State, firewallID string, rules []config.InboundRule) []int {
+	inUse := st.PortsInUse(firewallID)
+	for _, rule := range rules {
+		inUse[rule.Port] = true
+	}
+
+	return slices.DeleteFunc(st.ManagedPorts(firewallID), func(port int) bool {
+		return inUse[port]
+	})
+}
+
+// ruleNames formats inbound rules as "protocol/port_range"
+func ruleNames(rules []godo.InboundRule) []string {
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, rule.Protocol+"/"+rule.PortRange)
+	}
+	return names
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// openAccessGrant allowlists the grant's IP on its port and records the grant so the address is
+// removed once it expires; a grant ID can only be used once
+func (s *Service) openAccessGrant(ctx context.Context, grant state.AccessGrant) error {
+	ctx = audit.WithFields(ctx, grantAuditFields(grant))
+
+	return s.stateStore.Update(func(st *state.State) error {
+		if st.FindAccessGrant(grant.ID) != nil {
+			return ErrInviteRedeemed
+		}
+
+		if err := s.digitalOceanClient.AddSSHRule(ctx, grant.FirewallID, grant.IP, grant.Port, false); err != nil {
+			return fmt.Errorf("failed to allow %s: %w", grant.IP, err)
+		}
+
+		st.AccessGrants = append(st.AccessGrants, grant)
+		return nil
+	})
+}
+
+// ExpireAccessGrants removes the addresses of invites and self-service grants whose TTL ran out,
+// keeping an address that another open grant or allow-current-ip still needs
+func (s *Service) ExpireAccessGrants(ctx context.Context) error {
+	firewallID := s.config.DigitalOcean.FirewallID
+	now := s.clock.Now().UTC()
+
+	err := s.stateStore.Update(func(st *state.State) error {
+		for _, grant := range st.DueAccessGrants(firewallID, now) {
+			fields := []zap.Field{
+				zap.String("grant_id", grant.ID),
+				zap.String("kind", grant.Kind),
+				zap.String("source_ip", grant.IP),
+				zap.Int("port", grant.Port),
+			}
+
+			if s.dryRun || s.digitalOceanClient.IsReadOnly() {
+				s.logger.Info("DRY RUN: Would remove the IP of an expired access grant", fields...)
+				continue
+			}
+
+			if !st.GrantIPInUse(firewallID, grant.Port, grant.IP, now) {
+				grantCtx := audit.WithFields(ctx, grantAuditFields(*grant))
+				if err := s.digitalOceanClient.RemoveSSHSources(grantCtx, firewallID, []string{grant.IP}, grant.Port); err != nil {
+					return fmt.Errorf("failed to remove IP of expired access grant %s: %w", grant.ID, err)
+				}
+			}
+
+			grant.Closed = true
+			s.logger.Info("Access grant expired, removed its IP", fields...)
+		}
+
+		st.PruneAccessGrants(now)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to expire access grants: %w", err)
+	}
+	return nil
+}
+
+// DueAccessGrants returns the open grants of firewall-id whose TTL ran out, without removing
+// their addresses
+func (s *Service) DueAccessGrants() ([]state.AccessGrant, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	var due []state.AccessGrant
+	for _, grant := range st.DueAccessGrants(s.config.DigitalOcean.FirewallID, s.clock.Now().UTC()) {
+		due = append(due, *grant)
+	}
+	return due, nil
+}
+
+// grantAuditFields identify the grant and the person behind it in the audit records of its changes
+func grantAuditFields(grant state.AccessGrant) map[string]string {
+	fields := map[string]string{
+		"grant_id":   grant.ID,
+		"grant_kind": grant.Kind,
+	}
+	if grant.CreatedBy != "" {
+		fields["invited_by"] = grant.CreatedBy
+	}
+	if grant.Identity != "" {
+		fields["identity"] = grant.Identity
+	}
+	return fields
+}
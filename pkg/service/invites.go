@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/invite"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// ErrInviteRedeemed is returned by RedeemInvite for an invite that was already used
+var ErrInviteRedeemed = errors.New("invite already redeemed")
+
+// RedeemInvite verifies a one-time invite token and allowlists ip on the invite's port until
+// its TTL runs out; every invite can only be redeemed once
+func (s *Service) RedeemInvite(ctx context.Context, token, ip string) (*state.AccessGrant, error) {
+	key := s.config.Invites.SigningKey
+	if key == "" {
+		return nil, errors.New("invites are not enabled: set invites.signing-key")
+	}
+
+	now := s.clock.Now().UTC()
+	inv, err := invite.Verify(token, []byte(key), now)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(ip) == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	firewallID := s.config.DigitalOcean.FirewallID
+	grant := state.AccessGrant{
+		ID:            inv.ID,
+		Kind:          state.GrantInvite,
+		FirewallID:    firewallID,
+		Port:          inv.Port,
+		IP:            ip,
+		CreatedBy:     inv.CreatedBy,
+		GrantedAt:     now,
+		ExpiresAt:     now.Add(inv.TTL),
+		LinkExpiresAt: inv.ExpiresAt,
+	}
+	fields := []zap.Field{
+		zap.String("invite_id", grant.ID),
+		zap.String("created_by", grant.CreatedBy),
+		zap.String("source_ip", grant.IP),
+		zap.Int("port", grant.Port),
+		zap.Time("expires_at", grant.ExpiresAt),
+	}
+
+	if s.dryRun || s.digitalOceanClient.IsReadOnly() {
+		s.logger.Info("DRY RUN: Would redeem invite and allow visitor IP", fields...)
+		return &grant, nil
+	}
+
+	if err := s.openAccessGrant(ctx, grant); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Redeemed invite", fields...)
+	return &grant, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// PortMigration is what MigratePort moved from one port of a firewall to another
+type PortMigration struct {
+	FirewallID string `json:"firewall_id"`
+	From       int    `json:"from"`
+	To         int    `json:"to"`
+	// Rules is the number of inbound rules moved, Records the number of state records
+	Rules   int  `json:"rules"`
+	Records int  `json:"records"`
+	Applied bool `json:"applied"`
+}
+
+// MigratePort moves the sources of a managed port's inbound rules to another port in a single
+// firewall update, then moves the state recorded for the port, firewall-id when firewallID is
+// empty; the configuration itself is left to the caller
+func (s *Service) MigratePort(ctx context.Context, firewallID string, from, to int) (*PortMigration, error) {
+	if firewallID == "" {
+		firewallID = s.config.DigitalOcean.FirewallID
+	}
+	primary := firewallID == s.config.DigitalOcean.FirewallID
+
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	targets := s.targets(st)
+	index := slices.IndexFunc(targets, func(target config.FirewallTarget) bool { return target.ID == firewallID })
+	if index < 0 {
+		return nil, fmt.Errorf("unknown firewall %s: ports can only be migrated on configured firewalls", firewallID)
+	}
+	configured := func(port int) bool {
+		return slices.ContainsFunc(targets[index].InboundRules, func(rule config.InboundRule) bool { return rule.Port == port })
+	}
+	if !configured(from) {
+		return nil, fmt.Errorf("port %d is not managed on firewall %s", from, firewallID)
+	}
+	if configured(to) {
+		return nil, fmt.Errorf("port %d is already managed on firewall %s", to, firewallID)
+	}
+	if s.isHalted(st, firewallID) {
+		return nil, fmt.Errorf("firewall %s is locked down or frozen", firewallID)
+	}
+
+	migration := &PortMigration{FirewallID: firewallID, From: from, To: to}
+	fields := []zap.Field{
+		zap.String("firewall_id", firewallID),
+		zap.Int("from_port", from),
+		zap.Int("to_port", to),
+	}
+
+	if s.dryRun || s.digitalOceanClient.IsReadOnly() {
+		firewall, err := s.digitalOceanClient.GetFirewall(ctx, firewallID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get firewall %s: %w", firewallID, err)
+		}
+		for _, rule := range firewall.InboundRules {
+			if rule.PortRange == strconv.Itoa(from) {
+				migration.Rules++
+			}
+		}
+		// The loaded state is a copy, moving its records only counts them
+		migration.Records = movePortRecords(st, firewallID, primary, from, to)
+
+		s.logger.Info("DRY RUN: Would migrate port",
+			append(fields, zap.Int("rules", migration.Rules), zap.Int("records", migration.Records))...)
+		return migration, nil
+	}
+
+	frozen, err := s.digitalOceanClient.IsFrozen(ctx, firewallID, s.config.DigitalOcean.FreezeTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check freeze tag: %w", err)
+	}
+	if frozen {
+		return nil, fmt.Errorf("firewall %s is frozen by tag %s", firewallID, s.config.DigitalOcean.FreezeTag)
+	}
+
+	migration.Rules, err = s.digitalOceanClient.MovePortRules(ctx, firewallID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate port %d to %d: %w", from, to, err)
+	}
+	migration.Applied = true
+
+	err = s.stateStore.Update(func(st *state.State) error {
+		migration.Records = movePortRecords(st, firewallID, primary, from, to)
+		return nil
+	})
+	if err != nil {
+		return migration, fmt.Errorf("firewall rules were migrated but recording it failed: %w", err)
+	}
+
+	s.logger.Info("Migrated port",
+		append(fields, zap.Int("rules", migration.Rules), zap.Int("records", migration.Records))...)
+	return migration, nil
+}
+
+// movePortRecords moves the state recorded for the firewall's port, including the pending access
+// requests of firewall-id, and returns how many records moved
+func movePortRecords(st *state.State, firewallID string, primary bool, from, to int) int {
+	moved := st.MovePort(firewallID, from, to)
+	if !primary {
+		return moved
+	}
+
+	// Access requests are only ever approved onto firewall-id
+	for i := range st.AccessRequests {
+		if st.AccessRequests[i].Status == state.AccessRequestPending && st.AccessRequests[i].Port == from {
+			st.AccessRequests[i].Port = to
+			moved++
+		}
+	}
+	return moved
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/notify"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+	"go.uber.org/zap"
+)
+
+// notifyFilter returns the filter of a notification channel, with its quiet hours in cron.timezone
+func notifyFilter(cfg *config.Config, failuresOnly bool, minSeverity string, quiet config.NotifyQuietHours) notify.Filter {
+	if failuresOnly {
+		minSeverity = notify.SeverityFailure
+	}
+	// The timezone is validated on load
+	loc, err := scheduler.LoadLocation(cfg.Cron.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return notify.Filter{
+		MinSeverity:      minSeverity,
+		QuietOpen:        quiet.Open,
+		QuietClose:       quiet.Close,
+		QuietMinSeverity: quiet.MinSeverity,
+		Location:         loc,
+	}
+}
+
+// ScheduledUpdate runs UpdateFirewallRules for a scheduled run of the daemon, then notifies the
+// configured channels if the run changed a firewall or failed
+func (s *Service) ScheduledUpdate(ctx context.Context) error {
+	if !s.runNotifier.Enabled() {
+		return s.UpdateFirewallRules(ctx)
+	}
+
+	applied := &digitalocean.AppliedChanges{}
+	startedAt := s.clock.Now()
+	err := s.UpdateFirewallRules(digitalocean.WithAppliedChanges(ctx, applied))
+
+	run := s.newRun(startedAt, applied.List(), err)
+	if run.Changed() > 0 || run.Failed() {
+		// A run cut short by shutdown is still reported
+		s.notifyRun(context.WithoutCancel(ctx), run)
+	}
+	return err
+}
+
+// newRun builds the result of a run from the changes it applied and its error
+func (s *Service) newRun(startedAt time.Time, applied []digitalocean.ChangeSummary, err error) *notify.Run {
+	run := &notify.Run{
+		Status:     notify.RunSucceeded,
+		StartedAt:  startedAt,
+		FinishedAt: s.clock.Now(),
+		Firewalls:  []notify.RunFirewall{},
+	}
+	for _, changes := range applied {
+		run.Firewalls = append(run.Firewalls, notify.RunFirewall{
+			FirewallID:   changes.FirewallID,
+			FirewallName: changes.FirewallName,
+			Outcome:      string(FirewallUpdated),
+			Added:        append([]string{}, changes.AddedAddresses...),
+			Removed:      append([]string{}, changes.RemovedAddresses...),
+		})
+	}
+	if err == nil {
+		return run
+	}
+
+	// Errors other than UpdateError fail the run as a whole, e.g. collecting the sources
+	run.Status, run.Error = notify.RunFailed, err.Error()
+	var updateErr *UpdateError
+	if errors.As(err, &updateErr) {
+		for _, result := range updateErr.Failed() {
+			run.Firewalls = append(run.Firewalls, notify.RunFirewall{
+				FirewallID: result.FirewallID,
+				Outcome:    string(FirewallFailed),
+				Added:      []string{},
+				Removed:    []string{},
+				Error:      result.Err.Error(),
+			})
+		}
+	}
+	return run
+}
+
+// notifyRun sends the run notification, logging rather than failing the run when it cannot
+func (s *Service) notifyRun(ctx context.Context, run *notify.Run) {
+	msg, err := s.runTemplate.Render(notify.TemplateData{
+		Kind:        notify.KindRun,
+		Environment: s.config.Notify.Environment,
+		FirewallID:  s.config.DigitalOcean.FirewallID,
+		Time:        run.FinishedAt,
+		Changes:     run.Changed(),
+		Added:       run.Added(),
+		Removed:     run.Removed(),
+		Run:         run,
+		Title:       run.Title(s.config.Notify.Environment),
+		Text:        run.Body(),
+	})
+	if err != nil {
+		s.logger.Error("Failed to render run notification", zap.Error(err))
+		return
+	}
+	msg.Run = run
+
+	if err := s.runNotifier.Dispatch(ctx, msg); err != nil {
+		s.logger.Error("Failed to notify about the run", zap.String("status", run.Status), zap.Error(err))
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FirewallOutcome is what a firewall update run did to one firewall
+type FirewallOutcome string
+
+const (
+	// FirewallUpdated means the firewall's rules were rewritten
+	FirewallUpdated FirewallOutcome = "updated"
+	// FirewallUnchanged means the firewall already had the wanted rules
+	FirewallUnchanged FirewallOutcome = "unchanged"
+	// FirewallSkipped means a lockdown, a freeze or a dry run left the firewall alone
+	FirewallSkipped FirewallOutcome = "skipped"
+	// FirewallFailed means updating the firewall failed, see FirewallResult.Err
+	FirewallFailed FirewallOutcome = "failed"
+)
+
+// applied reports whether the run left the firewall with the collected sources
+func (o FirewallOutcome) applied() bool {
+	return o == FirewallUpdated || o == FirewallUnchanged
+}
+
+// FirewallResult is the outcome of a firewall update run for one firewall
+type FirewallResult struct {
+	FirewallID string
+	Outcome    FirewallOutcome
+	Err        error
+}
+
+// UpdateError is returned by UpdateFirewallRules when some of several firewalls failed to update;
+// the other firewalls were still updated, and Results holds the outcome of every firewall in the
+// order they are configured
+type UpdateError struct {
+	Results []FirewallResult
+}
+
+// Failed returns the results of the firewalls that failed to update
+func (e *UpdateError) Failed() []FirewallResult {
+	var failed []FirewallResult
+	for _, result := range e.Results {
+		if result.Outcome == FirewallFailed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+func (e *UpdateError) Error() string {
+	failed := e.Failed()
+	messages := make([]string, 0, len(failed))
+	for _, result := range failed {
+		messages = append(messages, fmt.Sprintf("firewall %s: %v", result.FirewallID, result.Err))
+	}
+	return fmt.Sprintf("failed to update %d of %d firewalls: %s", len(failed), len(e.Results), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the error of every failed firewall, so errors.Is and errors.As see all of them
+func (e *UpdateError) Unwrap() []error {
+	var errs []error
+	for _, result := range e.Failed() {
+		errs = append(errs, result.Err)
+	}
+	return errs
+}
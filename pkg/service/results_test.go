@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateError(t *testing.T) {
+	errDenied := errors.New("403 forbidden")
+	errTimeout := errors.New("context deadline exceeded")
+	err := &UpdateError{Results: []FirewallResult{
+		{FirewallID: "fw-1", Outcome: FirewallUpdated},
+		{FirewallID: "fw-2", Outcome: FirewallFailed, Err: errDenied},
+		{FirewallID: "fw-3", Outcome: FirewallSkipped},
+		{FirewallID: "fw-4", Outcome: FirewallFailed, Err: errTimeout},
+	}}
+
+	expected := "failed to update 2 of 4 firewalls: firewall fw-2: 403 forbidden; firewall fw-4: context deadline exceeded"
+	if err.Error() != expected {
+		t.Errorf("expected message %q, got %q", expected, err.Error())
+	}
+
+	var failed []string
+	for _, result := range err.Failed() {
+		failed = append(failed, result.FirewallID)
+	}
+	if !reflect.DeepEqual(failed, []string{"fw-2", "fw-4"}) {
+		t.Errorf("expected fw-2 and fw-4 to have failed, got %v", failed)
+	}
+
+	for _, target := range []error{errDenied, errTimeout} {
+		if !errors.Is(err, target) {
+			t.Errorf("expected errors.Is to reach %v", target)
+		}
+	}
+	if errors.Is(err, errors.New("403 forbidden")) {
+		t.Error("expected errors.Is to only match the failed firewalls' errors")
+	}
+}
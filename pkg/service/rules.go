@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// ErrRuleManaged is returned by AddManagedRule for a protocol and port the firewall already manages
+var ErrRuleManaged = errors.New("rule already managed")
+
+// errDryRun leaves the state unchanged once a dry run checked the rule could be added
+var errDryRun = errors.New("dry run")
+
+// AddManagedRule adds an inbound rule to a configured firewall, firewall-id when firewallID is
+// empty, and persists it to the state file so it outlives restarts; the next firewall update
+// applies it
+func (s *Service) AddManagedRule(firewallID string, rule config.InboundRule, addedBy string) (*state.ManagedRule, error) {
+	if firewallID == "" {
+		firewallID = s.config.DigitalOcean.FirewallID
+	}
+	if rule.Window.Enabled() {
+		return nil, fmt.Errorf("rules added at runtime cannot have an access window")
+	}
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	managed := state.ManagedRule{
+		FirewallID: firewallID,
+		Port:       rule.Port,
+		Protocol:   rule.Protocol,
+		AddedBy:    addedBy,
+		AddedAt:    s.clock.Now().UTC(),
+	}
+	fields := []zap.Field{
+		zap.String("firewall_id", firewallID),
+		zap.Int("port", managed.Port),
+		zap.String("protocol", managed.Protocol),
+		zap.String("added_by", addedBy),
+	}
+
+	err := s.stateStore.Update(func(st *state.State) error {
+		targets := s.targets(st)
+		index := slices.IndexFunc(targets, func(target config.FirewallTarget) bool {
+			return target.ID == firewallID
+		})
+		if index < 0 {
+			return fmt.Errorf("unknown firewall %s: rules can only be added to configured firewalls", firewallID)
+		}
+
+		for _, existing := range targets[index].InboundRules {
+			if existing.Port != rule.Port {
+				continue
+			}
+			for _, protocol := range rule.Protocols() {
+				if slices.Contains(existing.Protocols(), protocol) {
+					return fmt.Errorf("%w: %s/%d on firewall %s", ErrRuleManaged, protocol, rule.Port, firewallID)
+				}
+			}
+		}
+
+		if s.dryRun || s.digitalOceanClient.IsReadOnly() {
+			return errDryRun
+		}
+		st.ManagedRules = append(st.ManagedRules, managed)
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		s.logger.Info("DRY RUN: Would add managed rule", fields...)
+		return &managed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Added managed rule", fields...)
+	return &managed, nil
+}
+
+// ManagedRules returns the rules added to firewalls at runtime, in the order they were added
+func (s *Service) ManagedRules() ([]state.ManagedRule, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	return st.ManagedRules, nil
+}
+
+// targets returns the configured firewalls with the rules added to them at runtime appended to
+// their configured rules
+func (s *Service) targets(st *state.State) []config.FirewallTarget {
+	targets := s.config.DigitalOcean.Targets()
+	for i, target := range targets {
+		added := st.ManagedRulesFor(target.ID)
+		if len(added) == 0 {
+			continue
+		}
+
+		rules := slices.Clone(target.InboundRules)
+		for _, rule := range added {
+			rules = append(rules, config.InboundRule{Port: rule.Port, Protocol: rule.Protocol})
+		}
+		targets[i].InboundRules = rules
+	}
+	return targets
+}
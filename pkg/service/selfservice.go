@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap"
+)
+
+// ErrNotPermitted is returned by AllowSelfService for a request the user's policy does not allow
+var ErrNotPermitted = errors.New("not permitted by the self-service policy")
+
+// AllowSelfService allowlists ip on the port for ttl on behalf of the signed-in identity, within
+// the limits of the first self-service policy matching it
+func (s *Service) AllowSelfService(ctx context.Context, identity, ip string, port int, ttl time.Duration) (*state.AccessGrant, error) {
+	policy, ok := s.config.SelfService.PolicyFor(identity)
+	if !ok {
+		return nil, fmt.Errorf("%w: no policy for %s", ErrNotPermitted, identity)
+	}
+	if !containsPort(policy.Ports, port) {
+		return nil, fmt.Errorf("%w: port %d is not allowed for %s", ErrNotPermitted, port, identity)
+	}
+	if ttl <= 0 || ttl > policy.MaxTTL {
+		return nil, fmt.Errorf("%w: duration must be between 0 and %s", ErrNotPermitted, policy.MaxTTL)
+	}
+	if net.ParseIP(ip) == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	id, err := newGrantID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now().UTC()
+	grant := state.AccessGrant{
+		ID:         id,
+		Kind:       state.GrantSelfService,
+		FirewallID: s.config.DigitalOcean.FirewallID,
+		Port:       port,
+		IP:         ip,
+		Identity:   identity,
+		GrantedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	fields := []zap.Field{
+		zap.String("grant_id", grant.ID),
+		zap.String("identity", grant.Identity),
+		zap.String("source_ip", grant.IP),
+		zap.Int("port", grant.Port),
+		zap.Time("expires_at", grant.ExpiresAt),
+	}
+
+	if s.dryRun || s.digitalOceanClient.IsReadOnly() {
+		s.logger.Info("DRY RUN: Would allow self-service IP", fields...)
+		return &grant, nil
+	}
+
+	if err := s.openAccessGrant(ctx, grant); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Allowed self-service IP", fields...)
+	return &grant, nil
+}
+
+// newGrantID generates a random identifier for an access grant
+func newGrantID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate grant id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// containsPort reports whether ports contains port
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
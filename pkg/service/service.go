@@ -2,107 +2,1631 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/kholisrag/do-firewall-allowlister/pkg/audit"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/export"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/lock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/notify"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/publish"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/scheduler"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/signing"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/cloudflare"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/dns"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/dyndns"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/google"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/httplist"
 	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/netdata"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources/probes"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/tracecontext"
 	"go.uber.org/zap"
 )
 
+// listClient fetches the list of a source published over HTTP: a sources.http, sources.google or
+// sources.probes list
+type listClient interface {
+	Name() string
+	FetchIPs(ctx context.Context) ([]string, error)
+	FetchIPsWithRetry(ctx context.Context, maxRetries int) ([]string, error)
+}
+
+// recentEventLimit bounds how many account actions are included in the status
+const recentEventLimit = 10
+
 // Service orchestrates the firewall update process
 type Service struct {
 	config             *config.Config
 	digitalOceanClient *digitalocean.Client
 	cloudflareClient   *cloudflare.Client
 	netdataClient      *netdata.Client
+	httpClients        []listClient
+	dnsClients         map[string]*dns.Client
+	dynDNSClient       *dyndns.Client
+	stateStore         *state.Store
 	logger             *zap.Logger
 	dryRun             bool
+	sourceIPsFunc      func(*SourceIPs)
+	planFunc           func(digitalocean.Plan)
+	publisher          *publish.Publisher
+	auditLogger        *audit.Logger
+	digestWebhook      *notify.Webhook
+	trendWebhook       *notify.Webhook
+	digestTemplate     *notify.Template
+	trendTemplate      *notify.Template
+	runNotifier        *notify.Dispatcher
+	runTemplate        *notify.Template
+	auditShipper       *audit.Shipper
+	// probeClients collect the sources for ProbeHealth without logging, which the daemon does
+	// on changes, and without touching the resolution results and DNS expiry of the runs
+	probeClients sourceClients
+	// clock decides access windows, grant expiry and run times; the simulate command fakes it
+	clock clock.Clock
+	// planMu keeps the plans of firewalls updated concurrently from interleaving
+	planMu sync.Mutex
+}
+
+// NewDigitalOceanClient creates a DigitalOcean client honoring the read-only, token file, lock,
+// audit, snapshot and retry settings, recording its changes with auditLogger
+func NewDigitalOceanClient(cfg *config.Config, auditLogger *audit.Logger, logger *zap.Logger) *digitalocean.Client {
+	return digitalocean.NewClient(cfg.DigitalOcean.APIKey, logger,
+		digitalocean.WithReadOnly(cfg.ReadOnly),
+		digitalocean.WithTokenFile(cfg.DigitalOcean.APIKeyFile),
+		digitalocean.WithRuleCompaction(cfg.DigitalOcean.CompactRules),
+		digitalocean.WithLocalIPv6(cfg.DigitalOcean.AllowLocalIPv6),
+		digitalocean.WithRetry(cfg.DigitalOcean.Retry.Retries, cfg.DigitalOcean.Retry.MinBackoff, cfg.DigitalOcean.Retry.MaxBackoff),
+		digitalocean.WithLock(lock.NewLocker(cfg.Lock.Path, logger), cfg.Lock.Timeout),
+		digitalocean.WithAudit(auditLogger),
+		digitalocean.WithSnapshots(state.NewSnapshotStore(cfg.State.SnapshotsPath(), cfg.State.Snapshots, logger)),
+	)
+}
+
+// NewService creates a new service instance
+func NewService(cfg *config.Config, logger *zap.Logger, dryRun bool) *Service {
+	auditLogger := audit.NewLogger(cfg.Audit.Path, cfg.Logging.GlobalFields(), logger)
+	doClient := NewDigitalOceanClient(cfg, auditLogger, logger)
+	clients := newSourceClients(cfg, logger)
+
+	// The configuration is validated on load, so a failure here only disables publishing
+	var publisher *publish.Publisher
+	if p := cfg.Publish; p.Endpoint != "" {
+		var err error
+		publisher, err = publish.NewPublisher(p.Endpoint, p.Region, p.Bucket, p.Prefix, p.AccessKey, p.SecretKey, logger)
+		if err != nil {
+			logger.Named("service").Error("Allowlist publishing disabled", zap.Error(err))
+		}
+	}
+
+	var digestWebhook *notify.Webhook
+	if cfg.Digest.WebhookURL != "" {
+		digestWebhook = notify.NewWebhook(cfg.Digest.WebhookURL, logger)
+	}
+
+	var trendWebhook *notify.Webhook
+	if cfg.Trends.WebhookURL != "" {
+		trendWebhook = notify.NewWebhook(cfg.Trends.WebhookURL, logger)
+	}
+
+	// The templates are validated on load too, a failure here keeps the default wording
+	digestTemplate, err := notify.ParseTemplate(cfg.Notify.Digest.Title, cfg.Notify.Digest.Body)
+	if err != nil {
+		logger.Named("service").Error("Change digest template ignored", zap.Error(err))
+	}
+	trendTemplate, err := notify.ParseTemplate(cfg.Notify.Trends.Title, cfg.Notify.Trends.Body)
+	if err != nil {
+		logger.Named("service").Error("Source size alert template ignored", zap.Error(err))
+	}
+
+	runTemplate, err := notify.ParseTemplate(cfg.Notify.Run.Title, cfg.Notify.Run.Body)
+	if err != nil {
+		logger.Named("service").Error("Run notification template ignored", zap.Error(err))
+	}
+
+	channels := make([]notify.Channel, 0, len(cfg.Notify.Webhooks)+1)
+	for _, webhook := range cfg.Notify.Webhooks {
+		channel := notify.NewWebhook(webhook.URL, logger, notify.WithFormat(webhook.Format))
+		channels = append(channels, notify.Filtered(channel,
+			notifyFilter(cfg, webhook.FailuresOnly, webhook.MinSeverity, webhook.QuietHours)))
+	}
+	if email := cfg.Notify.Email; email.Host != "" {
+		channel := notify.NewEmail(email.Host, email.Port, email.TLS,
+			email.Username, email.Password, email.From, email.To, logger)
+		channels = append(channels, notify.Filtered(channel,
+			notifyFilter(cfg, email.FailuresOnly, email.MinSeverity, email.QuietHours)))
+	}
+
+	// Like publishing, an invalid shipping setting only disables shipping
+	var auditShipper *audit.Shipper
+	if ship := cfg.Audit.Ship; ship.Type != "" {
+		var err error
+		auditShipper, err = audit.NewShipper(ship.Type, ship.URL, ship.Token, ship.Index, ship.BatchSize, ship.Retries, logger)
+		if err != nil {
+			logger.Named("service").Error("Audit shipping disabled", zap.Error(err))
+		}
+	}
+
+	return &Service{
+		config:             cfg,
+		digitalOceanClient: doClient,
+		cloudflareClient:   clients.cloudflare,
+		netdataClient:      clients.netdata,
+		httpClients:        clients.http,
+		dnsClients:         clients.dns,
+		probeClients:       newSourceClients(cfg, zap.NewNop()),
+		dynDNSClient:       dyndns.NewClient(logger),
+		stateStore:         state.NewStore(cfg.State.Path, logger),
+		logger:             logger.Named("service"),
+		dryRun:             dryRun,
+		publisher:          publisher,
+		auditLogger:        auditLogger,
+		digestWebhook:      digestWebhook,
+		trendWebhook:       trendWebhook,
+		digestTemplate:     digestTemplate,
+		trendTemplate:      trendTemplate,
+		runNotifier:        notify.NewDispatcher(logger, channels...),
+		runTemplate:        runTemplate,
+		auditShipper:       auditShipper,
+		clock:              clock.Real,
+	}
+}
+
+// sourceClients collect the fetched sources: Cloudflare, Netdata, the HTTP lists and the DNS sources
+type sourceClients struct {
+	cloudflare *cloudflare.Client
+	netdata    *netdata.Client
+	http       []listClient
+	dns        map[string]*dns.Client
+}
+
+// newSourceClients creates the clients of every configured source
+func newSourceClients(cfg *config.Config, logger *zap.Logger) sourceClients {
+	clients := sourceClients{
+		cloudflare: cloudflare.NewClient(cfg.Cloudflare.IPsURL, logger),
+		netdata: netdata.NewClient(logger,
+			dns.WithServer(cfg.Netdata.Resolver),
+			dns.WithDoH(cfg.Netdata.DoH),
+			dns.WithTimeout(cfg.Netdata.Timeout)),
+		dns: make(map[string]*dns.Client, len(cfg.Sources.DNS)),
+	}
+	clients.netdata.SetRequired(cfg.Netdata.Required())
+
+	// Like publishing, a parser error here cannot happen with a validated configuration
+	for _, source := range cfg.Sources.HTTP {
+		parser, err := httplist.NewParser(source.Format, source.Paths, source.Column, source.SkipHeader)
+		if err != nil {
+			logger.Named("service").Error("HTTP source disabled", zap.String("source", source.Name), zap.Error(err))
+			continue
+		}
+		clients.http = append(clients.http, httplist.NewClient(source.Name, source.URL, parser, logger))
+	}
+	for _, source := range cfg.Sources.Google {
+		url := source.URL
+		if url == "" {
+			url = google.URLs[source.List]
+		}
+		clients.http = append(clients.http, google.NewClient(source.Name, url, source.Scopes, logger))
+	}
+	for _, source := range cfg.Sources.Probes {
+		url := source.URL
+		if url == "" {
+			url = probes.URLs[source.Provider]
+		}
+		clients.http = append(clients.http, probes.NewClient(source.SourceName(), source.Provider, url, source.Token, logger))
+	}
+
+	for _, source := range cfg.Sources.DNS {
+		clients.dns[source.Name] = dns.NewClient(source.Name, logger,
+			dns.WithServer(source.Resolver),
+			dns.WithDoH(source.DoH),
+			dns.WithTimeout(source.Timeout),
+			dns.WithRecordTypes(source.RecordTypes))
+	}
+	return clients
+}
+
+// UpdateFirewallRules performs the complete firewall update process for every configured firewall;
+// the addresses are collected once and a failing firewall does not stop the others from updating.
+// The retries of the run share run.retry-budget and the run is cancelled at run.deadline
+func (s *Service) UpdateFirewallRules(ctx context.Context) error {
+	ctx = retrybudget.WithBudget(ctx, s.config.Run.RetryBudget)
+	if s.config.Run.Deadline <= 0 {
+		return s.updateFirewallRules(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Run.Deadline)
+	defer cancel()
+	err := s.updateFirewallRules(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("firewall update exceeded run.deadline of %s: %w", s.config.Run.Deadline, err)
+	}
+	return err
+}
+
+// updateFirewallRules is UpdateFirewallRules within the limits of the run
+func (s *Service) updateFirewallRules(ctx context.Context) error {
+	// Sources read by several firewalls or rules are fetched once per run
+	ctx = sources.WithRunCache(ctx)
+
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	// Rules added through the admin API are managed like the configured ones
+	targets := s.targets(st)
+	fields := []zap.Field{
+		zap.String("firewall_id", s.config.DigitalOcean.FirewallID),
+		zap.Int("firewalls", len(targets)),
+		zap.Bool("dry_run", s.dryRun),
+		zap.Bool("read_only", s.config.ReadOnly),
+	}
+
+	// Run as a child span of the triggering caller so audit records join its trace
+	if caller, ok := tracecontext.FromContext(ctx); ok {
+		span := caller.Child()
+		ctx = tracecontext.NewContext(ctx, span)
+		fields = append(fields,
+			zap.String("trace_id", span.TraceID),
+			zap.String("span_id", span.SpanID),
+			zap.String("parent_span_id", span.ParentID))
+	}
+	s.logger.Info("Starting firewall rules update", fields...)
+
+	// Locked down and frozen firewalls are left alone, and nothing is collected if all of them are
+	active := make([]config.FirewallTarget, 0, len(targets))
+	for _, target := range targets {
+		if !s.isHalted(st, target.ID) {
+			active = append(active, target)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	// Collect the addresses from every allowlist source
+	sourceIPs, err := s.CollectSourceIPs(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = audit.WithLabels(ctx, sourceIPs.Labels())
+	// Runs that apply nothing leave the size history alone, it is the baseline of the next alert
+	if !s.config.Lite && !s.dryRun && !s.digitalOceanClient.IsReadOnly() {
+		s.trackSourceSizes(ctx, sourceIPs)
+	}
+
+	if len(targets) == 1 {
+		outcome, err := s.updateFirewall(ctx, active[0], sourceIPs)
+		if err != nil || !outcome.applied() {
+			return err
+		}
+		s.publishAllowlist(ctx, sourceIPs)
+		return nil
+	}
+
+	// A failing firewall does not stop the others, the run reports every outcome at the end; up to
+	// digitalocean.workers firewalls are updated at the same time from the shared addresses
+	results := make([]FirewallResult, len(targets))
+	workers := make(chan struct{}, max(s.config.DigitalOcean.Workers, 1))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		results[i] = FirewallResult{FirewallID: target.ID, Outcome: FirewallSkipped}
+		if !slices.ContainsFunc(active, func(a config.FirewallTarget) bool { return a.ID == target.ID }) {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			outcome, err := s.updateFirewall(ctx, target, sourceIPs)
+			if err != nil {
+				s.logger.Error("Failed to update firewall, continuing with the other firewalls",
+					zap.String("firewall_id", target.ID),
+					zap.Error(err))
+				outcome = FirewallFailed
+			}
+			results[i].Outcome, results[i].Err = outcome, err
+		}()
+	}
+	wg.Wait()
+
+	counts := make(map[FirewallOutcome]int)
+	for _, result := range results {
+		counts[result.Outcome]++
+	}
+
+	s.logger.Info("Finished updating firewalls",
+		zap.Int("firewalls", len(targets)),
+		zap.Int("workers", cap(workers)),
+		zap.Int("updated", counts[FirewallUpdated]),
+		zap.Int("unchanged", counts[FirewallUnchanged]),
+		zap.Int("skipped", counts[FirewallSkipped]),
+		zap.Int("failed", counts[FirewallFailed]))
+
+	if counts[FirewallUpdated]+counts[FirewallUnchanged] > 0 {
+		s.publishAllowlist(ctx, sourceIPs)
+	}
+	if counts[FirewallFailed] > 0 {
+		return &UpdateError{Results: results}
+	}
+	return nil
+}
+
+// isHalted reports whether automation of the firewall is halted by an emergency lockdown or a
+// freeze, logging why it is skipped
+func (s *Service) isHalted(st *state.State, firewallID string) bool {
+	// Skip automation entirely while an emergency lockdown is active
+	if lockdown := st.ActiveLockdown(firewallID); lockdown != nil {
+		s.logger.Warn("Firewall is locked down, skipping update",
+			zap.String("firewall_id", lockdown.FirewallID),
+			zap.Ints("ports", lockdown.Ports),
+			zap.String("locked_by", lockdown.LockedBy),
+			zap.Time("locked_at", lockdown.LockedAt))
+		return true
+	}
+	if freeze := st.ActiveFreeze(firewallID); freeze != nil {
+		s.logger.Error("Firewall is frozen, skipping update until unfreeze is run",
+			zap.String("firewall_id", freeze.FirewallID),
+			zap.String("reason", freeze.Reason),
+			zap.String("frozen_by", freeze.FrozenBy),
+			zap.Time("frozen_at", freeze.FrozenAt))
+		return true
+	}
+
+	return false
+}
+
+// updateFirewall updates the rules of one firewall from the collected addresses, reporting whether
+// the rules were updated, already up to date, or skipped by a freeze tag or a dry run
+func (s *Service) updateFirewall(ctx context.Context, target config.FirewallTarget, sourceIPs *SourceIPs) (FirewallOutcome, error) {
+	// Dynamic DNS hostnames point into the SSH rule of firewall-id only
+	primary := target.ID == s.config.DigitalOcean.FirewallID
+
+	allIPs := sourceIPs.Select(target.Sources)
+	firewallRules, err := s.firewallRules(target, sourceIPs, allIPs)
+	if err != nil {
+		return FirewallFailed, err
+	}
+
+	// Read-only mode reports like dry-run; the client would reject the update anyway
+	if s.dryRun || s.digitalOceanClient.IsReadOnly() {
+		plan, err := s.digitalOceanClient.PlanFirewallRules(ctx, target.ID, firewallRules, allIPs)
+		if err != nil {
+			return FirewallFailed, fmt.Errorf("failed to plan firewall rules: %w", err)
+		}
+
+		added, removed := plan.Counts()
+		s.logger.Info("DRY RUN: Would update firewall with the following changes",
+			zap.String("firewall_id", target.ID),
+			zap.Int("added_sources", added),
+			zap.Int("removed_sources", removed),
+			zap.Int("collected_count", len(allIPs)))
+		for _, rule := range plan.Rules {
+			if rule.Action == digitalocean.RuleUnchanged {
+				continue
+			}
+			s.logger.Info("DRY RUN: Firewall rule",
+				zap.String("firewall_id", target.ID),
+				zap.String("rule", rule.Rule),
+				zap.String("action", string(rule.Action)),
+				zap.Int("added_sources", len(rule.Added)),
+				zap.Int("removed_sources", len(rule.Removed)),
+				zap.Int("kept_sources", rule.Kept))
+		}
+		if s.planFunc != nil {
+			s.planMu.Lock()
+			s.planFunc(*plan)
+			s.planMu.Unlock()
+		}
+		if primary {
+			return FirewallSkipped, s.updateDynamicDNS(ctx)
+		}
+		return FirewallSkipped, nil
+	}
+
+	// Responders can also freeze the firewall by tagging it in the DigitalOcean console
+	frozen, err := s.digitalOceanClient.IsFrozen(ctx, target.ID, s.config.DigitalOcean.FreezeTag)
+	if err != nil {
+		return FirewallFailed, fmt.Errorf("failed to check freeze tag: %w", err)
+	}
+	if frozen {
+		s.logger.Error("Firewall is frozen by tag, skipping update until the tag is removed",
+			zap.String("firewall_id", target.ID),
+			zap.String("tag", s.config.DigitalOcean.FreezeTag))
+		return FirewallSkipped, nil
+	}
+
+	// Update firewall rules; the client validates and normalizes the combined sources once
+	normalized, changed, err := s.digitalOceanClient.UpdateFirewallRules(ctx, target.ID, firewallRules, allIPs)
+	if err != nil {
+		return FirewallFailed, fmt.Errorf("failed to update firewall rules: %w", err)
+	}
+
+	// Duplicates and equivalent spellings across sources collapse during normalization
+	message := "Successfully completed firewall rules update"
+	if !changed {
+		message = "Firewall rules update completed with no changes"
+	}
+	s.logger.Info(message,
+		zap.String("firewall_id", target.ID),
+		zap.Int("total_rules", len(firewallRules)),
+		zap.Int("total_source_ips", len(allIPs)),
+		zap.Int("normalized_source_ips", len(normalized)),
+		zap.Bool("changed", changed))
+	s.logger.Debug("Normalized source set", zap.String("firewall_id", target.ID), zap.Strings("sources", normalized))
+
+	if primary {
+		if err := s.updateDynamicDNS(ctx); err != nil {
+			return FirewallFailed, err
+		}
+	}
+
+	outcome := FirewallUpdated
+	if !changed {
+		outcome = FirewallUnchanged
+	}
+	return outcome, s.recordSuccessfulRun(target, s.clock.Now())
+}
+
+// firewallRules converts the inbound rules of a firewall to the rules its update writes, allowing
+// allIPs, or the sources a rule selects, on the rules inside their access windows
+func (s *Service) firewallRules(target config.FirewallTarget, sourceIPs *SourceIPs, allIPs []string) ([]digitalocean.FirewallRule, error) {
+	var firewallRules []digitalocean.FirewallRule
+	for _, rule := range target.InboundRules {
+		active, err := s.isRuleActive(rule, s.clock.Now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate access window for port %d: %w", rule.Port, err)
+		}
+
+		if !active {
+			s.logger.Info("Rule is outside its access window, it will be removed",
+				zap.String("firewall_id", target.ID),
+				zap.Int("port", rule.Port),
+				zap.String("protocol", rule.Protocol),
+				zap.String("window_open", rule.Window.Open),
+				zap.String("window_close", rule.Window.Close))
+		}
+
+		// A rule selecting its own sources allows those rather than the firewall's
+		ruleIPs := allIPs
+		if len(rule.Sources) > 0 {
+			ruleIPs = sourceIPs.Select(rule.Sources)
+		}
+
+		for _, protocol := range rule.Protocols() {
+			firewallRules = append(firewallRules, digitalocean.FirewallRule{
+				Port:       rule.Port,
+				Protocol:   protocol,
+				Sources:    ruleIPs,
+				OwnSources: len(rule.Sources) > 0,
+				Inactive:   !active,
+				Tags:       rule.SourceTags,
+				DropletIDs: rule.SourceDropletIDs,
+			})
+		}
+	}
+	return firewallRules, nil
+}
+
+// PlanFirewallRules collects the addresses and diffs the inbound rules of every firewall that is
+// not locked down or frozen against the rules the next update would write, changing nothing
+func (s *Service) PlanFirewallRules(ctx context.Context) ([]digitalocean.Plan, error) {
+	planned, err := s.PlanFirewallUpdates(ctx)
+	if err != nil || planned == nil {
+		return nil, err
+	}
+
+	plans := make([]digitalocean.Plan, 0, len(planned))
+	for _, firewall := range planned {
+		plans = append(plans, firewall.Plan)
+	}
+	return plans, nil
+}
+
+// PlanFirewallUpdates plans like PlanFirewallRules, keeping the inbound rules each update would
+// write so that ApplyPlanFile can write them once the plan is approved
+func (s *Service) PlanFirewallUpdates(ctx context.Context) ([]digitalocean.PlannedFirewall, error) {
+	ctx = sources.WithRunCache(ctx)
+
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	var active []config.FirewallTarget
+	for _, target := range s.targets(st) {
+		if !s.isHalted(st, target.ID) {
+			active = append(active, target)
+		}
+	}
+	if len(active) == 0 {
+		return nil, nil
+	}
+
+	sourceIPs, err := s.CollectSourceIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	planned := make([]digitalocean.PlannedFirewall, 0, len(active))
+	for _, target := range active {
+		allIPs := sourceIPs.Select(target.Sources)
+		firewallRules, err := s.firewallRules(target, sourceIPs, allIPs)
+		if err != nil {
+			return nil, err
+		}
+
+		firewall, err := s.digitalOceanClient.PlanFirewallUpdate(ctx, target.ID, firewallRules, allIPs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan firewall %s: %w", target.ID, err)
+		}
+		planned = append(planned, *firewall)
+	}
+	return planned, nil
+}
+
+// ApplyPlanFile writes the inbound rules of a reviewed plan to its firewalls as they are, without
+// collecting the sources again. Every firewall is first verified to still have the rules it was
+// planned against; if any changed since planning nothing is written and those firewalls fail.
+// Otherwise firewalls locked down or frozen since planning are skipped and firewalls no longer
+// configured fail; like UpdateFirewallRules, a failing firewall does not stop the others and the
+// results list every firewall of the plan
+func (s *Service) ApplyPlanFile(ctx context.Context, file *digitalocean.PlanFile) ([]FirewallResult, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	targets := make(map[string]config.FirewallTarget)
+	for _, target := range s.targets(st) {
+		targets[target.ID] = target
+	}
+
+	s.logger.Info("Applying plan file",
+		zap.Time("created_at", file.CreatedAt),
+		zap.Int("firewalls", len(file.Firewalls)))
+
+	if results, ok := s.verifyPlanFile(ctx, st, targets, file); !ok {
+		return results, &UpdateError{Results: results}
+	}
+
+	results := make([]FirewallResult, len(file.Firewalls))
+	failed := false
+	for i, planned := range file.Firewalls {
+		outcome, err := s.applyPlannedFirewall(ctx, st, targets, planned)
+		if err != nil {
+			s.logger.Error("Failed to apply planned firewall, continuing with the other firewalls",
+				zap.String("firewall_id", planned.FirewallID),
+				zap.Error(err))
+			outcome, failed = FirewallFailed, true
+		}
+		results[i] = FirewallResult{FirewallID: planned.FirewallID, Outcome: outcome, Err: err}
+	}
+
+	if failed {
+		return results, &UpdateError{Results: results}
+	}
+	return results, nil
+}
+
+// verifyPlanFile checks, before anything is written, that every configured and active firewall of
+// the plan still has the rules it was planned against. When one does not, it reports false with
+// the results of an aborted apply: the firewalls that failed verification and the others skipped
+func (s *Service) verifyPlanFile(
+	ctx context.Context,
+	st *state.State,
+	targets map[string]config.FirewallTarget,
+	file *digitalocean.PlanFile,
+) ([]FirewallResult, bool) {
+	results := make([]FirewallResult, len(file.Firewalls))
+	verified := true
+	for i, planned := range file.Firewalls {
+		results[i] = FirewallResult{FirewallID: planned.FirewallID, Outcome: FirewallSkipped}
+		if _, ok := targets[planned.FirewallID]; !ok || s.isHalted(st, planned.FirewallID) {
+			continue
+		}
+		if err := s.digitalOceanClient.VerifyPlannedFirewall(ctx, planned); err != nil {
+			s.logger.Error("Planned firewall failed verification, not applying the plan",
+				zap.String("firewall_id", planned.FirewallID),
+				zap.Error(err))
+			results[i] = FirewallResult{FirewallID: planned.FirewallID, Outcome: FirewallFailed, Err: err}
+			verified = false
+		}
+	}
+	return results, verified
+}
+
+// applyPlannedFirewall writes the planned rules of one firewall, reporting whether they were
+// written, already in place, or skipped by a lockdown or freeze
+func (s *Service) applyPlannedFirewall(
+	ctx context.Context,
+	st *state.State,
+	targets map[string]config.FirewallTarget,
+	planned digitalocean.PlannedFirewall,
+) (FirewallOutcome, error) {
+	target, ok := targets[planned.FirewallID]
+	if !ok {
+		return FirewallFailed, fmt.Errorf("firewall %s is not configured", planned.FirewallID)
+	}
+	if s.isHalted(st, target.ID) {
+		return FirewallSkipped, nil
+	}
+
+	frozen, err := s.digitalOceanClient.IsFrozen(ctx, target.ID, s.config.DigitalOcean.FreezeTag)
+	if err != nil {
+		return FirewallFailed, fmt.Errorf("failed to check freeze tag: %w", err)
+	}
+	if frozen {
+		s.logger.Error("Firewall is frozen by tag, skipping planned update",
+			zap.String("firewall_id", target.ID),
+			zap.String("tag", s.config.DigitalOcean.FreezeTag))
+		return FirewallSkipped, nil
+	}
+
+	changed, err := s.digitalOceanClient.ApplyPlannedFirewall(ctx, planned)
+	if err != nil {
+		return FirewallFailed, fmt.Errorf("failed to apply planned rules: %w", err)
+	}
+
+	outcome := FirewallUpdated
+	if !changed {
+		outcome = FirewallUnchanged
+	}
+	return outcome, s.recordSuccessfulRun(target, s.clock.Now())
+}
+
+// publishAllowlist uploads the applied allowlist when publishing is configured; failures are
+// logged rather than failing a run whose firewall update already succeeded
+func (s *Service) publishAllowlist(ctx context.Context, sourceIPs *SourceIPs) {
+	if s.publisher == nil {
+		return
+	}
+
+	if err := s.publisher.Publish(ctx, sourceIPs.Entries()); err != nil {
+		s.logger.Error("Failed to publish allowlist", zap.Error(err))
+	}
+}
+
+// trackSourceSizes records the size of every source's address set and alerts when it changed by
+// more than trends.max-change-percent since the previous run; like publishing, failures are only
+// logged so a broken alert channel never stops an update
+func (s *Service) trackSourceSizes(ctx context.Context, sourceIPs *SourceIPs) {
+	firewallID := s.config.DigitalOcean.FirewallID
+	now := s.clock.Now()
+	counts := sourceIPs.Counts()
+
+	var alerts []string
+	err := s.stateStore.Update(func(st *state.State) error {
+		for _, source := range sourceIPs.Names() {
+			count := counts[source]
+			previous := st.RecordSourceSize(firewallID, source, count, now)
+			if previous == nil || s.config.Trends.MaxChangePercent == 0 {
+				continue
+			}
+
+			change := previous.ChangePercent(count)
+			if change <= float64(s.config.Trends.MaxChangePercent) {
+				continue
+			}
+			s.logger.Warn("Source address set changed sharply since the previous run",
+				zap.String("source", source),
+				zap.Int("previous_count", previous.Count),
+				zap.Int("count", count),
+				zap.Float64("change_percent", change),
+				zap.Time("previous_at", previous.At))
+			alerts = append(alerts, fmt.Sprintf("%s: %d -> %d addresses (%.0f%% change since %s)",
+				source, previous.Count, count, change, previous.At.Format(time.RFC3339)))
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to record source sizes", zap.Error(err))
+		return
+	}
+
+	if len(alerts) == 0 || s.trendWebhook == nil {
+		return
+	}
+	msg, err := s.trendTemplate.Render(notify.TemplateData{
+		Kind:        notify.KindSourceSizeAlert,
+		Environment: s.config.Notify.Environment,
+		FirewallID:  firewallID,
+		Time:        now,
+		Alerts:      alerts,
+		Title: fmt.Sprintf("Source address sets of firewall %s changed by more than %d%% since the previous run:",
+			firewallID, s.config.Trends.MaxChangePercent),
+		Text: strings.Join(alerts, "\n"),
+	})
+	if err != nil {
+		s.logger.Error("Failed to render source size alert", zap.Error(err))
+		return
+	}
+	if err := s.trendWebhook.Send(ctx, msg); err != nil {
+		s.logger.Error("Failed to send source size alert", zap.Error(err))
+	}
+}
+
+// SourceSizeChanges returns the size change in percent between the last two collections of every
+// source, for sources collected at least twice
+func (s *Service) SourceSizeChanges() (map[string]float64, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	changes := make(map[string]float64)
+	for _, source := range s.sourceNames() {
+		history := st.SourceSizeHistory(s.config.DigitalOcean.FirewallID, source)
+		if len(history) < 2 {
+			continue
+		}
+		changes[source] = history[len(history)-2].ChangePercent(history[len(history)-1].Count)
+	}
+	return changes, nil
+}
+
+// recordSuccessfulRun stores when the update of a firewall last succeeded and the configuration it
+// applied so missed runs and configuration edits can be detected on restart, and the ports it
+// wrote rules for so gc can remove them once unconfigured
+func (s *Service) recordSuccessfulRun(target config.FirewallTarget, at time.Time) error {
+	configHash := s.config.Hash()
+	ports := make([]int, 0, len(target.InboundRules))
+	for _, rule := range target.InboundRules {
+		ports = append(ports, rule.Port)
+	}
+
+	err := s.stateStore.Update(func(st *state.State) error {
+		st.SetLastSuccessfulRun(target.ID, at)
+		st.SetAppliedConfigHash(target.ID, configHash)
+		st.RecordManagedPorts(target.ID, ports)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record successful run: %w", err)
+	}
+	return nil
+}
+
+// LastSuccessfulRun returns when the update last succeeded for the configured firewall, or the
+// zero time if it never did
+func (s *Service) LastSuccessfulRun() (time.Time, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load state: %w", err)
+	}
+	return st.LastSuccessfulRun(s.config.DigitalOcean.FirewallID), nil
+}
+
+// LastSuccessfulRuns returns when the update last succeeded for every configured firewall that
+// was updated at least once
+func (s *Service) LastSuccessfulRuns() (map[string]time.Time, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	runs := make(map[string]time.Time)
+	for _, target := range s.config.DigitalOcean.Targets() {
+		if last := st.LastSuccessfulRun(target.ID); !last.IsZero() {
+			runs[target.ID] = last
+		}
+	}
+	return runs, nil
+}
+
+// NoteConfigChange returns the firewalls whose last successful update applied another
+// configuration than the loaded one, adding a config_changed note to the audit log of each;
+// firewalls last updated by a release that did not record the configuration are left out
+func (s *Service) NoteConfigChange() ([]string, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	configHash := s.config.Hash()
+	var changed []string
+	for _, target := range s.config.DigitalOcean.Targets() {
+		applied := st.AppliedConfigHash(target.ID)
+		if applied == "" || applied == configHash {
+			continue
+		}
+		changed = append(changed, target.ID)
+
+		err := s.auditLogger.Record(audit.Record{
+			Time:       s.clock.Now().UTC(),
+			Action:     "config_changed",
+			FirewallID: target.ID,
+			Fields:     map[string]string{"config_hash": configHash, "previous_config_hash": applied},
+		})
+		if err != nil {
+			s.logger.Warn("Failed to note configuration change in audit log",
+				zap.String("firewall_id", target.ID),
+				zap.Error(err))
+		}
+	}
+	return changed, nil
+}
+
+// RecordDaemonStart records the daemon of this process in the state file
+func (s *Service) RecordDaemonStart(record state.DaemonRecord) error {
+	err := s.stateStore.Update(func(st *state.State) error {
+		st.RecordDaemonStart(record)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record daemon start: %w", err)
+	}
+	return nil
+}
+
+// RecordDaemonStop records that the daemon of the process pid stopped
+func (s *Service) RecordDaemonStop(pid int, at time.Time) error {
+	err := s.stateStore.Update(func(st *state.State) error {
+		st.RecordDaemonStop(pid, at)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record daemon stop: %w", err)
+	}
+	return nil
+}
+
+// DaemonRecord returns the daemon last started on the state file, or nil if none ever was
+func (s *Service) DaemonRecord() (*state.DaemonRecord, error) {
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	return st.Daemon, nil
+}
+
+// updateDynamicDNS points the SSH rule of every configured dynamic-DNS hostname at the addresses it
+// currently resolves to, removing the addresses it resolved to on the previous run
+func (s *Service) updateDynamicDNS(ctx context.Context) error {
+	firewallID := s.config.DigitalOcean.FirewallID
+
+	for _, entry := range s.config.DigitalOcean.DynamicDNS {
+		ips, err := s.dynDNSClient.ResolveWithRetry(ctx, entry.Hostname, 3)
+		if err != nil {
+			return fmt.Errorf("failed to resolve dynamic DNS hostname: %w", err)
+		}
+		if ips, err = s.screenReserved(entry.Hostname, ips); err != nil {
+			return err
+		}
+		// Keep the last good addresses rather than closing the port over a bad lookup
+		if len(ips) == 0 {
+			s.logger.Warn("Dynamic DNS hostname resolved only to reserved addresses, leaving its rule unchanged",
+				zap.String("hostname", entry.Hostname))
+			continue
+		}
+
+		if s.dryRun || s.digitalOceanClient.IsReadOnly() {
+			s.logger.Info("DRY RUN: Would point SSH rule at dynamic DNS hostname",
+				zap.String("hostname", entry.Hostname),
+				zap.Int("port", entry.Port),
+				zap.Strings("ips", ips))
+			continue
+		}
+
+		st, err := s.stateStore.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		var previous []string
+		if record := st.FindDynamicDNS(entry.Hostname, firewallID, entry.Port); record != nil {
+			previous = record.IPs
+		}
+
+		// The firewall is updated before the addresses are recorded, outside the state update, so
+		// the state file is not held during the API call and never records addresses that failed
+		if err := s.digitalOceanClient.ReplaceSSHSources(ctx, firewallID, previous, ips, entry.Port); err != nil {
+			return fmt.Errorf("failed to update SSH rule for %s: %w", entry.Hostname, err)
+		}
+		err = s.stateStore.Update(func(st *state.State) error {
+			st.SetDynamicDNS(entry.Hostname, firewallID, entry.Port, ips)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("SSH rule for %s was updated but recording it failed: %w", entry.Hostname, err)
+		}
+
+		s.logger.Info("SSH rule points at dynamic DNS hostname",
+			zap.String("hostname", entry.Hostname),
+			zap.Int("port", entry.Port),
+			zap.Strings("ips", ips))
+	}
+
+	return nil
+}
+
+// SendDigest posts a summary of the changes applied since the previous digest to the digest
+// webhook; the first digest covers one schedule interval
+func (s *Service) SendDigest(ctx context.Context) error {
+	if s.digestWebhook == nil {
+		return nil
+	}
+
+	firewallID := s.config.DigitalOcean.FirewallID
+	now := s.clock.Now().UTC()
+
+	st, err := s.stateStore.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	from := st.LastDigest(firewallID)
+	if from.IsZero() {
+		interval, err := scheduler.ScheduleInterval(s.config.Digest.Schedule, s.config.Cron.Timezone, now)
+		if err != nil {
+			return fmt.Errorf("failed to determine digest period: %w", err)
+		}
+		from = now.Add(-interval)
+	}
+
+	records, err := s.auditLogger.Since(firewallID, from)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	digest := notify.Summarize(firewallID, records, from, now)
+	msg, err := s.digestTemplate.Render(notify.TemplateData{
+		Kind:         notify.KindDigest,
+		Environment:  s.config.Notify.Environment,
+		FirewallID:   firewallID,
+		FirewallName: digest.FirewallName,
+		Time:         now,
+		Changes:      digest.Changes,
+		Added:        digest.Added,
+		Removed:      digest.Removed,
+		Digest:       digest,
+		Title:        digest.Title(),
+		Text:         digest.Body(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render change digest: %w", err)
+	}
+	msg.Digest = digest
+	if err := s.digestWebhook.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send change digest: %w", err)
+	}
+
+	// Only move the period forward once the digest was delivered, so failed digests are not lost
+	err = s.stateStore.Update(func(st *state.State) error {
+		st.SetLastDigest(firewallID, now)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record change digest: %w", err)
+	}
+
+	s.logger.Info("Sent change digest",
+		zap.String("firewall_id", firewallID),
+		zap.Time("from", from),
+		zap.Int("changes", digest.Changes),
+		zap.Int("added", len(digest.Added)),
+		zap.Int("removed", len(digest.Removed)))
+	return nil
 }
 
-// NewService creates a new service instance
-func NewService(cfg *config.Config, logger *zap.Logger, dryRun bool) *Service {
-	doClient := digitalocean.NewClient(cfg.DigitalOcean.APIKey, logger)
-	cfClient := cloudflare.NewClient(cfg.Cloudflare.IPsURL, logger)
-	andClient := netdata.NewClient(logger)
+// ShipAuditLog forwards the audit records written since the last shipment to the configured
+// collector; instances and tenants sharing the audit log take turns through a lock next to it
+func (s *Service) ShipAuditLog(ctx context.Context) error {
+	if s.auditShipper == nil || s.auditLogger == nil {
+		return nil
+	}
 
-	return &Service{
-		config:             cfg,
-		digitalOceanClient: doClient,
-		cloudflareClient:   cfClient,
-		netdataClient:      andClient,
-		logger:             logger.Named("service"),
-		dryRun:             dryRun,
+	shipLock, err := lock.NewLocker(audit.CursorPath(s.auditLogger.Path())+".lock", s.logger).Acquire(ctx, s.config.Lock.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to lock audit shipping: %w", err)
+	}
+	defer func() {
+		if err := shipLock.Release(); err != nil {
+			s.logger.Warn("Failed to release audit shipping lock", zap.Error(err))
+		}
+	}()
+
+	shipped, err := s.auditShipper.Ship(ctx, s.auditLogger)
+	if shipped > 0 {
+		s.logger.Info("Shipped audit records",
+			zap.String("type", s.config.Audit.Ship.Type),
+			zap.Int("records", shipped))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ship audit log: %w", err)
 	}
+	return nil
 }
 
-// UpdateFirewallRules performs the complete firewall update process
-func (s *Service) UpdateFirewallRules(ctx context.Context) error {
-	s.logger.Info("Starting firewall rules update",
-		zap.String("firewall_id", s.config.DigitalOcean.FirewallID),
-		zap.Bool("dry_run", s.dryRun))
+// ProbeTokenScopes classifies what the DigitalOcean API token may do with the configured firewall
+func (s *Service) ProbeTokenScopes(ctx context.Context) (digitalocean.TokenScopes, error) {
+	return s.digitalOceanClient.ProbeTokenScopes(ctx, s.config.DigitalOcean.FirewallID)
+}
+
+// ReloadAPIToken re-reads the DigitalOcean API token from digitalocean.api-key-file
+func (s *Service) ReloadAPIToken() error {
+	return s.digitalOceanClient.ReloadToken()
+}
+
+// SetConfirmFunc installs a hook that must approve every firewall update before it is applied
+func (s *Service) SetConfirmFunc(fn digitalocean.ConfirmFunc) {
+	s.digitalOceanClient.SetConfirmFunc(fn)
+}
+
+// SetClock replaces the wall clock the service reads
+func (s *Service) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetAdminAccess installs a check that refuses updates removing admin access unless forced
+func (s *Service) SetAdminAccess(access *digitalocean.AdminAccess) {
+	s.digitalOceanClient.SetAdminAccess(access)
+}
+
+// RuleActive reports whether a rule is inside its access window at the service clock's time
+func (s *Service) RuleActive(rule config.InboundRule) (bool, error) {
+	return s.isRuleActive(rule, s.clock.Now())
+}
+
+// isRuleActive reports whether a rule should currently be present on the firewall
+func (s *Service) isRuleActive(rule config.InboundRule, now time.Time) (bool, error) {
+	if !rule.Window.Enabled() {
+		return true, nil
+	}
 
-	// Fetch Cloudflare IPs
-	cloudflareIPs, err := s.fetchCloudflareIPs(ctx)
+	loc, err := scheduler.LoadLocation(s.config.Cron.Timezone)
 	if err != nil {
-		return fmt.Errorf("failed to fetch Cloudflare IPs: %w", err)
+		return false, fmt.Errorf("invalid timezone %s: %w", s.config.Cron.Timezone, err)
+	}
+
+	return scheduler.InWindow(rule.Window.Open, rule.Window.Close, loc, now)
+}
+
+// SourceIPs holds the addresses collected from every allowlist source
+type SourceIPs struct {
+	Cloudflare []string `json:"cloudflare"`
+	Netdata    []string `json:"netdata"`
+	// HTTP holds the addresses of every sources.http, sources.google and sources.probes list by name
+	HTTP map[string][]string `json:"http,omitempty"`
+	// DNS holds the addresses resolved for every sources.dns entry by name
+	DNS map[string][]string `json:"dns,omitempty"`
+	// Networks holds the blocks of every sources.networks entry by name, Owners their owners
+	Networks map[string][]string `json:"networks,omitempty"`
+	Owners   map[string]string   `json:"owners,omitempty"`
+}
+
+// Names returns the sources addresses are attributed to in entries and size history: Cloudflare,
+// Netdata, then the HTTP sources, DNS sources and named networks, each by name
+func (s *SourceIPs) Names() []string {
+	names := []string{"cloudflare", "netdata"}
+	names = append(names, slices.Sorted(maps.Keys(s.HTTP))...)
+	names = append(names, slices.Sorted(maps.Keys(s.DNS))...)
+	return append(names, slices.Sorted(maps.Keys(s.Networks))...)
+}
+
+// Source returns the addresses collected from the named source
+func (s *SourceIPs) Source(name string) []string {
+	switch name {
+	case "cloudflare":
+		return s.Cloudflare
+	case "netdata":
+		return s.Netdata
+	default:
+		if ips, ok := s.HTTP[name]; ok {
+			return ips
+		}
+		if ips, ok := s.DNS[name]; ok {
+			return ips
+		}
+		return s.Networks[name]
+	}
+}
+
+// Hash returns a hash of the addresses of every source, however the sources ordered them
+func (s *SourceIPs) Hash() string {
+	h := sha256.New()
+	for _, name := range s.Names() {
+		fmt.Fprintf(h, "%s\n%s\n", name, strings.Join(slices.Sorted(slices.Values(s.Source(name))), ","))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// All returns every collected address, in the order of Names
+func (s *SourceIPs) All() []string {
+	return s.Select(nil)
+}
+
+// Entries returns the collected addresses labelled with their source, dropping duplicates
+func (s *SourceIPs) Entries() []export.Entry {
+	seen := make(map[string]bool)
+	entries := make([]export.Entry, 0, len(s.Cloudflare)+len(s.Netdata))
+	for _, source := range s.Names() {
+		for _, address := range s.Source(source) {
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+			entries = append(entries, export.Entry{Address: address, Source: source, Owner: s.Owners[source]})
+		}
+	}
+	return entries
+}
+
+// Select returns the collected addresses of the named sources in the order of Names, or every
+// address when no source is named
+func (s *SourceIPs) Select(names []string) []string {
+	var selected []string
+	for _, name := range s.Names() {
+		if len(names) == 0 || slices.Contains(names, name) {
+			selected = append(selected, s.Source(name)...)
+		}
+	}
+	return selected
+}
+
+// Labels returns the network and owner of every address of the named networks, for the audit log
+func (s *SourceIPs) Labels() map[string]audit.Label {
+	labels := make(map[string]audit.Label)
+	for _, name := range slices.Sorted(maps.Keys(s.Networks)) {
+		for _, address := range s.Networks[name] {
+			if _, ok := labels[address]; !ok {
+				labels[address] = audit.Label{Source: name, Owner: s.Owners[name]}
+			}
+		}
+	}
+	return labels
+}
+
+// Counts returns the number of addresses every source collected, counting those another source
+// returned as well, so the size of one source does not depend on the others
+func (s *SourceIPs) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, name := range s.Names() {
+		counts[name] = len(s.Source(name))
+	}
+	return counts
+}
+
+// sourceNames returns the configured sources in the order of SourceIPs.Names
+func (s *Service) sourceNames() []string {
+	names := []string{"cloudflare", "netdata"}
+	for _, client := range s.httpClients {
+		names = append(names, client.Name())
+	}
+	slices.Sort(names[2:])
+	names = append(names, slices.Sorted(maps.Keys(s.dnsClients))...)
+	networks := make([]string, 0, len(s.config.Sources.Networks))
+	for _, network := range s.config.Sources.Networks {
+		networks = append(networks, network.Name)
 	}
+	slices.Sort(networks)
+	return append(names, networks...)
+}
+
+// CollectSourceIPs fetches the Cloudflare IP ranges, resolves the Netdata domains and collects
+// every configured source; within a run each source is fetched once however many firewalls or
+// sources read it
+func (s *Service) CollectSourceIPs(ctx context.Context) (*SourceIPs, error) {
+	ctx = sources.WithRunCache(ctx)
 
-	// Resolve Netdata domain IPs
-	netdataIPs, err := s.resolveNetdataIPs(ctx)
+	fetches := s.sourceFetches()
+	results, err := s.collectConcurrently(ctx, fetches)
 	if err != nil {
-		return fmt.Errorf("failed to resolve Netdata IPs: %w", err)
+		return nil, err
+	}
+	for i, source := range fetches {
+		results[i] = s.filterFamily(source.name, source.family, results[i])
+	}
+	cloudflareIPs, netdataIPs := results[0], results[1]
+	httpLists, dnsLists := results[2:2+len(s.httpClients)], results[2+len(s.httpClients):]
+
+	httpIPs := make(map[string][]string, len(s.httpClients))
+	httpCount := 0
+	for i, client := range s.httpClients {
+		httpIPs[client.Name()] = httpLists[i]
+		httpCount += len(httpLists[i])
+	}
+	dnsIPs := make(map[string][]string, len(s.config.Sources.DNS))
+	dnsCount := 0
+	for i, source := range s.config.Sources.DNS {
+		dnsIPs[source.Name] = dnsLists[i]
+		dnsCount += len(dnsLists[i])
+	}
+
+	// The named networks are configured rather than fetched
+	settings := collectedSources(s.config)
+	networkIPs := make(map[string][]string, len(s.config.Sources.Networks))
+	owners := make(map[string]string, len(s.config.Sources.Networks))
+	networkCount := 0
+	for _, network := range s.config.Sources.Networks {
+		networkIPs[network.Name] = s.filterFamily(network.Name, settings[network.Name].family, slices.Clone(network.CIDRs))
+		if network.Owner != "" {
+			owners[network.Name] = network.Owner
+		}
+		networkCount += len(networkIPs[network.Name])
 	}
 
-	// Combine all IPs
-	allIPs := make([]string, 0, len(cloudflareIPs)+len(netdataIPs))
-	allIPs = append(allIPs, cloudflareIPs...)
-	allIPs = append(allIPs, netdataIPs...)
+	sourceIPs := &SourceIPs{
+		Cloudflare: cloudflareIPs,
+		Netdata:    netdataIPs,
+		HTTP:       httpIPs,
+		DNS:        dnsIPs,
+		Networks:   networkIPs,
+		Owners:     owners,
+	}
 	s.logger.Info("Collected all source IPs",
 		zap.Int("cloudflare_ips", len(cloudflareIPs)),
 		zap.Int("netdata_ips", len(netdataIPs)),
-		zap.Int("total_ips", len(allIPs)))
+		zap.Int("http_ips", httpCount),
+		zap.Int("dns_ips", dnsCount),
+		zap.Int("network_ips", networkCount),
+		zap.Int("total_ips", len(cloudflareIPs)+len(netdataIPs)+httpCount+dnsCount+networkCount))
 
-	// Convert config rules to service rules
-	var firewallRules []digitalocean.FirewallRule
-	for _, rule := range s.config.DigitalOcean.InboundRules {
-		firewallRules = append(firewallRules, digitalocean.FirewallRule{
-			Port:     rule.Port,
-			Protocol: rule.Protocol,
-			Sources:  allIPs,
-		})
+	if s.sourceIPsFunc != nil {
+		s.sourceIPsFunc(sourceIPs)
+	}
+	return sourceIPs, nil
+}
+
+// sourceFetches returns the collection of every fetched source: cloudflare, netdata, the HTTP
+// lists in the order of s.httpClients, then the DNS sources
+func (s *Service) sourceFetches() []sourceFetch {
+	settings := collectedSources(s.config)
+	fetches := []sourceFetch{
+		{name: "cloudflare", sourceSettings: settings["cloudflare"], fetch: func(ctx context.Context) ([]string, error) {
+			ips, err := s.fetchCloudflareIPs(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch Cloudflare IPs: %w", err)
+			}
+			return ips, nil
+		}},
+		{name: "netdata", sourceSettings: settings["netdata"], fetch: func(ctx context.Context) ([]string, error) {
+			ips, err := s.resolveNetdataIPs(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve Netdata IPs: %w", err)
+			}
+			return ips, nil
+		}},
+	}
+	for _, client := range s.httpClients {
+		fetches = append(fetches, sourceFetch{name: client.Name(), sourceSettings: settings[client.Name()], fetch: func(ctx context.Context) ([]string, error) {
+			ips, err := s.fetchHTTPIPs(ctx, client)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch %s IPs: %w", client.Name(), err)
+			}
+			return ips, nil
+		}})
+	}
+	for _, source := range s.config.Sources.DNS {
+		fetches = append(fetches, sourceFetch{name: source.Name, sourceSettings: settings[source.Name], fetch: func(ctx context.Context) ([]string, error) {
+			ips, err := s.resolveDNSIPs(ctx, source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s IPs: %w", source.Name, err)
+			}
+			return ips, nil
+		}})
 	}
+	return fetches
+}
 
-	if s.dryRun {
-		s.logger.Info("DRY RUN: Would update firewall with the following rules")
-		for _, rule := range firewallRules {
-			s.logger.Info("DRY RUN: Firewall rule",
-				zap.Int("port", rule.Port),
-				zap.String("protocol", rule.Protocol),
-				zap.Int("source_count", len(rule.Sources)))
+// probeFetches returns the collection of every fetched source like sourceFetches, with a single
+// attempt of the probe clients each and without screening the addresses, for ProbeHealth
+func (s *Service) probeFetches() []sourceFetch {
+	settings := collectedSources(s.config)
+	clients := s.probeClients
+	fetches := []sourceFetch{
+		{name: "cloudflare", sourceSettings: settings["cloudflare"], fetch: func(ctx context.Context) ([]string, error) {
+			ips, err := clients.cloudflare.FetchIPs(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch Cloudflare IPs: %w", err)
+			}
+			return ips, nil
+		}},
+		{name: "netdata", sourceSettings: settings["netdata"], fetch: func(ctx context.Context) ([]string, error) {
+			if len(s.config.Netdata.Domains) == 0 {
+				return []string{}, nil
+			}
+			ips, err := clients.netdata.ResolveDomains(ctx, s.config.Netdata.Domains)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve Netdata IPs: %w", err)
+			}
+			return ips, nil
+		}},
+	}
+	for _, client := range clients.http {
+		fetches = append(fetches, sourceFetch{name: client.Name(), sourceSettings: settings[client.Name()], fetch: func(ctx context.Context) ([]string, error) {
+			ips, err := client.FetchIPs(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch %s IPs: %w", client.Name(), err)
+			}
+			return ips, nil
+		}})
+	}
+	for _, source := range s.config.Sources.DNS {
+		client := clients.dns[source.Name]
+		fetches = append(fetches, sourceFetch{name: source.Name, sourceSettings: settings[source.Name], fetch: func(ctx context.Context) ([]string, error) {
+			ips, err := client.ResolveDomains(ctx, source.Domains)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s IPs: %w", source.Name, err)
+			}
+			return ips, nil
+		}})
+	}
+	return fetches
+}
+
+// sourceFetch collects the addresses of one source
+type sourceFetch struct {
+	sourceSettings
+	name  string
+	fetch func(ctx context.Context) ([]string, error)
+	// cached is set when fetch returns the addresses of the source cached within sources.cache-ttl
+	cached bool
+}
+
+// sourceSettings are the settings of a collected source that apply to every kind of source
+type sourceSettings struct {
+	// onFailure is the on-failure policy of the source, see config.OnFailureAbort
+	onFailure string
+	// family is the address family kept from the source, see sources.FamilyIPv4
+	family string
+	// hash identifies the settings the source collects its addresses with, see sourceHash
+	hash string
+}
+
+// collectedSources maps the collected sources to their settings; a source without an on-failure
+// policy aborts the run and one without an address family takes sources.address-family
+func collectedSources(cfg *config.Config) map[string]sourceSettings {
+	settings := make(map[string]sourceSettings)
+	add := func(name, onFailure, family string, source any) {
+		if family == "" {
+			family = cfg.Sources.AddressFamily
+		}
+		settings[name] = sourceSettings{onFailure: onFailure, family: family, hash: sourceHash(cfg, source)}
+	}
+
+	add("cloudflare", cfg.Cloudflare.OnFailure, cfg.Cloudflare.AddressFamily, cfg.Cloudflare)
+	add("netdata", cfg.Netdata.OnFailure, cfg.Netdata.AddressFamily, cfg.Netdata)
+	for _, source := range cfg.Sources.HTTP {
+		add(source.Name, source.OnFailure, source.AddressFamily, source)
+	}
+	for _, source := range cfg.Sources.Google {
+		add(source.Name, source.OnFailure, source.AddressFamily, source)
+	}
+	for _, source := range cfg.Sources.Probes {
+		add(source.SourceName(), source.OnFailure, source.AddressFamily, source)
+	}
+	for _, source := range cfg.Sources.DNS {
+		add(source.Name, source.OnFailure, source.AddressFamily, source)
+	}
+	for _, network := range cfg.Sources.Networks {
+		add(network.Name, "", network.AddressFamily, network)
+	}
+	return settings
+}
+
+// sourceHash returns a hash of the settings of a source config struct and the safety settings
+// screening what it returns, so cached addresses are only reused for the same source. The
+// on-failure policy and address family are left out, they do not change what is cached
+func sourceHash(cfg *config.Config, source any) string {
+	v := reflect.New(reflect.TypeOf(source)).Elem()
+	v.Set(reflect.ValueOf(source))
+	for _, name := range []string{"OnFailure", "AddressFamily"} {
+		if field := v.FieldByName(name); field.IsValid() {
+			field.SetZero()
+		}
+	}
+
+	data, _ := json.Marshal([]any{v.Interface(), cfg.Safety.BogonFilter, cfg.Safety.ReservedSources})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// collectConcurrently runs every fetch at the same time, each within sources.timeout, so a slow
+// source only delays the run by its own duration rather than the sum of all, and returns their
+// addresses in the order of fetches; sources collected within sources.cache-ttl are not fetched
+// again. A failed source is handled by its on-failure policy; the collection fails if any source
+// fails with abort, reporting every such source at once
+func (s *Service) collectConcurrently(ctx context.Context, fetches []sourceFetch) ([][]string, error) {
+	fetches = s.withCachedSources(fetches)
+	results, errs, _ := s.fetchAll(ctx, fetches)
+
+	// A canceled run is not a source failure, no policy applies
+	if ctx.Err() == nil {
+		s.applyOnFailure(fetches, results, errs)
+	}
+
+	var failed []error
+	var names []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+			names = append(names, fetches[i].name)
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return results, nil
+	case 1:
+		return nil, failed[0]
+	default:
+		s.logger.Error("Failed to collect several sources",
+			zap.Strings("sources", names),
+			zap.Int("sources_total", len(fetches)))
+		return nil, fmt.Errorf("failed to collect %d of %d sources: %w", len(failed), len(fetches), errors.Join(failed...))
+	}
+}
+
+// fetchAll runs every fetch at the same time, each within sources.timeout, returning the
+// addresses, error and duration of each in the order of fetches
+func (s *Service) fetchAll(ctx context.Context, fetches []sourceFetch) ([][]string, []error, []time.Duration) {
+	results := make([][]string, len(fetches))
+	errs := make([]error, len(fetches))
+	took := make([]time.Duration, len(fetches))
+	var wg sync.WaitGroup
+	for i, source := range fetches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			fetchCtx, cancel := s.sourceContext(ctx)
+			defer cancel()
+
+			start := time.Now()
+			ips, err := source.fetch(fetchCtx)
+			if err != nil && ctx.Err() == nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("%w (exceeded sources.timeout of %s)", err, s.config.Sources.Timeout)
+			}
+			results[i], errs[i], took[i] = ips, err, time.Since(start)
+		}()
+	}
+	wg.Wait()
+	return results, errs, took
+}
+
+// withCachedSources replaces the fetch of every source collected less than sources.cache-ttl
+// ago with its cached addresses, so aggressive schedules do not hammer the upstream APIs
+func (s *Service) withCachedSources(fetches []sourceFetch) []sourceFetch {
+	ttl := s.config.Sources.CacheTTL
+	if ttl <= 0 {
+		return fetches
+	}
+
+	st, err := s.stateStore.Load()
+	if err != nil {
+		s.logger.Warn("Failed to load the cached source addresses, collecting every source", zap.Error(err))
+		return fetches
+	}
+
+	now := s.clock.Now()
+	fetches = slices.Clone(fetches)
+	for i, source := range fetches {
+		cached := st.CachedSource(source.name, source.hash)
+		if cached == nil || now.Sub(cached.CollectedAt) >= ttl {
+			continue
+		}
+		s.logger.Debug("Using the cached source addresses",
+			zap.String("source", source.name),
+			zap.Int("addresses", len(cached.Addresses)),
+			zap.Duration("age", now.Sub(cached.CollectedAt)))
+		addresses := cached.Addresses
+		fetches[i].fetch = func(context.Context) ([]string, error) {
+			return slices.Clone(addresses), nil
+		}
+		fetches[i].cached = true
+	}
+	return fetches
+}
+
+// applyOnFailure clears the errors of the failed sources whose policy lets the run go on,
+// replacing their addresses with the cached ones for use-cached or none for skip. It caches the
+// addresses of the sources that were fetched successfully in the state file, for sources.cache-ttl
+// and the next failure of use-cached sources
+func (s *Service) applyOnFailure(fetches []sourceFetch, results [][]string, errs []error) {
+	caching := s.config.Sources.CacheTTL > 0
+	for _, source := range fetches {
+		caching = caching || source.onFailure == config.OnFailureUseCached
+	}
+	if caching {
+		s.updateSourceCache(fetches, results, errs)
+	}
+
+	for i, source := range fetches {
+		if errs[i] != nil && source.onFailure == config.OnFailureSkip {
+			s.logger.Warn("Source failed, updating the firewalls without its addresses",
+				zap.String("source", source.name),
+				zap.Error(errs[i]))
+			errs[i] = nil
+		}
+	}
+}
+
+// updateSourceCache caches the addresses of the fetched sources and falls back to the cached
+// addresses of the failed use-cached sources
+func (s *Service) updateSourceCache(fetches []sourceFetch, results [][]string, errs []error) {
+	now := s.clock.Now()
+	err := s.stateStore.Update(func(st *state.State) error {
+		for i, source := range fetches {
+			useCached := source.onFailure == config.OnFailureUseCached
+			if errs[i] == nil {
+				if !source.cached && (s.config.Sources.CacheTTL > 0 || useCached) {
+					st.CacheSource(source.name, source.hash, results[i], now)
+				}
+				continue
+			}
+			if !useCached {
+				continue
+			}
+
+			cached := st.CachedSource(source.name, source.hash)
+			if cached == nil {
+				errs[i] = fmt.Errorf("%w (no cached addresses of source %s to fall back to)", errs[i], source.name)
+				continue
+			}
+			s.logger.Warn("Source failed, updating the firewalls with its cached addresses",
+				zap.String("source", source.name),
+				zap.Int("addresses", len(cached.Addresses)),
+				zap.Time("collected_at", cached.CollectedAt),
+				zap.Error(errs[i]))
+			results[i], errs[i] = slices.Clone(cached.Addresses), nil
 		}
-		s.logger.Info("DRY RUN: Total source IPs that would be allowed", zap.Int("count", len(allIPs)))
 		return nil
+	})
+	if err != nil {
+		// When the state cannot be loaded the failed sources keep their errors and abort the run
+		s.logger.Error("Failed to update the cached source addresses", zap.Error(err))
 	}
+}
 
-	// Update firewall rules
-	err = s.digitalOceanClient.UpdateFirewallRules(
-		ctx,
-		s.config.DigitalOcean.FirewallID,
-		firewallRules,
-		allIPs,
-	)
+// sourceContext bounds the collection of one source by sources.timeout, if set
+func (s *Service) sourceContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.Sources.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.config.Sources.Timeout)
+}
+
+// SourceHash collects the addresses of every source and returns their SourceIPs.Hash, so pollers
+// can tell whether an update would change anything before running it
+func (s *Service) SourceHash(ctx context.Context) (string, error) {
+	sourceIPs, err := s.CollectSourceIPs(retrybudget.WithBudget(ctx, s.config.Run.RetryBudget))
 	if err != nil {
-		return fmt.Errorf("failed to update firewall rules: %w", err)
+		return "", err
 	}
+	return sourceIPs.Hash(), nil
+}
 
-	s.logger.Info("Successfully completed firewall rules update",
-		zap.String("firewall_id", s.config.DigitalOcean.FirewallID),
-		zap.Int("total_rules", len(firewallRules)),
-		zap.Int("total_source_ips", len(allIPs)))
+// SetSigner signs the allowlists and diffs uploaded to the publish bucket
+func (s *Service) SetSigner(signer *signing.Signer) {
+	if s.publisher != nil {
+		s.publisher.SetSigner(signer)
+	}
+}
 
-	return nil
+// SetSourceIPsFunc installs a hook receiving the addresses of every successful collection
+func (s *Service) SetSourceIPsFunc(fn func(*SourceIPs)) {
+	s.sourceIPsFunc = fn
+}
+
+// SetPlanFunc installs a hook receiving the planned changes of every firewall a dry run or
+// read-only run leaves alone
+func (s *Service) SetPlanFunc(fn func(digitalocean.Plan)) {
+	s.planFunc = fn
 }
 
 // fetchCloudflareIPs fetches Cloudflare IP ranges with retry
@@ -115,10 +1639,56 @@ func (s *Service) fetchCloudflareIPs(ctx context.Context) ([]string, error) {
 		return nil, err
 	}
 
+	ips = s.filterBogons("cloudflare", ips)
+
 	s.logger.Info("Successfully fetched Cloudflare IPs", zap.Int("count", len(ips)))
 	return ips, nil
 }
 
+// fetchHTTPIPs fetches the list of an HTTP source with retry
+func (s *Service) fetchHTTPIPs(ctx context.Context, client listClient) ([]string, error) {
+	s.logger.Debug("Fetching HTTP source IPs", zap.String("source", client.Name()))
+
+	ips, err := client.FetchIPsWithRetry(ctx, 3)
+	if err != nil {
+		s.logger.Error("Failed to fetch HTTP source IPs", zap.String("source", client.Name()), zap.Error(err))
+		return nil, err
+	}
+
+	ips = s.filterBogons(client.Name(), ips)
+
+	s.logger.Info("Successfully fetched HTTP source IPs", zap.String("source", client.Name()), zap.Int("count", len(ips)))
+	return ips, nil
+}
+
+// filterBogons drops the bogon ranges from a source list unless safety.bogon-filter is disabled;
+// addresses resolved from domains are screened by safety.reserved-sources instead
+func (s *Service) filterBogons(source string, ips []string) []string {
+	if !s.config.Safety.BogonFilter {
+		return ips
+	}
+	kept, dropped := sources.FilterBogons(ips)
+	if len(dropped) > 0 {
+		s.logger.Warn("Dropped bogon addresses from source",
+			zap.String("source", source),
+			zap.Strings("addresses", dropped))
+	}
+	return kept
+}
+
+// filterFamily keeps the addresses of the source's address family; filtering after collection
+// keeps the cached addresses whole, for when the family changes
+func (s *Service) filterFamily(source, family string, ips []string) []string {
+	kept, dropped := sources.FilterFamily(family, ips)
+	if dropped > 0 {
+		s.logger.Debug("Dropped addresses of the other address family from source",
+			zap.String("source", source),
+			zap.String("address_family", family),
+			zap.Int("dropped", dropped))
+	}
+	return kept
+}
+
 // resolveNetdataIPs resolves Netdata domain IPs with retry
 func (s *Service) resolveNetdataIPs(ctx context.Context) ([]string, error) {
 	if len(s.config.Netdata.Domains) == 0 {
@@ -129,37 +1699,126 @@ func (s *Service) resolveNetdataIPs(ctx context.Context) ([]string, error) {
 	s.logger.Debug("Resolving Netdata domain IPs", zap.Strings("domains", s.config.Netdata.Domains))
 
 	ips, err := s.netdataClient.ResolveDomainsWithRetry(ctx, s.config.Netdata.Domains, 3)
+	s.logDomainResults(s.netdataClient)
 	if err != nil {
 		s.logger.Error("Failed to resolve Netdata domain IPs", zap.Error(err))
 		return nil, err
 	}
 
+	ips, err = s.screenReserved("netdata", ips)
+	if err != nil {
+		return nil, err
+	}
+
 	s.logger.Info("Successfully resolved Netdata domain IPs", zap.Int("count", len(ips)))
 	return ips, nil
 }
 
+// resolveDNSIPs resolves the domains of a DNS source with retry
+func (s *Service) resolveDNSIPs(ctx context.Context, source config.DNSSource) ([]string, error) {
+	client := s.dnsClients[source.Name]
+	s.logger.Debug("Resolving DNS source IPs", zap.String("source", source.Name), zap.Strings("domains", source.Domains))
+
+	ips, err := client.ResolveDomainsWithRetry(ctx, source.Domains, 3)
+	s.logDomainResults(client)
+	if err != nil {
+		s.logger.Error("Failed to resolve DNS source IPs", zap.String("source", source.Name), zap.Error(err))
+		return nil, err
+	}
+
+	ips, err = s.screenReserved(source.Name, ips)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Successfully resolved DNS source IPs", zap.String("source", source.Name), zap.Int("count", len(ips)))
+	return ips, nil
+}
+
+// logDomainResults reports how each domain of the client's latest resolution went, so flaky
+// domains stand out in the run's logs
+func (s *Service) logDomainResults(client *dns.Client) {
+	for _, result := range client.Results() {
+		fields := []zap.Field{
+			zap.String("source", client.Name()),
+			zap.String("domain", result.Domain),
+			zap.Strings("ips", result.IPs),
+			zap.Duration("duration", result.Duration),
+		}
+		if result.Error != "" {
+			s.logger.Warn("Domain resolution", append(fields, zap.String("error", result.Error))...)
+			continue
+		}
+		s.logger.Info("Domain resolution", fields...)
+	}
+}
+
+// NetdataResults returns how each Netdata domain of the latest resolution went
+func (s *Service) NetdataResults() []netdata.DomainResult {
+	return s.netdataClient.Results()
+}
+
+// DNSExpiry returns when the first record resolved for the Netdata domains or a DNS source expires
+// by its TTL, or the zero time when no resolved record carried a TTL
+func (s *Service) DNSExpiry() time.Time {
+	expiry := s.netdataClient.Expiry()
+	for _, client := range s.dnsClients {
+		if next := client.Expiry(); !next.IsZero() && (expiry.IsZero() || next.Before(expiry)) {
+			expiry = next
+		}
+	}
+	return expiry
+}
+
+// screenReserved applies safety.reserved-sources to the addresses resolved for a source;
+// split-horizon DNS often answers with internal addresses that can never reach the firewall
+func (s *Service) screenReserved(source string, ips []string) ([]string, error) {
+	policy := s.config.Safety.ReservedSources
+	kept, reserved, err := sources.Screen(policy, ips)
+	if err != nil {
+		s.logger.Error("Source resolved to reserved addresses", zap.String("source", source), zap.Strings("addresses", reserved))
+		return nil, fmt.Errorf("failed to collect %s addresses: %w", source, err)
+	}
+	if len(reserved) > 0 {
+		s.logger.Warn("Source resolved to reserved addresses",
+			zap.String("source", source),
+			zap.String("policy", policy),
+			zap.Strings("addresses", reserved))
+	}
+	return kept, nil
+}
+
 // ValidateConfiguration validates the service configuration
 func (s *Service) ValidateConfiguration(ctx context.Context) error {
 	s.logger.Info("Validating configuration")
 
-	// Test DigitalOcean API access
-	firewall, err := s.digitalOceanClient.GetFirewall(ctx, s.config.DigitalOcean.FirewallID)
-	if err != nil {
-		return fmt.Errorf("failed to access DigitalOcean firewall: %w", err)
-	}
+	// Test DigitalOcean API access to every firewall
+	for _, target := range s.config.DigitalOcean.Targets() {
+		firewall, err := s.digitalOceanClient.GetFirewall(ctx, target.ID)
+		if err != nil {
+			return fmt.Errorf("failed to access DigitalOcean firewall %s: %w", target.ID, err)
+		}
 
-	s.logger.Info("Successfully validated DigitalOcean access",
-		zap.String("firewall_id", firewall.ID),
-		zap.String("firewall_name", firewall.Name))
+		s.logger.Info("Successfully validated DigitalOcean access",
+			zap.String("firewall_id", firewall.ID),
+			zap.String("firewall_name", firewall.Name))
+	}
 
 	// Test Cloudflare API access
-	_, err = s.cloudflareClient.FetchIPs(ctx)
+	_, err := s.cloudflareClient.FetchIPs(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to access Cloudflare API: %w", err)
 	}
 
 	s.logger.Info("Successfully validated Cloudflare API access")
 
+	// Test the lists of the HTTP sources
+	for _, client := range s.httpClients {
+		if _, err := client.FetchIPs(ctx); err != nil {
+			return fmt.Errorf("failed to fetch %s IP list: %w", client.Name(), err)
+		}
+	}
+
 	// Test Netdata domain resolution if domains are configured
 	if len(s.config.Netdata.Domains) > 0 {
 		_, err = s.netdataClient.ResolveDomains(ctx, s.config.Netdata.Domains)
@@ -170,6 +1829,20 @@ func (s *Service) ValidateConfiguration(ctx context.Context) error {
 		s.logger.Info("Successfully validated Netdata domain resolution")
 	}
 
+	// Test the domains of the DNS sources
+	for _, source := range s.config.Sources.DNS {
+		if _, err := s.dnsClients[source.Name].ResolveDomains(ctx, source.Domains); err != nil {
+			return fmt.Errorf("failed to resolve %s domains: %w", source.Name, err)
+		}
+	}
+
+	// Test dynamic DNS hostname resolution
+	for _, entry := range s.config.DigitalOcean.DynamicDNS {
+		if _, err := s.dynDNSClient.Resolve(ctx, entry.Hostname); err != nil {
+			return fmt.Errorf("failed to resolve dynamic DNS hostname: %w", err)
+		}
+	}
+
 	s.logger.Info("Configuration validation completed successfully")
 	return nil
 }
@@ -187,6 +1860,19 @@ func (s *Service) GetStatus(ctx context.Context) (*Status, error) {
 		status.DigitalOcean.Status = "ok"
 		status.DigitalOcean.FirewallName = firewall.Name
 		status.DigitalOcean.InboundRuleCount = len(firewall.InboundRules)
+
+		// Tell changes made by this tool apart from edits in the console or by other tools
+		modification, err := s.digitalOceanClient.LastModification(firewall)
+		if err != nil {
+			s.logger.Warn("Failed to determine the last firewall modification", zap.Error(err))
+		}
+		status.DigitalOcean.LastModified = &modification
+
+		events, err := s.digitalOceanClient.RecentEvents(ctx, firewall, recentEventLimit)
+		if err != nil {
+			s.logger.Warn("Failed to list recent firewall events", zap.Error(err))
+		}
+		status.DigitalOcean.RecentEvents = events
 	}
 
 	// Check Cloudflare API
@@ -210,20 +1896,49 @@ func (s *Service) GetStatus(ctx context.Context) (*Status, error) {
 			status.Netdata.IPCount = len(netdataIPs)
 			status.Netdata.DomainCount = len(s.config.Netdata.Domains)
 		}
+		status.Netdata.Domains = s.netdataClient.Results()
 	} else {
 		status.Netdata.Status = "disabled"
 	}
 
+	// Check the lists of the HTTP sources
+	for _, client := range s.httpClients {
+		source := HTTPSourceStatus{Name: client.Name(), Status: "ok"}
+		ips, err := client.FetchIPs(ctx)
+		if err != nil {
+			source.Status = "error"
+			source.Error = err.Error()
+		}
+		source.IPCount = len(ips)
+		status.HTTP = append(status.HTTP, source)
+	}
+
+	// Check the domains of the DNS sources
+	for _, entry := range s.config.Sources.DNS {
+		client := s.dnsClients[entry.Name]
+		source := DNSSourceStatus{Name: entry.Name, Status: "ok", DomainCount: len(entry.Domains)}
+		ips, err := client.ResolveDomains(ctx, entry.Domains)
+		if err != nil {
+			source.Status = "error"
+			source.Error = err.Error()
+		}
+		source.IPCount = len(ips)
+		source.Domains = client.Results()
+		status.DNS = append(status.DNS, source)
+	}
+
 	return status, nil
 }
 
 // Status represents the current status of external services
 type Status struct {
 	DigitalOcean struct {
-		Status           string `json:"status"`
-		Error            string `json:"error,omitempty"`
-		FirewallName     string `json:"firewall_name,omitempty"`
-		InboundRuleCount int    `json:"inbound_rule_count,omitempty"`
+		Status           string                     `json:"status"`
+		Error            string                     `json:"error,omitempty"`
+		FirewallName     string                     `json:"firewall_name,omitempty"`
+		InboundRuleCount int                        `json:"inbound_rule_count,omitempty"`
+		LastModified     *digitalocean.Modification `json:"last_modified,omitempty"`
+		RecentEvents     []digitalocean.Event       `json:"recent_events,omitempty"`
 	} `json:"digitalocean"`
 	Cloudflare struct {
 		Status  string `json:"status"`
@@ -235,5 +1950,27 @@ type Status struct {
 		Error       string `json:"error,omitempty"`
 		IPCount     int    `json:"ip_count,omitempty"`
 		DomainCount int    `json:"domain_count,omitempty"`
+		// Domains reports the resolution of every domain, to tell flaky ones apart
+		Domains []netdata.DomainResult `json:"domains,omitempty"`
 	} `json:"netdata"`
+	HTTP []HTTPSourceStatus `json:"http,omitempty"`
+	DNS  []DNSSourceStatus  `json:"dns,omitempty"`
+}
+
+// DNSSourceStatus represents the status of a sources.dns entry
+type DNSSourceStatus struct {
+	Name        string             `json:"name"`
+	Status      string             `json:"status"`
+	Error       string             `json:"error,omitempty"`
+	IPCount     int                `json:"ip_count,omitempty"`
+	DomainCount int                `json:"domain_count,omitempty"`
+	Domains     []dns.DomainResult `json:"domains,omitempty"`
+}
+
+// HTTPSourceStatus represents the status of a sources.http, sources.google or sources.probes list
+type HTTPSourceStatus struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	IPCount int    `json:"ip_count,omitempty"`
 }
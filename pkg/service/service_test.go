@@ -0,0 +1,438 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/config"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/digitalocean"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/state"
+	"go.uber.org/zap/zaptest"
+)
+
+// newTestService returns a Service collecting with the configuration and a state file of its own;
+// it has no source or DigitalOcean clients, tests install what they use
+func newTestService(t *testing.T, cfg *config.Config) *Service {
+	t.Helper()
+
+	logger := zaptest.NewLogger(t)
+	cfg.State.Path = filepath.Join(t.TempDir(), "state.json")
+	return &Service{
+		config:     cfg,
+		stateStore: state.NewStore(cfg.State.Path, logger),
+		logger:     logger.Named("service"),
+		clock:      clock.Real,
+	}
+}
+
+// staticFetch returns a fetch answering with the addresses or the error
+func staticFetch(name string, ips []string, err error) sourceFetch {
+	return sourceFetch{name: name, fetch: func(context.Context) ([]string, error) {
+		return slices.Clone(ips), err
+	}}
+}
+
+func TestCollectConcurrently(t *testing.T) {
+	s := newTestService(t, &config.Config{Sources: config.SourcesConfig{Timeout: time.Second}})
+
+	// The slow source only returns once the fast one finished, which a sequential collection of
+	// the sources in order never reaches
+	fastDone := make(chan struct{})
+	slow := sourceFetch{name: "slow", fetch: func(ctx context.Context) ([]string, error) {
+		select {
+		case <-fastDone:
+			return []string{"198.51.100.1"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}}
+	fast := sourceFetch{name: "fast", fetch: func(context.Context) ([]string, error) {
+		close(fastDone)
+		return []string{"198.51.100.2"}, nil
+	}}
+
+	results, err := s.collectConcurrently(context.Background(), []sourceFetch{slow, fast})
+	if err != nil {
+		t.Fatalf("expected the slow source not to wait for the fast one, got %v", err)
+	}
+	expected := [][]string{{"198.51.100.1"}, {"198.51.100.2"}}
+	if !slices.EqualFunc(results, expected, slices.Equal) {
+		t.Errorf("expected results %v in the order of the fetches, got %v", expected, results)
+	}
+}
+
+func TestCollectConcurrentlyTimeout(t *testing.T) {
+	s := newTestService(t, &config.Config{Sources: config.SourcesConfig{Timeout: 20 * time.Millisecond}})
+
+	hanging := sourceFetch{name: "hanging", fetch: func(ctx context.Context) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	_, err := s.collectConcurrently(context.Background(), []sourceFetch{hanging})
+	if err == nil || !strings.Contains(err.Error(), "exceeded sources.timeout of 20ms") {
+		t.Errorf("expected the source deadline to be named, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline error to be wrapped, got %v", err)
+	}
+
+	// A source failing with a deadline of its own within sources.timeout is not blamed on it
+	upstream := staticFetch("upstream", nil, context.DeadlineExceeded)
+	_, err = s.collectConcurrently(context.Background(), []sourceFetch{upstream})
+	if err == nil || strings.Contains(err.Error(), "sources.timeout") {
+		t.Errorf("expected the source's own deadline error unchanged, got %v", err)
+	}
+
+	// Nor is the deadline of the run
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = s.collectConcurrently(ctx, []sourceFetch{hanging})
+	if err == nil || strings.Contains(err.Error(), "sources.timeout") {
+		t.Errorf("expected the run's deadline not to be blamed on sources.timeout, got %v", err)
+	}
+}
+
+func TestCollectConcurrentlyFailures(t *testing.T) {
+	s := newTestService(t, &config.Config{})
+
+	errCloudflare := errors.New("cloudflare: 503 service unavailable")
+	errPartner := errors.New("partner: no such host")
+	ok := staticFetch("office", []string{"198.51.100.0/24"}, nil)
+
+	_, err := s.collectConcurrently(context.Background(), []sourceFetch{
+		ok, staticFetch("cloudflare", nil, errCloudflare),
+	})
+	if err != errCloudflare {
+		t.Errorf("expected the only failure to be returned as is, got %v", err)
+	}
+
+	_, err = s.collectConcurrently(context.Background(), []sourceFetch{
+		staticFetch("cloudflare", nil, errCloudflare), ok, staticFetch("partner", nil, errPartner),
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to collect 2 of 3 sources: ") {
+		t.Fatalf("expected every failure to be reported at once, got %v", err)
+	}
+	for _, target := range []error{errCloudflare, errPartner} {
+		if !errors.Is(err, target) {
+			t.Errorf("expected the error to wrap %v", target)
+		}
+	}
+}
+
+func TestCollectConcurrentlyOnFailure(t *testing.T) {
+	errOutage := errors.New("503 service unavailable")
+	cachedAt := time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		onFailure string
+		cached    []string
+		canceled  bool
+		expected  []string
+		errorMsg  string
+	}{
+		{name: "abort", onFailure: config.OnFailureAbort, errorMsg: "503 service unavailable"},
+		{name: "no policy aborts", onFailure: "", errorMsg: "503 service unavailable"},
+		{name: "skip", onFailure: config.OnFailureSkip},
+		{name: "use-cached", onFailure: config.OnFailureUseCached, cached: []string{"198.51.100.0/24"}, expected: []string{"198.51.100.0/24"}},
+		{name: "use-cached without cache", onFailure: config.OnFailureUseCached, errorMsg: "no cached addresses of source partner to fall back to"},
+		{name: "canceled run skips no source", onFailure: config.OnFailureSkip, canceled: true, errorMsg: "503 service unavailable"},
+		{name: "canceled run uses no cache", onFailure: config.OnFailureUseCached, cached: []string{"198.51.100.0/24"}, canceled: true, errorMsg: "503 service unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, &config.Config{})
+			if tt.cached != nil {
+				if err := s.stateStore.Update(func(st *state.State) error {
+					st.CacheSource("partner", "", tt.cached, cachedAt)
+					return nil
+				}); err != nil {
+					t.Fatalf("failed to cache the source: %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.canceled {
+				cancel()
+			}
+
+			failing := staticFetch("partner", nil, errOutage)
+			failing.onFailure = tt.onFailure
+			results, err := s.collectConcurrently(ctx, []sourceFetch{
+				staticFetch("office", []string{"203.0.113.0/27"}, nil), failing,
+			})
+
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("expected error containing %q, got %v", tt.errorMsg, err)
+				}
+				if !errors.Is(err, errOutage) {
+					t.Errorf("expected the source's error to be wrapped, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(results[0], []string{"203.0.113.0/27"}) {
+				t.Errorf("expected the other source's addresses to be kept, got %v", results[0])
+			}
+			if !slices.Equal(results[1], tt.expected) {
+				t.Errorf("expected the failed source to contribute %v, got %v", tt.expected, results[1])
+			}
+		})
+	}
+}
+
+func TestCollectConcurrentlyCachesUseCachedSources(t *testing.T) {
+	now := time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC)
+	s := newTestService(t, &config.Config{})
+	s.clock = clock.NewFake(now)
+
+	fetched := staticFetch("partner", []string{"198.51.100.0/24"}, nil)
+	fetched.onFailure = config.OnFailureUseCached
+	skipped := staticFetch("office", nil, errors.New("503 service unavailable"))
+	skipped.onFailure = config.OnFailureSkip
+	if _, err := s.collectConcurrently(context.Background(), []sourceFetch{fetched, skipped}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	st, err := s.stateStore.Load()
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	cached := st.CachedSource("partner", "")
+	if cached == nil || !slices.Equal(cached.Addresses, []string{"198.51.100.0/24"}) || !cached.CollectedAt.Equal(now) {
+		t.Errorf("expected the successful collection of the use-cached source to be cached, got %+v", cached)
+	}
+	if st.CachedSource("office", "") != nil {
+		t.Error("expected the skipped source not to be cached")
+	}
+}
+
+func TestCollectConcurrentlyCacheTTL(t *testing.T) {
+	cachedAt := time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		age      time.Duration
+		hash     string
+		fetched  bool
+		expected []string
+	}{
+		{name: "within the TTL", age: 30 * time.Second, hash: "v1", expected: []string{"198.51.100.0/24"}},
+		{name: "at the TTL", age: time.Minute, hash: "v1", fetched: true, expected: []string{"203.0.113.0/27"}},
+		{name: "after the TTL", age: time.Hour, hash: "v1", fetched: true, expected: []string{"203.0.113.0/27"}},
+		{name: "settings changed", age: 30 * time.Second, hash: "v2", fetched: true, expected: []string{"203.0.113.0/27"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := cachedAt.Add(tt.age)
+			s := newTestService(t, &config.Config{Sources: config.SourcesConfig{CacheTTL: time.Minute}})
+			s.clock = clock.NewFake(now)
+			if err := s.stateStore.Update(func(st *state.State) error {
+				st.CacheSource("partner", "v1", []string{"198.51.100.0/24"}, cachedAt)
+				return nil
+			}); err != nil {
+				t.Fatalf("failed to cache the source: %v", err)
+			}
+
+			fetched := false
+			source := sourceFetch{name: "partner", fetch: func(context.Context) ([]string, error) {
+				fetched = true
+				return []string{"203.0.113.0/27"}, nil
+			}}
+			source.hash = tt.hash
+
+			results, err := s.collectConcurrently(context.Background(), []sourceFetch{source})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fetched != tt.fetched {
+				t.Errorf("expected the source to be fetched: %v, got %v", tt.fetched, fetched)
+			}
+			if !slices.Equal(results[0], tt.expected) {
+				t.Errorf("expected addresses %v, got %v", tt.expected, results[0])
+			}
+
+			// Addresses served from the cache are not written back, which would extend their TTL
+			st, err := s.stateStore.Load()
+			if err != nil {
+				t.Fatalf("failed to load state: %v", err)
+			}
+			cached := st.CachedSource("partner", tt.hash)
+			expectedAt := cachedAt
+			if tt.fetched {
+				expectedAt = now
+			}
+			if cached == nil || !cached.CollectedAt.Equal(expectedAt) || !slices.Equal(cached.Addresses, tt.expected) {
+				t.Errorf("expected %v cached at %s, got %+v", tt.expected, expectedAt, cached)
+			}
+		})
+	}
+}
+
+func TestSourceHash(t *testing.T) {
+	cfg := &config.Config{Sources: config.SourcesConfig{HTTP: []config.HTTPSource{
+		{Name: "partner", URL: "https://partner.example.com/ips.txt", Format: "text"},
+	}}}
+	hash := collectedSources(cfg)["partner"].hash
+
+	// The on-failure policy and address family do not change what the source returns
+	cfg.Sources.HTTP[0].OnFailure = config.OnFailureUseCached
+	cfg.Sources.HTTP[0].AddressFamily = "ipv4"
+	if collectedSources(cfg)["partner"].hash != hash {
+		t.Error("expected the on-failure policy and address family not to change the hash")
+	}
+
+	cfg.Sources.HTTP[0].URL = "https://partner.example.com/v2/ips.txt"
+	if collectedSources(cfg)["partner"].hash == hash {
+		t.Error("expected a new URL to change the hash")
+	}
+}
+
+func TestUpdateFirewallRulesWorkers(t *testing.T) {
+	ids := []string{"fw-1", "fw-2", "fw-3", "fw-4", "fw-5", "fw-6"}
+	cfg := &config.Config{DigitalOcean: config.DigitalOceanConfig{
+		FirewallID:   ids[0],
+		InboundRules: []config.InboundRule{{Port: 443, Protocol: "tcp"}},
+		Workers:      2,
+	}}
+	for _, id := range ids[1:] {
+		cfg.DigitalOcean.Firewalls = append(cfg.DigitalOcean.Firewalls,
+			config.FirewallTarget{ID: id, InboundRules: []config.InboundRule{{Port: 443, Protocol: "tcp"}}})
+	}
+	s := newTestService(t, cfg)
+	api := newFakeFirewallAPI(ids...)
+	api.delay = 20 * time.Millisecond
+	api.fail["fw-4"] = true
+	withFakeAPIs(t, s, api, "173.245.48.0/20")
+
+	err := s.UpdateFirewallRules(context.Background())
+	var updateErr *UpdateError
+	if !errors.As(err, &updateErr) {
+		t.Fatalf("expected an UpdateError, got %v", err)
+	}
+
+	if api.maxInFlight != 2 {
+		t.Errorf("expected digitalocean.workers to bound the updates in flight at 2, got %d", api.maxInFlight)
+	}
+	if api.updates != len(ids)-1 {
+		t.Errorf("expected %d firewalls to be updated, got %d", len(ids)-1, api.updates)
+	}
+
+	// Results keep the order of the configuration however the updates finished
+	for i, result := range updateErr.Results {
+		expected := FirewallUpdated
+		if result.FirewallID == "fw-4" {
+			expected = FirewallFailed
+		}
+		if result.FirewallID != ids[i] || result.Outcome != expected {
+			t.Errorf("expected result %d to be %s %s, got %s %s", i, ids[i], expected, result.FirewallID, result.Outcome)
+		}
+	}
+}
+
+func TestUpdateFirewallRulesSerializesPlans(t *testing.T) {
+	ids := []string{"fw-1", "fw-2", "fw-3", "fw-4"}
+	cfg := &config.Config{DigitalOcean: config.DigitalOceanConfig{
+		FirewallID:   ids[0],
+		InboundRules: []config.InboundRule{{Port: 443, Protocol: "tcp"}},
+		Workers:      len(ids),
+	}}
+	for _, id := range ids[1:] {
+		cfg.DigitalOcean.Firewalls = append(cfg.DigitalOcean.Firewalls,
+			config.FirewallTarget{ID: id, InboundRules: []config.InboundRule{{Port: 443, Protocol: "tcp"}}})
+	}
+	s := newTestService(t, cfg)
+	s.dryRun = true
+	withFakeAPIs(t, s, newFakeFirewallAPI(ids...), "173.245.48.0/20")
+
+	var (
+		mu         sync.Mutex
+		inPlan     bool
+		overlapped bool
+		planned    []string
+	)
+	s.SetPlanFunc(func(plan digitalocean.Plan) {
+		mu.Lock()
+		overlapped = overlapped || inPlan
+		inPlan = true
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inPlan = false
+		planned = append(planned, plan.FirewallID)
+		mu.Unlock()
+	})
+
+	if err := s.UpdateFirewallRules(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if overlapped {
+		t.Error("expected the plans of concurrently planned firewalls not to interleave")
+	}
+	slices.Sort(planned)
+	if !slices.Equal(planned, ids) {
+		t.Errorf("expected a plan of every firewall, got %v", planned)
+	}
+}
+
+func TestSourceIPsCounts(t *testing.T) {
+	// The partner domain resolves to an address Cloudflare publishes as well
+	ips := &SourceIPs{
+		Cloudflare: []string{"173.245.48.0/20", "104.16.0.1"},
+		DNS:        map[string][]string{"partner": {"104.16.0.1", "198.51.100.7"}},
+	}
+
+	counts := ips.Counts()
+	expected := map[string]int{"cloudflare": 2, "netdata": 0, "partner": 2}
+	if len(counts) != len(expected) {
+		t.Fatalf("expected counts %v, got %v", expected, counts)
+	}
+	for source, count := range expected {
+		if counts[source] != count {
+			t.Errorf("expected %d addresses of %s, got %d", count, source, counts[source])
+		}
+	}
+	if len(ips.Entries()) != 3 {
+		t.Errorf("expected the allowlist to hold the shared address once, got %v", ips.Entries())
+	}
+}
+
+func TestTrackSourceSizesOverlappingSources(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.DigitalOcean.FirewallID = "fw-1"
+	s := newTestService(t, cfg)
+	s.clock = clock.NewFake(time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC))
+
+	// Cloudflare growing to include the partner's address leaves the size of the partner alone
+	runs := []*SourceIPs{
+		{Cloudflare: []string{"173.245.48.0/20"}, DNS: map[string][]string{"partner": {"104.16.0.1", "198.51.100.7"}}},
+		{Cloudflare: []string{"173.245.48.0/20", "104.16.0.1"}, DNS: map[string][]string{"partner": {"104.16.0.1", "198.51.100.7"}}},
+	}
+	for _, ips := range runs {
+		s.trackSourceSizes(context.Background(), ips)
+	}
+
+	st, err := s.stateStore.Load()
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	history := st.SourceSizeHistory("fw-1", "partner")
+	if len(history) != 2 || history[0].Count != 2 || history[1].Count != 2 {
+		t.Errorf("expected the partner to keep 2 addresses, got %+v", history)
+	}
+}
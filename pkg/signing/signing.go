@@ -0,0 +1,155 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Signature formats
+const (
+	// FormatMinisign produces minisign signatures, verified with minisign -Vm <file> -P <public key>
+	FormatMinisign = "minisign"
+	// FormatCosign produces cosign blob signatures, verified with cosign verify-blob --key <public key>
+	FormatCosign = "cosign"
+)
+
+// Signer signs exported allowlists so consumers can check they come from the trusted daemon
+type Signer struct {
+	format string
+	key    crypto.Signer
+	keyID  [8]byte
+	now    func() time.Time
+}
+
+// LoadSigner reads an unencrypted PEM private key from keyFile: Ed25519 for minisign, or
+// ECDSA P-256 for cosign
+func LoadSigner(format, keyFile string) (*Signer, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	signer, err := NewSigner(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %w", keyFile, err)
+	}
+	return signer, nil
+}
+
+// NewSigner creates a signer of the format from a PEM private key
+func NewSigner(format string, keyPEM []byte) (*Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	if strings.Contains(block.Type, "ENCRYPTED") {
+		return nil, errors.New("encrypted keys are not supported, export the key without a password")
+	}
+
+	var key crypto.Signer
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		var ok bool
+		if key, ok = parsed.(crypto.Signer); !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+	case "EC PRIVATE KEY":
+		parsed, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		key = parsed
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+
+	s := &Signer{format: format, key: key, now: time.Now}
+	switch format {
+	case FormatMinisign:
+		public, ok := key.Public().(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("minisign signatures need an Ed25519 key")
+		}
+		// minisign key IDs are random; deriving it keeps the ID stable for the same key
+		sum := sha256.Sum256(public)
+		copy(s.keyID[:], sum[:8])
+	case FormatCosign:
+		public, ok := key.Public().(*ecdsa.PublicKey)
+		if !ok || public.Curve != elliptic.P256() {
+			return nil, errors.New("cosign signatures need an ECDSA P-256 key")
+		}
+	default:
+		return nil, fmt.Errorf("unknown signature format %s", format)
+	}
+	return s, nil
+}
+
+// Extension returns the suffix signature files are stored under next to the signed file
+func (s *Signer) Extension() string {
+	if s.format == FormatMinisign {
+		return ".minisig"
+	}
+	return ".sig"
+}
+
+// Sign returns the signature of data, which is published as name
+func (s *Signer) Sign(name string, data []byte) ([]byte, error) {
+	if s.format == FormatCosign {
+		digest := sha256.Sum256(data)
+		sig, err := ecdsa.SignASN1(rand.Reader, s.key.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign %s: %w", name, err)
+		}
+		return []byte(base64.StdEncoding.EncodeToString(sig)), nil
+	}
+
+	// Legacy (non-prehashed) Ed25519 signatures, which every minisign version verifies
+	key := s.key.(ed25519.PrivateKey)
+	signature := ed25519.Sign(key, data)
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s", s.now().Unix(), name)
+	global := ed25519.Sign(key, append(append([]byte{}, signature...), trusted...))
+
+	payload := append([]byte("Ed"), s.keyID[:]...)
+	payload = append(payload, signature...)
+
+	var b strings.Builder
+	b.WriteString("untrusted comment: signature from do-firewall-allowlister\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(payload) + "\n")
+	b.WriteString("trusted comment: " + trusted + "\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(global) + "\n")
+	return []byte(b.String()), nil
+}
+
+// PublicKey returns the public key consumers verify signatures with, as a minisign public key
+// or a PEM public key for cosign
+func (s *Signer) PublicKey() ([]byte, error) {
+	if s.format == FormatCosign {
+		der, err := x509.MarshalPKIXPublicKey(s.key.Public())
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode public key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	}
+
+	payload := append([]byte("Ed"), s.keyID[:]...)
+	payload = append(payload, s.key.Public().(ed25519.PublicKey)...)
+	comment := fmt.Sprintf("untrusted comment: minisign public key %016X\n", binary.LittleEndian.Uint64(s.keyID[:]))
+	return []byte(comment + base64.StdEncoding.EncodeToString(payload) + "\n"), nil
+}
@@ -0,0 +1,166 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pemKey encodes a private key as the PKCS#8 PEM block openssl genpkey writes
+func pemKey(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestMinisign(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := NewSigner(FormatMinisign, pemKey(t, key))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	data := []byte("173.245.48.0/20\n203.0.113.5\n")
+	sig, err := signer.Sign("allowlist.txt", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signer.Extension() != ".minisig" {
+		t.Errorf("unexpected extension %s", signer.Extension())
+	}
+
+	// Verify as minisign does: the public key and signature share the key ID, the signature
+	// covers the data, and the global signature covers the signature and trusted comment
+	publicKey, err := signer.PublicKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pubLines := strings.Split(strings.TrimSpace(string(publicKey)), "\n")
+	if len(pubLines) != 2 || !strings.HasPrefix(pubLines[0], "untrusted comment: minisign public key ") {
+		t.Fatalf("unexpected public key %q", publicKey)
+	}
+	pub, err := base64.StdEncoding.DecodeString(pubLines[1])
+	if err != nil || len(pub) != 42 || string(pub[:2]) != "Ed" {
+		t.Fatalf("unexpected public key payload %q", pubLines[1])
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(sig)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+	payload, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(payload) != 74 || string(payload[:2]) != "Ed" {
+		t.Fatalf("unexpected signature payload %q", lines[1])
+	}
+	if !bytes.Equal(payload[2:10], pub[2:10]) {
+		t.Error("expected the signature key ID to match the public key")
+	}
+	if !ed25519.Verify(pub[10:], data, payload[10:]) {
+		t.Error("expected the signature to verify")
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		t.Fatalf("unexpected global signature %q", lines[3])
+	}
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if trusted != "timestamp:1700000000\tfile:allowlist.txt" {
+		t.Errorf("unexpected trusted comment %q", trusted)
+	}
+	if !ed25519.Verify(pub[10:], append(payload[10:], trusted...), global) {
+		t.Error("expected the global signature to verify")
+	}
+}
+
+func TestCosign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+
+	// openssl ecparam -genkey writes SEC1 keys, openssl genpkey PKCS#8 ones
+	for name, keyPEM := range map[string][]byte{
+		"sec1":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+		"pkcs8": pemKey(t, key),
+	} {
+		t.Run(name, func(t *testing.T) {
+			signer, err := NewSigner(FormatCosign, keyPEM)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data := []byte(`{"count":1}`)
+			sig, err := signer.Sign("allowlist.json", data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			raw, err := base64.StdEncoding.DecodeString(string(sig))
+			if err != nil {
+				t.Fatalf("expected a base64 signature, got %q", sig)
+			}
+
+			publicKey, err := signer.PublicKey()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			block, _ := pem.Decode(publicKey)
+			if block == nil || block.Type != "PUBLIC KEY" {
+				t.Fatalf("unexpected public key %q", publicKey)
+			}
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			digest := sha256.Sum256(data)
+			if !ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], raw) {
+				t.Error("expected the signature to verify")
+			}
+		})
+	}
+}
+
+func TestNewSignerErrors(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	tests := []struct {
+		name   string
+		format string
+		key    []byte
+	}{
+		{name: "not PEM", format: FormatMinisign, key: []byte("not a key")},
+		{name: "encrypted", format: FormatCosign, key: pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED SIGSTORE PRIVATE KEY", Bytes: []byte("x")})},
+		{name: "minisign with ECDSA key", format: FormatMinisign, key: pemKey(t, ecKey)},
+		{name: "cosign with Ed25519 key", format: FormatCosign, key: pemKey(t, edKey)},
+		{name: "cosign with P-384 key", format: FormatCosign, key: pemKey(t, ecKey)},
+		{name: "unknown format", format: "gpg", key: pemKey(t, edKey)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSigner(tt.format, tt.key); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
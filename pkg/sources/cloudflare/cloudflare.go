@@ -2,13 +2,15 @@ package cloudflare
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/jpillora/backoff"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
 	"go.uber.org/zap"
 )
 
@@ -17,6 +19,8 @@ type Client struct {
 	httpClient *http.Client
 	logger     *zap.Logger
 	baseURL    string
+	// clock times the retry backoff and is faked in tests
+	clock clock.Clock
 }
 
 // CloudflareIPsResponse represents the response from Cloudflare IPs API
@@ -37,11 +41,20 @@ func NewClient(baseURL string, logger *zap.Logger) *Client {
 		},
 		logger:  logger.Named("cloudflare"),
 		baseURL: baseURL,
+		clock:   clock.Real,
 	}
 }
 
-// FetchIPs fetches Cloudflare IP ranges from their API
+// FetchIPs fetches Cloudflare IP ranges from their API, once per run of ctx
 func (c *Client) FetchIPs(ctx context.Context) ([]string, error) {
+	ips, err := sources.Cached(ctx, "cloudflare "+c.baseURL, func() ([]string, error) {
+		return c.fetchIPs(ctx)
+	})
+	return slices.Clone(ips), err
+}
+
+// fetchIPs requests the IP ranges from the API
+func (c *Client) fetchIPs(ctx context.Context) ([]string, error) {
 	c.logger.Debug("Fetching Cloudflare IPs", zap.String("url", c.baseURL))
 
 	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL, nil)
@@ -67,14 +80,8 @@ func (c *Client) FetchIPs(ctx context.Context) ([]string, error) {
 		return nil, fmt.Errorf("unexpected status code: %d %s", resp.StatusCode, resp.Status)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	response, err := decodeResponse(resp.Body)
 	if err != nil {
-		c.logger.Error("Failed to read response body", zap.Error(err))
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	var response CloudflareIPsResponse
-	if err := json.Unmarshal(body, &response); err != nil {
 		c.logger.Error("Failed to parse JSON response", zap.Error(err))
 		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
 	}
@@ -130,10 +137,15 @@ func (c *Client) FetchIPsWithRetry(ctx context.Context, maxRetries int) ([]strin
 			backoffDuration := b.Duration()
 			c.logger.Debug("Waiting before retry", zap.Duration("backoff", backoffDuration))
 
+			// Every retry of the run shares its retry budget
+			if !retrybudget.Take(ctx, backoffDuration) {
+				return nil, fmt.Errorf("failed to fetch Cloudflare IPs after %d attempts: %w: %w", attempt, retrybudget.ErrExhausted, lastErr)
+			}
+
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
-			case <-time.After(backoffDuration):
+			case <-c.clock.After(backoffDuration):
 				// Continue to next attempt
 			}
 		}
@@ -0,0 +1,142 @@
+package cloudflare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// decodeResponse reads an IPs API response token by token, keeping only the CIDR lists and errors
+// and skipping every other value without buffering it, so a large mirror or an extended document
+// never has to fit in memory as a whole
+func decodeResponse(r io.Reader) (*CloudflareIPsResponse, error) {
+	dec := json.NewDecoder(r)
+	var response CloudflareIPsResponse
+
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "success":
+			return dec.Decode(&response.Success)
+		case "errors":
+			return decodeArray(dec, func() error {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				// Errors are strings or {"code":…,"message":…} objects
+				var text string
+				if json.Unmarshal(raw, &text) != nil {
+					var compact bytes.Buffer
+					_ = json.Compact(&compact, raw)
+					text = compact.String()
+				}
+				response.Errors = append(response.Errors, text)
+				return nil
+			})
+		case "result":
+			return decodeObject(dec, func(key string) error {
+				switch key {
+				case "ipv4_cidrs":
+					return decodeStrings(dec, &response.Result.IPv4CIDRs)
+				case "ipv6_cidrs":
+					return decodeStrings(dec, &response.Result.IPv6CIDRs)
+				default:
+					return skipValue(dec)
+				}
+			})
+		default:
+			return skipValue(dec)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// decodeObject calls field with the key of every member of the next object, which must consume
+// the member's value; null is accepted as an empty object
+func decodeObject(dec *json.Decoder, field func(key string) error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected an object, got %v", token)
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := field(token.(string)); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeArray calls element for every element of the next array, which must consume it; null is
+// accepted as an empty array
+func decodeArray(dec *json.Decoder, element func() error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected an array, got %v", token)
+	}
+
+	for dec.More() {
+		if err := element(); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeStrings appends the elements of the next array of strings to values
+func decodeStrings(dec *json.Decoder, values *[]string) error {
+	if *values == nil {
+		*values = []string{}
+	}
+	return decodeArray(dec, func() error {
+		var value string
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		*values = append(*values, value)
+		return nil
+	})
+}
+
+// skipValue consumes the next value, walking nested objects and arrays token by token
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := token.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
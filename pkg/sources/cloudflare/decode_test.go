@@ -0,0 +1,92 @@
+package cloudflare
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expectedV4  []string
+		expectedV6  []string
+		errors      []string
+		success     bool
+		expectError bool
+	}{
+		{
+			name:       "members in any order with unknown fields",
+			body:       `{"result":{"etag":"abc","ipv6_cidrs":["2400:cb00::/32"],"meta":{"x":[1,{"y":null}]},"ipv4_cidrs":["173.245.48.0/20"]},"messages":[],"success":true}`,
+			expectedV4: []string{"173.245.48.0/20"},
+			expectedV6: []string{"2400:cb00::/32"},
+			success:    true,
+		},
+		{
+			name:   "error objects",
+			body:   `{"success":false,"errors":[{"code":10000,"message":"Authentication error"},"plain"],"result":null}`,
+			errors: []string{`{"code":10000,"message":"Authentication error"}`, "plain"},
+		},
+		{
+			name:        "result is not an object",
+			body:        `{"success":true,"result":["173.245.48.0/20"]}`,
+			expectError: true,
+		},
+		{
+			name:        "CIDR is not a string",
+			body:        `{"success":true,"result":{"ipv4_cidrs":[42]}}`,
+			expectError: true,
+		},
+		{
+			name:        "truncated document",
+			body:        `{"success":true,"result":{"ipv4_cidrs":["173.245.48.0/20"`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := decodeResponse(strings.NewReader(tt.body))
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if response.Success != tt.success {
+				t.Errorf("expected success %v, got %v", tt.success, response.Success)
+			}
+			if fmt.Sprint(response.Result.IPv4CIDRs) != fmt.Sprint(tt.expectedV4) || fmt.Sprint(response.Result.IPv6CIDRs) != fmt.Sprint(tt.expectedV6) {
+				t.Errorf("unexpected CIDRs %v %v", response.Result.IPv4CIDRs, response.Result.IPv6CIDRs)
+			}
+			if fmt.Sprint(response.Errors) != fmt.Sprint(tt.errors) {
+				t.Errorf("expected errors %v, got %v", tt.errors, response.Errors)
+			}
+		})
+	}
+}
+
+func TestDecodeResponseLargeDocument(t *testing.T) {
+	// Several megabytes of unrelated members around the CIDRs, produced without ever holding
+	// the document in memory
+	filler := `{"name":"AzureCloud","properties":{"addressPrefixes":["13.64.0.0/16","2603:1000::/40"]}},`
+	parts := []io.Reader{strings.NewReader(`{"values":[`)}
+	for i := 0; i < 50000; i++ {
+		parts = append(parts, strings.NewReader(filler))
+	}
+	parts = append(parts, strings.NewReader(`{}],"success":true,"result":{"ipv4_cidrs":["173.245.48.0/20"],"ipv6_cidrs":[]}}`))
+
+	response, err := decodeResponse(io.MultiReader(parts...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !response.Success || len(response.Result.IPv4CIDRs) != 1 || len(response.Result.IPv6CIDRs) != 0 {
+		t.Errorf("unexpected response %+v", response)
+	}
+}
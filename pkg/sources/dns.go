@@ -0,0 +1,13 @@
+package sources
+
+import (
+	"errors"
+	"net"
+)
+
+// NotFound reports whether err is a DNS lookup of a name that does not exist, an NXDOMAIN answer
+// that retrying cannot fix; timeouts and SERVFAIL answers are worth retrying
+func NotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound && !dnsErr.IsTimeout && !dnsErr.IsTemporary
+}
@@ -0,0 +1,442 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+	"go.uber.org/zap"
+)
+
+// ErrDomainsNotFound is returned when the domains failing the resolution do not exist, which
+// retrying cannot fix
+var ErrDomainsNotFound = errors.New("domains do not exist")
+
+// DomainResult is how the resolution of a domain went
+type DomainResult struct {
+	Domain   string        `json:"domain"`
+	IPs      []string      `json:"ips,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// TTL is the shortest TTL of the records answering the lookup, zero when unknown
+	TTL   time.Duration `json:"ttl,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// Record types a source resolves its domains to
+const (
+	RecordA    = "A"
+	RecordAAAA = "AAAA"
+)
+
+// DefaultTimeout bounds each lookup when no timeout is configured
+const DefaultTimeout = 10 * time.Second
+
+// Resolver looks up the addresses of a domain
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Client resolves the domains of a DNS source, such as the Netdata Cloud domains
+type Client struct {
+	resolver Resolver
+	logger   *zap.Logger
+	name     string
+	// server is the address of the custom resolver and doh the URL of the DNS-over-HTTPS
+	// endpoint, both empty for the system resolver
+	server string
+	doh    string
+	// timeout bounds each lookup
+	timeout time.Duration
+	// ipv4 and ipv6 keep the addresses of A and AAAA records
+	ipv4, ipv6 bool
+	// required marks the domains that must resolve (true) or may fail with a warning (false);
+	// without an entry, a domain only fails the resolution if no other domain resolves
+	required map[string]bool
+	// clock times the retry backoff and the resolutions, and is faked in tests
+	clock clock.Clock
+
+	mu sync.Mutex
+	// results are the domains of the latest resolution, which started at resolvedAt
+	results    []DomainResult
+	resolvedAt time.Time
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// NewClient creates a client resolving the domains of the named source to A and AAAA records
+// through the system resolver
+func NewClient(name string, logger *zap.Logger, opts ...Option) *Client {
+	c := &Client{
+		logger:  logger.Named("dns").With(zap.String("source", name)),
+		name:    name,
+		ipv4:    true,
+		ipv6:    true,
+		timeout: DefaultTimeout,
+		clock:   clock.Real,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.resolver == nil {
+		c.resolver = newResolver(c.server, c.doh, c.timeout)
+	}
+	return c
+}
+
+// WithResolver resolves the domains through resolver
+func WithResolver(resolver Resolver) Option {
+	return func(c *Client) {
+		c.resolver = resolver
+	}
+}
+
+// WithServer resolves the domains through the DNS server at address, host:port or a host on port
+// 53, rather than the system resolver
+func WithServer(address string) Option {
+	return func(c *Client) {
+		if address == "" {
+			return
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "53")
+		}
+		c.server = address
+	}
+}
+
+// WithDoH resolves the domains through the DNS-over-HTTPS endpoint at url (RFC 8484), such as
+// https://cloudflare-dns.com/dns-query, rather than the system resolver
+func WithDoH(url string) Option {
+	return func(c *Client) {
+		c.doh = url
+	}
+}
+
+// WithTimeout bounds each lookup by timeout rather than DefaultTimeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// WithRecordTypes keeps the addresses of the given record types, A and AAAA; both are kept when
+// none is given
+func WithRecordTypes(types []string) Option {
+	return func(c *Client) {
+		if len(types) == 0 {
+			return
+		}
+		c.ipv4 = slices.ContainsFunc(types, func(t string) bool { return strings.EqualFold(t, RecordA) })
+		c.ipv6 = slices.ContainsFunc(types, func(t string) bool { return strings.EqualFold(t, RecordAAAA) })
+	}
+}
+
+// newResolver returns a resolver querying the DoH endpoint, else server, or the servers of the
+// system when both are empty
+func newResolver(server, doh string, timeout time.Duration) *net.Resolver {
+	if doh != "" {
+		return newDoHResolver(doh, timeout)
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{
+				Timeout: timeout,
+			}
+			if server != "" {
+				address = server
+			}
+			conn, err := d.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return observeTTL(ctx, conn), nil
+		},
+	}
+}
+
+// Name returns the name of the source
+func (c *Client) Name() string {
+	return c.name
+}
+
+// SetRequired marks the domains that must resolve for the resolution to succeed (true) and the
+// ones whose failures only warn (false)
+func (c *Client) SetRequired(required map[string]bool) {
+	c.required = required
+}
+
+// ResolveDomains resolves IP addresses for the given domains; a required domain failing fails the
+// resolution, an optional one only warns, and the others fail it when no domain resolves
+func (c *Client) ResolveDomains(ctx context.Context, domains []string) ([]string, error) {
+	c.logger.Info("Resolving domains", zap.Strings("domains", domains))
+
+	var allIPs []string
+	var resolveErrors, requiredErrors []error
+	failed := 0
+	results := make([]DomainResult, 0, len(domains))
+	resolvedAt := c.clock.Now()
+	defer func() { c.setResults(results, resolvedAt) }()
+
+	for _, domain := range domains {
+		c.logger.Debug("Resolving domain", zap.String("domain", domain))
+
+		start := c.clock.Now()
+		ips, ttl, err := c.resolveDomain(ctx, domain)
+		result := DomainResult{Domain: domain, IPs: ips, Duration: c.clock.Now().Sub(start), TTL: ttl}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+
+		if err != nil {
+			failed++
+			err = fmt.Errorf("failed to resolve %s: %w", domain, err)
+			required, set := c.required[domain]
+			switch {
+			case !set:
+				c.logger.Error("Failed to resolve domain",
+					zap.String("domain", domain),
+					zap.Error(err))
+				resolveErrors = append(resolveErrors, err)
+			case required:
+				c.logger.Error("Failed to resolve required domain",
+					zap.String("domain", domain),
+					zap.Error(err))
+				requiredErrors = append(requiredErrors, err)
+			default:
+				c.logger.Warn("Failed to resolve optional domain",
+					zap.String("domain", domain),
+					zap.Error(err))
+			}
+			continue
+		}
+
+		c.logger.Debug("Successfully resolved domain",
+			zap.String("domain", domain),
+			zap.Strings("ips", ips),
+			zap.Int("count", len(ips)))
+
+		allIPs = append(allIPs, ips...)
+	}
+
+	if len(requiredErrors) > 0 {
+		c.logger.Error("Failed to resolve required domains", zap.Int("error_count", len(requiredErrors)))
+		return nil, domainsError("failed to resolve required domains", requiredErrors)
+	}
+
+	if len(resolveErrors) > 0 && len(allIPs) == 0 {
+		// All domains failed to resolve
+		c.logger.Error("Failed to resolve any domains", zap.Int("error_count", len(resolveErrors)))
+		return nil, domainsError("failed to resolve any domains", resolveErrors)
+	}
+
+	if len(resolveErrors) > 0 {
+		// Some domains failed, but we have some IPs
+		c.logger.Warn("Some domains failed to resolve",
+			zap.Int("error_count", len(resolveErrors)),
+			zap.Int("successful_ips", len(allIPs)))
+	}
+
+	// Remove duplicates
+	uniqueIPs := removeDuplicates(allIPs)
+
+	c.logger.Info("Successfully resolved domains",
+		zap.Int("total_domains", len(domains)),
+		zap.Int("resolved_ips", len(uniqueIPs)),
+		zap.Int("failed_domains", failed))
+
+	return uniqueIPs, nil
+}
+
+// Results returns how each domain of the latest resolution went
+func (c *Client) Results() []DomainResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(c.results)
+}
+
+// Expiry returns when the first record of the latest resolution expires by its TTL, or the zero
+// time when no resolved record carried a TTL
+func (c *Client) Expiry() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var shortest time.Duration
+	for _, result := range c.results {
+		if result.TTL > 0 && (shortest == 0 || result.TTL < shortest) {
+			shortest = result.TTL
+		}
+	}
+	if shortest == 0 {
+		return time.Time{}
+	}
+	return c.resolvedAt.Add(shortest)
+}
+
+// setResults records the domains of the latest resolution
+func (c *Client) setResults(results []DomainResult, resolvedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results = results
+	c.resolvedAt = resolvedAt
+}
+
+// domainsError reports the domains that failed the resolution, as ErrDomainsNotFound when none of
+// them exist
+func domainsError(message string, errs []error) error {
+	if !slices.ContainsFunc(errs, func(err error) bool { return !sources.NotFound(err) }) {
+		return fmt.Errorf("%w: %v", ErrDomainsNotFound, errs)
+	}
+	return fmt.Errorf("%s: %v", message, errs)
+}
+
+// resolveDomain resolves the IPv4 and IPv6 addresses of the record types for a domain, IPv4 first,
+// with the shortest TTL of the records
+func (c *Client) resolveDomain(ctx context.Context, domain string) ([]string, time.Duration, error) {
+	addrs, ttl, err := c.lookup(ctx, domain)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ipv4, ipv6 []string
+	for _, addr := range addrs {
+		switch {
+		case addr.IP.To4() != nil:
+			if c.ipv4 {
+				ipv4 = append(ipv4, addr.IP.String())
+			}
+		case addr.IP.To16() != nil:
+			if c.ipv6 {
+				ipv6 = append(ipv6, addr.IP.String())
+			}
+		}
+	}
+
+	allIPs := append(ipv4, ipv6...)
+	if len(allIPs) == 0 {
+		return nil, 0, fmt.Errorf("no IP addresses found for domain %s", domain)
+	}
+
+	return allIPs, ttl, nil
+}
+
+// lookupResult is a lookup through a custom resolver kept for the run
+type lookupResult struct {
+	addrs []net.IPAddr
+	ttl   time.Duration
+}
+
+// lookup looks the domain up once per run of ctx and resolver within the timeout, sharing the
+// lookups of the system resolver with the other sources; the TTL is zero when unknown, e.g. when
+// another source of the run looked the domain up through the system resolver first
+func (c *Client) lookup(ctx context.Context, domain string) ([]net.IPAddr, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	recorder := &ttlRecorder{}
+	ctx = withTTLRecorder(ctx, recorder)
+
+	endpoint := c.server
+	if c.doh != "" {
+		endpoint = c.doh
+	}
+	if endpoint == "" {
+		addrs, err := sources.LookupIPAddr(ctx, c.resolver, domain)
+		ttl, _ := recorder.get()
+		return addrs, ttl, err
+	}
+	result, err := sources.Cached(ctx, "dns "+endpoint+" "+domain, func() (lookupResult, error) {
+		addrs, err := c.resolver.LookupIPAddr(ctx, domain)
+		ttl, _ := recorder.get()
+		return lookupResult{addrs: addrs, ttl: ttl}, err
+	})
+	return result.addrs, result.ttl, err
+}
+
+// ResolveDomainsWithRetry resolves domains with retry logic using exponential backoff with jitter
+func (c *Client) ResolveDomainsWithRetry(ctx context.Context, domains []string, maxRetries int) ([]string, error) {
+	var lastErr error
+
+	// Configure exponential backoff with jitter
+	b := &backoff.Backoff{
+		Min:    100 * time.Millisecond,
+		Max:    10 * time.Second,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		c.logger.Debug("Attempting to resolve domains",
+			zap.Int("attempt", attempt),
+			zap.Int("max_retries", maxRetries))
+
+		ips, err := c.ResolveDomains(ctx, domains)
+		if err == nil {
+			return ips, nil
+		}
+		// Misspelled or deleted domains fail the same way on every attempt
+		if errors.Is(err, ErrDomainsNotFound) {
+			c.logger.Error("Domains do not exist, not retrying", zap.Error(err))
+			return nil, fmt.Errorf("failed to resolve %s domains, check them for misspellings: %w", c.name, err)
+		}
+
+		lastErr = err
+		c.logger.Warn("Failed to resolve domains, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("max_retries", maxRetries),
+			zap.Error(err))
+
+		if attempt < maxRetries {
+			// Use exponential backoff with jitter
+			backoffDuration := b.Duration()
+			c.logger.Debug("Waiting before retry", zap.Duration("backoff", backoffDuration))
+
+			// Every retry of the run shares its retry budget
+			if !retrybudget.Take(ctx, backoffDuration) {
+				return nil, fmt.Errorf("failed to resolve %s domains after %d attempts: %w: %w", c.name, attempt, retrybudget.ErrExhausted, lastErr)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-c.clock.After(backoffDuration):
+				// Continue to next attempt
+			}
+		}
+	}
+
+	c.logger.Error("Failed to resolve domains after all retries",
+		zap.Int("max_retries", maxRetries),
+		zap.Error(lastErr))
+
+	return nil, fmt.Errorf("failed to resolve %s domains after %d retries: %w", c.name, maxRetries, lastErr)
+}
+
+// removeDuplicates removes duplicate IP addresses from the slice
+func removeDuplicates(ips []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+
+	for _, ip := range ips {
+		if !seen[ip] {
+			seen[ip] = true
+			unique = append(unique, ip)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,415 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeResolver struct {
+	responses map[string][]net.IPAddr
+	errors    map[string]error
+	calls     int
+}
+
+func (f *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	f.calls++
+	if err, ok := f.errors[host]; ok {
+		return nil, err
+	}
+	return f.responses[host], nil
+}
+
+func TestNewClient(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+
+	client := NewClient("netdata", logger)
+
+	if client == nil {
+		t.Fatal("expected client to be created, got nil")
+	}
+
+	if client.resolver == nil {
+		t.Error("expected resolver to be initialized")
+	}
+
+	if client.logger == nil {
+		t.Error("expected logger to be set")
+	}
+}
+
+func TestRemoveDuplicates(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+	}{
+		{
+			name:     "no duplicates",
+			input:    []string{"192.168.1.1", "192.168.1.2", "192.168.1.3"},
+			expected: []string{"192.168.1.1", "192.168.1.2", "192.168.1.3"},
+		},
+		{
+			name:     "with duplicates",
+			input:    []string{"192.168.1.1", "192.168.1.2", "192.168.1.1", "192.168.1.3", "192.168.1.2"},
+			expected: []string{"192.168.1.1", "192.168.1.2", "192.168.1.3"},
+		},
+		{
+			name:     "all duplicates",
+			input:    []string{"192.168.1.1", "192.168.1.1", "192.168.1.1"},
+			expected: []string{"192.168.1.1"},
+		},
+		{
+			name:     "empty input",
+			input:    []string{},
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := removeDuplicates(tt.input)
+
+			if len(result) != len(tt.expected) {
+				t.Errorf("expected %d unique IPs, got %d", len(tt.expected), len(result))
+				return
+			}
+
+			// Check if all expected IPs are present (order might differ)
+			expectedMap := make(map[string]bool)
+			for _, ip := range tt.expected {
+				expectedMap[ip] = true
+			}
+
+			for _, ip := range result {
+				if !expectedMap[ip] {
+					t.Errorf("unexpected IP in result: %s", ip)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveDomains(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+
+	tests := []struct {
+		name        string
+		domains     []string
+		responses   map[string][]net.IPAddr
+		errors      map[string]error
+		expectedIPs []string
+		expectError bool
+	}{
+		{
+			name:    "successful resolution",
+			domains: []string{"example.com", "test.com"},
+			responses: map[string][]net.IPAddr{
+				"example.com": {
+					{IP: net.ParseIP("192.168.1.1")},
+					{IP: net.ParseIP("192.168.1.2")},
+				},
+				"test.com": {
+					{IP: net.ParseIP("10.0.0.1")},
+				},
+			},
+			expectedIPs: []string{"192.168.1.1", "192.168.1.2", "10.0.0.1"},
+		},
+		{
+			name:    "partial failure",
+			domains: []string{"example.com", "nonexistent.com"},
+			responses: map[string][]net.IPAddr{
+				"example.com": {
+					{IP: net.ParseIP("192.168.1.1")},
+				},
+			},
+			errors: map[string]error{
+				"nonexistent.com": &net.DNSError{
+					Err:  "no such host",
+					Name: "nonexistent.com",
+				},
+			},
+			expectedIPs: []string{"192.168.1.1"},
+		},
+		{
+			name:    "all domains fail",
+			domains: []string{"nonexistent1.com", "nonexistent2.com"},
+			errors: map[string]error{
+				"nonexistent1.com": &net.DNSError{
+					Err:  "no such host",
+					Name: "nonexistent1.com",
+				},
+				"nonexistent2.com": &net.DNSError{
+					Err:  "no such host",
+					Name: "nonexistent2.com",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name:        "empty domains",
+			domains:     []string{},
+			expectedIPs: []string{},
+		},
+		{
+			name:    "IPv6 addresses",
+			domains: []string{"ipv6.example.com"},
+			responses: map[string][]net.IPAddr{
+				"ipv6.example.com": {
+					{IP: net.ParseIP("2001:db8::1")},
+					{IP: net.ParseIP("192.168.1.1")}, // Mixed IPv4 and IPv6
+				},
+			},
+			expectedIPs: []string{"192.168.1.1", "2001:db8::1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{responses: tt.responses, errors: tt.errors}
+			client := NewClient("netdata", logger, WithResolver(resolver))
+
+			ips, err := client.ResolveDomains(context.Background(), tt.domains)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", ips)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(ips) == 0 && len(tt.expectedIPs) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(ips, tt.expectedIPs) {
+				t.Errorf("expected %v, got %v", tt.expectedIPs, ips)
+			}
+		})
+	}
+}
+
+func TestResolveDomainsWithRetry(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	client := NewClient("netdata", logger)
+
+	// Test with empty domains (no network required)
+	ctx := context.Background()
+	ips, err := client.ResolveDomainsWithRetry(ctx, []string{}, 3)
+	if err != nil {
+		t.Errorf("unexpected error for empty domains: %v", err)
+	}
+	if len(ips) != 0 {
+		t.Errorf("expected empty result for empty domains, got %v", ips)
+	}
+
+	// For actual domain resolution tests, we'd need to mock the resolver
+	// or use integration tests with real domains
+}
+
+func TestResolveDomainsWithRetryNotFound(t *testing.T) {
+	resolver := &fakeResolver{errors: map[string]error{
+		"app.netdata.cluod": &net.DNSError{Err: "no such host", Name: "app.netdata.cluod", IsNotFound: true},
+	}}
+	client := NewClient("netdata", zaptest.NewLogger(t), WithResolver(resolver))
+
+	_, err := client.ResolveDomainsWithRetry(context.Background(), []string{"app.netdata.cluod"}, 3)
+	if !errors.Is(err, ErrDomainsNotFound) {
+		t.Fatalf("expected ErrDomainsNotFound, got %v", err)
+	}
+	if resolver.calls != 1 {
+		t.Errorf("expected a missing domain not to be retried, got %d lookups", resolver.calls)
+	}
+}
+
+func TestResolveDomainsWithRetryServerFailure(t *testing.T) {
+	resolver := &fakeResolver{errors: map[string]error{
+		"app.netdata.cloud": &net.DNSError{Err: "server misbehaving", Name: "app.netdata.cloud", IsTemporary: true},
+	}}
+	client := NewClient("netdata", zaptest.NewLogger(t), WithResolver(resolver))
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	client.clock = fake
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.ResolveDomainsWithRetry(context.Background(), []string{"app.netdata.cloud"}, 2)
+		done <- err
+	}()
+
+	// The retry waits out its backoff on the fake clock, which the test moves past it
+	fake.BlockUntil(1)
+	fake.Advance(10 * time.Second)
+
+	err := <-done
+	if err == nil || errors.Is(err, ErrDomainsNotFound) {
+		t.Fatalf("expected a retried failure, got %v", err)
+	}
+	if resolver.calls != 2 {
+		t.Errorf("expected a SERVFAIL to be retried, got %d lookups", resolver.calls)
+	}
+}
+
+func TestResolveDomainsRequirements(t *testing.T) {
+	responses := map[string][]net.IPAddr{
+		"app.netdata.cloud": {{IP: net.ParseIP("203.0.113.10")}},
+	}
+	errs := map[string]error{
+		"mqtt.netdata.cloud": &net.DNSError{Err: "server misbehaving", Name: "mqtt.netdata.cloud", IsTemporary: true},
+		"api.netdata.cloud":  &net.DNSError{Err: "server misbehaving", Name: "api.netdata.cloud", IsTemporary: true},
+	}
+
+	tests := []struct {
+		name        string
+		domains     []string
+		required    map[string]bool
+		expectedIPs []string
+		expectError bool
+	}{
+		{
+			name:        "failing domain without option is tolerated when another resolves",
+			domains:     []string{"app.netdata.cloud", "mqtt.netdata.cloud"},
+			expectedIPs: []string{"203.0.113.10"},
+		},
+		{
+			name:        "failing required domain fails the resolution",
+			domains:     []string{"app.netdata.cloud", "mqtt.netdata.cloud"},
+			required:    map[string]bool{"mqtt.netdata.cloud": true},
+			expectError: true,
+		},
+		{
+			name:     "failing optional domains only warn",
+			domains:  []string{"mqtt.netdata.cloud", "api.netdata.cloud"},
+			required: map[string]bool{"mqtt.netdata.cloud": false, "api.netdata.cloud": false},
+		},
+		{
+			name:        "failing domain without option fails when only optional domains remain",
+			domains:     []string{"mqtt.netdata.cloud", "api.netdata.cloud"},
+			required:    map[string]bool{"mqtt.netdata.cloud": false},
+			expectError: true,
+		},
+		{
+			name:        "resolved required domain",
+			domains:     []string{"app.netdata.cloud", "mqtt.netdata.cloud"},
+			required:    map[string]bool{"app.netdata.cloud": true, "mqtt.netdata.cloud": false},
+			expectedIPs: []string{"203.0.113.10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient("netdata", zaptest.NewLogger(t), WithResolver(&fakeResolver{responses: responses, errors: errs}))
+			client.SetRequired(tt.required)
+
+			ips, err := client.ResolveDomains(context.Background(), tt.domains)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", ips)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(ips) != len(tt.expectedIPs) || (len(ips) > 0 && !reflect.DeepEqual(ips, tt.expectedIPs)) {
+				t.Errorf("expected %v, got %v", tt.expectedIPs, ips)
+			}
+		})
+	}
+}
+
+func TestResolveDomainsResults(t *testing.T) {
+	resolver := &fakeResolver{
+		responses: map[string][]net.IPAddr{
+			"app.netdata.cloud": {{IP: net.ParseIP("203.0.113.10")}, {IP: net.ParseIP("2001:db8::10")}},
+		},
+		errors: map[string]error{
+			"mqtt.netdata.cloud": &net.DNSError{Err: "i/o timeout", Name: "mqtt.netdata.cloud", IsTimeout: true},
+		},
+	}
+	client := NewClient("netdata", zaptest.NewLogger(t), WithResolver(resolver))
+
+	if _, err := client.ResolveDomains(context.Background(), []string{"app.netdata.cloud", "mqtt.netdata.cloud"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := client.Results()
+	if len(results) != 2 {
+		t.Fatalf("expected a result per domain, got %+v", results)
+	}
+	if results[0].Domain != "app.netdata.cloud" || !reflect.DeepEqual(results[0].IPs, []string{"203.0.113.10", "2001:db8::10"}) || results[0].Error != "" {
+		t.Errorf("expected the resolved domain with its addresses, got %+v", results[0])
+	}
+	if results[1].Domain != "mqtt.netdata.cloud" || len(results[1].IPs) != 0 || results[1].Error == "" {
+		t.Errorf("expected the failed domain with its error, got %+v", results[1])
+	}
+}
+
+func TestResolveDomainsRecordTypes(t *testing.T) {
+	resolver := &fakeResolver{
+		responses: map[string][]net.IPAddr{
+			"probes.example.com": {{IP: net.ParseIP("2001:db8::10")}, {IP: net.ParseIP("203.0.113.10")}},
+			"v4.example.com":     {{IP: net.ParseIP("203.0.113.20")}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		types       []string
+		domains     []string
+		expectedIPs []string
+		expectError bool
+	}{
+		{name: "every record type", domains: []string{"probes.example.com"}, expectedIPs: []string{"203.0.113.10", "2001:db8::10"}},
+		{name: "A records", types: []string{RecordA}, domains: []string{"probes.example.com"}, expectedIPs: []string{"203.0.113.10"}},
+		{name: "AAAA records", types: []string{"aaaa"}, domains: []string{"probes.example.com"}, expectedIPs: []string{"2001:db8::10"}},
+		{name: "no record of the type", types: []string{RecordAAAA}, domains: []string{"v4.example.com"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient("probes", zaptest.NewLogger(t), WithResolver(resolver), WithRecordTypes(tt.types))
+
+			ips, err := client.ResolveDomains(context.Background(), tt.domains)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", ips)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ips, tt.expectedIPs) {
+				t.Errorf("expected %v, got %v", tt.expectedIPs, ips)
+			}
+		})
+	}
+}
+
+func TestWithServer(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{address: "", expected: ""},
+		{address: "1.1.1.1", expected: "1.1.1.1:53"},
+		{address: "10.0.0.2:5353", expected: "10.0.0.2:5353"},
+		{address: "2606:4700:4700::1111", expected: "[2606:4700:4700::1111]:53"},
+		{address: "[2606:4700:4700::1111]:853", expected: "[2606:4700:4700::1111]:853"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			client := NewClient("corp", zaptest.NewLogger(t), WithServer(tt.address))
+			if client.server != tt.expected {
+				t.Errorf("expected server %q, got %q", tt.expected, client.server)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// dohContentType is the media type of DNS messages sent over HTTPS
+const dohContentType = "application/dns-message"
+
+// newDoHResolver returns a resolver sending its queries to the DNS-over-HTTPS endpoint at url; the
+// Go resolver still builds the queries and parses the answers, only the transport is replaced
+func newDoHResolver(url string, timeout time.Duration) *net.Resolver {
+	client := &http.Client{Timeout: timeout}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return observeTTL(ctx, &dohConn{ctx: ctx, client: client, url: url}), nil
+		},
+	}
+}
+
+// dohConn carries the queries of the Go resolver to a DoH endpoint. It is not a net.PacketConn, so
+// the resolver frames each message with its two byte length as over TCP
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	url      string
+	deadline time.Time
+	query    bytes.Buffer
+	answer   bytes.Buffer
+}
+
+// Write buffers the query and posts it to the endpoint once it is complete
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.query.Write(b)
+	for c.query.Len() >= 2 {
+		length := int(binary.BigEndian.Uint16(c.query.Bytes()))
+		if c.query.Len() < 2+length {
+			break
+		}
+		c.query.Next(2)
+		answer, err := c.exchange(c.query.Next(length))
+		if err != nil {
+			return 0, err
+		}
+		c.answer.Write(binary.BigEndian.AppendUint16(nil, uint16(len(answer))))
+		c.answer.Write(answer)
+	}
+	return len(b), nil
+}
+
+// exchange posts a DNS message to the endpoint and returns the answer
+func (c *dohConn) exchange(message []byte) ([]byte, error) {
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(message))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DoH request: %w", err)
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+	req.Header.Set("User-Agent", "do-firewall-allowlister/1.0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query DoH endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from DoH endpoint: %d %s", resp.StatusCode, resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DoH answer: %w", err)
+	}
+	return answer, nil
+}
+
+// Read returns the framed answers of the queries written so far
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.answer.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.answer.Read(b)
+}
+
+// Close releases nothing, every query is a request of its own
+func (c *dohConn) Close() error { return nil }
+
+// LocalAddr returns nil, the conn has no local address
+func (c *dohConn) LocalAddr() net.Addr { return nil }
+
+// RemoteAddr returns nil, the endpoint is addressed by its URL
+func (c *dohConn) RemoteAddr() net.Addr { return nil }
+
+// SetDeadline bounds the requests of the queries written later
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+// SetReadDeadline does nothing, answers are read when the query is written
+func (c *dohConn) SetReadDeadline(t time.Time) error { return nil }
+
+// SetWriteDeadline bounds the requests of the queries written later
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
@@ -0,0 +1,93 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// dnsAnswer answers an A query with ip and any other query with no records
+func dnsAnswer(query []byte, ip net.IP) []byte {
+	// The question ends after its labels, type and class
+	end := 12
+	for query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+
+	answer := append([]byte{}, query[:end]...)
+	answer[2], answer[3] = 0x81, 0x80 // response, recursion desired and available
+	binary.BigEndian.PutUint16(answer[6:], 0)
+	binary.BigEndian.PutUint16(answer[10:], 0)
+	if qtype == 1 {
+		binary.BigEndian.PutUint16(answer[6:], 1)
+		answer = append(answer, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		answer = append(answer, ip.To4()...)
+	}
+	return answer
+}
+
+func TestResolveDomainsDoH(t *testing.T) {
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(dnsAnswer(query, net.ParseIP("203.0.113.10")))
+	}))
+	defer server.Close()
+
+	client := NewClient("corp", zaptest.NewLogger(t), WithDoH(server.URL))
+	ips, err := client.ResolveDomains(context.Background(), []string{"egress.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ips, []string{"203.0.113.10"}) {
+		t.Errorf("expected the address of the DoH answer, got %v", ips)
+	}
+	if contentType != dohContentType {
+		t.Errorf("expected queries posted as %s, got %q", dohContentType, contentType)
+	}
+	if results := client.Results(); len(results) != 1 || results[0].TTL != time.Minute {
+		t.Errorf("expected the TTL of the answer, got %+v", results)
+	}
+}
+
+func TestResolveDomainsDoHFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewClient("corp", zaptest.NewLogger(t), WithDoH(server.URL))
+	if ips, err := client.ResolveDomains(context.Background(), []string{"egress.example.com"}); err == nil {
+		t.Errorf("expected the failing endpoint to fail the resolution, got %v", ips)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient("corp", zaptest.NewLogger(t), WithDoH(server.URL), WithTimeout(50*time.Millisecond))
+	start := time.Now()
+	if _, err := client.ResolveDomains(context.Background(), []string{"egress.example.com"}); err == nil {
+		t.Fatal("expected the slow endpoint to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the lookup to give up after its timeout, took %s", elapsed)
+	}
+}
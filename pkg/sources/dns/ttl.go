@@ -0,0 +1,164 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// ttlKey is the context key of the TTL recorder of a lookup
+type ttlKey struct{}
+
+// ttlRecorder keeps the shortest TTL of the answers read during a lookup
+type ttlRecorder struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	set bool
+}
+
+// withTTLRecorder returns a context whose lookups report their TTLs to recorder
+func withTTLRecorder(ctx context.Context, recorder *ttlRecorder) context.Context {
+	return context.WithValue(ctx, ttlKey{}, recorder)
+}
+
+// observe records the TTL of an answer
+func (r *ttlRecorder) observe(ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.set || ttl < r.ttl {
+		r.ttl, r.set = ttl, true
+	}
+}
+
+// get returns the shortest TTL recorded, and whether any answer carried one
+func (r *ttlRecorder) get() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.ttl, r.set
+}
+
+// observeTTL wraps the conn of a lookup so the answers read from it report their TTLs to the
+// recorder of ctx; the Go resolver reads whole messages from packet conns and length-prefixed
+// messages from the others
+func observeTTL(ctx context.Context, conn net.Conn) net.Conn {
+	recorder, ok := ctx.Value(ttlKey{}).(*ttlRecorder)
+	if !ok {
+		return conn
+	}
+	if packetConn, ok := conn.(net.PacketConn); ok {
+		return &ttlPacketConn{Conn: conn, packetConn: packetConn, recorder: recorder}
+	}
+	return &ttlStreamConn{Conn: conn, recorder: recorder}
+}
+
+// ttlPacketConn reads one DNS message per read
+type ttlPacketConn struct {
+	net.Conn
+	packetConn net.PacketConn
+	recorder   *ttlRecorder
+}
+
+func (c *ttlPacketConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		if ttl, ok := answerTTL(b[:n]); ok {
+			c.recorder.observe(ttl)
+		}
+	}
+	return n, err
+}
+
+func (c *ttlPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return c.packetConn.ReadFrom(b)
+}
+
+func (c *ttlPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.packetConn.WriteTo(b, addr)
+}
+
+// ttlStreamConn reads DNS messages framed by their two byte length, in as many reads as it takes
+type ttlStreamConn struct {
+	net.Conn
+	recorder *ttlRecorder
+	buffer   []byte
+}
+
+func (c *ttlStreamConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.buffer = append(c.buffer, b[:n]...)
+	for len(c.buffer) >= 2 {
+		length := int(binary.BigEndian.Uint16(c.buffer))
+		if len(c.buffer) < 2+length {
+			break
+		}
+		if ttl, ok := answerTTL(c.buffer[2 : 2+length]); ok {
+			c.recorder.observe(ttl)
+		}
+		c.buffer = c.buffer[2+length:]
+	}
+	return n, err
+}
+
+// answerTTL returns the shortest TTL of the address and alias records answering a DNS message,
+// and false for messages without such records or that cannot be parsed
+func answerTTL(message []byte) (time.Duration, bool) {
+	if len(message) < 12 {
+		return 0, false
+	}
+	questions := int(binary.BigEndian.Uint16(message[4:]))
+	answers := int(binary.BigEndian.Uint16(message[6:]))
+
+	offset := 12
+	for range questions {
+		var ok bool
+		if offset, ok = skipName(message, offset); !ok || offset+4 > len(message) {
+			return 0, false
+		}
+		offset += 4
+	}
+
+	var shortest uint32
+	found := false
+	for range answers {
+		var ok bool
+		if offset, ok = skipName(message, offset); !ok || offset+10 > len(message) {
+			return 0, false
+		}
+		recordType := binary.BigEndian.Uint16(message[offset:])
+		ttl := binary.BigEndian.Uint32(message[offset+4:])
+		length := int(binary.BigEndian.Uint16(message[offset+8:]))
+		offset += 10 + length
+		if offset > len(message) {
+			return 0, false
+		}
+
+		// A, CNAME and AAAA records; an alias expires the addresses behind it as well
+		if recordType == 1 || recordType == 5 || recordType == 28 {
+			if !found || ttl < shortest {
+				shortest, found = ttl, true
+			}
+		}
+	}
+	return time.Duration(shortest) * time.Second, found
+}
+
+// skipName returns the offset after the domain name at offset, which ends with an empty label
+// or a compression pointer
+func skipName(message []byte, offset int) (int, bool) {
+	for offset < len(message) {
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			return offset + 1, true
+		case length&0xc0 == 0xc0:
+			return offset + 2, offset+2 <= len(message)
+		default:
+			offset += length + 1
+		}
+	}
+	return 0, false
+}
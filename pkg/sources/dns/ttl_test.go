@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAnswerTTL(t *testing.T) {
+	query := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0,
+		3, 'a', 'p', 'p', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1}
+
+	// dnsAnswer answers with an A record of TTL 60
+	answer := dnsAnswer(query, net.ParseIP("203.0.113.10"))
+	if ttl, ok := answerTTL(answer); !ok || ttl != time.Minute {
+		t.Errorf("expected a TTL of 1m, got %s (%t)", ttl, ok)
+	}
+
+	// A CNAME of TTL 30 in front of the A record expires the address sooner
+	alias := append([]byte{}, answer[:len(query)]...)
+	alias[7] = 2
+	alias = append(alias, 0xc0, 0x0c, 0, 5, 0, 1, 0, 0, 0, 30, 0, 2, 0xc0, 0x0c)
+	alias = append(alias, answer[len(query):]...)
+	if ttl, ok := answerTTL(alias); !ok || ttl != 30*time.Second {
+		t.Errorf("expected the shorter TTL of the alias, got %s (%t)", ttl, ok)
+	}
+
+	aaaa := append(append([]byte{}, query[:len(query)-4]...), 0, 28, 0, 1)
+	if _, ok := answerTTL(dnsAnswer(aaaa, nil)); ok {
+		t.Error("expected no TTL for an answer without records")
+	}
+	if _, ok := answerTTL(answer[:len(answer)-3]); ok {
+		t.Error("expected no TTL for a truncated answer")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	client := NewClient("corp", zaptest.NewLogger(t), WithResolver(&fakeResolver{}))
+	client.clock = fake
+
+	if !client.Expiry().IsZero() {
+		t.Error("expected no expiry before a resolution")
+	}
+
+	client.setResults([]DomainResult{
+		{Domain: "a.example.com", TTL: 5 * time.Minute},
+		{Domain: "b.example.com", TTL: time.Minute},
+		{Domain: "c.example.com"},
+	}, fake.Now())
+	if expected := fake.Now().Add(time.Minute); !client.Expiry().Equal(expected) {
+		t.Errorf("expected expiry %s, got %s", expected, client.Expiry())
+	}
+
+	// Resolutions without TTLs, e.g. through a custom Resolver, never expire
+	if _, err := client.ResolveDomains(context.Background(), []string{"a.example.com"}); err == nil {
+		t.Fatal("expected the empty resolver to fail")
+	}
+	if !client.Expiry().IsZero() {
+		t.Errorf("expected no expiry without TTLs, got %s", client.Expiry())
+	}
+}
@@ -0,0 +1,31 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestNotFound(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nxdomain", err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, expected: true},
+		{name: "wrapped nxdomain", err: fmt.Errorf("failed to resolve: %w", &net.DNSError{Err: "no such host", IsNotFound: true}), expected: true},
+		{name: "timeout", err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}},
+		{name: "servfail", err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}},
+		{name: "other error", err: errors.New("no such host")},
+		{name: "no error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NotFound(tt.err); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package dyndns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+	"go.uber.org/zap"
+)
+
+// Resolver looks up the addresses of a hostname
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Client resolves dynamic-DNS hostnames to the addresses currently registered for them
+type Client struct {
+	resolver Resolver
+	logger   *zap.Logger
+	// clock times the retry backoff and is faked in tests
+	clock clock.Clock
+}
+
+// NewClient creates a new dynamic DNS client
+func NewClient(logger *zap.Logger) *Client {
+	return NewClientWithResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{
+				Timeout: time.Second * 10,
+			}
+			return d.DialContext(ctx, network, address)
+		},
+	}, logger)
+}
+
+// NewClientWithResolver creates a new dynamic DNS client using the given resolver
+func NewClientWithResolver(resolver Resolver, logger *zap.Logger) *Client {
+	return &Client{
+		resolver: resolver,
+		logger:   logger.Named("dyndns"),
+		clock:    clock.Real,
+	}
+}
+
+// Resolve returns the sorted, de-duplicated IPv4 and IPv6 addresses of the hostname
+func (c *Client) Resolve(ctx context.Context, hostname string) ([]string, error) {
+	c.logger.Debug("Resolving dynamic DNS hostname", zap.String("hostname", hostname))
+
+	addrs, err := sources.LookupIPAddr(ctx, c.resolver, hostname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", hostname, err)
+	}
+
+	seen := make(map[string]bool, len(addrs))
+	var ips []string
+	for _, addr := range addrs {
+		ip := addr.IP.String()
+		if addr.IP == nil || seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		ips = append(ips, ip)
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP addresses found for hostname %s", hostname)
+	}
+	sort.Strings(ips)
+
+	c.logger.Debug("Successfully resolved dynamic DNS hostname",
+		zap.String("hostname", hostname),
+		zap.Strings("ips", ips))
+
+	return ips, nil
+}
+
+// ResolveWithRetry resolves the hostname with retry logic using exponential backoff with jitter
+func (c *Client) ResolveWithRetry(ctx context.Context, hostname string, maxRetries int) ([]string, error) {
+	var lastErr error
+
+	b := &backoff.Backoff{
+		Min:    100 * time.Millisecond,
+		Max:    10 * time.Second,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		ips, err := c.Resolve(ctx, hostname)
+		if err == nil {
+			return ips, nil
+		}
+		// A misspelled or deleted hostname fails the same way on every attempt
+		if sources.NotFound(err) {
+			c.logger.Error("Dynamic DNS hostname does not exist, not retrying",
+				zap.String("hostname", hostname),
+				zap.Error(err))
+			return nil, fmt.Errorf("%s does not exist, check the dynamic-dns hostname for misspellings: %w", hostname, err)
+		}
+
+		lastErr = err
+		c.logger.Warn("Failed to resolve dynamic DNS hostname, retrying",
+			zap.String("hostname", hostname),
+			zap.Int("attempt", attempt),
+			zap.Int("max_retries", maxRetries),
+			zap.Error(err))
+
+		if attempt < maxRetries {
+			backoffDuration := b.Duration()
+			// Every retry of the run shares its retry budget
+			if !retrybudget.Take(ctx, backoffDuration) {
+				return nil, fmt.Errorf("failed to resolve %s after %d attempts: %w: %w", hostname, attempt, retrybudget.ErrExhausted, lastErr)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-c.clock.After(backoffDuration):
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("failed to resolve %s after %d retries: %w", hostname, maxRetries, lastErr)
+}
@@ -0,0 +1,78 @@
+package dyndns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeResolver struct {
+	addrs []net.IPAddr
+	err   error
+	calls int
+}
+
+func (f *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	f.calls++
+	return f.addrs, f.err
+}
+
+func TestResolve(t *testing.T) {
+	resolver := &fakeResolver{addrs: []net.IPAddr{
+		{IP: net.ParseIP("203.0.113.5")},
+		{IP: net.ParseIP("2001:db8::1")},
+		{IP: net.ParseIP("198.51.100.7")},
+		{IP: net.ParseIP("203.0.113.5")},
+	}}
+	client := NewClientWithResolver(resolver, zaptest.NewLogger(t))
+
+	ips, err := client.Resolve(context.Background(), "home.example.dyndns.org")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"198.51.100.7", "2001:db8::1", "203.0.113.5"}
+	if len(ips) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, ips)
+	}
+	for i := range expected {
+		if ips[i] != expected[i] {
+			t.Errorf("expected IP %d to be %s, got %s", i, expected[i], ips[i])
+		}
+	}
+}
+
+func TestResolveNoAddresses(t *testing.T) {
+	client := NewClientWithResolver(&fakeResolver{}, zaptest.NewLogger(t))
+
+	if _, err := client.Resolve(context.Background(), "home.example.dyndns.org"); err == nil {
+		t.Error("expected an error when the hostname has no addresses")
+	}
+}
+
+func TestResolveWithRetry(t *testing.T) {
+	resolver := &fakeResolver{err: errors.New("no such host")}
+	client := NewClientWithResolver(resolver, zaptest.NewLogger(t))
+
+	if _, err := client.ResolveWithRetry(context.Background(), "home.example.dyndns.org", 2); err == nil {
+		t.Fatal("expected an error after all retries failed")
+	}
+	if resolver.calls != 2 {
+		t.Errorf("expected 2 resolution attempts, got %d", resolver.calls)
+	}
+}
+
+func TestResolveWithRetryNotFound(t *testing.T) {
+	resolver := &fakeResolver{err: &net.DNSError{Err: "no such host", Name: "home.example.dyndns.org", IsNotFound: true}}
+	client := NewClientWithResolver(resolver, zaptest.NewLogger(t))
+
+	if _, err := client.ResolveWithRetry(context.Background(), "home.example.dyndns.org", 3); err == nil {
+		t.Fatal("expected an error for a hostname that does not exist")
+	}
+	if resolver.calls != 1 {
+		t.Errorf("expected a missing hostname not to be retried, got %d resolution attempts", resolver.calls)
+	}
+}
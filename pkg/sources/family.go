@@ -0,0 +1,39 @@
+package sources
+
+import "net/netip"
+
+// Address families a source can be limited to
+const (
+	// FamilyIPv4 keeps the IPv4 addresses and CIDR blocks of a source
+	FamilyIPv4 = "ipv4"
+	// FamilyIPv6 keeps the IPv6 addresses and CIDR blocks of a source
+	FamilyIPv6 = "ipv6"
+	// FamilyBoth keeps every address
+	FamilyBoth = "both"
+)
+
+// FilterFamily keeps the addresses and CIDR blocks of the family, returning them and how many
+// were dropped; IPv4-mapped IPv6 addresses count as IPv4 and unparsable entries are kept for the
+// firewall to reject
+func FilterFamily(family string, addresses []string) ([]string, int) {
+	if family == "" || family == FamilyBoth {
+		return addresses, 0
+	}
+
+	kept := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			addr, err := netip.ParseAddr(address)
+			if err != nil {
+				kept = append(kept, address)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if prefix.Addr().Unmap().Is4() == (family == FamilyIPv4) {
+			kept = append(kept, address)
+		}
+	}
+	return kept, len(addresses) - len(kept)
+}
@@ -0,0 +1,28 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterFamily(t *testing.T) {
+	addresses := []string{"173.245.48.0/20", "2400:cb00::/32", "198.51.100.7", "2001:db8::1", "::ffff:203.0.113.9"}
+
+	tests := []struct {
+		family  string
+		kept    string
+		dropped int
+	}{
+		{family: FamilyBoth, kept: strings.Join(addresses, ","), dropped: 0},
+		{family: "", kept: strings.Join(addresses, ","), dropped: 0},
+		{family: FamilyIPv4, kept: "173.245.48.0/20,198.51.100.7,::ffff:203.0.113.9", dropped: 2},
+		{family: FamilyIPv6, kept: "2400:cb00::/32,2001:db8::1", dropped: 3},
+	}
+
+	for _, tt := range tests {
+		kept, dropped := FilterFamily(tt.family, addresses)
+		if strings.Join(kept, ",") != tt.kept || dropped != tt.dropped {
+			t.Errorf("family %q: expected %s with %d dropped, got %v with %d dropped", tt.family, tt.kept, tt.dropped, kept, dropped)
+		}
+	}
+}
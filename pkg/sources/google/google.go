@@ -0,0 +1,180 @@
+package google
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"path"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+	"go.uber.org/zap"
+)
+
+// Published range lists: goog holds every Google address, cloud the Google Cloud customer ranges
+// by scope (region)
+const (
+	ListGoog  = "goog"
+	ListCloud = "cloud"
+)
+
+// URLs are where Google publishes each list
+var URLs = map[string]string{
+	ListGoog:  "https://www.gstatic.com/ipranges/goog.json",
+	ListCloud: "https://www.gstatic.com/ipranges/cloud.json",
+}
+
+// Client fetches a range list published by Google, keeping the prefixes of the configured scopes
+type Client struct {
+	httpClient *http.Client
+	logger     *zap.Logger
+	name       string
+	url        string
+	scopes     []string
+	// clock paces the retries of FetchIPsWithRetry
+	clock clock.Clock
+}
+
+// Response is a goog.json or cloud.json document
+type Response struct {
+	SyncToken    string   `json:"syncToken"`
+	CreationTime string   `json:"creationTime"`
+	Prefixes     []Prefix `json:"prefixes"`
+}
+
+// Prefix is a range of a list; only cloud.json sets the service and scope
+type Prefix struct {
+	IPv4Prefix string `json:"ipv4Prefix"`
+	IPv6Prefix string `json:"ipv6Prefix"`
+	Service    string `json:"service"`
+	Scope      string `json:"scope"`
+}
+
+// NewClient creates a client for the list of the named source; scopes are shell patterns such as
+// us-central1 or europe-*, and every prefix is kept when none is given
+func NewClient(name, url string, scopes []string, logger *zap.Logger) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		logger: logger.Named("google").With(zap.String("source", name)),
+		name:   name,
+		url:    url,
+		scopes: scopes,
+		clock:  clock.Real,
+	}
+}
+
+// Name returns the name of the source
+func (c *Client) Name() string {
+	return c.name
+}
+
+// FetchIPs fetches the list and returns the prefixes of its scopes, failing when none matches since
+// that more likely means a mistyped scope or a changed format than withdrawn ranges; sources
+// reading the same list in a run share one download
+func (c *Client) FetchIPs(ctx context.Context) ([]string, error) {
+	body, err := sources.Cached(ctx, "http "+c.url, func() ([]byte, error) {
+		return c.download(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response Response
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&response); err != nil {
+		c.logger.Error("Failed to parse JSON response", zap.Error(err))
+		return nil, fmt.Errorf("failed to parse %s ranges: %w", c.name, err)
+	}
+
+	var ipv4, ipv6 []string
+	for _, prefix := range response.Prefixes {
+		if !c.inScope(prefix.Scope) {
+			continue
+		}
+		if prefix.IPv4Prefix != "" {
+			ipv4 = append(ipv4, prefix.IPv4Prefix)
+		}
+		if prefix.IPv6Prefix != "" {
+			ipv6 = append(ipv6, prefix.IPv6Prefix)
+		}
+	}
+	addresses := append(ipv4, ipv6...)
+
+	for _, address := range addresses {
+		if _, err := netip.ParsePrefix(address); err != nil {
+			return nil, fmt.Errorf("%s ranges hold %q, which is not a CIDR block", c.name, address)
+		}
+	}
+	if len(addresses) == 0 && len(c.scopes) > 0 {
+		return nil, fmt.Errorf("%s ranges hold no prefixes of scopes %v", c.name, c.scopes)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s ranges hold no prefixes", c.name)
+	}
+
+	c.logger.Info("Successfully fetched Google IP ranges",
+		zap.String("sync_token", response.SyncToken),
+		zap.Int("ipv4_count", len(ipv4)),
+		zap.Int("ipv6_count", len(ipv6)),
+		zap.Int("total_count", len(addresses)))
+	return addresses, nil
+}
+
+// inScope reports whether a prefix of the scope is kept
+func (c *Client) inScope(scope string) bool {
+	if len(c.scopes) == 0 {
+		return true
+	}
+	for _, pattern := range c.scopes {
+		if matched, _ := path.Match(pattern, scope); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// download fetches the body of the list
+func (c *Client) download(ctx context.Context) ([]byte, error) {
+	c.logger.Debug("Fetching Google IP ranges", zap.String("url", c.url))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url, nil)
+	if err != nil {
+		c.logger.Error("Failed to create request", zap.Error(err))
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "do-firewall-allowlister/1.0")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Error("Failed to fetch Google IP ranges", zap.Error(err))
+		return nil, fmt.Errorf("failed to fetch %s ranges: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger.Error("Unexpected status code from Google IP ranges",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("status", resp.Status))
+		return nil, fmt.Errorf("unexpected status code: %d %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.logger.Error("Failed to read Google IP ranges", zap.Error(err))
+		return nil, fmt.Errorf("failed to read %s ranges: %w", c.name, err)
+	}
+	return body, nil
+}
+
+// FetchIPsWithRetry fetches the list, retrying failures with sources.Retry
+func (c *Client) FetchIPsWithRetry(ctx context.Context, maxRetries int) ([]string, error) {
+	return sources.Retry(ctx, c.clock, c.logger, c.name+" ranges", maxRetries, c.FetchIPs)
+}
@@ -0,0 +1,183 @@
+package google
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+	"go.uber.org/zap/zaptest"
+)
+
+const cloudJSON = `{
+  "syncToken": "1700000000000",
+  "creationTime": "2025-01-08T09:30:00.000000",
+  "prefixes": [
+    {"ipv4Prefix": "34.1.208.0/20", "service": "Google Cloud", "scope": "africa-south1"},
+    {"ipv4Prefix": "34.16.0.0/17", "service": "Google Cloud", "scope": "us-central1"},
+    {"ipv6Prefix": "2600:1900:4000::/44", "service": "Google Cloud", "scope": "us-central1"},
+    {"ipv4Prefix": "34.22.0.0/19", "service": "Google Cloud", "scope": "us-east4"},
+    {"ipv4Prefix": "34.32.0.0/17", "service": "Google Cloud", "scope": "europe-west4"}
+  ]
+}`
+
+func TestFetchIPs(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		scopes      []string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:       "every scope",
+			statusCode: http.StatusOK,
+			body:       cloudJSON,
+			expected:   []string{"34.1.208.0/20", "34.16.0.0/17", "34.22.0.0/19", "34.32.0.0/17", "2600:1900:4000::/44"},
+		},
+		{
+			name:       "exact scope",
+			statusCode: http.StatusOK,
+			body:       cloudJSON,
+			scopes:     []string{"us-central1"},
+			expected:   []string{"34.16.0.0/17", "2600:1900:4000::/44"},
+		},
+		{
+			name:       "scope patterns",
+			statusCode: http.StatusOK,
+			body:       cloudJSON,
+			scopes:     []string{"us-*", "europe-west4"},
+			expected:   []string{"34.16.0.0/17", "34.22.0.0/19", "34.32.0.0/17", "2600:1900:4000::/44"},
+		},
+		{
+			name:       "goog list without scopes",
+			statusCode: http.StatusOK,
+			body:       `{"syncToken":"1","prefixes":[{"ipv4Prefix":"8.8.4.0/24"},{"ipv6Prefix":"2001:4860::/32"}]}`,
+			expected:   []string{"8.8.4.0/24", "2001:4860::/32"},
+		},
+		{
+			name:        "no prefix in scope",
+			statusCode:  http.StatusOK,
+			body:        cloudJSON,
+			scopes:      []string{"asia-east1"},
+			expectError: true,
+		},
+		{
+			name:        "prefix that is not a CIDR block",
+			statusCode:  http.StatusOK,
+			body:        `{"prefixes":[{"ipv4Prefix":"34.16.0.0"}]}`,
+			expectError: true,
+		},
+		{
+			name:        "server error",
+			statusCode:  http.StatusInternalServerError,
+			body:        cloudJSON,
+			expectError: true,
+		},
+		{
+			name:        "invalid JSON",
+			statusCode:  http.StatusOK,
+			body:        "<html>",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient("gcp", server.URL, tt.scopes, zaptest.NewLogger(t))
+
+			ips, err := client.FetchIPs(context.Background())
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", ips)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ips, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, ips)
+			}
+		})
+	}
+}
+
+func TestFetchIPsWithRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(cloudJSON))
+	}))
+	defer server.Close()
+
+	client := NewClient("gcp-us", server.URL, []string{"us-central1"}, zaptest.NewLogger(t))
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	client.clock = fake
+
+	type result struct {
+		ips []string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ips, err := client.FetchIPsWithRetry(context.Background(), 3)
+		done <- result{ips, err}
+	}()
+
+	// The retry waits out its backoff on the fake clock, which the test moves past it
+	fake.BlockUntil(1)
+	fake.Advance(10 * time.Second)
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+	if len(res.ips) != 2 || requests != 2 {
+		t.Errorf("expected the ranges on the second request, got %v after %d requests", res.ips, requests)
+	}
+}
+
+func TestFetchIPsSharesDownloadWithinRun(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(cloudJSON))
+	}))
+	defer server.Close()
+
+	us := NewClient("gcp-us", server.URL, []string{"us-*"}, zaptest.NewLogger(t))
+	europe := NewClient("gcp-europe", server.URL, []string{"europe-*"}, zaptest.NewLogger(t))
+
+	ctx := sources.WithRunCache(context.Background())
+	usIPs, err := us.FetchIPs(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	europeIPs, err := europe.FetchIPs(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(usIPs) != 3 || !reflect.DeepEqual(europeIPs, []string{"34.32.0.0/17"}) {
+		t.Errorf("expected each source to keep its own scopes, got %v and %v", usIPs, europeIPs)
+	}
+	if requests != 1 {
+		t.Errorf("expected one download in the run, got %d", requests)
+	}
+}
@@ -0,0 +1,124 @@
+package httplist
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+	"go.uber.org/zap"
+)
+
+// Client fetches an IP list published at a URL, such as the Fastly, GitHub meta or AWS
+// ip-ranges lists
+type Client struct {
+	httpClient *http.Client
+	logger     *zap.Logger
+	name       string
+	url        string
+	parser     Parser
+	// clock times the retry backoff and is faked in tests
+	clock clock.Clock
+}
+
+// NewClient creates a client for the list of the named source
+func NewClient(name, url string, parser Parser, logger *zap.Logger) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		logger: logger.Named("httplist").With(zap.String("source", name)),
+		name:   name,
+		url:    url,
+		parser: parser,
+		clock:  clock.Real,
+	}
+}
+
+// Name returns the name of the source
+func (c *Client) Name() string {
+	return c.name
+}
+
+// FetchIPs fetches and parses the list, failing on entries that are not an address or CIDR block
+// and on empty lists, which more likely mean the publisher changed the format than that it
+// withdrew every range; sources reading the same URL in a run share one download
+func (c *Client) FetchIPs(ctx context.Context) ([]string, error) {
+	body, err := sources.Cached(ctx, "http "+c.url, func() ([]byte, error) {
+		return c.download(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := c.parser.Parse(bytes.NewReader(body))
+	if err != nil {
+		c.logger.Error("Failed to parse IP list", zap.Error(err))
+		return nil, fmt.Errorf("failed to parse %s IP list: %w", c.name, err)
+	}
+
+	for _, address := range addresses {
+		if !validAddress(address) {
+			return nil, fmt.Errorf("%s IP list holds %q, which is not an IP address or CIDR block", c.name, address)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s IP list holds no addresses", c.name)
+	}
+
+	c.logger.Info("Successfully fetched IP list", zap.Int("total_count", len(addresses)))
+	return addresses, nil
+}
+
+// download fetches the body of the list
+func (c *Client) download(ctx context.Context) ([]byte, error) {
+	c.logger.Debug("Fetching IP list", zap.String("url", c.url))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url, nil)
+	if err != nil {
+		c.logger.Error("Failed to create request", zap.Error(err))
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "do-firewall-allowlister/1.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Error("Failed to fetch IP list", zap.Error(err))
+		return nil, fmt.Errorf("failed to fetch %s IP list: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger.Error("Unexpected status code from IP list",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("status", resp.Status))
+		return nil, fmt.Errorf("unexpected status code: %d %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.logger.Error("Failed to read IP list", zap.Error(err))
+		return nil, fmt.Errorf("failed to read %s IP list: %w", c.name, err)
+	}
+	return body, nil
+}
+
+// validAddress reports whether value is an IP address or CIDR block
+func validAddress(value string) bool {
+	if _, err := netip.ParsePrefix(value); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(value)
+	return err == nil
+}
+
+// FetchIPsWithRetry fetches the list, retrying failures with sources.Retry
+func (c *Client) FetchIPsWithRetry(ctx context.Context, maxRetries int) ([]string, error) {
+	return sources.Retry(ctx, c.clock, c.logger, c.name+" IP list", maxRetries, c.FetchIPs)
+}
@@ -0,0 +1,194 @@
+package httplist
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFetchIPs(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:       "successful response",
+			statusCode: http.StatusOK,
+			body:       "198.51.100.0/24\n2001:db8::1\n",
+			expected:   []string{"198.51.100.0/24", "2001:db8::1"},
+		},
+		{
+			name:        "server error",
+			statusCode:  http.StatusInternalServerError,
+			body:        "198.51.100.0/24\n",
+			expectError: true,
+		},
+		{
+			name:        "entry that is not an address",
+			statusCode:  http.StatusOK,
+			body:        "198.51.100.0/24\n<html>\n",
+			expectError: true,
+		},
+		{
+			name:        "empty list",
+			statusCode:  http.StatusOK,
+			body:        "# no ranges\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			parser, err := NewParser(FormatLines, nil, 0, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			client := NewClient("partner", server.URL, parser, zaptest.NewLogger(t))
+
+			ips, err := client.FetchIPs(context.Background())
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", ips)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ips, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, ips)
+			}
+		})
+	}
+}
+
+func TestFetchIPsWithRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"addresses":["23.235.32.0/20"]}`))
+	}))
+	defer server.Close()
+
+	parser, err := NewParser(FormatJSON, []string{"addresses"}, 0, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := NewClient("fastly", server.URL, parser, zaptest.NewLogger(t))
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	client.clock = fake
+
+	type result struct {
+		ips []string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ips, err := client.FetchIPsWithRetry(context.Background(), 3)
+		done <- result{ips, err}
+	}()
+
+	// The retry waits out its backoff on the fake clock, which the test moves past it
+	fake.BlockUntil(1)
+	fake.Advance(10 * time.Second)
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+	if len(res.ips) != 1 || requests != 2 {
+		t.Errorf("expected the list on the second request, got %v after %d requests", res.ips, requests)
+	}
+}
+
+func TestFetchIPsWithRetryStopsAtRetryBudget(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	parser, err := NewParser(FormatJSON, []string{"addresses"}, 0, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := NewClient("fastly", server.URL, parser, zaptest.NewLogger(t))
+	client.clock = clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+
+	// The first backoff of at least 100ms does not fit, so nothing waits on the fake clock
+	ctx := retrybudget.WithBudget(context.Background(), 50*time.Millisecond)
+	_, err = client.FetchIPsWithRetry(ctx, 3)
+	if !errors.Is(err, retrybudget.ErrExhausted) {
+		t.Fatalf("expected the retry budget to be exhausted, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+}
+
+func TestFetchIPsSharesDownloadWithinRun(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"prefixes":[{"ip_prefix":"198.51.100.0/24","service":"EC2"},{"ip_prefix":"203.0.113.0/24","service":"CLOUDFRONT"}]}`))
+	}))
+	defer server.Close()
+
+	newClient := func(name, service string) *Client {
+		parser, err := NewParser(FormatJSON, []string{"prefixes[service=" + service + "].ip_prefix"}, 0, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return NewClient(name, server.URL, parser, zaptest.NewLogger(t))
+	}
+	ec2 := newClient("aws-ec2", "EC2")
+	cloudfront := newClient("aws-cloudfront", "CLOUDFRONT")
+
+	ctx := sources.WithRunCache(context.Background())
+	ec2IPs, err := ec2.FetchIPs(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cloudfrontIPs, err := cloudfront.FetchIPs(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(ec2IPs, []string{"198.51.100.0/24"}) || !reflect.DeepEqual(cloudfrontIPs, []string{"203.0.113.0/24"}) {
+		t.Errorf("expected each source to parse its own ranges, got %v and %v", ec2IPs, cloudfrontIPs)
+	}
+	if requests != 1 {
+		t.Errorf("expected one download in the run, got %d", requests)
+	}
+
+	// A new run downloads the list again
+	if _, err := ec2.FetchIPs(sources.WithRunCache(context.Background())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected a download per run, got %d", requests)
+	}
+}
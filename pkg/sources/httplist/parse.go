@@ -0,0 +1,229 @@
+package httplist
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Formats of the IP lists an HTTP source publishes
+const (
+	// FormatJSON selects addresses from a JSON document with paths such as prefixes[*].ip_prefix
+	FormatJSON = "json"
+	// FormatLines reads one address per line, ignoring blank lines and # comments
+	FormatLines = "lines"
+	// FormatCSV reads the addresses from one column of a CSV document
+	FormatCSV = "csv"
+)
+
+// Parser extracts the addresses from an IP list response
+type Parser interface {
+	Parse(r io.Reader) ([]string, error)
+}
+
+// NewParser creates the parser of a format; paths apply to json, column and skipHeader to csv
+func NewParser(format string, paths []string, column int, skipHeader bool) (Parser, error) {
+	switch format {
+	case FormatJSON:
+		if len(paths) == 0 {
+			return nil, errors.New("json lists need at least one path")
+		}
+		parser := &jsonParser{}
+		for _, path := range paths {
+			parsed, err := parsePath(path)
+			if err != nil {
+				return nil, err
+			}
+			parser.paths = append(parser.paths, parsed)
+		}
+		return parser, nil
+	case FormatLines:
+		return linesParser{}, nil
+	case FormatCSV:
+		if column < 0 {
+			return nil, fmt.Errorf("invalid csv column %d", column)
+		}
+		return csvParser{column: column, skipHeader: skipHeader}, nil
+	default:
+		return nil, fmt.Errorf("unknown list format %s", format)
+	}
+}
+
+// segmentPattern matches one dotted path segment: a field, optionally followed by [*] selecting
+// every array element or [key=value] selecting the elements whose key equals value
+var segmentPattern = regexp.MustCompile(`^([A-Za-z0-9_-]+)(?:\[(\*|[A-Za-z0-9_-]+=[^\]]*)\])?$`)
+
+// pathSegment is one step of a JSON path
+type pathSegment struct {
+	field string
+	// each is set for [*] and [key=value] segments, which step into the array elements
+	each       bool
+	key, value string
+}
+
+// jsonPath is a parsed path, kept with its source text for error messages
+type jsonPath struct {
+	text     string
+	segments []pathSegment
+}
+
+// parsePath parses a path such as addresses or prefixes[service=CLOUDFRONT].ip_prefix
+func parsePath(path string) (jsonPath, error) {
+	parsed := jsonPath{text: path}
+	for _, part := range strings.Split(path, ".") {
+		match := segmentPattern.FindStringSubmatch(part)
+		if match == nil {
+			return jsonPath{}, fmt.Errorf("invalid json path %s", path)
+		}
+
+		segment := pathSegment{field: match[1]}
+		if match[2] != "" {
+			segment.each = true
+			if match[2] != "*" {
+				segment.key, segment.value, _ = strings.Cut(match[2], "=")
+			}
+		}
+		parsed.segments = append(parsed.segments, segment)
+	}
+	return parsed, nil
+}
+
+// jsonParser collects the strings every path selects; a path ending in a list of strings takes
+// every entry
+type jsonParser struct {
+	paths []jsonPath
+}
+
+func (p *jsonParser) Parse(r io.Reader) ([]string, error) {
+	var document interface{}
+	if err := json.NewDecoder(r).Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	var addresses []string
+	for _, path := range p.paths {
+		values, err := path.eval(document)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			switch value := value.(type) {
+			case string:
+				addresses = append(addresses, value)
+			case []interface{}:
+				for _, item := range value {
+					address, ok := item.(string)
+					if !ok {
+						return nil, fmt.Errorf("json path %s selects a list holding %T, expected strings", path.text, item)
+					}
+					addresses = append(addresses, address)
+				}
+			default:
+				return nil, fmt.Errorf("json path %s selects %T, expected a string or a list of strings", path.text, value)
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// eval returns the values the path selects in document
+func (p jsonPath) eval(document interface{}) ([]interface{}, error) {
+	values := []interface{}{document}
+	for _, segment := range p.segments {
+		var next []interface{}
+		for _, value := range values {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("json path %s: expected an object holding %s", p.text, segment.field)
+			}
+			field, ok := object[segment.field]
+			if !ok {
+				return nil, fmt.Errorf("json path %s: field %s not found", p.text, segment.field)
+			}
+			if !segment.each {
+				next = append(next, field)
+				continue
+			}
+
+			items, ok := field.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("json path %s: expected %s to be a list", p.text, segment.field)
+			}
+			for _, item := range items {
+				if segment.key != "" && !matches(item, segment.key, segment.value) {
+					continue
+				}
+				next = append(next, item)
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// matches reports whether item is an object whose key holds value
+func matches(item interface{}, key, value string) bool {
+	object, ok := item.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	field, ok := object[key]
+	return ok && fmt.Sprint(field) == value
+}
+
+// linesParser reads newline-delimited lists
+type linesParser struct{}
+
+func (linesParser) Parse(r io.Reader) ([]string, error) {
+	var addresses []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			addresses = append(addresses, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return addresses, nil
+}
+
+// csvParser reads one column of CSV lists
+type csvParser struct {
+	column     int
+	skipHeader bool
+}
+
+func (p csvParser) Parse(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var addresses []string
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV response: %w", err)
+		}
+		if row == 0 && p.skipHeader {
+			continue
+		}
+		if p.column >= len(record) {
+			return nil, fmt.Errorf("CSV row %d has no column %d", row+1, p.column)
+		}
+		if address := strings.TrimSpace(record[p.column]); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, nil
+}
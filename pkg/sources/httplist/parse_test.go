@@ -0,0 +1,142 @@
+package httplist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		paths       []string
+		column      int
+		skipHeader  bool
+		body        string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:     "fastly public IP list",
+			format:   FormatJSON,
+			paths:    []string{"addresses", "ipv6_addresses"},
+			body:     `{"addresses":["23.235.32.0/20","43.249.72.0/22"],"ipv6_addresses":["2a04:4e40::/32"]}`,
+			expected: []string{"23.235.32.0/20", "43.249.72.0/22", "2a04:4e40::/32"},
+		},
+		{
+			name:     "github meta hooks",
+			format:   FormatJSON,
+			paths:    []string{"hooks"},
+			body:     `{"verifiable_password_authentication":false,"hooks":["192.30.252.0/22","2a0a:a440::/29"],"web":["140.82.112.0/20"]}`,
+			expected: []string{"192.30.252.0/22", "2a0a:a440::/29"},
+		},
+		{
+			name:   "aws ip-ranges filtered by service",
+			format: FormatJSON,
+			paths:  []string{"prefixes[service=CLOUDFRONT].ip_prefix", "ipv6_prefixes[service=CLOUDFRONT].ipv6_prefix"},
+			body: `{"syncToken":"1","prefixes":[
+				{"ip_prefix":"3.2.34.0/26","region":"af-south-1","service":"AMAZON"},
+				{"ip_prefix":"13.32.0.0/15","region":"GLOBAL","service":"CLOUDFRONT"}
+			],"ipv6_prefixes":[
+				{"ipv6_prefix":"2600:9000::/28","region":"GLOBAL","service":"CLOUDFRONT"}
+			]}`,
+			expected: []string{"13.32.0.0/15", "2600:9000::/28"},
+		},
+		{
+			name:     "every element",
+			format:   FormatJSON,
+			paths:    []string{"result.ranges[*].cidr"},
+			body:     `{"result":{"ranges":[{"cidr":"198.51.100.0/24"},{"cidr":"203.0.113.0/24"}]}}`,
+			expected: []string{"198.51.100.0/24", "203.0.113.0/24"},
+		},
+		{
+			name:        "missing field",
+			format:      FormatJSON,
+			paths:       []string{"addresses"},
+			body:        `{"ips":["198.51.100.0/24"]}`,
+			expectError: true,
+		},
+		{
+			name:        "path selecting an object",
+			format:      FormatJSON,
+			paths:       []string{"prefixes[*]"},
+			body:        `{"prefixes":[{"ip_prefix":"13.32.0.0/15"}]}`,
+			expectError: true,
+		},
+		{
+			name:        "invalid JSON",
+			format:      FormatJSON,
+			paths:       []string{"addresses"},
+			body:        `{"addresses":`,
+			expectError: true,
+		},
+		{
+			name:     "newline-delimited",
+			format:   FormatLines,
+			body:     "# published ranges\n198.51.100.0/24\n\n  203.0.113.5  # office\r\n2001:db8::/32\n",
+			expected: []string{"198.51.100.0/24", "203.0.113.5", "2001:db8::/32"},
+		},
+		{
+			name:       "csv column with header",
+			format:     FormatCSV,
+			column:     1,
+			skipHeader: true,
+			body:       "region,prefix,service\nus-east,198.51.100.0/24,api\n# retired\neu-west, 203.0.113.0/24,api\n",
+			expected:   []string{"198.51.100.0/24", "203.0.113.0/24"},
+		},
+		{
+			name:        "csv row without the column",
+			format:      FormatCSV,
+			column:      2,
+			body:        "us-east,198.51.100.0/24,api\neu-west,203.0.113.0/24\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewParser(tt.format, tt.paths, tt.column, tt.skipHeader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			addresses, err := parser.Parse(strings.NewReader(tt.body))
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", addresses)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(addresses, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, addresses)
+			}
+		})
+	}
+}
+
+func TestNewParserErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		paths  []string
+		column int
+	}{
+		{name: "json without paths", format: FormatJSON},
+		{name: "empty path segment", format: FormatJSON, paths: []string{"prefixes..ip_prefix"}},
+		{name: "unterminated selector", format: FormatJSON, paths: []string{"prefixes[service=EC2"}},
+		{name: "negative csv column", format: FormatCSV, column: -1},
+		{name: "unknown format", format: "xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewParser(tt.format, tt.paths, tt.column, false); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package probes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/sources"
+	"go.uber.org/zap"
+)
+
+// Uptime monitoring providers publishing the addresses of their probes
+const (
+	// ProviderUptimeRobot publishes a plain text list of IPv4 and IPv6 addresses
+	ProviderUptimeRobot = "uptimerobot"
+	// ProviderPingdom lists its probes through the probes endpoint of its API, which needs a token
+	ProviderPingdom = "pingdom"
+)
+
+// URLs are where each provider publishes its probe addresses
+var URLs = map[string]string{
+	ProviderUptimeRobot: "https://uptimerobot.com/inc/files/ips/IPv4andIPv6.txt",
+	ProviderPingdom:     "https://api.pingdom.com/api/3.1/probes",
+}
+
+// Client fetches the probe addresses of an uptime monitoring provider
+type Client struct {
+	httpClient *http.Client
+	logger     *zap.Logger
+	name       string
+	provider   string
+	url        string
+	token      string
+	// clock waits out the backoff between retries
+	clock clock.Clock
+}
+
+// PingdomResponse is the response of the Pingdom probes endpoint
+type PingdomResponse struct {
+	Probes []PingdomProbe `json:"probes"`
+}
+
+// PingdomProbe is a Pingdom probe server; inactive probes run no checks
+type PingdomProbe struct {
+	Name   string `json:"name"`
+	IP     string `json:"ip"`
+	IPv6   string `json:"ipv6"`
+	Active bool   `json:"active"`
+}
+
+// NewClient creates a client for the probe list of the named source; token authenticates the
+// Pingdom API and is not sent to other providers
+func NewClient(name, provider, url, token string, logger *zap.Logger) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		logger:   logger.Named("probes").With(zap.String("source", name), zap.String("provider", provider)),
+		name:     name,
+		provider: provider,
+		url:      url,
+		token:    token,
+		clock:    clock.Real,
+	}
+}
+
+// Name returns the name of the source
+func (c *Client) Name() string {
+	return c.name
+}
+
+// FetchIPs fetches the probe addresses, failing on entries that are not an address and on empty
+// lists, which would take every monitor off the health-check ports
+func (c *Client) FetchIPs(ctx context.Context) ([]string, error) {
+	body, err := sources.Cached(ctx, "probes "+c.url, func() ([]byte, error) {
+		return c.download(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	switch c.provider {
+	case ProviderPingdom:
+		addresses, err = parsePingdom(body)
+	default:
+		addresses, err = parseLines(body)
+	}
+	if err != nil {
+		c.logger.Error("Failed to parse probe list", zap.Error(err))
+		return nil, fmt.Errorf("failed to parse %s probe list: %w", c.name, err)
+	}
+
+	for _, address := range addresses {
+		if _, err := netip.ParseAddr(address); err != nil {
+			if _, err := netip.ParsePrefix(address); err != nil {
+				return nil, fmt.Errorf("%s probe list holds %q, which is not an IP address", c.name, address)
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s probe list holds no addresses", c.name)
+	}
+
+	c.logger.Info("Successfully fetched probe addresses", zap.Int("total_count", len(addresses)))
+	return addresses, nil
+}
+
+// parseLines reads one address per line, ignoring blank lines and # comments
+func parseLines(body []byte) ([]string, error) {
+	var addresses []string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			addresses = append(addresses, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return addresses, nil
+}
+
+// parsePingdom returns the IPv4 then the IPv6 addresses of the active probes
+func parsePingdom(body []byte) ([]string, error) {
+	var response PingdomResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	var ipv4, ipv6 []string
+	for _, probe := range response.Probes {
+		if !probe.Active {
+			continue
+		}
+		if probe.IP != "" {
+			ipv4 = append(ipv4, probe.IP)
+		}
+		if probe.IPv6 != "" {
+			ipv6 = append(ipv6, probe.IPv6)
+		}
+	}
+	return append(ipv4, ipv6...), nil
+}
+
+// download fetches the body of the probe list
+func (c *Client) download(ctx context.Context) ([]byte, error) {
+	c.logger.Debug("Fetching probe list", zap.String("url", c.url))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url, nil)
+	if err != nil {
+		c.logger.Error("Failed to create request", zap.Error(err))
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "do-firewall-allowlister/1.0")
+	if c.provider == ProviderPingdom {
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Error("Failed to fetch probe list", zap.Error(err))
+		return nil, fmt.Errorf("failed to fetch %s probe list: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger.Error("Unexpected status code from probe list",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("status", resp.Status))
+		return nil, fmt.Errorf("unexpected status code: %d %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.logger.Error("Failed to read probe list", zap.Error(err))
+		return nil, fmt.Errorf("failed to read %s probe list: %w", c.name, err)
+	}
+	return body, nil
+}
+
+// FetchIPsWithRetry fetches the probe list, retrying failures with sources.Retry
+func (c *Client) FetchIPsWithRetry(ctx context.Context, maxRetries int) ([]string, error) {
+	return sources.Retry(ctx, c.clock, c.logger, c.name+" probe list", maxRetries, c.FetchIPs)
+}
@@ -0,0 +1,153 @@
+package probes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFetchIPs(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    string
+		statusCode  int
+		body        string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:       "uptimerobot list",
+			provider:   ProviderUptimeRobot,
+			statusCode: http.StatusOK,
+			body:       "69.162.124.226\r\n216.144.250.150\r\n\r\n2607:ff68:107::3\r\n",
+			expected:   []string{"69.162.124.226", "216.144.250.150", "2607:ff68:107::3"},
+		},
+		{
+			name:       "pingdom active probes",
+			provider:   ProviderPingdom,
+			statusCode: http.StatusOK,
+			body: `{"probes":[
+				{"id":1,"name":"Amsterdam","ip":"5.172.196.188","ipv6":"2a02:6ea0:c020::4","active":true},
+				{"id":2,"name":"Chicago","ip":"184.75.210.186","ipv6":"","active":true},
+				{"id":3,"name":"Retired","ip":"178.255.152.2","ipv6":"","active":false}
+			]}`,
+			expected: []string{"5.172.196.188", "184.75.210.186", "2a02:6ea0:c020::4"},
+		},
+		{
+			name:        "entry that is not an address",
+			provider:    ProviderUptimeRobot,
+			statusCode:  http.StatusOK,
+			body:        "69.162.124.226\n<html>\n",
+			expectError: true,
+		},
+		{
+			name:        "no active probe",
+			provider:    ProviderPingdom,
+			statusCode:  http.StatusOK,
+			body:        `{"probes":[{"ip":"178.255.152.2","active":false}]}`,
+			expectError: true,
+		},
+		{
+			name:        "unauthorized",
+			provider:    ProviderPingdom,
+			statusCode:  http.StatusUnauthorized,
+			body:        `{"error":{"statuscode":401}}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient("monitors", tt.provider, server.URL, "token", zaptest.NewLogger(t))
+
+			ips, err := client.FetchIPs(context.Background())
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", ips)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ips, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, ips)
+			}
+		})
+	}
+}
+
+func TestFetchIPsAuthorization(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"probes":[{"ip":"5.172.196.188","active":true}]}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewClient("pingdom", ProviderPingdom, server.URL, "secret", zaptest.NewLogger(t)).FetchIPs(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if authorization != "Bearer secret" {
+		t.Errorf("expected the token to authenticate Pingdom, got %q", authorization)
+	}
+
+	// UptimeRobot publishes its list openly, the token is never sent there
+	if _, err := NewClient("uptimerobot", ProviderUptimeRobot, server.URL, "secret", zaptest.NewLogger(t)).FetchIPs(context.Background()); err == nil {
+		t.Fatal("expected the JSON document to fail the text list")
+	}
+	if authorization != "" {
+		t.Errorf("expected no token sent to UptimeRobot, got %q", authorization)
+	}
+}
+
+func TestFetchIPsWithRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("69.162.124.226\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient("uptimerobot", ProviderUptimeRobot, server.URL, "", zaptest.NewLogger(t))
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	client.clock = fake
+
+	type result struct {
+		ips []string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ips, err := client.FetchIPsWithRetry(context.Background(), 3)
+		done <- result{ips, err}
+	}()
+
+	// The retry waits out its backoff on the fake clock, which the test moves past it
+	fake.BlockUntil(1)
+	fake.Advance(10 * time.Second)
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+	if len(res.ips) != 1 || requests != 2 {
+		t.Errorf("expected the list on the second request, got %v after %d requests", res.ips, requests)
+	}
+}
@@ -0,0 +1,124 @@
+package publicip
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultRetryAfter is used when a rate-limited response carries no usable Retry-After header
+const defaultRetryAfter = time.Minute
+
+// serviceEntry tracks the last detected IP and request times for one service
+type serviceEntry struct {
+	IP            string    `json:"ip,omitempty"`
+	DetectedAt    time.Time `json:"detected_at,omitempty"`
+	LastRequestAt time.Time `json:"last_request_at,omitempty"`
+	NotBefore     time.Time `json:"not_before,omitempty"`
+}
+
+// nextRequestAt returns the earliest time the service may be contacted again
+func (e *serviceEntry) nextRequestAt(minInterval time.Duration) time.Time {
+	next := e.LastRequestAt.Add(minInterval)
+	if e.NotBefore.After(next) {
+		return e.NotBefore
+	}
+	return next
+}
+
+// cacheFile is the on-disk representation of the public IP cache
+type cacheFile struct {
+	Services map[string]*serviceEntry `json:"services"`
+}
+
+// rateLimitedError is returned when the service answers 429 Too Many Requests
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("public IP service is rate limiting requests, retry after %s", e.retryAfter)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return defaultRetryAfter
+}
+
+// loadCache replaces the in-memory service entries with the cache file contents
+func (c *Client) loadCache() {
+	if c.cachePath == "" {
+		return
+	}
+
+	data, err := os.ReadFile(c.cachePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.logger.Debug("Failed to read public IP cache", zap.String("path", c.cachePath), zap.Error(err))
+		}
+		return
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		c.logger.Debug("Ignoring invalid public IP cache", zap.String("path", c.cachePath), zap.Error(err))
+		return
+	}
+	for url, entry := range file.Services {
+		if entry != nil {
+			c.services[url] = entry
+		}
+	}
+}
+
+// saveCache writes the service entries to the cache file; failures only disable caching
+func (c *Client) saveCache() {
+	if c.cachePath == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(cacheFile{Services: c.services}, "", "  ")
+	if err != nil {
+		c.logger.Debug("Failed to encode public IP cache", zap.Error(err))
+		return
+	}
+
+	dir := filepath.Dir(c.cachePath)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		c.logger.Debug("Failed to create public IP cache directory", zap.String("path", dir), zap.Error(err))
+		return
+	}
+
+	tmp, err := os.CreateTemp(dir, ".public-ip-*.json")
+	if err != nil {
+		c.logger.Debug("Failed to write public IP cache", zap.String("path", c.cachePath), zap.Error(err))
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.cachePath); err != nil {
+		c.logger.Debug("Failed to write public IP cache", zap.String("path", c.cachePath), zap.Error(err))
+	}
+}
@@ -0,0 +1,130 @@
+package publicip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"go.uber.org/zap/zaptest"
+)
+
+func newIPServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestGetPublicIPCache(t *testing.T) {
+	server, requests := newIPServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5\n"))
+	})
+	path := filepath.Join(t.TempDir(), "cache", "public-ip.json")
+	ctx := context.Background()
+
+	client := NewClientWithURL(server.URL, zaptest.NewLogger(t), WithCache(path, time.Minute))
+	if ip, err := client.GetPublicIP(ctx); err != nil || ip != "203.0.113.5" {
+		t.Fatalf("expected 203.0.113.5, got %q (err: %v)", ip, err)
+	}
+
+	// A new client, as in a second CLI invocation, reads the IP from the cache file
+	client = NewClientWithURL(server.URL, zaptest.NewLogger(t), WithCache(path, time.Minute))
+	if ip, err := client.GetPublicIP(ctx); err != nil || ip != "203.0.113.5" {
+		t.Fatalf("expected cached 203.0.113.5, got %q (err: %v)", ip, err)
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("expected 1 request to the service, got %d", got)
+	}
+}
+
+func TestGetPublicIPCacheExpiry(t *testing.T) {
+	server, requests := newIPServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5"))
+	})
+	path := filepath.Join(t.TempDir(), "public-ip.json")
+	fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+	client := NewClientWithURL(server.URL, zaptest.NewLogger(t), WithCache(path, time.Minute), WithClock(fake))
+	ctx := context.Background()
+
+	for _, advance := range []time.Duration{0, 59 * time.Second, time.Second} {
+		fake.Advance(advance)
+		if _, err := client.GetPublicIP(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// The IP is served from the cache until its TTL runs out a minute after detection
+	if got := requests.Load(); got != 2 {
+		t.Errorf("expected 2 requests to the service, got %d", got)
+	}
+}
+
+func TestGetPublicIPMinInterval(t *testing.T) {
+	server, requests := newIPServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5"))
+	})
+	interval := 200 * time.Millisecond
+	client := NewClientWithURL(server.URL, zaptest.NewLogger(t), WithMinInterval(interval))
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetPublicIP(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < interval {
+		t.Errorf("expected requests to be spaced by at least %s, took %s", interval, elapsed)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("expected 2 requests without a cache, got %d", got)
+	}
+}
+
+func TestGetPublicIPRateLimited(t *testing.T) {
+	server, requests := newIPServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	client := NewClientWithURL(server.URL, zaptest.NewLogger(t))
+
+	if _, err := client.GetPublicIP(context.Background()); err == nil {
+		t.Fatal("expected error for rate-limited response")
+	}
+
+	// The next attempt must wait for Retry-After instead of hitting the service again
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetPublicIP(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline while waiting for Retry-After, got %v", err)
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("expected 1 request to the service, got %d", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("120"); got != 2*time.Minute {
+		t.Errorf("expected 2m, got %s", got)
+	}
+	if got := parseRetryAfter(""); got != defaultRetryAfter {
+		t.Errorf("expected default %s, got %s", defaultRetryAfter, got)
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("expected about 1h, got %s", got)
+	}
+}
@@ -2,13 +2,16 @@ package publicip
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
 	"go.uber.org/zap"
 )
 
@@ -17,32 +20,114 @@ type Client struct {
 	httpClient *http.Client
 	logger     *zap.Logger
 	serviceURL string
+
+	cachePath   string
+	cacheTTL    time.Duration
+	minInterval time.Duration
+	clock       clock.Clock
+
+	mu       sync.Mutex
+	services map[string]*serviceEntry
 }
 
-// NewClient creates a new public IP detection client
-func NewClient(logger *zap.Logger) *Client {
-	return &Client{
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		logger:     logger.Named("publicip"),
-		serviceURL: "https://icanhazip.com/",
+// Option configures optional Client behavior
+type Option func(*Client)
+
+// WithCache persists detected IPs and request times to path, serving an IP detected
+// less than ttl ago without contacting the service (a zero ttl always refreshes)
+func WithCache(path string, ttl time.Duration) Option {
+	return func(c *Client) {
+		c.cachePath = path
+		c.cacheTTL = ttl
 	}
 }
 
+// WithMinInterval enforces a minimum delay between requests to the same service
+func WithMinInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.minInterval = interval
+	}
+}
+
+// WithClock replaces the wall clock deciding cache expiry and the waits between requests
+func WithClock(c clock.Clock) Option {
+	return func(client *Client) {
+		client.clock = c
+	}
+}
+
+// NewClient creates a new public IP detection client
+func NewClient(logger *zap.Logger, opts ...Option) *Client {
+	return NewClientWithURL("https://icanhazip.com/", logger, opts...)
+}
+
 // NewClientWithURL creates a new public IP detection client with custom service URL
-func NewClientWithURL(serviceURL string, logger *zap.Logger) *Client {
-	return &Client{
+func NewClientWithURL(serviceURL string, logger *zap.Logger, opts ...Option) *Client {
+	c := &Client{
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 		logger:     logger.Named("publicip"),
 		serviceURL: serviceURL,
+		clock:      clock.Real,
+		services:   make(map[string]*serviceEntry),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// GetPublicIP detects the current public IP address
+// GetPublicIP detects the current public IP address, serving it from the cache when
+// fresh and waiting out the service's minimum interval otherwise
 func (c *Client) GetPublicIP(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loadCache()
+	entry := c.services[c.serviceURL]
+	if entry == nil {
+		entry = &serviceEntry{}
+		c.services[c.serviceURL] = entry
+	}
+
+	now := c.clock.Now()
+	if entry.IP != "" && c.cacheTTL > 0 && now.Sub(entry.DetectedAt) < c.cacheTTL {
+		c.logger.Debug("Using cached public IP",
+			zap.String("ip", entry.IP),
+			zap.Time("detected_at", entry.DetectedAt))
+		return entry.IP, nil
+	}
+
+	if wait := entry.nextRequestAt(c.minInterval).Sub(now); wait > 0 {
+		c.logger.Info("Waiting before contacting public IP service again",
+			zap.String("service_url", c.serviceURL),
+			zap.Duration("wait", wait))
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-c.clock.After(wait):
+		}
+	}
+
+	ip, err := c.fetchPublicIP(ctx)
+
+	entry.LastRequestAt = c.clock.Now()
+	var limited *rateLimitedError
+	if errors.As(err, &limited) {
+		entry.NotBefore = entry.LastRequestAt.Add(limited.retryAfter)
+	}
+	if err == nil {
+		entry.IP = ip
+		entry.DetectedAt = entry.LastRequestAt
+	}
+	c.saveCache()
+
+	return ip, err
+}
+
+// fetchPublicIP asks the service for the current public IP address
+func (c *Client) fetchPublicIP(ctx context.Context) (string, error) {
 	c.logger.Debug("Detecting public IP address", zap.String("service_url", c.serviceURL))
 
 	req, err := http.NewRequestWithContext(ctx, "GET", c.serviceURL, nil)
@@ -61,6 +146,14 @@ func (c *Client) GetPublicIP(ctx context.Context) (string, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		c.logger.Warn("Public IP service is rate limiting requests",
+			zap.String("service_url", c.serviceURL),
+			zap.Duration("retry_after", retryAfter))
+		return "", &rateLimitedError{retryAfter: retryAfter}
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error("Unexpected status code",
 			zap.Int("status_code", resp.StatusCode),
@@ -113,7 +206,7 @@ func (c *Client) GetPublicIPWithRetry(ctx context.Context, maxRetries int) (stri
 			select {
 			case <-ctx.Done():
 				return "", ctx.Err()
-			case <-time.After(2 * time.Second):
+			case <-c.clock.After(2 * time.Second):
 				// Continue to next attempt
 			}
 		}
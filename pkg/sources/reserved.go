@@ -0,0 +1,104 @@
+package sources
+
+import (
+	_ "embed"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Policies for reserved addresses returned by a source
+const (
+	// ReservedDrop leaves reserved addresses out of the allowlist
+	ReservedDrop = "drop"
+	// ReservedKeep allowlists reserved addresses like any other
+	ReservedKeep = "keep"
+	// ReservedFail fails the collection when a source returns a reserved address
+	ReservedFail = "fail"
+)
+
+// bogonList is the embedded bogon reference every source output is checked against
+//
+//go:embed bogons.txt
+var bogonList string
+
+// reservedRanges are the networks never reachable from the internet, by category
+var reservedRanges = parseBogons(bogonList)
+
+type reservedRange struct {
+	category string
+	prefix   netip.Prefix
+}
+
+// parseBogons parses "prefix category" lines, ignoring blank lines and # comments
+func parseBogons(list string) []reservedRange {
+	var ranges []reservedRange
+	for _, line := range strings.Split(list, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			panic(fmt.Sprintf("invalid bogon list line %q", line))
+		}
+		ranges = append(ranges, reservedRange{category: fields[1], prefix: netip.MustParsePrefix(fields[0])})
+	}
+	return ranges
+}
+
+// Reserved returns the category (private, loopback, link-local or bogon) of an address or CIDR
+// block overlapping a reserved range, or an empty string for public and unparsable sources
+func Reserved(source string) string {
+	prefix, err := netip.ParsePrefix(source)
+	if err != nil {
+		addr, err := netip.ParseAddr(source)
+		if err != nil {
+			return ""
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	prefix = prefix.Masked()
+
+	for _, reserved := range reservedRanges {
+		// Blocks inside a reserved range are reserved; wider blocks around one are left alone
+		if prefix.Bits() >= reserved.prefix.Bits() && reserved.prefix.Contains(prefix.Addr()) {
+			return reserved.category
+		}
+	}
+	return ""
+}
+
+// Screen applies the policy to the addresses a source returned, returning the addresses to keep
+// and the reserved ones it found as "address (category)"
+func Screen(policy string, addresses []string) ([]string, []string, error) {
+	kept := make([]string, 0, len(addresses))
+	var reserved []string
+	for _, address := range addresses {
+		category := Reserved(address)
+		if category == "" {
+			kept = append(kept, address)
+			continue
+		}
+
+		reserved = append(reserved, fmt.Sprintf("%s (%s)", address, category))
+		if policy == ReservedKeep {
+			kept = append(kept, address)
+		}
+	}
+
+	if policy == ReservedFail && len(reserved) > 0 {
+		return nil, reserved, fmt.Errorf("source returned reserved addresses: %s", strings.Join(reserved, ", "))
+	}
+	return kept, reserved, nil
+}
+
+// FilterBogons drops the addresses inside a bogon range, returning the addresses to keep and the
+// dropped ones as "address (category)"
+func FilterBogons(addresses []string) ([]string, []string) {
+	kept, dropped, _ := Screen(ReservedDrop, addresses)
+	return kept, dropped
+}
@@ -0,0 +1,93 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReserved(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{source: "10.1.2.3", expected: "private"},
+		{source: "172.20.0.0/16", expected: "private"},
+		{source: "192.168.1.10/32", expected: "private"},
+		{source: "100.64.0.1", expected: "private"},
+		{source: "fd00::1", expected: "private"},
+		{source: "127.0.0.1", expected: "loopback"},
+		{source: "::1", expected: "loopback"},
+		{source: "169.254.169.254", expected: "link-local"},
+		{source: "fe80::1", expected: "link-local"},
+		{source: "0.0.0.0", expected: "bogon"},
+		{source: "203.0.113.5", expected: "bogon"},
+		{source: "2001:db8::1", expected: "bogon"},
+		{source: "239.1.1.1", expected: "bogon"},
+		{source: "ff02::1", expected: "bogon"},
+		{source: "fec0::1", expected: "bogon"},
+		{source: "3fff::/24", expected: "bogon"},
+		{source: "64:ff9b::101:101", expected: "bogon"},
+		{source: "4000::1", expected: "bogon"},
+		{source: "::ffff:10.0.0.1", expected: "private"},
+		{source: "1.1.1.1", expected: ""},
+		{source: "173.245.48.0/20", expected: ""},
+		{source: "2606:4700::/32", expected: ""},
+		{source: "172.15.255.255", expected: ""},
+		// Wider blocks merely containing a reserved range are not flagged
+		{source: "0.0.0.0/0", expected: ""},
+		{source: "not-an-ip", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := Reserved(tt.source); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestScreen(t *testing.T) {
+	addresses := []string{"104.16.0.1", "10.0.0.5", "2606:4700::1", "127.0.0.1"}
+
+	tests := []struct {
+		policy      string
+		expected    []string
+		expectError bool
+	}{
+		{policy: ReservedDrop, expected: []string{"104.16.0.1", "2606:4700::1"}},
+		{policy: ReservedKeep, expected: addresses},
+		{policy: ReservedFail, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			kept, reserved, err := Screen(tt.policy, addresses)
+			if strings.Join(reserved, ",") != "10.0.0.5 (private),127.0.0.1 (loopback)" {
+				t.Errorf("unexpected reserved addresses %v", reserved)
+			}
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(kept, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v, got %v", tt.expected, kept)
+			}
+		})
+	}
+}
+
+func TestFilterBogons(t *testing.T) {
+	kept, dropped := FilterBogons([]string{"173.245.48.0/20", "198.51.100.0/24", "2400:cb00::/32", "2001:db8::/48", "fd12::/16"})
+	if strings.Join(kept, ",") != "173.245.48.0/20,2400:cb00::/32" {
+		t.Errorf("unexpected kept addresses %v", kept)
+	}
+	if strings.Join(dropped, ",") != "198.51.100.0/24 (bogon),2001:db8::/48 (bogon),fd12::/16 (private)" {
+		t.Errorf("unexpected dropped addresses %v", dropped)
+	}
+}
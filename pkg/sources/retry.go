@@ -0,0 +1,63 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"go.uber.org/zap"
+)
+
+// Retry calls attempt until it succeeds, at most maxRetries times, waiting an exponential
+// backoff with jitter on clk between the attempts. Every wait is taken from the retry budget of
+// ctx, shared by the retries of a run, and gives up with retrybudget.ErrExhausted once it does
+// not fit; list names what attempt fetches in the errors, e.g. "fastly IP list"
+func Retry(ctx context.Context, clk clock.Clock, logger *zap.Logger, list string, maxRetries int, attempt func(context.Context) ([]string, error)) ([]string, error) {
+	var lastErr error
+
+	b := &backoff.Backoff{
+		Min:    100 * time.Millisecond,
+		Max:    10 * time.Second,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	for n := 1; n <= maxRetries; n++ {
+		logger.Debug("Attempting to fetch the list",
+			zap.Int("attempt", n),
+			zap.Int("max_retries", maxRetries))
+
+		ips, err := attempt(ctx)
+		if err == nil {
+			return ips, nil
+		}
+
+		lastErr = err
+		logger.Warn("Failed to fetch the list, retrying",
+			zap.Int("attempt", n),
+			zap.Int("max_retries", maxRetries),
+			zap.Error(err))
+
+		if n < maxRetries {
+			backoffDuration := b.Duration()
+			if !retrybudget.Take(ctx, backoffDuration) {
+				return nil, fmt.Errorf("failed to fetch %s after %d attempts: %w: %w", list, n, retrybudget.ErrExhausted, lastErr)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-clk.After(backoffDuration):
+			}
+		}
+	}
+
+	logger.Error("Failed to fetch the list after all retries",
+		zap.Int("max_retries", maxRetries),
+		zap.Error(lastErr))
+
+	return nil, fmt.Errorf("failed to fetch %s after %d retries: %w", list, maxRetries, lastErr)
+}
@@ -0,0 +1,106 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/clock"
+	"github.com/kholisrag/do-firewall-allowlister/pkg/retrybudget"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRetry(t *testing.T) {
+	failure := errors.New("unavailable")
+
+	t.Run("succeeds after failures", func(t *testing.T) {
+		fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+		attempts := 0
+		attempt := func(context.Context) ([]string, error) {
+			attempts++
+			if attempts < 3 {
+				return nil, failure
+			}
+			return []string{"198.51.100.0/24"}, nil
+		}
+
+		done := make(chan struct{})
+		var ips []string
+		var err error
+		go func() {
+			defer close(done)
+			ips, err = Retry(context.Background(), fake, zaptest.NewLogger(t), "fastly IP list", 3, attempt)
+		}()
+		// Each backoff is at most 10s, which the fake clock skips
+		for range 2 {
+			fake.BlockUntil(1)
+			fake.Advance(10 * time.Second)
+		}
+		<-done
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if attempts != 3 || !slices.Equal(ips, []string{"198.51.100.0/24"}) {
+			t.Errorf("expected the third attempt to succeed, got %v after %d attempts", ips, attempts)
+		}
+	})
+
+	t.Run("fails after all retries", func(t *testing.T) {
+		fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+		attempts := 0
+		done := make(chan error)
+		go func() {
+			_, err := Retry(context.Background(), fake, zaptest.NewLogger(t), "fastly IP list", 2, func(context.Context) ([]string, error) {
+				attempts++
+				return nil, failure
+			})
+			done <- err
+		}()
+		fake.BlockUntil(1)
+		fake.Advance(10 * time.Second)
+		err := <-done
+
+		if !errors.Is(err, failure) || err.Error() != "failed to fetch fastly IP list after 2 retries: unavailable" {
+			t.Errorf("expected the last failure after 2 retries, got %v", err)
+		}
+		if attempts != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("retry budget exhausted", func(t *testing.T) {
+		// The first backoff of at least 100ms does not fit, so nothing waits on the clock
+		ctx := retrybudget.WithBudget(context.Background(), 50*time.Millisecond)
+		attempts := 0
+		_, err := Retry(ctx, clock.NewFake(time.Now()), zaptest.NewLogger(t), "fastly IP list", 3, func(context.Context) ([]string, error) {
+			attempts++
+			return nil, failure
+		})
+		if !errors.Is(err, retrybudget.ErrExhausted) || !errors.Is(err, failure) {
+			t.Errorf("expected the exhausted budget and the failure, got %v", err)
+		}
+		if attempts != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		fake := clock.NewFake(time.Date(2025, 1, 8, 9, 30, 0, 0, time.UTC))
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			_, err := Retry(ctx, fake, zaptest.NewLogger(t), "fastly IP list", 3, func(context.Context) ([]string, error) {
+				return nil, failure
+			})
+			done <- err
+		}()
+		fake.BlockUntil(1)
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the cancellation, got %v", err)
+		}
+	})
+}
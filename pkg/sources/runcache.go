@@ -0,0 +1,83 @@
+package sources
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// RunCache holds what the sources fetched during one run, so a list or hostname read by several
+// firewalls, rules or sources is fetched once per run
+type RunCache struct {
+	mu      sync.Mutex
+	entries map[string]*runCacheEntry
+}
+
+// runCacheEntry is a fetch of a run, done is closed once value and err are set
+type runCacheEntry struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// runCacheKey is the context key of the run cache
+type runCacheKey struct{}
+
+// WithRunCache returns a context holding a new run cache, or ctx itself if it already holds one
+func WithRunCache(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(runCacheKey{}).(*RunCache); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, runCacheKey{}, &RunCache{entries: make(map[string]*runCacheEntry)})
+}
+
+// Cached returns what fetch returned for key earlier in the run of ctx, calling it once for
+// concurrent callers; failures are not kept so a retry fetches again, and fetch is called every
+// time when ctx holds no run cache
+func Cached[T any](ctx context.Context, key string, fetch func() (T, error)) (T, error) {
+	cache, ok := ctx.Value(runCacheKey{}).(*RunCache)
+	if !ok {
+		return fetch()
+	}
+
+	cache.mu.Lock()
+	entry, found := cache.entries[key]
+	if !found {
+		entry = &runCacheEntry{done: make(chan struct{})}
+		cache.entries[key] = entry
+	}
+	cache.mu.Unlock()
+
+	if found {
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+		if entry.err != nil {
+			var zero T
+			return zero, entry.err
+		}
+		return entry.value.(T), nil
+	}
+
+	value, err := fetch()
+	entry.value, entry.err = value, err
+	if err != nil {
+		cache.mu.Lock()
+		delete(cache.entries, key)
+		cache.mu.Unlock()
+	}
+	close(entry.done)
+	return value, err
+}
+
+// LookupIPAddr looks the host up once per run of ctx, shared by the domain and dynamic DNS sources
+func LookupIPAddr(ctx context.Context, resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}, host string) ([]net.IPAddr, error) {
+	return Cached(ctx, "dns "+host, func() ([]net.IPAddr, error) {
+		return resolver.LookupIPAddr(ctx, host)
+	})
+}
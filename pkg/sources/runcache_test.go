@@ -0,0 +1,69 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCached(t *testing.T) {
+	calls := 0
+	fetch := func() (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	// Without a run cache every call fetches
+	for range 2 {
+		if _, err := Cached(context.Background(), "list", fetch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 fetches without a run cache, got %d", calls)
+	}
+
+	ctx := WithRunCache(context.Background())
+	if WithRunCache(ctx) != ctx {
+		t.Error("expected a nested run to keep the cache of its run")
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make(map[int]bool)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := Cached(ctx, "list", func() (int, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return fetch()
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			mu.Lock()
+			results[value] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if calls != 3 || len(results) != 1 {
+		t.Errorf("expected one fetch shared by the run, got %d fetches and results %v", calls-2, results)
+	}
+}
+
+func TestCachedDoesNotKeepFailures(t *testing.T) {
+	ctx := WithRunCache(context.Background())
+	failure := errors.New("unavailable")
+
+	if _, err := Cached(ctx, "list", func() (string, error) { return "", failure }); !errors.Is(err, failure) {
+		t.Fatalf("expected the fetch error, got %v", err)
+	}
+	value, err := Cached(ctx, "list", func() (string, error) { return "ranges", nil })
+	if err != nil || value != "ranges" {
+		t.Errorf("expected a retry to fetch again, got %q, %v", value, err)
+	}
+}
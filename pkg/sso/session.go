@@ -0,0 +1,113 @@
+package sso
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrInvalidSession is returned by OpenSession and OpenLogin for a tampered, malformed or expired value
+var ErrInvalidSession = errors.New("invalid or expired session")
+
+// Session is the signed-in user carried in a cookie between requests
+type Session struct {
+	Identity  string    `json:"identity"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// Login is the pending sign-in carried in a cookie until the provider redirects back
+type Login struct {
+	State     string    `json:"state"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// NewLogin starts a sign-in with a random state and PKCE verifier, valid for ttl
+func NewLogin(ttl time.Duration) (Login, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Login{}, fmt.Errorf("failed to generate sign-in state: %w", err)
+	}
+
+	return Login{
+		State:     base64.RawURLEncoding.EncodeToString(b),
+		Verifier:  oauth2.GenerateVerifier(),
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// Seal encodes v as a URL-safe value authenticated with an HMAC-SHA256 of key
+func Seal(v interface{}, key []byte) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac("seal", encoded, key)), nil
+}
+
+// OpenSession verifies a sealed session and checks that it has not expired
+func OpenSession(value string, key []byte, now time.Time) (Session, error) {
+	var session Session
+	if err := open(value, key, &session); err != nil || session.Identity == "" || !now.Before(session.ExpiresAt) {
+		return Session{}, ErrInvalidSession
+	}
+	return session, nil
+}
+
+// OpenLogin verifies a sealed pending sign-in and checks that it has not expired
+func OpenLogin(value string, key []byte, now time.Time) (Login, error) {
+	var login Login
+	if err := open(value, key, &login); err != nil || login.State == "" || !now.Before(login.ExpiresAt) {
+		return Login{}, ErrInvalidSession
+	}
+	return login, nil
+}
+
+// CSRFToken derives the token forms posted with the sealed session must carry
+func CSRFToken(session string, key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(mac("csrf", session, key))
+}
+
+// ValidCSRFToken reports whether token belongs to the sealed session
+func ValidCSRFToken(token, session string, key []byte) bool {
+	return hmac.Equal([]byte(token), []byte(CSRFToken(session, key)))
+}
+
+// open verifies the signature of a sealed value and decodes it into v
+func open(value string, key []byte, v interface{}) error {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return ErrInvalidSession
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, mac("seal", encoded, key)) {
+		return ErrInvalidSession
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSession
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrInvalidSession
+	}
+	return nil
+}
+
+// mac computes the HMAC-SHA256 of value for the purpose, so tokens of one kind cannot pass as another
+func mac(purpose, value string, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(purpose + "\x00" + value))
+	return h.Sum(nil)
+}
@@ -0,0 +1,164 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// Provider describes an OAuth 2.0 or OpenID Connect identity provider
+type Provider struct {
+	Endpoint    oauth2.Endpoint
+	UserInfoURL string
+	Scopes      []string
+}
+
+// Providers are the built-in providers selectable by name
+var Providers = map[string]Provider{
+	"google": {
+		Endpoint:    endpoints.Google,
+		UserInfoURL: "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:      []string{"openid", "email"},
+	},
+	"github": {
+		Endpoint:    endpoints.GitHub,
+		UserInfoURL: "https://api.github.com/user",
+		Scopes:      []string{"read:user"},
+	},
+}
+
+// OIDCProvider returns a generic OpenID Connect provider with the given endpoints
+func OIDCProvider(authURL, tokenURL, userInfoURL string) Provider {
+	return Provider{
+		Endpoint:    oauth2.Endpoint{AuthURL: authURL, TokenURL: tokenURL},
+		UserInfoURL: userInfoURL,
+		Scopes:      []string{"openid", "email"},
+	}
+}
+
+// Identity is the user the provider authenticated
+type Identity struct {
+	Subject string
+	Email   string
+	// Login is the GitHub user name, which identifies GitHub users instead of their unverified email
+	Login string
+}
+
+// Name returns the name policies and audit records refer to the user by
+func (i Identity) Name() string {
+	if i.Login != "" {
+		return i.Login
+	}
+	return i.Email
+}
+
+// userInfo is the subset of the OpenID Connect userinfo and GitHub user responses that is used
+type userInfo struct {
+	Subject       string          `json:"sub"`
+	Email         string          `json:"email"`
+	EmailVerified *bool           `json:"email_verified"`
+	Login         string          `json:"login"`
+	ID            json.RawMessage `json:"id"`
+}
+
+// Client signs users in with the authorization code flow and looks up who they are
+type Client struct {
+	config      oauth2.Config
+	userInfoURL string
+	httpClient  *http.Client
+	logger      *zap.Logger
+}
+
+// NewClient creates a client for the provider redirecting back to redirectURL
+func NewClient(provider Provider, clientID, clientSecret, redirectURL string, logger *zap.Logger) *Client {
+	return &Client{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint,
+			RedirectURL:  redirectURL,
+			Scopes:       provider.Scopes,
+		},
+		userInfoURL: provider.UserInfoURL,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		logger:      logger.Named("sso"),
+	}
+}
+
+// AuthCodeURL returns the provider's sign-in URL for the state and PKCE verifier
+func (c *Client) AuthCodeURL(state, verifier string) string {
+	return c.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems the authorization code and returns the identity of the signed-in user
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (Identity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.httpClient)
+
+	token, err := c.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.userInfoURL, nil)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to create userinfo request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.config.Client(ctx, token).Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to fetch userinfo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("userinfo returned status %d", resp.StatusCode)
+	}
+
+	var info userInfo
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&info); err != nil {
+		return Identity{}, fmt.Errorf("failed to parse userinfo: %w", err)
+	}
+
+	identity, err := info.identity()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	c.logger.Debug("Authenticated user", zap.String("identity", identity.Name()))
+	return identity, nil
+}
+
+// identity validates the userinfo response; unverified emails are never trusted
+func (u userInfo) identity() (Identity, error) {
+	identity := Identity{Subject: u.Subject, Login: u.Login}
+	if identity.Subject == "" && len(u.ID) > 0 {
+		if id, err := strconv.Unquote(string(u.ID)); err == nil {
+			identity.Subject = id
+		} else {
+			identity.Subject = string(u.ID)
+		}
+	}
+
+	// GitHub users are identified by login, their profile email is not verified
+	if u.Login == "" && u.Email != "" {
+		if u.EmailVerified == nil || !*u.EmailVerified {
+			return Identity{}, errors.New("provider did not verify the user's email")
+		}
+		identity.Email = u.Email
+	}
+
+	if identity.Name() == "" {
+		return Identity{}, errors.New("provider returned no email or login for the user")
+	}
+	return identity, nil
+}
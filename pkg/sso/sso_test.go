@@ -0,0 +1,123 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name        string
+		userInfo    string
+		expectError bool
+		expected    string
+	}{
+		{name: "verified email", userInfo: `{"sub":"1234","email":"alice@example.com","email_verified":true}`, expected: "alice@example.com"},
+		{name: "github login", userInfo: `{"id":42,"login":"octocat","email":"octo@example.com"}`, expected: "octocat"},
+		{name: "unverified email", userInfo: `{"sub":"1234","email":"alice@example.com","email_verified":false}`, expectError: true},
+		{name: "no identity", userInfo: `{"sub":"1234"}`, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Fatalf("failed to parse token request: %v", err)
+				}
+				if r.Form.Get("code") != "the-code" || r.Form.Get("code_verifier") != "the-verifier" {
+					t.Errorf("unexpected token request %v", r.Form)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "the-token", "token_type": "Bearer"})
+			})
+			mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer the-token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write([]byte(tt.userInfo))
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			provider := OIDCProvider(srv.URL+"/authorize", srv.URL+"/token", srv.URL+"/userinfo")
+			client := NewClient(provider, "client", "secret", "https://allow.example.com/allow/callback", zaptest.NewLogger(t))
+
+			identity, err := client.Exchange(context.Background(), "the-code", "the-verifier")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got identity %+v", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if identity.Name() != tt.expected {
+				t.Errorf("expected identity %s, got %s", tt.expected, identity.Name())
+			}
+		})
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	provider := OIDCProvider("https://idp.example.com/authorize", "https://idp.example.com/token", "https://idp.example.com/userinfo")
+	client := NewClient(provider, "client", "secret", "https://allow.example.com/allow/callback", zaptest.NewLogger(t))
+
+	u, err := url.Parse(client.AuthCodeURL("the-state", "the-verifier"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	query := u.Query()
+	if query.Get("state") != "the-state" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf("expected state and PKCE challenge, got %s", u)
+	}
+	if query.Get("redirect_uri") != "https://allow.example.com/allow/callback" {
+		t.Errorf("unexpected redirect_uri %s", query.Get("redirect_uri"))
+	}
+}
+
+func TestSessions(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Now()
+
+	value, err := Seal(Session{Identity: "alice@example.com", ExpiresAt: now.Add(time.Hour)}, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	session, err := OpenSession(value, key, now)
+	if err != nil || session.Identity != "alice@example.com" {
+		t.Fatalf("expected session for alice@example.com, got %+v, %v", session, err)
+	}
+	if _, err := OpenSession(value, key, now.Add(2*time.Hour)); err == nil {
+		t.Error("expected expired session to be rejected")
+	}
+	if _, err := OpenSession(value, []byte("another-key-another-key-another-k"), now); err == nil {
+		t.Error("expected session sealed with another key to be rejected")
+	}
+
+	login, err := Seal(Login{State: "s", Verifier: "v", ExpiresAt: now.Add(time.Minute)}, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := OpenSession(login, key, now); err == nil {
+		t.Error("expected a pending login not to pass as a session")
+	}
+
+	token := CSRFToken(value, key)
+	if !ValidCSRFToken(token, value, key) {
+		t.Error("expected CSRF token of the session to be valid")
+	}
+	if ValidCSRFToken(token, login, key) {
+		t.Error("expected CSRF token to be bound to its session")
+	}
+}
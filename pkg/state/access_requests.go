@@ -0,0 +1,103 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Access request statuses
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+)
+
+// AccessRequest represents a manual request to allow an IP address on a port
+type AccessRequest struct {
+	ID          string    `json:"id"`
+	IP          string    `json:"ip"`
+	Port        int       `json:"port"`
+	Reason      string    `json:"reason,omitempty"`
+	Status      string    `json:"status"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+	DecidedBy   string    `json:"decided_by,omitempty"`
+	DecidedAt   time.Time `json:"decided_at,omitempty"`
+}
+
+// NewAccessRequest creates a pending access request with a random ID
+func NewAccessRequest(ip string, port int, reason, requestedBy string) (AccessRequest, error) {
+	id, err := newID()
+	if err != nil {
+		return AccessRequest{}, err
+	}
+
+	return AccessRequest{
+		ID:          id,
+		IP:          ip,
+		Port:        port,
+		Reason:      reason,
+		Status:      AccessRequestPending,
+		RequestedBy: requestedBy,
+		RequestedAt: time.Now().UTC(),
+	}, nil
+}
+
+// PendingAccessRequests returns all access requests awaiting a decision
+func (s *State) PendingAccessRequests() []AccessRequest {
+	var pending []AccessRequest
+	for _, req := range s.AccessRequests {
+		if req.Status == AccessRequestPending {
+			pending = append(pending, req)
+		}
+	}
+	return pending
+}
+
+// FindAccessRequest returns a pointer to the access request with the given ID
+func (s *State) FindAccessRequest(id string) (*AccessRequest, error) {
+	for i := range s.AccessRequests {
+		if s.AccessRequests[i].ID == id {
+			return &s.AccessRequests[i], nil
+		}
+	}
+	return nil, fmt.Errorf("access request %s not found", id)
+}
+
+// Decide marks a pending access request as approved or denied; requesters may deny their own
+// request but not approve it, an approval takes a second person
+func (r *AccessRequest) Decide(status, decidedBy string) error {
+	if r.Status != AccessRequestPending {
+		return fmt.Errorf("access request %s is already %s", r.ID, r.Status)
+	}
+	if status != AccessRequestApproved && status != AccessRequestDenied {
+		return fmt.Errorf("invalid access request status: %s", status)
+	}
+	if status == AccessRequestApproved && r.RequestedBy != "" && decidedBy == r.RequestedBy {
+		return fmt.Errorf("access request %s was requested by %s, who cannot approve it", r.ID, decidedBy)
+	}
+
+	r.Status = status
+	r.DecidedBy = decidedBy
+	r.DecidedAt = time.Now().UTC()
+	return nil
+}
+
+// Reopen returns an approved request whose rule failed to apply to pending, so it can be
+// approved again
+func (r *AccessRequest) Reopen() {
+	r.Status = AccessRequestPending
+	r.DecidedBy = ""
+	r.DecidedAt = time.Time{}
+}
+
+// newID generates a short random hexadecimal identifier
+func newID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,32 @@
+package state
+
+import "time"
+
+// DaemonRecord records the daemon running on the state file, so other commands can tell whether
+// it is up and running the current configuration
+type DaemonRecord struct {
+	StartedAt time.Time `json:"started_at"`
+	// StoppedAt is set on graceful shutdown; a crashed daemon leaves it unset
+	StoppedAt  *time.Time `json:"stopped_at,omitempty"`
+	PID        int        `json:"pid"`
+	Hostname   string     `json:"hostname,omitempty"`
+	DryRun     bool       `json:"dry_run,omitempty"`
+	ConfigHash string     `json:"config_hash"`
+}
+
+// RecordDaemonStart replaces the daemon record with the one of a daemon that just started
+func (s *State) RecordDaemonStart(record DaemonRecord) {
+	record.StartedAt = record.StartedAt.UTC()
+	record.StoppedAt = nil
+	s.Daemon = &record
+}
+
+// RecordDaemonStop records that the daemon of the given process stopped at the given time; the
+// record of another daemon started since is left alone
+func (s *State) RecordDaemonStop(pid int, at time.Time) {
+	if s.Daemon == nil || s.Daemon.PID != pid {
+		return
+	}
+	at = at.UTC()
+	s.Daemon.StoppedAt = &at
+}
@@ -0,0 +1,31 @@
+package state
+
+import "time"
+
+// DigestRecord records the end of the period covered by the last change digest sent for a firewall
+type DigestRecord struct {
+	FirewallID string    `json:"firewall_id"`
+	SentUntil  time.Time `json:"sent_until"`
+}
+
+// LastDigest returns the end of the period covered by the last digest for the firewall, or the zero time
+func (s *State) LastDigest(firewallID string) time.Time {
+	for _, record := range s.Digests {
+		if record.FirewallID == firewallID {
+			return record.SentUntil
+		}
+	}
+	return time.Time{}
+}
+
+// SetLastDigest records that a digest covering changes up to until was sent for the firewall
+func (s *State) SetLastDigest(firewallID string, until time.Time) {
+	for i := range s.Digests {
+		if s.Digests[i].FirewallID == firewallID {
+			s.Digests[i].SentUntil = until.UTC()
+			return
+		}
+	}
+
+	s.Digests = append(s.Digests, DigestRecord{FirewallID: firewallID, SentUntil: until.UTC()})
+}
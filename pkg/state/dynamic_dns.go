@@ -0,0 +1,41 @@
+package state
+
+import "time"
+
+// DynamicDNSRecord records the addresses a dynamic-DNS hostname last resolved to in a firewall's SSH rule
+type DynamicDNSRecord struct {
+	Hostname   string    `json:"hostname"`
+	FirewallID string    `json:"firewall_id"`
+	Port       int       `json:"port"`
+	IPs        []string  `json:"ips"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FindDynamicDNS returns the record for the hostname, firewall and port, if any
+func (s *State) FindDynamicDNS(hostname, firewallID string, port int) *DynamicDNSRecord {
+	for i := range s.DynamicDNS {
+		record := &s.DynamicDNS[i]
+		if record.Hostname == hostname && record.FirewallID == firewallID && record.Port == port {
+			return record
+		}
+	}
+	return nil
+}
+
+// SetDynamicDNS records the addresses the hostname resolved to for the firewall and port
+func (s *State) SetDynamicDNS(hostname, firewallID string, port int, ips []string) {
+	now := time.Now().UTC()
+	if record := s.FindDynamicDNS(hostname, firewallID, port); record != nil {
+		record.IPs = ips
+		record.UpdatedAt = now
+		return
+	}
+
+	s.DynamicDNS = append(s.DynamicDNS, DynamicDNSRecord{
+		Hostname:   hostname,
+		FirewallID: firewallID,
+		Port:       port,
+		IPs:        ips,
+		UpdatedAt:  now,
+	})
+}
@@ -0,0 +1,41 @@
+package state
+
+import "time"
+
+// Freeze records an operator-set freeze that halts automated updates of a firewall
+type Freeze struct {
+	FirewallID string    `json:"firewall_id"`
+	Reason     string    `json:"reason,omitempty"`
+	FrozenBy   string    `json:"frozen_by,omitempty"`
+	FrozenAt   time.Time `json:"frozen_at"`
+}
+
+// ActiveFreeze returns the active freeze for the given firewall, if any
+func (s *State) ActiveFreeze(firewallID string) *Freeze {
+	for i := range s.Freezes {
+		if s.Freezes[i].FirewallID == firewallID {
+			return &s.Freezes[i]
+		}
+	}
+	return nil
+}
+
+// SetFreeze freezes the firewall, replacing any existing freeze for it
+func (s *State) SetFreeze(freeze Freeze) {
+	if existing := s.ActiveFreeze(freeze.FirewallID); existing != nil {
+		*existing = freeze
+		return
+	}
+	s.Freezes = append(s.Freezes, freeze)
+}
+
+// RemoveFreeze lifts the freeze for the firewall, reporting whether one was active
+func (s *State) RemoveFreeze(firewallID string) bool {
+	for i := range s.Freezes {
+		if s.Freezes[i].FirewallID == firewallID {
+			s.Freezes = append(s.Freezes[:i], s.Freezes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package state
+
+import "time"
+
+// Access grant kinds
+const (
+	GrantInvite      = "invite"
+	GrantSelfService = "self-service"
+)
+
+// AccessGrant records temporary access opened for an IP address, by redeeming a one-time invite
+// link or through the SSO-protected self-service endpoint
+type AccessGrant struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	FirewallID string `json:"firewall_id"`
+	Port       int    `json:"port"`
+	IP         string `json:"ip"`
+	// CreatedBy is the operator who created the invite, Identity the SSO user who allowed themselves
+	CreatedBy string    `json:"created_by,omitempty"`
+	Identity  string    `json:"identity,omitempty"`
+	GrantedAt time.Time `json:"granted_at"`
+	// ExpiresAt is when the access is removed again
+	ExpiresAt time.Time `json:"expires_at"`
+	// LinkExpiresAt is when an invite link stops being redeemable, after which the grant can be forgotten
+	LinkExpiresAt time.Time `json:"link_expires_at,omitempty"`
+	Closed        bool      `json:"closed,omitempty"`
+}
+
+// FindAccessGrant returns the grant with the given ID, e.g. of a redeemed invite, if any
+func (s *State) FindAccessGrant(id string) *AccessGrant {
+	for i := range s.AccessGrants {
+		if s.AccessGrants[i].ID == id {
+			return &s.AccessGrants[i]
+		}
+	}
+	return nil
+}
+
+// DueAccessGrants returns the firewall's open grants whose access has expired by now
+func (s *State) DueAccessGrants(firewallID string, now time.Time) []*AccessGrant {
+	var due []*AccessGrant
+	for i := range s.AccessGrants {
+		grant := &s.AccessGrants[i]
+		if grant.FirewallID == firewallID && !grant.Closed && !now.Before(grant.ExpiresAt) {
+			due = append(due, grant)
+		}
+	}
+	return due
+}
+
+// GrantIPInUse reports whether another open grant, or a machine's own address, still needs ip on the port
+func (s *State) GrantIPInUse(firewallID string, port int, ip string, now time.Time) bool {
+	for _, grant := range s.AccessGrants {
+		if grant.FirewallID == firewallID && grant.Port == port && grant.IP == ip &&
+			!grant.Closed && now.Before(grant.ExpiresAt) {
+			return true
+		}
+	}
+	for _, entry := range s.SelfIPs {
+		if entry.FirewallID == firewallID && entry.Port == port && entry.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// PruneAccessGrants forgets closed grants, keeping those of invites whose links can still be
+// redeemed so they cannot be used twice
+func (s *State) PruneAccessGrants(now time.Time) {
+	kept := s.AccessGrants[:0]
+	for _, grant := range s.AccessGrants {
+		if grant.Closed && !now.Before(grant.LinkExpiresAt) {
+			continue
+		}
+		kept = append(kept, grant)
+	}
+	s.AccessGrants = kept
+}
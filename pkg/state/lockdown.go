@@ -0,0 +1,25 @@
+package state
+
+import (
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// Lockdown records an active emergency lockdown and the rules it replaced
+type Lockdown struct {
+	FirewallID        string             `json:"firewall_id"`
+	Ports             []int              `json:"ports"`
+	BreakGlassSources []string           `json:"break_glass_sources,omitempty"`
+	Backup            []godo.InboundRule `json:"backup"`
+	LockedBy          string             `json:"locked_by,omitempty"`
+	LockedAt          time.Time          `json:"locked_at"`
+}
+
+// ActiveLockdown returns the active lockdown for the given firewall, if any
+func (s *State) ActiveLockdown(firewallID string) *Lockdown {
+	if s.Lockdown != nil && s.Lockdown.FirewallID == firewallID {
+		return s.Lockdown
+	}
+	return nil
+}
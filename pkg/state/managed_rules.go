@@ -0,0 +1,25 @@
+package state
+
+import "time"
+
+// ManagedRule records an inbound rule added to a firewall at runtime through the admin API; it is
+// managed like the configured rules from then on
+type ManagedRule struct {
+	FirewallID string `json:"firewall_id"`
+	Port       int    `json:"port"`
+	// Protocol is tcp, udp or icmp, or several joined by "+" like configured rules
+	Protocol string    `json:"protocol"`
+	AddedBy  string    `json:"added_by,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// ManagedRulesFor returns the rules added to the firewall at runtime, in the order they were added
+func (s *State) ManagedRulesFor(firewallID string) []ManagedRule {
+	var rules []ManagedRule
+	for _, rule := range s.ManagedRules {
+		if rule.FirewallID == firewallID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,41 @@
+package state
+
+import "slices"
+
+// MovePort moves the records of the firewall's port from to port to: the addresses added by
+// dynamic DNS, allow-current-ip, watch-ip, invites and self-service, the rules added at runtime and
+// the recorded managed ports; it returns how many records moved
+func (s *State) MovePort(firewallID string, from, to int) int {
+	moved := 0
+	for i := range s.DynamicDNS {
+		if s.DynamicDNS[i].FirewallID == firewallID && s.DynamicDNS[i].Port == from {
+			s.DynamicDNS[i].Port = to
+			moved++
+		}
+	}
+	for i := range s.SelfIPs {
+		if s.SelfIPs[i].FirewallID == firewallID && s.SelfIPs[i].Port == from {
+			s.SelfIPs[i].Port = to
+			moved++
+		}
+	}
+	for i := range s.AccessGrants {
+		if s.AccessGrants[i].FirewallID == firewallID && s.AccessGrants[i].Port == from {
+			s.AccessGrants[i].Port = to
+			moved++
+		}
+	}
+	for i := range s.ManagedRules {
+		if s.ManagedRules[i].FirewallID == firewallID && s.ManagedRules[i].Port == from {
+			s.ManagedRules[i].Port = to
+			moved++
+		}
+	}
+
+	if slices.Contains(s.ManagedPorts(firewallID), from) {
+		s.ForgetManagedPorts(firewallID, []int{from})
+		s.RecordManagedPorts(firewallID, []int{to})
+		moved++
+	}
+	return moved
+}
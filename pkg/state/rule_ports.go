@@ -0,0 +1,71 @@
+package state
+
+import "slices"
+
+// RulePorts records the ports whose inbound rules the allowlister wrote to a firewall, so the rules
+// of ports later dropped from the configuration can be found and removed
+type RulePorts struct {
+	FirewallID string `json:"firewall_id"`
+	Ports      []int  `json:"ports"`
+}
+
+// ManagedPorts returns the ports recorded for the firewall, sorted
+func (s *State) ManagedPorts(firewallID string) []int {
+	for _, record := range s.RulePorts {
+		if record.FirewallID == firewallID {
+			return slices.Clone(record.Ports)
+		}
+	}
+	return nil
+}
+
+// RecordManagedPorts adds the ports to those recorded for the firewall; recorded ports are only
+// dropped by ForgetManagedPorts
+func (s *State) RecordManagedPorts(firewallID string, ports []int) {
+	for i := range s.RulePorts {
+		if s.RulePorts[i].FirewallID == firewallID {
+			merged := append(s.RulePorts[i].Ports, ports...)
+			slices.Sort(merged)
+			s.RulePorts[i].Ports = slices.Compact(merged)
+			return
+		}
+	}
+
+	recorded := slices.Clone(ports)
+	slices.Sort(recorded)
+	s.RulePorts = append(s.RulePorts, RulePorts{FirewallID: firewallID, Ports: slices.Compact(recorded)})
+}
+
+// ForgetManagedPorts drops the ports from those recorded for the firewall
+func (s *State) ForgetManagedPorts(firewallID string, ports []int) {
+	for i := range s.RulePorts {
+		if s.RulePorts[i].FirewallID == firewallID {
+			s.RulePorts[i].Ports = slices.DeleteFunc(s.RulePorts[i].Ports, func(port int) bool {
+				return slices.Contains(ports, port)
+			})
+			return
+		}
+	}
+}
+
+// PortsInUse returns the ports of the firewall holding addresses added by dynamic DNS,
+// allow-current-ip, watch-ip, invites or self-service, which are not managed inbound rules
+func (s *State) PortsInUse(firewallID string) map[int]bool {
+	ports := make(map[int]bool)
+	for _, record := range s.DynamicDNS {
+		if record.FirewallID == firewallID {
+			ports[record.Port] = true
+		}
+	}
+	for _, entry := range s.SelfIPs {
+		if entry.FirewallID == firewallID {
+			ports[entry.Port] = true
+		}
+	}
+	for _, grant := range s.AccessGrants {
+		if grant.FirewallID == firewallID {
+			ports[grant.Port] = true
+		}
+	}
+	return ports
+}
@@ -0,0 +1,56 @@
+package state
+
+import "time"
+
+// RunRecord records when the scheduled update last succeeded for a firewall, and the Config.Hash
+// of the configuration it applied
+type RunRecord struct {
+	FirewallID  string    `json:"firewall_id"`
+	SucceededAt time.Time `json:"succeeded_at"`
+	ConfigHash  string    `json:"config_hash,omitempty"`
+}
+
+// LastSuccessfulRun returns when the update last succeeded for the firewall, or the zero time
+func (s *State) LastSuccessfulRun(firewallID string) time.Time {
+	for _, record := range s.Runs {
+		if record.FirewallID == firewallID {
+			return record.SucceededAt
+		}
+	}
+	return time.Time{}
+}
+
+// SetLastSuccessfulRun records that the update succeeded for the firewall at the given time
+func (s *State) SetLastSuccessfulRun(firewallID string, at time.Time) {
+	for i := range s.Runs {
+		if s.Runs[i].FirewallID == firewallID {
+			s.Runs[i].SucceededAt = at.UTC()
+			return
+		}
+	}
+
+	s.Runs = append(s.Runs, RunRecord{FirewallID: firewallID, SucceededAt: at.UTC()})
+}
+
+// AppliedConfigHash returns the hash of the configuration the last successful update of the
+// firewall applied, or "" if it is unknown
+func (s *State) AppliedConfigHash(firewallID string) string {
+	for _, record := range s.Runs {
+		if record.FirewallID == firewallID {
+			return record.ConfigHash
+		}
+	}
+	return ""
+}
+
+// SetAppliedConfigHash records the hash of the configuration the update of the firewall applied
+func (s *State) SetAppliedConfigHash(firewallID, hash string) {
+	for i := range s.Runs {
+		if s.Runs[i].FirewallID == firewallID {
+			s.Runs[i].ConfigHash = hash
+			return
+		}
+	}
+
+	s.Runs = append(s.Runs, RunRecord{FirewallID: firewallID, ConfigHash: hash})
+}
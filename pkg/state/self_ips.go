@@ -0,0 +1,41 @@
+package state
+
+import "time"
+
+// SelfIP records the address a machine last added to a firewall's SSH rule for itself
+type SelfIP struct {
+	Machine    string    `json:"machine"`
+	FirewallID string    `json:"firewall_id"`
+	Port       int       `json:"port"`
+	IP         string    `json:"ip"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FindSelfIP returns the address previously added by the machine for the firewall and port, if any
+func (s *State) FindSelfIP(machine, firewallID string, port int) *SelfIP {
+	for i := range s.SelfIPs {
+		entry := &s.SelfIPs[i]
+		if entry.Machine == machine && entry.FirewallID == firewallID && entry.Port == port {
+			return entry
+		}
+	}
+	return nil
+}
+
+// SetSelfIP records the address added by the machine for the firewall and port
+func (s *State) SetSelfIP(machine, firewallID string, port int, ip string) {
+	now := time.Now().UTC()
+	if entry := s.FindSelfIP(machine, firewallID, port); entry != nil {
+		entry.IP = ip
+		entry.UpdatedAt = now
+		return
+	}
+
+	s.SelfIPs = append(s.SelfIPs, SelfIP{
+		Machine:    machine,
+		FirewallID: firewallID,
+		Port:       port,
+		IP:         ip,
+		UpdatedAt:  now,
+	})
+}
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"go.uber.org/zap"
+)
+
+// FirewallSnapshot holds the rules a firewall had before an update changed them
+type FirewallSnapshot struct {
+	FirewallID   string `json:"firewall_id"`
+	FirewallName string `json:"firewall_name,omitempty"`
+	// Action is the update that replaced the rules, e.g. update_inbound_rules or rollback
+	Action        string              `json:"action"`
+	TakenAt       time.Time           `json:"taken_at"`
+	InboundRules  []godo.InboundRule  `json:"inbound_rules"`
+	OutboundRules []godo.OutboundRule `json:"outbound_rules"`
+}
+
+// snapshotFile is the on-disk format of the snapshot store, oldest snapshot first
+type snapshotFile struct {
+	Snapshots []FirewallSnapshot `json:"snapshots"`
+}
+
+// SnapshotStore keeps the latest snapshots of every firewall in a JSON file of its own, apart from
+// the state file, since firewall updates run while commands hold the state file
+type SnapshotStore struct {
+	path   string
+	keep   int
+	logger *zap.Logger
+	mu     sync.Mutex
+}
+
+// NewSnapshotStore creates a store keeping the keep latest snapshots of every firewall at path;
+// with keep 0 no snapshots are recorded, but the recorded ones can still be listed
+func NewSnapshotStore(path string, keep int, logger *zap.Logger) *SnapshotStore {
+	return &SnapshotStore{
+		path:   path,
+		keep:   keep,
+		logger: logger.Named("state"),
+	}
+}
+
+// Record adds the snapshot, dropping the oldest ones of its firewall beyond the kept count
+func (s *SnapshotStore) Record(snapshot FirewallSnapshot) error {
+	if s.keep <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	snapshot.TakenAt = snapshot.TakenAt.UTC()
+	file.Snapshots = append(file.Snapshots, snapshot)
+
+	// Walking from the newest, the snapshots of the firewall past keep are dropped
+	kept := 0
+	for i := len(file.Snapshots) - 1; i >= 0; i-- {
+		if file.Snapshots[i].FirewallID != snapshot.FirewallID {
+			continue
+		}
+		kept++
+		if kept > s.keep {
+			file.Snapshots = slices.Delete(file.Snapshots, i, i+1)
+		}
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshots: %w", err)
+	}
+	if err := writeFile(s.path, data, "snapshot"); err != nil {
+		return err
+	}
+
+	s.logger.Debug("Saved firewall snapshot",
+		zap.String("path", s.path),
+		zap.String("firewall_id", snapshot.FirewallID))
+	return nil
+}
+
+// List returns the snapshots of the firewall, newest first
+func (s *SnapshotStore) List(firewallID string) ([]FirewallSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []FirewallSnapshot
+	for i := len(file.Snapshots) - 1; i >= 0; i-- {
+		if file.Snapshots[i].FirewallID == firewallID {
+			snapshots = append(snapshots, file.Snapshots[i])
+		}
+	}
+	return snapshots, nil
+}
+
+func (s *SnapshotStore) load() (*snapshotFile, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &snapshotFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file %s: %w", s.path, err)
+	}
+
+	var file snapshotFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot file %s: %w", s.path, err)
+	}
+	return &file, nil
+}
+
+// SelectSnapshot picks a snapshot of the newest-first list: by index, 0 being the newest, or the
+// newest taken at or before an RFC 3339 timestamp; an empty selector picks the newest
+func SelectSnapshot(snapshots []FirewallSnapshot, selector string) (FirewallSnapshot, error) {
+	if len(snapshots) == 0 {
+		return FirewallSnapshot{}, fmt.Errorf("no snapshots recorded")
+	}
+	if selector == "" {
+		return snapshots[0], nil
+	}
+
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 0 || index >= len(snapshots) {
+			return FirewallSnapshot{}, fmt.Errorf("no snapshot %d, %d recorded", index, len(snapshots))
+		}
+		return snapshots[index], nil
+	}
+
+	at, err := time.Parse(time.RFC3339, selector)
+	if err != nil {
+		return FirewallSnapshot{}, fmt.Errorf("invalid snapshot %q (must be an index or an RFC 3339 timestamp)", selector)
+	}
+	for _, snapshot := range snapshots {
+		if !snapshot.TakenAt.After(at) {
+			return snapshot, nil
+		}
+	}
+	return FirewallSnapshot{}, fmt.Errorf("no snapshot taken at or before %s", at.Format(time.RFC3339))
+}
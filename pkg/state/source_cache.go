@@ -0,0 +1,54 @@
+package state
+
+import (
+	"slices"
+	"time"
+)
+
+// CachedSource records the addresses of a source's last successful collection, which the
+// use-cached on-failure policy falls back to when the source fails
+type CachedSource struct {
+	Source string `json:"source"`
+	// Hash identifies the settings the source was collected with, so a source whose URL or
+	// domains were edited since is collected again rather than served from the cache
+	Hash        string    `json:"hash,omitempty"`
+	Addresses   []string  `json:"addresses"`
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// CachedSource returns the last successful collection of the source with the settings of hash,
+// or nil when there is none or the source was collected with other settings
+func (s *State) CachedSource(source, hash string) *CachedSource {
+	entry := s.cachedSource(source)
+	if entry == nil || entry.Hash != hash {
+		return nil
+	}
+	return entry
+}
+
+// cachedSource returns the cache entry of the source whatever its settings
+func (s *State) cachedSource(source string) *CachedSource {
+	for i := range s.SourceCache {
+		if s.SourceCache[i].Source == source {
+			return &s.SourceCache[i]
+		}
+	}
+	return nil
+}
+
+// CacheSource records the addresses a source collected with the settings of hash returned on a
+// successful collection, replacing its previous entry
+func (s *State) CacheSource(source, hash string, addresses []string, at time.Time) {
+	if entry := s.cachedSource(source); entry != nil {
+		entry.Hash = hash
+		entry.Addresses = slices.Clone(addresses)
+		entry.CollectedAt = at.UTC()
+		return
+	}
+	s.SourceCache = append(s.SourceCache, CachedSource{
+		Source:      source,
+		Hash:        hash,
+		Addresses:   slices.Clone(addresses),
+		CollectedAt: at.UTC(),
+	})
+}
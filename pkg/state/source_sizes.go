@@ -0,0 +1,63 @@
+package state
+
+import "time"
+
+// maxSourceSizes is how many size samples are kept per source and firewall
+const maxSourceSizes = 100
+
+// SourceSize records how many addresses a source returned on a run
+type SourceSize struct {
+	FirewallID string    `json:"firewall_id"`
+	Source     string    `json:"source"`
+	Count      int       `json:"count"`
+	At         time.Time `json:"at"`
+}
+
+// SourceSizeHistory returns the recorded sizes of a source for the firewall, oldest first
+func (s *State) SourceSizeHistory(firewallID, source string) []SourceSize {
+	var history []SourceSize
+	for _, size := range s.SourceSizes {
+		if size.FirewallID == firewallID && size.Source == source {
+			history = append(history, size)
+		}
+	}
+	return history
+}
+
+// RecordSourceSize appends a size sample for the source, dropping the oldest samples beyond
+// maxSourceSizes, and returns the previous sample if there was one
+func (s *State) RecordSourceSize(firewallID, source string, count int, at time.Time) *SourceSize {
+	history := s.SourceSizeHistory(firewallID, source)
+	var previous *SourceSize
+	if len(history) > 0 {
+		previous = &history[len(history)-1]
+	}
+
+	drop := len(history) + 1 - maxSourceSizes
+	kept := s.SourceSizes[:0]
+	for _, size := range s.SourceSizes {
+		if drop > 0 && size.FirewallID == firewallID && size.Source == source {
+			drop--
+			continue
+		}
+		kept = append(kept, size)
+	}
+	s.SourceSizes = append(kept, SourceSize{FirewallID: firewallID, Source: source, Count: count, At: at.UTC()})
+	return previous
+}
+
+// ChangePercent returns the size change from the previous sample to count in percent of the
+// previous size; a source growing from zero addresses counts as a 100% change
+func (s SourceSize) ChangePercent(count int) float64 {
+	if s.Count == 0 {
+		if count == 0 {
+			return 0
+		}
+		return 100
+	}
+	change := float64(count-s.Count) / float64(s.Count) * 100
+	if change < 0 {
+		return -change
+	}
+	return change
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kholisrag/do-firewall-allowlister/pkg/lock"
+	"go.uber.org/zap"
+)
+
+// updateLockTimeout is how long Update waits for another process updating the same state file
+const updateLockTimeout = time.Minute
+
+// State represents the persisted application state
+type State struct {
+	AccessRequests []AccessRequest    `json:"access_requests,omitempty"`
+	Lockdown       *Lockdown          `json:"lockdown,omitempty"`
+	SelfIPs        []SelfIP           `json:"self_ips,omitempty"`
+	DynamicDNS     []DynamicDNSRecord `json:"dynamic_dns,omitempty"`
+	Runs           []RunRecord        `json:"runs,omitempty"`
+	Freezes        []Freeze           `json:"freezes,omitempty"`
+	Digests        []DigestRecord     `json:"digests,omitempty"`
+	AccessGrants   []AccessGrant      `json:"access_grants,omitempty"`
+	SourceSizes    []SourceSize       `json:"source_sizes,omitempty"`
+	SourceCache    []CachedSource     `json:"source_cache,omitempty"`
+	ManagedRules   []ManagedRule      `json:"managed_rules,omitempty"`
+	RulePorts      []RulePorts        `json:"rule_ports,omitempty"`
+	Daemon         *DaemonRecord      `json:"daemon,omitempty"`
+}
+
+// Store persists State as a JSON file on disk
+type Store struct {
+	path   string
+	logger *zap.Logger
+	mu     sync.Mutex
+	// locker excludes the other processes on the file, the daemon and the commands each have a store
+	locker *lock.Locker
+}
+
+// NewStore creates a new state store backed by the given file path
+func NewStore(path string, logger *zap.Logger) *Store {
+	return &Store{
+		path:   path,
+		logger: logger.Named("state"),
+		locker: lock.NewLocker(path+".lock", logger),
+	}
+}
+
+// Path returns the file path of the state store
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Load reads the state from disk, returning an empty state if the file does not exist
+func (s *Store) Load() (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load()
+}
+
+// Update loads the state, applies fn and saves the result if fn succeeds, holding the lock of
+// the state file throughout so concurrent updates by other processes are not lost
+func (s *Store) Update(fn func(*State) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held, err := s.locker.Acquire(context.Background(), updateLockTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to lock state file %s: %w", s.path, err)
+	}
+	defer held.Release()
+
+	st, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(st); err != nil {
+		return err
+	}
+
+	return s.save(st)
+}
+
+func (s *Store) load() (*State, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.logger.Debug("State file does not exist, starting with empty state", zap.String("path", s.path))
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %w", s.path, err)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", s.path, err)
+	}
+
+	return &st, nil
+}
+
+// save writes the state atomically by writing to a temporary file and renaming it
+func (s *Store) save(st *State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if err := writeFile(s.path, data, "state"); err != nil {
+		return err
+	}
+
+	s.logger.Debug("Saved state", zap.String("path", s.path))
+	return nil
+}
+
+// writeFile replaces the file at path with data atomically, by writing to a temporary file and
+// renaming it; kind names the file in errors
+func writeFile(path string, data []byte, kind string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create %s directory %s: %w", kind, dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary %s file: %w", kind, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary %s file: %w", kind, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary %s file: %w", kind, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s file %s: %w", kind, path, err)
+	}
+	return nil
+}
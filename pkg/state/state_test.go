@@ -0,0 +1,569 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestStoreLoadMissingFile(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	store := NewStore(filepath.Join(t.TempDir(), "state.json"), logger)
+
+	st, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(st.AccessRequests) != 0 {
+		t.Errorf("expected empty state, got %d access requests", len(st.AccessRequests))
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+	store := NewStore(path, logger)
+
+	req, err := NewAccessRequest("203.0.113.10", 22, "on-call", "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = store.Update(func(st *State) error {
+		st.AccessRequests = append(st.AccessRequests, req)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected state file to exist: %v", err)
+	}
+
+	st, err := NewStore(path, logger).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(st.AccessRequests) != 1 {
+		t.Fatalf("expected 1 access request, got %d", len(st.AccessRequests))
+	}
+
+	if st.AccessRequests[0].ID != req.ID {
+		t.Errorf("expected ID %s, got %s", req.ID, st.AccessRequests[0].ID)
+	}
+}
+
+func TestStoreUpdateAcrossStores(t *testing.T) {
+	// Like the daemon and a command, two stores update the same file without sharing their mutex
+	path := filepath.Join(t.TempDir(), "state.json")
+	stores := []*Store{NewStore(path, zaptest.NewLogger(t)), NewStore(path, zaptest.NewLogger(t))}
+
+	const updates = 20
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range updates {
+				err := store.Update(func(st *State) error {
+					st.AccessRequests = append(st.AccessRequests, AccessRequest{ID: fmt.Sprintf("store-%d-%d", i, n)})
+					return nil
+				})
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	st, err := stores[0].Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(st.AccessRequests) != len(stores)*updates {
+		t.Errorf("expected every update of both stores to be kept, got %d of %d", len(st.AccessRequests), len(stores)*updates)
+	}
+}
+
+func TestStoreLoadInvalidFile(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if _, err := NewStore(path, logger).Load(); err == nil {
+		t.Error("expected error for invalid state file")
+	}
+}
+
+func TestAccessRequestDecide(t *testing.T) {
+	st := &State{}
+
+	req, err := NewAccessRequest("203.0.113.10", 22, "", "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	st.AccessRequests = append(st.AccessRequests, req)
+
+	if len(st.PendingAccessRequests()) != 1 {
+		t.Fatalf("expected 1 pending access request")
+	}
+
+	found, err := st.FindAccessRequest(req.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := found.Decide(AccessRequestApproved, "bob"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(st.PendingAccessRequests()) != 0 {
+		t.Errorf("expected no pending access requests after approval")
+	}
+
+	if err := found.Decide(AccessRequestDenied, "bob"); err == nil {
+		t.Error("expected error when deciding an already decided request")
+	}
+
+	found.Reopen()
+	if len(st.PendingAccessRequests()) != 1 || found.DecidedBy != "" || !found.DecidedAt.IsZero() {
+		t.Errorf("expected the reopened request to be pending again, got %+v", found)
+	}
+
+	if _, err := st.FindAccessRequest("missing"); err == nil {
+		t.Error("expected error for unknown request ID")
+	}
+}
+
+func TestAccessRequestDecideSelfApproval(t *testing.T) {
+	req, err := NewAccessRequest("203.0.113.10", 22, "", "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := req.Decide(AccessRequestApproved, "alice"); err == nil {
+		t.Fatal("expected the requester to be refused approving their own request")
+	}
+	if req.Status != AccessRequestPending {
+		t.Errorf("expected the request to stay pending, got %s", req.Status)
+	}
+
+	// Withdrawing a request is still up to the requester
+	if err := req.Decide(AccessRequestDenied, "alice"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSelfIPs(t *testing.T) {
+	st := &State{}
+
+	if st.FindSelfIP("laptop", "fw-1", 22) != nil {
+		t.Fatal("expected no self IP in empty state")
+	}
+
+	st.SetSelfIP("laptop", "fw-1", 22, "203.0.113.5")
+	st.SetSelfIP("desktop", "fw-1", 22, "192.0.2.10")
+	st.SetSelfIP("laptop", "fw-1", 22, "198.51.100.7")
+
+	if len(st.SelfIPs) != 2 {
+		t.Fatalf("expected one entry per machine, got %+v", st.SelfIPs)
+	}
+
+	entry := st.FindSelfIP("laptop", "fw-1", 22)
+	if entry == nil || entry.IP != "198.51.100.7" {
+		t.Errorf("expected laptop self IP 198.51.100.7, got %+v", entry)
+	}
+
+	if st.FindSelfIP("laptop", "fw-1", 2222) != nil {
+		t.Error("expected self IPs to be tracked per port")
+	}
+}
+
+func TestLastSuccessfulRun(t *testing.T) {
+	st := &State{}
+
+	if !st.LastSuccessfulRun("fw-1").IsZero() {
+		t.Fatal("expected no successful run in empty state")
+	}
+
+	first := time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	st.SetLastSuccessfulRun("fw-1", first)
+	st.SetLastSuccessfulRun("fw-2", first)
+	st.SetLastSuccessfulRun("fw-1", second)
+
+	if len(st.Runs) != 2 {
+		t.Fatalf("expected one record per firewall, got %+v", st.Runs)
+	}
+	if got := st.LastSuccessfulRun("fw-1"); !got.Equal(second) {
+		t.Errorf("expected last run %s, got %s", second, got)
+	}
+	if got := st.LastSuccessfulRun("fw-2"); !got.Equal(first) {
+		t.Errorf("expected last run %s, got %s", first, got)
+	}
+}
+
+func TestAppliedConfigHash(t *testing.T) {
+	st := &State{}
+	if got := st.AppliedConfigHash("fw-1"); got != "" {
+		t.Fatalf("expected no config hash in empty state, got %q", got)
+	}
+
+	at := time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC)
+	st.SetLastSuccessfulRun("fw-1", at)
+	st.SetAppliedConfigHash("fw-1", "abc")
+	st.SetAppliedConfigHash("fw-2", "def")
+	// A later run keeps the hash until it records its own
+	st.SetLastSuccessfulRun("fw-1", at.Add(time.Hour))
+
+	if len(st.Runs) != 2 {
+		t.Fatalf("expected one record per firewall, got %+v", st.Runs)
+	}
+	if got := st.AppliedConfigHash("fw-1"); got != "abc" {
+		t.Errorf("expected config hash abc, got %q", got)
+	}
+	if got := st.AppliedConfigHash("fw-2"); got != "def" {
+		t.Errorf("expected config hash def, got %q", got)
+	}
+}
+
+func TestDaemonRecord(t *testing.T) {
+	st := &State{}
+	startedAt := time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC)
+	stoppedAt := startedAt.Add(time.Hour)
+
+	st.RecordDaemonStart(DaemonRecord{StartedAt: startedAt, PID: 42, ConfigHash: "abc"})
+	// A daemon that exited after another one started must not mark the new one stopped
+	st.RecordDaemonStop(41, stoppedAt)
+	if st.Daemon.StoppedAt != nil {
+		t.Fatalf("expected the daemon of another process to be left alone, got %+v", st.Daemon)
+	}
+
+	st.RecordDaemonStop(42, stoppedAt)
+	if st.Daemon.StoppedAt == nil || !st.Daemon.StoppedAt.Equal(stoppedAt) {
+		t.Fatalf("expected the daemon stopped at %s, got %+v", stoppedAt, st.Daemon)
+	}
+
+	st.RecordDaemonStart(DaemonRecord{StartedAt: stoppedAt, PID: 43, ConfigHash: "def"})
+	if st.Daemon.StoppedAt != nil || st.Daemon.PID != 43 || st.Daemon.ConfigHash != "def" {
+		t.Errorf("expected the record of the restarted daemon, got %+v", st.Daemon)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	st := &State{}
+
+	if st.ActiveFreeze("fw-1") != nil {
+		t.Fatal("expected no freeze in empty state")
+	}
+
+	st.SetFreeze(Freeze{FirewallID: "fw-1", Reason: "incident"})
+	st.SetFreeze(Freeze{FirewallID: "fw-2"})
+	st.SetFreeze(Freeze{FirewallID: "fw-1", Reason: "still investigating"})
+
+	if len(st.Freezes) != 2 {
+		t.Fatalf("expected one freeze per firewall, got %+v", st.Freezes)
+	}
+	if freeze := st.ActiveFreeze("fw-1"); freeze == nil || freeze.Reason != "still investigating" {
+		t.Errorf("expected updated freeze for fw-1, got %+v", freeze)
+	}
+
+	if !st.RemoveFreeze("fw-1") {
+		t.Error("expected freeze for fw-1 to be removed")
+	}
+	if st.RemoveFreeze("fw-1") {
+		t.Error("expected no freeze left to remove for fw-1")
+	}
+	if st.ActiveFreeze("fw-2") == nil {
+		t.Error("expected freeze for fw-2 to remain")
+	}
+}
+
+func TestLastDigest(t *testing.T) {
+	st := &State{}
+
+	if !st.LastDigest("fw-1").IsZero() {
+		t.Fatal("expected no digest in empty state")
+	}
+
+	first := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+	st.SetLastDigest("fw-1", first)
+	st.SetLastDigest("fw-1", second)
+
+	if len(st.Digests) != 1 {
+		t.Fatalf("expected one record per firewall, got %+v", st.Digests)
+	}
+	if got := st.LastDigest("fw-1"); !got.Equal(second) {
+		t.Errorf("expected last digest %s, got %s", second, got)
+	}
+}
+
+func TestAccessGrants(t *testing.T) {
+	now := time.Date(2025, 1, 8, 12, 0, 0, 0, time.UTC)
+	st := &State{
+		AccessGrants: []AccessGrant{
+			{ID: "expired", FirewallID: "fw-1", Port: 22, IP: "203.0.113.5", ExpiresAt: now.Add(-time.Minute), LinkExpiresAt: now.Add(time.Hour)},
+			{ID: "active", FirewallID: "fw-1", Port: 22, IP: "203.0.113.5", ExpiresAt: now.Add(time.Hour), LinkExpiresAt: now.Add(time.Hour)},
+			{ID: "other-firewall", FirewallID: "fw-2", Port: 22, IP: "192.0.2.10", ExpiresAt: now.Add(-time.Minute), LinkExpiresAt: now.Add(time.Hour)},
+			{ID: "forgettable", FirewallID: "fw-1", Port: 22, IP: "192.0.2.10", ExpiresAt: now.Add(-2 * time.Hour), LinkExpiresAt: now.Add(-time.Hour), Closed: true},
+		},
+	}
+
+	due := st.DueAccessGrants("fw-1", now)
+	if len(due) != 1 || due[0].ID != "expired" {
+		t.Fatalf("expected only the expired fw-1 grant to be due, got %+v", due)
+	}
+
+	if !st.GrantIPInUse("fw-1", 22, "203.0.113.5", now) {
+		t.Error("expected address still in use by the active grant")
+	}
+	if st.GrantIPInUse("fw-1", 22, "192.0.2.10", now) {
+		t.Error("expected closed grant not to keep its address in use")
+	}
+
+	due[0].Closed = true
+	st.PruneAccessGrants(now)
+	if len(st.AccessGrants) != 3 || st.FindAccessGrant("forgettable") != nil {
+		t.Errorf("expected only the closed grant whose link expired to be forgotten, got %+v", st.AccessGrants)
+	}
+	if grant := st.FindAccessGrant("expired"); grant == nil || !grant.Closed {
+		t.Errorf("expected closed grant to be kept until its link expires, got %+v", grant)
+	}
+}
+
+func TestRecordSourceSize(t *testing.T) {
+	st := &State{}
+	start := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+
+	if previous := st.RecordSourceSize("fw-1", "cloudflare", 22, start); previous != nil {
+		t.Fatalf("expected no previous sample, got %+v", previous)
+	}
+	st.RecordSourceSize("fw-1", "netdata", 4, start)
+	previous := st.RecordSourceSize("fw-1", "cloudflare", 11, start.Add(time.Hour))
+	if previous == nil || previous.Count != 22 {
+		t.Fatalf("expected the previous cloudflare sample, got %+v", previous)
+	}
+	if change := previous.ChangePercent(11); change != 50 {
+		t.Errorf("expected a 50%% change, got %v", change)
+	}
+
+	for i := 0; i < maxSourceSizes+5; i++ {
+		st.RecordSourceSize("fw-1", "cloudflare", i, start.Add(time.Duration(i+2)*time.Hour))
+	}
+	history := st.SourceSizeHistory("fw-1", "cloudflare")
+	if len(history) != maxSourceSizes || history[len(history)-1].Count != maxSourceSizes+4 {
+		t.Errorf("expected the newest %d samples, got %d ending in %+v", maxSourceSizes, len(history), history[len(history)-1])
+	}
+	if netdata := st.SourceSizeHistory("fw-1", "netdata"); len(netdata) != 1 {
+		t.Errorf("expected other sources to be kept, got %+v", netdata)
+	}
+}
+
+func TestCacheSource(t *testing.T) {
+	st := &State{}
+	first := time.Date(2025, 1, 8, 9, 0, 0, 0, time.UTC)
+
+	if st.CachedSource("cloudflare", "v1") != nil {
+		t.Fatal("expected no cached source in empty state")
+	}
+
+	st.CacheSource("cloudflare", "v1", []string{"173.245.48.0/20"}, first)
+	st.CacheSource("netdata", "v1", []string{"198.51.100.7"}, first)
+	st.CacheSource("cloudflare", "v1", []string{"103.21.244.0/22", "173.245.48.0/20"}, first.Add(time.Hour))
+
+	if len(st.SourceCache) != 2 {
+		t.Fatalf("expected one entry per source, got %+v", st.SourceCache)
+	}
+	cached := st.CachedSource("cloudflare", "v1")
+	if cached == nil || len(cached.Addresses) != 2 || !cached.CollectedAt.Equal(first.Add(time.Hour)) {
+		t.Errorf("expected the latest cloudflare collection, got %+v", cached)
+	}
+
+	// A source collected with other settings is not served from the cache until collected again
+	if cached := st.CachedSource("cloudflare", "v2"); cached != nil {
+		t.Errorf("expected no cached collection with other settings, got %+v", cached)
+	}
+	st.CacheSource("cloudflare", "v2", []string{"104.16.0.0/13"}, first.Add(2*time.Hour))
+	if len(st.SourceCache) != 2 || st.CachedSource("cloudflare", "v1") != nil {
+		t.Errorf("expected the new collection to replace the old one, got %+v", st.SourceCache)
+	}
+}
+
+func TestChangePercent(t *testing.T) {
+	tests := []struct {
+		previous int
+		count    int
+		expected float64
+	}{
+		{previous: 20, count: 30, expected: 50},
+		{previous: 20, count: 5, expected: 75},
+		{previous: 20, count: 20, expected: 0},
+		{previous: 0, count: 0, expected: 0},
+		{previous: 0, count: 3, expected: 100},
+	}
+
+	for _, tt := range tests {
+		if got := (SourceSize{Count: tt.previous}).ChangePercent(tt.count); got != tt.expected {
+			t.Errorf("%d -> %d: expected %v, got %v", tt.previous, tt.count, tt.expected, got)
+		}
+	}
+}
+
+func TestManagedPorts(t *testing.T) {
+	st := &State{}
+
+	if ports := st.ManagedPorts("fw-1"); len(ports) != 0 {
+		t.Fatalf("expected no managed ports in empty state, got %v", ports)
+	}
+
+	st.RecordManagedPorts("fw-1", []int{443, 22})
+	st.RecordManagedPorts("fw-2", []int{80})
+	st.RecordManagedPorts("fw-1", []int{8080, 22})
+
+	if got := st.ManagedPorts("fw-1"); !slices.Equal(got, []int{22, 443, 8080}) {
+		t.Errorf("expected sorted union of recorded ports, got %v", got)
+	}
+
+	st.ForgetManagedPorts("fw-1", []int{8080, 9090})
+	if got := st.ManagedPorts("fw-1"); !slices.Equal(got, []int{22, 443}) {
+		t.Errorf("expected port 8080 to be forgotten, got %v", got)
+	}
+	if got := st.ManagedPorts("fw-2"); !slices.Equal(got, []int{80}) {
+		t.Errorf("expected other firewalls to be unchanged, got %v", got)
+	}
+}
+
+func TestPortsInUse(t *testing.T) {
+	st := &State{}
+	st.SetDynamicDNS("home.example.com", "fw-1", 22, []string{"198.51.100.7"})
+	st.SetSelfIP("laptop", "fw-1", 2222, "203.0.113.5")
+	st.SetDynamicDNS("office.example.com", "fw-2", 8022, []string{"198.51.100.8"})
+
+	ports := st.PortsInUse("fw-1")
+	if len(ports) != 2 || !ports[22] || !ports[2222] {
+		t.Errorf("expected ports 22 and 2222 in use on fw-1, got %v", ports)
+	}
+}
+
+func TestMovePort(t *testing.T) {
+	st := &State{}
+	st.SetDynamicDNS("home.example.com", "fw-1", 2222, []string{"198.51.100.7"})
+	st.SetSelfIP("laptop", "fw-1", 2222, "203.0.113.5")
+	st.SetSelfIP("laptop", "fw-2", 2222, "203.0.113.5")
+	st.ManagedRules = append(st.ManagedRules, ManagedRule{FirewallID: "fw-1", Port: 2222, Protocol: "tcp"})
+	st.RecordManagedPorts("fw-1", []int{443, 2222})
+
+	if moved := st.MovePort("fw-1", 2222, 22022); moved != 4 {
+		t.Errorf("expected 4 moved records, got %d", moved)
+	}
+
+	if st.FindDynamicDNS("home.example.com", "fw-1", 22022) == nil {
+		t.Error("expected dynamic DNS record to move to port 22022")
+	}
+	if st.FindSelfIP("laptop", "fw-1", 22022) == nil {
+		t.Error("expected self IP to move to port 22022")
+	}
+	if st.FindSelfIP("laptop", "fw-2", 2222) == nil {
+		t.Error("expected records of other firewalls to stay on port 2222")
+	}
+	if st.ManagedRules[0].Port != 22022 {
+		t.Errorf("expected managed rule to move to port 22022, got %d", st.ManagedRules[0].Port)
+	}
+	if got := st.ManagedPorts("fw-1"); !slices.Equal(got, []int{443, 22022}) {
+		t.Errorf("expected managed ports [443 22022], got %v", got)
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	path := filepath.Join(t.TempDir(), "state.snapshots.json")
+	store := NewSnapshotStore(path, 2, logger)
+
+	taken := time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC)
+	for i, firewallID := range []string{"fw-1", "fw-2", "fw-1", "fw-1"} {
+		err := store.Record(FirewallSnapshot{FirewallID: firewallID, Action: "update_inbound_rules", TakenAt: taken.Add(time.Duration(i) * time.Hour)})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// A new store reads what the first one wrote
+	snapshots, err := NewSnapshotStore(path, 2, logger).List("fw-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 2 || !snapshots[0].TakenAt.Equal(taken.Add(3*time.Hour)) || !snapshots[1].TakenAt.Equal(taken.Add(2*time.Hour)) {
+		t.Fatalf("expected the 2 newest snapshots of fw-1, newest first, got %+v", snapshots)
+	}
+	if others, _ := store.List("fw-2"); len(others) != 1 {
+		t.Errorf("expected the snapshot of fw-2 to be kept, got %+v", others)
+	}
+
+	disabled := NewSnapshotStore(filepath.Join(t.TempDir(), "none.json"), 0, logger)
+	if err := disabled.Record(FirewallSnapshot{FirewallID: "fw-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshots, _ := disabled.List("fw-1"); len(snapshots) != 0 {
+		t.Errorf("expected no snapshots recorded with keep 0, got %+v", snapshots)
+	}
+}
+
+func TestSelectSnapshot(t *testing.T) {
+	newest := time.Date(2025, 1, 8, 12, 0, 0, 0, time.UTC)
+	snapshots := []FirewallSnapshot{
+		{FirewallID: "fw-1", TakenAt: newest},
+		{FirewallID: "fw-1", TakenAt: newest.Add(-time.Hour)},
+		{FirewallID: "fw-1", TakenAt: newest.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		name        string
+		selector    string
+		expected    time.Time
+		expectError bool
+	}{
+		{name: "newest by default", expected: newest},
+		{name: "by index", selector: "2", expected: newest.Add(-2 * time.Hour)},
+		{name: "index out of range", selector: "3", expectError: true},
+		{name: "by exact timestamp", selector: "2025-01-08T11:00:00Z", expected: newest.Add(-time.Hour)},
+		{name: "newest before a timestamp", selector: "2025-01-08T11:30:00Z", expected: newest.Add(-time.Hour)},
+		{name: "timestamp before every snapshot", selector: "2025-01-08T09:00:00Z", expectError: true},
+		{name: "invalid selector", selector: "yesterday", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := SelectSnapshot(snapshots, tt.selector)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", snapshot)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !snapshot.TakenAt.Equal(tt.expected) {
+				t.Errorf("expected snapshot of %s, got %s", tt.expected, snapshot.TakenAt)
+			}
+		})
+	}
+
+	if _, err := SelectSnapshot(nil, ""); err == nil {
+		t.Error("expected error without snapshots")
+	}
+}
@@ -0,0 +1,128 @@
+package tracecontext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Header is the W3C Trace Context HTTP header carrying the caller's span
+	Header = "traceparent"
+	// EnvVar carries the traceparent to processes started by automation such as CI pipelines
+	EnvVar = "TRACEPARENT"
+)
+
+// sampledFlag is the trace-flags bit recording that the caller sampled the trace
+const sampledFlag = 0x01
+
+var (
+	// ErrInvalid is returned by Parse for a malformed traceparent
+	ErrInvalid = errors.New("invalid traceparent")
+
+	zeroTraceID = strings.Repeat("0", 32)
+	zeroSpanID  = strings.Repeat("0", 16)
+)
+
+// SpanContext identifies a span within a distributed trace
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	// ParentID is the span this span was started from, empty for a span received from a caller
+	ParentID string
+	Sampled  bool
+}
+
+type contextKey struct{}
+
+// Parse parses a W3C traceparent value such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 into the caller's span
+func Parse(value string) (SpanContext, error) {
+	value = strings.TrimSpace(value)
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 {
+		return SpanContext{}, fmt.Errorf("%w: expected version-traceid-parentid-flags", ErrInvalid)
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isHex(version, 2) || version == "ff" {
+		return SpanContext{}, fmt.Errorf("%w: unsupported version %q", ErrInvalid, version)
+	}
+	// Version 00 has exactly four fields; later versions may append more, which are ignored
+	if version == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("%w: unexpected fields after trace flags", ErrInvalid)
+	}
+	if !isHex(traceID, 32) || traceID == zeroTraceID {
+		return SpanContext{}, fmt.Errorf("%w: trace ID must be 32 lowercase hex digits, not all zero", ErrInvalid)
+	}
+	if !isHex(spanID, 16) || spanID == zeroSpanID {
+		return SpanContext{}, fmt.Errorf("%w: parent ID must be 16 lowercase hex digits, not all zero", ErrInvalid)
+	}
+	if !isHex(flags, 2) {
+		return SpanContext{}, fmt.Errorf("%w: trace flags must be 2 lowercase hex digits", ErrInvalid)
+	}
+
+	decoded, _ := hex.DecodeString(flags)
+	return SpanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: decoded[0]&sampledFlag != 0,
+	}, nil
+}
+
+// String formats the span as a version 00 traceparent value
+func (s SpanContext) String() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceID, s.SpanID, flags)
+}
+
+// Child starts a new span in the same trace with this span as its parent
+func (s SpanContext) Child() SpanContext {
+	return SpanContext{
+		TraceID:  s.TraceID,
+		SpanID:   newSpanID(),
+		ParentID: s.SpanID,
+		Sampled:  s.Sampled,
+	}
+}
+
+// NewContext returns a copy of ctx carrying the span
+func NewContext(ctx context.Context, span SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+// FromContext returns the span carried by ctx, if any
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	span, ok := ctx.Value(contextKey{}).(SpanContext)
+	return span, ok
+}
+
+// newSpanID returns a random non-zero span ID
+func newSpanID() string {
+	b := make([]byte, 8)
+	for {
+		_, _ = rand.Read(b)
+		if id := hex.EncodeToString(b); id != zeroSpanID {
+			return id
+		}
+	}
+}
+
+// isHex reports whether s consists of exactly n lowercase hex digits
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package tracecontext
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expectError bool
+		expected    SpanContext
+	}{
+		{
+			name:  "sampled",
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expected: SpanContext{
+				TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				SpanID:  "00f067aa0ba902b7",
+				Sampled: true,
+			},
+		},
+		{
+			name:  "not sampled with surrounding whitespace",
+			value: " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00\n",
+			expected: SpanContext{
+				TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				SpanID:  "00f067aa0ba902b7",
+			},
+		},
+		{
+			name:  "future version with extra fields",
+			value: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			expected: SpanContext{
+				TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				SpanID:  "00f067aa0ba902b7",
+				Sampled: true,
+			},
+		},
+		{name: "empty", value: "", expectError: true},
+		{name: "version ff", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expectError: true},
+		{name: "version 00 with extra fields", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", expectError: true},
+		{name: "zero trace ID", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", expectError: true},
+		{name: "zero parent ID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", expectError: true},
+		{name: "uppercase trace ID", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", expectError: true},
+		{name: "short parent ID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, err := Parse(tt.value)
+			if tt.expectError {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("expected ErrInvalid, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if span != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, span)
+			}
+		})
+	}
+}
+
+func TestChild(t *testing.T) {
+	parent, err := Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	child := parent.Child()
+	if child.TraceID != parent.TraceID || child.ParentID != parent.SpanID || !child.Sampled {
+		t.Errorf("expected child in the same trace with the caller as parent, got %+v", child)
+	}
+	if !isHex(child.SpanID, 16) || child.SpanID == parent.SpanID {
+		t.Errorf("expected a new span ID, got %s", child.SpanID)
+	}
+
+	// The child's traceparent propagates onward to anything it calls
+	roundTrip, err := Parse(child.String())
+	if err != nil || roundTrip.SpanID != child.SpanID {
+		t.Errorf("expected child traceparent to round-trip, got %+v (%v)", roundTrip, err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatal("expected no span in empty context")
+	}
+
+	span := SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	got, ok := FromContext(NewContext(context.Background(), span))
+	if !ok || got != span {
+		t.Errorf("expected %+v from context, got %+v", span, got)
+	}
+}
@@ -0,0 +1,126 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI color codes
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+	colorDim    = "\033[2m"
+)
+
+// Printer writes concise human-readable progress output, separate from structured logs
+type Printer struct {
+	out   io.Writer
+	color bool
+	quiet bool
+}
+
+// NewPrinter creates a printer for the given file, enabling colors only on terminals
+// and honoring the NO_COLOR convention
+func NewPrinter(f *os.File) *Printer {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return &Printer{
+		out:   f,
+		color: IsTerminal(f) && !noColor,
+	}
+}
+
+// NewPlainPrinter creates a printer that never emits colors
+func NewPlainPrinter(w io.Writer) *Printer {
+	return &Printer{out: w}
+}
+
+// SetQuiet suppresses everything except warnings and failures
+func (p *Printer) SetQuiet(quiet bool) {
+	p.quiet = quiet
+}
+
+// Step announces a step that is about to start
+func (p *Printer) Step(format string, args ...any) {
+	if p.quiet {
+		return
+	}
+	p.print(colorCyan, "→", format, args...)
+}
+
+// Success reports a step that completed successfully
+func (p *Printer) Success(format string, args ...any) {
+	if p.quiet {
+		return
+	}
+	p.print(colorGreen, "✔", format, args...)
+}
+
+// Warn reports a non-fatal problem
+func (p *Printer) Warn(format string, args ...any) {
+	p.print(colorYellow, "⚠", format, args...)
+}
+
+// Fail reports a step that failed
+func (p *Printer) Fail(format string, args ...any) {
+	p.print(colorRed, "✖", format, args...)
+}
+
+// Detail prints an indented supplementary line
+func (p *Printer) Detail(format string, args ...any) {
+	if p.quiet {
+		return
+	}
+	p.print(colorDim, " ", format, args...)
+}
+
+// Added prints a diff line for something a change adds, indented by depth levels
+func (p *Printer) Added(depth int, format string, args ...any) {
+	p.diff(colorGreen, "+", depth, format, args...)
+}
+
+// Removed prints a diff line for something a change removes, indented by depth levels
+func (p *Printer) Removed(depth int, format string, args ...any) {
+	p.diff(colorRed, "-", depth, format, args...)
+}
+
+// Changed prints a diff line for something a change modifies, indented by depth levels
+func (p *Printer) Changed(depth int, format string, args ...any) {
+	p.diff(colorYellow, "~", depth, format, args...)
+}
+
+// diff prints a whole diff line in the color of its symbol
+func (p *Printer) diff(color, symbol string, depth int, format string, args ...any) {
+	if p.quiet {
+		return
+	}
+	indent := strings.Repeat("  ", depth)
+	msg := fmt.Sprintf(format, args...)
+	if p.color {
+		fmt.Fprintf(p.out, "%s%s%s %s%s\n", indent, color, symbol, msg, colorReset)
+		return
+	}
+	fmt.Fprintf(p.out, "%s%s %s\n", indent, symbol, msg)
+}
+
+func (p *Printer) print(color, symbol, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if p.color {
+		fmt.Fprintf(p.out, "%s%s%s %s\n", color, symbol, colorReset, msg)
+		return
+	}
+	fmt.Fprintf(p.out, "%s %s\n", symbol, msg)
+}
+
+// IsTerminal reports whether the file is an interactive character device
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPlainPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPlainPrinter(&buf)
+
+	p.Step("Testing %s", "connectivity")
+	p.Success("Done")
+	p.Warn("Careful")
+	p.Fail("Broken: %d", 42)
+	p.Detail("more info")
+
+	expected := "→ Testing connectivity\n✔ Done\n⚠ Careful\n✖ Broken: 42\n  more info\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+}
+
+func TestColorPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	p := &Printer{out: &buf, color: true}
+
+	p.Success("Done")
+
+	expected := colorGreen + "✔" + colorReset + " Done\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+}
+
+func TestQuietPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPlainPrinter(&buf)
+	p.SetQuiet(true)
+
+	p.Step("Testing")
+	p.Success("Done")
+	p.Detail("more info")
+	p.Warn("Careful")
+	p.Fail("Broken")
+
+	expected := "⚠ Careful\n✖ Broken\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPlainPrinter(&buf)
+
+	p.Changed(1, "tcp/443")
+	p.Added(2, "203.0.113.0/24")
+	p.Removed(2, "198.51.100.0/24")
+
+	expected := "  ~ tcp/443\n    + 203.0.113.0/24\n    - 198.51.100.0/24\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	colored := &Printer{out: &buf, color: true}
+	colored.Removed(0, "tcp/22")
+	if expected := colorRed + "- tcp/22" + colorReset + "\n"; buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+}
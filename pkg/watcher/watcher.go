@@ -0,0 +1,139 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// IPDetector detects the current public IP address
+type IPDetector interface {
+	GetPublicIPWithRetry(ctx context.Context, maxRetries int) (string, error)
+}
+
+// SSHRuleUpdater points the SSH rule for a port at a new IP, removing the previous one
+type SSHRuleUpdater interface {
+	ReplaceSSHSource(ctx context.Context, firewallID string, previousIP string, sourceIP string, port int) error
+}
+
+// Watcher periodically re-detects the public IP and updates the SSH rule when it changes
+type Watcher struct {
+	detector   IPDetector
+	updater    SSHRuleUpdater
+	firewallID string
+	port       int
+	interval   time.Duration
+	dryRun     bool
+	logger     *zap.Logger
+
+	currentIP string
+	onChange  func(ip string) error
+}
+
+// NewWatcher creates a new IP watcher for the SSH rule on the given port
+func NewWatcher(
+	detector IPDetector,
+	updater SSHRuleUpdater,
+	firewallID string,
+	port int,
+	interval time.Duration,
+	dryRun bool,
+	logger *zap.Logger,
+) *Watcher {
+	return &Watcher{
+		detector:   detector,
+		updater:    updater,
+		firewallID: firewallID,
+		port:       port,
+		interval:   interval,
+		dryRun:     dryRun,
+		logger:     logger.Named("watcher"),
+	}
+}
+
+// SetPreviousIP sets the address the SSH rule pointed at before the watcher started, so
+// it is replaced on the first change
+func (w *Watcher) SetPreviousIP(ip string) {
+	w.currentIP = ip
+}
+
+// SetOnChange installs a hook called after the SSH rule was updated to a new IP
+func (w *Watcher) SetOnChange(fn func(ip string) error) {
+	w.onChange = fn
+}
+
+// CurrentIP returns the IP address the SSH rule currently points at
+func (w *Watcher) CurrentIP() string {
+	return w.currentIP
+}
+
+// Run checks the public IP immediately and then on every interval until the context is done
+func (w *Watcher) Run(ctx context.Context) error {
+	w.logger.Info("Watching public IP for changes",
+		zap.String("firewall_id", w.firewallID),
+		zap.Int("port", w.port),
+		zap.Duration("interval", w.interval),
+		zap.Bool("dry_run", w.dryRun))
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		// A failed check is retried on the next tick instead of stopping the watcher
+		if _, err := w.Check(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			w.logger.Error("Failed to refresh SSH rule", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Stopped watching public IP")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check detects the public IP once and updates the SSH rule if it changed, reporting
+// whether an update was made
+func (w *Watcher) Check(ctx context.Context) (bool, error) {
+	ip, err := w.detector.GetPublicIPWithRetry(ctx, 3)
+	if err != nil {
+		return false, fmt.Errorf("failed to detect current public IP: %w", err)
+	}
+
+	if ip == w.currentIP {
+		w.logger.Debug("Public IP unchanged", zap.String("ip", ip))
+		return false, nil
+	}
+
+	w.logger.Info("Public IP changed, updating SSH rule",
+		zap.String("previous_ip", w.currentIP),
+		zap.String("ip", ip),
+		zap.Int("port", w.port))
+
+	if w.dryRun {
+		w.logger.Info("DRY RUN: Would replace previous IP in SSH rule",
+			zap.String("firewall_id", w.firewallID),
+			zap.String("previous_ip", w.currentIP),
+			zap.String("ip", ip))
+		w.currentIP = ip
+		return true, nil
+	}
+
+	if err := w.updater.ReplaceSSHSource(ctx, w.firewallID, w.currentIP, ip, w.port); err != nil {
+		return false, fmt.Errorf("failed to update SSH rule: %w", err)
+	}
+
+	w.currentIP = ip
+	if w.onChange != nil {
+		if err := w.onChange(ip); err != nil {
+			return true, fmt.Errorf("failed to record new IP: %w", err)
+		}
+	}
+	return true, nil
+}
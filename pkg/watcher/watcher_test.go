@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeDetector struct {
+	ips []string
+	err error
+}
+
+func (f *fakeDetector) GetPublicIPWithRetry(ctx context.Context, maxRetries int) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	ip := f.ips[0]
+	if len(f.ips) > 1 {
+		f.ips = f.ips[1:]
+	}
+	return ip, nil
+}
+
+type replacement struct {
+	previous string
+	current  string
+}
+
+type fakeUpdater struct {
+	replacements []replacement
+}
+
+func (f *fakeUpdater) ReplaceSSHSource(ctx context.Context, firewallID, previousIP, sourceIP string, port int) error {
+	f.replacements = append(f.replacements, replacement{previous: previousIP, current: sourceIP})
+	return nil
+}
+
+func TestWatcherCheck(t *testing.T) {
+	detector := &fakeDetector{ips: []string{"203.0.113.5", "203.0.113.5", "198.51.100.7"}}
+	updater := &fakeUpdater{}
+	w := NewWatcher(detector, updater, "fw-1", 22, time.Minute, false, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	expectedChanges := []bool{true, false, true}
+	for i, expected := range expectedChanges {
+		changed, err := w.Check(ctx)
+		if err != nil {
+			t.Fatalf("check %d: unexpected error: %v", i, err)
+		}
+		if changed != expected {
+			t.Errorf("check %d: expected changed=%v, got %v", i, expected, changed)
+		}
+	}
+
+	expected := []replacement{
+		{previous: "", current: "203.0.113.5"},
+		{previous: "203.0.113.5", current: "198.51.100.7"},
+	}
+	if len(updater.replacements) != len(expected) {
+		t.Fatalf("expected %d replacements, got %+v", len(expected), updater.replacements)
+	}
+	for i := range expected {
+		if updater.replacements[i] != expected[i] {
+			t.Errorf("replacement %d: expected %+v, got %+v", i, expected[i], updater.replacements[i])
+		}
+	}
+
+	if w.CurrentIP() != "198.51.100.7" {
+		t.Errorf("expected current IP 198.51.100.7, got %s", w.CurrentIP())
+	}
+}
+
+func TestWatcherDryRun(t *testing.T) {
+	updater := &fakeUpdater{}
+	w := NewWatcher(&fakeDetector{ips: []string{"203.0.113.5"}}, updater, "fw-1", 22, time.Minute, true, zaptest.NewLogger(t))
+
+	if _, err := w.Check(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updater.replacements) != 0 {
+		t.Errorf("expected no firewall updates in dry-run mode, got %+v", updater.replacements)
+	}
+}
+
+func TestWatcherRunStopsOnCancel(t *testing.T) {
+	w := NewWatcher(&fakeDetector{err: errors.New("offline")}, &fakeUpdater{}, "fw-1", 22,
+		10*time.Millisecond, false, zaptest.NewLogger(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := w.Run(ctx); err != nil {
+		t.Errorf("expected clean stop, got %v", err)
+	}
+}
+
+func TestWatcherResumesFromPreviousIP(t *testing.T) {
+	updater := &fakeUpdater{}
+	w := NewWatcher(&fakeDetector{ips: []string{"198.51.100.7"}}, updater, "fw-1", 22, time.Minute, false, zaptest.NewLogger(t))
+	w.SetPreviousIP("203.0.113.5")
+
+	var recorded []string
+	w.SetOnChange(func(ip string) error {
+		recorded = append(recorded, ip)
+		return nil
+	})
+
+	if _, err := w.Check(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(updater.replacements) != 1 || updater.replacements[0].previous != "203.0.113.5" {
+		t.Errorf("expected previous IP to be replaced, got %+v", updater.replacements)
+	}
+	if len(recorded) != 1 || recorded[0] != "198.51.100.7" {
+		t.Errorf("expected new IP to be recorded, got %v", recorded)
+	}
+}